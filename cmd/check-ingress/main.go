@@ -0,0 +1,210 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"golang.org/x/oauth2/google"
+	computealpha "google.golang.org/api/compute/v0.alpha"
+	computebeta "google.golang.org/api/compute/v0.beta"
+	compute "google.golang.org/api/compute/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	backendconfigclient "k8s.io/ingress-gce/pkg/backendconfig/client/clientset/versioned"
+	ingctx "k8s.io/ingress-gce/pkg/context"
+	"k8s.io/ingress-gce/pkg/controller/translator"
+	"k8s.io/ingress-gce/pkg/ingresscheck"
+	"k8s.io/ingress-gce/pkg/storage"
+	"k8s.io/ingress-gce/pkg/utils"
+	namer_util "k8s.io/ingress-gce/pkg/utils/namer"
+
+	// Pull in the auth library for GCP.
+	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
+)
+
+// uidConfigMapName is the ConfigMap in kube-system holding the cluster UID
+// and firewall name, as written by the controller.
+const uidConfigMapName = "ingress-uid"
+
+var options struct {
+	kubeconfig         string
+	project            string
+	ingress            string
+	defaultBackend     string
+	defaultBackendPort string
+	defaultBackendGCE  string
+}
+
+func init() {
+	defaultKubeconfig := ""
+	if home := os.Getenv("HOME"); home != "" {
+		defaultKubeconfig = filepath.Join(home, ".kube", "config")
+	}
+	flag.StringVar(&options.kubeconfig, "kubeconfig", defaultKubeconfig, "absolute path to the kubeconfig file")
+	flag.StringVar(&options.project, "project", "", "GCP project of the cluster")
+	flag.StringVar(&options.ingress, "ingress", "", "namespace/name of the Ingress to check")
+	flag.StringVar(&options.defaultBackend, "default-backend-service", "kube-system/default-http-backend", "namespace/name of the default backend Service, as configured for the controller")
+	flag.StringVar(&options.defaultBackendPort, "default-backend-service-port", "http", "port of the default backend Service, as configured for the controller")
+	flag.StringVar(&options.defaultBackendGCE, "default-backend-gce-service", "", "backend service used as the default backend, as configured for the controller")
+}
+
+func main() {
+	flag.Parse()
+	drifts, err := run()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if drifts > 0 {
+		os.Exit(2)
+	}
+}
+
+// run prints the expected resources of the Ingress and the drifts of the
+// actual ones, and returns the number of drifts.
+func run() (int, error) {
+	if options.project == "" || options.ingress == "" {
+		return 0, fmt.Errorf("-project and -ingress are required")
+	}
+	ingName, err := utils.ToNamespacedName(options.ingress)
+	if err != nil {
+		return 0, fmt.Errorf("invalid -ingress: %v", err)
+	}
+	defaultBackend, err := utils.ToNamespacedName(options.defaultBackend)
+	if err != nil {
+		return 0, fmt.Errorf("invalid -default-backend-service: %v", err)
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", options.kubeconfig)
+	if err != nil {
+		return 0, err
+	}
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return 0, err
+	}
+	backendConfigClient, err := backendconfigclient.NewForConfig(config)
+	if err != nil {
+		return 0, err
+	}
+	namer, err := newNamer(kubeClient)
+	if err != nil {
+		return 0, err
+	}
+	ing, err := kubeClient.NetworkingV1beta1().Ingresses(ingName.Namespace).Get(ingName.Name, metav1.GetOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("error getting Ingress %v: %v", ingName, err)
+	}
+
+	// The translator only reads the Services and BackendConfigs, the other
+	// informers of the context are not started.
+	defaultBackendID := utils.ServicePortID{Service: defaultBackend, Port: intstr.FromString(options.defaultBackendPort)}
+	ctx := ingctx.NewControllerContext(kubeClient, nil, backendConfigClient, nil, nil, namer, ingctx.ControllerContextConfig{
+		Namespace:             metav1.NamespaceAll,
+		DefaultBackendSvcPort: utils.ServicePort{ID: defaultBackendID, ExternalBackendService: options.defaultBackendGCE},
+	})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go ctx.ServiceInformer.Run(stopCh)
+	go ctx.BackendConfigInformer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, ctx.ServiceInformer.HasSynced, ctx.BackendConfigInformer.HasSynced) {
+		return 0, fmt.Errorf("error syncing Services and BackendConfigs")
+	}
+	urlMap, errs := translator.NewTranslator(ctx).TranslateIngress(ing, defaultBackendID)
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	roots := ingresscheck.Expected(namer, ing, urlMap)
+	fmt.Println("Expected resources:")
+	ingresscheck.Print(os.Stdout, roots)
+
+	gce, err := newCloud(options.project)
+	if err != nil {
+		return 0, err
+	}
+	drifts := ingresscheck.NewChecker(gce, namer).Check(context.Background(), roots)
+	if len(drifts) == 0 {
+		fmt.Println("No drift.")
+		return 0, nil
+	}
+	fmt.Println("Drifts:")
+	for _, drift := range drifts {
+		fmt.Println(drift)
+	}
+	return len(drifts), nil
+}
+
+// newNamer returns the namer of the controller, given the cluster UID and
+// firewall name it saved. Unlike the controller, it never writes them.
+func newNamer(kubeClient kubernetes.Interface) (namer_util.IngressNamer, error) {
+	vault := storage.NewConfigMapVault(kubeClient, metav1.NamespaceSystem, uidConfigMapName)
+	uid, found, err := vault.Get(storage.UIDDataKey)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("cluster UID not found in ConfigMap %s/%s", metav1.NamespaceSystem, uidConfigMapName)
+	}
+	fwName, found, err := vault.Get(storage.ProviderDataKey)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		fwName = uid
+	}
+	return namer_util.NewNamer(uid, fwName), nil
+}
+
+// newCloud returns a client of the GCE API using the application default
+// credentials.
+func newCloud(project string) (cloud.Cloud, error) {
+	const computeScope = "https://www.googleapis.com/auth/compute"
+	client, err := google.DefaultClient(context.Background(), computeScope)
+	if err != nil {
+		return nil, err
+	}
+	service, err := compute.New(client)
+	if err != nil {
+		return nil, err
+	}
+	serviceAlpha, err := computealpha.New(client)
+	if err != nil {
+		return nil, err
+	}
+	serviceBeta, err := computebeta.New(client)
+	if err != nil {
+		return nil, err
+	}
+	return cloud.NewGCE(&cloud.Service{
+		GA:            service,
+		Alpha:         serviceAlpha,
+		Beta:          serviceBeta,
+		ProjectRouter: &cloud.SingleProjectRouter{ID: project},
+		RateLimiter:   &cloud.NopRateLimiter{},
+	}), nil
+}
@@ -368,7 +368,7 @@ func TestILBUpdate(t *testing.T) {
 			vip := ing.Status.LoadBalancer.Ingress[0].IP
 			t.Logf("Ingress %s/%s VIP = %s", s.Namespace, tc.ing.Name, vip)
 
-			if utils.IsGCEL7ILBIngress(ing) && !e2e.IsRfc1918Addr(vip) {
+			if utils.IsGCEL7ILBIngress(ing, nil) && !e2e.IsRfc1918Addr(vip) {
 				t.Fatalf("got %v, want RFC1918 address, ing: %v", vip, ing)
 			}
 
@@ -391,7 +391,7 @@ func TestILBUpdate(t *testing.T) {
 
 			vip = ing.Status.LoadBalancer.Ingress[0].IP
 			t.Logf("Ingress %s/%s VIP = %s", s.Namespace, tc.ingUpdate.Name, vip)
-			if utils.IsGCEL7ILBIngress(ing) && !e2e.IsRfc1918Addr(vip) {
+			if utils.IsGCEL7ILBIngress(ing, nil) && !e2e.IsRfc1918Addr(vip) {
 				t.Fatalf("got %v, want RFC1918 address, ing: %v", vip, ing)
 			}
 
@@ -551,7 +551,7 @@ func TestILBShared(t *testing.T) {
 
 				vip := ing.Status.LoadBalancer.Ingress[0].IP
 				t.Logf("Ingress %s/%s VIP = %s", s.Namespace, ing.Name, vip)
-				if utils.IsGCEL7ILBIngress(ing) && !e2e.IsRfc1918Addr(vip) {
+				if utils.IsGCEL7ILBIngress(ing, nil) && !e2e.IsRfc1918Addr(vip) {
 					t.Fatalf("got %v, want RFC1918 address, ing: %v", vip, ing)
 				}
 
@@ -0,0 +1,139 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	frontendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1"
+	backendconfigclient "k8s.io/ingress-gce/pkg/backendconfig/client/clientset/versioned"
+	frontendconfigclient "k8s.io/ingress-gce/pkg/frontendconfig/client/clientset/versioned"
+	"k8s.io/ingress-gce/pkg/gatewaymigration"
+
+	// Pull in the auth library for GCP.
+	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
+)
+
+var options struct {
+	kubeconfig      string
+	ns              string
+	output          string
+	frontendConfigs bool
+}
+
+func init() {
+	defaultKubeconfig := ""
+	if home := os.Getenv("HOME"); home != "" {
+		defaultKubeconfig = filepath.Join(home, ".kube", "config")
+	}
+	flag.StringVar(&options.kubeconfig, "kubeconfig", defaultKubeconfig, "absolute path to the kubeconfig file")
+	flag.StringVar(&options.ns, "ns", metav1.NamespaceAll, "namespace of the Ingresses to migrate, all namespaces if empty")
+	flag.StringVar(&options.output, "output", "", "file to write the generated manifests to, stdout if empty")
+	flag.BoolVar(&options.frontendConfigs, "frontend-configs", true, "read FrontendConfigs, disable if the CRD is not installed")
+}
+
+func main() {
+	flag.Parse()
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	config, err := clientcmd.BuildConfigFromFlags("", options.kubeconfig)
+	if err != nil {
+		return err
+	}
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	backendConfigClient, err := backendconfigclient.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	frontendConfigClient, err := frontendconfigclient.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	ings, err := kubeClient.NetworkingV1beta1().Ingresses(options.ns).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("error listing Ingresses: %v", err)
+	}
+	svcs, err := kubeClient.CoreV1().Services(options.ns).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("error listing Services: %v", err)
+	}
+	beConfigs, err := backendConfigClient.CloudV1beta1().BackendConfigs(options.ns).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("error listing BackendConfigs: %v", err)
+	}
+	var feConfigs []*frontendconfigv1beta1.FrontendConfig
+	if options.frontendConfigs {
+		list, err := frontendConfigClient.NetworkingV1beta1().FrontendConfigs(options.ns).List(metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("error listing FrontendConfigs: %v", err)
+		}
+		for i := range list.Items {
+			feConfigs = append(feConfigs, &list.Items[i])
+		}
+	}
+
+	svcLister := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for i := range svcs.Items {
+		svcLister.Add(&svcs.Items[i])
+	}
+	beConfigLister := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for i := range beConfigs.Items {
+		beConfigLister.Add(&beConfigs.Items[i])
+	}
+	result := gatewaymigration.NewConverter(svcLister, beConfigLister, feConfigs).Convert(ingressPointers(ings.Items))
+
+	var out io.Writer = os.Stdout
+	if options.output != "" {
+		f, err := os.Create(options.output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := result.WriteManifests(out); err != nil {
+		return fmt.Errorf("error writing manifests: %v", err)
+	}
+	return result.WriteReport(os.Stderr)
+}
+
+func ingressPointers(items []v1beta1.Ingress) []*v1beta1.Ingress {
+	var ings []*v1beta1.Ingress
+	for i := range items {
+		ings = append(ings, &items[i])
+	}
+	return ings
+}
@@ -0,0 +1,58 @@
+//go:build chaos
+// +build chaos
+
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	flag "github.com/spf13/pflag"
+	"k8s.io/klog"
+	"k8s.io/legacy-cloud-providers/gce"
+
+	"k8s.io/ingress-gce/pkg/chaos"
+)
+
+// chaosConfig is the configuration of the failures injected into the GCE API
+// calls, only set by the flags of the binaries built with the chaos tag.
+var chaosConfig chaos.Config
+
+func init() {
+	flag.Float64Var(&chaosConfig.ErrorRate, "chaos-gce-error-rate", 0,
+		`Optional, rate between 0 and 1 of the GCE API calls failing with a
+server error, to validate that the controller heals from failures.`)
+	flag.Float64Var(&chaosConfig.DelayRate, "chaos-gce-delay-rate", 0,
+		`Optional, rate between 0 and 1 of the GCE API calls, including the polls
+of operations, delayed by --chaos-gce-delay.`)
+	flag.DurationVar(&chaosConfig.Delay, "chaos-gce-delay", 0,
+		`Optional, delay of the GCE API calls picked by --chaos-gce-delay-rate.`)
+}
+
+// injectGCEFaults makes the GCE API calls accepted by rl fail or get delayed
+// at random, as configured by the chaos flags.
+func injectGCEFaults(gceCloud *gce.Cloud, rl cloud.RateLimiter) {
+	if !chaosConfig.Enabled() {
+		return
+	}
+	config := chaosConfig
+	config.Seed = time.Now().UnixNano()
+	klog.Warningf("Injecting failures into GCE API calls: %+v", config)
+	gceCloud.SetRateLimiter(chaos.NewInjector(config).RateLimiter(rl))
+}
@@ -18,12 +18,15 @@ package app
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
+	gcfg "gopkg.in/gcfg.v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	cloudprovider "k8s.io/cloud-provider"
@@ -34,14 +37,26 @@ import (
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
 
+	"k8s.io/ingress-gce/pkg/alerting"
+	"k8s.io/ingress-gce/pkg/firewallpolicy"
 	"k8s.io/ingress-gce/pkg/flags"
+	"k8s.io/ingress-gce/pkg/identity"
+	"k8s.io/ingress-gce/pkg/metrics"
 	"k8s.io/ingress-gce/pkg/ratelimit"
+	"k8s.io/ingress-gce/pkg/targetproxy"
 	"k8s.io/ingress-gce/pkg/utils"
 )
 
 const (
 	// Sleep interval to retry cloud client creation.
 	cloudClientRetryInterval = 10 * time.Second
+	// monitoringScope is the OAuth scope of the Cloud Monitoring API.
+	monitoringScope = "https://www.googleapis.com/auth/monitoring"
+	// computeScope is the OAuth scope of the Compute Engine API.
+	computeScope = "https://www.googleapis.com/auth/compute"
+	// cloudPlatformScope is the OAuth scope of the Google Cloud APIs without
+	// a scope of their own, such as the network security API.
+	cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
 )
 
 // NewKubeConfig returns a Kubernetes client config given the command line settings.
@@ -65,10 +80,12 @@ func newKubeConfig() (*rest.Config, error) {
 	return clientcmd.BuildConfigFromFlags(flags.F.APIServerHost, flags.F.KubeConfigFile)
 }
 
-// NewGCEClient returns a client to the GCE environment. This will block until
-// a valid configuration file can be read.
-func NewGCEClient() *gce.Cloud {
+// NewGCEClient returns a client to the GCE environment authenticated with the
+// given credentials. This will block until a valid configuration file can be
+// read.
+func NewGCEClient(credentials *identity.Credentials) *gce.Cloud {
 	var configReader func() io.Reader
+	var allConfig []byte
 	if flags.F.ConfigFilePath != "" {
 		klog.Infof("Reading config from path %q", flags.F.ConfigFilePath)
 		config, err := os.Open(flags.F.ConfigFilePath)
@@ -77,7 +94,7 @@ func NewGCEClient() *gce.Cloud {
 		}
 		defer config.Close()
 
-		allConfig, err := ioutil.ReadAll(config)
+		allConfig, err = ioutil.ReadAll(config)
 		if err != nil {
 			klog.Fatalf("Error while reading config (%q): %v", flags.F.ConfigFilePath, err)
 		}
@@ -89,20 +106,24 @@ func NewGCEClient() *gce.Cloud {
 		configReader = func() io.Reader { return nil }
 	}
 
+	// Record the metrics of the calls to the GCE API, including the calls
+	// of the impersonated clients which share the transport.
+	metrics.InstrumentDefaultTransport()
+
 	// Creating the cloud interface involves resolving the metadata server to get
 	// an oauth token. If this fails, the token provider assumes it's not on GCE.
 	// No errors are thrown. So we need to keep retrying till it works because
 	// we know we're on GCE.
 	for {
-		provider, err := cloudprovider.GetCloudProvider("gce", configReader())
+		cloud, err := newCloud(credentials, configReader, allConfig)
 		if err == nil {
-			cloud := provider.(*gce.Cloud)
 			// Configure GCE rate limiting
 			rl, err := ratelimit.NewGCERateLimiter(flags.F.GCERateLimit.Values(), flags.F.GCEOperationPollInterval)
 			if err != nil {
 				klog.Fatalf("Error configuring rate limiting: %v", err)
 			}
 			cloud.SetRateLimiter(rl)
+			injectGCEFaults(cloud, rl)
 			// If this controller is scheduled on a node without compute/rw
 			// it won't be allowed to list backends. We can assume that the
 			// user has no need for Ingress in this case. If they grant
@@ -120,6 +141,129 @@ func NewGCEClient() *gce.Cloud {
 	}
 }
 
+// newCloud creates the GCE client. The clients authenticated with a key file
+// are created from the config file alone, as there is no metadata server.
+func newCloud(credentials *identity.Credentials, configReader func() io.Reader, config []byte) (*gce.Cloud, error) {
+	if credentials.Source != identity.KeyFileSource {
+		provider, err := cloudprovider.GetCloudProvider("gce", configReader())
+		if err != nil {
+			return nil, err
+		}
+		return provider.(*gce.Cloud), nil
+	}
+	ts, err := credentials.TokenSource(cloudPlatformScope, computeScope)
+	if err != nil {
+		return nil, err
+	}
+	cloudConfig, err := cloudConfigFromFile(config)
+	if err != nil {
+		return nil, err
+	}
+	cloudConfig.TokenSource = ts
+	return gce.CreateGCECloud(cloudConfig)
+}
+
+// cloudConfigFromFile returns the GCE client config of a config file which
+// sets the project, zone and network, like the GCE cloud provider does
+// without the metadata server.
+func cloudConfigFromFile(config []byte) (*gce.CloudConfig, error) {
+	configFile := &gce.ConfigFile{}
+	if err := gcfg.FatalOnly(gcfg.ReadStringInto(configFile, string(config))); err != nil {
+		return nil, fmt.Errorf("error reading config: %v", err)
+	}
+	global := configFile.Global
+	if global.ProjectID == "" || global.LocalZone == "" || global.NetworkName == "" {
+		return nil, fmt.Errorf("the config file must set project-id, local-zone and network-name without metadata server")
+	}
+	region, err := gce.GetGCERegion(global.LocalZone)
+	if err != nil {
+		return nil, err
+	}
+	cloudConfig := &gce.CloudConfig{
+		APIEndpoint:          global.APIEndpoint,
+		ContainerAPIEndpoint: global.ContainerAPIEndpoint,
+		ProjectID:            global.ProjectID,
+		NetworkProjectID:     global.NetworkProjectID,
+		Region:               region,
+		Regional:             global.Regional,
+		Zone:                 global.LocalZone,
+		ManagedZones:         []string{global.LocalZone},
+		SecondaryRangeName:   global.SecondaryRangeName,
+		NodeTags:             global.NodeTags,
+		NodeInstancePrefix:   global.NodeInstancePrefix,
+		AlphaFeatureGate:     gce.NewAlphaFeatureGate(global.AlphaFeatures),
+	}
+	if global.Multizone || global.Regional {
+		// Use all zones in region
+		cloudConfig.ManagedZones = nil
+	}
+	if strings.Contains(global.NetworkName, "/") {
+		cloudConfig.NetworkURL = global.NetworkName
+	} else {
+		cloudConfig.NetworkName = global.NetworkName
+	}
+	if strings.Contains(global.SubnetworkName, "/") {
+		cloudConfig.SubnetworkURL = global.SubnetworkName
+	} else {
+		cloudConfig.SubnetworkName = global.SubnetworkName
+	}
+	return cloudConfig, nil
+}
+
+// NewImpersonatedGCEClientFunc returns a function creating clients to the same
+// GCE environment as cloud, authenticated as a given service account by the
+// given credentials.
+func NewImpersonatedGCEClientFunc(cloud *gce.Cloud, credentials *identity.Credentials) identity.NewCloudFunc {
+	return func(serviceAccount string) (*gce.Cloud, error) {
+		impersonated, err := identity.NewImpersonatedCloud(cloud, credentials, serviceAccount)
+		if err != nil {
+			return nil, err
+		}
+		rl, err := ratelimit.NewGCERateLimiter(flags.F.GCERateLimit.Values(), flags.F.GCEOperationPollInterval)
+		if err != nil {
+			return nil, err
+		}
+		impersonated.SetRateLimiter(rl)
+		return impersonated, nil
+	}
+}
+
+// NewAlertPolicyClient returns a client to the Cloud Monitoring alert policies
+// authenticated with the given credentials.
+func NewAlertPolicyClient(credentials *identity.Credentials) (alerting.Client, error) {
+	client, err := credentials.Client(monitoringScope)
+	if err != nil {
+		return nil, err
+	}
+	return alerting.NewClient(client), nil
+}
+
+// NewFirewallPolicyClient returns a client to the network firewall policy of
+// --firewall-policy in the network project of cloud, authenticated with the
+// given credentials.
+func NewFirewallPolicyClient(cloud *gce.Cloud, credentials *identity.Credentials) (firewallpolicy.Client, error) {
+	client, err := credentials.Client(computeScope)
+	if err != nil {
+		return nil, err
+	}
+	return firewallpolicy.NewClient(client, cloud.NetworkProjectID(), flags.F.FirewallPolicyRegion, flags.F.FirewallPolicy), nil
+}
+
+// NewTargetProxyClient returns a client to the target proxies in the project
+// of cloud, authenticated with the given credentials. The ServerTlsPolicies
+// of mutual TLS need the broader cloud platform scope.
+func NewTargetProxyClient(cloud *gce.Cloud, credentials *identity.Credentials) (targetproxy.Client, error) {
+	scopes := []string{computeScope}
+	if flags.F.EnableMutualTLS {
+		scopes = append(scopes, cloudPlatformScope)
+	}
+	client, err := credentials.Client(scopes...)
+	if err != nil {
+		return nil, err
+	}
+	return targetproxy.NewClient(client, cloud.ProjectID()), nil
+}
+
 type readerFunc func() io.Reader
 
 func generateConfigReaderFunc(config []byte) readerFunc {
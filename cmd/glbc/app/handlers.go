@@ -17,10 +17,12 @@ limitations under the License.
 package app
 
 import (
+	"expvar"
 	"flag"
 	"fmt"
 	"html/template"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
 	"strings"
@@ -35,18 +37,43 @@ import (
 	"k8s.io/ingress-gce/pkg/version"
 )
 
-// RunHTTPServer starts an HTTP server. `healthChecker` returns a mapping of component/controller
-// name to the result of its healthcheck.
-func RunHTTPServer(healthChecker func() context.HealthCheckResults) {
-	http.HandleFunc("/healthz", healthCheckHandler(healthChecker))
-	http.HandleFunc("/flag", flagHandler)
-	http.Handle("/metrics", promhttp.Handler())
+// RunHTTPServer starts an HTTP server. `healthChecker` and `readinessChecker` return a mapping of
+// component/controller name to the result of its healthcheck and readiness check.
+func RunHTTPServer(healthChecker, readinessChecker func() context.HealthCheckResults) {
+	// The default mux is not used, as importing pprof and expvar registers
+	// their handlers on it.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", healthCheckHandler(healthChecker))
+	mux.HandleFunc("/readyz", healthCheckHandler(readinessChecker))
+	mux.HandleFunc("/flag", flagHandler)
+	mux.Handle("/metrics", promhttp.Handler())
+	if flags.F.EnablePprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		mux.Handle("/debug/vars", expvar.Handler())
+	}
 
 	klog.V(0).Infof("Running http server on :%v", flags.F.HealthzPort)
-	klog.Fatal(http.ListenAndServe(fmt.Sprintf(":%v", flags.F.HealthzPort), nil))
+	klog.Fatal(http.ListenAndServe(fmt.Sprintf(":%v", flags.F.HealthzPort), mux))
 }
 
-func RunSIGTERMHandler(lbc *controller.LoadBalancerController, deleteAll bool) {
+// RunWebhookServer starts the HTTPS server of the validating admission
+// webhook.
+func RunWebhookServer(validator http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/validate", validator)
+
+	klog.V(0).Infof("Running webhook server on :%v", flags.F.WebhookPort)
+	server := &http.Server{Addr: fmt.Sprintf(":%v", flags.F.WebhookPort), Handler: mux}
+	klog.Fatal(server.ListenAndServeTLS(flags.F.WebhookCertFile, flags.F.WebhookKeyFile))
+}
+
+// RunSIGTERMHandler stops the controller on SIGTERM, runs the shutdown hooks
+// of ctx and exits. onExit is called, if not nil, before exiting.
+func RunSIGTERMHandler(ctx *context.ControllerContext, lbc *controller.LoadBalancerController, deleteAll bool, onExit func()) {
 	// Multiple SIGTERMs will get dropped
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGTERM)
@@ -60,6 +87,10 @@ func RunSIGTERMHandler(lbc *controller.LoadBalancerController, deleteAll bool) {
 		klog.Infof("Error during shutdown %v", err)
 		exitCode = 1
 	}
+	ctx.RunShutdownHooks()
+	if onExit != nil {
+		onExit()
+	}
 	klog.Infof("Exiting with %v", exitCode)
 	os.Exit(exitCode)
 }
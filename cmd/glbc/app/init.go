@@ -18,6 +18,7 @@ package app
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"k8s.io/api/core/v1"
@@ -47,12 +48,28 @@ func DefaultBackendServicePort(kubeClient kubernetes.Interface) utils.ServicePor
 		klog.Fatalf("Failed to parse --default-backend-service: %v", err)
 	}
 
+	backendPort := intstr.FromString(flags.F.DefaultSvcPortName)
+	if flags.F.DefaultBackendGCEService != "" {
+		beName := flags.F.DefaultBackendGCEService
+		if strings.Contains(beName, "/") {
+			if beName, err = utils.KeyName(beName); err != nil {
+				klog.Fatalf("Failed to parse --default-backend-gce-service: %v", err)
+			}
+		}
+		// The Service is only the default backend of internal load
+		// balancers, which may not exist yet.
+		klog.V(2).Infof("Using backend service %q as the default backend", beName)
+		return utils.ServicePort{
+			ID:                     utils.ServicePortID{Service: name, Port: backendPort},
+			ExternalBackendService: beName,
+		}
+	}
+
 	svc, err := waitForServicePort(kubeClient, name, flags.F.DefaultSvcPortName)
 	if err != nil {
 		klog.Fatalf("Failed to verify default backend service: %v", err)
 	}
 
-	backendPort := intstr.FromString(flags.F.DefaultSvcPortName)
 	svcPort := servicePortForDefaultService(svc, backendPort, name)
 	if svcPort == nil {
 		klog.Fatalf("could not derive service port for default service: %v", err)
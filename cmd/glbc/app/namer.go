@@ -29,6 +29,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 
+	"k8s.io/ingress-gce/pkg/flags"
 	"k8s.io/ingress-gce/pkg/loadbalancers"
 	"k8s.io/ingress-gce/pkg/storage"
 )
@@ -41,7 +42,7 @@ const (
 )
 
 // NewNamer returns a new naming policy given the state of the cluster.
-func NewNamer(kubeClient kubernetes.Interface, clusterName, fwName string) (*namer.Namer, error) {
+func NewNamer(kubeClient kubernetes.Interface, clusterName, fwName string) (namer.IngressNamer, error) {
 	namer, err := NewStaticNamer(kubeClient, clusterName, fwName)
 	if err != nil {
 		return nil, err
@@ -86,7 +87,7 @@ func NewNamer(kubeClient kubernetes.Interface, clusterName, fwName string) (*nam
 
 // NewStaticNamer returns a new naming policy given a snapshot of cluster state. Note that this
 // implementation does not dynamically change the naming policy based on changes in cluster state.
-func NewStaticNamer(kubeClient kubernetes.Interface, clusterName, fwName string) (*namer.Namer, error) {
+func NewStaticNamer(kubeClient kubernetes.Interface, clusterName, fwName string) (namer.IngressNamer, error) {
 	name, err := getClusterUID(kubeClient, clusterName)
 	if err != nil {
 		return nil, err
@@ -96,7 +97,7 @@ func NewStaticNamer(kubeClient kubernetes.Interface, clusterName, fwName string)
 		return nil, err
 	}
 
-	return namer.NewNamer(name, fw_name), nil
+	return namer.NewRegisteredNamer(flags.F.Namer, name, fw_name)
 }
 
 // useDefaultOrLookupVault returns either a 'defaultName' or if unset, obtains
@@ -0,0 +1,29 @@
+//go:build !chaos
+// +build !chaos
+
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+// injectGCEFaults does nothing, the faults are only injected by the binaries
+// built with the chaos tag.
+func injectGCEFaults(*gce.Cloud, cloud.RateLimiter) {}
@@ -28,6 +28,7 @@ import (
 	"k8s.io/klog"
 
 	crdclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	clientset "k8s.io/client-go/kubernetes"
@@ -45,11 +46,27 @@ import (
 
 	"k8s.io/ingress-gce/cmd/glbc/app"
 	"k8s.io/ingress-gce/pkg/backendconfig"
+	"k8s.io/ingress-gce/pkg/composite"
 	"k8s.io/ingress-gce/pkg/crd"
+	"k8s.io/ingress-gce/pkg/diagnostics"
 	"k8s.io/ingress-gce/pkg/firewalls"
 	"k8s.io/ingress-gce/pkg/flags"
+	"k8s.io/ingress-gce/pkg/gateway"
+	"k8s.io/ingress-gce/pkg/gc"
+	"k8s.io/ingress-gce/pkg/identity"
+	"k8s.io/ingress-gce/pkg/ingressclass"
 	_ "k8s.io/ingress-gce/pkg/klog"
+	"k8s.io/ingress-gce/pkg/l4"
+	"k8s.io/ingress-gce/pkg/loadbalancers"
+	"k8s.io/ingress-gce/pkg/operations"
+	"k8s.io/ingress-gce/pkg/preflight"
+	"k8s.io/ingress-gce/pkg/quota"
+	"k8s.io/ingress-gce/pkg/reload"
+	"k8s.io/ingress-gce/pkg/shard"
+	"k8s.io/ingress-gce/pkg/utils"
+	namer_util "k8s.io/ingress-gce/pkg/utils/namer"
 	"k8s.io/ingress-gce/pkg/version"
+	"k8s.io/ingress-gce/pkg/webhook"
 )
 
 func main() {
@@ -70,6 +87,19 @@ func main() {
 
 	klog.V(2).Infof("Flags = %+v", flags.F)
 	defer klog.Flush()
+
+	if _, err := namer_util.NewRegisteredNamer(flags.F.Namer, "", ""); err != nil {
+		klog.Fatalf("Invalid --namer, registered namers are %v: %v", namer_util.RegisteredNamers(), err)
+	}
+	if len(flags.F.FirewallTargetTags) > 0 && len(flags.F.FirewallTargetSAs) > 0 {
+		klog.Fatalf("--firewall-target-tags and --firewall-target-service-accounts cannot be used together")
+	}
+	if flags.F.FirewallPolicy != "" && len(flags.F.FirewallTargetTags) > 0 {
+		klog.Fatalf("--firewall-target-tags cannot be used with --firewall-policy, firewall policies do not support network tags")
+	}
+	if flags.F.ShardIngresses && !flags.F.LeaderElection.LeaderElect {
+		klog.Fatalf("--shard-ingresses requires --leader-elect, so that the controllers other than the Ingress controller only run on one replica")
+	}
 	kubeConfig, err := app.NewKubeConfig()
 	if err != nil {
 		klog.Fatalf("Failed to create kubernetes client config: %v", err)
@@ -80,7 +110,7 @@ func main() {
 		klog.Fatalf("Failed to create kubernetes client: %v", err)
 	}
 	var dynamicClient dynamic.Interface
-	if flags.F.EnableCSM {
+	if flags.F.EnableCSM || flags.F.FirewallSuggestionNamespace != "" || flags.F.EnableIngressClasses || flags.F.EnableGateways || flags.F.DiagnosticsPeriod > 0 || flags.F.EnableRetainedLoadBalancers {
 		dynamicClient, err = dynamic.NewForConfig(kubeConfig)
 		if err != nil {
 			klog.Fatalf("Failed to create kubernetes dynamic client: %v", err)
@@ -122,6 +152,30 @@ func main() {
 		}
 	}
 
+	if flags.F.FirewallSuggestionNamespace != "" {
+		if _, err := crdHandler.EnsureCRD(firewalls.SuggestionCRDMeta()); err != nil {
+			klog.Fatalf("Failed to ensure FirewallSuggestion CRD: %v", err)
+		}
+	}
+
+	if flags.F.DiagnosticsPeriod > 0 {
+		if _, err := crdHandler.EnsureCRD(diagnostics.ReportCRDMeta()); err != nil {
+			klog.Fatalf("Failed to ensure DiagnosticReport CRD: %v", err)
+		}
+	}
+
+	if flags.F.EnableRetainedLoadBalancers {
+		if _, err := crdHandler.EnsureCRD(loadbalancers.RetainedLoadBalancerCRDMeta()); err != nil {
+			klog.Fatalf("Failed to ensure RetainedLoadBalancer CRD: %v", err)
+		}
+	}
+
+	if flags.F.EnableIngressClasses {
+		if _, err := crdHandler.EnsureCRD(ingressclass.ParamsCRDMeta()); err != nil {
+			klog.Fatalf("Failed to ensure GCPIngressParams CRD: %v", err)
+		}
+	}
+
 	namer, err := app.NewNamer(kubeClient, flags.F.ClusterName, firewalls.DefaultFirewallName)
 	if err != nil {
 		klog.Fatalf("app.NewNamer(ctx.KubeClient, %q, %q) = %v", flags.F.ClusterName, firewalls.DefaultFirewallName, err)
@@ -130,7 +184,19 @@ func main() {
 		klog.V(0).Infof("Cluster name: %+v", namer.UID())
 	}
 
-	cloud := app.NewGCEClient()
+	credentials, err := identity.FindCredentials(flags.F.GCEKeyFile)
+	if err != nil {
+		klog.Fatalf("Failed to find GCE credentials: %v", err)
+	}
+	klog.V(0).Infof("Using GCE credentials %v", credentials)
+	cloud := app.NewGCEClient(credentials)
+	if flags.F.EnableStartupChecks {
+		reportName, err := utils.ToNamespacedName(flags.F.StartupCheckReport)
+		if err != nil {
+			klog.Fatalf("Failed to parse --startup-check-report: %v", err)
+		}
+		preflight.RunAndReport(cloud, kubeClient, credentials, reportName)
+	}
 	defaultBackendServicePort := app.DefaultBackendServicePort(kubeClient)
 	ctxConfig := ingctx.ControllerContextConfig{
 		Namespace:                     flags.F.WatchNamespace,
@@ -140,34 +206,117 @@ func main() {
 		DefaultBackendHealthCheckPath: flags.F.DefaultSvcHealthCheckPath,
 		FrontendConfigEnabled:         flags.F.EnableFrontendConfig,
 		EnableCSM:                     flags.F.EnableCSM,
+		FirewallSuggestionNamespace:   flags.F.FirewallSuggestionNamespace,
+		EnableIngressClasses:          flags.F.EnableIngressClasses,
+		EnableDiagnostics:             flags.F.DiagnosticsPeriod > 0,
+		EnableRetainedLoadBalancers:   flags.F.EnableRetainedLoadBalancers,
 	}
 	ctx := ingctx.NewControllerContext(kubeClient, dynamicClient, backendConfigClient, frontendConfigClient, cloud, namer, ctxConfig)
-	go app.RunHTTPServer(ctx.HealthCheck)
+	if flags.F.EnableGateways {
+		ctx.IngressSource = gateway.NewIngresses(dynamicClient, flags.F.WatchNamespace, flags.F.ResyncPeriod, ctx.Recorder)
+	}
+	if flags.F.NamespaceServiceAccounts != "" {
+		cmName, err := utils.ToNamespacedName(flags.F.NamespaceServiceAccounts)
+		if err != nil {
+			klog.Fatalf("Failed to parse --namespace-service-accounts-configmap: %v", err)
+		}
+		ctx.NamespaceClouds = identity.NewNamespaceCloudProvider(kubeClient, cmName, cloud, app.NewImpersonatedGCEClientFunc(cloud, credentials))
+	}
+	if flags.F.EnableAlertPolicies {
+		ctx.AlertPolicyClient, err = app.NewAlertPolicyClient(credentials)
+		if err != nil {
+			klog.Fatalf("Failed to create Cloud Monitoring client: %v", err)
+		}
+	}
+	if flags.F.FirewallPolicy != "" {
+		ctx.FirewallPolicyClient, err = app.NewFirewallPolicyClient(cloud, credentials)
+		if err != nil {
+			klog.Fatalf("Failed to create firewall policy client: %v", err)
+		}
+	}
+	if flags.F.EnableProxyKeepAlive || flags.F.EnableMutualTLS {
+		ctx.TargetProxyClient, err = app.NewTargetProxyClient(cloud, credentials)
+		if err != nil {
+			klog.Fatalf("Failed to create target proxy client: %v", err)
+		}
+	}
+	if flags.F.GCECacheTTL > 0 {
+		composite.EnableCache(flags.F.GCECacheTTL)
+	}
+	if flags.F.EnableQuotaChecks {
+		ctx.Quota = quota.NewChecker(cloud)
+	}
+	if flags.F.EnableAsyncOperations {
+		ctx.Operations = operations.NewTracker(operations.NewCloudGetter(cloud), flags.F.GCEOperationPollInterval)
+	}
+	if flags.F.ReloadConfigMap != "" {
+		name, err := utils.ToNamespacedName(flags.F.ReloadConfigMap)
+		if err != nil {
+			klog.Fatalf("Failed to parse --reload-config-map: %v", err)
+		}
+		go reload.NewReloader(kubeClient, name, flag.CommandLine).Run(wait.NeverStop)
+	}
+	go app.RunHTTPServer(ctx.HealthCheck, ctx.ReadinessCheck)
+	if flags.F.WebhookPort != 0 {
+		go app.RunWebhookServer(webhook.NewValidator(kubeClient, backendConfigClient, frontendConfigClient))
+	}
+
+	if flags.F.ShardIngresses {
+		runShardedControllers(ctx, leaderElectKubeClient)
+		return
+	}
 
 	if !flags.F.LeaderElection.LeaderElect {
-		runControllers(ctx)
+		runControllers(ctx, nil)
 		return
 	}
 
-	electionConfig, err := makeLeaderElectionConfig(leaderElectKubeClient, ctx.Recorder(flags.F.LeaderElection.LockObjectNamespace), func() {
-		runControllers(ctx)
+	startLeaderElection(ctx, leaderElectKubeClient, func(release func()) {
+		runControllers(ctx, release)
+	})
+	// Wait for the SIGTERM handler to exit.
+	select {}
+}
+
+// startLeaderElection runs run once this replica is elected leader. run and
+// the caller are given the function releasing the lock, which the leader calls
+// when it is stopped, e.g. when its node is drained, so that another replica
+// takes over without waiting for the lease to expire.
+func startLeaderElection(ctx *ingctx.ControllerContext, client clientset.Interface, run func(release func())) func() {
+	leCtx, cancel := context.WithCancel(context.Background())
+	released := make(chan struct{})
+	release := func() {
+		cancel()
+		<-released
+	}
+	watchdog := leaderelection.NewLeaderHealthzAdaptor(flags.F.LeaderElection.LeaseDuration.Duration)
+	ctx.AddHealthCheck("leader-election", func() error { return watchdog.Check(nil) })
+	electionConfig, err := makeLeaderElectionConfig(client, ctx.Recorder(flags.F.LeaderElection.LockObjectNamespace), watchdog, func() { run(release) }, func() {
+		if leCtx.Err() == nil {
+			klog.Fatalf("lost master")
+		}
+		klog.Infof("Released leader election lock")
+		close(released)
 	})
 	if err != nil {
 		klog.Fatalf("%v", err)
 	}
-	leaderelection.RunOrDie(context.Background(), *electionConfig)
+	go leaderelection.RunOrDie(leCtx, *electionConfig)
+	return release
 }
 
 // makeLeaderElectionConfig builds a leader election configuration. It will
-// create a new resource lock associated with the configuration.
-func makeLeaderElectionConfig(client clientset.Interface, recorder record.EventRecorder, run func()) (*leaderelection.LeaderElectionConfig, error) {
+// create a new resource lock associated with the configuration. The lock is
+// released once the context of the election is cancelled, after which stop
+// is called.
+func makeLeaderElectionConfig(client clientset.Interface, recorder record.EventRecorder, watchdog *leaderelection.HealthzAdaptor, run func(), stop func()) (*leaderelection.LeaderElectionConfig, error) {
 	hostname, err := os.Hostname()
 	if err != nil {
 		return nil, fmt.Errorf("unable to get hostname: %v", err)
 	}
 	// add a uniquifier so that two processes on the same host don't accidentally both become active
 	id := fmt.Sprintf("%v_%x", hostname, rand.Intn(1e6))
-	rl, err := resourcelock.New(resourcelock.ConfigMapsResourceLock,
+	rl, err := resourcelock.New(flags.F.LeaderElection.ResourceLock,
 		flags.F.LeaderElection.LockObjectNamespace,
 		flags.F.LeaderElection.LockObjectName,
 		client.CoreV1(),
@@ -181,27 +330,89 @@ func makeLeaderElectionConfig(client clientset.Interface, recorder record.EventR
 	}
 
 	return &leaderelection.LeaderElectionConfig{
-		Lock:          rl,
-		LeaseDuration: flags.F.LeaderElection.LeaseDuration.Duration,
-		RenewDeadline: flags.F.LeaderElection.RenewDeadline.Duration,
-		RetryPeriod:   flags.F.LeaderElection.RetryPeriod.Duration,
+		Lock:            rl,
+		LeaseDuration:   flags.F.LeaderElection.LeaseDuration.Duration,
+		RenewDeadline:   flags.F.LeaderElection.RenewDeadline.Duration,
+		RetryPeriod:     flags.F.LeaderElection.RetryPeriod.Duration,
+		WatchDog:        watchdog,
+		ReleaseOnCancel: true,
+		Name:            flags.F.LeaderElection.LockObjectName,
 		Callbacks: leaderelection.LeaderCallbacks{
 			OnStartedLeading: func(context.Context) {
 				// Since we are committing a suicide after losing
 				// mastership, we can safely ignore the argument.
+				klog.Infof("Became leader %v", id)
 				run()
 			},
-			OnStoppedLeading: func() {
-				klog.Fatalf("lost master")
-			},
+			OnStoppedLeading: stop,
 		},
 	}, nil
 }
 
-func runControllers(ctx *ingctx.ControllerContext) {
+// runControllers runs the controllers until SIGTERM. onExit is called, if not
+// nil, once the controllers are stopped.
+func runControllers(ctx *ingctx.ControllerContext, onExit func()) {
+	stopCh := make(chan struct{})
+	lbc := controller.NewLoadBalancerController(ctx, stopCh)
+
+	startClusterControllers(ctx, lbc, stopCh)
+
+	go app.RunSIGTERMHandler(ctx, lbc, flags.F.DeleteAllOnQuit, onExit)
+
+	ctx.Start(stopCh)
+	lbc.Init()
+	lbc.Run()
+
+	for {
+		klog.Infof("Handled quit, awaiting pod deletion.")
+		time.Sleep(30 * time.Second)
+	}
+}
+
+// runShardedControllers runs the Ingress controller for the namespaces which
+// the shard ring assigns to this replica, and the other controllers on the
+// leader, until SIGTERM.
+func runShardedControllers(ctx *ingctx.ControllerContext, client clientset.Interface) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		klog.Fatalf("Unable to get hostname: %v", err)
+	}
+	ring := shard.NewRing(client.CoordinationV1(), flags.F.LeaderElection.LockObjectNamespace, flags.F.LeaderElection.LockObjectName+"-shard", hostname, flags.F.LeaderElection.LeaseDuration.Duration)
+	ctx.Shard = ring
+
 	stopCh := make(chan struct{})
 	lbc := controller.NewLoadBalancerController(ctx, stopCh)
 
+	// The other replicas take over the namespaces of this replica once it
+	// left the ring.
+	left := make(chan struct{})
+	go func() {
+		ring.Run(stopCh)
+		close(left)
+	}()
+	release := startLeaderElection(ctx, client, func(func()) {
+		startClusterControllers(ctx, lbc, stopCh)
+	})
+	onExit := func() {
+		release()
+		<-left
+	}
+
+	go app.RunSIGTERMHandler(ctx, lbc, flags.F.DeleteAllOnQuit, onExit)
+
+	ctx.Start(stopCh)
+	lbc.Init()
+	lbc.Run()
+
+	for {
+		klog.Infof("Handled quit, awaiting pod deletion.")
+		time.Sleep(30 * time.Second)
+	}
+}
+
+// startClusterControllers starts the controllers other than the Ingress
+// controller.
+func startClusterControllers(ctx *ingctx.ControllerContext, lbc *controller.LoadBalancerController, stopCh chan struct{}) {
 	fwc := firewalls.NewFirewallController(ctx, flags.F.NodePortRanges.Values())
 
 	// TODO: Refactor NEG to use cloud mocks so ctx.Cloud can be referenced within NewController.
@@ -210,17 +421,24 @@ func runControllers(ctx *ingctx.ControllerContext) {
 	go negController.Run(stopCh)
 	klog.V(0).Infof("negController started")
 
-	go app.RunSIGTERMHandler(lbc, flags.F.DeleteAllOnQuit)
+	if flags.F.GCCrawlPeriod > 0 {
+		crawler := gc.NewCrawler(ctx.Cloud, negtypes.NewAdapter(ctx.Cloud), ctx.ClusterNamer, ctx.ServiceInformer.GetIndexer(), lbc.DesiredResources, flags.F.GCCrawlDryRun)
+		go crawler.Run(ctx.HasSynced, flags.F.GCCrawlPeriod, stopCh)
+		klog.V(0).Infof("GCE resource crawler started")
+	}
 
 	go fwc.Run()
 	klog.V(0).Infof("firewall controller started")
 
-	ctx.Start(stopCh)
-	lbc.Init()
-	lbc.Run()
+	if flags.F.DiagnosticsPeriod > 0 {
+		diagnoser := diagnostics.NewDiagnoser(ctx, fwc.SyncError)
+		go diagnoser.Run(ctx.HasSynced, flags.F.DiagnosticsPeriod, stopCh)
+		klog.V(0).Infof("self-diagnosis started")
+	}
 
-	for {
-		klog.Infof("Handled quit, awaiting pod deletion.")
-		time.Sleep(30 * time.Second)
+	if flags.F.RunL4Controller {
+		l4c := l4.NewController(ctx, flags.F.L4SubsetSizePerZone)
+		go l4c.Run()
+		klog.V(0).Infof("L4 controller started")
 	}
 }
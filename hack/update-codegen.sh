@@ -62,3 +62,24 @@ ${GOPATH}/bin/openapi-gen \
   --input-dirs k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1\
   --output-package k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1 \
   --go-header-file ${SCRIPT_ROOT}/hack/boilerplate.go.txt
+
+echo "Performing code generation for FirewallSuggestion CRD"
+${CODEGEN_PKG}/generate-groups.sh \
+  "deepcopy" \
+  k8s.io/ingress-gce/pkg/firewallsuggestion/client k8s.io/ingress-gce/pkg/apis \
+  firewallsuggestion:v1beta1 \
+  --go-header-file ${SCRIPT_ROOT}/hack/boilerplate.go.txt
+
+echo "Performing code generation for DiagnosticReport CRD"
+${CODEGEN_PKG}/generate-groups.sh \
+  "deepcopy" \
+  k8s.io/ingress-gce/pkg/diagnosticreport/client k8s.io/ingress-gce/pkg/apis \
+  diagnosticreport:v1beta1 \
+  --go-header-file ${SCRIPT_ROOT}/hack/boilerplate.go.txt
+
+echo "Performing code generation for RetainedLoadBalancer CRD"
+${CODEGEN_PKG}/generate-groups.sh \
+  "deepcopy" \
+  k8s.io/ingress-gce/pkg/retainedloadbalancer/client k8s.io/ingress-gce/pkg/apis \
+  retainedloadbalancer:v1beta1 \
+  --go-header-file ${SCRIPT_ROOT}/hack/boilerplate.go.txt
@@ -0,0 +1,297 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package alerting
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	backendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/backendconfig/v1beta1"
+	"k8s.io/ingress-gce/pkg/events"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/klog"
+)
+
+const (
+	// backendServiceLabel is the user label holding the name of the backend
+	// service of the alert policies created by the controller.
+	backendServiceLabel = "ingress_gce_backend_service"
+	// policyLabel is the user label holding the kind of the alert policy.
+	policyLabel = "ingress_gce_policy"
+
+	errorRatePolicy = "error-rate"
+	latencyPolicy   = "latency"
+
+	// DefaultErrorRatePercent is the default percentage of 5xx responses
+	// above which the error rate policy fires.
+	DefaultErrorRatePercent = 1
+	// DefaultLatencyThresholdMs is the default 99th percentile latency
+	// above which the latency policy fires.
+	DefaultLatencyThresholdMs = 1000
+
+	alignmentPeriod   = "60s"
+	conditionDuration = "300s"
+
+	requestCountMetric    = "loadbalancing.googleapis.com/https/request_count"
+	backendLatencyMetric  = "loadbalancing.googleapis.com/https/backend_latencies"
+	loadBalancerRuleType  = "https_lb_rule"
+	serverErrorCodeClass  = 500
+	comparisonGreaterThan = "COMPARISON_GT"
+)
+
+// policyResyncPeriod is how often the alert policies of the project are
+// listed again, to notice the changes made outside of the controller.
+const policyResyncPeriod = 30 * time.Minute
+
+// Manager creates, updates and deletes the alert policies of the backend
+// services of external load balancers. The policies are identified by their
+// user labels, so they are never confused with policies created by users.
+// The policies of the project are listed once every policyResyncPeriod and
+// kept up to date with the writes of the Manager in between, so that the
+// backend services whose policies are in sync need no call.
+type Manager struct {
+	client    Client
+	project   string
+	recorders events.RecorderProducer
+
+	// lock protects policies and listed.
+	lock sync.Mutex
+	// policies are the alert policies created by the controller, by backend
+	// service.
+	policies map[string][]*Policy
+	// listed is when policies were listed, zero if they must be listed again.
+	listed time.Time
+}
+
+// NewManager returns a Manager of the alert policies of the given project,
+// which records the errors of the BackendConfigs with recorders.
+func NewManager(client Client, project string, recorders events.RecorderProducer) *Manager {
+	return &Manager{client: client, project: project, recorders: recorders}
+}
+
+// Sync ensures the alert policies of the backend service match the alerting
+// config of the BackendConfig, which may be nil. Cloud Monitoring errors do
+// not fail the sync of the load balancer: they are logged, and recorded as
+// events of the BackendConfig.
+func (m *Manager) Sync(backendService string, backendConfig *backendconfigv1beta1.BackendConfig) {
+	var config *backendconfigv1beta1.AlertingConfig
+	if backendConfig != nil {
+		config = backendConfig.Spec.Alerting
+	}
+	err := m.Ensure(backendService, config)
+	if err == nil {
+		return
+	}
+	klog.Warningf("Error ensuring alert policies of backend service %v: %v", backendService, err)
+	if backendConfig != nil {
+		m.recorders.Recorder(backendConfig.Namespace).Eventf(backendConfig, apiv1.EventTypeWarning, "AlertPolicies", "Error ensuring alert policies of backend service %v: %v", backendService, err)
+	}
+}
+
+// Ensure ensures the alert policies of the backend service match the config.
+// The policies are deleted if the config is nil or disabled.
+func (m *Manager) Ensure(backendService string, config *backendconfigv1beta1.AlertingConfig) (err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	// The policies are listed again after a failed write, which may have
+	// been applied.
+	defer func() {
+		if err != nil {
+			m.listed = time.Time{}
+		}
+	}()
+
+	existing, err := m.list(backendService)
+	if err != nil {
+		return err
+	}
+
+	desired := map[string]*Policy{}
+	if config != nil && config.Enabled {
+		desired = policies(backendService, config)
+	}
+
+	for _, policy := range existing {
+		kind := policy.UserLabels[policyLabel]
+		want, ok := desired[kind]
+		if !ok {
+			klog.V(2).Infof("Deleting alert policy %q of backend service %v", policy.Name, backendService)
+			if err := utils.IgnoreHTTPNotFound(m.client.DeletePolicy(policy.Name)); err != nil {
+				return err
+			}
+			m.remove(backendService, policy)
+			continue
+		}
+		delete(desired, kind)
+		if policyEqual(policy, want) {
+			continue
+		}
+		want.Name = policy.Name
+		klog.V(2).Infof("Updating alert policy %q of backend service %v", policy.Name, backendService)
+		if err := m.client.UpdatePolicy(want); err != nil {
+			return err
+		}
+		m.remove(backendService, policy)
+		m.policies[backendService] = append(m.policies[backendService], want)
+	}
+
+	var kinds []string
+	for kind := range desired {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		klog.V(2).Infof("Creating %s alert policy of backend service %v", kind, backendService)
+		created, err := m.client.CreatePolicy(m.project, desired[kind])
+		if err != nil {
+			return err
+		}
+		m.policies[backendService] = append(m.policies[backendService], created)
+	}
+	return nil
+}
+
+// Delete deletes the alert policies of the backend service.
+func (m *Manager) Delete(backendService string) error {
+	return m.Ensure(backendService, nil)
+}
+
+// list returns the alert policies created for the backend service, listing
+// the policies of the project if they were not listed for
+// policyResyncPeriod. m.lock must be held.
+func (m *Manager) list(backendService string) ([]*Policy, error) {
+	if m.listed.IsZero() || time.Since(m.listed) > policyResyncPeriod {
+		policies, err := m.client.ListPolicies(m.project, fmt.Sprintf("user_labels.%s=%q OR user_labels.%s=%q", policyLabel, errorRatePolicy, policyLabel, latencyPolicy))
+		if err != nil {
+			return nil, err
+		}
+		m.policies = map[string][]*Policy{}
+		for _, policy := range policies {
+			if name := policy.UserLabels[backendServiceLabel]; name != "" && policy.UserLabels[policyLabel] != "" {
+				m.policies[name] = append(m.policies[name], policy)
+			}
+		}
+		m.listed = time.Now()
+	}
+	return append([]*Policy(nil), m.policies[backendService]...), nil
+}
+
+// remove removes the policy from the policies of the backend service. m.lock
+// must be held.
+func (m *Manager) remove(backendService string, policy *Policy) {
+	var kept []*Policy
+	for _, p := range m.policies[backendService] {
+		if p.Name != policy.Name {
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) == 0 {
+		delete(m.policies, backendService)
+		return
+	}
+	m.policies[backendService] = kept
+}
+
+// policies returns the alert policies of the backend service by kind.
+func policies(backendService string, config *backendconfigv1beta1.AlertingConfig) map[string]*Policy {
+	errorRatePercent := int64(DefaultErrorRatePercent)
+	if config.ErrorRatePercent != nil {
+		errorRatePercent = *config.ErrorRatePercent
+	}
+	latencyThresholdMs := int64(DefaultLatencyThresholdMs)
+	if config.LatencyThresholdMs != nil {
+		latencyThresholdMs = *config.LatencyThresholdMs
+	}
+
+	resourceFilter := fmt.Sprintf("resource.type=%q AND resource.label.backend_target_name=%q", loadBalancerRuleType, backendService)
+	requestCount := fmt.Sprintf("metric.type=%q AND %s", requestCountMetric, resourceFilter)
+	sumRate := []*Aggregation{{
+		AlignmentPeriod:    alignmentPeriod,
+		PerSeriesAligner:   "ALIGN_RATE",
+		CrossSeriesReducer: "REDUCE_SUM",
+	}}
+
+	return map[string]*Policy{
+		errorRatePolicy: newPolicy(backendService, errorRatePolicy, config, &Condition{
+			DisplayName: fmt.Sprintf("5xx rate of %s above %d%%", backendService, errorRatePercent),
+			ConditionThreshold: &Threshold{
+				Filter:                  fmt.Sprintf("%s AND metric.label.response_code_class=%d", requestCount, serverErrorCodeClass),
+				Aggregations:            sumRate,
+				DenominatorFilter:       requestCount,
+				DenominatorAggregations: sumRate,
+				Comparison:              comparisonGreaterThan,
+				ThresholdValue:          float64(errorRatePercent) / 100,
+				Duration:                conditionDuration,
+			},
+		}),
+		latencyPolicy: newPolicy(backendService, latencyPolicy, config, &Condition{
+			DisplayName: fmt.Sprintf("99th percentile latency of %s above %dms", backendService, latencyThresholdMs),
+			ConditionThreshold: &Threshold{
+				Filter: fmt.Sprintf("metric.type=%q AND %s", backendLatencyMetric, resourceFilter),
+				Aggregations: []*Aggregation{{
+					AlignmentPeriod:    alignmentPeriod,
+					PerSeriesAligner:   "ALIGN_DELTA",
+					CrossSeriesReducer: "REDUCE_PERCENTILE_99",
+				}},
+				Comparison:     comparisonGreaterThan,
+				ThresholdValue: float64(latencyThresholdMs),
+				Duration:       conditionDuration,
+			},
+		}),
+	}
+}
+
+func newPolicy(backendService, kind string, config *backendconfigv1beta1.AlertingConfig, condition *Condition) *Policy {
+	return &Policy{
+		DisplayName: fmt.Sprintf("%s %s", backendService, kind),
+		Combiner:    "OR",
+		UserLabels: map[string]string{
+			backendServiceLabel: backendService,
+			policyLabel:         kind,
+		},
+		Conditions:           []*Condition{condition},
+		NotificationChannels: config.NotificationChannels,
+	}
+}
+
+// policyEqual returns true if the existing policy has the settings of the
+// desired one, ignoring the names assigned by Cloud Monitoring.
+func policyEqual(existing, desired *Policy) bool {
+	if existing.DisplayName != desired.DisplayName || existing.Combiner != desired.Combiner {
+		return false
+	}
+	if len(existing.NotificationChannels) != 0 || len(desired.NotificationChannels) != 0 {
+		if !reflect.DeepEqual(existing.NotificationChannels, desired.NotificationChannels) {
+			return false
+		}
+	}
+	if len(existing.Conditions) != len(desired.Conditions) {
+		return false
+	}
+	for i := range existing.Conditions {
+		condition := *existing.Conditions[i]
+		condition.Name = ""
+		if !reflect.DeepEqual(&condition, desired.Conditions[i]) {
+			return false
+		}
+	}
+	return true
+}
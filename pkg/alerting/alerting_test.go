@@ -0,0 +1,180 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package alerting
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	backendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/backendconfig/v1beta1"
+	"k8s.io/ingress-gce/pkg/events"
+)
+
+func TestEnsure(t *testing.T) {
+	i64 := func(v int64) *int64 { return &v }
+	const beName = "k8s-be-30000--uid1"
+
+	testCases := []struct {
+		desc   string
+		config *backendconfigv1beta1.AlertingConfig
+		// wantThresholds are the thresholds of the policies by kind.
+		wantThresholds map[string]float64
+		wantChannels   []string
+	}{
+		{
+			desc:   "no config",
+			config: nil,
+		},
+		{
+			desc:   "disabled",
+			config: &backendconfigv1beta1.AlertingConfig{Enabled: false},
+		},
+		{
+			desc:           "defaults",
+			config:         &backendconfigv1beta1.AlertingConfig{Enabled: true},
+			wantThresholds: map[string]float64{errorRatePolicy: 0.01, latencyPolicy: 1000},
+		},
+		{
+			desc: "custom thresholds and channels",
+			config: &backendconfigv1beta1.AlertingConfig{
+				Enabled:              true,
+				ErrorRatePercent:     i64(5),
+				LatencyThresholdMs:   i64(250),
+				NotificationChannels: []string{"projects/test-project/notificationChannels/1"},
+			},
+			wantThresholds: map[string]float64{errorRatePolicy: 0.05, latencyPolicy: 250},
+			wantChannels:   []string{"projects/test-project/notificationChannels/1"},
+		},
+	}
+
+	client := NewFakeClient()
+	// A policy created by the user is never modified.
+	userPolicy, _ := client.CreatePolicy("test-project", &Policy{DisplayName: "user policy"})
+	m := NewManager(client, "test-project", events.RecorderProducerMock{})
+
+	// Run the test cases in order against the same client, so that each
+	// exercises the transition from the previous one.
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if err := m.Ensure(beName, tc.config); err != nil {
+				t.Fatalf("Ensure(%q, %+v) = %v, want nil", beName, tc.config, err)
+			}
+
+			policies, _ := m.list(beName)
+			if len(policies) != len(tc.wantThresholds) {
+				t.Fatalf("Got %d policies, want %d", len(policies), len(tc.wantThresholds))
+			}
+			for _, policy := range policies {
+				kind := policy.UserLabels[policyLabel]
+				want, ok := tc.wantThresholds[kind]
+				if !ok {
+					t.Errorf("Got unexpected %q policy", kind)
+					continue
+				}
+				if got := policy.Conditions[0].ConditionThreshold.ThresholdValue; got != want {
+					t.Errorf("Got threshold %v for %q policy, want %v", got, kind, want)
+				}
+				if len(policy.NotificationChannels) != len(tc.wantChannels) {
+					t.Errorf("Got notification channels %v for %q policy, want %v", policy.NotificationChannels, kind, tc.wantChannels)
+				}
+			}
+
+			// Ensure is idempotent.
+			before := len(client.Policies)
+			if err := m.Ensure(beName, tc.config); err != nil {
+				t.Fatalf("Ensure(%q, %+v) = %v, want nil", beName, tc.config, err)
+			}
+			if len(client.Policies) != before {
+				t.Errorf("Got %d policies after resync, want %d", len(client.Policies), before)
+			}
+		})
+	}
+
+	if err := m.Delete(beName); err != nil {
+		t.Fatalf("Delete(%q) = %v, want nil", beName, err)
+	}
+	if len(client.Policies) != 1 || client.Policies[userPolicy.Name] == nil {
+		t.Errorf("Got policies %v, want only the user policy", client.Policies)
+	}
+}
+
+func TestEnsureCalls(t *testing.T) {
+	client := NewFakeClient()
+	m := NewManager(client, "test-project", events.RecorderProducerMock{})
+	enabled := &backendconfigv1beta1.AlertingConfig{Enabled: true}
+
+	// The policies are listed once, and backend services without alerting
+	// or whose policies are in sync need no call.
+	for i := 0; i < 3; i++ {
+		for _, beName := range []string{"k8s-be-30000--uid1", "k8s-be-30001--uid1"} {
+			if err := m.Ensure(beName, nil); err != nil {
+				t.Fatalf("Ensure(%q, nil) = %v, want nil", beName, err)
+			}
+		}
+		if err := m.Ensure("k8s-be-30002--uid1", enabled); err != nil {
+			t.Fatalf("Ensure() = %v, want nil", err)
+		}
+	}
+	if client.Lists != 1 || len(client.Policies) != 2 {
+		t.Errorf("Got %d list calls and %d policies, want 1 and 2", client.Lists, len(client.Policies))
+	}
+
+	// After a failed call, the policies are listed again.
+	client.Err = fmt.Errorf("unavailable")
+	if err := m.Delete("k8s-be-30002--uid1"); err == nil {
+		t.Fatalf("Delete() = nil, want error")
+	}
+	client.Err = nil
+	if err := m.Delete("k8s-be-30002--uid1"); err != nil {
+		t.Fatalf("Delete() = %v, want nil", err)
+	}
+	if client.Lists != 2 || len(client.Policies) != 0 {
+		t.Errorf("Got %d list calls and %d policies, want 2 and 0", client.Lists, len(client.Policies))
+	}
+}
+
+func TestSyncErrors(t *testing.T) {
+	client := NewFakeClient()
+	client.Err = fmt.Errorf("permission denied")
+	recorder := record.NewFakeRecorder(1)
+	m := NewManager(client, "test-project", fakeRecorderProducer{recorder})
+	backendConfig := &backendconfigv1beta1.BackendConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "config"},
+		Spec:       backendconfigv1beta1.BackendConfigSpec{Alerting: &backendconfigv1beta1.AlertingConfig{Enabled: true}},
+	}
+
+	m.Sync("k8s-be-30000--uid1", backendConfig)
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, "permission denied") {
+			t.Errorf("Got event %q, want the error", event)
+		}
+	default:
+		t.Errorf("Got no event for the error")
+	}
+}
+
+type fakeRecorderProducer struct {
+	recorder record.EventRecorder
+}
+
+func (f fakeRecorderProducer) Recorder(string) record.EventRecorder {
+	return f.recorder
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package alerting
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"google.golang.org/api/googleapi"
+)
+
+const monitoringBasePath = "https://monitoring.googleapis.com/v3/"
+
+// Policy is a Cloud Monitoring alert policy. See
+// https://cloud.google.com/monitoring/api/ref_v3/rest/v3/projects.alertPolicies.
+type Policy struct {
+	// Name is assigned by Cloud Monitoring on creation, in the form
+	// projects/[PROJECT_ID]/alertPolicies/[ALERT_POLICY_ID].
+	Name                 string            `json:"name,omitempty"`
+	DisplayName          string            `json:"displayName,omitempty"`
+	Combiner             string            `json:"combiner,omitempty"`
+	UserLabels           map[string]string `json:"userLabels,omitempty"`
+	Conditions           []*Condition      `json:"conditions,omitempty"`
+	NotificationChannels []string          `json:"notificationChannels,omitempty"`
+}
+
+// Condition is a condition of an alert policy.
+type Condition struct {
+	// Name is assigned by Cloud Monitoring on creation.
+	Name               string     `json:"name,omitempty"`
+	DisplayName        string     `json:"displayName,omitempty"`
+	ConditionThreshold *Threshold `json:"conditionThreshold,omitempty"`
+}
+
+// Threshold is a condition which fires when a time series, or the ratio of
+// two time series, crosses a threshold for a duration.
+type Threshold struct {
+	Filter                  string         `json:"filter"`
+	Aggregations            []*Aggregation `json:"aggregations,omitempty"`
+	DenominatorFilter       string         `json:"denominatorFilter,omitempty"`
+	DenominatorAggregations []*Aggregation `json:"denominatorAggregations,omitempty"`
+	Comparison              string         `json:"comparison"`
+	ThresholdValue          float64        `json:"thresholdValue"`
+	Duration                string         `json:"duration"`
+}
+
+// Aggregation describes how time series are aligned and combined.
+type Aggregation struct {
+	AlignmentPeriod    string `json:"alignmentPeriod,omitempty"`
+	PerSeriesAligner   string `json:"perSeriesAligner,omitempty"`
+	CrossSeriesReducer string `json:"crossSeriesReducer,omitempty"`
+}
+
+// Client manages the alert policies of a project.
+type Client interface {
+	// ListPolicies returns the alert policies of the project matching filter.
+	ListPolicies(project, filter string) ([]*Policy, error)
+	// CreatePolicy creates the alert policy in the project.
+	CreatePolicy(project string, policy *Policy) (*Policy, error)
+	// UpdatePolicy replaces the alert policy with the name of policy.
+	UpdatePolicy(policy *Policy) error
+	// DeletePolicy deletes the alert policy with the given name.
+	DeletePolicy(name string) error
+}
+
+// restClient is a Client using the Cloud Monitoring REST API.
+type restClient struct {
+	client   *http.Client
+	basePath string
+}
+
+// NewClient returns a Client using the given authenticated HTTP client.
+func NewClient(client *http.Client) Client {
+	return &restClient{client: client, basePath: monitoringBasePath}
+}
+
+type listPoliciesResponse struct {
+	AlertPolicies []*Policy `json:"alertPolicies"`
+	NextPageToken string    `json:"nextPageToken"`
+}
+
+// ListPolicies implements Client.
+func (c *restClient) ListPolicies(project, filter string) ([]*Policy, error) {
+	var policies []*Policy
+	pageToken := ""
+	for {
+		params := url.Values{}
+		params.Set("filter", filter)
+		if pageToken != "" {
+			params.Set("pageToken", pageToken)
+		}
+		resp := &listPoliciesResponse{}
+		if err := c.do(http.MethodGet, fmt.Sprintf("projects/%s/alertPolicies?%s", project, params.Encode()), nil, resp); err != nil {
+			return nil, err
+		}
+		policies = append(policies, resp.AlertPolicies...)
+		if resp.NextPageToken == "" {
+			return policies, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// CreatePolicy implements Client.
+func (c *restClient) CreatePolicy(project string, policy *Policy) (*Policy, error) {
+	created := &Policy{}
+	if err := c.do(http.MethodPost, fmt.Sprintf("projects/%s/alertPolicies", project), policy, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// UpdatePolicy implements Client. Without an update mask, the whole policy
+// is replaced.
+func (c *restClient) UpdatePolicy(policy *Policy) error {
+	return c.do(http.MethodPatch, policy.Name, policy, nil)
+}
+
+// DeletePolicy implements Client.
+func (c *restClient) DeletePolicy(name string) error {
+	return c.do(http.MethodDelete, name, nil, nil)
+}
+
+// do sends a request with the JSON encoded body to the path relative to the
+// API base path, and decodes the response into out if it is not nil.
+func (c *restClient) do(method, path string, body, out interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, c.basePath+path, &reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer googleapi.CloseBody(resp)
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package alerting
+
+import (
+	"fmt"
+	"net/http"
+
+	"google.golang.org/api/googleapi"
+)
+
+// FakeClient is a Client storing alert policies in memory. The filter of
+// ListPolicies is ignored.
+type FakeClient struct {
+	Policies map[string]*Policy
+	// Lists is the number of ListPolicies calls.
+	Lists int
+	// Err, if set, is returned by all the calls.
+	Err    error
+	nextID int
+}
+
+// NewFakeClient returns a new FakeClient.
+func NewFakeClient() *FakeClient {
+	return &FakeClient{Policies: map[string]*Policy{}}
+}
+
+// ListPolicies implements Client.
+func (f *FakeClient) ListPolicies(project, filter string) ([]*Policy, error) {
+	f.Lists++
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	var policies []*Policy
+	for _, policy := range f.Policies {
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// CreatePolicy implements Client.
+func (f *FakeClient) CreatePolicy(project string, policy *Policy) (*Policy, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	f.nextID++
+	created := *policy
+	created.Name = fmt.Sprintf("projects/%s/alertPolicies/%d", project, f.nextID)
+	f.Policies[created.Name] = &created
+	return &created, nil
+}
+
+// UpdatePolicy implements Client.
+func (f *FakeClient) UpdatePolicy(policy *Policy) error {
+	if f.Err != nil {
+		return f.Err
+	}
+	if _, ok := f.Policies[policy.Name]; !ok {
+		return &googleapi.Error{Code: http.StatusNotFound}
+	}
+	updated := *policy
+	f.Policies[policy.Name] = &updated
+	return nil
+}
+
+// DeletePolicy implements Client.
+func (f *FakeClient) DeletePolicy(name string) error {
+	if f.Err != nil {
+		return f.Err
+	}
+	if _, ok := f.Policies[name]; !ok {
+		return &googleapi.Error{Code: http.StatusNotFound}
+	}
+	delete(f.Policies, name)
+	return nil
+}
@@ -41,6 +41,13 @@ const (
 	// responsibility to create/delete it.
 	StaticIPNameKey = "kubernetes.io/ingress.global-static-ip-name"
 
+	// ManagedStaticIPKey tells the Ingress controller to reserve a global
+	// static ip for the Ingress when it is created, instead of promoting the
+	// ephemeral ip of its forwarding rules. The controller owns this ip and
+	// releases it when the Ingress is deleted, unless it runs with
+	// --preserve-managed-static-ips. Ignored if StaticIPNameKey is set.
+	ManagedStaticIPKey = "networking.gke.io/managed-static-ip"
+
 	// PreSharedCertKey represents the specific pre-shared SSL
 	// certicate for the Ingress controller to use. The controller *does not*
 	// manage this certificate, it is the users responsibility to create/delete it.
@@ -77,6 +84,31 @@ const (
 	// - annotations:
 	//     networking.gke.io/v1beta1.FrontendConfig: 'my-frontendconfig'
 	FrontendConfigKey = "networking.gke.io/v1beta1.FrontendConfig"
+
+	// URLMapKey is the annotation key used to attach the target proxies of
+	// the Ingress to an existing URL map, not managed by the controller,
+	// instead of the URL map translated from the Ingress spec. The value is
+	// the name or the self link of the URL map.
+	// Examples:
+	// - annotations:
+	//     networking.gke.io/url-map: 'projects/p/global/urlMaps/my-url-map'
+	URLMapKey = "networking.gke.io/url-map"
+
+	// RetainResourcesKey is the annotation key used to keep the cloud
+	// resources of the load balancer of an Ingress when it is deleted, if
+	// the controller runs with --enable-retained-load-balancers. The
+	// resources are recorded in a RetainedLoadBalancer instead.
+	// Examples:
+	// - annotations:
+	//     networking.gke.io/retain-resources: 'true'
+	RetainResourcesKey = "networking.gke.io/retain-resources"
+
+	// NamingSchemeKey is the annotation key used by the controller to record
+	// the naming scheme of the frontend resources of the Ingress, either
+	// NamingSchemeV1 or NamingSchemeV2. This is read only for users.
+	NamingSchemeKey = "networking.gke.io/naming-scheme"
+	NamingSchemeV1  = "v1"
+	NamingSchemeV2  = "v2"
 )
 
 // Ingress represents ingress annotations.
@@ -120,6 +152,19 @@ func (ing *Ingress) StaticIPName() string {
 	return val
 }
 
+// ManagedStaticIP returns the ManagedStaticIPKey flag. False by default.
+func (ing *Ingress) ManagedStaticIP() bool {
+	val, ok := ing.v[ManagedStaticIPKey]
+	if !ok {
+		return false
+	}
+	v, err := strconv.ParseBool(val)
+	if err != nil {
+		return false
+	}
+	return v
+}
+
 func (ing *Ingress) IngressClass() string {
 	val, ok := ing.v[IngressClassKey]
 	if !ok {
@@ -149,3 +194,27 @@ func (ing *Ingress) FrontendConfig() string {
 	}
 	return val
 }
+
+// URLMap returns the URLMapKey annotation. Empty if not set.
+func (ing *Ingress) URLMap() string {
+	return ing.v[URLMapKey]
+}
+
+// RetainResources returns the RetainResourcesKey flag. False by default.
+func (ing *Ingress) RetainResources() bool {
+	val, ok := ing.v[RetainResourcesKey]
+	if !ok {
+		return false
+	}
+	v, err := strconv.ParseBool(val)
+	if err != nil {
+		return false
+	}
+	return v
+}
+
+// NamingScheme returns the naming scheme recorded on the Ingress. Empty if
+// the controller did not record it yet.
+func (ing *Ingress) NamingScheme() string {
+	return ing.v[NamingSchemeKey]
+}
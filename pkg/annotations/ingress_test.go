@@ -17,10 +17,12 @@ limitations under the License.
 package annotations
 
 import (
+	"reflect"
 	"testing"
 
 	"k8s.io/api/networking/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 func TestIngress(t *testing.T) {
@@ -67,3 +69,147 @@ func TestIngress(t *testing.T) {
 		}
 	}
 }
+
+func TestRouteActions(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		val     string
+		want    []RouteAction
+		wantErr bool
+	}{
+		{
+			desc: "no annotation",
+		},
+		{
+			desc: "rewrite and redirect",
+			val:  `[{"host":"foo.com","path":"/api/*","rewrite":{"pathPrefix":"/"}},{"path":"/old","redirect":{"path":"/new","responseCode":"FOUND"}}]`,
+			want: []RouteAction{
+				{Host: "foo.com", Path: "/api/*", Rewrite: &URLRewrite{PathPrefix: "/"}},
+				{Path: "/old", Redirect: &URLRedirect{Path: "/new", ResponseCode: "FOUND"}},
+			},
+		},
+		{
+			desc: "weighted backends",
+			val:  `[{"path":"/*","weightedBackends":[{"serviceName":"app","servicePort":80,"weight":90},{"serviceName":"app-canary","servicePort":"http","weight":10}]}]`,
+			want: []RouteAction{
+				{Path: "/*", WeightedBackends: []WeightedBackend{
+					{ServiceName: "app", ServicePort: intstr.FromInt(80), Weight: 90},
+					{ServiceName: "app-canary", ServicePort: intstr.FromString("http"), Weight: 10},
+				}},
+			},
+		},
+		{
+			desc:    "weighted backend out of range",
+			val:     `[{"path":"/*","weightedBackends":[{"serviceName":"app","servicePort":80,"weight":1001}]}]`,
+			wantErr: true,
+		},
+		{
+			desc:    "weighted backends all zero",
+			val:     `[{"path":"/*","weightedBackends":[{"serviceName":"app","servicePort":80,"weight":0}]}]`,
+			wantErr: true,
+		},
+		{
+			desc: "security policy",
+			val:  `[{"path":"/admin/*","securityPolicy":"admin-policy"}]`,
+			want: []RouteAction{{Path: "/admin/*", SecurityPolicy: "admin-policy"}},
+		},
+		{
+			desc:    "redirect with security policy",
+			val:     `[{"path":"/admin/*","redirect":{"https":true},"securityPolicy":"admin-policy"}]`,
+			wantErr: true,
+		},
+		{
+			desc: "backend service",
+			val:  `[{"path":"/fn/*","backendService":"projects/p/global/backendServices/serverless"}]`,
+			want: []RouteAction{{Path: "/fn/*", BackendService: "projects/p/global/backendServices/serverless"}},
+		},
+		{
+			desc:    "backend service with security policy",
+			val:     `[{"path":"/fn/*","backendService":"serverless","securityPolicy":"admin-policy"}]`,
+			wantErr: true,
+		},
+		{
+			desc:    "redirect with backend service",
+			val:     `[{"path":"/fn/*","redirect":{"https":true},"backendService":"serverless"}]`,
+			wantErr: true,
+		},
+		{
+			desc:    "redirect with weighted backends",
+			val:     `[{"path":"/*","redirect":{"https":true},"weightedBackends":[{"serviceName":"app","servicePort":80,"weight":1}]}]`,
+			wantErr: true,
+		},
+		{
+			desc: "conditional routes",
+			val:  `[{"path":"/*","routes":[{"headers":[{"name":"Cookie","regex":".*beta=true.*"}],"queryParams":[{"name":"debug","present":true}],"serviceName":"app-beta","servicePort":80}]}]`,
+			want: []RouteAction{
+				{Path: "/*", Routes: []ConditionalRoute{
+					{
+						Headers:     []HeaderMatch{{Name: "Cookie", Regex: ".*beta=true.*"}},
+						QueryParams: []QueryParamMatch{{Name: "debug", Present: true}},
+						ServiceName: "app-beta",
+						ServicePort: intstr.FromInt(80),
+					},
+				}},
+			},
+		},
+		{
+			desc:    "route without conditions",
+			val:     `[{"path":"/*","routes":[{"serviceName":"app-beta","servicePort":80}]}]`,
+			wantErr: true,
+		},
+		{
+			desc:    "header match with multiple conditions",
+			val:     `[{"path":"/*","routes":[{"headers":[{"name":"X-Beta","present":true,"exact":"1"}],"serviceName":"app-beta","servicePort":80}]}]`,
+			wantErr: true,
+		},
+		{
+			desc:    "query parameter match without name",
+			val:     `[{"path":"/*","routes":[{"queryParams":[{"exact":"1"}],"serviceName":"app-beta","servicePort":80}]}]`,
+			wantErr: true,
+		},
+		{
+			desc:    "invalid json",
+			val:     `[{"path":}]`,
+			wantErr: true,
+		},
+		{
+			desc:    "missing path",
+			val:     `[{"rewrite":{"pathPrefix":"/"}}]`,
+			wantErr: true,
+		},
+		{
+			desc:    "both rewrite and redirect",
+			val:     `[{"path":"/","rewrite":{"pathPrefix":"/"},"redirect":{"https":true}}]`,
+			wantErr: true,
+		},
+		{
+			desc:    "empty rewrite",
+			val:     `[{"path":"/","rewrite":{}}]`,
+			wantErr: true,
+		},
+		{
+			desc:    "redirect with path and path prefix",
+			val:     `[{"path":"/","redirect":{"path":"/a","pathPrefix":"/b"}}]`,
+			wantErr: true,
+		},
+		{
+			desc:    "unsupported response code",
+			val:     `[{"path":"/","redirect":{"https":true,"responseCode":"OK"}}]`,
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ing := &v1beta1.Ingress{}
+			if tc.val != "" {
+				ing.Annotations = map[string]string{RouteActionsKey: tc.val}
+			}
+			got, err := FromIngress(ing).RouteActions()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("RouteActions() = %v, want error %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("RouteActions() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
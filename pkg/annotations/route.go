@@ -0,0 +1,232 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package annotations
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// RouteActionsKey is the annotation key used to configure URL rewrites,
+	// redirects and traffic splitting for paths of an Ingress. The value is a
+	// JSON list of route actions, each of which applies to a host and path of
+	// the Ingress spec. An empty host refers to the rules without a host.
+	// Examples:
+	// - annotations:
+	//     networking.gke.io/route-actions: '[{"host":"foo.com","path":"/api/*","rewrite":{"pathPrefix":"/"}}]'
+	// - annotations:
+	//     networking.gke.io/route-actions: '[{"path":"/*","weightedBackends":[{"serviceName":"app","servicePort":80,"weight":90},{"serviceName":"app-canary","servicePort":80,"weight":10}]}]'
+	// - annotations:
+	//     networking.gke.io/route-actions: '[{"path":"/*","routes":[{"headers":[{"name":"Cookie","regex":".*beta=true.*"}],"serviceName":"app-beta","servicePort":80}]}]'
+	// - annotations:
+	//     networking.gke.io/route-actions: '[{"path":"/admin/*","securityPolicy":"admin-policy"}]'
+	// - annotations:
+	//     networking.gke.io/route-actions: '[{"path":"/fn/*","backendService":"projects/p/global/backendServices/serverless"}]'
+	RouteActionsKey = "networking.gke.io/route-actions"
+
+	// MaxBackendWeight is the maximum weight of a weighted backend.
+	MaxBackendWeight = 1000
+)
+
+// Redirect response codes supported by the load balancer.
+var redirectResponseCodes = map[string]bool{
+	"MOVED_PERMANENTLY_DEFAULT": true,
+	"FOUND":                     true,
+	"SEE_OTHER":                 true,
+	"TEMPORARY_REDIRECT":        true,
+	"PERMANENT_REDIRECT":        true,
+}
+
+// RouteAction describes how requests matching a host and path of an Ingress
+// are modified before being forwarded to the backend.
+type RouteAction struct {
+	Host     string       `json:"host,omitempty"`
+	Path     string       `json:"path"`
+	Rewrite  *URLRewrite  `json:"rewrite,omitempty"`
+	Redirect *URLRedirect `json:"redirect,omitempty"`
+	// WeightedBackends, if set, splits the traffic of the path between the
+	// given backends instead of sending it to the backend of the Ingress spec.
+	WeightedBackends []WeightedBackend `json:"weightedBackends,omitempty"`
+	// Routes send the requests of the path which match their conditions to
+	// a different backend. Routes are evaluated in order before the path.
+	Routes []ConditionalRoute `json:"routes,omitempty"`
+	// SecurityPolicy is the name of the Cloud Armor security policy of the
+	// backends of the path, which overrides the one of their BackendConfig.
+	// The paths with the same policy share backend services distinct from
+	// those of the other paths.
+	SecurityPolicy string `json:"securityPolicy,omitempty"`
+	// BackendService is the name or the self link of an existing backend
+	// service, not managed by the controller, which the requests of the
+	// path are sent to instead of the backend of the Ingress spec.
+	BackendService string `json:"backendService,omitempty"`
+}
+
+// ConditionalRoute sends requests matching all of its header and query
+// parameter conditions to a service port.
+type ConditionalRoute struct {
+	Headers     []HeaderMatch      `json:"headers,omitempty"`
+	QueryParams []QueryParamMatch  `json:"queryParams,omitempty"`
+	ServiceName string             `json:"serviceName"`
+	ServicePort intstr.IntOrString `json:"servicePort"`
+}
+
+// HeaderMatch matches a request header. Exactly one of Present, Exact or
+// Regex must be set. Cookies are matched through the Cookie header.
+type HeaderMatch struct {
+	Name    string `json:"name"`
+	Present bool   `json:"present,omitempty"`
+	Exact   string `json:"exact,omitempty"`
+	Regex   string `json:"regex,omitempty"`
+}
+
+// QueryParamMatch matches a query parameter. Exactly one of Present, Exact
+// or Regex must be set.
+type QueryParamMatch struct {
+	Name    string `json:"name"`
+	Present bool   `json:"present,omitempty"`
+	Exact   string `json:"exact,omitempty"`
+	Regex   string `json:"regex,omitempty"`
+}
+
+// WeightedBackend is a service port receiving a share of the traffic of a
+// path proportional to its weight.
+type WeightedBackend struct {
+	ServiceName string             `json:"serviceName"`
+	ServicePort intstr.IntOrString `json:"servicePort"`
+	Weight      int64              `json:"weight"`
+}
+
+// URLRewrite replaces the host and/or the matched path prefix of a request
+// before it is forwarded to the backend.
+type URLRewrite struct {
+	Host       string `json:"host,omitempty"`
+	PathPrefix string `json:"pathPrefix,omitempty"`
+}
+
+// URLRedirect redirects requests instead of forwarding them to the backend.
+type URLRedirect struct {
+	Host       string `json:"host,omitempty"`
+	Path       string `json:"path,omitempty"`
+	PathPrefix string `json:"pathPrefix,omitempty"`
+	HTTPS      bool   `json:"https,omitempty"`
+	StripQuery bool   `json:"stripQuery,omitempty"`
+	// ResponseCode is one of MOVED_PERMANENTLY_DEFAULT (default), FOUND,
+	// SEE_OTHER, TEMPORARY_REDIRECT or PERMANENT_REDIRECT.
+	ResponseCode string `json:"responseCode,omitempty"`
+}
+
+// RouteActions returns the route actions configured on the Ingress. Returns
+// an error if the annotation is malformed.
+func (ing *Ingress) RouteActions() ([]RouteAction, error) {
+	val, ok := ing.v[RouteActionsKey]
+	if !ok {
+		return nil, nil
+	}
+	var actions []RouteAction
+	if err := json.Unmarshal([]byte(val), &actions); err != nil {
+		return nil, fmt.Errorf("%s annotation is invalid json: %v", RouteActionsKey, err)
+	}
+	for _, action := range actions {
+		if err := action.validate(); err != nil {
+			return nil, fmt.Errorf("%s annotation is invalid: %v", RouteActionsKey, err)
+		}
+	}
+	return actions, nil
+}
+
+func (a *RouteAction) validate() error {
+	if a.Path == "" {
+		return fmt.Errorf("path must be set for host %q", a.Host)
+	}
+	if a.Rewrite == nil && a.Redirect == nil && len(a.WeightedBackends) == 0 && len(a.Routes) == 0 && a.SecurityPolicy == "" && a.BackendService == "" {
+		return fmt.Errorf("one of rewrite, redirect, weightedBackends, routes, securityPolicy or backendService must be set for path %q", a.Path)
+	}
+	if a.Redirect != nil && (a.Rewrite != nil || len(a.WeightedBackends) > 0 || a.SecurityPolicy != "" || a.BackendService != "") {
+		return fmt.Errorf("redirect for path %q cannot be combined with rewrite, weightedBackends, securityPolicy or backendService", a.Path)
+	}
+	// The controller does not manage the backend service, thus cannot
+	// attach a security policy to it.
+	if a.BackendService != "" && (len(a.WeightedBackends) > 0 || a.SecurityPolicy != "") {
+		return fmt.Errorf("backendService for path %q cannot be combined with weightedBackends or securityPolicy", a.Path)
+	}
+	if a.Rewrite != nil && a.Rewrite.Host == "" && a.Rewrite.PathPrefix == "" {
+		return fmt.Errorf("rewrite for path %q must set host or pathPrefix", a.Path)
+	}
+	if a.Redirect != nil {
+		if a.Redirect.Path != "" && a.Redirect.PathPrefix != "" {
+			return fmt.Errorf("redirect for path %q cannot set both path and pathPrefix", a.Path)
+		}
+		if a.Redirect.ResponseCode != "" && !redirectResponseCodes[a.Redirect.ResponseCode] {
+			return fmt.Errorf("redirect for path %q has unsupported responseCode %q", a.Path, a.Redirect.ResponseCode)
+		}
+	}
+	if len(a.WeightedBackends) > 0 {
+		var total int64
+		for _, b := range a.WeightedBackends {
+			if b.ServiceName == "" {
+				return fmt.Errorf("weighted backend for path %q must set serviceName", a.Path)
+			}
+			if b.Weight < 0 || b.Weight > MaxBackendWeight {
+				return fmt.Errorf("weighted backend %q for path %q has weight %d, must be between 0 and %d", b.ServiceName, a.Path, b.Weight, MaxBackendWeight)
+			}
+			total += b.Weight
+		}
+		if total == 0 {
+			return fmt.Errorf("weighted backends for path %q must have at least one non-zero weight", a.Path)
+		}
+	}
+	for _, r := range a.Routes {
+		if r.ServiceName == "" {
+			return fmt.Errorf("route for path %q must set serviceName", a.Path)
+		}
+		if len(r.Headers) == 0 && len(r.QueryParams) == 0 {
+			return fmt.Errorf("route to %q for path %q must set headers or queryParams", r.ServiceName, a.Path)
+		}
+		for _, h := range r.Headers {
+			if err := validateMatch("header", h.Name, h.Present, h.Exact, h.Regex); err != nil {
+				return fmt.Errorf("route to %q for path %q: %v", r.ServiceName, a.Path, err)
+			}
+		}
+		for _, q := range r.QueryParams {
+			if err := validateMatch("query parameter", q.Name, q.Present, q.Exact, q.Regex); err != nil {
+				return fmt.Errorf("route to %q for path %q: %v", r.ServiceName, a.Path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateMatch checks that a header or query parameter match has a name and
+// exactly one condition.
+func validateMatch(kind, name string, present bool, exact, regex string) error {
+	if name == "" {
+		return fmt.Errorf("%s match must set name", kind)
+	}
+	conditions := 0
+	for _, set := range []bool{present, exact != "", regex != ""} {
+		if set {
+			conditions++
+		}
+	}
+	if conditions != 1 {
+		return fmt.Errorf("%s match %q must set exactly one of present, exact or regex", kind, name)
+	}
+	return nil
+}
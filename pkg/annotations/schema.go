@@ -0,0 +1,242 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package annotations
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/ingress-gce/pkg/flags"
+)
+
+// AnnotationError is the error of an annotation whose value does not match
+// its schema.
+type AnnotationError struct {
+	// Key is the key of the annotation.
+	Key string
+	// Err is the error of the annotation, e.g. ErrNEGAnnotationInvalid.
+	Err error
+	// Fields are the errors of the value, each prefixed with the path of the
+	// field, e.g. `exposed_ports["443"].name: must be a string`.
+	Fields []string
+}
+
+func (e *AnnotationError) Error() string {
+	return fmt.Sprintf("%v: %s", e.Err, strings.Join(e.Fields, "; "))
+}
+
+// WarningMessage returns the message reporting the error of an annotation
+// which is still accepted, see Service.AnnotationWarning.
+func (e *AnnotationError) WarningMessage() string {
+	return fmt.Sprintf("%v, accepted until --strict-annotation-validation is the default", e)
+}
+
+// jsonType is the type of a JSON value, as named in the errors.
+type jsonType string
+
+const (
+	jsonObject  jsonType = "an object"
+	jsonString  jsonType = "a string"
+	jsonBoolean jsonType = "a boolean"
+)
+
+// schema describes the JSON values accepted by an annotation.
+type schema struct {
+	typ jsonType
+	// properties are the fields of an object. Other fields are rejected.
+	properties map[string]*schema
+	// keys and values describe the keys and values of an object used as a
+	// map, if properties is nil.
+	keys   func(string) []string
+	values *schema
+	// check returns the errors of a string value.
+	check func(string) []string
+}
+
+var (
+	// negAnnotationSchema is the schema of NegAnnotation.
+	negAnnotationSchema = &schema{
+		typ: jsonObject,
+		properties: map[string]*schema{
+			"ingress": {typ: jsonBoolean},
+			"exposed_ports": {
+				typ:  jsonObject,
+				keys: isExposedPortKey,
+				values: &schema{
+					typ: jsonObject,
+					properties: map[string]*schema{
+						"name": {typ: jsonString},
+					},
+				},
+			},
+		},
+	}
+
+	// backendConfigsSchema is the schema of BackendConfigs.
+	backendConfigsSchema = &schema{
+		typ: jsonObject,
+		properties: map[string]*schema{
+			"default": {typ: jsonString, check: validation.IsDNS1123Subdomain},
+			"ports": {
+				typ:    jsonObject,
+				keys:   isPortNameOrNumber,
+				values: &schema{typ: jsonString, check: validation.IsDNS1123Subdomain},
+			},
+		},
+	}
+)
+
+// isPortNumber returns the errors of a port number, as parsed by
+// encoding/json for the int32 keys of a map.
+func isPortNumber(key string) []string {
+	port, err := strconv.ParseInt(key, 10, 32)
+	if err != nil {
+		return []string{"must be a port number"}
+	}
+	return validation.IsValidPortNum(int(port))
+}
+
+// isExposedPortKey returns the errors of a key of exposed_ports: a port
+// number, a range of ports or "all".
+func isExposedPortKey(key string) []string {
+	if _, err := strconv.ParseInt(key, 10, 32); err == nil {
+		return isPortNumber(key)
+	}
+	if _, err := parsePortRange(key); err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
+
+// isPortNameOrNumber returns the errors of the name or number of a
+// ServicePort.
+func isPortNameOrNumber(key string) []string {
+	if _, err := strconv.Atoi(key); err == nil {
+		return isPortNumber(key)
+	}
+	return validation.IsValidPortName(key)
+}
+
+// parseAnnotation unmarshals the value of the annotation with the given key
+// into out. A value which does not unmarshal returns an *AnnotationError with
+// the given err and the errors of all the fields of the value. A value which
+// unmarshals but does not match s used to be accepted, so it is only rejected
+// with --strict-annotation-validation, see AnnotationWarning.
+func parseAnnotation(key, value string, s *schema, err error, out interface{}) error {
+	annotationErr := validateAnnotation(key, value, s, err)
+	if jsonErr := json.Unmarshal([]byte(value), out); jsonErr != nil {
+		if annotationErr != nil {
+			return annotationErr
+		}
+		// The schema is expected to reject all the values which do not
+		// unmarshal.
+		return &AnnotationError{Key: key, Err: err, Fields: []string{jsonErr.Error()}}
+	}
+	if annotationErr != nil && flags.F.StrictAnnotationValidation {
+		return annotationErr
+	}
+	return nil
+}
+
+// validateAnnotation returns an *AnnotationError with the given err and the
+// errors of all the fields of the value of the annotation with the given key,
+// or nil if the value matches s.
+func validateAnnotation(key, value string, s *schema, err error) *AnnotationError {
+	var v interface{}
+	if jsonErr := json.Unmarshal([]byte(value), &v); jsonErr != nil {
+		msg := jsonErr.Error()
+		if syntaxErr, ok := jsonErr.(*json.SyntaxError); ok {
+			msg = fmt.Sprintf("invalid JSON at offset %d: %v", syntaxErr.Offset, syntaxErr)
+		}
+		return &AnnotationError{Key: key, Err: err, Fields: []string{msg}}
+	}
+	if fields := s.validate("", v); len(fields) > 0 {
+		return &AnnotationError{Key: key, Err: err, Fields: fields}
+	}
+	return nil
+}
+
+// validate returns the errors of the value v at path, in the order of the
+// paths.
+func (s *schema) validate(path string, v interface{}) []string {
+	fieldErr := func(msg string) string {
+		if path == "" {
+			return msg
+		}
+		return path + ": " + msg
+	}
+
+	switch s.typ {
+	case jsonBoolean:
+		if _, ok := v.(bool); !ok {
+			return []string{fieldErr("must be " + string(s.typ))}
+		}
+		return nil
+	case jsonString:
+		str, ok := v.(string)
+		if !ok {
+			return []string{fieldErr("must be " + string(s.typ))}
+		}
+		if s.check == nil {
+			return nil
+		}
+		var errs []string
+		for _, msg := range s.check(str) {
+			errs = append(errs, fieldErr(fmt.Sprintf("invalid value %q: %s", str, msg)))
+		}
+		return errs
+	}
+
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return []string{fieldErr("must be " + string(s.typ))}
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var errs []string
+	for _, k := range keys {
+		if s.properties != nil {
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			prop, ok := s.properties[k]
+			if !ok {
+				errs = append(errs, child+": unknown field")
+				continue
+			}
+			errs = append(errs, prop.validate(child, obj[k])...)
+			continue
+		}
+		child := path + "[" + strconv.Quote(k) + "]"
+		if s.keys != nil {
+			for _, msg := range s.keys(k) {
+				errs = append(errs, child+": invalid key: "+msg)
+			}
+		}
+		errs = append(errs, s.values.validate(child, obj[k])...)
+	}
+	return errs
+}
@@ -20,7 +20,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
 	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/ingress-gce/pkg/flags"
 )
 
 const (
@@ -36,17 +43,58 @@ const (
 	// NEGAnnotationKey is the annotation key to enable GCE NEG.
 	// The value of the annotation must be a valid JSON string in the format
 	// specified by type NegAnnotation. To enable, must have either Ingress: true
-	// or a non-empty ExposedPorts map referencing valid ServicePorts.
+	// or a non-empty ExposedPorts map referencing valid ServicePorts. The keys
+	// of exposed_ports may also be ranges of ports, or "all" for all the ports
+	// of the Service.
 	// examples:
 	// - `{"exposed_ports":{"80":{},"443":{}}}`
 	// - `{"ingress":true}`
 	// - `{"ingress": true,"exposed_ports":{"3000":{},"4000":{}}}`
+	// - `{"exposed_ports":{"8000-8100":{}}}`
+	// - `{"exposed_ports":{"all":{}}}`
 	NEGAnnotationKey = "cloud.google.com/neg"
 
 	// NEGStatusKey is the annotation key whose value is the status of the NEGs
-	// on the Service, and is applied by the NEG Controller.
+	// on the Service, and is applied by the NEG Controller. The value is a
+	// JSON string in the format specified by type NegStatus, e.g.
+	// `{"network_endpoint_groups":{"80":"k8s1-..."},"zones":["us-central1-a"],
+	// "network_endpoint_type":"GCE_VM_IP_PORT","target_ports":{"80":"8080"},
+	// "subnetwork":"https://..."}`
 	NEGStatusKey = "cloud.google.com/neg-status"
 
+	// NEGZonesKey is the annotation key pinning the NEGs of the Service to a
+	// subset of the zones of the cluster, e.g. to match a zonal dependency.
+	// The value is a comma separated list of zones, e.g.
+	// `us-central1-a,us-central1-b`.
+	NEGZonesKey = "cloud.google.com/neg-zones"
+
+	// NEGHealthCheckPortKey is the annotation key whose value is the port
+	// health checked on the endpoints of the NEGs of the Service, e.g. a
+	// dedicated admin port, instead of their serving port, e.g. `9000`.
+	NEGHealthCheckPortKey = "cloud.google.com/neg-health-check-port"
+
+	// BackendServicesKey is the annotation key whose value lists the
+	// backend services of the ports of the Service and their health checks,
+	// and is applied by the Ingress controller. The value is a JSON string in
+	// the format specified by type BackendServicesStatus, e.g.
+	// `{"80":[{"backend_service":"https://.../backendServices/k8s1-...",
+	// "health_check":"https://.../healthChecks/k8s1-..."}]}`
+	BackendServicesKey = "cloud.google.com/backend-services"
+
+	// NEGMigrationKey is the annotation key whose value records the service
+	// ports of the Service whose backends are migrating from instance groups
+	// to NEGs, and is applied by the Ingress controller. The value is a JSON
+	// string in the format specified by type NEGMigrationStatus, mapping the
+	// ports to the start of their migration, e.g.
+	// `{"80":"2020-01-01T00:00:00Z"}`
+	NEGMigrationKey = "cloud.google.com/neg-migration"
+
+	// RBSAnnotationKey is the annotation key to provision the external load
+	// balancer of a LoadBalancer Service with a regional backend service
+	// instead of a target pool. The only supported value is RBSEnabled.
+	RBSAnnotationKey = "cloud.google.com/l4-rbs"
+	RBSEnabled       = "enabled"
+
 	// BackendConfigKey is a stringified JSON with two fields:
 	// - "ports": a map of port names or port numbers to backendConfig names
 	// - "default": denotes the default backendConfig name for all ports except
@@ -62,6 +110,9 @@ const (
 	ProtocolHTTPS AppProtocol = "HTTPS"
 	// ProtocolHTTP2 protocol for a service
 	ProtocolHTTP2 AppProtocol = "HTTP2"
+	// ProtocolGRPC protocol for a service. gRPC backends are served over
+	// HTTP/2 and are only supported with NEGs.
+	ProtocolGRPC AppProtocol = "GRPC"
 )
 
 // NegAnnotation is the format of the annotation associated with the
@@ -79,7 +130,125 @@ type NegAnnotation struct {
 	// The exposed NEGs will be created and managed by NEG controller.
 	// ExposedPorts maps ServicePort to attributes of the NEG that should be
 	// associated with the ServicePort.
-	ExposedPorts map[int32]NegAttributes `json:"exposed_ports,omitempty"`
+	ExposedPorts map[int32]NegAttributes `json:"-"`
+	// ExposedPortRanges are the ranges of ServicePorts to be exposed as
+	// stand-alone NEGs. Unlike ExposedPorts, they may match no ServicePort.
+	ExposedPortRanges []PortRange `json:"-"`
+}
+
+// AllPorts is the key of exposed_ports exposing all the ServicePorts.
+const AllPorts = "all"
+
+// PortRange is a range of ports, including First and Last.
+type PortRange struct {
+	First int32
+	Last  int32
+}
+
+// allPortRange is the range of all the ports.
+var allPortRange = PortRange{First: 1, Last: 65535}
+
+// Contains returns true if the port is in the range.
+func (r PortRange) Contains(port int32) bool {
+	return port >= r.First && port <= r.Last
+}
+
+// String returns the range as a key of exposed_ports.
+func (r PortRange) String() string {
+	if r == allPortRange {
+		return AllPorts
+	}
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+// parsePortRange parses a key of exposed_ports which is not a port number.
+func parsePortRange(key string) (PortRange, error) {
+	if key == AllPorts {
+		return allPortRange, nil
+	}
+	var r PortRange
+	parts := strings.SplitN(key, "-", 2)
+	if len(parts) != 2 {
+		return r, fmt.Errorf("must be a port number, a range of ports or %q", AllPorts)
+	}
+	for i, part := range parts {
+		port, err := strconv.ParseInt(part, 10, 32)
+		if err != nil || port < int64(allPortRange.First) || port > int64(allPortRange.Last) {
+			return r, fmt.Errorf("range %q must be between ports %d and %d", key, allPortRange.First, allPortRange.Last)
+		}
+		if i == 0 {
+			r.First = int32(port)
+		} else {
+			r.Last = int32(port)
+		}
+	}
+	if r.First > r.Last {
+		return r, fmt.Errorf("range %q must not end before it starts", key)
+	}
+	return r, nil
+}
+
+// negAnnotationJSON is the JSON format of NegAnnotation, whose exposed ports
+// are keyed by port number or range.
+type negAnnotationJSON struct {
+	Ingress      bool                     `json:"ingress,omitempty"`
+	ExposedPorts map[string]NegAttributes `json:"exposed_ports,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (n NegAnnotation) MarshalJSON() ([]byte, error) {
+	out := negAnnotationJSON{Ingress: n.Ingress}
+	if len(n.ExposedPorts)+len(n.ExposedPortRanges) > 0 {
+		out.ExposedPorts = map[string]NegAttributes{}
+	}
+	for port, attrs := range n.ExposedPorts {
+		out.ExposedPorts[strconv.Itoa(int(port))] = attrs
+	}
+	for _, r := range n.ExposedPortRanges {
+		out.ExposedPorts[r.String()] = NegAttributes{}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (n *NegAnnotation) UnmarshalJSON(data []byte) error {
+	var in negAnnotationJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*n = NegAnnotation{Ingress: in.Ingress}
+	for key, attrs := range in.ExposedPorts {
+		if port, err := strconv.ParseInt(key, 10, 32); err == nil {
+			if n.ExposedPorts == nil {
+				n.ExposedPorts = map[int32]NegAttributes{}
+			}
+			n.ExposedPorts[int32(port)] = attrs
+			continue
+		}
+		r, err := parsePortRange(key)
+		if err != nil {
+			return err
+		}
+		n.ExposedPortRanges = append(n.ExposedPortRanges, r)
+	}
+	sort.Slice(n.ExposedPortRanges, func(i, j int) bool {
+		return n.ExposedPortRanges[i].First < n.ExposedPortRanges[j].First
+	})
+	return nil
+}
+
+// Exposes returns true if the ServicePort is exposed as a stand-alone NEG,
+// either explicitly or by a range.
+func (n *NegAnnotation) Exposes(port int32) bool {
+	if _, ok := n.ExposedPorts[port]; ok {
+		return true
+	}
+	for _, r := range n.ExposedPortRanges {
+		if r.Contains(port) {
+			return true
+		}
+	}
+	return false
 }
 
 // NegAttributes houses the attributes of the NEGs that are associated with the
@@ -98,7 +267,7 @@ func (n *NegAnnotation) NEGEnabledForIngress() bool {
 
 // NEGExposed is true if the service exposes NEGs
 func (n *NegAnnotation) NEGExposed() bool {
-	return len(n.ExposedPorts) > 0
+	return len(n.ExposedPorts) > 0 || len(n.ExposedPortRanges) > 0
 }
 
 // NEGExposed is true if the service uses NEG
@@ -114,6 +283,10 @@ func (n *NegAnnotation) String() string {
 // PortNegMap is the mapping between service port to NEG name
 type PortNegMap map[string]string
 
+// PortTargetPortMap is the mapping between service port and target port,
+// which is a port number or name.
+type PortTargetPortMap map[string]string
+
 // NegStatus contains name and zone of the Network Endpoint Group
 // resources associated with this service
 type NegStatus struct {
@@ -122,6 +295,14 @@ type NegStatus struct {
 	NetworkEndpointGroups PortNegMap `json:"network_endpoint_groups,omitempty"`
 	// Zones is a list of zones where the NEGs exist.
 	Zones []string `json:"zones,omitempty"`
+	// NetworkEndpointType is the type of the network endpoints of the NEGs,
+	// e.g. GCE_VM_IP_PORT.
+	NetworkEndpointType string `json:"network_endpoint_type,omitempty"`
+	// TargetPorts returns the mapping between service port and the target
+	// port of the network endpoints of its NEG.
+	TargetPorts PortTargetPortMap `json:"target_ports,omitempty"`
+	// Subnetwork is the URL of the subnetwork of the NEGs.
+	Subnetwork string `json:"subnetwork,omitempty"`
 }
 
 func (ns NegStatus) Marshal() (string, error) {
@@ -149,6 +330,24 @@ func ParseNegStatus(annotation string) (NegStatus, error) {
 	return *ret, err
 }
 
+// BackendServiceStatus is a backend service of a service port.
+type BackendServiceStatus struct {
+	// BackendService is the self-link of the backend service.
+	BackendService string `json:"backend_service"`
+	// HealthCheck is the self-link of the health check of the backend
+	// service.
+	HealthCheck string `json:"health_check,omitempty"`
+}
+
+// BackendServicesStatus maps the service ports of a Service to their backend
+// services. A service port has several backend services when it is used by
+// Ingresses of different classes, or with different security policies.
+type BackendServicesStatus map[string][]BackendServiceStatus
+
+// NEGMigrationStatus maps the service ports of a Service migrating from
+// instance groups to NEGs to the start of their migration.
+type NEGMigrationStatus map[string]time.Time
+
 // AppProtocol describes the service protocol.
 type AppProtocol string
 
@@ -183,7 +382,7 @@ func (svc *Service) ApplicationProtocols() (map[string]AppProtocol, error) {
 	for _, proto := range portToProtos {
 		switch proto {
 		case ProtocolHTTP, ProtocolHTTPS:
-		case ProtocolHTTP2:
+		case ProtocolHTTP2, ProtocolGRPC:
 		default:
 			return nil, fmt.Errorf("invalid port application protocol: %v", proto)
 		}
@@ -196,11 +395,13 @@ var (
 	ErrBackendConfigNoneFound         = errors.New("no BackendConfig's found in annotation")
 	ErrBackendConfigInvalidJSON       = errors.New("BackendConfig annotation is invalid json")
 	ErrBackendConfigAnnotationMissing = errors.New("BackendConfig annotation is missing")
-	ErrNEGAnnotationInvalid           = errors.New("NEG annotation is invalid.")
+	ErrNEGAnnotationInvalid           = errors.New("NEG annotation is invalid")
+	ErrNEGHealthCheckPortInvalid      = errors.New("NEG health check port annotation is invalid")
 )
 
 // NEGAnnotation returns true if NEG annotation is found.
-// If found, it also returns NEG annotation struct.
+// If found, it also returns NEG annotation struct. An invalid annotation
+// returns an *AnnotationError, see parseAnnotation.
 func (svc *Service) NEGAnnotation() (*NegAnnotation, bool, error) {
 	var res NegAnnotation
 	annotation, ok := svc.v[NEGAnnotationKey]
@@ -209,8 +410,8 @@ func (svc *Service) NEGAnnotation() (*NegAnnotation, bool, error) {
 	}
 
 	// TODO: add link to Expose NEG documentation when complete
-	if err := json.Unmarshal([]byte(annotation), &res); err != nil {
-		return nil, true, ErrNEGAnnotationInvalid
+	if err := parseAnnotation(NEGAnnotationKey, annotation, negAnnotationSchema, ErrNEGAnnotationInvalid, &res); err != nil {
+		return nil, true, err
 	}
 
 	return &res, true, nil
@@ -232,12 +433,72 @@ func (svc *Service) NEGStatus() (*NegStatus, bool, error) {
 	return &res, true, nil
 }
 
+// NEGZones returns the sorted zones the NEGs of the Service are pinned to,
+// and false if they are not pinned.
+func (svc *Service) NEGZones() ([]string, bool) {
+	val, ok := svc.v[NEGZonesKey]
+	if !ok {
+		return nil, false
+	}
+	zones := sets.NewString()
+	for _, zone := range strings.Split(val, ",") {
+		if zone = strings.TrimSpace(zone); zone != "" {
+			zones.Insert(zone)
+		}
+	}
+	return zones.List(), true
+}
+
+// NEGHealthCheckPort returns the port health checked on the endpoints of
+// the NEGs of the Service, and false if the annotation is not set. A value
+// which is not a port returns an *AnnotationError.
+func (svc *Service) NEGHealthCheckPort() (int64, bool, error) {
+	val, ok := svc.v[NEGHealthCheckPortKey]
+	if !ok {
+		return 0, false, nil
+	}
+	port, err := strconv.ParseInt(strings.TrimSpace(val), 10, 32)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, true, &AnnotationError{Key: NEGHealthCheckPortKey, Err: ErrNEGHealthCheckPortInvalid, Fields: []string{fmt.Sprintf("%q is not a port between 1 and 65535", val)}}
+	}
+	return port, true, nil
+}
+
+// BackendServicesStatus returns the backend services of the ports of the
+// Service, and false if the annotation is not set.
+func (svc *Service) BackendServicesStatus() (BackendServicesStatus, bool, error) {
+	val, ok := svc.v[BackendServicesKey]
+	if !ok {
+		return nil, false, nil
+	}
+	status := BackendServicesStatus{}
+	if err := json.Unmarshal([]byte(val), &status); err != nil {
+		return nil, true, fmt.Errorf("error parsing backend services status: %v", err)
+	}
+	return status, true, nil
+}
+
+// NEGMigrationStatus returns the service ports of the Service migrating from
+// instance groups to NEGs, and false if the annotation is not set.
+func (svc *Service) NEGMigrationStatus() (NEGMigrationStatus, bool, error) {
+	val, ok := svc.v[NEGMigrationKey]
+	if !ok {
+		return nil, false, nil
+	}
+	status := NEGMigrationStatus{}
+	if err := json.Unmarshal([]byte(val), &status); err != nil {
+		return nil, true, fmt.Errorf("error parsing NEG migration status: %v", err)
+	}
+	return status, true, nil
+}
+
 type BackendConfigs struct {
 	Default string            `json:"default,omitempty"`
 	Ports   map[string]string `json:"ports,omitempty"`
 }
 
-// GetBackendConfigs returns BackendConfigs for the service.
+// GetBackendConfigs returns BackendConfigs for the service. An invalid
+// annotation returns an *AnnotationError.
 func (svc *Service) GetBackendConfigs() (*BackendConfigs, error) {
 	val, ok := svc.v[BackendConfigKey]
 	if !ok {
@@ -245,11 +506,38 @@ func (svc *Service) GetBackendConfigs() (*BackendConfigs, error) {
 	}
 
 	configs := BackendConfigs{}
-	if err := json.Unmarshal([]byte(val), &configs); err != nil {
-		return nil, ErrBackendConfigInvalidJSON
+	if err := parseAnnotation(BackendConfigKey, val, backendConfigsSchema, ErrBackendConfigInvalidJSON, &configs); err != nil {
+		return nil, err
 	}
 	if configs.Default == "" && len(configs.Ports) == 0 {
 		return nil, ErrBackendConfigNoneFound
 	}
 	return &configs, nil
 }
+
+// AnnotationWarning returns the errors of the NEG or BackendConfig annotation
+// with the given key which does not match its schema, but is still accepted
+// without --strict-annotation-validation. It returns nil if the annotation is
+// missing, valid, or rejected by NEGAnnotation and GetBackendConfigs.
+func (svc *Service) AnnotationWarning(key string) *AnnotationError {
+	if flags.F.StrictAnnotationValidation {
+		return nil
+	}
+	value, ok := svc.v[key]
+	if !ok {
+		return nil
+	}
+	switch key {
+	case NEGAnnotationKey:
+		if json.Unmarshal([]byte(value), &NegAnnotation{}) != nil {
+			return nil
+		}
+		return validateAnnotation(key, value, negAnnotationSchema, ErrNEGAnnotationInvalid)
+	case BackendConfigKey:
+		if json.Unmarshal([]byte(value), &BackendConfigs{}) != nil {
+			return nil
+		}
+		return validateAnnotation(key, value, backendConfigsSchema, ErrBackendConfigInvalidJSON)
+	}
+	return nil
+}
@@ -23,6 +23,7 @@ import (
 
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/ingress-gce/pkg/flags"
 )
 
 func TestNEGAnnotation(t *testing.T) {
@@ -52,7 +53,11 @@ func TestNEGAnnotation(t *testing.T) {
 				},
 			},
 			expectFound: true,
-			expectError: ErrNEGAnnotationInvalid,
+			expectError: &AnnotationError{
+				Key:    NEGAnnotationKey,
+				Err:    ErrNEGAnnotationInvalid,
+				Fields: []string{"invalid JSON at offset 2: invalid character 'o' in literal false (expecting 'a')"},
+			},
 		},
 		{
 			desc: "NEG annotation is malformed 2",
@@ -64,7 +69,32 @@ func TestNEGAnnotation(t *testing.T) {
 				},
 			},
 			expectFound: true,
-			expectError: ErrNEGAnnotationInvalid,
+			expectError: &AnnotationError{
+				Key:    NEGAnnotationKey,
+				Err:    ErrNEGAnnotationInvalid,
+				Fields: []string{"invalid JSON at offset 19: invalid character '8' looking for beginning of object key string"},
+			},
+		},
+		{
+			desc: "NEG annotation does not match the schema",
+			svc: &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						NEGAnnotationKey: `{"ingress":"true","exposed_ports":{"443":{"name":1},"http":{}},"exposed":true}`,
+					},
+				},
+			},
+			expectFound: true,
+			expectError: &AnnotationError{
+				Key: NEGAnnotationKey,
+				Err: ErrNEGAnnotationInvalid,
+				Fields: []string{
+					"exposed: unknown field",
+					`exposed_ports["443"].name: must be a string`,
+					`exposed_ports["http"]: invalid key: must be a port number, a range of ports or "all"`,
+					"ingress: must be a boolean",
+				},
+			},
 		},
 		{
 			desc: "NEG enabled for ingress",
@@ -135,6 +165,60 @@ func TestNEGAnnotation(t *testing.T) {
 			ingress:    true,
 			exposed:    true,
 		},
+		{
+			desc: "Ranges of ports exposed",
+			svc: &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						NEGAnnotationKey: `{"exposed_ports":{"80":{}, "9000-9100":{}, "8000-8080":{}}}`,
+					},
+				},
+			},
+			expectFound: true,
+			expectNegAnnotation: &NegAnnotation{
+				ExposedPorts:      map[int32]NegAttributes{int32(80): {}},
+				ExposedPortRanges: []PortRange{{First: 8000, Last: 8080}, {First: 9000, Last: 9100}},
+			},
+			negEnabled: true,
+			ingress:    false,
+			exposed:    true,
+		},
+		{
+			desc: "All ports exposed",
+			svc: &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						NEGAnnotationKey: `{"exposed_ports":{"all":{}}}`,
+					},
+				},
+			},
+			expectFound: true,
+			expectNegAnnotation: &NegAnnotation{
+				ExposedPortRanges: []PortRange{{First: 1, Last: 65535}},
+			},
+			negEnabled: true,
+			ingress:    false,
+			exposed:    true,
+		},
+		{
+			desc: "Invalid ranges of ports",
+			svc: &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						NEGAnnotationKey: `{"exposed_ports":{"90-80":{}, "0-80":{}}}`,
+					},
+				},
+			},
+			expectFound: true,
+			expectError: &AnnotationError{
+				Key: NEGAnnotationKey,
+				Err: ErrNEGAnnotationInvalid,
+				Fields: []string{
+					`exposed_ports["0-80"]: invalid key: range "0-80" must be between ports 1 and 65535`,
+					`exposed_ports["90-80"]: invalid key: range "90-80" must not end before it starts`,
+				},
+			},
+		},
 	} {
 		negAnnotation, found, err := FromService(tc.svc).NEGAnnotation()
 		if fmt.Sprintf("%q", err) != fmt.Sprintf("%q", tc.expectError) {
@@ -281,6 +365,16 @@ func TestService(t *testing.T) {
 			},
 			appProtocols: map[string]AppProtocol{"443": "HTTP2"},
 		},
+		{
+			svc: &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						GoogleServiceApplicationProtocolKey: `{"grpc": "GRPC"}`,
+					},
+				},
+			},
+			appProtocols: map[string]AppProtocol{"grpc": "GRPC"},
+		},
 		{
 			svc: &v1.Service{
 				ObjectMeta: metav1.ObjectMeta{
@@ -317,6 +411,9 @@ func TestService(t *testing.T) {
 }
 
 func TestBackendConfigs(t *testing.T) {
+	defer func(strict bool) { flags.F.StrictAnnotationValidation = strict }(flags.F.StrictAnnotationValidation)
+	flags.F.StrictAnnotationValidation = true
+
 	testcases := []struct {
 		desc            string
 		svc             *v1.Service
@@ -384,7 +481,11 @@ func TestBackendConfigs(t *testing.T) {
 					},
 				},
 			},
-			expectedErr: ErrBackendConfigInvalidJSON,
+			expectedErr: &AnnotationError{
+				Key:    BackendConfigKey,
+				Err:    ErrBackendConfigInvalidJSON,
+				Fields: []string{"invalid JSON at offset 1: invalid character 'i' looking for beginning of value"},
+			},
 		},
 		{
 			desc: "wrong field name in backendConfig annotation",
@@ -395,19 +496,105 @@ func TestBackendConfigs(t *testing.T) {
 					},
 				},
 			},
+			expectedErr: &AnnotationError{
+				Key:    BackendConfigKey,
+				Err:    ErrBackendConfigInvalidJSON,
+				Fields: []string{"portstypo: unknown field"},
+			},
+		},
+		{
+			desc: "no backendConfig in annotation",
+			svc: &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						BackendConfigKey: `{"ports":{}}`,
+					},
+				},
+			},
 			expectedErr: ErrBackendConfigNoneFound,
 		},
+		{
+			desc: "invalid backendConfig names in annotation",
+			svc: &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						BackendConfigKey: `{"default":"Config","ports":{"80":"config-http","https_port":"config-https"}}`,
+					},
+				},
+			},
+			expectedErr: &AnnotationError{
+				Key: BackendConfigKey,
+				Err: ErrBackendConfigInvalidJSON,
+				Fields: []string{
+					`default: invalid value "Config": a DNS-1123 subdomain must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character (e.g. 'example.com', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')`,
+					`ports["https_port"]: invalid key: must contain only alpha-numeric characters (a-z, 0-9), and hyphens (-)`,
+				},
+			},
+		},
 	}
 
 	for _, tc := range testcases {
 		svc := FromService(tc.svc)
 		configs, err := svc.GetBackendConfigs()
-		if !reflect.DeepEqual(configs, tc.expectedConfigs) || tc.expectedErr != err {
+		if !reflect.DeepEqual(configs, tc.expectedConfigs) || !reflect.DeepEqual(err, tc.expectedErr) {
 			t.Errorf("%s: for annotations %+v; svc.GetBackendConfigs() = %v, %v; want %v, %v", tc.desc, svc.v, configs, err, tc.expectedConfigs, tc.expectedErr)
 		}
 	}
 }
 
+func TestAnnotationWarning(t *testing.T) {
+	for _, tc := range []struct {
+		desc        string
+		key         string
+		annotation  string
+		wantWarning []string
+	}{
+		{
+			desc:       "valid NEG annotation",
+			key:        NEGAnnotationKey,
+			annotation: `{"ingress":true}`,
+		},
+		{
+			desc:        "NEG annotation with an unknown field",
+			key:         NEGAnnotationKey,
+			annotation:  `{"ingress":true,"exposed":{}}`,
+			wantWarning: []string{"exposed: unknown field"},
+		},
+		{
+			// Rejected by NEGAnnotation, as before the schema.
+			desc:       "malformed NEG annotation",
+			key:        NEGAnnotationKey,
+			annotation: `{"ingress":"true"}`,
+		},
+		{
+			desc:        "invalid backendConfig names",
+			key:         BackendConfigKey,
+			annotation:  `{"ports":{"80":"config-http","https_port":"config-https"}}`,
+			wantWarning: []string{`ports["https_port"]: invalid key: must contain only alpha-numeric characters (a-z, 0-9), and hyphens (-)`},
+		},
+	} {
+		svc := FromService(&v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{tc.key: tc.annotation}}})
+		var got []string
+		if warning := svc.AnnotationWarning(tc.key); warning != nil {
+			got = warning.Fields
+		}
+		if !reflect.DeepEqual(got, tc.wantWarning) {
+			t.Errorf("%s: AnnotationWarning(%q) = %v, want %v", tc.desc, tc.key, got, tc.wantWarning)
+		}
+
+		// Annotations with warnings are accepted.
+		var err error
+		if tc.key == NEGAnnotationKey {
+			_, _, err = svc.NEGAnnotation()
+		} else {
+			_, err = svc.GetBackendConfigs()
+		}
+		if tc.wantWarning != nil && err != nil {
+			t.Errorf("%s: got error %v for an annotation with warnings, want nil", tc.desc, err)
+		}
+	}
+}
+
 func TestParseNegStatus(t *testing.T) {
 	for _, tc := range []struct {
 		desc            string
@@ -459,3 +646,72 @@ func TestParseNegStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestNEGZones(t *testing.T) {
+	for _, tc := range []struct {
+		desc        string
+		annotations map[string]string
+		wantZones   []string
+		wantFound   bool
+	}{
+		{
+			desc: "No annotation",
+		},
+		{
+			desc:        "Zones are trimmed, deduplicated and sorted",
+			annotations: map[string]string{NEGZonesKey: "us-central1-b, us-central1-a,,us-central1-b"},
+			wantZones:   []string{"us-central1-a", "us-central1-b"},
+			wantFound:   true,
+		},
+		{
+			desc:        "Empty annotation",
+			annotations: map[string]string{NEGZonesKey: ""},
+			wantZones:   []string{},
+			wantFound:   true,
+		},
+	} {
+		svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}
+		zones, found := FromService(svc).NEGZones()
+		if found != tc.wantFound || !reflect.DeepEqual(zones, tc.wantZones) {
+			t.Errorf("%s: NEGZones() = %v, %v; want %v, %v", tc.desc, zones, found, tc.wantZones, tc.wantFound)
+		}
+	}
+}
+
+func TestNEGHealthCheckPort(t *testing.T) {
+	for _, tc := range []struct {
+		desc        string
+		annotations map[string]string
+		wantPort    int64
+		wantFound   bool
+		wantErr     bool
+	}{
+		{
+			desc: "No annotation",
+		},
+		{
+			desc:        "Valid port",
+			annotations: map[string]string{NEGHealthCheckPortKey: " 9000"},
+			wantPort:    9000,
+			wantFound:   true,
+		},
+		{
+			desc:        "Not a number",
+			annotations: map[string]string{NEGHealthCheckPortKey: "admin"},
+			wantFound:   true,
+			wantErr:     true,
+		},
+		{
+			desc:        "Out of range",
+			annotations: map[string]string{NEGHealthCheckPortKey: "70000"},
+			wantFound:   true,
+			wantErr:     true,
+		},
+	} {
+		svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}
+		port, found, err := FromService(svc).NEGHealthCheckPort()
+		if port != tc.wantPort || found != tc.wantFound || (err != nil) != tc.wantErr {
+			t.Errorf("%s: NEGHealthCheckPort() = %d, %v, %v; want %d, %v, error: %v", tc.desc, port, found, err, tc.wantPort, tc.wantFound, tc.wantErr)
+		}
+	}
+}
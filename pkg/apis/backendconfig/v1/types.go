@@ -43,6 +43,8 @@ type BackendConfigSpec struct {
 	ConnectionDraining   *ConnectionDrainingConfig   `json:"connectionDraining,omitempty"`
 	SessionAffinity      *SessionAffinityConfig      `json:"sessionAffinity,omitempty"`
 	CustomRequestHeaders *CustomRequestHeadersConfig `json:"customRequestHeaders,omitempty"`
+	HealthCheck          *HealthCheckConfig          `json:"healthCheck,omitempty"`
+	Alerting             *AlertingConfig             `json:"alerting,omitempty"`
 }
 
 // BackendConfigStatus is the status for a BackendConfig resource
@@ -132,3 +134,47 @@ type SessionAffinityConfig struct {
 type CustomRequestHeadersConfig struct {
 	Headers []string `json:"headers,omitempty"`
 }
+
+// HealthCheckConfig contains configuration for the health check.
+// Fields that are set take precedence over values inferred from the
+// readiness probe and are never reverted by the controller.
+// +k8s:openapi-gen=true
+type HealthCheckConfig struct {
+	// CheckIntervalSec is a health check parameter. See
+	// https://cloud.google.com/compute/docs/reference/rest/v1/healthChecks.
+	CheckIntervalSec *int64 `json:"checkIntervalSec,omitempty"`
+	// TimeoutSec is a health check parameter. See
+	// https://cloud.google.com/compute/docs/reference/rest/v1/healthChecks.
+	TimeoutSec *int64 `json:"timeoutSec,omitempty"`
+	// HealthyThreshold is a health check parameter. See
+	// https://cloud.google.com/compute/docs/reference/rest/v1/healthChecks.
+	HealthyThreshold *int64 `json:"healthyThreshold,omitempty"`
+	// UnhealthyThreshold is a health check parameter. See
+	// https://cloud.google.com/compute/docs/reference/rest/v1/healthChecks.
+	UnhealthyThreshold *int64 `json:"unhealthyThreshold,omitempty"`
+	// Type is a health check parameter. One of HTTP, HTTPS or HTTP2.
+	Type *string `json:"type,omitempty"`
+	// RequestPath is a health check parameter. See
+	// https://cloud.google.com/compute/docs/reference/rest/v1/healthChecks.
+	RequestPath *string `json:"requestPath,omitempty"`
+	// Port is a health check parameter. See
+	// https://cloud.google.com/compute/docs/reference/rest/v1/healthChecks.
+	Port *int64 `json:"port,omitempty"`
+}
+
+// AlertingConfig contains configuration for the Cloud Monitoring alert
+// policies on the 5xx rate and latency of the backend service.
+// +k8s:openapi-gen=true
+type AlertingConfig struct {
+	// Enabled creates the alert policies. They are deleted when disabled.
+	Enabled bool `json:"enabled"`
+	// ErrorRatePercent is the percentage of 5xx responses over 5 minutes
+	// above which the error rate policy fires. Defaults to 1.
+	ErrorRatePercent *int64 `json:"errorRatePercent,omitempty"`
+	// LatencyThresholdMs is the 99th percentile backend latency over 5
+	// minutes above which the latency policy fires. Defaults to 1000.
+	LatencyThresholdMs *int64 `json:"latencyThresholdMs,omitempty"`
+	// NotificationChannels are the names of the notification channels of the
+	// policies, e.g. projects/[PROJECT_ID]/notificationChannels/[CHANNEL_ID].
+	NotificationChannels []string `json:"notificationChannels,omitempty"`
+}
@@ -29,17 +29,68 @@ import (
 
 func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenAPIDefinition {
 	return map[string]common.OpenAPIDefinition{
+		"k8s.io/ingress-gce/pkg/apis/backendconfig/v1.AlertingConfig":           schema_pkg_apis_backendconfig_v1_AlertingConfig(ref),
 		"k8s.io/ingress-gce/pkg/apis/backendconfig/v1.BackendConfig":            schema_pkg_apis_backendconfig_v1_BackendConfig(ref),
 		"k8s.io/ingress-gce/pkg/apis/backendconfig/v1.BackendConfigSpec":        schema_pkg_apis_backendconfig_v1_BackendConfigSpec(ref),
 		"k8s.io/ingress-gce/pkg/apis/backendconfig/v1.CDNConfig":                schema_pkg_apis_backendconfig_v1_CDNConfig(ref),
 		"k8s.io/ingress-gce/pkg/apis/backendconfig/v1.CacheKeyPolicy":           schema_pkg_apis_backendconfig_v1_CacheKeyPolicy(ref),
 		"k8s.io/ingress-gce/pkg/apis/backendconfig/v1.ConnectionDrainingConfig": schema_pkg_apis_backendconfig_v1_ConnectionDrainingConfig(ref),
+		"k8s.io/ingress-gce/pkg/apis/backendconfig/v1.HealthCheckConfig":        schema_pkg_apis_backendconfig_v1_HealthCheckConfig(ref),
 		"k8s.io/ingress-gce/pkg/apis/backendconfig/v1.IAPConfig":                schema_pkg_apis_backendconfig_v1_IAPConfig(ref),
 		"k8s.io/ingress-gce/pkg/apis/backendconfig/v1.OAuthClientCredentials":   schema_pkg_apis_backendconfig_v1_OAuthClientCredentials(ref),
 		"k8s.io/ingress-gce/pkg/apis/backendconfig/v1.SessionAffinityConfig":    schema_pkg_apis_backendconfig_v1_SessionAffinityConfig(ref),
 	}
 }
 
+func schema_pkg_apis_backendconfig_v1_AlertingConfig(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "AlertingConfig contains configuration for the Cloud Monitoring alert policies on the 5xx rate and latency of the backend service.",
+				Properties: map[string]spec.Schema{
+					"enabled": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Enabled creates the alert policies. They are deleted when disabled.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"errorRatePercent": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ErrorRatePercent is the percentage of 5xx responses over 5 minutes above which the error rate policy fires. Defaults to 1.",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"latencyThresholdMs": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LatencyThresholdMs is the 99th percentile backend latency over 5 minutes above which the latency policy fires. Defaults to 1000.",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"notificationChannels": {
+						SchemaProps: spec.SchemaProps{
+							Description: "NotificationChannels are the names of the notification channels of the policies, e.g. projects/[PROJECT_ID]/notificationChannels/[CHANNEL_ID].",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+				},
+				Required: []string{"enabled"},
+			},
+		},
+		Dependencies: []string{},
+	}
+}
+
 func schema_pkg_apis_backendconfig_v1_BackendConfig(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -119,11 +170,21 @@ func schema_pkg_apis_backendconfig_v1_BackendConfigSpec(ref common.ReferenceCall
 							Ref: ref("k8s.io/ingress-gce/pkg/apis/backendconfig/v1.SessionAffinityConfig"),
 						},
 					},
+					"healthCheck": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("k8s.io/ingress-gce/pkg/apis/backendconfig/v1.HealthCheckConfig"),
+						},
+					},
+					"alerting": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("k8s.io/ingress-gce/pkg/apis/backendconfig/v1.AlertingConfig"),
+						},
+					},
 				},
 			},
 		},
 		Dependencies: []string{
-			"k8s.io/ingress-gce/pkg/apis/backendconfig/v1.CDNConfig", "k8s.io/ingress-gce/pkg/apis/backendconfig/v1.ConnectionDrainingConfig", "k8s.io/ingress-gce/pkg/apis/backendconfig/v1.IAPConfig", "k8s.io/ingress-gce/pkg/apis/backendconfig/v1.SecurityPolicyConfig", "k8s.io/ingress-gce/pkg/apis/backendconfig/v1.SessionAffinityConfig"},
+			"k8s.io/ingress-gce/pkg/apis/backendconfig/v1.AlertingConfig", "k8s.io/ingress-gce/pkg/apis/backendconfig/v1.CDNConfig", "k8s.io/ingress-gce/pkg/apis/backendconfig/v1.ConnectionDrainingConfig", "k8s.io/ingress-gce/pkg/apis/backendconfig/v1.HealthCheckConfig", "k8s.io/ingress-gce/pkg/apis/backendconfig/v1.IAPConfig", "k8s.io/ingress-gce/pkg/apis/backendconfig/v1.SecurityPolicyConfig", "k8s.io/ingress-gce/pkg/apis/backendconfig/v1.SessionAffinityConfig"},
 	}
 }
 
@@ -235,6 +296,68 @@ func schema_pkg_apis_backendconfig_v1_ConnectionDrainingConfig(ref common.Refere
 	}
 }
 
+func schema_pkg_apis_backendconfig_v1_HealthCheckConfig(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "HealthCheckConfig contains configuration for the health check. Fields that are set take precedence over values inferred from the readiness probe and are never reverted by the controller.",
+				Properties: map[string]spec.Schema{
+					"checkIntervalSec": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CheckIntervalSec is a health check parameter. See https://cloud.google.com/compute/docs/reference/rest/v1/healthChecks.",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"timeoutSec": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TimeoutSec is a health check parameter. See https://cloud.google.com/compute/docs/reference/rest/v1/healthChecks.",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"healthyThreshold": {
+						SchemaProps: spec.SchemaProps{
+							Description: "HealthyThreshold is a health check parameter. See https://cloud.google.com/compute/docs/reference/rest/v1/healthChecks.",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"unhealthyThreshold": {
+						SchemaProps: spec.SchemaProps{
+							Description: "UnhealthyThreshold is a health check parameter. See https://cloud.google.com/compute/docs/reference/rest/v1/healthChecks.",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"type": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Type is a health check parameter. One of HTTP, HTTPS or HTTP2.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"requestPath": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RequestPath is a health check parameter. See https://cloud.google.com/compute/docs/reference/rest/v1/healthChecks.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"port": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Port is a health check parameter. See https://cloud.google.com/compute/docs/reference/rest/v1/healthChecks.",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{},
+	}
+}
+
 func schema_pkg_apis_backendconfig_v1_IAPConfig(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -0,0 +1,66 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DiagnosticReport lists the misconfigurations of the Ingresses and Services
+// of the cluster found by the last self-diagnosis of the controller.
+//
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DiagnosticReport struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DiagnosticReportSpec   `json:"spec"`
+	Status DiagnosticReportStatus `json:"status"`
+}
+
+// DiagnosticReportSpec is the spec for a DiagnosticReport resource
+type DiagnosticReportSpec struct{}
+
+// DiagnosticReportStatus is the status for a DiagnosticReport resource
+type DiagnosticReportStatus struct {
+	// LastDiagnosisTime is the time of the self-diagnosis.
+	LastDiagnosisTime metav1.Time `json:"lastDiagnosisTime"`
+	// Findings are the misconfigurations found, empty if none.
+	Findings []Finding `json:"findings,omitempty"`
+}
+
+// Finding is a misconfiguration of a Kubernetes object.
+type Finding struct {
+	// Check is the name of the check which found the misconfiguration.
+	Check string `json:"check"`
+	// Kind, Namespace and Name identify the misconfigured object.
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// Message describes the misconfiguration and how to fix it.
+	Message string `json:"message"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// DiagnosticReportList is a list of DiagnosticReport resources
+type DiagnosticReportList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []DiagnosticReport `json:"items"`
+}
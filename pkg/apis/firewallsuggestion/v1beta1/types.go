@@ -0,0 +1,87 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FirewallSuggestion describes a change to a firewall rule which the
+// controller could not make itself, typically because the firewall rules of a
+// Shared VPC are managed in the host project. Automation with permissions in
+// the network project can apply the suggested change.
+//
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type FirewallSuggestion struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   FirewallSuggestionSpec   `json:"spec"`
+	Status FirewallSuggestionStatus `json:"status"`
+}
+
+// FirewallSuggestionSpec is the spec for a FirewallSuggestion resource
+type FirewallSuggestionSpec struct {
+	// Operation is the change to make to the firewall rule. One of CREATE,
+	// UPDATE or DELETE.
+	Operation string `json:"operation"`
+	// Project is the project of the network of the firewall rule.
+	Project string `json:"project"`
+	// Firewall is the desired firewall rule. Only its name is set for DELETE.
+	Firewall FirewallRule `json:"firewall"`
+	// Command is the gcloud command making the change.
+	Command string `json:"command,omitempty"`
+}
+
+const (
+	// OperationCreate requests the creation of the firewall rule.
+	OperationCreate = "CREATE"
+	// OperationUpdate requests the update of the firewall rule.
+	OperationUpdate = "UPDATE"
+	// OperationDelete requests the deletion of the firewall rule.
+	OperationDelete = "DELETE"
+)
+
+// FirewallRule is a GCE firewall rule allowing ingress traffic.
+type FirewallRule struct {
+	Name                  string            `json:"name"`
+	Network               string            `json:"network,omitempty"`
+	Description           string            `json:"description,omitempty"`
+	SourceRanges          []string          `json:"sourceRanges,omitempty"`
+	TargetTags            []string          `json:"targetTags,omitempty"`
+	Allowed               []FirewallAllowed `json:"allowed,omitempty"`
+	TargetServiceAccounts []string          `json:"targetServiceAccounts,omitempty"`
+}
+
+// FirewallAllowed is a protocol and the ports allowed by a firewall rule.
+type FirewallAllowed struct {
+	IPProtocol string   `json:"ipProtocol"`
+	Ports      []string `json:"ports,omitempty"`
+}
+
+// FirewallSuggestionStatus is the status for a FirewallSuggestion resource
+type FirewallSuggestionStatus struct{}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// FirewallSuggestionList is a list of FirewallSuggestion resources
+type FirewallSuggestionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []FirewallSuggestion `json:"items"`
+}
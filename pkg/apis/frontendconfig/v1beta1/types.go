@@ -36,9 +36,86 @@ type FrontendConfig struct {
 // FrontendConfigSpec is the spec for a FrontendConfig resource
 // +k8s:openapi-gen=true
 type FrontendConfigSpec struct {
-	// Add individual features here
+	// QuicOverride controls whether the target HTTPS proxy negotiates QUIC
+	// (HTTP/3) with clients. One of NONE, ENABLE or DISABLE. The setting of
+	// the proxy is left unchanged if empty.
+	QuicOverride string `json:"quicOverride,omitempty"`
+	// HttpKeepAliveTimeoutSec is the time in seconds the target proxies keep
+	// idle HTTP connections from clients open, between 5 and 1200. The load
+	// balancer default is used if unset.
+	HttpKeepAliveTimeoutSec int64 `json:"httpKeepAliveTimeoutSec,omitempty"`
+	// NetworkTier is the network tier of the forwarding rules and static IP
+	// of an external load balancer, PREMIUM or STANDARD. Standard tier load
+	// balancers are regional, in the region of the cluster. The tier of the
+	// IngressClass, or else PREMIUM, is used if empty.
+	NetworkTier string `json:"networkTier,omitempty"`
+	// AllowGlobalAccess controls whether clients in all the regions of the
+	// network can reach an internal load balancer, rather than only the
+	// clients in its region. The setting of the forwarding rules is left
+	// unchanged if unset. External load balancers ignore it.
+	AllowGlobalAccess *bool `json:"allowGlobalAccess,omitempty"`
+	// HttpsPorts are the ports served by the target HTTPS proxy, [443] if
+	// empty. The first port is served by the HTTPS forwarding rule, and each
+	// other port by an additional forwarding rule with the same IP.
+	HttpsPorts []int64 `json:"httpsPorts,omitempty"`
+	// MutualTLS configures the validation of the client certificates by the
+	// target HTTPS proxy. The proxy is left unchanged if unset, and an empty
+	// MutualTLS detaches its ServerTlsPolicy.
+	MutualTLS *MutualTLSConfig `json:"mutualTLS,omitempty"`
 }
 
+// MutualTLSConfig is the ServerTlsPolicy of the target HTTPS proxy, either an
+// existing policy or one managed by the controller for a TrustConfig.
+// +k8s:openapi-gen=true
+type MutualTLSConfig struct {
+	// ServerTlsPolicy is the name of an existing global ServerTlsPolicy of
+	// the project, attached to the proxy as is.
+	ServerTlsPolicy string `json:"serverTlsPolicy,omitempty"`
+	// TrustConfig is the name of the global Certificate Manager TrustConfig
+	// of the project which validates the client certificates, or its full
+	// resource name. The controller manages a ServerTlsPolicy for it.
+	TrustConfig string `json:"trustConfig,omitempty"`
+	// ClientValidationMode is the handling of the clients without a valid
+	// certificate with TrustConfig, REJECT_INVALID (the default) or
+	// ALLOW_INVALID_OR_MISSING_CLIENT_CERT.
+	ClientValidationMode string `json:"clientValidationMode,omitempty"`
+}
+
+const (
+	// QuicOverrideNone uses the default QUIC policy of the load balancer.
+	QuicOverrideNone = "NONE"
+	// QuicOverrideEnable allows clients to negotiate QUIC.
+	QuicOverrideEnable = "ENABLE"
+	// QuicOverrideDisable prevents clients from negotiating QUIC.
+	QuicOverrideDisable = "DISABLE"
+)
+
+const (
+	// MinHttpKeepAliveTimeoutSec is the lowest client HTTP keepalive timeout.
+	MinHttpKeepAliveTimeoutSec = 5
+	// MaxHttpKeepAliveTimeoutSec is the highest client HTTP keepalive timeout.
+	MaxHttpKeepAliveTimeoutSec = 1200
+)
+
+const (
+	// NetworkTierPremium routes the traffic of clients over the Google
+	// network, to a global anycast IP.
+	NetworkTierPremium = "PREMIUM"
+	// NetworkTierStandard routes the traffic of clients over the internet,
+	// to a regional IP.
+	NetworkTierStandard = "STANDARD"
+)
+
+const (
+	// ClientValidationModeRejectInvalid rejects the clients without a valid
+	// certificate.
+	ClientValidationModeRejectInvalid = "REJECT_INVALID"
+	// ClientValidationModeAllowInvalid lets the requests of the clients
+	// without a valid certificate through, with the result of the
+	// validation in their headers.
+	ClientValidationModeAllowInvalid = "ALLOW_INVALID_OR_MISSING_CLIENT_CERT"
+)
+
 // FrontendConfigStatus is the status for a FrontendConfig resource
 type FrontendConfigStatus struct{}
 
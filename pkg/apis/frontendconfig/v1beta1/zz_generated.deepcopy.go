@@ -29,7 +29,7 @@ func (in *FrontendConfig) DeepCopyInto(out *FrontendConfig) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	out.Status = in.Status
 	return
 }
@@ -88,6 +88,21 @@ func (in *FrontendConfigList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FrontendConfigSpec) DeepCopyInto(out *FrontendConfigSpec) {
 	*out = *in
+	if in.AllowGlobalAccess != nil {
+		in, out := &in.AllowGlobalAccess, &out.AllowGlobalAccess
+		*out = new(bool)
+		**out = **in
+	}
+	if in.HttpsPorts != nil {
+		in, out := &in.HttpsPorts, &out.HttpsPorts
+		*out = make([]int64, len(*in))
+		copy(*out, *in)
+	}
+	if in.MutualTLS != nil {
+		in, out := &in.MutualTLS, &out.MutualTLS
+		*out = new(MutualTLSConfig)
+		**out = **in
+	}
 	return
 }
 
@@ -116,3 +131,19 @@ func (in *FrontendConfigStatus) DeepCopy() *FrontendConfigStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MutualTLSConfig) DeepCopyInto(out *MutualTLSConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MutualTLSConfig.
+func (in *MutualTLSConfig) DeepCopy() *MutualTLSConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(MutualTLSConfig)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -31,6 +31,7 @@ func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenA
 	return map[string]common.OpenAPIDefinition{
 		"k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1.FrontendConfig":     schema_pkg_apis_frontendconfig_v1beta1_FrontendConfig(ref),
 		"k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1.FrontendConfigSpec": schema_pkg_apis_frontendconfig_v1beta1_FrontendConfigSpec(ref),
+		"k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1.MutualTLSConfig":    schema_pkg_apis_frontendconfig_v1beta1_MutualTLSConfig(ref),
 	}
 }
 
@@ -84,6 +85,92 @@ func schema_pkg_apis_frontendconfig_v1beta1_FrontendConfigSpec(ref common.Refere
 			SchemaProps: spec.SchemaProps{
 				Description: "FrontendConfigSpec is the spec for a FrontendConfig resource",
 				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"quicOverride": {
+						SchemaProps: spec.SchemaProps{
+							Description: "QuicOverride controls whether the target HTTPS proxy negotiates QUIC (HTTP/3) with clients. One of NONE, ENABLE or DISABLE. The setting of the proxy is left unchanged if empty.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"httpKeepAliveTimeoutSec": {
+						SchemaProps: spec.SchemaProps{
+							Description: "HttpKeepAliveTimeoutSec is the time in seconds the target proxies keep idle HTTP connections from clients open, between 5 and 1200. The load balancer default is used if unset.",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"networkTier": {
+						SchemaProps: spec.SchemaProps{
+							Description: "NetworkTier is the network tier of the forwarding rules and static IP of an external load balancer, PREMIUM or STANDARD. Standard tier load balancers are regional, in the region of the cluster. The tier of the IngressClass, or else PREMIUM, is used if empty.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"allowGlobalAccess": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AllowGlobalAccess controls whether clients in all the regions of the network can reach an internal load balancer, rather than only the clients in its region. The setting of the forwarding rules is left unchanged if unset. External load balancers ignore it.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"httpsPorts": {
+						SchemaProps: spec.SchemaProps{
+							Description: "HttpsPorts are the ports served by the target HTTPS proxy, [443] if empty. The first port is served by the HTTPS forwarding rule, and each other port by an additional forwarding rule with the same IP.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"integer"},
+										Format: "int64",
+									},
+								},
+							},
+						},
+					},
+					"mutualTLS": {
+						SchemaProps: spec.SchemaProps{
+							Description: "MutualTLS configures the validation of the client certificates by the target HTTPS proxy. The proxy is left unchanged if unset, and an empty MutualTLS detaches its ServerTlsPolicy.",
+							Ref:         ref("k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1.MutualTLSConfig"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1.MutualTLSConfig"},
+	}
+}
+
+func schema_pkg_apis_frontendconfig_v1beta1_MutualTLSConfig(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "MutualTLSConfig is the ServerTlsPolicy of the target HTTPS proxy, either an existing policy or one managed by the controller for a TrustConfig.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"serverTlsPolicy": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ServerTlsPolicy is the name of an existing global ServerTlsPolicy of the project, attached to the proxy as is.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"trustConfig": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TrustConfig is the name of the global Certificate Manager TrustConfig of the project which validates the client certificates, or its full resource name. The controller manages a ServerTlsPolicy for it.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"clientValidationMode": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ClientValidationMode is the handling of the clients without a valid certificate with TrustConfig, REJECT_INVALID (the default) or ALLOW_INVALID_OR_MISSING_CLIENT_CERT.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
 			},
 		},
 	}
@@ -0,0 +1,71 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// GCPIngressParams holds the cluster-wide settings of the Ingresses of an
+// IngressClass of the controller, which references it in its parameters.
+type GCPIngressParams struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec GCPIngressParamsSpec `json:"spec,omitempty"`
+}
+
+// GCPIngressParamsSpec is the spec for a GCPIngressParams resource
+type GCPIngressParamsSpec struct {
+	// LoadBalancerType is the type of the load balancers of the Ingresses,
+	// External (the default) or Internal.
+	LoadBalancerType string `json:"loadBalancerType,omitempty"`
+	// NetworkTier is the network tier of external load balancers, PREMIUM
+	// (the default) or STANDARD.
+	NetworkTier string `json:"networkTier,omitempty"`
+	// DefaultBackend is the backend of the Ingresses without a default
+	// backend, instead of the default backend of the cluster.
+	DefaultBackend *DefaultBackend `json:"defaultBackend,omitempty"`
+}
+
+const (
+	LoadBalancerTypeExternal = "External"
+	LoadBalancerTypeInternal = "Internal"
+
+	NetworkTierPremium  = "PREMIUM"
+	NetworkTierStandard = "STANDARD"
+)
+
+// DefaultBackend is a port of a Service in any namespace.
+type DefaultBackend struct {
+	Namespace   string             `json:"namespace"`
+	ServiceName string             `json:"serviceName"`
+	ServicePort intstr.IntOrString `json:"servicePort"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// GCPIngressParamsList is a list of GCPIngressParams resources
+type GCPIngressParamsList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []GCPIngressParams `json:"items"`
+}
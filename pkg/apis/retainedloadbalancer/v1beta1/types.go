@@ -0,0 +1,70 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RetainedLoadBalancer records the cloud resources of the load balancer of an
+// Ingress which were retained when the Ingress was deleted, because of its
+// networking.gke.io/retain-resources annotation. It has the namespace and
+// the name of the Ingress. The resources are kept until an Ingress with the
+// same namespace, name and naming scheme adopts them, or until the
+// RetainedLoadBalancer is deleted.
+//
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type RetainedLoadBalancer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RetainedLoadBalancerSpec   `json:"spec"`
+	Status RetainedLoadBalancerStatus `json:"status"`
+}
+
+// RetainedLoadBalancerSpec is the spec for a RetainedLoadBalancer resource
+type RetainedLoadBalancerSpec struct {
+	// LoadBalancer is the name of the load balancer of the Ingress, which
+	// the names of its resources derive from.
+	LoadBalancer string `json:"loadBalancer"`
+	// NamingScheme is the naming scheme of the Ingress, which an Ingress
+	// adopting the resources must be annotated with.
+	NamingScheme string `json:"namingScheme"`
+	// Regional is true if the resources are regional, i.e. of an internal
+	// load balancer.
+	Regional bool `json:"regional,omitempty"`
+	// Resources are the names of the frontend resources of the load
+	// balancer, keyed by their status annotation on the Ingress, e.g.
+	// url-map or forwarding-rule.
+	Resources map[string]string `json:"resources,omitempty"`
+	// BackendServices are the names of the backend services of the load
+	// balancer.
+	BackendServices []string `json:"backendServices,omitempty"`
+}
+
+// RetainedLoadBalancerStatus is the status for a RetainedLoadBalancer resource
+type RetainedLoadBalancerStatus struct{}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// RetainedLoadBalancerList is a list of RetainedLoadBalancer resources
+type RetainedLoadBalancerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []RetainedLoadBalancer `json:"items"`
+}
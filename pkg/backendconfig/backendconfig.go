@@ -27,8 +27,15 @@ import (
 	apisbackendconfig "k8s.io/ingress-gce/pkg/apis/backendconfig"
 	backendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/backendconfig/v1beta1"
 	"k8s.io/ingress-gce/pkg/crd"
+	"k8s.io/ingress-gce/pkg/utils"
 )
 
+// DefaultBackendConfigName is the name of the BackendConfig applied to the
+// service ports of its namespace, when default configs are enabled. The
+// BackendConfig with this name in the cluster default config namespace
+// applies to all namespaces.
+const DefaultBackendConfigName = "default"
+
 var (
 	ErrBackendConfigDoesNotExist = errors.New("no BackendConfig for service port exists.")
 	ErrBackendConfigFailedToGet  = errors.New("client had error getting BackendConfig for service port.")
@@ -82,3 +89,33 @@ func GetBackendConfigForServicePort(backendConfigLister cache.Store, svc *apiv1.
 
 	return obj.(*backendconfigv1beta1.BackendConfig), nil
 }
+
+// WithDefaults returns a copy of beConfig whose unset spec fields are set
+// from the default BackendConfig of the namespace, and then from the default
+// BackendConfig of the cluster. beConfig may be nil, in which case the merged
+// defaults are returned, or nil if there are none.
+func WithDefaults(backendConfigLister cache.Store, beConfig *backendconfigv1beta1.BackendConfig, namespace, clusterNamespace string) (*backendconfigv1beta1.BackendConfig, error) {
+	namespaces := []string{namespace}
+	if clusterNamespace != "" && clusterNamespace != namespace {
+		namespaces = append(namespaces, clusterNamespace)
+	}
+	merged := beConfig.DeepCopy()
+	for _, ns := range namespaces {
+		obj, exists, err := backendConfigLister.GetByKey(ns + "/" + DefaultBackendConfigName)
+		if err != nil {
+			return nil, ErrBackendConfigFailedToGet
+		}
+		if !exists {
+			continue
+		}
+		defaultConfig := obj.(*backendconfigv1beta1.BackendConfig).DeepCopy()
+		if merged == nil {
+			merged = defaultConfig
+			continue
+		}
+		if err := utils.MergeUnsetFields(&merged.Spec, &defaultConfig.Spec); err != nil {
+			return nil, err
+		}
+	}
+	return merged, nil
+}
@@ -22,6 +22,7 @@ import (
 	"testing"
 
 	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/cache"
 
 	backendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/backendconfig/v1beta1"
@@ -104,3 +105,68 @@ func TestGetBackendConfigForServicePort(t *testing.T) {
 		}
 	}
 }
+
+func TestWithDefaults(t *testing.T) {
+	timeout, clusterTimeout := int64(10), int64(60)
+	newConfig := func(namespace, name string, spec backendconfigv1beta1.BackendConfigSpec) *backendconfigv1beta1.BackendConfig {
+		return &backendconfigv1beta1.BackendConfig{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}, Spec: spec}
+	}
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	store.Add(newConfig("ns1", DefaultBackendConfigName, backendconfigv1beta1.BackendConfigSpec{
+		TimeoutSec: &timeout,
+	}))
+	store.Add(newConfig("kube-system", DefaultBackendConfigName, backendconfigv1beta1.BackendConfigSpec{
+		TimeoutSec:     &clusterTimeout,
+		SecurityPolicy: &backendconfigv1beta1.SecurityPolicyConfig{Name: "cluster-policy"},
+	}))
+
+	testCases := []struct {
+		desc      string
+		beConfig  *backendconfigv1beta1.BackendConfig
+		namespace string
+		want      *backendconfigv1beta1.BackendConfig
+	}{
+		{
+			desc:      "namespace and cluster defaults",
+			namespace: "ns1",
+			want: newConfig("ns1", DefaultBackendConfigName, backendconfigv1beta1.BackendConfigSpec{
+				TimeoutSec:     &timeout,
+				SecurityPolicy: &backendconfigv1beta1.SecurityPolicyConfig{Name: "cluster-policy"},
+			}),
+		},
+		{
+			desc:      "cluster defaults only",
+			namespace: "ns2",
+			want: newConfig("kube-system", DefaultBackendConfigName, backendconfigv1beta1.BackendConfigSpec{
+				TimeoutSec:     &clusterTimeout,
+				SecurityPolicy: &backendconfigv1beta1.SecurityPolicyConfig{Name: "cluster-policy"},
+			}),
+		},
+		{
+			desc:      "referenced config takes precedence",
+			namespace: "ns1",
+			beConfig: newConfig("ns1", "config", backendconfigv1beta1.BackendConfigSpec{
+				SecurityPolicy: &backendconfigv1beta1.SecurityPolicyConfig{Name: "policy"},
+			}),
+			want: newConfig("ns1", "config", backendconfigv1beta1.BackendConfigSpec{
+				TimeoutSec:     &timeout,
+				SecurityPolicy: &backendconfigv1beta1.SecurityPolicyConfig{Name: "policy"},
+			}),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := WithDefaults(store, tc.beConfig, tc.namespace, "kube-system")
+			if err != nil {
+				t.Fatalf("WithDefaults() = %v, want nil", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("WithDefaults() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+
+	if got, err := WithDefaults(cache.NewStore(cache.MetaNamespaceKeyFunc), nil, "ns1", "kube-system"); got != nil || err != nil {
+		t.Errorf("WithDefaults() without defaults = %v, %v, want nil, nil", got, err)
+	}
+}
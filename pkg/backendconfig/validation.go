@@ -18,6 +18,7 @@ package backendconfig
 
 import (
 	"fmt"
+	"strings"
 
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -35,6 +36,12 @@ var supportedAffinities = map[string]bool{
 	"GENERATED_COOKIE": true,
 }
 
+var supportedHealthCheckTypes = map[string]bool{
+	"HTTP":  true,
+	"HTTPS": true,
+	"HTTP2": true,
+}
+
 func Validate(kubeClient kubernetes.Interface, beConfig *backendconfigv1beta1.BackendConfig) error {
 	if beConfig == nil {
 		return nil
@@ -48,6 +55,14 @@ func Validate(kubeClient kubernetes.Interface, beConfig *backendconfigv1beta1.Ba
 		return err
 	}
 
+	if err := validateHealthCheck(beConfig); err != nil {
+		return err
+	}
+
+	if err := validateAlerting(beConfig); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -104,3 +119,65 @@ func validateSessionAffinity(kubeClient kubernetes.Interface, beConfig *backendc
 
 	return nil
 }
+
+func validateHealthCheck(beConfig *backendconfigv1beta1.BackendConfig) error {
+	hc := beConfig.Spec.HealthCheck
+	if hc == nil {
+		return nil
+	}
+
+	for name, v := range map[string]*int64{
+		"CheckIntervalSec":   hc.CheckIntervalSec,
+		"TimeoutSec":         hc.TimeoutSec,
+		"HealthyThreshold":   hc.HealthyThreshold,
+		"UnhealthyThreshold": hc.UnhealthyThreshold,
+	} {
+		if v != nil && *v <= 0 {
+			return fmt.Errorf("unsupported %s: %d, should be greater than 0", name, *v)
+		}
+	}
+
+	if hc.CheckIntervalSec != nil && hc.TimeoutSec != nil && *hc.TimeoutSec > *hc.CheckIntervalSec {
+		return fmt.Errorf("unsupported TimeoutSec: %d, should not be greater than CheckIntervalSec (%d)",
+			*hc.TimeoutSec, *hc.CheckIntervalSec)
+	}
+
+	if hc.Type != nil {
+		if _, ok := supportedHealthCheckTypes[*hc.Type]; !ok {
+			return fmt.Errorf("unsupported health check Type: %s, should be one of HTTP, HTTPS, or HTTP2", *hc.Type)
+		}
+	}
+
+	if hc.RequestPath != nil && !strings.HasPrefix(*hc.RequestPath, "/") {
+		return fmt.Errorf("unsupported RequestPath: %q, should start with \"/\"", *hc.RequestPath)
+	}
+
+	if hc.Port != nil && (*hc.Port < 1 || *hc.Port > 65535) {
+		return fmt.Errorf("unsupported Port: %d, should be between 1 and 65535", *hc.Port)
+	}
+
+	return nil
+}
+
+func validateAlerting(beConfig *backendconfigv1beta1.BackendConfig) error {
+	alerting := beConfig.Spec.Alerting
+	if alerting == nil {
+		return nil
+	}
+
+	if alerting.ErrorRatePercent != nil && (*alerting.ErrorRatePercent < 1 || *alerting.ErrorRatePercent > 100) {
+		return fmt.Errorf("unsupported ErrorRatePercent: %d, should be between 1 and 100", *alerting.ErrorRatePercent)
+	}
+
+	if alerting.LatencyThresholdMs != nil && *alerting.LatencyThresholdMs <= 0 {
+		return fmt.Errorf("unsupported LatencyThresholdMs: %d, should be greater than 0", *alerting.LatencyThresholdMs)
+	}
+
+	for _, channel := range alerting.NotificationChannels {
+		if !strings.HasPrefix(channel, "projects/") || !strings.Contains(channel, "/notificationChannels/") {
+			return fmt.Errorf("unsupported NotificationChannel: %q, should be of the form projects/[PROJECT_ID]/notificationChannels/[CHANNEL_ID]", channel)
+		}
+	}
+
+	return nil
+}
@@ -239,3 +239,127 @@ func TestValidateSessionAffinity(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateHealthCheck(t *testing.T) {
+	i64 := func(v int64) *int64 { return &v }
+	str := func(v string) *string { return &v }
+
+	testCases := []struct {
+		desc        string
+		hc          *backendconfigv1beta1.HealthCheckConfig
+		expectError bool
+	}{
+		{
+			desc: "valid health check",
+			hc: &backendconfigv1beta1.HealthCheckConfig{
+				CheckIntervalSec:   i64(10),
+				TimeoutSec:         i64(5),
+				HealthyThreshold:   i64(1),
+				UnhealthyThreshold: i64(3),
+				Type:               str("HTTPS"),
+				RequestPath:        str("/healthz"),
+				Port:               i64(8443),
+			},
+			expectError: false,
+		},
+		{
+			desc:        "non-positive interval",
+			hc:          &backendconfigv1beta1.HealthCheckConfig{CheckIntervalSec: i64(0)},
+			expectError: true,
+		},
+		{
+			desc:        "timeout greater than interval",
+			hc:          &backendconfigv1beta1.HealthCheckConfig{CheckIntervalSec: i64(5), TimeoutSec: i64(10)},
+			expectError: true,
+		},
+		{
+			desc:        "unsupported type",
+			hc:          &backendconfigv1beta1.HealthCheckConfig{Type: str("TCP")},
+			expectError: true,
+		},
+		{
+			desc:        "request path without leading slash",
+			hc:          &backendconfigv1beta1.HealthCheckConfig{RequestPath: str("healthz")},
+			expectError: true,
+		},
+		{
+			desc:        "port out of range",
+			hc:          &backendconfigv1beta1.HealthCheckConfig{Port: i64(70000)},
+			expectError: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		beConfig := &backendconfigv1beta1.BackendConfig{
+			ObjectMeta: meta_v1.ObjectMeta{
+				Namespace: "default",
+			},
+			Spec: backendconfigv1beta1.BackendConfigSpec{
+				HealthCheck: testCase.hc,
+			},
+		}
+		kubeClient := fake.NewSimpleClientset()
+		err := Validate(kubeClient, beConfig)
+		if testCase.expectError && err == nil {
+			t.Errorf("%v: Expected error but got nil", testCase.desc)
+		}
+		if !testCase.expectError && err != nil {
+			t.Errorf("%v: Did not expect error but got: %v", testCase.desc, err)
+		}
+	}
+}
+
+func TestValidateAlerting(t *testing.T) {
+	i64 := func(v int64) *int64 { return &v }
+
+	testCases := []struct {
+		desc        string
+		alerting    *backendconfigv1beta1.AlertingConfig
+		expectError bool
+	}{
+		{
+			desc: "valid alerting",
+			alerting: &backendconfigv1beta1.AlertingConfig{
+				Enabled:              true,
+				ErrorRatePercent:     i64(5),
+				LatencyThresholdMs:   i64(500),
+				NotificationChannels: []string{"projects/test-project/notificationChannels/123"},
+			},
+			expectError: false,
+		},
+		{
+			desc:        "error rate out of range",
+			alerting:    &backendconfigv1beta1.AlertingConfig{Enabled: true, ErrorRatePercent: i64(0)},
+			expectError: true,
+		},
+		{
+			desc:        "non-positive latency threshold",
+			alerting:    &backendconfigv1beta1.AlertingConfig{Enabled: true, LatencyThresholdMs: i64(-1)},
+			expectError: true,
+		},
+		{
+			desc:        "invalid notification channel",
+			alerting:    &backendconfigv1beta1.AlertingConfig{Enabled: true, NotificationChannels: []string{"123"}},
+			expectError: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		beConfig := &backendconfigv1beta1.BackendConfig{
+			ObjectMeta: meta_v1.ObjectMeta{
+				Namespace: "default",
+			},
+			Spec: backendconfigv1beta1.BackendConfigSpec{
+				Alerting: testCase.alerting,
+			},
+		}
+		kubeClient := fake.NewSimpleClientset()
+		err := Validate(kubeClient, beConfig)
+		if testCase.expectError && err == nil {
+			t.Errorf("%v: Expected error but got nil", testCase.desc)
+		}
+		if !testCase.expectError && err != nil {
+			t.Errorf("%v: Did not expect error but got: %v", testCase.desc, err)
+		}
+	}
+}
@@ -30,7 +30,7 @@ import (
 // Backends handles CRUD operations for backends.
 type Backends struct {
 	cloud *gce.Cloud
-	namer *namer.Namer
+	namer namer.IngressNamer
 }
 
 // Backends is a Pool.
@@ -39,7 +39,7 @@ var _ Pool = (*Backends)(nil)
 // NewPool returns a new backend pool.
 // - cloud: implements BackendServices
 // - namer: produces names for backends.
-func NewPool(cloud *gce.Cloud, namer *namer.Namer) *Backends {
+func NewPool(cloud *gce.Cloud, namer namer.IngressNamer) *Backends {
 	return &Backends{
 		cloud: cloud,
 		namer: namer,
@@ -70,7 +70,7 @@ func (b *Backends) Create(sp utils.ServicePort, hcLink string) (*composite.Backe
 	be := &composite.BackendService{
 		Version:      version,
 		Name:         name,
-		Protocol:     string(sp.Protocol),
+		Protocol:     string(sp.BackendProtocol()),
 		Port:         namedPort.Port,
 		PortName:     namedPort.Name,
 		HealthChecks: []string{hcLink},
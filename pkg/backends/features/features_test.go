@@ -47,6 +47,12 @@ var (
 		Protocol: annotations.ProtocolHTTP2,
 	}
 
+	svcPortWithGRPC = utils.ServicePort{
+		ID:         fakeSvcPortID,
+		Protocol:   annotations.ProtocolGRPC,
+		NEGEnabled: true,
+	}
+
 	svcPortWithSecurityPolicy = utils.ServicePort{
 		ID: fakeSvcPortID,
 		BackendConfig: &backendconfigv1beta1.BackendConfig{
@@ -92,6 +98,11 @@ func TestFeaturesFromServicePort(t *testing.T) {
 			svcPort:          svcPortWithHTTP2,
 			expectedFeatures: []string{"HTTP2"},
 		},
+		{
+			desc:             "GRPC",
+			svcPort:          svcPortWithGRPC,
+			expectedFeatures: []string{"HTTP2", "NEG"},
+		},
 		{
 			desc:             "SecurityPolicy",
 			svcPort:          svcPortWithSecurityPolicy,
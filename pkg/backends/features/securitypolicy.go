@@ -32,19 +32,27 @@ import (
 )
 
 // EnsureSecurityPolicy ensures the security policy link on backend service.
+// The security policy of the paths of the ServicePort overrides the one of
+// its BackendConfig.
 // TODO(mrhohn): Emit event when attach/detach security policy to backend service.
 func EnsureSecurityPolicy(cloud *gce.Cloud, sp utils.ServicePort, be *composite.BackendService, beName string) error {
-	if sp.BackendConfig.Spec.SecurityPolicy == nil {
-		return nil
+	desiredName := sp.SecurityPolicy
+	if desiredName == "" {
+		if sp.BackendConfig == nil || sp.BackendConfig.Spec.SecurityPolicy == nil {
+			return nil
+		}
+		desiredName = sp.BackendConfig.Spec.SecurityPolicy.Name
 	}
 
-	needsUpdate, policyRef := securityPolicyNeedsUpdate(cloud, be.SecurityPolicy, sp.BackendConfig.Spec.SecurityPolicy.Name)
+	needsUpdate, policyRef := securityPolicyNeedsUpdate(cloud, be.SecurityPolicy, desiredName)
 	if !needsUpdate {
 		return nil
 	}
 
 	klog.V(2).Infof("Setting security policy %q for backend service %s (%s:%s)", policyRef, beName, sp.ID.Service.String(), sp.ID.Port.String())
-	if err := cloud.SetSecurityPolicyForBetaGlobalBackendService(beName, policyRef); err != nil {
+	err := cloud.SetSecurityPolicyForBetaGlobalBackendService(beName, policyRef)
+	composite.InvalidateCache("BackendService", meta.GlobalKey(beName))
+	if err != nil {
 		return fmt.Errorf("failed to set security policy %q for backend service %s (%s:%s): %v", policyRef, beName, sp.ID.Service.String(), sp.ID.Port.String(), err)
 	}
 	return nil
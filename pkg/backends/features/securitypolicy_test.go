@@ -47,6 +47,7 @@ func TestEnsureSecurityPolicy(t *testing.T) {
 		desc                  string
 		currentBackendService *composite.BackendService
 		desiredConfig         *backendconfigv1beta1.BackendConfig
+		pathPolicy            string
 		expectSetCall         bool
 	}{
 		{
@@ -115,6 +116,34 @@ func TestEnsureSecurityPolicy(t *testing.T) {
 			desiredConfig: &backendconfigv1beta1.BackendConfig{},
 			expectSetCall: false,
 		},
+		{
+			desc:                  "path-policy-without-config",
+			currentBackendService: &composite.BackendService{},
+			pathPolicy:            "policy-1",
+			expectSetCall:         true,
+		},
+		{
+			desc: "path-policy-overrides-config",
+			currentBackendService: &composite.BackendService{
+				SecurityPolicy: "https://www.googleapis.com/compute/beta/projects/test-project/global/securityPolicies/policy-2",
+			},
+			desiredConfig: &backendconfigv1beta1.BackendConfig{
+				Spec: backendconfigv1beta1.BackendConfigSpec{
+					SecurityPolicy: &backendconfigv1beta1.SecurityPolicyConfig{
+						Name: "policy-2",
+					},
+				},
+			},
+			pathPolicy:    "policy-1",
+			expectSetCall: true,
+		},
+		{
+			desc: "same-path-policy",
+			currentBackendService: &composite.BackendService{
+				SecurityPolicy: "https://www.googleapis.com/compute/beta/projects/test-project/global/securityPolicies/policy-1",
+			},
+			pathPolicy: "policy-1",
+		},
 	}
 
 	for i, tc := range testCases {
@@ -128,7 +157,7 @@ func TestEnsureSecurityPolicy(t *testing.T) {
 
 			(fakeGCE.Compute().(*cloud.MockGCE)).MockBetaBackendServices.SetSecurityPolicyHook = setSecurityPolicyHook
 
-			if err := EnsureSecurityPolicy(fakeGCE, utils.ServicePort{BackendConfig: tc.desiredConfig}, tc.currentBackendService, fakeBeName); err != nil {
+			if err := EnsureSecurityPolicy(fakeGCE, utils.ServicePort{BackendConfig: tc.desiredConfig, SecurityPolicy: tc.pathPolicy}, tc.currentBackendService, fakeBeName); err != nil {
 				t.Errorf("EnsureSecurityPolicy()=%v, want nil", err)
 			}
 
@@ -146,7 +175,9 @@ func TestEnsureSecurityPolicy(t *testing.T) {
 					policyLink = policyRef.SecurityPolicy
 				}
 				desiredPolicyName := ""
-				if tc.desiredConfig != nil && tc.desiredConfig.Spec.SecurityPolicy != nil {
+				if tc.pathPolicy != "" {
+					desiredPolicyName = tc.pathPolicy
+				} else if tc.desiredConfig != nil && tc.desiredConfig.Spec.SecurityPolicy != nil {
 					desiredPolicyName = tc.desiredConfig.Spec.SecurityPolicy.Name
 				}
 				if utils.EqualResourceIDs(policyLink, desiredPolicyName) {
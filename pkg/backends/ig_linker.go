@@ -66,7 +66,7 @@ const maxRPS = 1
 type instanceGroupLinker struct {
 	instancePool instances.NodePool
 	backendPool  Pool
-	namer        *namer.Namer
+	namer        namer.IngressNamer
 }
 
 // instanceGroupLinker is a Linker
@@ -75,7 +75,7 @@ var _ Linker = (*instanceGroupLinker)(nil)
 func NewInstanceGroupLinker(
 	instancePool instances.NodePool,
 	backendPool Pool,
-	namer *namer.Namer) Linker {
+	namer namer.IngressNamer) Linker {
 	return &instanceGroupLinker{
 		instancePool: instancePool,
 		backendPool:  backendPool,
@@ -87,11 +87,13 @@ func NewInstanceGroupLinker(
 func (l *instanceGroupLinker) Link(sp utils.ServicePort, groups []GroupKey) error {
 	var igLinks []string
 	for _, group := range groups {
-		ig, err := l.instancePool.Get(l.namer.InstanceGroup(), group.Zone)
+		igs, err := l.instancePool.GetShards(l.namer.InstanceGroup(), group.Zone)
 		if err != nil {
 			return fmt.Errorf("error retrieving IG for linking with backend %+v: %v", sp, err)
 		}
-		igLinks = append(igLinks, ig.SelfLink)
+		for _, ig := range igs {
+			igLinks = append(igLinks, ig.SelfLink)
+		}
 	}
 
 	// ig_linker only supports L7 HTTP(s) External Load Balancer
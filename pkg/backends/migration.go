@@ -0,0 +1,265 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backends
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/annotations"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/ingress-gce/pkg/utils/namer"
+	"k8s.io/klog"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+// healthyState is the health state of healthy endpoints.
+const healthyState = "HEALTHY"
+
+// NEGMigrator moves the backends of service ports from instance groups to
+// NEGs without dropping traffic when NEGs get enabled on their service.
+// Backend services cannot mix instance groups and NEGs, so while a port
+// migrates, the load balancer keeps sending its traffic to the backend
+// service of the instance groups, and the backend service of the NEGs is
+// synced and linked alongside it. The load balancer switches to the NEGs once
+// they have healthy endpoints, or once the timeout expired, after which the
+// backend service of the instance groups is garbage collected.
+//
+// The start of the migration of the ports is recorded in the NEGMigrationKey
+// annotation of their Service, so that the timeout survives restarts.
+type NEGMigrator struct {
+	backendPool   Pool
+	cloud         *gce.Cloud
+	kubeClient    kubernetes.Interface
+	serviceLister cache.Indexer
+	namer         namer.IngressNamer
+	timeout       time.Duration
+
+	// lock serializes the updates of the annotations.
+	lock sync.Mutex
+	// now is overridden in tests.
+	now func() time.Time
+}
+
+// NewNEGMigrator returns a NEGMigrator which switches the load balancer to
+// NEGs after at most timeout.
+func NewNEGMigrator(backendPool Pool, cloud *gce.Cloud, kubeClient kubernetes.Interface, serviceLister cache.Indexer, namer namer.IngressNamer, timeout time.Duration) *NEGMigrator {
+	return &NEGMigrator{
+		backendPool:   backendPool,
+		cloud:         cloud,
+		kubeClient:    kubeClient,
+		serviceLister: serviceLister,
+		namer:         namer,
+		timeout:       timeout,
+		now:           time.Now,
+	}
+}
+
+// Migrate returns the instance group variant of the ports of svcPorts which
+// are still migrating to NEGs. The load balancer must keep using these
+// instead of the NEG ports, which are synced as well.
+func (m *NEGMigrator) Migrate(svcPorts []utils.ServicePort) ([]utils.ServicePort, error) {
+	var igPorts []utils.ServicePort
+	seen := map[utils.ServicePortID]bool{}
+	for _, sp := range svcPorts {
+		if seen[sp.ID] {
+			continue
+		}
+		seen[sp.ID] = true
+		migrating, err := m.ensureMigration(sp)
+		if err != nil {
+			return nil, err
+		}
+		if migrating {
+			igPorts = append(igPorts, instanceGroupPort(sp))
+		}
+	}
+	return igPorts, nil
+}
+
+// GCPorts returns svcPorts along with the instance group variant of the
+// ports still migrating to NEGs, whose backend services must be kept.
+func (m *NEGMigrator) GCPorts(svcPorts []utils.ServicePort) []utils.ServicePort {
+	ports := append([]utils.ServicePort{}, svcPorts...)
+	for _, sp := range svcPorts {
+		if !sp.NEGEnabled {
+			continue
+		}
+		if _, ok := m.start(sp); ok {
+			ports = append(ports, instanceGroupPort(sp))
+		}
+	}
+	return ports
+}
+
+// ensureMigration returns true if the port is migrating from instance groups
+// to NEGs: NEGs are enabled on it, the backend service of its instance
+// groups still exists, and its NEGs have no healthy endpoint yet.
+func (m *NEGMigrator) ensureMigration(sp utils.ServicePort) (bool, error) {
+	// Instance groups only back global load balancers.
+	if !sp.NEGEnabled || sp.L7ILBEnabled || sp.NodePort == 0 {
+		return false, m.done(sp)
+	}
+	_, err := m.backendPool.Get(instanceGroupPort(sp).BackendName(m.namer), meta.VersionGA, meta.Global)
+	if utils.IsNotFoundError(err) {
+		return false, m.done(sp)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	start, ok := m.start(sp)
+	if !ok {
+		klog.V(2).Infof("Migrating backend of %v from instance groups to NEGs", sp.ID)
+		start = m.now()
+		if err := m.update(sp, &start); err != nil {
+			return false, err
+		}
+	}
+
+	if m.healthy(sp) {
+		klog.V(2).Infof("NEGs of %v are healthy, switching from instance groups", sp.ID)
+		return false, m.done(sp)
+	}
+	if m.now().Sub(start) > m.timeout {
+		klog.Warningf("NEGs of %v did not become healthy within %v, switching from instance groups", sp.ID, m.timeout)
+		return false, m.done(sp)
+	}
+	return true, nil
+}
+
+// healthy returns true if one of the NEGs linked to the backend service of
+// the port has a healthy endpoint. The health of the endpoints is read from
+// the NEGs, as backend services which no load balancer uses do not report
+// the health of their backends.
+func (m *NEGMigrator) healthy(sp utils.ServicePort) bool {
+	beName := sp.BackendName(m.namer)
+	be, err := m.backendPool.Get(beName, meta.VersionGA, meta.Global)
+	if err != nil {
+		// The backend service of the NEGs is created by the current sync.
+		return false
+	}
+	for _, backend := range be.Backends {
+		id, err := cloud.ParseResourceURL(backend.Group)
+		if err != nil || id.Key == nil || id.Key.Zone == "" {
+			continue
+		}
+		endpoints, err := m.cloud.ListNetworkEndpoints(id.Key.Name, id.Key.Zone, true)
+		if err != nil {
+			klog.V(3).Infof("Failed to get the health of the endpoints of NEG %v in zone %v: %v", id.Key.Name, id.Key.Zone, err)
+			continue
+		}
+		for _, ep := range endpoints {
+			for _, health := range ep.Healths {
+				if health != nil && health.HealthState == healthyState {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// start returns the start of the migration of the port recorded on its
+// Service, and false if it is not migrating.
+func (m *NEGMigrator) start(sp utils.ServicePort) (time.Time, bool) {
+	svc, err := m.service(sp)
+	if err != nil || svc == nil {
+		return time.Time{}, false
+	}
+	status, _, err := annotations.FromService(svc).NEGMigrationStatus()
+	if err != nil {
+		klog.Warningf("Ignoring the NEG migration status of service %v: %v", sp.ID.Service, err)
+		return time.Time{}, false
+	}
+	start, ok := status[strconv.Itoa(int(sp.Port))]
+	return start, ok
+}
+
+// done records that the port is not migrating anymore.
+func (m *NEGMigrator) done(sp utils.ServicePort) error {
+	return m.update(sp, nil)
+}
+
+// update records the start of the migration of the port on its Service, or
+// removes the port from the migrating ports if start is nil. The annotation
+// is removed once no port migrates.
+func (m *NEGMigrator) update(sp utils.ServicePort, start *time.Time) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	svc, err := m.service(sp)
+	if err != nil || svc == nil {
+		return err
+	}
+	status, _, err := annotations.FromService(svc).NEGMigrationStatus()
+	if err != nil {
+		klog.Warningf("Overwriting the invalid NEG migration status of service %v: %v", sp.ID.Service, err)
+	}
+	if status == nil {
+		status = annotations.NEGMigrationStatus{}
+	}
+	port := strconv.Itoa(int(sp.Port))
+	if _, ok := status[port]; !ok && start == nil {
+		return nil
+	}
+	if start == nil {
+		delete(status, port)
+	} else {
+		status[port] = *start
+	}
+
+	svc = svc.DeepCopy()
+	if len(status) == 0 {
+		delete(svc.Annotations, annotations.NEGMigrationKey)
+	} else {
+		b, err := json.Marshal(status)
+		if err != nil {
+			return err
+		}
+		if svc.Annotations == nil {
+			svc.Annotations = map[string]string{}
+		}
+		svc.Annotations[annotations.NEGMigrationKey] = string(b)
+	}
+	klog.V(2).Infof("Updating the NEG migration status of service %s/%s.", svc.Namespace, svc.Name)
+	_, err = m.kubeClient.CoreV1().Services(svc.Namespace).Update(svc)
+	return err
+}
+
+// service returns the Service of the port, nil if it does not exist.
+func (m *NEGMigrator) service(sp utils.ServicePort) (*v1.Service, error) {
+	obj, exists, err := m.serviceLister.GetByKey(sp.ID.Service.String())
+	if err != nil || !exists {
+		return nil, err
+	}
+	return obj.(*v1.Service), nil
+}
+
+// instanceGroupPort returns the port backed by instance groups instead of
+// NEGs.
+func instanceGroupPort(sp utils.ServicePort) utils.ServicePort {
+	sp.NEGEnabled = false
+	return sp
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backends
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	computebeta "google.golang.org/api/compute/v0.beta"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/annotations"
+	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+func TestNEGMigratorMigrate(t *testing.T) {
+	negPort := utils.ServicePort{
+		ID: utils.ServicePortID{
+			Service: types.NamespacedName{Namespace: "ns", Name: "name"},
+		},
+		Port:       80,
+		NodePort:   30001,
+		Protocol:   annotations.ProtocolHTTP,
+		NEGEnabled: true,
+	}
+	igPort := negPort
+	igPort.NEGEnabled = false
+
+	testCases := []struct {
+		desc          string
+		sp            utils.ServicePort
+		igBackend     bool
+		negBackend    bool
+		healthState   string
+		elapsed       time.Duration
+		wantMigrating bool
+	}{
+		{
+			desc:      "NEGs disabled",
+			sp:        igPort,
+			igBackend: true,
+		},
+		{
+			desc:       "no instance group backend service",
+			sp:         negPort,
+			negBackend: true,
+		},
+		{
+			desc:          "NEG backend service not synced yet",
+			sp:            negPort,
+			igBackend:     true,
+			wantMigrating: true,
+		},
+		{
+			desc:          "NEGs unhealthy",
+			sp:            negPort,
+			igBackend:     true,
+			negBackend:    true,
+			healthState:   "UNHEALTHY",
+			wantMigrating: true,
+		},
+		{
+			desc:        "NEGs healthy",
+			sp:          negPort,
+			igBackend:   true,
+			negBackend:  true,
+			healthState: healthyState,
+		},
+		{
+			desc:        "NEGs unhealthy after timeout",
+			sp:          negPort,
+			igBackend:   true,
+			negBackend:  true,
+			healthState: "UNHEALTHY",
+			elapsed:     time.Hour,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+			(fakeGCE.Compute().(*cloud.MockGCE)).MockBetaNetworkEndpointGroups.ListNetworkEndpointsHook = func(_ context.Context, key *meta.Key, _ *computebeta.NetworkEndpointGroupsListEndpointsRequest, _ *filter.F, _ *cloud.MockBetaNetworkEndpointGroups) ([]*computebeta.NetworkEndpointWithHealthStatus, error) {
+				if key.Name != "neg" || key.Zone != "zone1" {
+					t.Errorf("ListNetworkEndpoints(%v), want NEG neg in zone1", key)
+				}
+				return []*computebeta.NetworkEndpointWithHealthStatus{{
+					Healths: []*computebeta.HealthStatusForNetworkEndpoint{{HealthState: tc.healthState}},
+				}}, nil
+			}
+			svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "name"}}
+			kubeClient := fake.NewSimpleClientset(svc)
+			serviceLister := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			serviceLister.Add(svc)
+			// syncLister keeps the lister in sync with the updates.
+			syncLister := func() *v1.Service {
+				t.Helper()
+				svc, err := kubeClient.CoreV1().Services("ns").Get("name", metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				serviceLister.Update(svc)
+				return svc
+			}
+			pool := NewPool(fakeGCE, defaultNamer)
+			if tc.igBackend {
+				if _, err := pool.Create(igPort, "fake-healthcheck-link"); err != nil {
+					t.Fatalf("pool.Create(%v) = %v", igPort.ID, err)
+				}
+			}
+			if tc.negBackend {
+				be := &composite.BackendService{
+					Name:     negPort.BackendName(defaultNamer),
+					Backends: []*composite.Backend{{Group: "https://www.googleapis.com/compute/v1/projects/p/zones/zone1/networkEndpointGroups/neg"}},
+				}
+				key := meta.GlobalKey(be.Name)
+				if err := composite.CreateBackendService(fakeGCE, key, be); err != nil {
+					t.Fatalf("CreateBackendService(%v) = %v", be.Name, err)
+				}
+			}
+
+			start := time.Now()
+			m := NewNEGMigrator(pool, fakeGCE, kubeClient, serviceLister, defaultNamer, 10*time.Minute)
+			m.now = func() time.Time { return start }
+			// The first sync starts the migration.
+			if _, err := m.Migrate([]utils.ServicePort{tc.sp}); err != nil {
+				t.Fatalf("Migrate() = %v", err)
+			}
+			syncLister()
+			// The start of the migration is read from the Service after a
+			// restart.
+			m = NewNEGMigrator(pool, fakeGCE, kubeClient, serviceLister, defaultNamer, 10*time.Minute)
+			m.now = func() time.Time { return start.Add(tc.elapsed) }
+
+			igPorts, err := m.Migrate([]utils.ServicePort{tc.sp, tc.sp})
+			if err != nil {
+				t.Fatalf("Migrate() = %v", err)
+			}
+			if gotMigrating := len(igPorts) == 1; gotMigrating != tc.wantMigrating || len(igPorts) > 1 {
+				t.Fatalf("Migrate() = %+v, want migrating: %t", igPorts, tc.wantMigrating)
+			}
+			_, migrating := syncLister().Annotations[annotations.NEGMigrationKey]
+			if migrating != tc.wantMigrating {
+				t.Errorf("%s annotation set: %t, want %t", annotations.NEGMigrationKey, migrating, tc.wantMigrating)
+			}
+			gcPorts := m.GCPorts([]utils.ServicePort{tc.sp})
+			if tc.wantMigrating {
+				if len(gcPorts) != 2 || gcPorts[1].NEGEnabled || gcPorts[1].BackendName(defaultNamer) != igPort.BackendName(defaultNamer) {
+					t.Errorf("GCPorts() = %+v, want the instance group port kept", gcPorts)
+				}
+			} else if len(gcPorts) != 1 {
+				t.Errorf("GCPorts() = %+v, want only %v", gcPorts, tc.sp.ID)
+			}
+		})
+	}
+}
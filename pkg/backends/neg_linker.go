@@ -27,7 +27,7 @@ import (
 type negLinker struct {
 	backendPool Pool
 	negGetter   NEGGetter
-	namer       *namer.Namer
+	namer       namer.IngressNamer
 	cloud       *gce.Cloud
 }
 
@@ -37,7 +37,7 @@ var _ Linker = (*negLinker)(nil)
 func NewNEGLinker(
 	backendPool Pool,
 	negGetter NEGGetter,
-	namer *namer.Namer,
+	namer namer.IngressNamer,
 	cloud *gce.Cloud) Linker {
 	return &negLinker{
 		backendPool: backendPool,
@@ -56,7 +56,7 @@ func (l *negLinker) Link(sp utils.ServicePort, groups []GroupKey) error {
 		// Otherwise, generate the name using the namer.
 		negName := group.Name
 		if negName == "" {
-			negName = sp.BackendName(l.namer)
+			negName = l.namer.NEG(sp.ID.Service.Namespace, sp.ID.Service.Name, sp.Port)
 		}
 		neg, err := l.negGetter.GetNetworkEndpointGroup(negName, group.Zone)
 		if err != nil {
@@ -0,0 +1,159 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backends
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/annotations"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/klog"
+)
+
+// ServiceStatusUpdater records the backend services of the ports of Services
+// and their health checks in the BackendServicesKey annotation of the
+// Services, so that they can be referenced without guessing their names.
+type ServiceStatusUpdater struct {
+	kubeClient    kubernetes.Interface
+	serviceLister cache.Indexer
+}
+
+// NewServiceStatusUpdater returns a ServiceStatusUpdater.
+func NewServiceStatusUpdater(kubeClient kubernetes.Interface, serviceLister cache.Indexer) *ServiceStatusUpdater {
+	return &ServiceStatusUpdater{kubeClient: kubeClient, serviceLister: serviceLister}
+}
+
+// Set records the backend services of the service ports, replacing the
+// previous status of the same backend services. Each Service is updated once.
+func (u *ServiceStatusUpdater) Set(statuses map[utils.ServicePort]annotations.BackendServiceStatus) error {
+	bySvc := map[string]map[utils.ServicePort]annotations.BackendServiceStatus{}
+	for sp, status := range statuses {
+		key := sp.ID.Service.String()
+		if bySvc[key] == nil {
+			bySvc[key] = map[utils.ServicePort]annotations.BackendServiceStatus{}
+		}
+		bySvc[key][sp] = status
+	}
+
+	var errs []error
+	for key, svcStatuses := range bySvc {
+		obj, exists, err := u.serviceLister.GetByKey(key)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !exists {
+			continue
+		}
+		svc := obj.(*v1.Service)
+		current, _, err := annotations.FromService(svc).BackendServicesStatus()
+		if err != nil {
+			klog.Warningf("Overwriting the invalid backend services status of service %s: %v", key, err)
+		}
+		if current == nil {
+			current = annotations.BackendServicesStatus{}
+		}
+		for sp, status := range svcStatuses {
+			port := strconv.Itoa(int(sp.Port))
+			portStatuses := []annotations.BackendServiceStatus{status}
+			for _, s := range current[port] {
+				if !utils.EqualResourceIDs(s.BackendService, status.BackendService) {
+					portStatuses = append(portStatuses, s)
+				}
+			}
+			sort.Slice(portStatuses, func(i, j int) bool { return portStatuses[i].BackendService < portStatuses[j].BackendService })
+			current[port] = portStatuses
+		}
+		if err := u.update(svc, current); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// Delete removes the given backend services from the status of the Services.
+func (u *ServiceStatusUpdater) Delete(backendServices []string) error {
+	if len(backendServices) == 0 {
+		return nil
+	}
+	for _, obj := range u.serviceLister.List() {
+		svc := obj.(*v1.Service)
+		statuses, ok, err := annotations.FromService(svc).BackendServicesStatus()
+		if !ok || err != nil {
+			continue
+		}
+		for port, portStatuses := range statuses {
+			var kept []annotations.BackendServiceStatus
+			for _, s := range portStatuses {
+				if !containsResource(backendServices, s.BackendService) {
+					kept = append(kept, s)
+				}
+			}
+			if len(kept) == 0 {
+				delete(statuses, port)
+			} else {
+				statuses[port] = kept
+			}
+		}
+		if err := u.update(svc, statuses); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// update sets the status of the Service if it changed. The annotation is
+// removed if the status is empty.
+func (u *ServiceStatusUpdater) update(svc *v1.Service, statuses annotations.BackendServicesStatus) error {
+	existing, ok := svc.Annotations[annotations.BackendServicesKey]
+	svc = svc.DeepCopy()
+	if len(statuses) == 0 {
+		if !ok {
+			return nil
+		}
+		delete(svc.Annotations, annotations.BackendServicesKey)
+	} else {
+		b, err := json.Marshal(statuses)
+		if err != nil {
+			return err
+		}
+		if ok && existing == string(b) {
+			return nil
+		}
+		if svc.Annotations == nil {
+			svc.Annotations = map[string]string{}
+		}
+		svc.Annotations[annotations.BackendServicesKey] = string(b)
+	}
+	klog.V(2).Infof("Updating the backend services status of service %s/%s.", svc.Namespace, svc.Name)
+	_, err := u.kubeClient.CoreV1().Services(svc.Namespace).Update(svc)
+	return err
+}
+
+// containsResource returns true if links contains a link to the resource of
+// link, whatever the API version of the links.
+func containsResource(links []string, link string) bool {
+	for _, l := range links {
+		if utils.EqualResourceIDs(l, link) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backends
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/annotations"
+	"k8s.io/ingress-gce/pkg/utils"
+)
+
+func TestServiceStatusUpdater(t *testing.T) {
+	const (
+		globalBS   = "https://www.googleapis.com/compute/v1/projects/p/global/backendServices/bs"
+		regionalBS = "https://www.googleapis.com/compute/beta/projects/p/regions/r/backendServices/bs"
+		hc         = "https://www.googleapis.com/compute/v1/projects/p/global/healthChecks/hc"
+		otherHC    = "https://www.googleapis.com/compute/v1/projects/p/global/healthChecks/other"
+	)
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "svc"}}
+	kubeClient := fake.NewSimpleClientset(svc)
+	serviceLister := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	serviceLister.Add(svc)
+	updater := NewServiceStatusUpdater(kubeClient, serviceLister)
+	sp := utils.ServicePort{ID: utils.ServicePortID{Service: types.NamespacedName{Namespace: "ns", Name: "svc"}}, Port: 80}
+
+	status := func() annotations.BackendServicesStatus {
+		t.Helper()
+		svc, err := kubeClient.CoreV1().Services("ns").Get("svc", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Keep the lister in sync with the updates.
+		serviceLister.Update(svc)
+		status, _, err := annotations.FromService(svc).BackendServicesStatus()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+
+	for _, step := range []struct {
+		desc string
+		set  map[utils.ServicePort]annotations.BackendServiceStatus
+		del  []string
+		want annotations.BackendServicesStatus
+	}{
+		{
+			desc: "global backend service",
+			set:  map[utils.ServicePort]annotations.BackendServiceStatus{sp: {BackendService: globalBS, HealthCheck: hc}},
+			want: annotations.BackendServicesStatus{"80": {{BackendService: globalBS, HealthCheck: hc}}},
+		},
+		{
+			desc: "regional backend service of the same port",
+			set:  map[utils.ServicePort]annotations.BackendServiceStatus{sp: {BackendService: regionalBS}},
+			want: annotations.BackendServicesStatus{"80": {{BackendService: regionalBS}, {BackendService: globalBS, HealthCheck: hc}}},
+		},
+		{
+			desc: "health check of the global backend service changed",
+			set:  map[utils.ServicePort]annotations.BackendServiceStatus{sp: {BackendService: globalBS, HealthCheck: otherHC}},
+			want: annotations.BackendServicesStatus{"80": {{BackendService: regionalBS}, {BackendService: globalBS, HealthCheck: otherHC}}},
+		},
+		{
+			desc: "regional backend service deleted",
+			del:  []string{"https://www.googleapis.com/compute/v1/projects/p/regions/r/backendServices/bs"},
+			want: annotations.BackendServicesStatus{"80": {{BackendService: globalBS, HealthCheck: otherHC}}},
+		},
+		{
+			desc: "all backend services deleted",
+			del:  []string{globalBS},
+		},
+	} {
+		if step.set != nil {
+			if err := updater.Set(step.set); err != nil {
+				t.Fatalf("%s: Set() = %v", step.desc, err)
+			}
+		}
+		if err := updater.Delete(step.del); err != nil {
+			t.Fatalf("%s: Delete() = %v", step.desc, err)
+		}
+		if got := status(); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: got status %v, want %v", step.desc, got, step.want)
+		}
+	}
+}
@@ -20,7 +20,10 @@ import (
 
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/ingress-gce/pkg/alerting"
+	"k8s.io/ingress-gce/pkg/annotations"
 	"k8s.io/ingress-gce/pkg/backends/features"
 	"k8s.io/ingress-gce/pkg/composite"
 	"k8s.io/ingress-gce/pkg/flags"
@@ -37,8 +40,14 @@ type backendSyncer struct {
 	backendPool   Pool
 	healthChecker healthchecks.HealthChecker
 	prober        ProbeProvider
-	namer         *namer.Namer
+	namer         namer.IngressNamer
 	cloud         *gce.Cloud
+	// alertPolicies manages the alert policies configured in BackendConfigs.
+	// Nil if disabled.
+	alertPolicies *alerting.Manager
+	// serviceStatus records the backend services in the annotations of
+	// their Services. Nil if disabled.
+	serviceStatus *ServiceStatusUpdater
 }
 
 // backendSyncer is a Syncer
@@ -47,13 +56,17 @@ var _ Syncer = (*backendSyncer)(nil)
 func NewBackendSyncer(
 	backendPool Pool,
 	healthChecker healthchecks.HealthChecker,
-	namer *namer.Namer,
-	cloud *gce.Cloud) Syncer {
+	namer namer.IngressNamer,
+	cloud *gce.Cloud,
+	alertPolicies *alerting.Manager,
+	serviceStatus *ServiceStatusUpdater) Syncer {
 	return &backendSyncer{
 		backendPool:   backendPool,
 		healthChecker: healthChecker,
 		namer:         namer,
 		cloud:         cloud,
+		alertPolicies: alertPolicies,
+		serviceStatus: serviceStatus,
 	}
 }
 
@@ -64,17 +77,30 @@ func (s *backendSyncer) Init(pp ProbeProvider) {
 
 // Sync implements Syncer.
 func (s *backendSyncer) Sync(svcPorts []utils.ServicePort) error {
+	statuses := map[utils.ServicePort]annotations.BackendServiceStatus{}
+	// Don't return error here since the backend services are in sync.
+	defer func() {
+		if s.serviceStatus == nil {
+			return
+		}
+		if err := s.serviceStatus.Set(statuses); err != nil {
+			klog.Errorf("Error updating the backend services status of services: %v", err)
+		}
+	}()
 	for _, sp := range svcPorts {
 		klog.V(3).Infof("Sync: backend %+v", sp)
-		if err := s.ensureBackendService(sp); err != nil {
+		status, err := s.ensureBackendService(sp)
+		if err != nil {
 			return err
 		}
+		statuses[sp] = *status
 	}
 	return nil
 }
 
-// ensureBackendService will update or create a BackendService for the given port.
-func (s *backendSyncer) ensureBackendService(sp utils.ServicePort) error {
+// ensureBackendService will update or create a BackendService for the given port
+// and returns its status.
+func (s *backendSyncer) ensureBackendService(sp utils.ServicePort) (*annotations.BackendServiceStatus, error) {
 	// We must track the ports even if creating the backends failed, because
 	// we might've created health-check for them.
 	be := &composite.BackendService{}
@@ -95,23 +121,24 @@ func (s *backendSyncer) ensureBackendService(sp utils.ServicePort) error {
 	// Ensure health check for backend service exists.
 	hcLink, err := s.ensureHealthCheck(sp, hasLegacyHC)
 	if err != nil {
-		return fmt.Errorf("error ensuring health check: %v", err)
+		return nil, fmt.Errorf("error ensuring health check: %v", err)
 	}
 
 	// Verify existence of a backend service for the proper port
 	// but do not specify any backends for it (IG / NEG).
 	if getErr != nil {
 		if !utils.IsNotFoundError(getErr) {
-			return getErr
+			return nil, getErr
 		}
 		// Only create the backend service if the error was 404.
 		klog.V(2).Infof("Creating backend service for port %v named %v", sp.NodePort, beName)
 		be, err = s.backendPool.Create(sp, hcLink)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
+	oldHCLink := getHealthCheckLink(be)
 	needUpdate := ensureProtocol(be, sp)
 	needUpdate = ensureHealthCheckLink(be, hcLink) || needUpdate
 	needUpdate = ensureDescription(be, &sp) || needUpdate
@@ -126,17 +153,31 @@ func (s *backendSyncer) ensureBackendService(sp utils.ServicePort) error {
 
 	if needUpdate {
 		if err := s.backendPool.Update(be); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	if sp.BackendConfig != nil {
+	// The backend service switched from its own health check to a shared one.
+	// Shared health checks are only deleted by GC, once unreferenced.
+	if name, err := utils.KeyName(oldHCLink); err == nil && name == beName && !utils.EqualResourceIDs(oldHCLink, hcLink) {
+		klog.V(2).Infof("Deleting health check %v replaced by %v", name, hcLink)
+		if err := utils.IgnoreHTTPNotFound(s.healthChecker.Delete(name, scope)); err != nil {
+			return nil, err
+		}
+	}
+
+	if sp.BackendConfig != nil || sp.SecurityPolicy != "" {
 		if err := features.EnsureSecurityPolicy(s.cloud, sp, be, beName); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return nil
+	// The alert policies use the metrics of external load balancers.
+	if s.alertPolicies != nil && scope == meta.Global {
+		s.alertPolicies.Sync(beName, sp.BackendConfig)
+	}
+
+	return &annotations.BackendServiceStatus{BackendService: be.SelfLink, HealthCheck: hcLink}, nil
 }
 
 // GC implements Syncer.
@@ -177,11 +218,41 @@ func (s *backendSyncer) GC(svcPorts []utils.ServicePort) error {
 		return fmt.Errorf("error GCing Backends: %v", err)
 	}
 
+	if err := s.gcSharedHealthChecks(backends, knownPorts); err != nil {
+		return fmt.Errorf("error GCing shared health checks: %v", err)
+	}
+
 	return nil
 }
 
+// gcSharedHealthChecks deletes the shared health checks which are no longer
+// referenced by any of the backends which are kept. This also runs when
+// sharing is disabled, to delete the health checks shared before.
+func (s *backendSyncer) gcSharedHealthChecks(backends []*composite.BackendService, knownPorts sets.String) error {
+	var links []string
+	for _, be := range backends {
+		key, err := composite.CreateKey(s.cloud, be.Name, meta.Global)
+		if err != nil {
+			return err
+		}
+		if knownPorts.Has(key.String()) {
+			links = append(links, be.HealthChecks...)
+		}
+	}
+	return s.healthChecker.GCShared(links)
+}
+
 // gc deletes the provided backends
 func (s *backendSyncer) gc(backends []*composite.BackendService, knownPorts sets.String) error {
+	var deleted []string
+	defer func() {
+		if s.serviceStatus == nil {
+			return
+		}
+		if err := s.serviceStatus.Delete(deleted); err != nil {
+			klog.Errorf("Error removing deleted backend services from the status of services: %v", err)
+		}
+	}()
 	for _, be := range backends {
 		var key *meta.Key
 		name := be.Name
@@ -207,16 +278,25 @@ func (s *backendSyncer) gc(backends []*composite.BackendService, knownPorts sets
 			klog.Errorf("backendPool.Delete(%v, %v, %v) = %v", name, be.Version, scope, err)
 			return err
 		}
+		deleted = append(deleted, be.SelfLink)
 
-		if err := s.healthChecker.Delete(name, scope); err != nil {
+		// Backends using a shared health check have no health check of their own.
+		if err := utils.IgnoreHTTPNotFound(s.healthChecker.Delete(name, scope)); err != nil {
 			return err
 		}
+
+		// Cloud Monitoring errors don't fail the GC of the backend service.
+		if s.alertPolicies != nil && scope == meta.Global {
+			if err := s.alertPolicies.Delete(name); err != nil {
+				klog.Warningf("Error deleting alert policies of backend service %v: %v", name, err)
+			}
+		}
 	}
 	return nil
 }
 
 // TODO: (shance) add unit tests
-func knownPortsFromServicePorts(cloud *gce.Cloud, namer *namer.Namer, svcPorts []utils.ServicePort) (sets.String, error) {
+func knownPortsFromServicePorts(cloud *gce.Cloud, namer namer.IngressNamer, svcPorts []utils.ServicePort) (sets.String, error) {
 	knownPorts := sets.NewString()
 
 	for _, sp := range svcPorts {
@@ -257,8 +337,21 @@ func (s *backendSyncer) ensureHealthCheck(sp utils.ServicePort, hasLegacyHC bool
 		if probe != nil {
 			klog.V(4).Infof("Applying httpGet settings of readinessProbe to health check on port %+v", sp)
 			applyProbeSettingsToHC(probe, hc)
+			if hc.ForNEG && flags.F.EnableNEGProbeHealthChecks {
+				applyProbePortAndSchemeToNEGHC(probe, hc, sp)
+			}
 		}
 	}
+	if hc.ForNEG && sp.HealthCheckPort != 0 {
+		hc.Port = sp.HealthCheckPort
+		hc.PortSpecification = healthchecks.UseFixedPortSpecification
+	}
+	if sp.BackendConfig != nil {
+		hc.UpdateFromBackendConfig(sp.BackendConfig.Spec.HealthCheck)
+	}
+	if flags.Reloadable().EnableSharedHealthChecks {
+		s.healthChecker.Share(hc)
+	}
 
 	return s.healthChecker.Sync(hc)
 }
@@ -273,10 +366,10 @@ func getHealthCheckLink(be *composite.BackendService) string {
 
 // ensureProtocol updates the BackendService Protocol with the expected value
 func ensureProtocol(be *composite.BackendService, p utils.ServicePort) (needsUpdate bool) {
-	if be.Protocol == string(p.Protocol) {
+	if be.Protocol == string(p.BackendProtocol()) {
 		return false
 	}
-	be.Protocol = string(p.Protocol)
+	be.Protocol = string(p.BackendProtocol())
 	return true
 }
 
@@ -319,3 +412,27 @@ func applyProbeSettingsToHC(p *v1.Probe, hc *healthchecks.HealthCheck) {
 		hc.CheckIntervalSec = int64(p.PeriodSeconds) + int64(healthchecks.DefaultHealthCheckInterval.Seconds())
 	}
 }
+
+// applyProbePortAndSchemeToNEGHC applies the port and scheme of the readiness
+// probe to a NEG health check. Since NEG health checks reach the pods directly,
+// a probe on a port other than the serving one can be used as is.
+func applyProbePortAndSchemeToNEGHC(p *v1.Probe, hc *healthchecks.HealthCheck, sp utils.ServicePort) {
+	hc.ForProbe = true
+	if port := p.Handler.HTTPGet.Port; port.String() != sp.TargetPort && port.Type == intstr.Int {
+		hc.Port = int64(port.IntVal)
+		hc.PortSpecification = healthchecks.UseFixedPortSpecification
+	}
+	// The health check type matches the backend protocol by default, only
+	// override it when the probe explicitly uses another scheme.
+	if scheme := p.Handler.HTTPGet.Scheme; scheme != "" && scheme != probeScheme(hc.Protocol()) {
+		hc.Type = string(scheme)
+	}
+}
+
+// probeScheme returns the readiness probe scheme used for a protocol.
+func probeScheme(protocol annotations.AppProtocol) v1.URIScheme {
+	if protocol == annotations.ProtocolHTTP2 {
+		return v1.URISchemeHTTPS
+	}
+	return v1.URIScheme(protocol)
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
@@ -30,11 +31,18 @@ import (
 	"google.golang.org/api/compute/v1"
 	"google.golang.org/api/googleapi"
 	api_v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/alerting"
 	"k8s.io/ingress-gce/pkg/annotations"
+	backendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/backendconfig/v1beta1"
 	"k8s.io/ingress-gce/pkg/backends/features"
 	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/events"
+	"k8s.io/ingress-gce/pkg/flags"
 	"k8s.io/ingress-gce/pkg/healthchecks"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/ingress-gce/pkg/utils/namer"
@@ -553,6 +561,142 @@ func TestSyncNEG(t *testing.T) {
 	}
 }
 
+func TestSyncSharedHealthChecks(t *testing.T) {
+	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	syncer := newTestSyncer(fakeGCE)
+	defer func() { flags.F.EnableSharedHealthChecks = false }()
+
+	newSvcPort := func(name string) utils.ServicePort {
+		return utils.ServicePort{
+			ID:         utils.ServicePortID{Service: types.NamespacedName{Namespace: "ns", Name: name}, Port: intstr.FromInt(80)},
+			Port:       80,
+			Protocol:   annotations.ProtocolHTTP,
+			NEGEnabled: true,
+		}
+	}
+	sp1, sp2 := newSvcPort("svc1"), newSvcPort("svc2")
+	hcLink := func(sp utils.ServicePort) string {
+		be, err := fakeGCE.GetGlobalBackendService(sp.BackendName(defaultNamer))
+		if err != nil {
+			t.Fatalf("GetGlobalBackendService(%v) = %v", sp.ID, err)
+		}
+		if len(be.HealthChecks) != 1 {
+			t.Fatalf("backend %v has health checks %v, want one", be.Name, be.HealthChecks)
+		}
+		return be.HealthChecks[0]
+	}
+	hcExists := func(name string) bool {
+		_, err := fakeGCE.GetHealthCheck(name)
+		return err == nil
+	}
+
+	// Without sharing, the backend has its own health check.
+	if err := syncer.Sync([]utils.ServicePort{sp1}); err != nil {
+		t.Fatalf("syncer.Sync() = %v, want nil", err)
+	}
+	ownHC := sp1.BackendName(defaultNamer)
+	if !hcExists(ownHC) {
+		t.Fatalf("health check %v does not exist", ownHC)
+	}
+
+	// With sharing, both backends use the same health check and the one of
+	// the first backend is deleted.
+	flags.F.EnableSharedHealthChecks = true
+	if err := syncer.Sync([]utils.ServicePort{sp1, sp2}); err != nil {
+		t.Fatalf("syncer.Sync() = %v, want nil", err)
+	}
+	link := hcLink(sp1)
+	if link != hcLink(sp2) {
+		t.Errorf("backends use health checks %q and %q, want a shared one", link, hcLink(sp2))
+	}
+	sharedHC, err := utils.KeyName(link)
+	if err != nil {
+		t.Fatalf("utils.KeyName(%q) = %v", link, err)
+	}
+	if !defaultNamer.IsSharedHealthCheck(sharedHC) {
+		t.Errorf("health check %v is not a shared health check", sharedHC)
+	}
+	if hcExists(ownHC) {
+		t.Errorf("health check %v was not deleted", ownHC)
+	}
+
+	// The shared health check is kept while it is referenced.
+	if err := syncer.GC([]utils.ServicePort{sp1}); err != nil {
+		t.Fatalf("syncer.GC() = %v, want nil", err)
+	}
+	if !hcExists(sharedHC) {
+		t.Errorf("health check %v was deleted while still referenced", sharedHC)
+	}
+	if err := syncer.GC(nil); err != nil {
+		t.Fatalf("syncer.GC() = %v, want nil", err)
+	}
+	if hcExists(sharedHC) {
+		t.Errorf("health check %v was not deleted", sharedHC)
+	}
+}
+
+func TestSyncNEGHealthCheckPort(t *testing.T) {
+	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	syncer := newTestSyncer(fakeGCE)
+
+	svcPort := utils.ServicePort{
+		ID:              utils.ServicePortID{Service: types.NamespacedName{Namespace: "ns", Name: "svc"}, Port: intstr.FromInt(80)},
+		Port:            80,
+		Protocol:        annotations.ProtocolHTTP,
+		NEGEnabled:      true,
+		HealthCheckPort: 9000,
+	}
+	for _, port := range []int64{9000, 9001} {
+		svcPort.HealthCheckPort = port
+		if err := syncer.Sync([]utils.ServicePort{svcPort}); err != nil {
+			t.Fatalf("syncer.Sync() = %v, want nil", err)
+		}
+		hc, err := fakeGCE.GetHealthCheck(svcPort.BackendName(defaultNamer))
+		if err != nil {
+			t.Fatalf("GetHealthCheck() = %v", err)
+		}
+		if hc.HttpHealthCheck == nil || hc.HttpHealthCheck.Port != port {
+			t.Errorf("Got HTTP health check %+v, want port %d", hc.HttpHealthCheck, port)
+		}
+	}
+}
+
+func TestSyncBackendServicesStatus(t *testing.T) {
+	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	syncer := newTestSyncer(fakeGCE)
+	svc := &api_v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "svc"}}
+	kubeClient := fake.NewSimpleClientset(svc)
+	serviceLister := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	serviceLister.Add(svc)
+	syncer.serviceStatus = NewServiceStatusUpdater(kubeClient, serviceLister)
+
+	svcPort := utils.ServicePort{
+		ID:         utils.ServicePortID{Service: types.NamespacedName{Namespace: "ns", Name: "svc"}, Port: intstr.FromInt(80)},
+		Port:       80,
+		Protocol:   annotations.ProtocolHTTP,
+		NEGEnabled: true,
+	}
+	if err := syncer.Sync([]utils.ServicePort{svcPort}); err != nil {
+		t.Fatalf("syncer.Sync() = %v, want nil", err)
+	}
+	be, err := fakeGCE.GetGlobalBackendService(svcPort.BackendName(defaultNamer))
+	if err != nil {
+		t.Fatalf("GetGlobalBackendService() = %v", err)
+	}
+	updated, err := kubeClient.CoreV1().Services("ns").Get("svc", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, _, err := annotations.FromService(updated).BackendServicesStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := annotations.BackendServicesStatus{"80": {{BackendService: be.SelfLink, HealthCheck: be.HealthChecks[0]}}}
+	if !reflect.DeepEqual(status, want) {
+		t.Errorf("Got backend services status %v, want %v", status, want)
+	}
+}
+
 func TestShutdown(t *testing.T) {
 	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
 	syncer := newTestSyncer(fakeGCE)
@@ -591,6 +735,76 @@ func TestApplyProbeSettingsToHC(t *testing.T) {
 	}
 }
 
+func TestApplyProbePortAndSchemeToNEGHC(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		protocol     annotations.AppProtocol
+		port         intstr.IntOrString
+		scheme       api_v1.URIScheme
+		wantPort     int64
+		wantPortSpec string
+		wantProtocol annotations.AppProtocol
+	}{
+		{
+			desc:         "probe on serving port",
+			protocol:     annotations.ProtocolHTTP,
+			port:         intstr.FromInt(8080),
+			scheme:       api_v1.URISchemeHTTP,
+			wantPortSpec: healthchecks.UseServingPortSpecification,
+			wantProtocol: annotations.ProtocolHTTP,
+		},
+		{
+			desc:         "probe on another port",
+			protocol:     annotations.ProtocolHTTP,
+			port:         intstr.FromInt(9090),
+			scheme:       api_v1.URISchemeHTTP,
+			wantPort:     9090,
+			wantPortSpec: healthchecks.UseFixedPortSpecification,
+			wantProtocol: annotations.ProtocolHTTP,
+		},
+		{
+			desc:         "probe with another scheme",
+			protocol:     annotations.ProtocolHTTP,
+			port:         intstr.FromInt(8080),
+			scheme:       api_v1.URISchemeHTTPS,
+			wantPortSpec: healthchecks.UseServingPortSpecification,
+			wantProtocol: annotations.ProtocolHTTPS,
+		},
+		{
+			desc:         "HTTP2 backend with HTTPS probe",
+			protocol:     annotations.ProtocolHTTP2,
+			port:         intstr.FromInt(8080),
+			scheme:       api_v1.URISchemeHTTPS,
+			wantPortSpec: healthchecks.UseServingPortSpecification,
+			wantProtocol: annotations.ProtocolHTTP2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			sp := utils.ServicePort{Protocol: tc.protocol, NEGEnabled: true, TargetPort: "8080"}
+			hc := healthchecks.DefaultNEGHealthCheck(tc.protocol)
+			probe := &api_v1.Probe{
+				Handler: api_v1.Handler{
+					HTTPGet: &api_v1.HTTPGetAction{Scheme: tc.scheme, Path: "/healthz", Port: tc.port},
+				},
+			}
+
+			applyProbePortAndSchemeToNEGHC(probe, hc, sp)
+
+			if hc.Port != tc.wantPort || hc.PortSpecification != tc.wantPortSpec {
+				t.Errorf("got port %d and port specification %q, want %d and %q", hc.Port, hc.PortSpecification, tc.wantPort, tc.wantPortSpec)
+			}
+			if hc.Protocol() != tc.wantProtocol {
+				t.Errorf("got protocol %v, want %v", hc.Protocol(), tc.wantProtocol)
+			}
+			if !hc.ForProbe {
+				t.Errorf("got ForProbe = false, want true")
+			}
+		})
+	}
+}
+
 func TestEnsureBackendServiceProtocol(t *testing.T) {
 	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
 	syncer := newTestSyncer(fakeGCE)
@@ -703,3 +917,42 @@ func TestEnsureBackendServiceHealthCheckLink(t *testing.T) {
 		t.Fatalf("Expected ensureHealthCheckLink for healthcheck with the same name to return false, got %v", needsHcUpdate)
 	}
 }
+
+func TestSyncAlertPolicies(t *testing.T) {
+	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	syncer := newTestSyncer(fakeGCE)
+	alertClient := alerting.NewFakeClient()
+	syncer.alertPolicies = alerting.NewManager(alertClient, fakeGCE.ProjectID(), events.RecorderProducerMock{})
+
+	sp := utils.ServicePort{
+		ID:       utils.ServicePortID{Service: types.NamespacedName{Namespace: "ns", Name: "svc"}, Port: intstr.FromInt(80)},
+		NodePort: 30001,
+		Protocol: annotations.ProtocolHTTP,
+		BackendConfig: &backendconfigv1beta1.BackendConfig{
+			Spec: backendconfigv1beta1.BackendConfigSpec{
+				Alerting: &backendconfigv1beta1.AlertingConfig{Enabled: true},
+			},
+		},
+	}
+	beName := sp.BackendName(defaultNamer)
+
+	if err := syncer.Sync([]utils.ServicePort{sp}); err != nil {
+		t.Fatalf("syncer.Sync() = %v, want nil", err)
+	}
+	if len(alertClient.Policies) != 2 {
+		t.Fatalf("Got %d alert policies, want 2", len(alertClient.Policies))
+	}
+	for _, policy := range alertClient.Policies {
+		if !strings.Contains(policy.Conditions[0].ConditionThreshold.Filter, fmt.Sprintf("backend_target_name=%q", beName)) {
+			t.Errorf("Got filter %q, want the metrics of backend service %v", policy.Conditions[0].ConditionThreshold.Filter, beName)
+		}
+	}
+
+	// The alert policies are deleted with the backend service.
+	if err := syncer.GC([]utils.ServicePort{}); err != nil {
+		t.Fatalf("syncer.GC() = %v, want nil", err)
+	}
+	if len(alertClient.Policies) != 0 {
+		t.Errorf("Got %d alert policies after GC, want 0", len(alertClient.Policies))
+	}
+}
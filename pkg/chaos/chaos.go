@@ -0,0 +1,254 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package chaos injects failures into the calls of the controller to GCE,
+// to validate that the controller heals from them.
+package chaos
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"google.golang.org/api/googleapi"
+	"k8s.io/klog"
+)
+
+// Config is the configuration of an Injector. Rates are probabilities
+// between 0 and 1.
+type Config struct {
+	// ErrorRate is the rate of calls failing with a server error.
+	ErrorRate float64
+	// OperationErrorRates overrides ErrorRate for the operations with the
+	// given names, e.g. "NetworkEndpointGroups.AttachNetworkEndpoints".
+	OperationErrorRates map[string]float64
+	// QuotaErrorRate is the rate of the injected errors which are quota
+	// exceeded errors instead of server errors.
+	QuotaErrorRate float64
+	// DelayRate is the rate of calls delayed by Delay.
+	DelayRate float64
+	Delay     time.Duration
+	// StaleReads makes the reads of the decorated clouds return the result
+	// of the previous identical read, as if the writes since were not
+	// visible yet.
+	StaleReads bool
+	// Seed seeds the random faults, so that failing runs can be replayed.
+	Seed int64
+}
+
+// Enabled returns true if the configuration injects any fault.
+func (c Config) Enabled() bool {
+	for _, rate := range c.OperationErrorRates {
+		if rate > 0 {
+			return true
+		}
+	}
+	return c.ErrorRate > 0 || (c.DelayRate > 0 && c.Delay > 0) || c.StaleReads
+}
+
+// Injector decides which calls fail or get delayed.
+type Injector struct {
+	config Config
+
+	lock    sync.Mutex
+	rand    *rand.Rand
+	enabled bool
+	// errors is the number of errors injected.
+	errors int
+	// reads are the results of the reads of the decorated clouds, by call,
+	// returned again while reads are stale.
+	reads map[string]interface{}
+}
+
+// NewInjector returns a new enabled Injector.
+func NewInjector(config Config) *Injector {
+	return &Injector{
+		config:  config,
+		rand:    rand.New(rand.NewSource(config.Seed)),
+		enabled: true,
+		reads:   map[string]interface{}{},
+	}
+}
+
+// SetEnabled enables or disables the faults.
+func (i *Injector) SetEnabled(enabled bool) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.enabled = enabled
+}
+
+// SetErrorRate sets the error rate of the operation, overriding ErrorRate.
+func (i *Injector) SetErrorRate(operation string, rate float64) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	rates := map[string]float64{}
+	for op, r := range i.config.OperationErrorRates {
+		rates[op] = r
+	}
+	rates[operation] = rate
+	i.config.OperationErrorRates = rates
+}
+
+// SetStaleReads sets whether the reads of the decorated clouds return the
+// result of the previous identical read.
+func (i *Injector) SetStaleReads(stale bool) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.config.StaleReads = stale
+}
+
+// Errors returns the number of errors injected so far.
+func (i *Injector) Errors() int {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return i.errors
+}
+
+// Roll returns true with the given probability, if the faults are enabled.
+func (i *Injector) Roll(rate float64) bool {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return i.enabled && rate > 0 && i.rand.Float64() < rate
+}
+
+// Fault delays the call of the operation and returns the error it must fail
+// with, or nil.
+func (i *Injector) Fault(operation string) error {
+	i.lock.Lock()
+	config := i.config
+	i.lock.Unlock()
+
+	if i.Roll(config.DelayRate) {
+		time.Sleep(config.Delay)
+	}
+	rate := config.ErrorRate
+	if r, ok := config.OperationErrorRates[operation]; ok {
+		rate = r
+	}
+	if !i.Roll(rate) {
+		return nil
+	}
+	i.lock.Lock()
+	i.errors++
+	i.lock.Unlock()
+	if i.Roll(config.QuotaErrorRate) {
+		klog.V(4).Infof("Injecting quota exceeded failure of %s", operation)
+		msg := "chaos: injected quota exceeded failure of " + operation
+		return &googleapi.Error{
+			Code:    http.StatusForbidden,
+			Message: msg,
+			Errors:  []googleapi.ErrorItem{{Reason: "quotaExceeded", Message: msg}},
+		}
+	}
+	klog.V(4).Infof("Injecting failure of %s", operation)
+	return &googleapi.Error{Code: http.StatusServiceUnavailable, Message: "chaos: injected failure of " + operation}
+}
+
+// read returns the result of the previous read with the same key if reads
+// are stale, otherwise calls get and records its result.
+func (i *Injector) read(key string, get func() (interface{}, error)) (interface{}, error) {
+	i.lock.Lock()
+	stale := i.enabled && i.config.StaleReads
+	result, ok := i.reads[key]
+	i.lock.Unlock()
+	if stale && ok {
+		return result, nil
+	}
+	result, err := get()
+	if err != nil {
+		return nil, err
+	}
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.reads[key] = result
+	return result, nil
+}
+
+// RateLimiter returns a cloud.RateLimiter injecting the faults before
+// accepting the calls with rl, which may be nil. As the operations of
+// mutating calls are polled through the rate limiter, delays also delay
+// operations.
+func (i *Injector) RateLimiter(rl cloud.RateLimiter) cloud.RateLimiter {
+	return &rateLimiter{injector: i, rl: rl}
+}
+
+type rateLimiter struct {
+	injector *Injector
+	rl       cloud.RateLimiter
+}
+
+// Accept implements cloud.RateLimiter.
+func (r *rateLimiter) Accept(ctx context.Context, key *cloud.RateLimitKey) error {
+	if err := r.injector.Fault(string(key.Version) + "." + key.Service + "." + key.Operation); err != nil {
+		return err
+	}
+	if r.rl == nil || reflect.ValueOf(r.rl).IsNil() {
+		return nil
+	}
+	return r.rl.Accept(ctx, key)
+}
+
+// InjectMockFaults injects the faults into all the calls to the resources of
+// mockGCE, which do not go through the rate limiter. Hooks already set on
+// the mocks are kept and run for the calls without faults.
+func (i *Injector) InjectMockFaults(mockGCE *cloud.MockGCE) {
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	mocks := reflect.ValueOf(mockGCE).Elem()
+	for m := 0; m < mocks.NumField(); m++ {
+		mock := mocks.Field(m)
+		if mock.Kind() != reflect.Ptr || mock.IsNil() || mock.Elem().Kind() != reflect.Struct {
+			continue
+		}
+		resource := mocks.Type().Field(m).Name
+		for h := 0; h < mock.Elem().NumField(); h++ {
+			hook := mock.Elem().Field(h)
+			hookType := hook.Type()
+			if hookType.Kind() != reflect.Func || !hook.CanSet() || hookType.NumOut() == 0 || hookType.Out(hookType.NumOut()-1) != errorType {
+				continue
+			}
+			operation := resource + "." + mock.Elem().Type().Field(h).Name
+			original := reflect.ValueOf(hook.Interface())
+			hook.Set(reflect.MakeFunc(hookType, func(args []reflect.Value) []reflect.Value {
+				if err := i.Fault(operation); err != nil {
+					out := zeroValues(hookType)
+					// Hooks returning a bool first intercept the call
+					// with true.
+					if hookType.Out(0).Kind() == reflect.Bool {
+						out[0] = reflect.ValueOf(true)
+					}
+					out[len(out)-1] = reflect.ValueOf(&err).Elem()
+					return out
+				}
+				if !original.IsNil() {
+					return original.Call(args)
+				}
+				return zeroValues(hookType)
+			}))
+		}
+	}
+}
+
+func zeroValues(t reflect.Type) []reflect.Value {
+	out := make([]reflect.Value, t.NumOut())
+	for i := range out {
+		out[i] = reflect.Zero(t.Out(i))
+	}
+	return out
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chaos
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/mock"
+	"google.golang.org/api/compute/v1"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+func TestRateLimiter(t *testing.T) {
+	key := &cloud.RateLimitKey{Operation: "Get", Version: meta.VersionGA, Service: "BackendServices"}
+	testCases := []struct {
+		desc    string
+		config  Config
+		enabled bool
+		wantErr bool
+	}{
+		{desc: "no faults", config: Config{}, enabled: true},
+		{desc: "all calls fail", config: Config{ErrorRate: 1}, enabled: true, wantErr: true},
+		{desc: "faults disabled", config: Config{ErrorRate: 1}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			injector := NewInjector(tc.config)
+			injector.SetEnabled(tc.enabled)
+			err := injector.RateLimiter(nil).Accept(context.Background(), key)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Accept() = %v, want error %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestInjectMockFaults(t *testing.T) {
+	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	mockGCE := fakeGCE.Compute().(*cloud.MockGCE)
+	mockGCE.MockHealthChecks.UpdateHook = mock.UpdateHealthCheckHook
+	injector := NewInjector(Config{ErrorRate: 1})
+	injector.InjectMockFaults(mockGCE)
+
+	hc := &compute.HealthCheck{Name: "hc", Type: "HTTP"}
+	if err := fakeGCE.CreateHealthCheck(hc); !utils.IsHTTPErrorCode(err, 503) {
+		t.Fatalf("CreateHealthCheck() = %v, want an injected failure", err)
+	}
+	if injector.Errors() != 1 {
+		t.Errorf("Errors() = %d, want 1", injector.Errors())
+	}
+
+	// Without faults, the mocks and their hooks behave as before.
+	injector.SetEnabled(false)
+	if err := fakeGCE.CreateHealthCheck(hc); err != nil {
+		t.Fatalf("CreateHealthCheck() = %v", err)
+	}
+	hc.Type = "HTTPS"
+	if err := fakeGCE.UpdateHealthCheck(hc); err != nil {
+		t.Fatalf("UpdateHealthCheck() = %v", err)
+	}
+	if got, err := fakeGCE.GetHealthCheck("hc"); err != nil || got.Type != "HTTPS" {
+		t.Errorf("GetHealthCheck() = %+v, %v, want type HTTPS", got, err)
+	}
+}
+
+func TestNetworkEndpointGroupCloud(t *testing.T) {
+	injector := NewInjector(Config{Seed: 1})
+	cloud := injector.NetworkEndpointGroupCloud(negtypes.NewFakeNetworkEndpointGroupCloud("test-subnetwork", "test-network"))
+	if err := cloud.CreateNetworkEndpointGroup(&compute.NetworkEndpointGroup{Name: "neg"}, negtypes.TestZone1); err != nil {
+		t.Fatal(err)
+	}
+	const attachOperation = "NetworkEndpointGroups.AttachNetworkEndpoints"
+	attach := func() error {
+		return cloud.AttachNetworkEndpoints("neg", negtypes.TestZone1, []*compute.NetworkEndpoint{{IpAddress: "10.0.0.1", Port: 80, Instance: negtypes.TestInstance1}})
+	}
+
+	injector.SetErrorRate(attachOperation, 1)
+	if err := attach(); !utils.IsHTTPErrorCode(err, http.StatusServiceUnavailable) {
+		t.Errorf("AttachNetworkEndpoints() = %v, want an injected server error", err)
+	}
+	if endpoints, _ := cloud.ListNetworkEndpoints("neg", negtypes.TestZone1, false); len(endpoints) != 0 {
+		t.Errorf("Got %d endpoints after a failed attach call, want 0", len(endpoints))
+	}
+
+	injector.SetErrorRate(attachOperation, 0.5)
+	failures := 0
+	for i := 0; i < 100; i++ {
+		if attach() != nil {
+			failures++
+		}
+	}
+	if failures < 25 || failures > 75 {
+		t.Errorf("Got %d failures out of 100 calls with an error rate of 0.5", failures)
+	}
+	if got, want := injector.Errors(), failures+1; got != want {
+		t.Errorf("Errors() = %d, want %d", got, want)
+	}
+
+	injector.SetErrorRate(attachOperation, 0)
+	before, _ := cloud.ListNetworkEndpoints("neg", negtypes.TestZone1, false)
+	injector.SetStaleReads(true)
+	if err := cloud.AttachNetworkEndpoints("neg", negtypes.TestZone1, []*compute.NetworkEndpoint{{IpAddress: "10.0.0.2", Port: 80, Instance: negtypes.TestInstance1}}); err != nil {
+		t.Fatal(err)
+	}
+	if stale, _ := cloud.ListNetworkEndpoints("neg", negtypes.TestZone1, false); len(stale) != len(before) {
+		t.Errorf("Got %d endpoints with stale reads, want %d", len(stale), len(before))
+	}
+	injector.SetStaleReads(false)
+	if fresh, _ := cloud.ListNetworkEndpoints("neg", negtypes.TestZone1, false); len(fresh) != len(before)+1 {
+		t.Errorf("Got %d endpoints, want %d", len(fresh), len(before)+1)
+	}
+}
+
+func TestQuotaErrors(t *testing.T) {
+	injector := NewInjector(Config{OperationErrorRates: map[string]float64{"Firewalls.Get": 1}, QuotaErrorRate: 1})
+	err := injector.Fault("Firewalls.Get")
+	if reason, _ := negtypes.ParseOperationError(err, "compute.firewalls.get"); err == nil || reason != negtypes.ReasonQuotaExceeded {
+		t.Errorf("Fault(%q) = %v, want a quota exceeded error", "Firewalls.Get", err)
+	}
+	if err := injector.Fault("Firewalls.Insert"); err != nil {
+		t.Errorf("Fault(%q) = %v, want nil", "Firewalls.Insert", err)
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chaos
+
+import (
+	"fmt"
+
+	compute "google.golang.org/api/compute/v1"
+	"k8s.io/ingress-gce/pkg/firewalls"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+)
+
+// NetworkEndpointGroupCloud returns a NetworkEndpointGroupCloud injecting
+// the faults into the calls to cloud. Its reads are stale with StaleReads.
+func (i *Injector) NetworkEndpointGroupCloud(cloud negtypes.NetworkEndpointGroupCloud) negtypes.NetworkEndpointGroupCloud {
+	return &negCloud{NetworkEndpointGroupCloud: cloud, injector: i}
+}
+
+type negCloud struct {
+	negtypes.NetworkEndpointGroupCloud
+	injector *Injector
+}
+
+func (c *negCloud) GetNetworkEndpointGroup(name string, zone string) (*compute.NetworkEndpointGroup, error) {
+	if err := c.injector.Fault("NetworkEndpointGroups.Get"); err != nil {
+		return nil, err
+	}
+	result, err := c.injector.read(fmt.Sprintf("NetworkEndpointGroups.Get/%s/%s", zone, name), func() (interface{}, error) {
+		neg, err := c.NetworkEndpointGroupCloud.GetNetworkEndpointGroup(name, zone)
+		if err != nil {
+			return nil, err
+		}
+		// Copy the NEG so that the stale result does not change.
+		ret := *neg
+		return &ret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	neg := *result.(*compute.NetworkEndpointGroup)
+	return &neg, nil
+}
+
+func (c *negCloud) ListNetworkEndpointGroup(zone string) ([]*compute.NetworkEndpointGroup, error) {
+	if err := c.injector.Fault("NetworkEndpointGroups.List"); err != nil {
+		return nil, err
+	}
+	result, err := c.injector.read("NetworkEndpointGroups.List/"+zone, func() (interface{}, error) {
+		return c.NetworkEndpointGroupCloud.ListNetworkEndpointGroup(zone)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]*compute.NetworkEndpointGroup), nil
+}
+
+func (c *negCloud) AggregatedListNetworkEndpointGroup() (map[string][]*compute.NetworkEndpointGroup, error) {
+	if err := c.injector.Fault("NetworkEndpointGroups.AggregatedList"); err != nil {
+		return nil, err
+	}
+	result, err := c.injector.read("NetworkEndpointGroups.AggregatedList", func() (interface{}, error) {
+		return c.NetworkEndpointGroupCloud.AggregatedListNetworkEndpointGroup()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(map[string][]*compute.NetworkEndpointGroup), nil
+}
+
+func (c *negCloud) CreateNetworkEndpointGroup(neg *compute.NetworkEndpointGroup, zone string) error {
+	if err := c.injector.Fault("NetworkEndpointGroups.Insert"); err != nil {
+		return err
+	}
+	return c.NetworkEndpointGroupCloud.CreateNetworkEndpointGroup(neg, zone)
+}
+
+func (c *negCloud) DeleteNetworkEndpointGroup(name string, zone string) error {
+	if err := c.injector.Fault("NetworkEndpointGroups.Delete"); err != nil {
+		return err
+	}
+	return c.NetworkEndpointGroupCloud.DeleteNetworkEndpointGroup(name, zone)
+}
+
+func (c *negCloud) AttachNetworkEndpoints(name, zone string, endpoints []*compute.NetworkEndpoint) error {
+	if err := c.injector.Fault("NetworkEndpointGroups.AttachNetworkEndpoints"); err != nil {
+		return err
+	}
+	return c.NetworkEndpointGroupCloud.AttachNetworkEndpoints(name, zone, endpoints)
+}
+
+func (c *negCloud) DetachNetworkEndpoints(name, zone string, endpoints []*compute.NetworkEndpoint) error {
+	if err := c.injector.Fault("NetworkEndpointGroups.DetachNetworkEndpoints"); err != nil {
+		return err
+	}
+	return c.NetworkEndpointGroupCloud.DetachNetworkEndpoints(name, zone, endpoints)
+}
+
+func (c *negCloud) ListNetworkEndpoints(name, zone string, showHealthStatus bool) ([]*compute.NetworkEndpointWithHealthStatus, error) {
+	if err := c.injector.Fault("NetworkEndpointGroups.ListNetworkEndpoints"); err != nil {
+		return nil, err
+	}
+	result, err := c.injector.read(fmt.Sprintf("NetworkEndpointGroups.ListNetworkEndpoints/%s/%s/%t", zone, name, showHealthStatus), func() (interface{}, error) {
+		return c.NetworkEndpointGroupCloud.ListNetworkEndpoints(name, zone, showHealthStatus)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]*compute.NetworkEndpointWithHealthStatus), nil
+}
+
+// Firewall returns a Firewall injecting the faults into the calls to fw.
+func (i *Injector) Firewall(fw firewalls.Firewall) firewalls.Firewall {
+	return &firewall{Firewall: fw, injector: i}
+}
+
+type firewall struct {
+	firewalls.Firewall
+	injector *Injector
+}
+
+func (f *firewall) CreateFirewall(fw *compute.Firewall) error {
+	if err := f.injector.Fault("Firewalls.Insert"); err != nil {
+		return err
+	}
+	return f.Firewall.CreateFirewall(fw)
+}
+
+func (f *firewall) GetFirewall(name string) (*compute.Firewall, error) {
+	if err := f.injector.Fault("Firewalls.Get"); err != nil {
+		return nil, err
+	}
+	return f.Firewall.GetFirewall(name)
+}
+
+func (f *firewall) DeleteFirewall(name string) error {
+	if err := f.injector.Fault("Firewalls.Delete"); err != nil {
+		return err
+	}
+	return f.Firewall.DeleteFirewall(name)
+}
+
+func (f *firewall) UpdateFirewall(fw *compute.Firewall) error {
+	if err := f.injector.Fault("Firewalls.Update"); err != nil {
+		return err
+	}
+	return f.Firewall.UpdateFirewall(fw)
+}
+
+func (f *firewall) GetNodeTags(nodeNames []string) ([]string, error) {
+	if err := f.injector.Fault("Instances.Get"); err != nil {
+		return nil, err
+	}
+	return f.Firewall.GetNodeTags(nodeNames)
+}
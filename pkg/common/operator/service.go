@@ -8,6 +8,7 @@ import (
 
 	api_v1 "k8s.io/api/core/v1"
 	"k8s.io/api/networking/v1beta1"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 // Services returns the wrapper
@@ -43,6 +44,21 @@ func (op *ServicesOperator) ReferencesBackendConfig(beConfig *backendconfigv1bet
 	return Services(s)
 }
 
+// SelectsPod returns the Services whose selector matches the given Pod.
+func (op *ServicesOperator) SelectsPod(pod *api_v1.Pod) *ServicesOperator {
+	dupes := map[string]bool{}
+
+	var s []*api_v1.Service
+	for _, svc := range op.s {
+		key := fmt.Sprintf("%s/%s", svc.Namespace, svc.Name)
+		if doesServiceSelectPod(svc, pod) && !dupes[key] {
+			s = append(s, svc)
+			dupes[key] = true
+		}
+	}
+	return Services(s)
+}
+
 // ReferencedBackendIngress returns the Services that are referenced by the passed in Ingress.
 func (op *ServicesOperator) ReferencedByIngress(ing *v1beta1.Ingress) *ServicesOperator {
 	dupes := map[string]bool{}
@@ -75,3 +91,12 @@ func doesIngressReferenceService(ing *v1beta1.Ingress, svc *api_v1.Service) bool
 	})
 	return doesReference
 }
+
+// doesServiceSelectPod returns true if the selector of the passed in Service
+// matches the passed in Pod. Services without a selector match no Pods.
+func doesServiceSelectPod(svc *api_v1.Service, pod *api_v1.Pod) bool {
+	if svc.Namespace != pod.Namespace || len(svc.Spec.Selector) == 0 {
+		return false
+	}
+	return labels.SelectorFromSet(labels.Set(svc.Spec.Selector)).Matches(labels.Set(pod.Labels))
+}
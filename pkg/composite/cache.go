@@ -0,0 +1,88 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composite
+
+import (
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+)
+
+// cachedResources are the resources whose Get calls are cached once
+// EnableCache is called.
+var cachedResources = sets.NewString("BackendService", "HealthCheck")
+
+// objectCache caches the GCE objects returned by the Get calls of the
+// cached resources. It is nil unless EnableCache is called.
+var objectCache cache.Store
+
+// cachedObject is a GCE object of a version of a resource.
+type cachedObject struct {
+	key     string
+	version meta.Version
+	obj     interface{}
+}
+
+// EnableCache makes the Get calls of backend services and health checks
+// read through a cache whose entries expire after ttl, so that the repeated
+// Get calls of a sync don't each call the API. The Create, Update and Delete
+// calls of a resource invalidate its entry.
+func EnableCache(ttl time.Duration) {
+	objectCache = cache.NewTTLStore(func(obj interface{}) (string, error) {
+		return obj.(*cachedObject).key, nil
+	}, ttl)
+}
+
+// InvalidateCache invalidates the cached object of the resource, for the
+// writes of the resource which are not made through this package.
+func InvalidateCache(resource string, key *meta.Key) {
+	if objectCache == nil || !cachedResources.Has(resource) {
+		return
+	}
+	objectCache.Delete(&cachedObject{key: cacheKey(resource, key)})
+}
+
+func cacheKey(resource string, key *meta.Key) string {
+	return resource + "/" + key.String()
+}
+
+// getCached returns the cached object of the version of the resource, if
+// any.
+func getCached(resource string, key *meta.Key, version meta.Version) (interface{}, bool) {
+	if objectCache == nil || !cachedResources.Has(resource) {
+		return nil, false
+	}
+	item, ok, err := objectCache.GetByKey(cacheKey(resource, key))
+	if err != nil || !ok {
+		return nil, false
+	}
+	cached := item.(*cachedObject)
+	if cached.version != version {
+		return nil, false
+	}
+	return cached.obj, true
+}
+
+// setCached caches the object of the version of the resource.
+func setCached(resource string, key *meta.Key, version meta.Version, obj interface{}) {
+	if objectCache == nil || !cachedResources.Has(resource) {
+		return
+	}
+	objectCache.Add(&cachedObject{key: cacheKey(resource, key), version: version, obj: obj})
+}
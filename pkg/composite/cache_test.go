@@ -0,0 +1,86 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"google.golang.org/api/compute/v1"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+func TestCache(t *testing.T) {
+	defer func() { objectCache = nil }()
+	EnableCache(time.Hour)
+
+	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	key := meta.GlobalKey("bs")
+	if err := CreateBackendService(fakeGCE, key, &BackendService{Name: "bs", Description: "created", Version: meta.VersionGA}); err != nil {
+		t.Fatal(err)
+	}
+	// setDescription changes the backend service without going through the
+	// composite functions, so without invalidating the cache.
+	setDescription := func(description string) {
+		mockBS := fakeGCE.Compute().(*cloud.MockGCE).BackendServices().(*cloud.MockBackendServices)
+		mockBS.Objects[*key] = &cloud.MockBackendServicesObj{Obj: &compute.BackendService{Name: "bs", Description: description}}
+	}
+	checkDescription := func(desc string, version meta.Version, want string) {
+		t.Helper()
+		bs, err := GetBackendService(fakeGCE, key, version)
+		if err != nil {
+			t.Fatalf("%s: GetBackendService() = %v", desc, err)
+		}
+		if bs.Description != want {
+			t.Errorf("%s: got description %q, want %q", desc, bs.Description, want)
+		}
+	}
+
+	checkDescription("first get", meta.VersionGA, "created")
+	setDescription("changed")
+	checkDescription("cached", meta.VersionGA, "created")
+	checkDescription("other version", meta.VersionBeta, "changed")
+
+	// The update of the mock is a no-op, only the invalidation matters.
+	setDescription("updated")
+	if err := UpdateBackendService(fakeGCE, key, &BackendService{Name: "bs", Description: "updated", Version: meta.VersionBeta}); err != nil {
+		t.Fatal(err)
+	}
+	checkDescription("invalidated by update", meta.VersionGA, "updated")
+
+	setDescription("changed again")
+	InvalidateCache("BackendService", key)
+	checkDescription("invalidated explicitly", meta.VersionGA, "changed again")
+
+	if err := DeleteBackendService(fakeGCE, key, meta.VersionGA); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetBackendService(fakeGCE, key, meta.VersionGA); err == nil {
+		t.Errorf("GetBackendService() = nil after the backend service was deleted, want error")
+	}
+
+	EnableCache(time.Millisecond)
+	if err := CreateBackendService(fakeGCE, key, &BackendService{Name: "bs", Description: "created", Version: meta.VersionGA}); err != nil {
+		t.Fatal(err)
+	}
+	checkDescription("first get", meta.VersionGA, "created")
+	setDescription("changed")
+	time.Sleep(10 * time.Millisecond)
+	checkDescription("expired", meta.VersionGA, "changed")
+}
@@ -18,12 +18,18 @@ limitations under the License.
 package composite
 
 import (
+	"context"
+	"fmt"
+	"regexp"
+
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 	computealpha "google.golang.org/api/compute/v0.alpha"
 	computebeta "google.golang.org/api/compute/v0.beta"
 	"google.golang.org/api/compute/v1"
 	"k8s.io/ingress-gce/pkg/composite/metrics"
+	"k8s.io/ingress-gce/pkg/restapi"
 	"k8s.io/klog"
 	"k8s.io/legacy-cloud-providers/gce"
 )
@@ -86,6 +92,29 @@ func SetSslCertificateForTargetHttpsProxy(gceCloud *gce.Cloud, key *meta.Key, ta
 	}
 }
 
+// SetQuicOverrideForTargetHttpsProxy() sets the QUIC override for a global
+// target https proxy. The cloud provider library does not expose this call,
+// so the compute API is called directly and the operation polled until done.
+func SetQuicOverrideForTargetHttpsProxy(gceCloud *gce.Cloud, key *meta.Key, targetHttpsProxy *TargetHttpsProxy, quicOverride string) error {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+	mc := metrics.NewMetricContext("TargetHttpsProxy", "set_quic_override", key.Region, key.Zone, string(targetHttpsProxy.Version))
+
+	// Set name in case it is not present in the key
+	key.Name = targetHttpsProxy.Name
+	klog.V(3).Infof("setting QuicOverride %q for TargetHttpsProxy %v", quicOverride, key)
+
+	if key.Type() != meta.Global {
+		return mc.Observe(fmt.Errorf("QuicOverride is only supported for global TargetHttpsProxy, got %v", key))
+	}
+	req := &compute.TargetHttpsProxiesSetQuicOverrideRequest{QuicOverride: quicOverride}
+	op, err := gceCloud.ComputeServices().GA.TargetHttpsProxies.SetQuicOverride(gceCloud.ProjectID(), key.Name, req).Context(ctx).Do()
+	if err != nil {
+		return mc.Observe(err)
+	}
+	return mc.Observe(waitForOperation(ctx, gceCloud, "", op.Name))
+}
+
 // SetUrlMapForTargetHttpProxy() sets the url map for a target proxy
 func SetUrlMapForTargetHttpProxy(gceCloud *gce.Cloud, key *meta.Key, targetHttpProxy *TargetHttpProxy, urlMapLink string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
@@ -151,3 +180,133 @@ func SetProxyForForwardingRule(gceCloud *gce.Cloud, key *meta.Key, forwardingRul
 		}
 	}
 }
+
+// ListForwardingRulesWithPrefix() lists the forwarding rules in the scope of
+// the key whose names start with prefix, filtering them in the API call
+// rather than listing all the forwarding rules of the scope.
+func ListForwardingRulesWithPrefix(gceCloud *gce.Cloud, key *meta.Key, version meta.Version, prefix string) ([]*ForwardingRule, error) {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+	mc := metrics.NewMetricContext("ForwardingRule", "list", key.Region, key.Zone, string(version))
+
+	fl := filter.Regexp("name", regexp.QuoteMeta(prefix)+".*")
+	var gceObjs interface{}
+	var err error
+	switch version {
+	case meta.VersionAlpha:
+		switch key.Type() {
+		case meta.Regional:
+			gceObjs, err = gceCloud.Compute().AlphaForwardingRules().List(ctx, key.Region, fl)
+		default:
+			gceObjs, err = gceCloud.Compute().AlphaGlobalForwardingRules().List(ctx, fl)
+		}
+	case meta.VersionBeta:
+		switch key.Type() {
+		case meta.Regional:
+			gceObjs, err = gceCloud.Compute().BetaForwardingRules().List(ctx, key.Region, fl)
+		default:
+			gceObjs, err = gceCloud.Compute().BetaGlobalForwardingRules().List(ctx, fl)
+		}
+	default:
+		switch key.Type() {
+		case meta.Regional:
+			gceObjs, err = gceCloud.Compute().ForwardingRules().List(ctx, key.Region, fl)
+		default:
+			gceObjs, err = gceCloud.Compute().GlobalForwardingRules().List(ctx, fl)
+		}
+	}
+	if err != nil {
+		return nil, mc.Observe(err)
+	}
+	compositeObjs, err := ToForwardingRuleList(gceObjs)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range compositeObjs {
+		obj.Version = version
+	}
+	return compositeObjs, nil
+}
+
+// SetLabelsForForwardingRule() sets the labels of a forwarding rule. The
+// cloud provider library does not expose this call, so the beta compute API,
+// the first one with labels of forwarding rules, is called directly and the
+// operation polled until done.
+func SetLabelsForForwardingRule(gceCloud *gce.Cloud, key *meta.Key, forwardingRule *ForwardingRule, labels map[string]string) error {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+	mc := metrics.NewMetricContext("ForwardingRule", "set_labels", key.Region, key.Zone, string(meta.VersionBeta))
+
+	// Set name in case it is not present in the key
+	key.Name = forwardingRule.Name
+	klog.V(3).Infof("setting labels %v for ForwardingRule %v", labels, key)
+
+	var op *computebeta.Operation
+	var err error
+	switch key.Type() {
+	case meta.Regional:
+		req := &computebeta.RegionSetLabelsRequest{Labels: labels, LabelFingerprint: forwardingRule.LabelFingerprint}
+		op, err = gceCloud.ComputeServices().Beta.ForwardingRules.SetLabels(gceCloud.ProjectID(), key.Region, key.Name, req).Context(ctx).Do()
+	default:
+		req := &computebeta.GlobalSetLabelsRequest{Labels: labels, LabelFingerprint: forwardingRule.LabelFingerprint}
+		op, err = gceCloud.ComputeServices().Beta.GlobalForwardingRules.SetLabels(gceCloud.ProjectID(), key.Name, req).Context(ctx).Do()
+	}
+	if err != nil {
+		return mc.Observe(err)
+	}
+	return mc.Observe(waitForOperation(ctx, gceCloud, key.Region, op.Name))
+}
+
+// SetAllowGlobalAccessForForwardingRule() sets whether clients in all the
+// regions of the network can reach a regional internal forwarding rule. The
+// cloud provider library does not expose the patch call, so the beta compute
+// API, the first one with the field, is called directly and the operation
+// polled until done.
+func SetAllowGlobalAccessForForwardingRule(gceCloud *gce.Cloud, key *meta.Key, forwardingRule *ForwardingRule, allowGlobalAccess bool) error {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+	mc := metrics.NewMetricContext("ForwardingRule", "patch", key.Region, key.Zone, string(meta.VersionBeta))
+
+	if key.Type() != meta.Regional {
+		return mc.Observe(fmt.Errorf("global access is only supported by regional forwarding rules, not %v", key))
+	}
+	// Set name in case it is not present in the key
+	key.Name = forwardingRule.Name
+	klog.V(3).Infof("setting allowGlobalAccess %t for ForwardingRule %v", allowGlobalAccess, key)
+
+	patch := &computebeta.ForwardingRule{
+		AllowGlobalAccess: allowGlobalAccess,
+		// Send false, which is otherwise omitted as the zero value.
+		ForceSendFields: []string{"AllowGlobalAccess"},
+	}
+	op, err := gceCloud.ComputeServices().Beta.ForwardingRules.Patch(gceCloud.ProjectID(), key.Region, key.Name, patch).Context(ctx).Do()
+	if err != nil {
+		return mc.Observe(err)
+	}
+	return mc.Observe(waitForOperation(ctx, gceCloud, key.Region, op.Name))
+}
+
+// waitForOperation polls the operation with the given name, global if region
+// is empty, until it is done and returns its error, if any.
+func waitForOperation(ctx context.Context, gceCloud *gce.Cloud, region, name string) error {
+	var op *compute.Operation
+	err := restapi.WaitForOperation(name, func() (bool, error) {
+		var err error
+		if region == "" {
+			op, err = gceCloud.ComputeServices().GA.GlobalOperations.Get(gceCloud.ProjectID(), name).Context(ctx).Do()
+		} else {
+			op, err = gceCloud.ComputeServices().GA.RegionOperations.Get(gceCloud.ProjectID(), region, name).Context(ctx).Do()
+		}
+		if err != nil {
+			return false, err
+		}
+		return op.Status == "DONE", nil
+	})
+	if err != nil {
+		return err
+	}
+	if op.Error != nil && len(op.Error.Errors) > 0 {
+		return fmt.Errorf("operation %s failed: %s", op.Name, op.Error.Errors[0].Message)
+	}
+	return nil
+}
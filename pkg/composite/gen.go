@@ -2490,6 +2490,7 @@ type WeightedBackendService struct {
 func CreateBackendService(gceCloud *gce.Cloud, key *meta.Key, backendService *BackendService) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()
+	defer InvalidateCache("BackendService", key)
 	mc := compositemetrics.NewMetricContext("BackendService", "create", key.Region, key.Zone, string(backendService.Version))
 
 	switch backendService.Version {
@@ -2534,6 +2535,7 @@ func CreateBackendService(gceCloud *gce.Cloud, key *meta.Key, backendService *Ba
 func UpdateBackendService(gceCloud *gce.Cloud, key *meta.Key, backendService *BackendService) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()
+	defer InvalidateCache("BackendService", key)
 	mc := compositemetrics.NewMetricContext("BackendService", "update", key.Region, key.Zone, string(backendService.Version))
 	switch backendService.Version {
 	case meta.VersionAlpha:
@@ -2575,6 +2577,7 @@ func UpdateBackendService(gceCloud *gce.Cloud, key *meta.Key, backendService *Ba
 func DeleteBackendService(gceCloud *gce.Cloud, key *meta.Key, version meta.Version) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()
+	defer InvalidateCache("BackendService", key)
 	mc := compositemetrics.NewMetricContext("BackendService", "delete", key.Region, key.Zone, string(version))
 
 	switch version {
@@ -2607,33 +2610,36 @@ func GetBackendService(gceCloud *gce.Cloud, key *meta.Key, version meta.Version)
 	defer cancel()
 	mc := compositemetrics.NewMetricContext("BackendService", "get", key.Region, key.Zone, string(version))
 
-	var gceObj interface{}
+	gceObj, cached := getCached("BackendService", key, version)
 	var err error
-	switch version {
-	case meta.VersionAlpha:
-		switch key.Type() {
-		case meta.Regional:
-			klog.V(3).Infof("Getting alpha region BackendService %v", key.Name)
-			gceObj, err = gceCloud.Compute().AlphaRegionBackendServices().Get(ctx, key)
+	if !cached {
+		switch version {
+		case meta.VersionAlpha:
+			switch key.Type() {
+			case meta.Regional:
+				klog.V(3).Infof("Getting alpha region BackendService %v", key.Name)
+				gceObj, err = gceCloud.Compute().AlphaRegionBackendServices().Get(ctx, key)
+			default:
+				klog.V(3).Infof("Getting alpha BackendService %v", key.Name)
+				gceObj, err = gceCloud.Compute().AlphaBackendServices().Get(ctx, key)
+			}
+		case meta.VersionBeta:
+			switch key.Type() {
+			case meta.Regional:
+				klog.V(3).Infof("Getting beta region BackendService %v", key.Name)
+				gceObj, err = gceCloud.Compute().BetaRegionBackendServices().Get(ctx, key)
+			default:
+				klog.V(3).Infof("Getting beta BackendService %v", key.Name)
+				gceObj, err = gceCloud.Compute().BetaBackendServices().Get(ctx, key)
+			}
 		default:
-			klog.V(3).Infof("Getting alpha BackendService %v", key.Name)
-			gceObj, err = gceCloud.Compute().AlphaBackendServices().Get(ctx, key)
+			klog.V(3).Infof("Getting ga BackendService %v", key.Name)
+			gceObj, err = gceCloud.Compute().BackendServices().Get(ctx, key)
 		}
-	case meta.VersionBeta:
-		switch key.Type() {
-		case meta.Regional:
-			klog.V(3).Infof("Getting beta region BackendService %v", key.Name)
-			gceObj, err = gceCloud.Compute().BetaRegionBackendServices().Get(ctx, key)
-		default:
-			klog.V(3).Infof("Getting beta BackendService %v", key.Name)
-			gceObj, err = gceCloud.Compute().BetaBackendServices().Get(ctx, key)
+		if err != nil {
+			return nil, mc.Observe(err)
 		}
-	default:
-		klog.V(3).Infof("Getting ga BackendService %v", key.Name)
-		gceObj, err = gceCloud.Compute().BackendServices().Get(ctx, key)
-	}
-	if err != nil {
-		return nil, mc.Observe(err)
+		setCached("BackendService", key, version, gceObj)
 	}
 	compositeType, err := ToBackendService(gceObj)
 	if err != nil {
@@ -2772,6 +2778,7 @@ func (backendService *BackendService) ToGA() (*compute.BackendService, error) {
 func CreateForwardingRule(gceCloud *gce.Cloud, key *meta.Key, forwardingRule *ForwardingRule) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()
+	defer InvalidateCache("ForwardingRule", key)
 	mc := compositemetrics.NewMetricContext("ForwardingRule", "create", key.Region, key.Zone, string(forwardingRule.Version))
 
 	switch forwardingRule.Version {
@@ -2823,39 +2830,42 @@ func GetForwardingRule(gceCloud *gce.Cloud, key *meta.Key, version meta.Version)
 	defer cancel()
 	mc := compositemetrics.NewMetricContext("ForwardingRule", "get", key.Region, key.Zone, string(version))
 
-	var gceObj interface{}
+	gceObj, cached := getCached("ForwardingRule", key, version)
 	var err error
-	switch version {
-	case meta.VersionAlpha:
-		switch key.Type() {
-		case meta.Regional:
-			klog.V(3).Infof("Getting alpha region ForwardingRule %v", key.Name)
-			gceObj, err = gceCloud.Compute().AlphaForwardingRules().Get(ctx, key)
-		default:
-			klog.V(3).Infof("Getting alpha ForwardingRule %v", key.Name)
-			gceObj, err = gceCloud.Compute().AlphaGlobalForwardingRules().Get(ctx, key)
-		}
-	case meta.VersionBeta:
-		switch key.Type() {
-		case meta.Regional:
-			klog.V(3).Infof("Getting beta region ForwardingRule %v", key.Name)
-			gceObj, err = gceCloud.Compute().BetaForwardingRules().Get(ctx, key)
+	if !cached {
+		switch version {
+		case meta.VersionAlpha:
+			switch key.Type() {
+			case meta.Regional:
+				klog.V(3).Infof("Getting alpha region ForwardingRule %v", key.Name)
+				gceObj, err = gceCloud.Compute().AlphaForwardingRules().Get(ctx, key)
+			default:
+				klog.V(3).Infof("Getting alpha ForwardingRule %v", key.Name)
+				gceObj, err = gceCloud.Compute().AlphaGlobalForwardingRules().Get(ctx, key)
+			}
+		case meta.VersionBeta:
+			switch key.Type() {
+			case meta.Regional:
+				klog.V(3).Infof("Getting beta region ForwardingRule %v", key.Name)
+				gceObj, err = gceCloud.Compute().BetaForwardingRules().Get(ctx, key)
+			default:
+				klog.V(3).Infof("Getting beta ForwardingRule %v", key.Name)
+				gceObj, err = gceCloud.Compute().BetaGlobalForwardingRules().Get(ctx, key)
+			}
 		default:
-			klog.V(3).Infof("Getting beta ForwardingRule %v", key.Name)
-			gceObj, err = gceCloud.Compute().BetaGlobalForwardingRules().Get(ctx, key)
+			switch key.Type() {
+			case meta.Regional:
+				klog.V(3).Infof("Getting ga region ForwardingRule %v", key.Name)
+				gceObj, err = gceCloud.Compute().ForwardingRules().Get(ctx, key)
+			default:
+				klog.V(3).Infof("Getting ga ForwardingRule %v", key.Name)
+				gceObj, err = gceCloud.Compute().GlobalForwardingRules().Get(ctx, key)
+			}
 		}
-	default:
-		switch key.Type() {
-		case meta.Regional:
-			klog.V(3).Infof("Getting ga region ForwardingRule %v", key.Name)
-			gceObj, err = gceCloud.Compute().ForwardingRules().Get(ctx, key)
-		default:
-			klog.V(3).Infof("Getting ga ForwardingRule %v", key.Name)
-			gceObj, err = gceCloud.Compute().GlobalForwardingRules().Get(ctx, key)
+		if err != nil {
+			return nil, mc.Observe(err)
 		}
-	}
-	if err != nil {
-		return nil, mc.Observe(err)
+		setCached("ForwardingRule", key, version, gceObj)
 	}
 	compositeType, err := ToForwardingRule(gceObj)
 	if err != nil {
@@ -2922,6 +2932,7 @@ func ListForwardingRules(gceCloud *gce.Cloud, key *meta.Key, version meta.Versio
 func DeleteForwardingRule(gceCloud *gce.Cloud, key *meta.Key, version meta.Version) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()
+	defer InvalidateCache("ForwardingRule", key)
 	mc := compositemetrics.NewMetricContext("ForwardingRule", "delete", key.Region, key.Zone, string(version))
 
 	switch version {
@@ -3018,6 +3029,7 @@ func (forwardingRule *ForwardingRule) ToGA() (*compute.ForwardingRule, error) {
 func CreateHealthCheck(gceCloud *gce.Cloud, key *meta.Key, healthCheck *HealthCheck) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()
+	defer InvalidateCache("HealthCheck", key)
 	mc := compositemetrics.NewMetricContext("HealthCheck", "create", key.Region, key.Zone, string(healthCheck.Version))
 
 	switch healthCheck.Version {
@@ -3062,6 +3074,7 @@ func CreateHealthCheck(gceCloud *gce.Cloud, key *meta.Key, healthCheck *HealthCh
 func UpdateHealthCheck(gceCloud *gce.Cloud, key *meta.Key, healthCheck *HealthCheck) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()
+	defer InvalidateCache("HealthCheck", key)
 	mc := compositemetrics.NewMetricContext("HealthCheck", "update", key.Region, key.Zone, string(healthCheck.Version))
 	switch healthCheck.Version {
 	case meta.VersionAlpha:
@@ -3103,6 +3116,7 @@ func UpdateHealthCheck(gceCloud *gce.Cloud, key *meta.Key, healthCheck *HealthCh
 func DeleteHealthCheck(gceCloud *gce.Cloud, key *meta.Key, version meta.Version) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()
+	defer InvalidateCache("HealthCheck", key)
 	mc := compositemetrics.NewMetricContext("HealthCheck", "delete", key.Region, key.Zone, string(version))
 
 	switch version {
@@ -3135,33 +3149,36 @@ func GetHealthCheck(gceCloud *gce.Cloud, key *meta.Key, version meta.Version) (*
 	defer cancel()
 	mc := compositemetrics.NewMetricContext("HealthCheck", "get", key.Region, key.Zone, string(version))
 
-	var gceObj interface{}
+	gceObj, cached := getCached("HealthCheck", key, version)
 	var err error
-	switch version {
-	case meta.VersionAlpha:
-		switch key.Type() {
-		case meta.Regional:
-			klog.V(3).Infof("Getting alpha region HealthCheck %v", key.Name)
-			gceObj, err = gceCloud.Compute().AlphaRegionHealthChecks().Get(ctx, key)
+	if !cached {
+		switch version {
+		case meta.VersionAlpha:
+			switch key.Type() {
+			case meta.Regional:
+				klog.V(3).Infof("Getting alpha region HealthCheck %v", key.Name)
+				gceObj, err = gceCloud.Compute().AlphaRegionHealthChecks().Get(ctx, key)
+			default:
+				klog.V(3).Infof("Getting alpha HealthCheck %v", key.Name)
+				gceObj, err = gceCloud.Compute().AlphaHealthChecks().Get(ctx, key)
+			}
+		case meta.VersionBeta:
+			switch key.Type() {
+			case meta.Regional:
+				klog.V(3).Infof("Getting beta region HealthCheck %v", key.Name)
+				gceObj, err = gceCloud.Compute().BetaRegionHealthChecks().Get(ctx, key)
+			default:
+				klog.V(3).Infof("Getting beta HealthCheck %v", key.Name)
+				gceObj, err = gceCloud.Compute().BetaHealthChecks().Get(ctx, key)
+			}
 		default:
-			klog.V(3).Infof("Getting alpha HealthCheck %v", key.Name)
-			gceObj, err = gceCloud.Compute().AlphaHealthChecks().Get(ctx, key)
+			klog.V(3).Infof("Getting ga HealthCheck %v", key.Name)
+			gceObj, err = gceCloud.Compute().HealthChecks().Get(ctx, key)
 		}
-	case meta.VersionBeta:
-		switch key.Type() {
-		case meta.Regional:
-			klog.V(3).Infof("Getting beta region HealthCheck %v", key.Name)
-			gceObj, err = gceCloud.Compute().BetaRegionHealthChecks().Get(ctx, key)
-		default:
-			klog.V(3).Infof("Getting beta HealthCheck %v", key.Name)
-			gceObj, err = gceCloud.Compute().BetaHealthChecks().Get(ctx, key)
+		if err != nil {
+			return nil, mc.Observe(err)
 		}
-	default:
-		klog.V(3).Infof("Getting ga HealthCheck %v", key.Name)
-		gceObj, err = gceCloud.Compute().HealthChecks().Get(ctx, key)
-	}
-	if err != nil {
-		return nil, mc.Observe(err)
+		setCached("HealthCheck", key, version, gceObj)
 	}
 	compositeType, err := ToHealthCheck(gceObj)
 	if err != nil {
@@ -3279,6 +3296,7 @@ func (healthCheck *HealthCheck) ToGA() (*compute.HealthCheck, error) {
 func CreateSslCertificate(gceCloud *gce.Cloud, key *meta.Key, sslCertificate *SslCertificate) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()
+	defer InvalidateCache("SslCertificate", key)
 	mc := compositemetrics.NewMetricContext("SslCertificate", "create", key.Region, key.Zone, string(sslCertificate.Version))
 
 	switch sslCertificate.Version {
@@ -3323,6 +3341,7 @@ func CreateSslCertificate(gceCloud *gce.Cloud, key *meta.Key, sslCertificate *Ss
 func DeleteSslCertificate(gceCloud *gce.Cloud, key *meta.Key, version meta.Version) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()
+	defer InvalidateCache("SslCertificate", key)
 	mc := compositemetrics.NewMetricContext("SslCertificate", "delete", key.Region, key.Zone, string(version))
 
 	switch version {
@@ -3355,33 +3374,36 @@ func GetSslCertificate(gceCloud *gce.Cloud, key *meta.Key, version meta.Version)
 	defer cancel()
 	mc := compositemetrics.NewMetricContext("SslCertificate", "get", key.Region, key.Zone, string(version))
 
-	var gceObj interface{}
+	gceObj, cached := getCached("SslCertificate", key, version)
 	var err error
-	switch version {
-	case meta.VersionAlpha:
-		switch key.Type() {
-		case meta.Regional:
-			klog.V(3).Infof("Getting alpha region SslCertificate %v", key.Name)
-			gceObj, err = gceCloud.Compute().AlphaRegionSslCertificates().Get(ctx, key)
+	if !cached {
+		switch version {
+		case meta.VersionAlpha:
+			switch key.Type() {
+			case meta.Regional:
+				klog.V(3).Infof("Getting alpha region SslCertificate %v", key.Name)
+				gceObj, err = gceCloud.Compute().AlphaRegionSslCertificates().Get(ctx, key)
+			default:
+				klog.V(3).Infof("Getting alpha SslCertificate %v", key.Name)
+				gceObj, err = gceCloud.Compute().AlphaSslCertificates().Get(ctx, key)
+			}
+		case meta.VersionBeta:
+			switch key.Type() {
+			case meta.Regional:
+				klog.V(3).Infof("Getting beta region SslCertificate %v", key.Name)
+				gceObj, err = gceCloud.Compute().BetaRegionSslCertificates().Get(ctx, key)
+			default:
+				klog.V(3).Infof("Getting beta SslCertificate %v", key.Name)
+				gceObj, err = gceCloud.Compute().BetaSslCertificates().Get(ctx, key)
+			}
 		default:
-			klog.V(3).Infof("Getting alpha SslCertificate %v", key.Name)
-			gceObj, err = gceCloud.Compute().AlphaSslCertificates().Get(ctx, key)
+			klog.V(3).Infof("Getting ga SslCertificate %v", key.Name)
+			gceObj, err = gceCloud.Compute().SslCertificates().Get(ctx, key)
 		}
-	case meta.VersionBeta:
-		switch key.Type() {
-		case meta.Regional:
-			klog.V(3).Infof("Getting beta region SslCertificate %v", key.Name)
-			gceObj, err = gceCloud.Compute().BetaRegionSslCertificates().Get(ctx, key)
-		default:
-			klog.V(3).Infof("Getting beta SslCertificate %v", key.Name)
-			gceObj, err = gceCloud.Compute().BetaSslCertificates().Get(ctx, key)
+		if err != nil {
+			return nil, mc.Observe(err)
 		}
-	default:
-		klog.V(3).Infof("Getting ga SslCertificate %v", key.Name)
-		gceObj, err = gceCloud.Compute().SslCertificates().Get(ctx, key)
-	}
-	if err != nil {
-		return nil, mc.Observe(err)
+		setCached("SslCertificate", key, version, gceObj)
 	}
 	compositeType, err := ToSslCertificate(gceObj)
 	if err != nil {
@@ -3499,6 +3521,7 @@ func (sslCertificate *SslCertificate) ToGA() (*compute.SslCertificate, error) {
 func CreateTargetHttpProxy(gceCloud *gce.Cloud, key *meta.Key, targetHttpProxy *TargetHttpProxy) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()
+	defer InvalidateCache("TargetHttpProxy", key)
 	mc := compositemetrics.NewMetricContext("TargetHttpProxy", "create", key.Region, key.Zone, string(targetHttpProxy.Version))
 
 	switch targetHttpProxy.Version {
@@ -3543,6 +3566,7 @@ func CreateTargetHttpProxy(gceCloud *gce.Cloud, key *meta.Key, targetHttpProxy *
 func DeleteTargetHttpProxy(gceCloud *gce.Cloud, key *meta.Key, version meta.Version) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()
+	defer InvalidateCache("TargetHttpProxy", key)
 	mc := compositemetrics.NewMetricContext("TargetHttpProxy", "delete", key.Region, key.Zone, string(version))
 
 	switch version {
@@ -3575,33 +3599,36 @@ func GetTargetHttpProxy(gceCloud *gce.Cloud, key *meta.Key, version meta.Version
 	defer cancel()
 	mc := compositemetrics.NewMetricContext("TargetHttpProxy", "get", key.Region, key.Zone, string(version))
 
-	var gceObj interface{}
+	gceObj, cached := getCached("TargetHttpProxy", key, version)
 	var err error
-	switch version {
-	case meta.VersionAlpha:
-		switch key.Type() {
-		case meta.Regional:
-			klog.V(3).Infof("Getting alpha region TargetHttpProxy %v", key.Name)
-			gceObj, err = gceCloud.Compute().AlphaRegionTargetHttpProxies().Get(ctx, key)
+	if !cached {
+		switch version {
+		case meta.VersionAlpha:
+			switch key.Type() {
+			case meta.Regional:
+				klog.V(3).Infof("Getting alpha region TargetHttpProxy %v", key.Name)
+				gceObj, err = gceCloud.Compute().AlphaRegionTargetHttpProxies().Get(ctx, key)
+			default:
+				klog.V(3).Infof("Getting alpha TargetHttpProxy %v", key.Name)
+				gceObj, err = gceCloud.Compute().AlphaTargetHttpProxies().Get(ctx, key)
+			}
+		case meta.VersionBeta:
+			switch key.Type() {
+			case meta.Regional:
+				klog.V(3).Infof("Getting beta region TargetHttpProxy %v", key.Name)
+				gceObj, err = gceCloud.Compute().BetaRegionTargetHttpProxies().Get(ctx, key)
+			default:
+				klog.V(3).Infof("Getting beta TargetHttpProxy %v", key.Name)
+				gceObj, err = gceCloud.Compute().BetaTargetHttpProxies().Get(ctx, key)
+			}
 		default:
-			klog.V(3).Infof("Getting alpha TargetHttpProxy %v", key.Name)
-			gceObj, err = gceCloud.Compute().AlphaTargetHttpProxies().Get(ctx, key)
+			klog.V(3).Infof("Getting ga TargetHttpProxy %v", key.Name)
+			gceObj, err = gceCloud.Compute().TargetHttpProxies().Get(ctx, key)
 		}
-	case meta.VersionBeta:
-		switch key.Type() {
-		case meta.Regional:
-			klog.V(3).Infof("Getting beta region TargetHttpProxy %v", key.Name)
-			gceObj, err = gceCloud.Compute().BetaRegionTargetHttpProxies().Get(ctx, key)
-		default:
-			klog.V(3).Infof("Getting beta TargetHttpProxy %v", key.Name)
-			gceObj, err = gceCloud.Compute().BetaTargetHttpProxies().Get(ctx, key)
+		if err != nil {
+			return nil, mc.Observe(err)
 		}
-	default:
-		klog.V(3).Infof("Getting ga TargetHttpProxy %v", key.Name)
-		gceObj, err = gceCloud.Compute().TargetHttpProxies().Get(ctx, key)
-	}
-	if err != nil {
-		return nil, mc.Observe(err)
+		setCached("TargetHttpProxy", key, version, gceObj)
 	}
 	compositeType, err := ToTargetHttpProxy(gceObj)
 	if err != nil {
@@ -3719,6 +3746,7 @@ func (targetHttpProxy *TargetHttpProxy) ToGA() (*compute.TargetHttpProxy, error)
 func CreateTargetHttpsProxy(gceCloud *gce.Cloud, key *meta.Key, targetHttpsProxy *TargetHttpsProxy) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()
+	defer InvalidateCache("TargetHttpsProxy", key)
 	mc := compositemetrics.NewMetricContext("TargetHttpsProxy", "create", key.Region, key.Zone, string(targetHttpsProxy.Version))
 
 	switch targetHttpsProxy.Version {
@@ -3763,6 +3791,7 @@ func CreateTargetHttpsProxy(gceCloud *gce.Cloud, key *meta.Key, targetHttpsProxy
 func DeleteTargetHttpsProxy(gceCloud *gce.Cloud, key *meta.Key, version meta.Version) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()
+	defer InvalidateCache("TargetHttpsProxy", key)
 	mc := compositemetrics.NewMetricContext("TargetHttpsProxy", "delete", key.Region, key.Zone, string(version))
 
 	switch version {
@@ -3795,33 +3824,36 @@ func GetTargetHttpsProxy(gceCloud *gce.Cloud, key *meta.Key, version meta.Versio
 	defer cancel()
 	mc := compositemetrics.NewMetricContext("TargetHttpsProxy", "get", key.Region, key.Zone, string(version))
 
-	var gceObj interface{}
+	gceObj, cached := getCached("TargetHttpsProxy", key, version)
 	var err error
-	switch version {
-	case meta.VersionAlpha:
-		switch key.Type() {
-		case meta.Regional:
-			klog.V(3).Infof("Getting alpha region TargetHttpsProxy %v", key.Name)
-			gceObj, err = gceCloud.Compute().AlphaRegionTargetHttpsProxies().Get(ctx, key)
+	if !cached {
+		switch version {
+		case meta.VersionAlpha:
+			switch key.Type() {
+			case meta.Regional:
+				klog.V(3).Infof("Getting alpha region TargetHttpsProxy %v", key.Name)
+				gceObj, err = gceCloud.Compute().AlphaRegionTargetHttpsProxies().Get(ctx, key)
+			default:
+				klog.V(3).Infof("Getting alpha TargetHttpsProxy %v", key.Name)
+				gceObj, err = gceCloud.Compute().AlphaTargetHttpsProxies().Get(ctx, key)
+			}
+		case meta.VersionBeta:
+			switch key.Type() {
+			case meta.Regional:
+				klog.V(3).Infof("Getting beta region TargetHttpsProxy %v", key.Name)
+				gceObj, err = gceCloud.Compute().BetaRegionTargetHttpsProxies().Get(ctx, key)
+			default:
+				klog.V(3).Infof("Getting beta TargetHttpsProxy %v", key.Name)
+				gceObj, err = gceCloud.Compute().BetaTargetHttpsProxies().Get(ctx, key)
+			}
 		default:
-			klog.V(3).Infof("Getting alpha TargetHttpsProxy %v", key.Name)
-			gceObj, err = gceCloud.Compute().AlphaTargetHttpsProxies().Get(ctx, key)
+			klog.V(3).Infof("Getting ga TargetHttpsProxy %v", key.Name)
+			gceObj, err = gceCloud.Compute().TargetHttpsProxies().Get(ctx, key)
 		}
-	case meta.VersionBeta:
-		switch key.Type() {
-		case meta.Regional:
-			klog.V(3).Infof("Getting beta region TargetHttpsProxy %v", key.Name)
-			gceObj, err = gceCloud.Compute().BetaRegionTargetHttpsProxies().Get(ctx, key)
-		default:
-			klog.V(3).Infof("Getting beta TargetHttpsProxy %v", key.Name)
-			gceObj, err = gceCloud.Compute().BetaTargetHttpsProxies().Get(ctx, key)
+		if err != nil {
+			return nil, mc.Observe(err)
 		}
-	default:
-		klog.V(3).Infof("Getting ga TargetHttpsProxy %v", key.Name)
-		gceObj, err = gceCloud.Compute().TargetHttpsProxies().Get(ctx, key)
-	}
-	if err != nil {
-		return nil, mc.Observe(err)
+		setCached("TargetHttpsProxy", key, version, gceObj)
 	}
 	compositeType, err := ToTargetHttpsProxy(gceObj)
 	if err != nil {
@@ -3939,6 +3971,7 @@ func (targetHttpsProxy *TargetHttpsProxy) ToGA() (*compute.TargetHttpsProxy, err
 func CreateUrlMap(gceCloud *gce.Cloud, key *meta.Key, urlMap *UrlMap) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()
+	defer InvalidateCache("UrlMap", key)
 	mc := compositemetrics.NewMetricContext("UrlMap", "create", key.Region, key.Zone, string(urlMap.Version))
 
 	switch urlMap.Version {
@@ -3983,6 +4016,7 @@ func CreateUrlMap(gceCloud *gce.Cloud, key *meta.Key, urlMap *UrlMap) error {
 func UpdateUrlMap(gceCloud *gce.Cloud, key *meta.Key, urlMap *UrlMap) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()
+	defer InvalidateCache("UrlMap", key)
 	mc := compositemetrics.NewMetricContext("UrlMap", "update", key.Region, key.Zone, string(urlMap.Version))
 	switch urlMap.Version {
 	case meta.VersionAlpha:
@@ -4024,6 +4058,7 @@ func UpdateUrlMap(gceCloud *gce.Cloud, key *meta.Key, urlMap *UrlMap) error {
 func DeleteUrlMap(gceCloud *gce.Cloud, key *meta.Key, version meta.Version) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()
+	defer InvalidateCache("UrlMap", key)
 	mc := compositemetrics.NewMetricContext("UrlMap", "delete", key.Region, key.Zone, string(version))
 
 	switch version {
@@ -4056,33 +4091,36 @@ func GetUrlMap(gceCloud *gce.Cloud, key *meta.Key, version meta.Version) (*UrlMa
 	defer cancel()
 	mc := compositemetrics.NewMetricContext("UrlMap", "get", key.Region, key.Zone, string(version))
 
-	var gceObj interface{}
+	gceObj, cached := getCached("UrlMap", key, version)
 	var err error
-	switch version {
-	case meta.VersionAlpha:
-		switch key.Type() {
-		case meta.Regional:
-			klog.V(3).Infof("Getting alpha region UrlMap %v", key.Name)
-			gceObj, err = gceCloud.Compute().AlphaRegionUrlMaps().Get(ctx, key)
+	if !cached {
+		switch version {
+		case meta.VersionAlpha:
+			switch key.Type() {
+			case meta.Regional:
+				klog.V(3).Infof("Getting alpha region UrlMap %v", key.Name)
+				gceObj, err = gceCloud.Compute().AlphaRegionUrlMaps().Get(ctx, key)
+			default:
+				klog.V(3).Infof("Getting alpha UrlMap %v", key.Name)
+				gceObj, err = gceCloud.Compute().AlphaUrlMaps().Get(ctx, key)
+			}
+		case meta.VersionBeta:
+			switch key.Type() {
+			case meta.Regional:
+				klog.V(3).Infof("Getting beta region UrlMap %v", key.Name)
+				gceObj, err = gceCloud.Compute().BetaRegionUrlMaps().Get(ctx, key)
+			default:
+				klog.V(3).Infof("Getting beta UrlMap %v", key.Name)
+				gceObj, err = gceCloud.Compute().BetaUrlMaps().Get(ctx, key)
+			}
 		default:
-			klog.V(3).Infof("Getting alpha UrlMap %v", key.Name)
-			gceObj, err = gceCloud.Compute().AlphaUrlMaps().Get(ctx, key)
+			klog.V(3).Infof("Getting ga UrlMap %v", key.Name)
+			gceObj, err = gceCloud.Compute().UrlMaps().Get(ctx, key)
 		}
-	case meta.VersionBeta:
-		switch key.Type() {
-		case meta.Regional:
-			klog.V(3).Infof("Getting beta region UrlMap %v", key.Name)
-			gceObj, err = gceCloud.Compute().BetaRegionUrlMaps().Get(ctx, key)
-		default:
-			klog.V(3).Infof("Getting beta UrlMap %v", key.Name)
-			gceObj, err = gceCloud.Compute().BetaUrlMaps().Get(ctx, key)
+		if err != nil {
+			return nil, mc.Observe(err)
 		}
-	default:
-		klog.V(3).Infof("Getting ga UrlMap %v", key.Name)
-		gceObj, err = gceCloud.Compute().UrlMaps().Get(ctx, key)
-	}
-	if err != nil {
-		return nil, mc.Observe(err)
+		setCached("UrlMap", key, version, gceObj)
 	}
 	compositeType, err := ToUrlMap(gceObj)
 	if err != nil {
@@ -204,6 +204,7 @@ func genFuncs(wr io.Writer) {
   func Create{{.Name}}(gceCloud *gce.Cloud, key *meta.Key, {{.VarName}} *{{.Name}}) error {
 		ctx, cancel := cloudprovider.ContextWithCallTimeout()
 		defer cancel()
+		defer InvalidateCache("{{.Name}}", key)
   	mc := compositemetrics.NewMetricContext("{{.Name}}", "create", key.Region, key.Zone, string({{.VarName}}.Version))
 
 		switch {{.VarName}}.Version {
@@ -253,6 +254,7 @@ func genFuncs(wr io.Writer) {
 func Update{{.Name}}(gceCloud *gce.Cloud, key *meta.Key, {{.VarName}} *{{.Name}}) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()	
+	defer InvalidateCache("{{.Name}}", key)
   mc := compositemetrics.NewMetricContext("{{.Name}}", "update", key.Region, key.Zone, string({{.VarName}}.Version))
 
 	switch {{.VarName}}.Version {
@@ -303,8 +305,9 @@ func Get{{.Name}}(gceCloud *gce.Cloud, key *meta.Key, version meta.Version) (*{{
 	defer cancel()	
   mc := compositemetrics.NewMetricContext("{{.Name}}", "get", key.Region, key.Zone, string(version))
 
-	var gceObj interface{}
+	gceObj, cached := getCached("{{.Name}}", key, version)
 	var err error
+	if !cached {
 	switch version {
 	case meta.VersionAlpha:
 		switch key.Type() {
@@ -337,6 +340,8 @@ func Get{{.Name}}(gceCloud *gce.Cloud, key *meta.Key, version meta.Version) (*{{
 	if err != nil {
 		return nil, mc.Observe(err)
 	}
+	setCached("{{.Name}}", key, version, gceObj)
+	}
 	compositeType, err := To{{.Name}}(gceObj)
   if err != nil {
     return nil, err
@@ -402,6 +407,7 @@ func List{{.GetCloudProviderName}}(gceCloud *gce.Cloud, key *meta.Key, version m
 func Delete{{.Name}}(gceCloud *gce.Cloud, key *meta.Key, version meta.Version) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()	
+	defer InvalidateCache("{{.Name}}", key)
   mc := compositemetrics.NewMetricContext("{{.Name}}", "delete", key.Region, key.Zone, string(version))
 
 	switch version {
@@ -451,6 +457,7 @@ func To{{.Name}}List(objs interface{}) ([]*{{.Name}}, error) {
 func Create{{.Name}}(gceCloud *gce.Cloud, key *meta.Key, {{.VarName}} *{{.Name}}) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()
+	defer InvalidateCache("{{.Name}}", key)
   mc := compositemetrics.NewMetricContext("{{.Name}}", "create", key.Region, key.Zone, string({{.VarName}}.Version))
 
 	switch {{.VarName}}.Version {
@@ -496,6 +503,7 @@ func Create{{.Name}}(gceCloud *gce.Cloud, key *meta.Key, {{.VarName}} *{{.Name}}
 func Update{{.Name}}(gceCloud *gce.Cloud, key *meta.Key, {{.VarName}} *{{.Name}}) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()	
+	defer InvalidateCache("{{.Name}}", key)
   mc := compositemetrics.NewMetricContext("{{.Name}}", "update", key.Region, key.Zone, string({{.VarName}}.Version))
 	switch {{.VarName}}.Version {
 	case meta.VersionAlpha:
@@ -538,6 +546,7 @@ func Update{{.Name}}(gceCloud *gce.Cloud, key *meta.Key, {{.VarName}} *{{.Name}}
 func Delete{{.Name}}(gceCloud *gce.Cloud, key *meta.Key, version meta.Version) error {
 	ctx, cancel := cloudprovider.ContextWithCallTimeout()
 	defer cancel()	
+	defer InvalidateCache("{{.Name}}", key)
   mc := compositemetrics.NewMetricContext("{{.Name}}", "delete", key.Region, key.Zone, string(version))
 
 	switch version {
@@ -570,8 +579,9 @@ func Get{{.Name}}(gceCloud *gce.Cloud, key *meta.Key, version meta.Version) (*{{
 	defer cancel()	
   mc := compositemetrics.NewMetricContext("{{.Name}}", "get", key.Region, key.Zone, string(version))
 
-	var gceObj interface{}
+	gceObj, cached := getCached("{{.Name}}", key, version)
 	var err error
+	if !cached {
 	switch version {
 	case meta.VersionAlpha:
 		switch key.Type() {
@@ -598,6 +608,8 @@ func Get{{.Name}}(gceCloud *gce.Cloud, key *meta.Key, version meta.Version) (*{{
 	if err != nil {
 		return nil, mc.Observe(err)
 	}
+	setCached("{{.Name}}", key, version, gceObj)
+	}
 	compositeType, err := To{{.Name}}(gceObj)
   if err != nil {
     return nil, err
@@ -14,10 +14,12 @@ limitations under the License.
 package context
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/api/networking/v1beta1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamicinformer"
@@ -28,11 +30,21 @@ import (
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/ingress-gce/pkg/alerting"
+	diagnosticreportv1beta1 "k8s.io/ingress-gce/pkg/apis/diagnosticreport/v1beta1"
+	firewallsuggestionv1beta1 "k8s.io/ingress-gce/pkg/apis/firewallsuggestion/v1beta1"
+	retainedloadbalancerv1beta1 "k8s.io/ingress-gce/pkg/apis/retainedloadbalancer/v1beta1"
 	backendconfigclient "k8s.io/ingress-gce/pkg/backendconfig/client/clientset/versioned"
 	informerbackendconfig "k8s.io/ingress-gce/pkg/backendconfig/client/informers/externalversions/backendconfig/v1beta1"
 	"k8s.io/ingress-gce/pkg/common/typed"
+	"k8s.io/ingress-gce/pkg/firewallpolicy"
 	frontendconfigclient "k8s.io/ingress-gce/pkg/frontendconfig/client/clientset/versioned"
 	informerfrontendconfig "k8s.io/ingress-gce/pkg/frontendconfig/client/informers/externalversions/frontendconfig/v1beta1"
+	"k8s.io/ingress-gce/pkg/identity"
+	"k8s.io/ingress-gce/pkg/ingressclass"
+	"k8s.io/ingress-gce/pkg/operations"
+	"k8s.io/ingress-gce/pkg/quota"
+	"k8s.io/ingress-gce/pkg/targetproxy"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/ingress-gce/pkg/utils/namer"
 	"k8s.io/klog"
@@ -48,10 +60,43 @@ const (
 type ControllerContext struct {
 	KubeClient            kubernetes.Interface
 	DestinationRuleClient dynamic.NamespaceableResourceInterface
+	// ServiceEntryClient manages the Istio ServiceEntries, nil unless CSM is
+	// enabled.
+	ServiceEntryClient dynamic.NamespaceableResourceInterface
+	// FirewallSuggestionClient manages the FirewallSuggestions of the firewall
+	// changes which must be made in the network project. Nil if disabled.
+	FirewallSuggestionClient dynamic.ResourceInterface
+	// DiagnosticReportClient manages the DiagnosticReport written by the
+	// self-diagnosis. Nil if disabled.
+	DiagnosticReportClient dynamic.ResourceInterface
+	// RetainedLoadBalancerClient manages the RetainedLoadBalancers recording
+	// the load balancers retained after their Ingress was deleted, which are
+	// read from RetainedLoadBalancerInformer. Both are nil if disabled.
+	RetainedLoadBalancerClient   dynamic.NamespaceableResourceInterface
+	RetainedLoadBalancerInformer cache.SharedIndexInformer
+	// FirewallPolicyClient manages the rules of the network firewall policy
+	// used instead of VPC firewall rules. Nil if disabled.
+	FirewallPolicyClient firewallpolicy.Client
 
 	Cloud *gce.Cloud
-
-	ClusterNamer *namer.Namer
+	// AlertPolicyClient manages the Cloud Monitoring alert policies configured
+	// in BackendConfigs. Nil if disabled.
+	AlertPolicyClient alerting.Client
+	// TargetProxyClient manages the settings of target proxies configured in
+	// FrontendConfigs which the compute API version in use does not expose.
+	// Nil if disabled.
+	TargetProxyClient targetproxy.Client
+	// Quota checks the resources to create against the quotas of the
+	// project. Nil if disabled.
+	Quota *quota.Checker
+	// Operations tracks the GCE operations started without waiting for
+	// them. Nil if disabled.
+	Operations *operations.Tracker
+	// NamespaceClouds provides the clients used for mutations on the
+	// resources of the Ingresses of a namespace. Nil if Cloud is used for all.
+	NamespaceClouds identity.CloudProvider
+
+	ClusterNamer namer.IngressNamer
 
 	ControllerContextConfig
 
@@ -63,8 +108,27 @@ type ControllerContext struct {
 	NodeInformer            cache.SharedIndexInformer
 	EndpointInformer        cache.SharedIndexInformer
 	DestinationRuleInformer cache.SharedIndexInformer
-
-	healthChecks map[string]func() error
+	ServiceEntryInformer    cache.SharedIndexInformer
+	// IngressClassInformer and GCPIngressParamsInformer watch the cluster
+	// scoped IngressClasses and their parameters, nil if disabled.
+	IngressClassInformer     cache.SharedIndexInformer
+	GCPIngressParamsInformer cache.SharedIndexInformer
+	// IngressClasses resolves the IngressClasses of Ingresses from these
+	// informers, nil if disabled.
+	IngressClasses utils.IngressClassLookup
+	// IngressSource provides the Ingresses translated from Gateways, nil if
+	// disabled.
+	IngressSource IngressSource
+	// Shard decides the namespaces whose Ingresses are synced by this
+	// replica, nil if all are.
+	Shard Shard
+
+	healthChecks    map[string]func() error
+	readinessChecks map[string]func() error
+	// caches are the informers whose staleness is checked.
+	caches []*trackedCache
+	// shutdownHooks are called on graceful shutdown.
+	shutdownHooks []func()
 
 	lock sync.Mutex
 
@@ -82,6 +146,45 @@ type ControllerContextConfig struct {
 	DefaultBackendHealthCheckPath string
 	FrontendConfigEnabled         bool
 	EnableCSM                     bool
+	// FirewallSuggestionNamespace is the namespace of the FirewallSuggestions.
+	// FirewallSuggestions are not written if empty.
+	FirewallSuggestionNamespace string
+	// EnableIngressClasses resolves ingress classes through IngressClass
+	// resources and their GCPIngressParams.
+	EnableIngressClasses bool
+	// EnableDiagnostics writes the findings of the self-diagnosis in a
+	// DiagnosticReport.
+	EnableDiagnostics bool
+	// EnableRetainedLoadBalancers retains the load balancers of the deleted
+	// Ingresses which ask for it, and records them in RetainedLoadBalancers.
+	EnableRetainedLoadBalancers bool
+}
+
+// IngressSource provides Ingresses which are not stored in the API server,
+// such as the Ingresses translated from Gateways. They are synced along with
+// the Ingresses of the cluster, which take precedence over the Ingresses of
+// the source with the same key.
+type IngressSource interface {
+	List() []interface{}
+	GetByKey(key string) (interface{}, bool, error)
+	AddEventHandler(handler cache.ResourceEventHandler)
+	HasSynced() bool
+	Run(stopCh <-chan struct{})
+	// Owns returns true if the Ingress was provided by the source.
+	Owns(ing *v1beta1.Ingress) bool
+	// UpdateStatus publishes the IP of the load balancer of an Ingress of
+	// the source.
+	UpdateStatus(ing *v1beta1.Ingress, ip string) error
+}
+
+// Shard assigns the namespaces of the cluster to the replicas of the
+// controller.
+type Shard interface {
+	// Owns returns true if the namespace is assigned to this replica.
+	Owns(namespace string) bool
+	// AddChangeHandler registers a function called when namespaces may have
+	// changed owner.
+	AddChangeHandler(handler func())
 }
 
 // NewControllerContext returns a new shared set of informers.
@@ -91,7 +194,7 @@ func NewControllerContext(
 	backendConfigClient backendconfigclient.Interface,
 	frontendConfigClient frontendconfigclient.Interface,
 	cloud *gce.Cloud,
-	namer *namer.Namer,
+	namer namer.IngressNamer,
 	config ControllerContextConfig) *ControllerContext {
 
 	context := &ControllerContext{
@@ -107,7 +210,14 @@ func NewControllerContext(
 		NodeInformer:            informerv1.NewNodeInformer(kubeClient, config.ResyncPeriod, utils.NewNamespaceIndexer()),
 		recorders:               map[string]record.EventRecorder{},
 		healthChecks:            make(map[string]func() error),
+		readinessChecks:         make(map[string]func() error),
 	}
+	// Nodes and Services, e.g. the kubernetes Service, exist in every
+	// cluster, so that their informers get resync events.
+	context.trackCache("ingress", context.IngressInformer)
+	context.trackCache("service", context.ServiceInformer)
+	context.trackCache("node", context.NodeInformer)
+	context.AddHealthCheck("caches", context.CheckCaches)
 
 	if config.EnableCSM && dynamicClient != nil {
 		klog.Warning("The DestinationRule group version is v1alpha3 in group networking.istio.io. Need to update as istio API graduates.")
@@ -117,6 +227,34 @@ func NewControllerContext(
 			nil)
 		context.DestinationRuleInformer = drDynamicInformer.Informer()
 		context.DestinationRuleClient = dynamicClient.Resource(destrinationGVR)
+
+		serviceEntryGVR := schema.GroupVersionResource{Group: "networking.istio.io", Version: "v1alpha3", Resource: "serviceentries"}
+		seDynamicInformer := dynamicinformer.NewFilteredDynamicInformer(dynamicClient, serviceEntryGVR, config.Namespace, config.ResyncPeriod,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+			nil)
+		context.ServiceEntryInformer = seDynamicInformer.Informer()
+		context.ServiceEntryClient = dynamicClient.Resource(serviceEntryGVR)
+	}
+
+	if config.FirewallSuggestionNamespace != "" && dynamicClient != nil {
+		suggestionGVR := firewallsuggestionv1beta1.SchemeGroupVersion.WithResource("firewallsuggestions")
+		context.FirewallSuggestionClient = dynamicClient.Resource(suggestionGVR).Namespace(config.FirewallSuggestionNamespace)
+	}
+
+	if config.EnableDiagnostics && dynamicClient != nil {
+		context.DiagnosticReportClient = dynamicClient.Resource(diagnosticreportv1beta1.SchemeGroupVersion.WithResource("diagnosticreports"))
+	}
+
+	if config.EnableRetainedLoadBalancers && dynamicClient != nil {
+		retainedGVR := retainedloadbalancerv1beta1.SchemeGroupVersion.WithResource("retainedloadbalancers")
+		context.RetainedLoadBalancerClient = dynamicClient.Resource(retainedGVR)
+		context.RetainedLoadBalancerInformer = dynamicinformer.NewFilteredDynamicInformer(dynamicClient, retainedGVR, apiv1.NamespaceAll, config.ResyncPeriod, cache.Indexers{}, nil).Informer()
+	}
+
+	if config.EnableIngressClasses && dynamicClient != nil {
+		context.IngressClassInformer = dynamicinformer.NewFilteredDynamicInformer(dynamicClient, ingressclass.IngressClassGVR, apiv1.NamespaceAll, config.ResyncPeriod, cache.Indexers{}, nil).Informer()
+		context.GCPIngressParamsInformer = dynamicinformer.NewFilteredDynamicInformer(dynamicClient, ingressclass.ParamsGVR, apiv1.NamespaceAll, config.ResyncPeriod, cache.Indexers{}, nil).Informer()
+		context.IngressClasses = ingressclass.NewRegistry(context.IngressClassInformer.GetStore(), context.GCPIngressParamsInformer.GetStore())
 	}
 
 	if config.FrontendConfigEnabled {
@@ -145,6 +283,22 @@ func (ctx *ControllerContext) HasSynced() bool {
 		funcs = append(funcs, ctx.DestinationRuleInformer.HasSynced)
 	}
 
+	if ctx.ServiceEntryInformer != nil {
+		funcs = append(funcs, ctx.ServiceEntryInformer.HasSynced)
+	}
+
+	if ctx.IngressClassInformer != nil {
+		funcs = append(funcs, ctx.IngressClassInformer.HasSynced, ctx.GCPIngressParamsInformer.HasSynced)
+	}
+
+	if ctx.RetainedLoadBalancerInformer != nil {
+		funcs = append(funcs, ctx.RetainedLoadBalancerInformer.HasSynced)
+	}
+
+	if ctx.IngressSource != nil {
+		funcs = append(funcs, ctx.IngressSource.HasSynced)
+	}
+
 	for _, f := range funcs {
 		if !f() {
 			return false
@@ -178,6 +332,90 @@ func (ctx *ControllerContext) AddHealthCheck(id string, hc func() error) {
 	ctx.healthChecks[id] = hc
 }
 
+// AddShutdownHook registers function to be called on graceful shutdown,
+// before the controller exits.
+func (ctx *ControllerContext) AddShutdownHook(hook func()) {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+
+	ctx.shutdownHooks = append(ctx.shutdownHooks, hook)
+}
+
+// RunShutdownHooks calls all registered shutdown hooks in order.
+func (ctx *ControllerContext) RunShutdownHooks() {
+	ctx.lock.Lock()
+	hooks := ctx.shutdownHooks
+	ctx.lock.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+// AddReadinessCheck registers function to be called for readiness checking.
+func (ctx *ControllerContext) AddReadinessCheck(id string, rc func() error) {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+
+	ctx.readinessChecks[id] = rc
+}
+
+// ReadinessCheck runs all registered readiness check functions.
+func (ctx *ControllerContext) ReadinessCheck() HealthCheckResults {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+
+	readinessChecks := make(map[string]error)
+	for component, f := range ctx.readinessChecks {
+		readinessChecks[component] = f()
+	}
+
+	return readinessChecks
+}
+
+// staleCacheResyncs is the number of resync periods without any event after
+// which the cache of an informer is considered stale.
+const staleCacheResyncs = 3
+
+// trackedCache is an informer whose staleness is checked.
+type trackedCache struct {
+	name     string
+	informer cache.SharedIndexInformer
+	// lastEvent is the time of the last event of the informer.
+	lastEvent utils.TimeTracker
+}
+
+// trackCache records the time of the events of the informer, including its
+// periodic resyncs.
+func (ctx *ControllerContext) trackCache(name string, informer cache.SharedIndexInformer) {
+	c := &trackedCache{name: name, informer: informer, lastEvent: utils.NewTimeTracker()}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { c.lastEvent.Track() },
+		UpdateFunc: func(interface{}, interface{}) { c.lastEvent.Track() },
+		DeleteFunc: func(interface{}) { c.lastEvent.Track() },
+	})
+	ctx.caches = append(ctx.caches, c)
+}
+
+// CheckCaches returns an error if the cache of an informer got no event,
+// not even a resync, for several resync periods, e.g. because its watch is
+// stuck.
+func (ctx *ControllerContext) CheckCaches() error {
+	if ctx.ResyncPeriod <= 0 {
+		return nil
+	}
+	for _, c := range ctx.caches {
+		// Empty caches get no resync events.
+		if len(c.informer.GetStore().ListKeys()) == 0 {
+			continue
+		}
+		if last := c.lastEvent.Get(); time.Since(last) > staleCacheResyncs*ctx.ResyncPeriod {
+			return fmt.Errorf("%s cache got no event since %v", c.name, last)
+		}
+	}
+	return nil
+}
+
 // HealthCheckResults contains a mapping of component -> health check results.
 type HealthCheckResults map[string]error
 
@@ -212,11 +450,93 @@ func (ctx *ControllerContext) Start(stopCh chan struct{}) {
 	if ctx.DestinationRuleInformer != nil {
 		go ctx.DestinationRuleInformer.Run(stopCh)
 	}
+	if ctx.ServiceEntryInformer != nil {
+		go ctx.ServiceEntryInformer.Run(stopCh)
+	}
+	if ctx.IngressClassInformer != nil {
+		go ctx.IngressClassInformer.Run(stopCh)
+		go ctx.GCPIngressParamsInformer.Run(stopCh)
+	}
+	if ctx.RetainedLoadBalancerInformer != nil {
+		go ctx.RetainedLoadBalancerInformer.Run(stopCh)
+	}
+	if ctx.Operations != nil {
+		go ctx.Operations.Run(stopCh)
+	}
+	if ctx.IngressSource != nil {
+		ctx.IngressSource.Run(stopCh)
+	}
 }
 
-// Ingresses returns the store of Ingresses.
+// Ingresses returns the store of Ingresses, including the Ingresses of the
+// IngressSource.
 func (ctx *ControllerContext) Ingresses() *typed.IngressStore {
-	return typed.WrapIngressStore(ctx.IngressInformer.GetStore())
+	return typed.WrapIngressStore(ctx.IngressStore())
+}
+
+// IngressStore returns the untyped store of Ingresses, including the
+// Ingresses of the IngressSource. Writes only go to the Ingresses of the
+// cluster.
+func (ctx *ControllerContext) IngressStore() cache.Store {
+	if ctx.IngressSource == nil {
+		return ctx.IngressInformer.GetStore()
+	}
+	return &ingressStore{Store: ctx.IngressInformer.GetStore(), source: ctx.IngressSource}
+}
+
+// AddIngressEventHandler adds a handler of the changes of the Ingresses,
+// including the Ingresses of the IngressSource.
+func (ctx *ControllerContext) AddIngressEventHandler(handler cache.ResourceEventHandler) {
+	ctx.IngressInformer.AddEventHandler(handler)
+	if ctx.IngressSource != nil {
+		ctx.IngressSource.AddEventHandler(handler)
+	}
+}
+
+// ingressStore merges the Ingresses of the cluster with the Ingresses of an
+// IngressSource.
+type ingressStore struct {
+	cache.Store
+	source IngressSource
+}
+
+// List implements cache.Store.
+func (s *ingressStore) List() []interface{} {
+	ret := s.Store.List()
+	for _, obj := range s.source.List() {
+		if _, exists, _ := s.Store.Get(obj); !exists {
+			ret = append(ret, obj)
+		}
+	}
+	return ret
+}
+
+// ListKeys implements cache.Store.
+func (s *ingressStore) ListKeys() []string {
+	var ret []string
+	for _, obj := range s.List() {
+		if key, err := cache.MetaNamespaceKeyFunc(obj); err == nil {
+			ret = append(ret, key)
+		}
+	}
+	return ret
+}
+
+// Get implements cache.Store.
+func (s *ingressStore) Get(obj interface{}) (interface{}, bool, error) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return nil, false, err
+	}
+	return s.GetByKey(key)
+}
+
+// GetByKey implements cache.Store.
+func (s *ingressStore) GetByKey(key string) (interface{}, bool, error) {
+	if obj, exists, err := s.Store.GetByKey(key); err != nil || exists {
+		return obj, exists, err
+	}
+	return s.source.GetByKey(key)
 }
 
 // Services returns the store of Services.
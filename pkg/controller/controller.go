@@ -17,10 +17,14 @@ limitations under the License.
 package controller
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"reflect"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
@@ -28,24 +32,36 @@ import (
 	"k8s.io/api/networking/v1beta1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/kubernetes"
 	unversionedcore "k8s.io/client-go/kubernetes/typed/core/v1"
 	listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/ingress-gce/pkg/alerting"
 	"k8s.io/ingress-gce/pkg/annotations"
 	backendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/backendconfig/v1beta1"
 	frontendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1"
+	retainedloadbalancerv1beta1 "k8s.io/ingress-gce/pkg/apis/retainedloadbalancer/v1beta1"
+	"k8s.io/ingress-gce/pkg/backendconfig"
 	"k8s.io/ingress-gce/pkg/backends"
+	"k8s.io/ingress-gce/pkg/backends/features"
 	"k8s.io/ingress-gce/pkg/common/operator"
+	"k8s.io/ingress-gce/pkg/composite"
 	"k8s.io/ingress-gce/pkg/context"
+	"k8s.io/ingress-gce/pkg/controller/errors"
+	"k8s.io/ingress-gce/pkg/controller/metrics"
 	"k8s.io/ingress-gce/pkg/controller/translator"
+	"k8s.io/ingress-gce/pkg/events"
 	"k8s.io/ingress-gce/pkg/flags"
 	"k8s.io/ingress-gce/pkg/frontendconfig"
 	"k8s.io/ingress-gce/pkg/healthchecks"
 	"k8s.io/ingress-gce/pkg/instances"
 	"k8s.io/ingress-gce/pkg/loadbalancers"
+	"k8s.io/ingress-gce/pkg/mtu"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/ingress-gce/pkg/orgpolicy"
+	"k8s.io/ingress-gce/pkg/quota"
 	ingsync "k8s.io/ingress-gce/pkg/sync"
 	"k8s.io/ingress-gce/pkg/tls"
 	"k8s.io/ingress-gce/pkg/utils"
@@ -88,13 +104,37 @@ type LoadBalancerController struct {
 
 	// Ingress sync + GC implementation
 	ingSyncer ingsync.Syncer
+
+	// orgPolicy returns the organization policies Ingresses are checked
+	// against before syncing, nil if not configured.
+	orgPolicy orgpolicy.Source
+	// mtuChecker checks the MTU of the nodes against the load balancer data
+	// path, nil if disabled.
+	mtuChecker *mtu.Checker
+	// negMigrator moves backends from instance groups to NEGs without
+	// dropping traffic, nil if disabled.
+	negMigrator *backends.NEGMigrator
+	// syncErrors records the events of the failed syncs of Ingresses,
+	// collapsing the repeats of the failures retried by the queue.
+	syncErrors *events.Aggregator
+	// instanceGroupsDeleted is set to 1 once the instance groups of the
+	// cluster are gone with --disable-instance-groups, so that GC stops
+	// deleting them.
+	instanceGroupsDeleted int32
 }
 
+// syncErrorEventInterval is the interval at which the repeats of the same sync
+// error of an Ingress are recorded, so that the event does not expire while
+// the Ingress keeps failing.
+const syncErrorEventInterval = 10 * time.Minute
+
 // NewLoadBalancerController creates a controller for gce loadbalancers.
 func NewLoadBalancerController(
 	ctx *context.ControllerContext,
 	stopCh chan struct{}) *LoadBalancerController {
 
+	metrics.RegisterMetrics()
+
 	broadcaster := record.NewBroadcaster()
 	broadcaster.StartLogging(klog.Infof)
 	broadcaster.StartRecordingToSink(&unversionedcore.EventSinkImpl{
@@ -102,8 +142,16 @@ func NewLoadBalancerController(
 	})
 
 	healthChecker := healthchecks.NewHealthChecker(ctx.Cloud, ctx.HealthCheckPath, ctx.DefaultBackendHealthCheckPath, ctx.ClusterNamer, ctx.DefaultBackendSvcPort.ID.Service)
-	instancePool := instances.NewNodePool(ctx.Cloud, ctx.ClusterNamer)
+	instancePool := instances.NewNodePool(instances.NewCloudInstanceGroups(ctx.Cloud), ctx.ClusterNamer)
 	backendPool := backends.NewPool(ctx.Cloud, ctx.ClusterNamer)
+	var alertPolicies *alerting.Manager
+	if ctx.AlertPolicyClient != nil {
+		alertPolicies = alerting.NewManager(ctx.AlertPolicyClient, ctx.Cloud.ProjectID(), ctx)
+	}
+	var serviceStatus *backends.ServiceStatusUpdater
+	if flags.F.EnableBackendServicesStatus {
+		serviceStatus = backends.NewServiceStatusUpdater(ctx.KubeClient, ctx.ServiceInformer.GetIndexer())
+	}
 
 	lbc := LoadBalancerController{
 		ctx:           ctx,
@@ -112,22 +160,34 @@ func NewLoadBalancerController(
 		tlsLoader:     &tls.TLSCertsFromSecretsLoader{Client: ctx.KubeClient},
 		stopCh:        stopCh,
 		hasSynced:     ctx.HasSynced,
-		nodes:         NewNodeController(ctx, instancePool),
 		instancePool:  instancePool,
-		l7Pool:        loadbalancers.NewLoadBalancerPool(ctx.Cloud, ctx.ClusterNamer, ctx),
-		backendSyncer: backends.NewBackendSyncer(backendPool, healthChecker, ctx.ClusterNamer, ctx.Cloud),
+		l7Pool:        loadbalancers.NewLoadBalancerPool(ctx.Cloud, ctx.NamespaceClouds, ctx.TargetProxyClient, ctx.ClusterNamer, ctx),
+		backendSyncer: backends.NewBackendSyncer(backendPool, healthChecker, ctx.ClusterNamer, ctx.Cloud, alertPolicies, serviceStatus),
 		negLinker:     backends.NewNEGLinker(backendPool, negtypes.NewAdapter(ctx.Cloud), ctx.ClusterNamer, ctx.Cloud),
 		igLinker:      backends.NewInstanceGroupLinker(instancePool, backendPool, ctx.ClusterNamer),
+		syncErrors:    events.NewAggregator(flags.F.SyncErrorWarningThreshold, syncErrorEventInterval),
 	}
-	lbc.ingSyncer = ingsync.NewIngressSyncer(&lbc)
+	if !flags.F.DisableInstanceGroups {
+		lbc.nodes = NewNodeController(ctx, instancePool)
+	}
+	if flags.F.OrgPolicyFile != "" {
+		lbc.orgPolicy = orgpolicy.NewFileSource(flags.F.OrgPolicyFile)
+	}
+	if flags.F.EnableNEGMigration && !flags.F.DisableInstanceGroups {
+		lbc.negMigrator = backends.NewNEGMigrator(backendPool, ctx.Cloud, ctx.KubeClient, ctx.ServiceInformer.GetIndexer(), ctx.ClusterNamer, flags.F.NEGMigrationTimeout)
+	}
+	if flags.F.EnableMTUChecks {
+		lbc.mtuChecker = mtu.NewChecker(ctx.Cloud, flags.F.NodeMTULabel)
+	}
+	lbc.ingSyncer = ingsync.NewIngressSyncer(&lbc, ctx.IngressClasses)
 
 	lbc.ingQueue = utils.NewPeriodicTaskQueue("ingress", "ingresses", lbc.sync)
 
 	// Ingress event handlers.
-	ctx.IngressInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+	ctx.AddIngressEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			addIng := obj.(*v1beta1.Ingress)
-			if !utils.IsGLBCIngress(addIng) {
+			if !utils.IsGLBCIngress(addIng, ctx.IngressClasses) {
 				klog.V(4).Infof("Ignoring add for ingress %v based on annotation %v", namer.IngressKeyFunc(addIng), annotations.IngressClassKey)
 				return
 			}
@@ -147,7 +207,7 @@ func NewLoadBalancerController(
 				return
 			}
 
-			if !utils.IsGLBCIngress(delIng) {
+			if !utils.IsGLBCIngress(delIng, ctx.IngressClasses) {
 				klog.V(4).Infof("Ignoring delete for ingress %v based on annotation %v", namer.IngressKeyFunc(delIng), annotations.IngressClassKey)
 				return
 			}
@@ -157,11 +217,11 @@ func NewLoadBalancerController(
 		},
 		UpdateFunc: func(old, cur interface{}) {
 			curIng := cur.(*v1beta1.Ingress)
-			if !utils.IsGLBCIngress(curIng) {
+			if !utils.IsGLBCIngress(curIng, ctx.IngressClasses) {
 				oldIng := old.(*v1beta1.Ingress)
 				// If ingress was GLBC Ingress, we need to track ingress class change
 				// and run GC to delete LB resources.
-				if utils.IsGLBCIngress(oldIng) {
+				if utils.IsGLBCIngress(oldIng, ctx.IngressClasses) {
 					klog.V(4).Infof("Ingress %v class was changed, enqueuing", namer.IngressKeyFunc(curIng))
 					lbc.ingQueue.Enqueue(cur)
 					return
@@ -169,11 +229,13 @@ func NewLoadBalancerController(
 				return
 			}
 			if reflect.DeepEqual(old, cur) {
+				// Spread the periodic resyncs of all Ingresses across the
+				// resync period to avoid spikes of GCE API calls.
 				klog.V(3).Infof("Periodic enqueueing of %v", namer.IngressKeyFunc(curIng))
-			} else {
-				klog.V(3).Infof("Ingress %v changed, enqueuing", namer.IngressKeyFunc(curIng))
+				lbc.ingQueue.EnqueueSpread(ctx.ResyncPeriod, cur)
+				return
 			}
-
+			klog.V(3).Infof("Ingress %v changed, enqueuing", namer.IngressKeyFunc(curIng))
 			lbc.ingQueue.Enqueue(cur)
 		},
 	})
@@ -195,23 +257,51 @@ func NewLoadBalancerController(
 		// Ingress deletes matter, service deletes don't.
 	})
 
+	if flags.F.EnableNEGProbeHealthChecks {
+		// The probes picked for the health checks of deleted Services are
+		// no longer tracked.
+		ctx.ServiceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			DeleteFunc: func(obj interface{}) {
+				if svc, ok := obj.(*apiv1.Service); ok {
+					lbc.Translator.ForgetProbes(svc)
+				}
+			},
+		})
+
+		// Pod event handlers. Pods are sorted by age when picking the
+		// readiness probe of the NEG health checks, so adding or deleting a
+		// Pod may switch the health check to the probe of another Pod. The
+		// probes of a Pod are immutable, so updates are ignored.
+		ctx.PodInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				pod := obj.(*apiv1.Pod)
+				lbc.ingQueue.Enqueue(convert(lbc.ingressesForProbeChange(pod))...)
+			},
+			DeleteFunc: func(obj interface{}) {
+				if pod, ok := obj.(*apiv1.Pod); ok {
+					lbc.ingQueue.Enqueue(convert(lbc.ingressesForProbeChange(pod))...)
+				}
+			},
+		})
+	}
+
 	// BackendConfig event handlers.
 	ctx.BackendConfigInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			beConfig := obj.(*backendconfigv1beta1.BackendConfig)
-			ings := operator.Ingresses(ctx.Ingresses().List()).ReferencesBackendConfig(beConfig, operator.Services(ctx.Services().List())).AsList()
+			ings := lbc.ingressesForBackendConfig(beConfig)
 			lbc.ingQueue.Enqueue(convert(ings)...)
 		},
 		UpdateFunc: func(old, cur interface{}) {
 			if !reflect.DeepEqual(old, cur) {
 				beConfig := cur.(*backendconfigv1beta1.BackendConfig)
-				ings := operator.Ingresses(ctx.Ingresses().List()).ReferencesBackendConfig(beConfig, operator.Services(ctx.Services().List())).AsList()
+				ings := lbc.ingressesForBackendConfig(beConfig)
 				lbc.ingQueue.Enqueue(convert(ings)...)
 			}
 		},
 		DeleteFunc: func(obj interface{}) {
 			beConfig := obj.(*backendconfigv1beta1.BackendConfig)
-			ings := operator.Ingresses(ctx.Ingresses().List()).ReferencesBackendConfig(beConfig, operator.Services(ctx.Services().List())).AsList()
+			ings := lbc.ingressesForBackendConfig(beConfig)
 			lbc.ingQueue.Enqueue(convert(ings)...)
 		},
 	})
@@ -221,27 +311,52 @@ func NewLoadBalancerController(
 		ctx.FrontendConfigInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 			AddFunc: func(obj interface{}) {
 				feConfig := obj.(*frontendconfigv1beta1.FrontendConfig)
-				ings := operator.Ingresses(ctx.Ingresses().List()).ReferencesFrontendConfig(feConfig).AsList()
+				ings := lbc.ingressesForFrontendConfig(feConfig)
 				lbc.ingQueue.Enqueue(convert(ings)...)
 
 			},
 			UpdateFunc: func(old, cur interface{}) {
 				if !reflect.DeepEqual(old, cur) {
 					feConfig := cur.(*frontendconfigv1beta1.FrontendConfig)
-					ings := operator.Ingresses(ctx.Ingresses().List()).ReferencesFrontendConfig(feConfig).AsList()
+					ings := lbc.ingressesForFrontendConfig(feConfig)
 					lbc.ingQueue.Enqueue(convert(ings)...)
 				}
 			},
 			DeleteFunc: func(obj interface{}) {
 				feConfig := obj.(*frontendconfigv1beta1.FrontendConfig)
-				ings := operator.Ingresses(ctx.Ingresses().List()).ReferencesFrontendConfig(feConfig).AsList()
+				ings := lbc.ingressesForFrontendConfig(feConfig)
 				lbc.ingQueue.Enqueue(convert(ings)...)
 			},
 		})
 	}
 
-	// Register health check on controller context.
-	ctx.AddHealthCheck("ingress", func() error {
+	// IngressClass event handlers. Any change may move Ingresses between
+	// classes or change their settings.
+	if ctx.IngressClassInformer != nil {
+		enqueueAll := func(interface{}) {
+			lbc.ingQueue.Enqueue(convert(lbc.ctx.Ingresses().List())...)
+		}
+		handler := cache.ResourceEventHandlerFuncs{
+			AddFunc:    enqueueAll,
+			DeleteFunc: enqueueAll,
+			UpdateFunc: func(old, cur interface{}) {
+				if !reflect.DeepEqual(old, cur) {
+					enqueueAll(cur)
+				}
+			},
+		}
+		ctx.IngressClassInformer.AddEventHandler(handler)
+		ctx.GCPIngressParamsInformer.AddEventHandler(handler)
+	}
+
+	// Namespaces moving to or from this replica are synced by their new owner.
+	if ctx.Shard != nil {
+		ctx.Shard.AddChangeHandler(func() {
+			lbc.ingQueue.Enqueue(convert(lbc.ctx.Ingresses().List())...)
+		})
+	}
+
+	checkCloud := func() error {
 		_, err := backendPool.Get("foo", meta.VersionGA, meta.Global)
 
 		// If this container is scheduled on a node without compute/rw it is
@@ -252,6 +367,30 @@ func NewLoadBalancerController(
 			return nil
 		}
 		return utils.IgnoreHTTPNotFound(err)
+	}
+
+	// Register health check on controller context.
+	ctx.AddHealthCheck("ingress", func() error {
+		if err := checkCloud(); err != nil {
+			return err
+		}
+		return lbc.checkSyncStuck()
+	})
+
+	// The controller is ready once its caches synced and it reached GCE.
+	var cloudReached int32
+	ctx.AddReadinessCheck("ingress", func() error {
+		if !lbc.hasSynced() {
+			return fmt.Errorf("waiting for caches to sync")
+		}
+		if atomic.LoadInt32(&cloudReached) == 1 {
+			return nil
+		}
+		if err := checkCloud(); err != nil {
+			return fmt.Errorf("failed to reach GCE: %v", err)
+		}
+		atomic.StoreInt32(&cloudReached, 1)
+		return nil
 	})
 
 	klog.V(3).Infof("Created new loadbalancer controller")
@@ -259,6 +398,21 @@ func NewLoadBalancerController(
 	return &lbc
 }
 
+// checkSyncStuck returns an error if the sync of an Ingress has been running
+// for longer than --sync-stuck-threshold, e.g. because it is blocked on a
+// call which never returns.
+func (lbc *LoadBalancerController) checkSyncStuck() error {
+	threshold := flags.Reloadable().SyncStuckThreshold
+	if threshold <= 0 {
+		return nil
+	}
+	key, start := lbc.ingQueue.Syncing()
+	if key != "" && time.Since(start) > threshold {
+		return fmt.Errorf("sync of Ingress %q has been running since %v", key, start)
+	}
+	return nil
+}
+
 func (lbc *LoadBalancerController) Init() {
 	// TODO(rramkumar): Try to get rid of this "Init".
 	lbc.instancePool.Init(lbc.Translator)
@@ -269,7 +423,9 @@ func (lbc *LoadBalancerController) Init() {
 func (lbc *LoadBalancerController) Run() {
 	klog.Infof("Starting loadbalancer controller")
 	go lbc.ingQueue.Run()
-	go lbc.nodes.Run()
+	if lbc.nodes != nil {
+		go lbc.nodes.Run()
+	}
 
 	<-lbc.stopCh
 	klog.Infof("Shutting down Loadbalancer Controller")
@@ -287,7 +443,9 @@ func (lbc *LoadBalancerController) Stop(deleteAll bool) error {
 		close(lbc.stopCh)
 		klog.Infof("Shutting down controller queues.")
 		lbc.ingQueue.Shutdown()
-		lbc.nodes.Shutdown()
+		if lbc.nodes != nil {
+			lbc.nodes.Shutdown()
+		}
 		lbc.shutdown = true
 	}
 
@@ -311,7 +469,42 @@ func (lbc *LoadBalancerController) SyncBackends(state interface{}) error {
 	if !ok {
 		return fmt.Errorf("expected state type to be syncState, type was %T", state)
 	}
+	err := lbc.syncBackends(syncState)
+	if err != nil && err != ingsync.ErrSkipBackendsSync {
+		syncState.conditions.SetError(loadbalancers.BackendsHealthy, err)
+	}
+	return err
+}
+
+// syncBackends syncs the backends of the Ingress of the syncState.
+func (lbc *LoadBalancerController) syncBackends(syncState *syncState) error {
 	ingSvcPorts := syncState.urlMap.AllServicePorts()
+	if lbc.mtuChecker != nil {
+		lbc.checkMTU(ingSvcPorts)
+	}
+
+	if flags.F.DisableInstanceGroups {
+		return lbc.syncNEGBackends(syncState.ing, ingSvcPorts)
+	}
+
+	if lbc.negMigrator != nil {
+		igPorts, err := lbc.negMigrator.Migrate(ingSvcPorts)
+		if err != nil {
+			return err
+		}
+		// The load balancer keeps using the instance groups of the migrating
+		// ports, while their NEGs are synced and linked.
+		migrating := map[utils.ServicePortID]bool{}
+		for _, sp := range igPorts {
+			migrating[sp.ID] = true
+		}
+		syncState.urlMap.UpdateServicePorts(func(sp *utils.ServicePort) {
+			if migrating[sp.ID] {
+				sp.NEGEnabled = false
+			}
+		})
+		ingSvcPorts = append(ingSvcPorts, igPorts...)
+	}
 
 	// Create instance groups and set named ports.
 	igs, err := lbc.instancePool.EnsureInstanceGroupsAndPorts(lbc.ctx.ClusterNamer.InstanceGroup(), nodePorts(ingSvcPorts))
@@ -319,7 +512,7 @@ func (lbc *LoadBalancerController) SyncBackends(state interface{}) error {
 		return err
 	}
 
-	nodeNames, err := utils.GetReadyNodeNames(listers.NewNodeLister(lbc.nodeLister))
+	nodeNames, err := utils.GetInstanceGroupNodeNames(listers.NewNodeLister(lbc.nodeLister))
 	if err != nil {
 		return err
 	}
@@ -362,7 +555,7 @@ func (lbc *LoadBalancerController) SyncBackends(state interface{}) error {
 		var linkErr error
 		if sp.NEGEnabled {
 			// Link backend to NEG's if the backend has NEG enabled.
-			linkErr = lbc.negLinker.Link(sp, groupKeys)
+			linkErr = lbc.negLinker.Link(sp, lbc.negGroupKeys(sp, zones))
 		} else {
 			// Otherwise, link backend to IG's.
 			linkErr = lbc.igLinker.Link(sp, groupKeys)
@@ -375,23 +568,225 @@ func (lbc *LoadBalancerController) SyncBackends(state interface{}) error {
 	return nil
 }
 
+// checkMTU raises a warning event on the services of the given ports for
+// each MTU problem of the nodes. Errors are only logged, as they do not
+// prevent the sync.
+func (lbc *LoadBalancerController) checkMTU(svcPorts []utils.ServicePort) {
+	nodes, err := listers.NewNodeLister(lbc.nodeLister).ListWithPredicate(utils.GetNodeConditionPredicate())
+	if err != nil {
+		klog.Errorf("Failed to list nodes for MTU checks: %v", err)
+		return
+	}
+	problems, err := lbc.mtuChecker.Check(nodes)
+	if err != nil {
+		klog.Errorf("Failed to check the MTU of nodes: %v", err)
+		return
+	}
+	if len(problems) == 0 {
+		return
+	}
+	seen := map[string]bool{}
+	for _, sp := range svcPorts {
+		key := sp.ID.Service.String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		obj, exists, err := lbc.ctx.ServiceInformer.GetIndexer().GetByKey(key)
+		if err != nil || !exists {
+			continue
+		}
+		svc := obj.(*apiv1.Service)
+		for _, problem := range problems {
+			lbc.ctx.Recorder(svc.Namespace).Eventf(svc, apiv1.EventTypeWarning, "MTU", problem)
+		}
+	}
+}
+
+// syncNEGBackends syncs the backends of an Ingress and links them to NEGs,
+// when instance group management is disabled.
+func (lbc *LoadBalancerController) syncNEGBackends(ing *v1beta1.Ingress, ingSvcPorts []utils.ServicePort) error {
+	if utils.IsGCEMultiClusterIngress(ing) {
+		return fmt.Errorf("multi-cluster Ingress %v requires instance groups, which are disabled", namer.IngressKeyFunc(ing))
+	}
+	for _, sp := range ingSvcPorts {
+		if !sp.NEGEnabled {
+			return errors.ErrInstanceGroupsDisabled{ServicePortID: sp.ID}
+		}
+	}
+	if err := lbc.backendSyncer.Sync(ingSvcPorts); err != nil {
+		return err
+	}
+	zones, err := lbc.Translator.ListZones()
+	if err != nil {
+		return err
+	}
+	for _, sp := range ingSvcPorts {
+		if err := lbc.negLinker.Link(sp, lbc.negGroupKeys(sp, zones)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// negGroupKeys returns the group keys of the NEGs of the service port in the
+// given zones, restricted to the zones its Service pins its NEGs to with the
+// cloud.google.com/neg-zones annotation. The NEGs of a Service pinned to none
+// of the zones are kept by the NEG controller, so they stay linked in all the
+// zones rather than detaching all the backends.
+func (lbc *LoadBalancerController) negGroupKeys(sp utils.ServicePort, zones []string) []backends.GroupKey {
+	obj, exists, err := lbc.ctx.ServiceInformer.GetIndexer().GetByKey(sp.ID.Service.String())
+	if err == nil && exists {
+		if pinned, ok := annotations.FromService(obj.(*apiv1.Service)).NEGZones(); ok {
+			if pinnedZones, _ := negtypes.PinnedZones(zones, pinned); len(pinnedZones) > 0 {
+				zones = pinnedZones
+			} else {
+				klog.Warningf("Annotation %s of service %s pins its NEGs to none of the zones %v, linking the NEGs of all the zones", annotations.NEGZonesKey, sp.ID.Service, zones)
+			}
+		}
+	}
+	var groupKeys []backends.GroupKey
+	for _, zone := range zones {
+		groupKeys = append(groupKeys, backends.GroupKey{Zone: zone})
+	}
+	return groupKeys
+}
+
+// ingressesForBackendConfig returns the Ingresses using the BackendConfig,
+// either through a Service reference or as a default config.
+func (lbc *LoadBalancerController) ingressesForBackendConfig(beConfig *backendconfigv1beta1.BackendConfig) []*v1beta1.Ingress {
+	if flags.F.EnableDefaultConfigs && beConfig.Name == backendconfig.DefaultBackendConfigName {
+		return ingressesForDefaultConfig(lbc.ctx.Ingresses().List(), beConfig.Namespace)
+	}
+	return operator.Ingresses(lbc.ctx.Ingresses().List()).ReferencesBackendConfig(beConfig, operator.Services(lbc.ctx.Services().List())).AsList()
+}
+
+// ingressesForProbeChange returns the Ingresses referencing a Service which
+// selects the added or deleted Pod, if the readiness probe picked for the
+// health check of a NEG port of the Service changed.
+func (lbc *LoadBalancerController) ingressesForProbeChange(pod *apiv1.Pod) []*v1beta1.Ingress {
+	if !hasReadinessProbe(pod) {
+		return nil
+	}
+	objs, err := lbc.ctx.ServiceInformer.GetIndexer().ByIndex(cache.NamespaceIndex, pod.Namespace)
+	if err != nil {
+		klog.Errorf("Failed to list services in namespace %q: %v", pod.Namespace, err)
+		return nil
+	}
+	var svcs []*apiv1.Service
+	for _, obj := range objs {
+		svcs = append(svcs, obj.(*apiv1.Service))
+	}
+
+	var ings []*v1beta1.Ingress
+	var ingsOp *operator.IngressesOperator
+	for _, svc := range operator.Services(svcs).SelectsPod(pod).AsList() {
+		changed, err := lbc.Translator.NEGProbeChanged(svc)
+		if err != nil {
+			klog.Errorf("Failed to get the readiness probe of service %s/%s: %v", svc.Namespace, svc.Name, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if ingsOp == nil {
+			ingsOp = operator.Ingresses(lbc.ctx.Ingresses().List())
+		}
+		ings = append(ings, ingsOp.ReferencesService(svc).AsList()...)
+	}
+	return ings
+}
+
+// ingressesForFrontendConfig returns the Ingresses using the FrontendConfig,
+// either through a reference or as a default config.
+func (lbc *LoadBalancerController) ingressesForFrontendConfig(feConfig *frontendconfigv1beta1.FrontendConfig) []*v1beta1.Ingress {
+	if flags.F.EnableDefaultConfigs && feConfig.Name == frontendconfig.DefaultFrontendConfigName {
+		return ingressesForDefaultConfig(lbc.ctx.Ingresses().List(), feConfig.Namespace)
+	}
+	return operator.Ingresses(lbc.ctx.Ingresses().List()).ReferencesFrontendConfig(feConfig).AsList()
+}
+
 // GCBackends implements Controller.
 func (lbc *LoadBalancerController) GCBackends(toKeep []*v1beta1.Ingress) error {
 	svcPortsToKeep := lbc.ToSvcPorts(toKeep)
+	if lbc.negMigrator != nil {
+		svcPortsToKeep = lbc.negMigrator.GCPorts(svcPortsToKeep)
+	}
+	retained, err := lbc.retainedLoadBalancers(toKeep)
+	if err != nil {
+		return err
+	}
+	svcPortsToKeep = append(svcPortsToKeep, retainedServicePorts(retained)...)
 	if err := lbc.backendSyncer.GC(svcPortsToKeep); err != nil {
 		return err
 	}
 	// TODO(ingress#120): Move this to the backend pool so it mirrors creation
-	if len(toKeep) == 0 {
+	// Instance groups still used by backend services are not deleted, they
+	// are retried on the next GC once no backend service references them.
+	if flags.F.DisableInstanceGroups {
+		return lbc.gcDisabledInstanceGroups()
+	}
+	if len(toKeep) == 0 && len(retained) == 0 {
 		igName := lbc.ctx.ClusterNamer.InstanceGroup()
 		klog.Infof("Deleting instance group %v", igName)
-		if err := lbc.instancePool.DeleteInstanceGroup(igName); err != err {
+		if err := lbc.instancePool.DeleteInstanceGroup(igName); err != nil && !utils.IsNotFoundError(err) {
 			return err
 		}
 	}
 	return nil
 }
 
+// gcDisabledInstanceGroups deletes the instance groups of the cluster left
+// behind before --disable-instance-groups was set, until none is left.
+func (lbc *LoadBalancerController) gcDisabledInstanceGroups() error {
+	if atomic.LoadInt32(&lbc.instanceGroupsDeleted) == 1 {
+		return nil
+	}
+	igName := lbc.ctx.ClusterNamer.InstanceGroup()
+	klog.Infof("Deleting instance group %v, instance groups are disabled", igName)
+	if err := lbc.instancePool.DeleteInstanceGroup(igName); err != nil && !utils.IsNotFoundError(err) {
+		return err
+	}
+	// Instance groups still used by backend services are not deleted.
+	left, err := lbc.instancePool.List()
+	if err != nil {
+		return err
+	}
+	if len(left) == 0 {
+		klog.V(2).Infof("Instance group %v is gone, no longer deleting it", igName)
+		atomic.StoreInt32(&lbc.instanceGroupsDeleted, 1)
+	}
+	return nil
+}
+
+// DesiredResources returns the load balancer names of the Ingresses whose load
+// balancers are kept, including the retained load balancers, and the names of
+// the backend services they use.
+func (lbc *LoadBalancerController) DesiredResources() ([]string, []string, error) {
+	_, toKeep := operator.Ingresses(lbc.ctx.Ingresses().List()).Partition(func(ing *v1beta1.Ingress) bool {
+		return utils.NeedsCleanup(ing, lbc.ctx.IngressClasses)
+	})
+	ings := toKeep.AsList()
+	svcPorts := lbc.ToSvcPorts(ings)
+	if lbc.negMigrator != nil {
+		svcPorts = lbc.negMigrator.GCPorts(svcPorts)
+	}
+	lbNames := lbc.toLbNames(ings)
+	retained, err := lbc.retainedLoadBalancers(ings)
+	if err != nil {
+		return nil, nil, err
+	}
+	svcPorts = append(svcPorts, retainedServicePorts(retained)...)
+	for _, spec := range retained {
+		lbNames = append(lbNames, spec.LoadBalancer)
+	}
+	var backends []string
+	for _, sp := range svcPorts {
+		backends = append(backends, sp.BackendName(lbc.ctx.ClusterNamer))
+	}
+	return lbNames, backends, nil
+}
+
 // SyncLoadBalancer implements Controller.
 func (lbc *LoadBalancerController) SyncLoadBalancer(state interface{}) error {
 	// We expect state to be a syncState
@@ -404,6 +799,7 @@ func (lbc *LoadBalancerController) SyncLoadBalancer(state interface{}) error {
 	if err != nil {
 		return err
 	}
+	lb.Conditions = syncState.conditions
 
 	// Create higher-level LB resources.
 	l7, err := lbc.l7Pool.Ensure(lb)
@@ -417,7 +813,128 @@ func (lbc *LoadBalancerController) SyncLoadBalancer(state interface{}) error {
 
 // GCLoadBalancers implements Controller.
 func (lbc *LoadBalancerController) GCLoadBalancers(toKeep []*v1beta1.Ingress) error {
-	return lbc.l7Pool.GC(toLbNames(toKeep))
+	if err := lbc.recordRetainedLoadBalancers(toKeep); err != nil {
+		return err
+	}
+	lbNames := lbc.toLbNames(toKeep)
+	retained, err := lbc.retainedLoadBalancers(toKeep)
+	if err != nil {
+		return err
+	}
+	for _, spec := range retained {
+		lbNames = append(lbNames, spec.LoadBalancer)
+	}
+	return lbc.l7Pool.GC(lbNames)
+}
+
+// retainedLoadBalancers returns the load balancers retained after their
+// Ingress was deleted: those recorded in RetainedLoadBalancers, except the
+// ones adopted by an Ingress of toKeep, and those of the deleted Ingresses
+// annotated with RetainResourcesKey which are not recorded yet. It does not
+// modify anything, see recordRetainedLoadBalancers.
+func (lbc *LoadBalancerController) retainedLoadBalancers(toKeep []*v1beta1.Ingress) ([]retainedloadbalancerv1beta1.RetainedLoadBalancerSpec, error) {
+	if lbc.ctx.RetainedLoadBalancerInformer == nil {
+		return nil, nil
+	}
+	kept, _, err := lbc.retainedRecords(toKeep)
+	if err != nil {
+		return nil, err
+	}
+	retainedNames := sets.NewString()
+	var retained []retainedloadbalancerv1beta1.RetainedLoadBalancerSpec
+	for _, record := range kept {
+		retainedNames.Insert(record.Spec.LoadBalancer)
+		retained = append(retained, record.Spec)
+	}
+	for _, ing := range lbc.retainingIngresses() {
+		if lbName := lbc.lbName(ing); !retainedNames.Has(lbName) {
+			retainedNames.Insert(lbName)
+			retained = append(retained, loadbalancers.NewRetainedLoadBalancerSpec(ing, lbName, lbc.ctx.IngressClasses))
+		}
+	}
+	return retained, nil
+}
+
+// recordRetainedLoadBalancers records the load balancers of the deleted
+// Ingresses annotated with RetainResourcesKey in RetainedLoadBalancers, and
+// deletes the records of the load balancers adopted by an Ingress of toKeep,
+// whose resources are managed by the Ingress again.
+func (lbc *LoadBalancerController) recordRetainedLoadBalancers(toKeep []*v1beta1.Ingress) error {
+	client := lbc.ctx.RetainedLoadBalancerClient
+	if client == nil {
+		return nil
+	}
+	kept, adopted, err := lbc.retainedRecords(toKeep)
+	if err != nil {
+		return err
+	}
+	for _, record := range adopted {
+		klog.V(2).Infof("Load balancer %q was adopted, deleting RetainedLoadBalancer %s/%s", record.Spec.LoadBalancer, record.Namespace, record.Name)
+		if err := client.Namespace(record.Namespace).Delete(record.Name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	recorded := sets.NewString()
+	for _, record := range kept {
+		recorded.Insert(record.Spec.LoadBalancer)
+	}
+	for _, ing := range lbc.retainingIngresses() {
+		lbName := lbc.lbName(ing)
+		if recorded.Has(lbName) {
+			continue
+		}
+		created, err := loadbalancers.EnsureRetainedLoadBalancer(client, ing, loadbalancers.NewRetainedLoadBalancerSpec(ing, lbName, lbc.ctx.IngressClasses))
+		if err != nil {
+			return fmt.Errorf("error retaining the load balancer of Ingress %s/%s: %v", ing.Namespace, ing.Name, err)
+		}
+		if created {
+			lbc.ctx.Recorder(ing.Namespace).Eventf(ing, apiv1.EventTypeNormal, "RetainedResources",
+				"The load balancer %q is not deleted, its resources are recorded in RetainedLoadBalancer %s/%s", lbName, ing.Namespace, ing.Name)
+		}
+	}
+	return nil
+}
+
+// retainedRecords returns the RetainedLoadBalancers, split between those
+// kept and those adopted by an Ingress of toKeep.
+func (lbc *LoadBalancerController) retainedRecords(toKeep []*v1beta1.Ingress) (kept, adopted []*retainedloadbalancerv1beta1.RetainedLoadBalancer, err error) {
+	records, err := loadbalancers.ListRetainedLoadBalancers(lbc.ctx.RetainedLoadBalancerInformer)
+	if err != nil {
+		return nil, nil, err
+	}
+	adoptedNames := sets.NewString(lbc.toLbNames(toKeep)...)
+	for _, record := range records {
+		if adoptedNames.Has(record.Spec.LoadBalancer) {
+			adopted = append(adopted, record)
+		} else {
+			kept = append(kept, record)
+		}
+	}
+	return kept, adopted, nil
+}
+
+// retainingIngresses returns the deleted Ingresses annotated with
+// RetainResourcesKey. Only the Ingresses with a load balancer of this
+// controller, which have its finalizer, are retained.
+func (lbc *LoadBalancerController) retainingIngresses() []*v1beta1.Ingress {
+	toCleanup, _ := operator.Ingresses(lbc.ctx.Ingresses().List()).Partition(func(ing *v1beta1.Ingress) bool {
+		return utils.NeedsCleanup(ing, lbc.ctx.IngressClasses)
+	})
+	return toCleanup.Filter(func(ing *v1beta1.Ingress) bool {
+		return annotations.FromIngress(ing).RetainResources() && utils.HasFinalizer(ing.ObjectMeta, utils.FinalizerKey)
+	}).AsList()
+}
+
+// retainedServicePorts returns the service ports of the backend services of
+// the retained load balancers.
+func retainedServicePorts(retained []retainedloadbalancerv1beta1.RetainedLoadBalancerSpec) []utils.ServicePort {
+	var svcPorts []utils.ServicePort
+	for _, spec := range retained {
+		for _, name := range spec.BackendServices {
+			svcPorts = append(svcPorts, utils.ServicePort{ExternalBackendService: name, L7ILBEnabled: spec.Regional})
+		}
+	}
+	return svcPorts
 }
 
 // MaybeRemoveFinalizers cleans up Finalizers if needed.
@@ -445,7 +962,7 @@ func (lbc *LoadBalancerController) PostProcess(state interface{}) error {
 	}
 
 	// Update the ingress status.
-	return lbc.updateIngressStatus(syncState.l7, syncState.ing)
+	return lbc.updateIngressStatus(syncState.l7, syncState.ing, syncState.conditions)
 }
 
 // sync manages Ingress create/updates/deletes events from queue.
@@ -454,6 +971,16 @@ func (lbc *LoadBalancerController) sync(key string) error {
 		time.Sleep(context.StoreSyncPollPeriod)
 		return fmt.Errorf("waiting for stores to sync")
 	}
+	if lbc.ctx.Shard != nil {
+		namespace, _, err := cache.SplitMetaNamespaceKey(key)
+		if err != nil {
+			return err
+		}
+		if !lbc.ctx.Shard.Owns(namespace) {
+			klog.V(4).Infof("Skipping %v, namespace %q is synced by another replica", key, namespace)
+			return nil
+		}
+	}
 	klog.V(3).Infof("Syncing %v", key)
 
 	ing, ingExists, err := lbc.ctx.Ingresses().GetByKey(key)
@@ -464,17 +991,38 @@ func (lbc *LoadBalancerController) sync(key string) error {
 	// Snapshot of list of ingresses.
 	allIngresses := lbc.ctx.Ingresses().List()
 	// Determine if the ingress needs to be GCed.
-	if !ingExists || utils.NeedsCleanup(ing) {
+	if !ingExists || utils.NeedsCleanup(ing, lbc.ctx.IngressClasses) {
+		if namespace, name, err := cache.SplitMetaNamespaceKey(key); err == nil {
+			metrics.DeleteIngress(namespace, name)
+		}
+		lbc.syncErrors.Forget(key)
 		// GC will find GCE resources that were used for this ingress and delete them.
 		return lbc.ingSyncer.GC(allIngresses)
 	}
 
 	// Get ingress and DeepCopy for assurance that we don't pollute other goroutines with changes.
 	ing = ing.DeepCopy()
+	// reason is the reason of the failure of the sync, empty if it succeeds.
+	var reason string
+	defer func() {
+		metrics.ObserveSync(ing.Namespace, ing.Name, reason, time.Now())
+		if reason == "" {
+			lbc.syncErrors.Success(ing)
+		}
+	}()
 	ingClient := lbc.ctx.KubeClient.NetworkingV1beta1().Ingresses(ing.Namespace)
-	if flags.F.FinalizerAdd {
+	// Ingresses translated from Gateways are not stored in the API server.
+	if !lbc.fromSource(ing) {
+		if err := utils.EnsureNamingScheme(ing, ingClient); err != nil {
+			klog.Errorf("Failed to record naming scheme of Ingress %q: %v", key, err)
+			reason = metrics.ReasonKubernetes
+			return err
+		}
+	}
+	if flags.F.FinalizerAdd && !lbc.fromSource(ing) {
 		if err := utils.AddFinalizer(ing, ingClient); err != nil {
 			klog.Errorf("Failed to add Finalizer to Ingress %q: %v", key, err)
+			reason = metrics.ReasonKubernetes
 			return err
 		}
 	}
@@ -484,30 +1032,190 @@ func (lbc *LoadBalancerController) sync(key string) error {
 
 	if errs != nil {
 		msg := fmt.Errorf("error while evaluating the ingress spec: %v", utils.JoinErrs(errs))
-		lbc.ctx.Recorder(ing.Namespace).Eventf(ing, apiv1.EventTypeWarning, "Translate", msg.Error())
+		lbc.syncErrors.Failure(lbc.ctx.Recorder(ing.Namespace), ing, "Translate", msg.Error())
+		reason = metrics.ReasonTranslate
 		return msg
 	}
 
+	// Retrying will not help an Ingress which violates an organization policy
+	// until the policy changes, which the periodic resync picks up.
+	if err := lbc.checkOrgPolicy(ing); err != nil {
+		lbc.syncErrors.Failure(lbc.ctx.Recorder(ing.Namespace), ing, "OrgPolicy", err.Error())
+		reason = metrics.ReasonOrgPolicy
+		return nil
+	}
+	if err := lbc.checkQuota(urlMap); err != nil {
+		lbc.syncErrors.Failure(lbc.ctx.Recorder(ing.Namespace), ing, "QuotaExceeded", err.Error())
+		reason = metrics.ReasonQuotaExceeded
+		// Garbage collecting may free enough quota for the next sync.
+		if gcErr := lbc.ingSyncer.GC(allIngresses); gcErr != nil {
+			return fmt.Errorf("error checking quotas %v, error during GC %v", err, gcErr)
+		}
+		return err
+	}
+
 	// Sync GCP resources.
-	syncState := &syncState{urlMap, ing, nil}
+	syncState := &syncState{urlMap, ing, nil, loadbalancers.Conditions{}}
 	syncErr := lbc.ingSyncer.Sync(syncState)
+	if err := lbc.updateConditions(ing, syncState.conditions); err != nil {
+		klog.Errorf("Failed to update conditions of Ingress %q: %v", key, err)
+	}
+	if constraint, ok := orgpolicy.ViolatedConstraint(syncErr); ok {
+		lbc.syncErrors.Failure(lbc.ctx.Recorder(ing.Namespace), ing, "OrgPolicy", fmt.Sprintf("Denied by organization policy constraint %s: %v", constraint, syncErr))
+	} else if syncErr != nil {
+		lbc.syncErrors.Failure(lbc.ctx.Recorder(ing.Namespace), ing, "Sync", fmt.Sprintf("Error during sync: %v", syncErr.Error()))
+	}
 	if syncErr != nil {
-		lbc.ctx.Recorder(ing.Namespace).Eventf(ing, apiv1.EventTypeWarning, "Sync", fmt.Sprintf("Error during sync: %v", syncErr.Error()))
+		reason = syncErrorReason(syncErr, syncState.conditions)
 	}
 
 	// Garbage collection will occur regardless of an error occurring. If an error occurred,
 	// it could have been caused by quota issues; therefore, garbage collecting now may
 	// free up enough quota for the next sync to pass.
 	if gcErr := lbc.ingSyncer.GC(allIngresses); gcErr != nil {
+		if reason == "" {
+			reason = metrics.ReasonGC
+		}
 		return fmt.Errorf("error during sync %v, error during GC %v", syncErr, gcErr)
 	}
 
+	if _, ok := orgpolicy.ViolatedConstraint(syncErr); ok {
+		return nil
+	}
 	return syncErr
 }
 
+// syncErrorReason returns the reason of the failure of the sync of an Ingress
+// to GCE, from the error and the stage which failed.
+func syncErrorReason(err error, conditions loadbalancers.Conditions) string {
+	if _, ok := orgpolicy.ViolatedConstraint(err); ok {
+		return metrics.ReasonOrgPolicy
+	}
+	// The errors of the GCE API end with their reason.
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "quotaExceeded"):
+		return metrics.ReasonQuotaExceeded
+	case strings.Contains(msg, "rateLimitExceeded"), strings.Contains(msg, "userRateLimitExceeded"):
+		return metrics.ReasonRateLimited
+	}
+	for _, stage := range []struct{ condition, reason string }{
+		{loadbalancers.BackendsHealthy, metrics.ReasonBackends},
+		{loadbalancers.UrlMapReady, metrics.ReasonUrlMap},
+		{loadbalancers.CertificatesReady, metrics.ReasonCertificates},
+		{loadbalancers.FrontendReady, metrics.ReasonFrontend},
+	} {
+		if cond := conditions[stage.condition]; cond != nil && cond.Reason == loadbalancers.ReasonSyncFailed {
+			return stage.reason
+		}
+	}
+	return metrics.ReasonUnknown
+}
+
+// checkOrgPolicy returns an ErrOrgPolicyViolation if the load balancer of the
+// Ingress violates an organization policy of the project. Failing to get the
+// policies is not fatal, the GCE API enforces them regardless.
+func (lbc *LoadBalancerController) checkOrgPolicy(ing *v1beta1.Ingress) error {
+	if lbc.orgPolicy == nil {
+		return nil
+	}
+	policies, err := lbc.orgPolicy.Policies()
+	if err != nil {
+		klog.Warningf("Failed to get organization policies, not checking Ingress %s/%s: %v", ing.Namespace, ing.Name, err)
+		return nil
+	}
+	lbType := orgpolicy.ExternalHTTPSLoadBalancer
+	if utils.IsGCEL7ILBIngress(ing, lbc.ctx.IngressClasses) {
+		lbType = orgpolicy.InternalHTTPSLoadBalancer
+	}
+	tls := len(ing.Spec.TLS) > 0 || annotations.FromIngress(ing).UseNamedTLS() != ""
+	return orgpolicy.Check(policies, lbType, tls)
+}
+
+// checkQuota returns an ErrQuotaExceeded if the backend services of the
+// Ingress which do not exist yet, and their health checks, would exceed the
+// quotas of the project.
+func (lbc *LoadBalancerController) checkQuota(urlMap *utils.GCEURLMap) error {
+	if lbc.ctx.Quota == nil {
+		return nil
+	}
+	names := sets.NewString()
+	for _, sp := range urlMap.AllServicePorts() {
+		// The regional backend services of L7-ILB have regional quotas.
+		if features.ScopeFromServicePort(&sp) != meta.Global {
+			continue
+		}
+		names.Insert(sp.BackendName(lbc.ctx.ClusterNamer))
+	}
+	existing := func() (sets.String, error) {
+		key, err := composite.CreateKey(lbc.ctx.Cloud, "", meta.Global)
+		if err != nil {
+			return nil, err
+		}
+		backends, err := composite.ListBackendServices(lbc.ctx.Cloud, key, meta.VersionGA)
+		if err != nil {
+			return nil, err
+		}
+		have := sets.NewString()
+		for _, be := range backends {
+			have.Insert(be.Name)
+		}
+		return have, nil
+	}
+	return lbc.ctx.Quota.Check(names.List(), existing, quota.BackendServices, quota.HealthChecks)
+}
+
+// updateConditions records the conditions updated by the sync of the Ingress
+// in its conditions annotation.
+func (lbc *LoadBalancerController) updateConditions(ing *v1beta1.Ingress, conditions loadbalancers.Conditions) error {
+	if lbc.fromSource(ing) || len(conditions) == 0 {
+		return nil
+	}
+	ingClient := lbc.ctx.KubeClient.NetworkingV1beta1().Ingresses(ing.Namespace)
+	currIng, err := ingClient.Get(ing.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	value, changed, err := loadbalancers.MergeConditions(currIng.Annotations[loadbalancers.ConditionsAnnotationKey], conditions, metav1.Now())
+	if err != nil || !changed {
+		return err
+	}
+	if currIng.Annotations == nil {
+		currIng.Annotations = map[string]string{}
+	}
+	currIng.Annotations[loadbalancers.ConditionsAnnotationKey] = value
+	_, err = ingClient.Update(currIng)
+	return err
+}
+
+// backendsHealthy sets the BackendsHealthy condition from the backends
+// annotation, which maps the backends of the Ingress to their health.
+func backendsHealthy(conditions loadbalancers.Conditions, ingAnnotations map[string]string) {
+	var states map[string]string
+	if err := json.Unmarshal([]byte(loadbalancers.GCEResourceName(ingAnnotations, "backends")), &states); err != nil {
+		conditions.Set(loadbalancers.BackendsHealthy, metav1.ConditionUnknown, "", "")
+		return
+	}
+	var unhealthy []string
+	for name, state := range states {
+		if state != "HEALTHY" {
+			unhealthy = append(unhealthy, fmt.Sprintf("%s: %s", name, state))
+		}
+	}
+	if len(unhealthy) > 0 {
+		sort.Strings(unhealthy)
+		conditions.Set(loadbalancers.BackendsHealthy, metav1.ConditionFalse, loadbalancers.ReasonUnhealthy, strings.Join(unhealthy, ", "))
+		return
+	}
+	conditions.Set(loadbalancers.BackendsHealthy, metav1.ConditionTrue, loadbalancers.ReasonSynced, "")
+}
+
 // updateIngressStatus updates the IP and annotations of a loadbalancer.
 // The annotations are parsed by kubectl describe.
-func (lbc *LoadBalancerController) updateIngressStatus(l7 *loadbalancers.L7, ing *v1beta1.Ingress) error {
+func (lbc *LoadBalancerController) updateIngressStatus(l7 *loadbalancers.L7, ing *v1beta1.Ingress, conditions loadbalancers.Conditions) error {
+	if lbc.fromSource(ing) {
+		return lbc.ctx.IngressSource.UpdateStatus(ing, l7.GetIP())
+	}
 	ingClient := lbc.ctx.KubeClient.NetworkingV1beta1().Ingresses(ing.Namespace)
 
 	// Update IP through update/status endpoint
@@ -539,6 +1247,7 @@ func (lbc *LoadBalancerController) updateIngressStatus(l7 *loadbalancers.L7, ing
 	if err != nil {
 		return err
 	}
+	backendsHealthy(conditions, annotations)
 
 	if err := updateAnnotations(lbc.ctx.KubeClient, ing.Name, ing.Namespace, annotations); err != nil {
 		return err
@@ -546,17 +1255,20 @@ func (lbc *LoadBalancerController) updateIngressStatus(l7 *loadbalancers.L7, ing
 	return nil
 }
 
+// fromSource returns true if the Ingress is provided by the IngressSource of
+// the context.
+func (lbc *LoadBalancerController) fromSource(ing *v1beta1.Ingress) bool {
+	return lbc.ctx.IngressSource != nil && lbc.ctx.IngressSource.Owns(ing)
+}
+
 // toRuntimeInfo returns L7RuntimeInfo for the given ingress.
 func (lbc *LoadBalancerController) toRuntimeInfo(ing *v1beta1.Ingress, urlMap *utils.GCEURLMap) (*loadbalancers.L7RuntimeInfo, error) {
-	k, err := utils.KeyFunc(ing)
-	if err != nil {
+	if _, err := utils.KeyFunc(ing); err != nil {
 		return nil, fmt.Errorf("cannot get key for Ingress %v/%v: %v", ing.Namespace, ing.Name, err)
 	}
 
-	var tls []*loadbalancers.TLSCerts
-
 	annotations := annotations.FromIngress(ing)
-	tls, err = lbc.tlsLoader.Load(ing)
+	tls, err := lbc.tlsLoader.Load(ing)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			// TODO: this path should be removed when external certificate managers migrate to a better solution.
@@ -574,23 +1286,70 @@ func (lbc *LoadBalancerController) toRuntimeInfo(ing *v1beta1.Ingress, urlMap *u
 		if err != nil {
 			lbc.ctx.Recorder(ing.Namespace).Eventf(ing, apiv1.EventTypeWarning, "Sync", fmt.Sprintf("%v", err))
 		}
+		if flags.F.EnableDefaultConfigs {
+			if feConfig, err = frontendconfig.WithDefaults(lbc.ctx.FrontendConfigs().List(), feConfig, ing.Namespace, flags.F.DefaultConfigNamespace); err != nil {
+				return nil, err
+			}
+		}
+		if feConfig != nil {
+			if err := frontendconfig.Validate(feConfig); err != nil {
+				// Ignore the invalid FrontendConfig, leaving the frontend
+				// features it configures unchanged.
+				lbc.ctx.Recorder(ing.Namespace).Eventf(ing, apiv1.EventTypeWarning, "Sync", fmt.Sprintf("%v", err))
+				feConfig = nil
+			}
+		}
 		// Object in cache could be changed in-flight. Deepcopy to
 		// reduce race conditions.
 		feConfig = feConfig.DeepCopy()
 	}
 
 	return &loadbalancers.L7RuntimeInfo{
-		Name:           k,
-		TLS:            tls,
-		TLSName:        annotations.UseNamedTLS(),
-		Ingress:        ing,
-		AllowHTTP:      annotations.AllowHTTP(),
-		StaticIPName:   annotations.StaticIPName(),
-		UrlMap:         urlMap,
-		FrontendConfig: feConfig,
+		Name:            lbc.lbName(ing),
+		TLS:             tls,
+		TLSName:         annotations.UseNamedTLS(),
+		Ingress:         ing,
+		IngressClasses:  lbc.ctx.IngressClasses,
+		AllowHTTP:       annotations.AllowHTTP(),
+		StaticIPName:    annotations.StaticIPName(),
+		ManagedStaticIP: annotations.ManagedStaticIP(),
+		UrlMap:          urlMap,
+		UserURLMap:      annotations.URLMap(),
+		FrontendConfig:  feConfig,
+		ServiceLabels:   lbc.serviceLabels(urlMap),
 	}, nil
 }
 
+// serviceLabels returns the labels of the Services of the url map, merged in
+// the order of their namespaced names, or nil if no labels are propagated.
+func (lbc *LoadBalancerController) serviceLabels(urlMap *utils.GCEURLMap) map[string]string {
+	if len(flags.F.PropagatedLabels) == 0 || urlMap == nil {
+		return nil
+	}
+	var keys []string
+	seen := map[string]bool{}
+	for _, sp := range urlMap.AllServicePorts() {
+		if key := sp.ID.Service.String(); !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	labels := map[string]string{}
+	for _, key := range keys {
+		obj, exists, err := lbc.ctx.ServiceInformer.GetIndexer().GetByKey(key)
+		if err != nil || !exists {
+			continue
+		}
+		for k, v := range obj.(*apiv1.Service).Labels {
+			if _, ok := labels[k]; !ok {
+				labels[k] = v
+			}
+		}
+	}
+	return labels
+}
+
 func updateAnnotations(client kubernetes.Interface, name, namespace string, annotations map[string]string) error {
 	ingClient := client.NetworkingV1beta1().Ingresses(namespace)
 	currIng, err := ingClient.Get(name, metav1.GetOptions{})
@@ -613,7 +1372,7 @@ func (lbc *LoadBalancerController) ToSvcPorts(ings []*v1beta1.Ingress) []utils.S
 	var knownPorts []utils.ServicePort
 	for _, ing := range ings {
 		// Only resources associated with GCE Ingress are managed by this controller.
-		if !utils.IsGCEIngress(ing) {
+		if !utils.IsGCEIngress(ing, lbc.ctx.IngressClasses) {
 			continue
 		}
 		urlMap, _ := lbc.Translator.TranslateIngress(ing, lbc.ctx.DefaultBackendSvcPort.ID)
@@ -623,14 +1382,25 @@ func (lbc *LoadBalancerController) ToSvcPorts(ings []*v1beta1.Ingress) []utils.S
 }
 
 // toLbNames returns a list of load balancers owned by this controller given a list of ingresses.
-func toLbNames(ings []*v1beta1.Ingress) []string {
+func (lbc *LoadBalancerController) toLbNames(ings []*v1beta1.Ingress) []string {
 	lbNames := make([]string, 0, len(ings))
 	for _, ing := range ings {
 		// Only resources associated with GCE Ingress are managed by this controller.
-		if !utils.IsGCEIngress(ing) {
+		if !utils.IsGCEIngress(ing, lbc.ctx.IngressClasses) {
 			continue
 		}
-		lbNames = append(lbNames, namer.IngressKeyFunc(ing))
+		lbNames = append(lbNames, lbc.lbName(ing))
 	}
 	return lbNames
 }
+
+// lbName returns the load balancer name of the Ingress in its naming scheme.
+// v1 load balancers are named by the key of the Ingress, which the namer
+// turns into their names.
+func (lbc *LoadBalancerController) lbName(ing *v1beta1.Ingress) string {
+	key := namer.IngressKeyFunc(ing)
+	if utils.NamingScheme(ing) == annotations.NamingSchemeV2 {
+		return lbc.ctx.ClusterNamer.LoadBalancerV2(key)
+	}
+	return key
+}
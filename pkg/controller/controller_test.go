@@ -17,27 +17,42 @@ limitations under the License.
 package controller
 
 import (
+	"encoding/json"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 	"github.com/google/go-cmp/cmp"
+	dto "github.com/prometheus/client_model/go"
+	compute "google.golang.org/api/compute/v1"
 	api_v1 "k8s.io/api/core/v1"
 	"k8s.io/api/networking/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/ingress-gce/pkg/annotations"
+	retainedloadbalancerv1beta1 "k8s.io/ingress-gce/pkg/apis/retainedloadbalancer/v1beta1"
 	backendconfigclient "k8s.io/ingress-gce/pkg/backendconfig/client/clientset/versioned/fake"
 	"k8s.io/ingress-gce/pkg/context"
+	"k8s.io/ingress-gce/pkg/controller/metrics"
 	"k8s.io/ingress-gce/pkg/events"
 	"k8s.io/ingress-gce/pkg/flags"
+	"k8s.io/ingress-gce/pkg/identity"
 	"k8s.io/ingress-gce/pkg/instances"
 	"k8s.io/ingress-gce/pkg/loadbalancers"
+	"k8s.io/ingress-gce/pkg/orgpolicy"
+	"k8s.io/ingress-gce/pkg/quota"
 	"k8s.io/ingress-gce/pkg/test"
 	"k8s.io/ingress-gce/pkg/tls"
 	"k8s.io/ingress-gce/pkg/utils"
@@ -84,7 +99,7 @@ func newLoadBalancerController() *LoadBalancerController {
 	lbc := NewLoadBalancerController(ctx, stopCh)
 	// TODO(rramkumar): Fix this so we don't have to override with our fake
 	lbc.instancePool = instances.NewNodePool(instances.NewFakeInstanceGroups(sets.NewString(), namer), namer)
-	lbc.l7Pool = loadbalancers.NewLoadBalancerPool(fakeGCE, namer, events.RecorderProducerMock{})
+	lbc.l7Pool = loadbalancers.NewLoadBalancerPool(fakeGCE, nil, nil, namer, events.RecorderProducerMock{})
 	lbc.instancePool.Init(&instances.FakeZoneLister{Zones: []string{"zone-a"}})
 
 	lbc.hasSynced = func() bool { return true }
@@ -180,10 +195,315 @@ func TestIngressSyncError(t *testing.T) {
 	}
 }
 
+// TestSyncMetrics asserts that the metrics of an Ingress record the reason of
+// its failed syncs until it is synced.
+func TestSyncMetrics(t *testing.T) {
+	lbc := newLoadBalancerController()
+
+	someBackend := backend("my-service", intstr.FromInt(80))
+	ing := test.NewIngress(types.NamespacedName{Name: "my-ingress", Namespace: "metrics"},
+		v1beta1.IngressSpec{
+			Backend: &someBackend,
+		})
+	addIngress(lbc, ing)
+
+	gauge := func(g interface{ Write(*dto.Metric) error }) float64 {
+		var m dto.Metric
+		if err := g.Write(&m); err != nil {
+			t.Fatalf("Write() = %v, want nil", err)
+		}
+		return m.GetGauge().GetValue()
+	}
+
+	ingStoreKey := getKey(ing, t)
+	for i := 0; i < 2; i++ {
+		if err := lbc.sync(ingStoreKey); err == nil {
+			t.Fatalf("lbc.sync(%v) = nil, want error for missing service", ingStoreKey)
+		}
+	}
+	if got := gauge(metrics.ConsecutiveFailures.WithLabelValues(ing.Namespace, ing.Name)); got != 2 {
+		t.Errorf("consecutive failures = %v, want 2", got)
+	}
+	if got := gauge(metrics.SyncError.WithLabelValues(ing.Namespace, ing.Name, metrics.ReasonTranslate)); got != 1 {
+		t.Errorf("sync error %q = %v, want 1", metrics.ReasonTranslate, got)
+	}
+
+	svc := test.NewService(types.NamespacedName{Name: "my-service", Namespace: "metrics"}, api_v1.ServiceSpec{
+		Type:  api_v1.ServiceTypeNodePort,
+		Ports: []api_v1.ServicePort{{Port: 80}},
+	})
+	addService(lbc, svc)
+	if err := lbc.sync(ingStoreKey); err != nil {
+		t.Fatalf("lbc.sync(%v) = err %v", ingStoreKey, err)
+	}
+	if got := gauge(metrics.ConsecutiveFailures.WithLabelValues(ing.Namespace, ing.Name)); got != 0 {
+		t.Errorf("consecutive failures = %v, want 0", got)
+	}
+	if got := gauge(metrics.LastSuccessfulSync.WithLabelValues(ing.Namespace, ing.Name)); got == 0 {
+		t.Errorf("last successful sync = 0, want the time of the sync")
+	}
+	// WithLabelValues recreates the deleted error with value 0.
+	if got := gauge(metrics.SyncError.WithLabelValues(ing.Namespace, ing.Name, metrics.ReasonTranslate)); got != 0 {
+		t.Errorf("sync error %q = %v, want 0", metrics.ReasonTranslate, got)
+	}
+}
+
+// TestReadinessCheck asserts that the controller is ready once its caches
+// synced and it reached GCE.
+func TestReadinessCheck(t *testing.T) {
+	lbc := newLoadBalancerController()
+	lbc.hasSynced = func() bool { return false }
+	if err := lbc.ctx.ReadinessCheck()["ingress"]; err == nil {
+		t.Errorf("readiness check = nil before the caches synced, want error")
+	}
+	lbc.hasSynced = func() bool { return true }
+	if err := lbc.ctx.ReadinessCheck()["ingress"]; err != nil {
+		t.Errorf("readiness check = %v, want nil", err)
+	}
+}
+
+// fakeShard owns the namespaces of the set.
+type fakeShard map[string]bool
+
+func (s fakeShard) Owns(namespace string) bool { return s[namespace] }
+
+func (s fakeShard) AddChangeHandler(func()) {}
+
+// TestShard asserts that the controller only syncs the Ingresses of the
+// namespaces owned by its shard.
+func TestShard(t *testing.T) {
+	lbc := newLoadBalancerController()
+	shard := fakeShard{}
+	lbc.ctx.Shard = shard
+
+	someBackend := backend("my-service", intstr.FromInt(80))
+	ing := test.NewIngress(types.NamespacedName{Name: "my-ingress", Namespace: "default"},
+		v1beta1.IngressSpec{
+			Backend: &someBackend,
+		})
+	addIngress(lbc, ing)
+
+	ingStoreKey := getKey(ing, t)
+	if err := lbc.sync(ingStoreKey); err != nil {
+		t.Errorf("lbc.sync(%v) = %v, want nil for an Ingress of another shard", ingStoreKey, err)
+	}
+	shard["default"] = true
+	if err := lbc.sync(ingStoreKey); err == nil {
+		t.Errorf("lbc.sync(%v) = nil, want error for missing service", ingStoreKey)
+	}
+}
+
+// TestIngressConditions asserts that the sync of an Ingress records the
+// conditions of its stages in the conditions annotation.
+func TestIngressConditions(t *testing.T) {
+	lbc := newLoadBalancerController()
+
+	svc := test.NewService(types.NamespacedName{Name: "my-service", Namespace: "default"}, api_v1.ServiceSpec{
+		Type:  api_v1.ServiceTypeNodePort,
+		Ports: []api_v1.ServicePort{{Port: 80}},
+	})
+	addService(lbc, svc)
+
+	defaultBackend := backend("my-service", intstr.FromInt(80))
+	ing := test.NewIngress(types.NamespacedName{Name: "my-ingress", Namespace: "default"},
+		v1beta1.IngressSpec{
+			Backend: &defaultBackend,
+		})
+	addIngress(lbc, ing)
+
+	ingStoreKey := getKey(ing, t)
+	if err := lbc.sync(ingStoreKey); err != nil {
+		t.Fatalf("lbc.sync(%v) = err %v", ingStoreKey, err)
+	}
+
+	updatedIng, _ := lbc.ctx.KubeClient.NetworkingV1beta1().Ingresses(ing.Namespace).Get(ing.Name, meta_v1.GetOptions{})
+	val, ok := updatedIng.GetAnnotations()[loadbalancers.ConditionsAnnotationKey]
+	if !ok {
+		t.Fatalf("Ingress.Annotations does not contain key %q", loadbalancers.ConditionsAnnotationKey)
+	}
+	var conditions []loadbalancers.Condition
+	if err := json.Unmarshal([]byte(val), &conditions); err != nil {
+		t.Fatalf("json.Unmarshal(%q) = %v", val, err)
+	}
+	got := map[string]meta_v1.ConditionStatus{}
+	for _, cond := range conditions {
+		got[cond.Type] = cond.Status
+	}
+	// The fake backend services have no health status.
+	want := map[string]meta_v1.ConditionStatus{
+		loadbalancers.UrlMapReady:     meta_v1.ConditionTrue,
+		loadbalancers.BackendsHealthy: meta_v1.ConditionFalse,
+		loadbalancers.FrontendReady:   meta_v1.ConditionTrue,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Got diff for conditions (-want +got):\n%s", diff)
+	}
+}
+
+// TestInstanceGroupsDisabled asserts that the controller does not sync nodes
+// nor create instance groups when instance groups are disabled, and that it
+// deletes the existing ones.
+func TestInstanceGroupsDisabled(t *testing.T) {
+	defer func(disable bool) { flags.F.DisableInstanceGroups = disable }(flags.F.DisableInstanceGroups)
+	flags.F.DisableInstanceGroups = true
+
+	lbc := newLoadBalancerController()
+	if lbc.nodes != nil {
+		t.Errorf("lbc.nodes = %v, want nil", lbc.nodes)
+	}
+	igName := lbc.ctx.ClusterNamer.InstanceGroup()
+	if _, err := lbc.instancePool.EnsureInstanceGroupsAndPorts(igName, []int64{30000}); err != nil {
+		t.Fatalf("lbc.instancePool.EnsureInstanceGroupsAndPorts() = %v", err)
+	}
+
+	defaultBackend := backend("my-service", intstr.FromInt(80))
+	ing := test.NewIngress(types.NamespacedName{Name: "my-ingress", Namespace: "default"},
+		v1beta1.IngressSpec{Backend: &defaultBackend})
+	addService(lbc, test.NewService(types.NamespacedName{Name: "my-service", Namespace: "default"}, api_v1.ServiceSpec{
+		Type:  api_v1.ServiceTypeNodePort,
+		Ports: []api_v1.ServicePort{{Port: 80}},
+	}))
+	addIngress(lbc, ing)
+
+	ingStoreKey := getKey(ing, t)
+	err := lbc.sync(ingStoreKey)
+	if err == nil || !strings.Contains(err.Error(), "instance groups are disabled") {
+		t.Errorf("lbc.sync(%v) = %v, want instance groups disabled error", ingStoreKey, err)
+	}
+
+	if err := lbc.GCBackends([]*v1beta1.Ingress{ing}); err != nil {
+		t.Fatalf("lbc.GCBackends() = %v", err)
+	}
+	igs, err := lbc.instancePool.List()
+	if err != nil {
+		t.Fatalf("lbc.instancePool.List() = %v", err)
+	}
+	if len(igs) != 0 {
+		t.Errorf("Got instance groups %v, want none", igs)
+	}
+
+	// Once the instance groups are gone, GC no longer deletes them.
+	if _, err := lbc.instancePool.EnsureInstanceGroupsAndPorts(igName, []int64{30000}); err != nil {
+		t.Fatalf("lbc.instancePool.EnsureInstanceGroupsAndPorts() = %v", err)
+	}
+	if err := lbc.GCBackends([]*v1beta1.Ingress{ing}); err != nil {
+		t.Fatalf("lbc.GCBackends() = %v", err)
+	}
+	if igs, err := lbc.instancePool.List(); err != nil || len(igs) != 1 {
+		t.Errorf("lbc.instancePool.List() = %v, %v, want the instance group not deleted again", igs, err)
+	}
+}
+
 // TestIngressCreateDeleteFinalizer asserts that `sync` will will not return an
 // error for a good ingress config. It also tests garbage collection for
 // Ingresses that need to be deleted, and keep the ones that don't, depending
 // on whether Finalizer Adds and/or Removes are enabled.
+type fakeOrgPolicySource []orgpolicy.Policy
+
+func (f fakeOrgPolicySource) Policies() ([]orgpolicy.Policy, error) { return f, nil }
+
+func TestOrgPolicy(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		denied string
+		wantLB bool
+	}{
+		{
+			desc:   "allowed load balancer type",
+			denied: orgpolicy.InternalHTTPSLoadBalancer,
+			wantLB: true,
+		},
+		{
+			desc:   "denied load balancer type",
+			denied: orgpolicy.ExternalHTTPSLoadBalancer,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			lbc := newLoadBalancerController()
+			lbc.orgPolicy = fakeOrgPolicySource{{
+				Constraint: orgpolicy.RestrictLoadBalancerTypesConstraint,
+				ListPolicy: &orgpolicy.ListPolicy{DeniedValues: []string{tc.denied}},
+			}}
+
+			defaultBackend := backend("my-service", intstr.FromInt(80))
+			ing := test.NewIngress(types.NamespacedName{Name: "my-ingress", Namespace: "default"},
+				v1beta1.IngressSpec{Backend: &defaultBackend})
+			addService(lbc, test.NewService(types.NamespacedName{Name: "my-service", Namespace: "default"}, api_v1.ServiceSpec{
+				Type:  api_v1.ServiceTypeNodePort,
+				Ports: []api_v1.ServicePort{{Port: 80}},
+			}))
+			addIngress(lbc, ing)
+
+			// Violations are reported instead of being retried.
+			ingStoreKey := getKey(ing, t)
+			if err := lbc.sync(ingStoreKey); err != nil {
+				t.Fatalf("lbc.sync(%v) = %v, want nil", ingStoreKey, err)
+			}
+
+			frs, err := lbc.ctx.Cloud.ListGlobalForwardingRules()
+			if err != nil {
+				t.Fatalf("ListGlobalForwardingRules() = %v", err)
+			}
+			if gotLB := len(frs) > 0; gotLB != tc.wantLB {
+				t.Errorf("Got forwarding rules %v, want load balancer %v", frs, tc.wantLB)
+			}
+		})
+	}
+}
+
+func TestQuota(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		limit  float64
+		wantLB bool
+	}{
+		{
+			desc:   "within quota",
+			limit:  10,
+			wantLB: true,
+		},
+		{
+			desc:  "quota exceeded",
+			limit: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			lbc := newLoadBalancerController()
+			mockProjects := lbc.ctx.Cloud.Compute().(*cloud.MockGCE).Projects().(*cloud.MockProjects)
+			mockProjects.Objects[*meta.GlobalKey(lbc.ctx.Cloud.ProjectID())] = &cloud.MockProjectsObj{Obj: &compute.Project{
+				Quotas: []*compute.Quota{{Metric: quota.BackendServices, Limit: tc.limit, Usage: 1}},
+			}}
+			lbc.ctx.Quota = quota.NewChecker(lbc.ctx.Cloud)
+
+			defaultBackend := backend("my-service", intstr.FromInt(80))
+			ing := test.NewIngress(types.NamespacedName{Name: "my-ingress", Namespace: "default"},
+				v1beta1.IngressSpec{Backend: &defaultBackend})
+			addService(lbc, test.NewService(types.NamespacedName{Name: "my-service", Namespace: "default"}, api_v1.ServiceSpec{
+				Type:  api_v1.ServiceTypeNodePort,
+				Ports: []api_v1.ServicePort{{Port: 80}},
+			}))
+			addIngress(lbc, ing)
+
+			ingStoreKey := getKey(ing, t)
+			if err := lbc.sync(ingStoreKey); (err != nil) == tc.wantLB {
+				t.Fatalf("lbc.sync(%v) = %v, want error %t", ingStoreKey, err, !tc.wantLB)
+			}
+
+			frs, err := lbc.ctx.Cloud.ListGlobalForwardingRules()
+			if err != nil {
+				t.Fatalf("ListGlobalForwardingRules() = %v", err)
+			}
+			if gotLB := len(frs) > 0; gotLB != tc.wantLB {
+				t.Errorf("Got forwarding rules %v, want load balancer %v", frs, tc.wantLB)
+			}
+		})
+	}
+}
+
 func TestIngressCreateDeleteFinalizer(t *testing.T) {
 	var flagSaver saveFinalizerFlags
 	flagSaver.save()
@@ -664,3 +984,365 @@ func TestToRuntimeInfoCerts(t *testing.T) {
 		t.Errorf("lbInfo.TLS = %v, want %v", lbInfo.TLS, tlsCerts)
 	}
 }
+
+// fakeRetainedLoadBalancerClient creates and deletes RetainedLoadBalancers in
+// the store of their informer. The other methods are not implemented.
+type fakeRetainedLoadBalancerClient struct {
+	dynamic.NamespaceableResourceInterface
+	store     cache.Store
+	namespace string
+}
+
+func (c *fakeRetainedLoadBalancerClient) Namespace(namespace string) dynamic.ResourceInterface {
+	return &fakeRetainedLoadBalancerClient{store: c.store, namespace: namespace}
+}
+
+func (c *fakeRetainedLoadBalancerClient) Create(obj *unstructured.Unstructured, _ meta_v1.CreateOptions, _ ...string) (*unstructured.Unstructured, error) {
+	if _, exists, _ := c.store.GetByKey(c.namespace + "/" + obj.GetName()); exists {
+		return nil, apierrors.NewAlreadyExists(schema.GroupResource{}, obj.GetName())
+	}
+	return obj, c.store.Add(obj)
+}
+
+func (c *fakeRetainedLoadBalancerClient) Delete(name string, _ *meta_v1.DeleteOptions, _ ...string) error {
+	obj, exists, _ := c.store.GetByKey(c.namespace + "/" + name)
+	if !exists {
+		return apierrors.NewNotFound(schema.GroupResource{}, name)
+	}
+	return c.store.Delete(obj)
+}
+
+func TestRetainedLoadBalancer(t *testing.T) {
+	var flagSaver saveFinalizerFlags
+	flagSaver.save()
+	defer flagSaver.reset()
+	flags.F.FinalizerAdd = true
+	flags.F.FinalizerRemove = true
+
+	lbc := newLoadBalancerController()
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &unstructured.Unstructured{}, 0, cache.Indexers{})
+	lbc.ctx.RetainedLoadBalancerInformer = informer
+	lbc.ctx.RetainedLoadBalancerClient = &fakeRetainedLoadBalancerClient{store: informer.GetStore()}
+
+	addService(lbc, test.NewService(types.NamespacedName{Name: "my-service", Namespace: "default"}, api_v1.ServiceSpec{
+		Type:  api_v1.ServiceTypeNodePort,
+		Ports: []api_v1.ServicePort{{Port: 80}},
+	}))
+	defaultBackend := backend("my-service", intstr.FromInt(80))
+	newIngress := func() *v1beta1.Ingress {
+		ing := test.NewIngress(types.NamespacedName{Name: "my-ingress", Namespace: "default"}, v1beta1.IngressSpec{Backend: &defaultBackend})
+		ing.Annotations = map[string]string{annotations.RetainResourcesKey: "true"}
+		return ing
+	}
+	ing := newIngress()
+	addIngress(lbc, ing)
+	ingStoreKey := getKey(ing, t)
+
+	forwardingRules := func() int {
+		t.Helper()
+		frs, err := lbc.ctx.Cloud.ListGlobalForwardingRules()
+		if err != nil {
+			t.Fatalf("ListGlobalForwardingRules() = %v", err)
+		}
+		return len(frs)
+	}
+	records := func() []*retainedloadbalancerv1beta1.RetainedLoadBalancer {
+		t.Helper()
+		records, err := loadbalancers.ListRetainedLoadBalancers(informer)
+		if err != nil {
+			t.Fatalf("ListRetainedLoadBalancers() = %v", err)
+		}
+		return records
+	}
+	// deleteIngress deletes the Ingress once the controller removed its
+	// finalizer.
+	deleteIngress := func() {
+		t.Helper()
+		updatedIng, err := lbc.ctx.KubeClient.NetworkingV1beta1().Ingresses(ing.Namespace).Get(ing.Name, meta_v1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Get(%v) = %v", ingStoreKey, err)
+		}
+		setDeletionTimestamp(lbc, updatedIng)
+		if err := lbc.sync(ingStoreKey); err != nil {
+			t.Fatalf("lbc.sync(%v) = %v", ingStoreKey, err)
+		}
+		if updatedIng, err = lbc.ctx.KubeClient.NetworkingV1beta1().Ingresses(ing.Namespace).Get(ing.Name, meta_v1.GetOptions{}); err != nil {
+			t.Fatalf("Get(%v) = %v", ingStoreKey, err)
+		}
+		if len(updatedIng.Finalizers) != 0 {
+			t.Fatalf("Got finalizers %v, want none", updatedIng.Finalizers)
+		}
+		lbc.ctx.KubeClient.NetworkingV1beta1().Ingresses(ing.Namespace).Delete(ing.Name, &meta_v1.DeleteOptions{})
+		lbc.ctx.IngressInformer.GetIndexer().Delete(updatedIng)
+		if err := lbc.sync(ingStoreKey); err != nil {
+			t.Fatalf("lbc.sync(%v) = %v", ingStoreKey, err)
+		}
+	}
+
+	if err := lbc.sync(ingStoreKey); err != nil {
+		t.Fatalf("lbc.sync(%v) = %v", ingStoreKey, err)
+	}
+	if got := forwardingRules(); got != 1 {
+		t.Fatalf("Got %d forwarding rules, want 1", got)
+	}
+
+	// Deleting the Ingress records its load balancer, which is kept.
+	deleteIngress()
+	got := records()
+	if len(got) != 1 || got[0].Name != ing.Name || got[0].Spec.LoadBalancer != lbc.lbName(ing) || len(got[0].Spec.BackendServices) == 0 {
+		t.Fatalf("Got RetainedLoadBalancers %+v, want the load balancer %q and its backend services", got, lbc.lbName(ing))
+	}
+	if got := forwardingRules(); got != 1 {
+		t.Errorf("Got %d forwarding rules after the deletion of the Ingress, want the retained one", got)
+	}
+	lbNames, backends, err := lbc.DesiredResources()
+	if err != nil || len(lbNames) != 1 || lbNames[0] != lbc.lbName(ing) || len(backends) == 0 {
+		t.Errorf("DesiredResources() = %v, %v, %v, want the retained load balancer and its backend services", lbNames, backends, err)
+	}
+
+	// Recreating the Ingress adopts the load balancer, its record is deleted.
+	ing = newIngress()
+	addIngress(lbc, ing)
+	if err := lbc.sync(ingStoreKey); err != nil {
+		t.Fatalf("lbc.sync(%v) = %v", ingStoreKey, err)
+	}
+	if got := records(); len(got) != 0 {
+		t.Errorf("Got RetainedLoadBalancers %+v after adoption, want none", got)
+	}
+	if got := forwardingRules(); got != 1 {
+		t.Errorf("Got %d forwarding rules after adoption, want 1", got)
+	}
+
+	// Deleting the record releases the load balancer of the deleted Ingress.
+	deleteIngress()
+	if got := records(); len(got) != 1 {
+		t.Fatalf("Got RetainedLoadBalancers %+v, want 1", got)
+	}
+	if err := lbc.ctx.RetainedLoadBalancerClient.Namespace(ing.Namespace).Delete(ing.Name, &meta_v1.DeleteOptions{}); err != nil {
+		t.Fatalf("Delete() = %v", err)
+	}
+	if err := lbc.ingSyncer.GC(lbc.ctx.Ingresses().List()); err != nil {
+		t.Fatalf("GC() = %v", err)
+	}
+	if got := forwardingRules(); got != 0 {
+		t.Errorf("Got %d forwarding rules after the release, want 0", got)
+	}
+}
+
+func TestNEGGroupKeys(t *testing.T) {
+	lbc := newLoadBalancerController()
+	svcName := types.NamespacedName{Name: "my-service", Namespace: "default"}
+	svc := test.NewService(svcName, api_v1.ServiceSpec{Ports: []api_v1.ServicePort{{Port: 80}}})
+	addService(lbc, svc)
+	sp := utils.ServicePort{ID: utils.ServicePortID{Service: svcName}, Port: 80, NEGEnabled: true}
+	zones := []string{"zone-a", "zone-b"}
+
+	for _, tc := range []struct {
+		desc     string
+		negZones string
+		want     []string
+	}{
+		{desc: "no pinned zones", want: zones},
+		{desc: "pinned zone", negZones: "zone-b,zone-c", want: []string{"zone-b"}},
+		// The NEGs of all the zones stay linked rather than detaching them all.
+		{desc: "pinned to no zone of the cluster", negZones: "zone-c", want: zones},
+	} {
+		svc.Annotations = nil
+		if tc.negZones != "" {
+			svc.Annotations = map[string]string{annotations.NEGZonesKey: tc.negZones}
+		}
+		lbc.ctx.ServiceInformer.GetIndexer().Update(svc)
+		var got []string
+		for _, key := range lbc.negGroupKeys(sp, zones) {
+			got = append(got, key.Zone)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("%s: negGroupKeys() returned unexpected zones (-want +got):\n%s", tc.desc, diff)
+		}
+	}
+}
+
+func TestIngressesForProbeChange(t *testing.T) {
+	defer func(enable bool) { flags.F.EnableNEGProbeHealthChecks = enable }(flags.F.EnableNEGProbeHealthChecks)
+	flags.F.EnableNEGProbeHealthChecks = true
+
+	lbc := newLoadBalancerController()
+	svcName := types.NamespacedName{Name: "my-service", Namespace: "default"}
+	svc := test.NewService(svcName, api_v1.ServiceSpec{
+		Selector: map[string]string{"app": "web"},
+		Ports:    []api_v1.ServicePort{{Port: 80, TargetPort: intstr.FromInt(8080)}},
+	})
+	addService(lbc, svc)
+	ing := test.NewIngress(types.NamespacedName{Name: "my-ingress", Namespace: "default"},
+		v1beta1.IngressSpec{Backend: &v1beta1.IngressBackend{ServiceName: svcName.Name, ServicePort: intstr.FromInt(80)}})
+	addIngress(lbc, ing)
+
+	newPod := func(name, path string, age time.Duration) *api_v1.Pod {
+		return &api_v1.Pod{
+			ObjectMeta: meta_v1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				Labels:            map[string]string{"app": "web"},
+				CreationTimestamp: meta_v1.NewTime(time.Now().Add(-age)),
+			},
+			Spec: api_v1.PodSpec{
+				Containers: []api_v1.Container{{
+					Ports: []api_v1.ContainerPort{{ContainerPort: 8080}},
+					ReadinessProbe: &api_v1.Probe{
+						Handler: api_v1.Handler{
+							HTTPGet: &api_v1.HTTPGetAction{Path: path, Port: intstr.FromInt(8080)},
+						},
+					},
+				}},
+			},
+		}
+	}
+	oldPod := newPod("old", "/old", time.Hour)
+	lbc.ctx.PodInformer.GetIndexer().Add(oldPod)
+
+	// The probe was not picked by any sync of the Service yet.
+	if got := lbc.ingressesForProbeChange(oldPod); len(got) != 0 {
+		t.Errorf("ingressesForProbeChange() = %v before a sync, want none", got)
+	}
+	sp := utils.ServicePort{ID: utils.ServicePortID{Service: svcName}, Port: 80, NEGEnabled: true}
+	if _, err := lbc.Translator.GetProbe(sp); err != nil {
+		t.Fatalf("GetProbe(%+v) = %v", sp, err)
+	}
+
+	// A newer Pod does not change the probe picked.
+	youngPod := newPod("young", "/young", time.Minute)
+	lbc.ctx.PodInformer.GetIndexer().Add(youngPod)
+	if got := lbc.ingressesForProbeChange(youngPod); len(got) != 0 {
+		t.Errorf("ingressesForProbeChange() = %v after adding a newer pod, want none", got)
+	}
+
+	// Deleting the oldest Pod switches to the probe of the newer one.
+	lbc.ctx.PodInformer.GetIndexer().Delete(oldPod)
+	got := lbc.ingressesForProbeChange(oldPod)
+	if len(got) != 1 || got[0].Name != ing.Name {
+		t.Errorf("ingressesForProbeChange() = %v after deleting the oldest pod, want [%v]", got, ing.Name)
+	}
+}
+
+func TestServiceLabels(t *testing.T) {
+	lbc := newLoadBalancerController()
+	defer func(labels []string) { flags.F.PropagatedLabels = labels }(flags.F.PropagatedLabels)
+	flags.F.PropagatedLabels = []string{"team"}
+
+	urlMap := utils.NewGCEURLMap()
+	for _, svc := range []struct {
+		name   string
+		labels map[string]string
+	}{
+		{name: "b", labels: map[string]string{"team": "search", "tier": "web"}},
+		{name: "a", labels: map[string]string{"team": "payments"}},
+	} {
+		svcName := types.NamespacedName{Name: svc.name, Namespace: "default"}
+		s := test.NewService(svcName, api_v1.ServiceSpec{Ports: []api_v1.ServicePort{{Port: 80}}})
+		s.Labels = svc.labels
+		addService(lbc, s)
+		urlMap.PutPathRulesForHost(svc.name+".example.com", []utils.PathRule{{Path: "/", Backend: utils.ServicePort{ID: utils.ServicePortID{Service: svcName}}}})
+	}
+
+	// The labels of the Service named first win.
+	want := map[string]string{"team": "payments", "tier": "web"}
+	if diff := cmp.Diff(want, lbc.serviceLabels(urlMap)); diff != "" {
+		t.Errorf("serviceLabels() returned unexpected labels (-want +got):\n%s", diff)
+	}
+}
+
+// recordMockOperations records in operations the calls to the resources of
+// mockGCE, named <Resource>.<Method> as in the cloud library. Hooks already
+// set on the mocks are kept.
+func recordMockOperations(mockGCE *cloud.MockGCE, operations sets.String) {
+	mocks := reflect.ValueOf(mockGCE).Elem()
+	for m := 0; m < mocks.NumField(); m++ {
+		mock := mocks.Field(m)
+		if mock.Kind() != reflect.Ptr || mock.IsNil() || mock.Elem().Kind() != reflect.Struct {
+			continue
+		}
+		resource := strings.TrimPrefix(mocks.Type().Field(m).Name, "Mock")
+		resource = strings.TrimPrefix(strings.TrimPrefix(resource, "Alpha"), "Beta")
+		for h := 0; h < mock.Elem().NumField(); h++ {
+			hook := mock.Elem().Field(h)
+			name := mock.Elem().Type().Field(h).Name
+			if hook.Kind() != reflect.Func || !hook.CanSet() || !strings.HasSuffix(name, "Hook") {
+				continue
+			}
+			operation := resource + "." + strings.TrimSuffix(name, "Hook")
+			hookType := hook.Type()
+			original := reflect.ValueOf(hook.Interface())
+			hook.Set(reflect.MakeFunc(hookType, func(args []reflect.Value) []reflect.Value {
+				operations.Insert(operation)
+				if !original.IsNil() {
+					return original.Call(args)
+				}
+				out := make([]reflect.Value, hookType.NumOut())
+				for i := range out {
+					out[i] = reflect.Zero(hookType.Out(i))
+				}
+				return out
+			}))
+		}
+	}
+}
+
+// TestOperationPermissions asserts that the permissions of all the cloud
+// operations made to sync and delete an Ingress are known.
+func TestOperationPermissions(t *testing.T) {
+	var flagSaver saveFinalizerFlags
+	flagSaver.save()
+	defer flagSaver.reset()
+	flags.F.FinalizerAdd = true
+	flags.F.FinalizerRemove = true
+
+	lbc := newLoadBalancerController()
+	operations := sets.NewString()
+	recordMockOperations(lbc.ctx.Cloud.Compute().(*cloud.MockGCE), operations)
+	lbc.tlsLoader = &tls.FakeTLSSecretLoader{FakeCerts: map[string]*loadbalancers.TLSCerts{
+		"tls-secret": {Key: "key", Cert: "cert", Name: "tls-secret"},
+	}}
+
+	svc := test.NewService(types.NamespacedName{Name: "my-service", Namespace: "default"}, api_v1.ServiceSpec{
+		Type:  api_v1.ServiceTypeNodePort,
+		Ports: []api_v1.ServicePort{{Port: 80}},
+	})
+	addService(lbc, svc)
+	defaultBackend := backend("my-service", intstr.FromInt(80))
+	ing := test.NewIngress(types.NamespacedName{Name: "ing", Namespace: "default"}, v1beta1.IngressSpec{
+		Backend: &defaultBackend,
+		TLS:     []v1beta1.IngressTLS{{SecretName: "tls-secret"}},
+	})
+	addIngress(lbc, ing)
+	ingStoreKey := getKey(ing, t)
+	if err := lbc.sync(ingStoreKey); err != nil {
+		t.Fatalf("lbc.sync(%v) = %v, want nil", ingStoreKey, err)
+	}
+	// Update the load balancer with a new certificate and path rule.
+	lbc.tlsLoader = &tls.FakeTLSSecretLoader{FakeCerts: map[string]*loadbalancers.TLSCerts{
+		"tls-secret": {Key: "new-key", Cert: "new-cert", Name: "tls-secret"},
+	}}
+	updatedIng, _ := lbc.ctx.KubeClient.NetworkingV1beta1().Ingresses("default").Get(ing.Name, meta_v1.GetOptions{})
+	updatedIng.Spec.Rules = []v1beta1.IngressRule{{
+		Host: "foo.com",
+		IngressRuleValue: v1beta1.IngressRuleValue{HTTP: &v1beta1.HTTPIngressRuleValue{
+			Paths: []v1beta1.HTTPIngressPath{{Path: "/foo", Backend: backend("my-service", intstr.FromInt(80))}},
+		}},
+	}}
+	updateIngress(lbc, updatedIng)
+	if err := lbc.sync(ingStoreKey); err != nil {
+		t.Fatalf("lbc.sync(%v) = %v, want nil", ingStoreKey, err)
+	}
+
+	updatedIng, _ = lbc.ctx.KubeClient.NetworkingV1beta1().Ingresses("default").Get(ing.Name, meta_v1.GetOptions{})
+	setDeletionTimestamp(lbc, updatedIng)
+	if err := lbc.sync(ingStoreKey); err != nil {
+		t.Fatalf("lbc.sync(%v) = %v, want nil", ingStoreKey, err)
+	}
+
+	for _, operation := range operations.List() {
+		if _, ok := identity.OperationPermissions[operation]; !ok {
+			t.Errorf("The permissions of operation %s are unknown", operation)
+		}
+	}
+}
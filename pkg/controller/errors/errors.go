@@ -91,3 +91,79 @@ type ErrBackendConfigValidation struct {
 func (e ErrBackendConfigValidation) Error() string {
 	return fmt.Sprintf("BackendConfig %v/%v is not valid: %v", e.BackendConfig.Namespace, e.BackendConfig.Name, e.Err)
 }
+
+// ErrUnsupportedScopeFeature is returned when a BackendConfig enables a
+// feature which is not supported for the scope of the backend service.
+type ErrUnsupportedScopeFeature struct {
+	utils.ServicePortID
+	Feature string
+	Scope   string
+}
+
+// Error returns the port name/number, service name, the feature and the scope.
+func (e ErrUnsupportedScopeFeature) Error() string {
+	return fmt.Sprintf("%s is not supported for %s backend service of port %q on service %q", e.Feature, e.Scope, e.ServicePortID.Port.String(), e.ServicePortID.Service.String())
+}
+
+// ErrInstanceGroupsDisabled is returned when a service port does not use NEG
+// but instance group management is disabled.
+type ErrInstanceGroupsDisabled struct {
+	utils.ServicePortID
+}
+
+// Error returns the port name/number and service name.
+func (e ErrInstanceGroupsDisabled) Error() string {
+	return fmt.Sprintf("port %q on service %q requires NEG to be enabled, instance groups are disabled", e.ServicePortID.Port.String(), e.ServicePortID.Service.String())
+}
+
+// ErrMissingProxyOnlySubnet is returned when there is no active proxy-only
+// subnet in the network and region of an internal load balancer.
+type ErrMissingProxyOnlySubnet struct {
+	Network string
+	Region  string
+}
+
+// Error returns the network and region and how to create the subnet.
+func (e ErrMissingProxyOnlySubnet) Error() string {
+	return fmt.Sprintf("no active proxy-only subnet in network %q and region %q, create one with "+
+		"\"gcloud compute networks subnets create proxy-only --purpose=INTERNAL_HTTPS_LOAD_BALANCER --role=ACTIVE --network=%s --region=%s --range=<CIDR>\" "+
+		"or set --l7-ilb-proxy-subnet-cidr to let the controller create it", e.Network, e.Region, e.Network, e.Region)
+}
+
+// ErrProtocolRequiresNEG is returned when the app protocol of a service port
+// is only supported for NEG backends.
+type ErrProtocolRequiresNEG struct {
+	utils.ServicePortID
+	Protocol annotations.AppProtocol
+}
+
+// Error returns the port name/number, service name and the protocol.
+func (e ErrProtocolRequiresNEG) Error() string {
+	return fmt.Sprintf("app protocol %s of port %q on service %q requires NEG to be enabled", e.Protocol, e.ServicePortID.Port.String(), e.ServicePortID.Service.String())
+}
+
+// ErrOrgPolicyViolation is returned when the resources of an Ingress would
+// violate an organization policy constraint of the project.
+type ErrOrgPolicyViolation struct {
+	Constraint string
+	Reason     string
+}
+
+// Error returns the constraint and why it is violated.
+func (e ErrOrgPolicyViolation) Error() string {
+	return fmt.Sprintf("organization policy constraint %s is violated: %s", e.Constraint, e.Reason)
+}
+
+// ErrQuotaExceeded is returned when creating the resources of an Ingress or
+// Service would exceed a quota of the project.
+type ErrQuotaExceeded struct {
+	Metric   string
+	Limit    float64
+	Usage    float64
+	Required int
+}
+
+// Error returns the quota metric, its usage and the number of resources to create.
+func (e ErrQuotaExceeded) Error() string {
+	return fmt.Sprintf("quota %s of the project would be exceeded: %d more needed, %v of %v used", e.Metric, e.Required, e.Usage, e.Limit)
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/ingress-gce/pkg/metrics"
+)
+
+const (
+	ingressSubsystem = "ingress"
+
+	lastSuccessfulSyncKey  = "last_successful_sync_timestamp_seconds"
+	consecutiveFailuresKey = "consecutive_sync_failures"
+	syncErrorKey           = "sync_error"
+)
+
+// Reasons of the failed syncs of an Ingress. The set is bounded to bound the
+// cardinality of the metrics.
+const (
+	// ReasonTranslate is the reason of Ingresses with an invalid spec.
+	ReasonTranslate = "Translate"
+	// ReasonOrgPolicy is the reason of Ingresses violating an organization
+	// policy.
+	ReasonOrgPolicy = "OrgPolicy"
+	// ReasonQuotaExceeded is the reason of syncs exceeding a GCE quota.
+	ReasonQuotaExceeded = "QuotaExceeded"
+	// ReasonRateLimited is the reason of syncs exceeding a GCE rate limit.
+	ReasonRateLimited = "RateLimited"
+	// ReasonBackends, ReasonUrlMap, ReasonCertificates and ReasonFrontend
+	// are the reasons of syncs failing at the stage of the same name.
+	ReasonBackends     = "Backends"
+	ReasonUrlMap       = "UrlMap"
+	ReasonCertificates = "Certificates"
+	ReasonFrontend     = "Frontend"
+	// ReasonKubernetes is the reason of syncs failing to update the Ingress.
+	ReasonKubernetes = "Kubernetes"
+	// ReasonGC is the reason of syncs failing to garbage collect.
+	ReasonGC = "GC"
+	// ReasonUnknown is the reason of other failures.
+	ReasonUnknown = "Unknown"
+)
+
+var reasons = []string{
+	ReasonTranslate,
+	ReasonOrgPolicy,
+	ReasonQuotaExceeded,
+	ReasonRateLimited,
+	ReasonBackends,
+	ReasonUrlMap,
+	ReasonCertificates,
+	ReasonFrontend,
+	ReasonKubernetes,
+	ReasonGC,
+	ReasonUnknown,
+}
+
+var (
+	ingressLabels = []string{
+		"namespace", // The namespace of the Ingress.
+		"name",      // The name of the Ingress.
+	}
+
+	// LastSuccessfulSync is the time of the last successful sync of each
+	// Ingress.
+	LastSuccessfulSync = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.GLBC_NAMESPACE,
+			Subsystem: ingressSubsystem,
+			Name:      lastSuccessfulSyncKey,
+			Help:      "Time of the last successful sync of an Ingress in seconds since the epoch",
+		},
+		ingressLabels,
+	)
+
+	// ConsecutiveFailures is the number of failed syncs of each Ingress since
+	// its last successful sync.
+	ConsecutiveFailures = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.GLBC_NAMESPACE,
+			Subsystem: ingressSubsystem,
+			Name:      consecutiveFailuresKey,
+			Help:      "Number of failed syncs of an Ingress since its last successful sync",
+		},
+		ingressLabels,
+	)
+
+	// SyncError is 1 for the reason of the last sync of each Ingress which
+	// failed, and unset for the Ingresses whose last sync succeeded.
+	SyncError = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.GLBC_NAMESPACE,
+			Subsystem: ingressSubsystem,
+			Name:      syncErrorKey,
+			Help:      "Reason of the failure of the last sync of an Ingress",
+		},
+		append(ingressLabels, "reason"),
+	)
+)
+
+var register sync.Once
+
+func RegisterMetrics() {
+	register.Do(func() {
+		prometheus.MustRegister(LastSuccessfulSync)
+		prometheus.MustRegister(ConsecutiveFailures)
+		prometheus.MustRegister(SyncError)
+	})
+}
+
+// ObserveSync publishes the result of a sync of an Ingress, which failed
+// with the given reason if not empty.
+func ObserveSync(namespace, name, reason string, now time.Time) {
+	for _, r := range reasons {
+		if r != reason {
+			SyncError.DeleteLabelValues(namespace, name, r)
+		}
+	}
+	if reason == "" {
+		LastSuccessfulSync.WithLabelValues(namespace, name).Set(float64(now.Unix()))
+		ConsecutiveFailures.WithLabelValues(namespace, name).Set(0)
+		return
+	}
+	ConsecutiveFailures.WithLabelValues(namespace, name).Inc()
+	SyncError.WithLabelValues(namespace, name, reason).Set(1)
+}
+
+// DeleteIngress removes the metrics of a deleted Ingress.
+func DeleteIngress(namespace, name string) {
+	LastSuccessfulSync.DeleteLabelValues(namespace, name)
+	ConsecutiveFailures.DeleteLabelValues(namespace, name)
+	for _, r := range reasons {
+		SyncError.DeleteLabelValues(namespace, name, r)
+	}
+}
@@ -43,6 +43,12 @@ func NewNodeController(ctx *context.ControllerContext, instancePool instances.No
 		instancePool: instancePool,
 	}
 	c.queue = utils.NewPeriodicTaskQueue("", "nodes", c.sync)
+	if ctx.Operations != nil {
+		// All the nodes are synced regardless of the key.
+		instancePool.TrackOperations(instances.NewAsyncInstanceGroups(ctx.Cloud), ctx.Operations, func(key string) {
+			c.queue.Enqueue(cache.ExplicitKey(key))
+		})
+	}
 
 	ctx.NodeInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
@@ -71,7 +77,7 @@ func (c *NodeController) Shutdown() {
 }
 
 func (c *NodeController) sync(key string) error {
-	nodeNames, err := utils.GetReadyNodeNames(listers.NewNodeLister(c.lister))
+	nodeNames, err := utils.GetInstanceGroupNodeNames(listers.NewNodeLister(c.lister))
 	if err != nil {
 		return err
 	}
@@ -16,16 +16,20 @@ package translator
 import (
 	"fmt"
 	"k8s.io/ingress-gce/pkg/flags"
+	"reflect"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
 
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
 	"k8s.io/klog"
 
 	api_v1 "k8s.io/api/core/v1"
 	"k8s.io/api/networking/v1beta1"
-	"k8s.io/apimachinery/pkg/api/meta"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/sets"
 	listers "k8s.io/client-go/listers/core/v1"
@@ -37,6 +41,7 @@ import (
 	"k8s.io/ingress-gce/pkg/context"
 	"k8s.io/ingress-gce/pkg/controller/errors"
 	"k8s.io/ingress-gce/pkg/loadbalancers"
+	"k8s.io/ingress-gce/pkg/metrics"
 	"k8s.io/ingress-gce/pkg/utils"
 )
 
@@ -47,12 +52,19 @@ type getServicePortParams struct {
 
 // NewTranslator returns a new Translator.
 func NewTranslator(ctx *context.ControllerContext) *Translator {
-	return &Translator{ctx}
+	metrics.RegisterAnnotationMetrics()
+	return &Translator{ctx: ctx, probes: map[string]*api_v1.Probe{}}
 }
 
 // Translator helps with kubernetes -> gce api conversion.
 type Translator struct {
 	ctx *context.ControllerContext
+
+	// probes holds the readiness probe picked for the health check of each
+	// NEG Service port by its last sync, by probeKey, with
+	// --enable-neg-probe-health-checks.
+	probes     map[string]*api_v1.Probe
+	probesLock sync.Mutex
 }
 
 func (t *Translator) getCachedService(id utils.ServicePortID) (*api_v1.Service, error) {
@@ -100,6 +112,23 @@ func maybeEnableNEG(sp *utils.ServicePort, svc *api_v1.Service) error {
 	return nil
 }
 
+// setHealthCheckPort sets the health check port of the NEG backend of the
+// service port, if overridden by the Service. An invalid annotation is
+// reported and ignored, so that the serving port stays health checked.
+func (t *Translator) setHealthCheckPort(sp *utils.ServicePort, svc *api_v1.Service) {
+	if !sp.NEGEnabled {
+		return
+	}
+	port, ok, err := annotations.FromService(svc).NEGHealthCheckPort()
+	if annotationErr, isAnnotationErr := err.(*annotations.AnnotationError); isAnnotationErr {
+		t.ctx.Recorder(svc.Namespace).Event(svc, api_v1.EventTypeWarning, "InvalidAnnotation", annotationErr.Error())
+		metrics.InvalidAnnotations.WithLabelValues(annotationErr.Key).Inc()
+	}
+	if ok && err == nil {
+		sp.HealthCheckPort = port
+	}
+}
+
 // setAppProtocol sets the app protocol on the service port
 func setAppProtocol(sp *utils.ServicePort, svc *api_v1.Service, port *api_v1.ServicePort) error {
 	appProtocols, err := annotations.FromService(svc).ApplicationProtocols()
@@ -125,13 +154,25 @@ func (t *Translator) maybeEnableBackendConfig(sp *utils.ServicePort, svc *api_v1
 		// service port, then do not return an error. Removing a reference
 		// to a backend config from the service annotation is a valid
 		// step that a user could take.
+		if annotationErr, ok := err.(*annotations.AnnotationError); ok {
+			t.ctx.Recorder(svc.Namespace).Event(svc, api_v1.EventTypeWarning, "InvalidAnnotation", annotationErr.Error())
+			metrics.InvalidAnnotations.WithLabelValues(annotationErr.Key).Inc()
+		}
 		if err != backendconfig.ErrNoBackendConfigForPort {
 			return errors.ErrSvcBackendConfig{ServicePortID: sp.ID, Err: err}
 		}
 	}
+	if warning := annotations.FromService(svc).AnnotationWarning(annotations.BackendConfigKey); warning != nil {
+		t.ctx.Recorder(svc.Namespace).Event(svc, api_v1.EventTypeWarning, "InvalidAnnotation", warning.WarningMessage())
+	}
 	// Object in cache could be changed in-flight. Deepcopy to
 	// reduce race conditions.
 	beConfig = beConfig.DeepCopy()
+	if flags.F.EnableDefaultConfigs {
+		if beConfig, err = backendconfig.WithDefaults(t.ctx.BackendConfigInformer.GetIndexer(), beConfig, svc.Namespace, flags.F.DefaultConfigNamespace); err != nil {
+			return errors.ErrSvcBackendConfig{ServicePortID: sp.ID, Err: err}
+		}
+	}
 	if err = backendconfig.Validate(t.ctx.KubeClient, beConfig); err != nil {
 		return errors.ErrBackendConfigValidation{BackendConfig: *beConfig, Err: err}
 	}
@@ -168,54 +209,118 @@ func (t *Translator) getServicePort(id utils.ServicePortID, params *getServicePo
 		return nil, err
 	}
 
+	if flags.F.DisableInstanceGroups && !svcPort.NEGEnabled {
+		// This is a fatal error, the backend cannot be linked to instance groups.
+		return nil, errors.ErrInstanceGroupsDisabled{ServicePortID: id}
+	}
+
+	t.setHealthCheckPort(svcPort, svc)
+
 	if err := setAppProtocol(svcPort, svc, port); err != nil {
 		return svcPort, err
 	}
 
+	if svcPort.Protocol == annotations.ProtocolGRPC && !svcPort.NEGEnabled {
+		return svcPort, errors.ErrProtocolRequiresNEG{ServicePortID: id, Protocol: svcPort.Protocol}
+	}
+
 	if err := t.maybeEnableBackendConfig(svcPort, svc, port); err != nil {
 		return svcPort, err
 	}
 
+	if err := validateScopeFeatures(svcPort); err != nil {
+		return svcPort, err
+	}
+
 	return svcPort, nil
 }
 
+// validateScopeFeatures returns an error if the BackendConfig of the service
+// port enables features which are not supported for its backend service scope.
+func validateScopeFeatures(sp *utils.ServicePort) error {
+	if !sp.L7ILBEnabled || sp.BackendConfig == nil {
+		return nil
+	}
+	spec := sp.BackendConfig.Spec
+	var feature string
+	switch {
+	case spec.Cdn != nil && spec.Cdn.Enabled:
+		feature = "Cloud CDN"
+	case spec.Iap != nil && spec.Iap.Enabled:
+		feature = "IAP"
+	case spec.SecurityPolicy != nil:
+		feature = "Cloud Armor security policy"
+	default:
+		return nil
+	}
+	return errors.ErrUnsupportedScopeFeature{ServicePortID: sp.ID, Feature: feature, Scope: flags.ScopeRegional}
+}
+
 // TranslateIngress converts an Ingress into our internal UrlMap representation.
 func (t *Translator) TranslateIngress(ing *v1beta1.Ingress, systemDefaultBackend utils.ServicePortID) (*utils.GCEURLMap, []error) {
 	var errs []error
 	urlMap := utils.NewGCEURLMap()
 
 	params := &getServicePortParams{}
-	params.isL7ILB = flags.F.EnableL7Ilb && utils.IsGCEL7ILBIngress(ing)
+	params.isL7ILB = flags.F.EnableL7Ilb && utils.IsGCEL7ILBIngress(ing, t.ctx.IngressClasses)
+
+	// The IngressClass of the Ingress may replace the default backend of
+	// the cluster.
+	if classParams, ok := utils.IngressClassParamsFor(ing, t.ctx.IngressClasses); ok {
+		if classParams.Err != nil {
+			errs = append(errs, classParams.Err)
+		}
+		if classParams.DefaultBackend != nil {
+			systemDefaultBackend = *classParams.DefaultBackend
+		}
+	}
 
+	backendServices := routeActionBackendServices(ing, t.project(), utils.IsGCEL7ILBIngress(ing, t.ctx.IngressClasses))
 	for _, rule := range ing.Spec.Rules {
 		if rule.HTTP == nil {
 			continue
 		}
+		host := rule.Host
+		if host == "" {
+			host = loadbalancers.DefaultHost
+		}
 
 		pathRules := []utils.PathRule{}
 		for _, p := range rule.HTTP.Paths {
-			svcPort, err := t.getServicePort(utils.BackendToServicePortID(p.Backend, ing.Namespace), params)
+			// The Ingress spec defines empty path as catch-all, so if a user
+			// asks for a single host and multiple empty paths, all traffic is
+			// sent to one of the last backend in the rules list.
+			path := p.Path
+			if path == "" {
+				path = loadbalancers.DefaultPath
+			}
+			id := utils.BackendToServicePortID(p.Backend, ing.Namespace)
+			// Paths of Ingresses translated from Gateways have no backend
+			// when their requests are redirected or only routed on
+			// conditions, the remaining requests go to the default backend.
+			// The Service of a path sent to an existing backend service is
+			// not looked up, it may not exist.
+			var svcPort *utils.ServicePort
+			var err error
+			if name, ok := backendServices[host][path]; ok {
+				svcPort = &utils.ServicePort{ID: id, ExternalBackendService: name}
+			} else if p.Backend.ServiceName == "" {
+				svcPort, err = t.getDefaultBackendServicePort(ing, systemDefaultBackend, params)
+			} else {
+				svcPort, err = t.getServicePort(id, params)
+			}
 			if err != nil {
 				errs = append(errs, err)
 			}
 			if svcPort != nil {
-				// The Ingress spec defines empty path as catch-all, so if a user
-				// asks for a single host and multiple empty paths, all traffic is
-				// sent to one of the last backend in the rules list.
-				path := p.Path
-				if path == "" {
-					path = loadbalancers.DefaultPath
-				}
 				pathRules = append(pathRules, utils.PathRule{Path: path, Backend: *svcPort})
 			}
 		}
-		host := rule.Host
-		if host == "" {
-			host = loadbalancers.DefaultHost
-		}
 		urlMap.PutPathRulesForHost(host, pathRules)
 	}
 
+	errs = append(errs, t.applyRouteActions(ing, urlMap, params)...)
+
 	if ing.Spec.Backend != nil {
 		svcPort, err := t.getServicePort(utils.BackendToServicePortID(*ing.Spec.Backend, ing.Namespace), params)
 		if err == nil {
@@ -227,7 +332,7 @@ func (t *Translator) TranslateIngress(ing *v1beta1.Ingress, systemDefaultBackend
 		return urlMap, errs
 	}
 
-	svcPort, err := t.getServicePort(systemDefaultBackend, params)
+	svcPort, err := t.getDefaultBackendServicePort(ing, systemDefaultBackend, params)
 	if err == nil {
 		urlMap.DefaultBackend = svcPort
 		return urlMap, errs
@@ -237,6 +342,149 @@ func (t *Translator) TranslateIngress(ing *v1beta1.Ingress, systemDefaultBackend
 	return urlMap, errs
 }
 
+// getDefaultBackendServicePort returns the ServicePort of the system default
+// backend of the Ingress. The cluster default backend may be an external
+// backend service, which is global and thus not used by internal load
+// balancers.
+func (t *Translator) getDefaultBackendServicePort(ing *v1beta1.Ingress, id utils.ServicePortID, params *getServicePortParams) (*utils.ServicePort, error) {
+	if external := t.ctx.DefaultBackendSvcPort; external.ExternalBackendService != "" && id == external.ID && !utils.IsGCEL7ILBIngress(ing, t.ctx.IngressClasses) {
+		return &external, nil
+	}
+	return t.getServicePort(id, params)
+}
+
+// applyRouteActions sets the rewrites, redirects, weighted backends,
+// conditional routes, security policies and existing backend services
+// configured through the route actions annotation on the matching paths of
+// the url map.
+func (t *Translator) applyRouteActions(ing *v1beta1.Ingress, urlMap *utils.GCEURLMap, params *getServicePortParams) []error {
+	actions, err := annotations.FromIngress(ing).RouteActions()
+	if err != nil {
+		return []error{err}
+	}
+	var errs []error
+	for _, action := range actions {
+		host := action.Host
+		if host == "" {
+			host = loadbalancers.DefaultHost
+		}
+		var weighted []utils.WeightedServicePort
+		for _, b := range action.WeightedBackends {
+			id := utils.ServicePortID{Service: types.NamespacedName{Namespace: ing.Namespace, Name: b.ServiceName}, Port: b.ServicePort}
+			svcPort, err := t.getServicePort(id, params)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			weighted = append(weighted, utils.WeightedServicePort{Backend: *svcPort, Weight: b.Weight})
+		}
+		var routes []utils.ConditionalRoute
+		for _, r := range action.Routes {
+			id := utils.ServicePortID{Service: types.NamespacedName{Namespace: ing.Namespace, Name: r.ServiceName}, Port: r.ServicePort}
+			svcPort, err := t.getServicePort(id, params)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			routes = append(routes, utils.ConditionalRoute{Headers: r.Headers, QueryParams: r.QueryParams, Backend: *svcPort})
+		}
+		if action.SecurityPolicy != "" && utils.IsGCEL7ILBIngress(ing, t.ctx.IngressClasses) {
+			errs = append(errs, fmt.Errorf("%s annotation sets security policy %q for path %q of host %q, which is not supported by internal load balancers", annotations.RouteActionsKey, action.SecurityPolicy, action.Path, host))
+			continue
+		}
+		var backendService string
+		if action.BackendService != "" {
+			if backendService, err = routeActionBackendService(action, t.project(), utils.IsGCEL7ILBIngress(ing, t.ctx.IngressClasses)); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		found := urlMap.UpdatePathRule(host, action.Path, func(rule *utils.PathRule) {
+			rule.Rewrite = action.Rewrite
+			rule.Redirect = action.Redirect
+			rule.WeightedBackends = weighted
+			rule.ConditionalRoutes = routes
+			if backendService != "" {
+				rule.Backend = utils.ServicePort{ID: rule.Backend.ID, ExternalBackendService: backendService}
+			}
+			if action.SecurityPolicy != "" {
+				rule.Backend.SecurityPolicy = action.SecurityPolicy
+				for i := range rule.WeightedBackends {
+					rule.WeightedBackends[i].Backend.SecurityPolicy = action.SecurityPolicy
+				}
+				for i := range rule.ConditionalRoutes {
+					rule.ConditionalRoutes[i].Backend.SecurityPolicy = action.SecurityPolicy
+				}
+			}
+		})
+		if !found {
+			errs = append(errs, fmt.Errorf("%s annotation refers to path %q of host %q which is not in the Ingress spec", annotations.RouteActionsKey, action.Path, host))
+		}
+	}
+	return errs
+}
+
+// project returns the project of the cluster, empty if the context has no
+// cloud, as when the Ingress is checked offline.
+func (t *Translator) project() string {
+	if t.ctx.Cloud == nil {
+		return ""
+	}
+	return t.ctx.Cloud.ProjectID()
+}
+
+// routeActionBackendServices returns the names of the existing backend
+// services which the route actions annotation sends paths to, by host and
+// path. The invalid route actions are reported by applyRouteActions. project
+// is the project of the cluster and regional is true for internal load
+// balancers.
+func routeActionBackendServices(ing *v1beta1.Ingress, project string, regional bool) map[string]map[string]string {
+	actions, err := annotations.FromIngress(ing).RouteActions()
+	if err != nil {
+		return nil
+	}
+	ret := map[string]map[string]string{}
+	for _, action := range actions {
+		if action.BackendService == "" {
+			continue
+		}
+		name, err := routeActionBackendService(action, project, regional)
+		if err != nil {
+			continue
+		}
+		host := action.Host
+		if host == "" {
+			host = loadbalancers.DefaultHost
+		}
+		if ret[host] == nil {
+			ret[host] = map[string]string{}
+		}
+		ret[host][action.Path] = name
+	}
+	return ret
+}
+
+// routeActionBackendService returns the name of the backend service of a
+// route action. A self link must refer to a backend service in the project,
+// unless it is empty, global for external load balancers and regional for
+// internal load balancers, for which regional is true.
+func routeActionBackendService(action annotations.RouteAction, project string, regional bool) (string, error) {
+	if !strings.Contains(action.BackendService, "/") {
+		return action.BackendService, nil
+	}
+	id, err := cloud.ParseResourceURL(action.BackendService)
+	if err != nil || id.Key == nil || id.Resource != "backendServices" {
+		return "", fmt.Errorf("%s annotation sets invalid backend service %q for path %q of host %q", annotations.RouteActionsKey, action.BackendService, action.Path, action.Host)
+	}
+	if project != "" && id.ProjectID != project {
+		return "", fmt.Errorf("%s annotation sets backend service %q for path %q of host %q, which is not in project %q of the cluster", annotations.RouteActionsKey, action.BackendService, action.Path, action.Host, project)
+	}
+	if (id.Key.Region != "") != regional {
+		return "", fmt.Errorf("%s annotation sets backend service %q for path %q of host %q, which must be regional for internal load balancers and global otherwise", annotations.RouteActionsKey, action.BackendService, action.Path, action.Host)
+	}
+	return id.Key.Name, nil
+}
+
 func getZone(n *api_v1.Node) string {
 	zone, ok := n.Labels[annotations.ZoneKey]
 	if !ok {
@@ -278,12 +526,14 @@ func (t *Translator) ListZones() ([]string, error) {
 
 // geHTTPProbe returns the http readiness probe from the first container
 // that matches targetPort, from the set of pods matching the given labels.
-func (t *Translator) getHTTPProbe(svc api_v1.Service, targetPort intstr.IntOrString, protocol annotations.AppProtocol) (*api_v1.Probe, error) {
+// For NEG backends, the probe may also use a different port or scheme than the
+// serving port, see negProbe.
+func (t *Translator) getHTTPProbe(svc api_v1.Service, targetPort intstr.IntOrString, protocol annotations.AppProtocol, negEnabled bool) (*api_v1.Probe, error) {
 	l := svc.Spec.Selector
 
 	// Lookup any container with a matching targetPort from the set of pods
 	// with a matching label selector.
-	pl, err := listPodsBySelector(t.ctx.PodInformer.GetIndexer(), labels.SelectorFromSet(labels.Set(l)))
+	pl, err := listPodsBySelector(t.ctx.PodInformer.GetIndexer(), svc.Namespace, labels.SelectorFromSet(labels.Set(l)))
 	if err != nil {
 		return nil, err
 	}
@@ -297,7 +547,12 @@ func (t *Translator) getHTTPProbe(svc api_v1.Service, targetPort intstr.IntOrStr
 		}
 		logStr := fmt.Sprintf("Pod %v matching service selectors %v (targetport %+v)", pod.Name, l, targetPort)
 		for _, c := range pod.Spec.Containers {
-			if !isSimpleHTTPProbe(c.ReadinessProbe) || getProbeScheme(protocol) != c.ReadinessProbe.HTTPGet.Scheme {
+			if !isSimpleHTTPProbe(c.ReadinessProbe) {
+				continue
+			}
+			// NEG health checks reach the pod directly, so the scheme of
+			// the probe is honored even if it differs from the protocol.
+			if !negEnabled && getProbeScheme(protocol) != c.ReadinessProbe.HTTPGet.Scheme {
 				continue
 			}
 
@@ -309,11 +564,17 @@ func (t *Translator) getHTTPProbe(svc api_v1.Service, targetPort intstr.IntOrStr
 					switch readinessProbePort.Type {
 					case intstr.Int:
 						if readinessProbePort.IntVal == p.ContainerPort {
-							return c.ReadinessProbe, nil
+							return servingProbe(c.ReadinessProbe, targetPort, negEnabled), nil
 						}
 					case intstr.String:
 						if readinessProbePort.StrVal == p.Name {
-							return c.ReadinessProbe, nil
+							return servingProbe(c.ReadinessProbe, targetPort, negEnabled), nil
+						}
+					}
+
+					if negEnabled {
+						if port, ok := containerPort(c, readinessProbePort); ok {
+							return negProbe(c.ReadinessProbe, intstr.FromInt(int(port))), nil
 						}
 					}
 
@@ -327,6 +588,37 @@ func (t *Translator) getHTTPProbe(svc api_v1.Service, targetPort intstr.IntOrStr
 	return nil, nil
 }
 
+// servingProbe returns the probe to use for a readiness probe on the serving
+// port of a container.
+func servingProbe(probe *api_v1.Probe, targetPort intstr.IntOrString, negEnabled bool) *api_v1.Probe {
+	if !negEnabled {
+		return probe
+	}
+	return negProbe(probe, targetPort)
+}
+
+// negProbe returns a copy of the probe with its port set to the given port.
+// The port is the target port of the service if the probe is on the serving
+// port, and the resolved container port otherwise.
+func negProbe(probe *api_v1.Probe, port intstr.IntOrString) *api_v1.Probe {
+	ret := probe.DeepCopy()
+	ret.Handler.HTTPGet.Port = port
+	return ret
+}
+
+// containerPort resolves the given port, possibly named, on the container.
+func containerPort(c api_v1.Container, port intstr.IntOrString) (int32, bool) {
+	if port.Type == intstr.Int {
+		return port.IntVal, port.IntVal > 0
+	}
+	for _, p := range c.Ports {
+		if p.Name == port.StrVal {
+			return p.ContainerPort, true
+		}
+	}
+	return 0, false
+}
+
 // GatherEndpointPorts returns all ports needed to open NEG endpoints.
 func (t *Translator) GatherEndpointPorts(svcPorts []utils.ServicePort) []string {
 	portMap := map[int64]bool{}
@@ -360,13 +652,15 @@ func isSimpleHTTPProbe(probe *api_v1.Probe) bool {
 // getProbeScheme returns the Kubernetes API URL scheme corresponding to the
 // protocol.
 func getProbeScheme(protocol annotations.AppProtocol) api_v1.URIScheme {
-	if protocol == annotations.ProtocolHTTP2 {
+	if protocol == annotations.ProtocolHTTP2 || protocol == annotations.ProtocolGRPC {
 		return api_v1.URISchemeHTTPS
 	}
 	return api_v1.URIScheme(string(protocol))
 }
 
-// GetProbe returns a probe that's used for the given nodeport
+// GetProbe returns a probe that's used for the given nodeport.
+// For NEG enabled ports, the port of the returned probe equals the TargetPort
+// of the ServicePort if the probe is on the serving port.
 func (t *Translator) GetProbe(port utils.ServicePort) (*api_v1.Probe, error) {
 	sl := t.ctx.ServiceInformer.GetIndexer().List()
 
@@ -398,29 +692,59 @@ OuterLoop:
 		return nil, fmt.Errorf("unable to find nodeport %v in any service", port)
 	}
 
-	return t.getHTTPProbe(service, svcPort.TargetPort, port.Protocol)
-}
-
-// listPodsBySelector returns a list of all pods based on selector
-func listPodsBySelector(indexer cache.Indexer, selector labels.Selector) (ret []*api_v1.Pod, err error) {
-	err = listAll(indexer, selector, func(m interface{}) {
-		ret = append(ret, m.(*api_v1.Pod))
-	})
-	return ret, err
+	negProbe := port.NEGEnabled && flags.F.EnableNEGProbeHealthChecks
+	probe, err := t.getHTTPProbe(service, svcPort.TargetPort, port.Protocol, negProbe)
+	if err == nil && negProbe {
+		t.probesLock.Lock()
+		t.probes[probeKey(&service, svcPort.Port)] = probe
+		t.probesLock.Unlock()
+	}
+	return probe, err
 }
 
-// listAll iterates a store and passes selected item to a func
-func listAll(store cache.Store, selector labels.Selector, appendFn cache.AppendFunc) error {
-	for _, m := range store.List() {
-		metadata, err := meta.Accessor(m)
+// NEGProbeChanged returns true if the readiness probe picked for the health
+// check of a NEG port of the Service differs from the one picked by the last
+// sync of the port, e.g. because a pod was added or deleted. The ports which
+// were not synced with --enable-neg-probe-health-checks are ignored.
+func (t *Translator) NEGProbeChanged(svc *api_v1.Service) (bool, error) {
+	for _, sp := range svc.Spec.Ports {
+		t.probesLock.Lock()
+		synced, ok := t.probes[probeKey(svc, sp.Port)]
+		t.probesLock.Unlock()
+		if !ok {
+			continue
+		}
+		probe, err := t.getHTTPProbe(*svc, sp.TargetPort, "", true)
 		if err != nil {
-			return err
+			return false, err
 		}
-		if selector.Matches(labels.Set(metadata.GetLabels())) {
-			appendFn(m)
+		if !reflect.DeepEqual(probe, synced) {
+			return true, nil
 		}
 	}
-	return nil
+	return false, nil
+}
+
+// ForgetProbes forgets the probes picked for the ports of a deleted Service.
+func (t *Translator) ForgetProbes(svc *api_v1.Service) {
+	t.probesLock.Lock()
+	defer t.probesLock.Unlock()
+	for _, sp := range svc.Spec.Ports {
+		delete(t.probes, probeKey(svc, sp.Port))
+	}
+}
+
+// probeKey returns the key of the port of the Service in Translator.probes.
+func probeKey(svc *api_v1.Service, port int32) string {
+	return fmt.Sprintf("%s/%s/%d", svc.Namespace, svc.Name, port)
+}
+
+// listPodsBySelector returns a list of all pods of the namespace based on selector
+func listPodsBySelector(indexer cache.Indexer, namespace string, selector labels.Selector) (ret []*api_v1.Pod, err error) {
+	err = cache.ListAllByNamespace(indexer, namespace, selector, func(m interface{}) {
+		ret = append(ret, m.(*api_v1.Pod))
+	})
+	return ret, err
 }
 
 func listEndpointTargetPorts(indexer cache.Indexer, namespace, name, targetPort string) []int {
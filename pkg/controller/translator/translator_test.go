@@ -34,9 +34,12 @@ import (
 	backendconfig "k8s.io/ingress-gce/pkg/apis/backendconfig/v1beta1"
 	backendconfigclient "k8s.io/ingress-gce/pkg/backendconfig/client/clientset/versioned/fake"
 	"k8s.io/ingress-gce/pkg/context"
+	"k8s.io/ingress-gce/pkg/controller/errors"
+	"k8s.io/ingress-gce/pkg/flags"
 	"k8s.io/ingress-gce/pkg/test"
 	"k8s.io/ingress-gce/pkg/utils"
 	namer_util "k8s.io/ingress-gce/pkg/utils/namer"
+	"k8s.io/legacy-cloud-providers/gce"
 )
 
 var (
@@ -65,11 +68,9 @@ func fakeTranslator() *Translator {
 		HealthCheckPath:               "/",
 		DefaultBackendHealthCheckPath: "/healthz",
 	}
-	ctx := context.NewControllerContext(client, nil, backendConfigClient, nil, nil, namer, ctxConfig)
-	gce := &Translator{
-		ctx: ctx,
-	}
-	return gce
+	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	ctx := context.NewControllerContext(client, nil, backendConfigClient, nil, fakeGCE, namer, ctxConfig)
+	return NewTranslator(ctx)
 }
 
 func TestTranslateIngress(t *testing.T) {
@@ -160,6 +161,47 @@ func TestTranslateIngress(t *testing.T) {
 			wantErrCount:  2,
 			wantGCEURLMap: gceURLMapFromFile(t, "ingress-missing-multi-svc.json"),
 		},
+		{
+			desc:          "route actions",
+			ing:           ingressFromFile(t, "ingress-route-actions.yaml"),
+			wantErrCount:  0,
+			wantGCEURLMap: gceURLMapFromFile(t, "ingress-route-actions.json"),
+		},
+		{
+			desc:          "weighted backends",
+			ing:           ingressFromFile(t, "ingress-weighted-backends.yaml"),
+			wantErrCount:  0,
+			wantGCEURLMap: gceURLMapFromFile(t, "ingress-weighted-backends.json"),
+		},
+		{
+			desc:          "security policies",
+			ing:           ingressFromFile(t, "ingress-security-policies.yaml"),
+			wantErrCount:  0,
+			wantGCEURLMap: gceURLMapFromFile(t, "ingress-security-policies.json"),
+		},
+		{
+			desc:          "route action for unknown path",
+			ing:           ingressFromFile(t, "ingress-route-actions-unknown-path.yaml"),
+			wantErrCount:  1,
+			wantGCEURLMap: gceURLMapFromFile(t, "ingress-single-host.json"),
+		},
+		{
+			desc: "path without backend",
+			ing: test.NewIngress(types.NamespacedName{Name: "my-ingress", Namespace: "default"},
+				v1beta1.IngressSpec{
+					Rules: []v1beta1.IngressRule{{
+						Host:             "foo.bar",
+						IngressRuleValue: v1beta1.IngressRuleValue{HTTP: &v1beta1.HTTPIngressRuleValue{Paths: []v1beta1.HTTPIngressPath{{Path: "/old/*"}}}},
+					}},
+				}),
+			wantErrCount: 0,
+			wantGCEURLMap: func() *utils.GCEURLMap {
+				m := utils.NewGCEURLMap()
+				m.DefaultBackend = &defaultBackend
+				m.PutPathRulesForHost("foo.bar", []utils.PathRule{{Path: "/old/*", Backend: defaultBackend}})
+				return m
+			}(),
+		},
 		{
 			desc: "missing default service",
 			ing: test.NewIngress(types.NamespacedName{Name: "my-ingress", Namespace: "default"},
@@ -186,6 +228,114 @@ func TestTranslateIngress(t *testing.T) {
 	}
 }
 
+func TestTranslateIngressExternalDefaultBackend(t *testing.T) {
+	translator := fakeTranslator()
+	translator.ctx.DefaultBackendSvcPort.ExternalBackendService = "external-backend"
+
+	ing := test.NewIngress(types.NamespacedName{Name: "my-ingress", Namespace: "default"}, v1beta1.IngressSpec{})
+	urlMap, errs := translator.TranslateIngress(ing, defaultBackend.ID)
+	if len(errs) != 0 {
+		t.Fatalf("TranslateIngress() = _, %v, want no errs", errs)
+	}
+	if got := urlMap.DefaultBackend; got == nil || got.ExternalBackendService != "external-backend" {
+		t.Errorf("TranslateIngress() has default backend %+v, want external backend service %q", got, "external-backend")
+	}
+
+	// Internal load balancers cannot use the global external backend
+	// service, and fall back to the default backend Service, which does
+	// not exist.
+	ing.Annotations = map[string]string{annotations.IngressClassKey: annotations.GceL7ILBIngressClass}
+	if _, errs := translator.TranslateIngress(ing, defaultBackend.ID); len(errs) != 1 {
+		t.Errorf("TranslateIngress() = _, %v, want 1 err for an internal Ingress", errs)
+	}
+}
+
+func TestTranslateIngressRouteActionBackendService(t *testing.T) {
+	translator := fakeTranslator()
+	svc := test.NewService(types.NamespacedName{Name: "first-service", Namespace: "default"}, apiv1.ServiceSpec{
+		Type:  apiv1.ServiceTypeNodePort,
+		Ports: []apiv1.ServicePort{{Port: 80}},
+	})
+	translator.ctx.ServiceInformer.GetIndexer().Add(svc)
+
+	for _, tc := range []struct {
+		desc           string
+		class          string
+		backendService string
+		wantName       string
+		wantErrCount   int
+	}{
+		{
+			desc:           "name",
+			backendService: "serverless",
+			wantName:       "serverless",
+		},
+		{
+			desc:           "global self link",
+			backendService: "https://www.googleapis.com/compute/v1/projects/test-project/global/backendServices/serverless",
+			wantName:       "serverless",
+		},
+		{
+			desc:           "regional self link for an internal Ingress",
+			class:          annotations.GceL7ILBIngressClass,
+			backendService: "projects/test-project/regions/r/backendServices/serverless",
+			wantName:       "serverless",
+		},
+		{
+			desc:           "regional self link for an external Ingress",
+			backendService: "projects/test-project/regions/r/backendServices/serverless",
+			// The Service of the path does not exist either.
+			wantErrCount: 2,
+		},
+		{
+			desc:           "self link of another project",
+			backendService: "https://www.googleapis.com/compute/v1/projects/other-project/global/backendServices/serverless",
+			wantErrCount:   2,
+		},
+		{
+			desc:           "self link of another resource",
+			backendService: "projects/test-project/global/urlMaps/serverless",
+			wantErrCount:   2,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ing := test.NewIngress(types.NamespacedName{Name: "my-ingress", Namespace: "default"},
+				v1beta1.IngressSpec{
+					Backend: test.Backend("first-service", intstr.FromInt(80)),
+					Rules: []v1beta1.IngressRule{{
+						Host: "foo.bar",
+						IngressRuleValue: v1beta1.IngressRuleValue{HTTP: &v1beta1.HTTPIngressRuleValue{Paths: []v1beta1.HTTPIngressPath{
+							{Path: "/fn/*", Backend: v1beta1.IngressBackend{ServiceName: "placeholder", ServicePort: intstr.FromInt(80)}},
+						}}},
+					}},
+				})
+			ing.Annotations = map[string]string{
+				annotations.RouteActionsKey: fmt.Sprintf(`[{"host":"foo.bar","path":"/fn/*","backendService":%q}]`, tc.backendService),
+			}
+			if tc.class != "" {
+				ing.Annotations[annotations.IngressClassKey] = tc.class
+			}
+			urlMap, errs := translator.TranslateIngress(ing, defaultBackend.ID)
+			if len(errs) != tc.wantErrCount {
+				t.Fatalf("TranslateIngress() = _, %v, want %d errs", errs, tc.wantErrCount)
+			}
+			if tc.wantErrCount > 0 {
+				return
+			}
+			sp, ok := urlMap.PathExists("foo.bar", "/fn/*")
+			if !ok || sp.ExternalBackendService != tc.wantName {
+				t.Errorf("TranslateIngress() sends path /fn/* to %+v, want external backend service %q", sp, tc.wantName)
+			}
+			// The existing backend service is not synced by the controller.
+			for _, sp := range urlMap.AllServicePorts() {
+				if sp.ID.Service.Name != "first-service" {
+					t.Errorf("AllServicePorts() has %+v, want only first-service", sp)
+				}
+			}
+		})
+	}
+}
+
 func TestGetServicePort(t *testing.T) {
 	cases := []struct {
 		desc        string
@@ -301,6 +451,16 @@ func TestGetServicePortWithBackendConfigEnabled(t *testing.T) {
 			wantErr:  false,
 			wantPort: true,
 		},
+		{
+			desc: "backend config feature not supported for regional scope",
+			annotations: map[string]string{
+				annotations.BackendConfigKey: `{"ports":{"http":"config-http"}}`,
+			},
+			id:       utils.ServicePortID{Port: intstr.FromString("http")},
+			wantErr:  true,
+			wantPort: true,
+			params:   getServicePortParams{isL7ILB: true},
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.desc, func(t *testing.T) {
@@ -329,6 +489,143 @@ func TestGetServicePortWithBackendConfigEnabled(t *testing.T) {
 	}
 }
 
+func TestGetServicePortGRPC(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		annotations map[string]string
+		wantErr     bool
+	}{
+		{
+			desc: "GRPC with NEG",
+			annotations: map[string]string{
+				annotations.GoogleServiceApplicationProtocolKey: `{"grpc":"GRPC"}`,
+				annotations.NEGAnnotationKey:                    `{"ingress":true}`,
+			},
+		},
+		{
+			desc: "GRPC without NEG",
+			annotations: map[string]string{
+				annotations.GoogleServiceApplicationProtocolKey: `{"grpc":"GRPC"}`,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			translator := fakeTranslator()
+			svcName := types.NamespacedName{Name: "foo", Namespace: "default"}
+			svc := test.NewService(svcName, apiv1.ServiceSpec{
+				Type:  apiv1.ServiceTypeNodePort,
+				Ports: []apiv1.ServicePort{{Name: "grpc", Port: 8080}},
+			})
+			svc.Annotations = tc.annotations
+			translator.ctx.ServiceInformer.GetIndexer().Add(svc)
+
+			id := utils.ServicePortID{Service: svcName, Port: intstr.FromString("grpc")}
+			port, err := translator.getServicePort(id, &getServicePortParams{})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("translator.getServicePort(%+v) = _, %v, want err? %v", id, err, tc.wantErr)
+			}
+			if port == nil || port.Protocol != annotations.ProtocolGRPC {
+				t.Errorf("translator.getServicePort(%+v) = %+v, want protocol %q", id, port, annotations.ProtocolGRPC)
+			}
+		})
+	}
+}
+
+func TestGetServicePortNEGHealthCheckPort(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		annotations map[string]string
+		wantPort    int64
+	}{
+		{
+			desc: "NEG",
+			annotations: map[string]string{
+				annotations.NEGAnnotationKey:      `{"ingress":true}`,
+				annotations.NEGHealthCheckPortKey: "9000",
+			},
+			wantPort: 9000,
+		},
+		{
+			desc: "Invalid port",
+			annotations: map[string]string{
+				annotations.NEGAnnotationKey:      `{"ingress":true}`,
+				annotations.NEGHealthCheckPortKey: "admin",
+			},
+		},
+		{
+			desc:        "Instance groups",
+			annotations: map[string]string{annotations.NEGHealthCheckPortKey: "9000"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			translator := fakeTranslator()
+			svcName := types.NamespacedName{Name: "foo", Namespace: "default"}
+			svc := test.NewService(svcName, apiv1.ServiceSpec{
+				Type:  apiv1.ServiceTypeNodePort,
+				Ports: []apiv1.ServicePort{{Name: "http", Port: 8080}},
+			})
+			svc.Annotations = tc.annotations
+			translator.ctx.ServiceInformer.GetIndexer().Add(svc)
+
+			id := utils.ServicePortID{Service: svcName, Port: intstr.FromString("http")}
+			port, err := translator.getServicePort(id, &getServicePortParams{})
+			if err != nil {
+				t.Fatalf("translator.getServicePort(%+v) = _, %v", id, err)
+			}
+			if port.HealthCheckPort != tc.wantPort {
+				t.Errorf("translator.getServicePort(%+v) has health check port %d, want %d", id, port.HealthCheckPort, tc.wantPort)
+			}
+		})
+	}
+}
+
+func TestGetServicePortInstanceGroupsDisabled(t *testing.T) {
+	defer func(disable bool) { flags.F.DisableInstanceGroups = disable }(flags.F.DisableInstanceGroups)
+	flags.F.DisableInstanceGroups = true
+
+	testCases := []struct {
+		desc        string
+		annotations map[string]string
+		wantErr     bool
+	}{
+		{
+			desc:        "NEG",
+			annotations: map[string]string{annotations.NEGAnnotationKey: `{"ingress":true}`},
+		},
+		{
+			desc:    "instance groups",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			translator := fakeTranslator()
+			svcName := types.NamespacedName{Name: "foo", Namespace: "default"}
+			svc := test.NewService(svcName, apiv1.ServiceSpec{
+				Type:  apiv1.ServiceTypeNodePort,
+				Ports: []apiv1.ServicePort{{Name: "http", Port: 8080}},
+			})
+			svc.Annotations = tc.annotations
+			translator.ctx.ServiceInformer.GetIndexer().Add(svc)
+
+			id := utils.ServicePortID{Service: svcName, Port: intstr.FromString("http")}
+			port, err := translator.getServicePort(id, &getServicePortParams{})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("translator.getServicePort(%+v) = _, %v, want err? %v", id, err, tc.wantErr)
+			}
+			if _, ok := err.(errors.ErrInstanceGroupsDisabled); tc.wantErr && !ok {
+				t.Errorf("translator.getServicePort(%+v) = _, %T, want ErrInstanceGroupsDisabled", id, err)
+			}
+			if !tc.wantErr && (port == nil || !port.NEGEnabled) {
+				t.Errorf("translator.getServicePort(%+v) = %+v, want NEG enabled", id, port)
+			}
+		})
+	}
+}
+
 func TestGetProbe(t *testing.T) {
 	translator := fakeTranslator()
 	nodePortToHealthCheck := map[utils.ServicePort]string{
@@ -434,6 +731,132 @@ func TestGetProbeCrossNamespace(t *testing.T) {
 	}
 }
 
+func TestGetProbeNEG(t *testing.T) {
+	defer func(enable bool) { flags.F.EnableNEGProbeHealthChecks = enable }(flags.F.EnableNEGProbeHealthChecks)
+	flags.F.EnableNEGProbeHealthChecks = true
+
+	negPort := utils.ServicePort{NodePort: 0, Protocol: annotations.ProtocolHTTPS, NEGEnabled: true,
+		ID: utils.ServicePortID{Service: types.NamespacedName{Name: "svc0", Namespace: apiv1.NamespaceDefault}}}
+	nodePortToHealthCheck := map[utils.ServicePort]string{negPort: "/bar"}
+
+	testCases := []struct {
+		desc       string
+		mutate     func(c *apiv1.Container)
+		wantPort   intstr.IntOrString
+		wantScheme apiv1.URIScheme
+	}{
+		{
+			desc:       "probe on serving port",
+			mutate:     func(c *apiv1.Container) {},
+			wantPort:   intstr.FromInt(80),
+			wantScheme: apiv1.URISchemeHTTPS,
+		},
+		{
+			desc: "probe on another port",
+			mutate: func(c *apiv1.Container) {
+				c.ReadinessProbe.Handler.HTTPGet.Port = intstr.FromInt(8081)
+			},
+			wantPort:   intstr.FromInt(8081),
+			wantScheme: apiv1.URISchemeHTTPS,
+		},
+		{
+			desc: "probe on another named port",
+			mutate: func(c *apiv1.Container) {
+				c.Ports = append(c.Ports, apiv1.ContainerPort{Name: "admin", ContainerPort: 9090})
+				c.ReadinessProbe.Handler.HTTPGet.Port = intstr.FromString("admin")
+			},
+			wantPort:   intstr.FromInt(9090),
+			wantScheme: apiv1.URISchemeHTTPS,
+		},
+		{
+			desc: "probe with another scheme",
+			mutate: func(c *apiv1.Container) {
+				c.ReadinessProbe.Handler.HTTPGet.Scheme = apiv1.URISchemeHTTP
+			},
+			wantPort:   intstr.FromInt(80),
+			wantScheme: apiv1.URISchemeHTTP,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			translator := fakeTranslator()
+			for _, svc := range makeServices(nodePortToHealthCheck, apiv1.NamespaceDefault) {
+				translator.ctx.ServiceInformer.GetIndexer().Add(svc)
+			}
+			for _, pod := range makePods(nodePortToHealthCheck, apiv1.NamespaceDefault) {
+				tc.mutate(&pod.Spec.Containers[0])
+				translator.ctx.PodInformer.GetIndexer().Add(pod)
+			}
+
+			got, err := translator.GetProbe(negPort)
+			if err != nil || got == nil {
+				t.Fatalf("GetProbe(%+v) = %v, %v, want probe", negPort, got, err)
+			}
+			if getProbePath(got) != "/bar" {
+				t.Errorf("got path %q, want %q", getProbePath(got), "/bar")
+			}
+			if got.Handler.HTTPGet.Port != tc.wantPort {
+				t.Errorf("got port %+v, want %+v", got.Handler.HTTPGet.Port, tc.wantPort)
+			}
+			if got.Handler.HTTPGet.Scheme != tc.wantScheme {
+				t.Errorf("got scheme %q, want %q", got.Handler.HTTPGet.Scheme, tc.wantScheme)
+			}
+		})
+	}
+}
+
+func TestNEGProbeChanged(t *testing.T) {
+	defer func(enable bool) { flags.F.EnableNEGProbeHealthChecks = enable }(flags.F.EnableNEGProbeHealthChecks)
+	flags.F.EnableNEGProbeHealthChecks = true
+
+	negPort := utils.ServicePort{NodePort: 0, Protocol: annotations.ProtocolHTTP, NEGEnabled: true,
+		ID: utils.ServicePortID{Service: types.NamespacedName{Name: "svc0", Namespace: apiv1.NamespaceDefault}}}
+	nodePortToHealthCheck := map[utils.ServicePort]string{negPort: "/bar"}
+
+	translator := fakeTranslator()
+	svc := makeServices(nodePortToHealthCheck, apiv1.NamespaceDefault)[0]
+	translator.ctx.ServiceInformer.GetIndexer().Add(svc)
+	pod := makePods(nodePortToHealthCheck, apiv1.NamespaceDefault)[0]
+	translator.ctx.PodInformer.GetIndexer().Add(pod)
+
+	// No probe was picked for the Service yet.
+	if changed, err := translator.NEGProbeChanged(svc); err != nil || changed {
+		t.Fatalf("NEGProbeChanged(%v) = %v, %v, want false, nil before GetProbe", svc.Name, changed, err)
+	}
+	if _, err := translator.GetProbe(negPort); err != nil {
+		t.Fatalf("GetProbe(%+v) = %v", negPort, err)
+	}
+	if changed, err := translator.NEGProbeChanged(svc); err != nil || changed {
+		t.Fatalf("NEGProbeChanged(%v) = %v, %v, want false, nil after GetProbe", svc.Name, changed, err)
+	}
+
+	// A newer pod with another probe does not change the probe picked.
+	newer := pod.DeepCopy()
+	newer.Name = "newer"
+	newer.CreationTimestamp = metav1.NewTime(pod.CreationTimestamp.Add(time.Minute))
+	newer.Spec.Containers[0].ReadinessProbe.Handler.HTTPGet.Path = "/newer"
+	translator.ctx.PodInformer.GetIndexer().Add(newer)
+	if changed, err := translator.NEGProbeChanged(svc); err != nil || changed {
+		t.Errorf("NEGProbeChanged(%v) = %v, %v, want false, nil after adding a newer pod", svc.Name, changed, err)
+	}
+
+	// An older pod with another probe changes it.
+	older := pod.DeepCopy()
+	older.Name = "older"
+	older.CreationTimestamp = metav1.NewTime(pod.CreationTimestamp.Add(-time.Minute))
+	older.Spec.Containers[0].ReadinessProbe.Handler.HTTPGet.Path = "/older"
+	translator.ctx.PodInformer.GetIndexer().Add(older)
+	if changed, err := translator.NEGProbeChanged(svc); err != nil || !changed {
+		t.Errorf("NEGProbeChanged(%v) = %v, %v, want true, nil after adding an older pod", svc.Name, changed, err)
+	}
+
+	translator.ForgetProbes(svc)
+	if changed, err := translator.NEGProbeChanged(svc); err != nil || changed {
+		t.Errorf("NEGProbeChanged(%v) = %v, %v, want false, nil after ForgetProbes", svc.Name, changed, err)
+	}
+}
+
 func makePods(nodePortToHealthCheck map[utils.ServicePort]string, ns string) []*apiv1.Pod {
 	delay := 1 * time.Minute
 
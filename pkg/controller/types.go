@@ -27,4 +27,6 @@ type syncState struct {
 	urlMap *utils.GCEURLMap
 	ing    *v1beta1.Ingress
 	l7     *loadbalancers.L7
+	// conditions collects the conditions of the stages of the sync.
+	conditions loadbalancers.Conditions
 }
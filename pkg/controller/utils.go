@@ -24,6 +24,7 @@ import (
 	api_v1 "k8s.io/api/core/v1"
 	"k8s.io/api/networking/v1beta1"
 	"k8s.io/ingress-gce/pkg/annotations"
+	"k8s.io/ingress-gce/pkg/flags"
 	"k8s.io/ingress-gce/pkg/utils"
 )
 
@@ -65,9 +66,41 @@ func nodeStatusChanged(old, cur *api_v1.Node) bool {
 	if utils.NodeIsReady(old) != utils.NodeIsReady(cur) {
 		return true
 	}
+	// Taints and labels may exclude nodes from the instance groups as well.
+	nodePredicate := utils.GetNodeConditionPredicateWithOptions(utils.InstanceGroupNodeFilterOptions())
+	if nodePredicate(old) != nodePredicate(cur) {
+		return true
+	}
+	return false
+}
+
+// hasReadinessProbe returns true if any container of the pod has an HTTP
+// readiness probe, which may be used for health checks.
+func hasReadinessProbe(pod *api_v1.Pod) bool {
+	for _, c := range pod.Spec.Containers {
+		if c.ReadinessProbe != nil && c.ReadinessProbe.HTTPGet != nil {
+			return true
+		}
+	}
 	return false
 }
 
+// ingressesForDefaultConfig returns the Ingresses to which a default config
+// of the given namespace applies. The defaults of the cluster default config
+// namespace apply to all Ingresses.
+func ingressesForDefaultConfig(ings []*v1beta1.Ingress, namespace string) []*v1beta1.Ingress {
+	if namespace == flags.F.DefaultConfigNamespace {
+		return ings
+	}
+	var result []*v1beta1.Ingress
+	for _, ing := range ings {
+		if ing.Namespace == namespace {
+			result = append(result, ing)
+		}
+	}
+	return result
+}
+
 func convert(ings []*v1beta1.Ingress) (retVal []interface{}) {
 	for _, ing := range ings {
 		retVal = append(retVal, ing)
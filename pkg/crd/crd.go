@@ -110,6 +110,9 @@ func crd(meta *CRDMeta) *apiextensionsv1beta1.CustomResourceDefinition {
 			},
 		},
 	}
+	if meta.clusterScoped {
+		crd.Spec.Scope = apiextensionsv1beta1.ClusterScoped
+	}
 	if meta.typeSource != "" && meta.fn != nil {
 		validationSpec, err := validation(meta.typeSource, meta.fn)
 		if err != nil {
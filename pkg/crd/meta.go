@@ -31,6 +31,8 @@ type CRDMeta struct {
 	shortNames []string
 	typeSource string
 	fn         common.GetOpenAPIDefinitions
+	// clusterScoped is true for CRDs of cluster-scoped resources.
+	clusterScoped bool
 }
 
 // NewCRDMeta creates a CRDMeta type which can be passed to a CRDHandler in
@@ -53,3 +55,9 @@ func (m *CRDMeta) AddValidationInfo(typeSource string, fn common.GetOpenAPIDefin
 	m.typeSource = typeSource
 	m.fn = fn
 }
+
+// SetClusterScoped makes the resources of the CRD cluster-scoped instead of
+// namespaced.
+func (m *CRDMeta) SetClusterScoped() {
+	m.clusterScoped = true
+}
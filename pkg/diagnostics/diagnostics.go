@@ -0,0 +1,339 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package diagnostics scans the Ingresses and Services of the cluster for
+// frequent misconfigurations, and reports them as Events and in a
+// DiagnosticReport.
+package diagnostics
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/api/networking/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/annotations"
+	apisdiagnosticreport "k8s.io/ingress-gce/pkg/apis/diagnosticreport"
+	diagnosticreportv1beta1 "k8s.io/ingress-gce/pkg/apis/diagnosticreport/v1beta1"
+	"k8s.io/ingress-gce/pkg/context"
+	"k8s.io/ingress-gce/pkg/controller/translator"
+	"k8s.io/ingress-gce/pkg/crd"
+	"k8s.io/ingress-gce/pkg/orgpolicy"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/klog"
+)
+
+const (
+	// ReportName is the name of the cluster-scoped DiagnosticReport.
+	ReportName = "ingress-gce"
+
+	// CheckNEGPorts finds NEG annotations exposing ports the Service does
+	// not have.
+	CheckNEGPorts = "NEGPorts"
+	// CheckBackendConfig finds BackendConfigs referenced by Services which
+	// do not exist.
+	CheckBackendConfig = "BackendConfig"
+	// CheckServiceType finds Ingress backends whose Service type requires
+	// NEGs which are not enabled.
+	CheckServiceType = "ServiceType"
+	// CheckFirewallOrgPolicy finds Ingresses whose firewall rule cannot be
+	// synced because of an organization policy.
+	CheckFirewallOrgPolicy = "FirewallOrgPolicy"
+
+	// eventReason is the reason of the Events of the findings.
+	eventReason = "Misconfiguration"
+)
+
+// ReportCRDMeta returns the metadata of the cluster-scoped DiagnosticReport
+// CRD.
+func ReportCRDMeta() *crd.CRDMeta {
+	meta := crd.NewCRDMeta(
+		apisdiagnosticreport.GroupName,
+		"v1beta1",
+		"DiagnosticReport",
+		"DiagnosticReportList",
+		"diagnosticreport",
+		"diagnosticreports",
+	)
+	meta.SetClusterScoped()
+	return meta
+}
+
+// Finding is a misconfiguration of an Ingress or a Service.
+type Finding struct {
+	Check   string
+	Object  runtime.Object
+	Message string
+}
+
+// Diagnoser periodically checks the Ingresses and Services for frequent
+// misconfigurations, which otherwise only surface as sync errors or as
+// traffic not reaching the backends.
+type Diagnoser struct {
+	ctx *context.ControllerContext
+	// firewallErr returns the error of the last sync of the firewall rule.
+	firewallErr func() error
+}
+
+// NewDiagnoser returns a Diagnoser of the objects of the context.
+func NewDiagnoser(ctx *context.ControllerContext, firewallErr func() error) *Diagnoser {
+	return &Diagnoser{ctx: ctx, firewallErr: firewallErr}
+}
+
+// Run diagnoses the objects every period once the informers synced, until
+// stopCh is closed.
+func (d *Diagnoser) Run(hasSynced cache.InformerSynced, period time.Duration, stopCh <-chan struct{}) {
+	if !cache.WaitForCacheSync(stopCh, hasSynced) {
+		return
+	}
+	wait.Until(func() {
+		findings := d.Diagnose()
+		d.recordEvents(findings)
+		if err := d.writeReport(findings); err != nil {
+			klog.Errorf("Failed to write DiagnosticReport %q: %v", ReportName, err)
+		}
+	}, period, stopCh)
+}
+
+// Diagnose returns the misconfigurations of the objects, sorted by check.
+func (d *Diagnoser) Diagnose() []Finding {
+	var findings []Finding
+	for _, svc := range d.ctx.Services().List() {
+		findings = append(findings, checkNEGPorts(svc)...)
+		findings = append(findings, d.checkBackendConfig(svc)...)
+	}
+	var ings []*v1beta1.Ingress
+	for _, ing := range d.ctx.Ingresses().List() {
+		if utils.IsGCEIngress(ing, d.ctx.IngressClasses) {
+			ings = append(ings, ing)
+		}
+	}
+	for _, ing := range ings {
+		findings = append(findings, d.checkServiceType(ing)...)
+	}
+	findings = append(findings, d.checkFirewallOrgPolicy(ings)...)
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Check < findings[j].Check })
+	return findings
+}
+
+// checkNEGPorts returns a finding if the NEG annotation of the Service
+// exposes ports the Service does not have, for which no NEG is created.
+func checkNEGPorts(svc *apiv1.Service) []Finding {
+	negAnnotation, ok, err := annotations.FromService(svc).NEGAnnotation()
+	if !ok || err != nil {
+		return nil
+	}
+	ports := map[int32]bool{}
+	for _, port := range svc.Spec.Ports {
+		ports[port.Port] = true
+	}
+	var missing []int
+	for port := range negAnnotation.ExposedPorts {
+		if !ports[port] {
+			missing = append(missing, int(port))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Ints(missing)
+	return []Finding{{
+		Check:   CheckNEGPorts,
+		Object:  svc,
+		Message: fmt.Sprintf("annotation %s exposes ports %v which are not ports of the Service", annotations.NEGAnnotationKey, missing),
+	}}
+}
+
+// checkBackendConfig returns a finding for each BackendConfig referenced by
+// the Service which does not exist.
+func (d *Diagnoser) checkBackendConfig(svc *apiv1.Service) []Finding {
+	configs, err := annotations.FromService(svc).GetBackendConfigs()
+	if err != nil {
+		return nil
+	}
+	names := map[string]bool{}
+	if configs.Default != "" {
+		names[configs.Default] = true
+	}
+	for _, name := range configs.Ports {
+		names[name] = true
+	}
+	var findings []Finding
+	for _, name := range sortedKeys(names) {
+		if _, exists, err := d.ctx.BackendConfigs().GetByKey(svc.Namespace + "/" + name); err == nil && !exists {
+			findings = append(findings, Finding{
+				Check:   CheckBackendConfig,
+				Object:  svc,
+				Message: fmt.Sprintf("BackendConfig %s/%s referenced by annotation %s does not exist", svc.Namespace, name, annotations.BackendConfigKey),
+			})
+		}
+	}
+	return findings
+}
+
+// checkServiceType returns a finding for each backend of the Ingress whose
+// Service is neither of type NodePort nor LoadBalancer, and does not enable
+// NEGs for Ingresses. Internal Ingresses always use NEGs, but the Services
+// must still enable them unless they are of those types.
+func (d *Diagnoser) checkServiceType(ing *v1beta1.Ingress) []Finding {
+	var findings []Finding
+	seen := map[string]bool{}
+	utils.TraverseIngressBackends(ing, func(id utils.ServicePortID) bool {
+		if id.Service.Name == "" || seen[id.Service.String()] {
+			return false
+		}
+		seen[id.Service.String()] = true
+		svc, exists, err := d.ctx.Services().GetByKey(id.Service.String())
+		// Missing Services and ports are reported by the Ingress sync.
+		if err != nil || !exists || translator.ServicePort(*svc, id.Port) == nil {
+			return false
+		}
+		if svc.Spec.Type == apiv1.ServiceTypeNodePort || svc.Spec.Type == apiv1.ServiceTypeLoadBalancer {
+			return false
+		}
+		if negAnnotation, ok, err := annotations.FromService(svc).NEGAnnotation(); ok && err == nil && negAnnotation.NEGEnabledForIngress() {
+			return false
+		}
+		message := fmt.Sprintf("backend Service %s is of type %s: set its type to NodePort or enable NEGs with the annotation %s: '{\"ingress\": true}'", id.Service, svc.Spec.Type, annotations.NEGAnnotationKey)
+		if utils.IsGCEL7ILBIngress(ing, d.ctx.IngressClasses) {
+			message = fmt.Sprintf("backend Service %s of the internal Ingress is of type %s: enable NEGs with the annotation %s: '{\"ingress\": true}'", id.Service, svc.Spec.Type, annotations.NEGAnnotationKey)
+		}
+		findings = append(findings, Finding{Check: CheckServiceType, Object: ing, Message: message})
+		return false
+	})
+	return findings
+}
+
+// checkFirewallOrgPolicy returns a finding for each Ingress if the last sync
+// of the firewall rule was denied by an organization policy.
+func (d *Diagnoser) checkFirewallOrgPolicy(ings []*v1beta1.Ingress) []Finding {
+	if d.firewallErr == nil {
+		return nil
+	}
+	constraint, ok := orgpolicy.ViolatedConstraint(d.firewallErr())
+	if !ok {
+		return nil
+	}
+	var findings []Finding
+	for _, ing := range ings {
+		findings = append(findings, Finding{
+			Check:   CheckFirewallOrgPolicy,
+			Object:  ing,
+			Message: fmt.Sprintf("the firewall rule allowing the health checks and the load balancer to reach the backends is denied by the organization policy constraint %s", constraint),
+		})
+	}
+	return findings
+}
+
+// recordEvents raises a warning Event on the object of each finding.
+func (d *Diagnoser) recordEvents(findings []Finding) {
+	for _, f := range findings {
+		obj, err := metaObject(f.Object)
+		if err != nil {
+			continue
+		}
+		d.ctx.Recorder(obj.GetNamespace()).Eventf(f.Object, apiv1.EventTypeWarning, eventReason, "%s: %s", f.Check, f.Message)
+	}
+}
+
+// writeReport creates or updates the DiagnosticReport with the findings. It
+// does nothing if the client is disabled.
+func (d *Diagnoser) writeReport(findings []Finding) error {
+	client := d.ctx.DiagnosticReportClient
+	if client == nil {
+		return nil
+	}
+	obj, err := toUnstructuredReport(findings, metav1.Now())
+	if err != nil {
+		return err
+	}
+	existing, err := client.Get(ReportName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = client.Create(obj, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	obj.SetResourceVersion(existing.GetResourceVersion())
+	_, err = client.Update(obj, metav1.UpdateOptions{})
+	return err
+}
+
+func toUnstructuredReport(findings []Finding, now metav1.Time) (*unstructured.Unstructured, error) {
+	report := &diagnosticreportv1beta1.DiagnosticReport{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: diagnosticreportv1beta1.SchemeGroupVersion.String(),
+			Kind:       "DiagnosticReport",
+		},
+		ObjectMeta: metav1.ObjectMeta{Name: ReportName},
+		Status:     diagnosticreportv1beta1.DiagnosticReportStatus{LastDiagnosisTime: now},
+	}
+	for _, f := range findings {
+		obj, err := metaObject(f.Object)
+		if err != nil {
+			return nil, err
+		}
+		report.Status.Findings = append(report.Status.Findings, diagnosticreportv1beta1.Finding{
+			Check:     f.Check,
+			Kind:      kind(f.Object),
+			Namespace: obj.GetNamespace(),
+			Name:      obj.GetName(),
+			Message:   f.Message,
+		})
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(report)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
+
+func metaObject(obj runtime.Object) (metav1.Object, error) {
+	o, ok := obj.(metav1.Object)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a Kubernetes object", obj)
+	}
+	return o, nil
+}
+
+// kind returns the kind of the object, whose TypeMeta is not set by the
+// informers.
+func kind(obj runtime.Object) string {
+	switch obj.(type) {
+	case *v1beta1.Ingress:
+		return "Ingress"
+	case *apiv1.Service:
+		return "Service"
+	}
+	return obj.GetObjectKind().GroupVersionKind().Kind
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
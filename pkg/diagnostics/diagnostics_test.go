@@ -0,0 +1,163 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnostics
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/ingress-gce/pkg/annotations"
+	backendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/backendconfig/v1beta1"
+	diagnosticreportv1beta1 "k8s.io/ingress-gce/pkg/apis/diagnosticreport/v1beta1"
+	backendconfigclient "k8s.io/ingress-gce/pkg/backendconfig/client/clientset/versioned/fake"
+	"k8s.io/ingress-gce/pkg/context"
+	"k8s.io/ingress-gce/pkg/flags"
+	"k8s.io/ingress-gce/pkg/test"
+	namer_util "k8s.io/ingress-gce/pkg/utils/namer"
+)
+
+func newService(name string, svcType apiv1.ServiceType, annotations map[string]string) *apiv1.Service {
+	return &apiv1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Annotations: annotations},
+		Spec: apiv1.ServiceSpec{
+			Type:  svcType,
+			Ports: []apiv1.ServicePort{{Name: "http", Port: 80}},
+		},
+	}
+}
+
+func newIngress(name, class, svcName string) *v1beta1.Ingress {
+	return &v1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        name,
+			Annotations: map[string]string{annotations.IngressClassKey: class},
+		},
+		Spec: v1beta1.IngressSpec{
+			Backend: &v1beta1.IngressBackend{ServiceName: svcName, ServicePort: intstr.FromInt(80)},
+		},
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	flags.F.EnableL7Ilb = true
+	defer func() { flags.F.EnableL7Ilb = false }()
+
+	ctxConfig := context.ControllerContextConfig{
+		Namespace:             apiv1.NamespaceAll,
+		ResyncPeriod:          1 * time.Minute,
+		DefaultBackendSvcPort: test.DefaultBeSvcPort,
+	}
+	ctx := context.NewControllerContext(fake.NewSimpleClientset(), nil, backendconfigclient.NewSimpleClientset(), nil, nil, namer_util.NewNamer("uid1", ""), ctxConfig)
+
+	negPorts := newService("neg-ports", apiv1.ServiceTypeClusterIP, map[string]string{
+		annotations.NEGAnnotationKey: `{"ingress": true, "exposed_ports": {"80": {}, "443": {}, "8443": {}}}`,
+	})
+	missingConfig := newService("missing-config", apiv1.ServiceTypeNodePort, map[string]string{
+		annotations.BackendConfigKey: `{"default": "config", "ports": {"http": "missing"}}`,
+	})
+	clusterIP := newService("cluster-ip", apiv1.ServiceTypeClusterIP, nil)
+	for _, svc := range []*apiv1.Service{negPorts, missingConfig, clusterIP, newService("node-port", apiv1.ServiceTypeNodePort, nil)} {
+		ctx.ServiceInformer.GetIndexer().Add(svc)
+	}
+	ctx.BackendConfigInformer.GetIndexer().Add(&backendconfigv1beta1.BackendConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "config"},
+	})
+	external := newIngress("external", annotations.GceIngressClass, "cluster-ip")
+	internal := newIngress("internal", annotations.GceL7ILBIngressClass, "cluster-ip")
+	for _, ing := range []*v1beta1.Ingress{
+		external,
+		internal,
+		newIngress("neg", annotations.GceIngressClass, "neg-ports"),
+		newIngress("node-port", annotations.GceIngressClass, "node-port"),
+		newIngress("other-class", "nginx", "cluster-ip"),
+	} {
+		ctx.IngressInformer.GetIndexer().Add(ing)
+	}
+
+	var firewallErr error
+	d := NewDiagnoser(ctx, func() error { return firewallErr })
+	checks := func() map[string][]string {
+		got := map[string][]string{}
+		for _, f := range d.Diagnose() {
+			got[f.Check] = append(got[f.Check], kind(f.Object)+" "+f.Object.(metav1.Object).GetName())
+		}
+		for _, objects := range got {
+			sort.Strings(objects)
+		}
+		return got
+	}
+
+	want := map[string][]string{
+		CheckNEGPorts:      {"Service neg-ports"},
+		CheckBackendConfig: {"Service missing-config"},
+		CheckServiceType:   {"Ingress external", "Ingress internal"},
+	}
+	if got := checks(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diagnose() found %v, want %v", got, want)
+	}
+
+	// Only the org policy denials of the firewall rule are reported.
+	firewallErr = fmt.Errorf("googleapi: Error 500: internal error")
+	if got := checks(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diagnose() found %v with a failed firewall sync, want %v", got, want)
+	}
+	firewallErr = fmt.Errorf("googleapi: Error 412: Constraint constraints/compute.restrictFirewallRules violated for projects/p, conditionNotMet")
+	want[CheckFirewallOrgPolicy] = []string{"Ingress external", "Ingress internal", "Ingress neg", "Ingress node-port"}
+	if got := checks(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diagnose() found %v with a firewall rule denied by an organization policy, want %v", got, want)
+	}
+}
+
+func TestToUnstructuredReport(t *testing.T) {
+	now := metav1.NewTime(time.Unix(1600000000, 0))
+	findings := []Finding{
+		{Check: CheckNEGPorts, Object: newService("svc", apiv1.ServiceTypeClusterIP, nil), Message: "ports"},
+		{Check: CheckServiceType, Object: newIngress("ing", annotations.GceIngressClass, "svc"), Message: "type"},
+	}
+	obj, err := toUnstructuredReport(findings, now)
+	if err != nil {
+		t.Fatalf("toUnstructuredReport() = %v", err)
+	}
+	if obj.GetName() != ReportName || obj.GetKind() != "DiagnosticReport" || obj.GetAPIVersion() != "networking.gke.io/v1beta1" {
+		t.Errorf("Got object %s %s %q, want DiagnosticReport networking.gke.io/v1beta1 %q", obj.GetKind(), obj.GetAPIVersion(), obj.GetName(), ReportName)
+	}
+
+	report := &diagnosticreportv1beta1.DiagnosticReport{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, report); err != nil {
+		t.Fatalf("FromUnstructured() = %v", err)
+	}
+	want := diagnosticreportv1beta1.DiagnosticReportStatus{
+		LastDiagnosisTime: now,
+		Findings: []diagnosticreportv1beta1.Finding{
+			{Check: CheckNEGPorts, Kind: "Service", Namespace: "default", Name: "svc", Message: "ports"},
+			{Check: CheckServiceType, Kind: "Ingress", Namespace: "default", Name: "ing", Message: "type"},
+		},
+	}
+	if !reflect.DeepEqual(report.Status, want) {
+		t.Errorf("Got status %+v, want %+v", report.Status, want)
+	}
+}
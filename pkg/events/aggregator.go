@@ -0,0 +1,133 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+)
+
+// Aggregator records the events of the failed syncs of objects, which fail
+// again at every retry. Repeats of the same failure are collapsed into a
+// single event with their count and first and last times, re-recorded at
+// most once per interval. The events are Normal until the object failed
+// threshold consecutive syncs, and Warning after.
+type Aggregator struct {
+	threshold int
+	interval  time.Duration
+	// now returns the current time, overridden in tests.
+	now func() time.Time
+
+	lock     sync.Mutex
+	failures map[string]*failure
+}
+
+// failure is the state of the consecutive failed syncs of an object.
+type failure struct {
+	// consecutive is the number of consecutive failed syncs.
+	consecutive int
+	// reason and message are those of the last failure, repeated count
+	// times since first.
+	reason, message string
+	count           int
+	first           time.Time
+	// recorded is the time the last event was recorded.
+	recorded time.Time
+	// warning is true once a Warning event was recorded.
+	warning bool
+}
+
+// NewAggregator returns an Aggregator recording Warning events after
+// threshold consecutive failures, and repeats at most once per interval.
+func NewAggregator(threshold int, interval time.Duration) *Aggregator {
+	return &Aggregator{
+		threshold: threshold,
+		interval:  interval,
+		now:       time.Now,
+		failures:  map[string]*failure{},
+	}
+}
+
+// Failure records a failed sync of obj with recorder, unless it repeats the
+// last failure of obj which was recorded less than interval ago.
+func (a *Aggregator) Failure(recorder record.EventRecorder, obj runtime.Object, reason, message string) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		klog.Errorf("Failed to get key of %v: %v", obj, err)
+		return
+	}
+	now := a.now()
+
+	a.lock.Lock()
+	f, ok := a.failures[key]
+	if !ok {
+		f = &failure{}
+		a.failures[key] = f
+	}
+	f.consecutive++
+	if f.reason != reason || f.message != message {
+		f.reason, f.message, f.count, f.first = reason, message, 0, now
+		f.recorded = time.Time{}
+	}
+	f.count++
+	warning := f.consecutive >= a.threshold
+	// Record the first failure, the escalation to Warning and the repeats
+	// once per interval.
+	emit := f.recorded.IsZero() || (warning && !f.warning) || now.Sub(f.recorded) >= a.interval
+	if emit {
+		f.recorded = now
+		f.warning = f.warning || warning
+	}
+	count, first := f.count, f.first
+	a.lock.Unlock()
+
+	if !emit {
+		return
+	}
+	eventType := apiv1.EventTypeNormal
+	if warning {
+		eventType = apiv1.EventTypeWarning
+	}
+	if count > 1 {
+		message = fmt.Sprintf("%s (%d times since %s, last at %s)", message, count, first.UTC().Format(time.RFC3339), now.UTC().Format(time.RFC3339))
+	}
+	recorder.Event(obj, eventType, reason, message)
+}
+
+// Success resets the failures of obj after a successful sync.
+func (a *Aggregator) Success(obj runtime.Object) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	a.Forget(key)
+}
+
+// Forget resets the failures of the object with the given key, e.g. once it
+// is deleted.
+func (a *Aggregator) Forget(key string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.failures, key)
+}
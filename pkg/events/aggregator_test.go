@@ -0,0 +1,70 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestAggregator(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	a := NewAggregator(3, 10*time.Minute)
+	a.now = func() time.Time { return now }
+	recorder := record.NewFakeRecorder(100)
+	ing := &v1beta1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "ing", Namespace: "default"}}
+
+	for _, step := range []struct {
+		desc    string
+		advance time.Duration
+		message string
+		success bool
+		// want is the event recorded by the step, if any.
+		want string
+	}{
+		{desc: "first failure", message: "boom", want: "Normal Sync boom"},
+		{desc: "repeat", advance: time.Second, message: "boom"},
+		{desc: "escalation", advance: time.Second, message: "boom", want: "Warning Sync boom (3 times since 2020-01-01T00:00:00Z, last at 2020-01-01T00:00:02Z)"},
+		{desc: "repeat after escalation", advance: time.Minute, message: "boom"},
+		{desc: "repeat after interval", advance: 10 * time.Minute, message: "boom", want: "Warning Sync boom (5 times since 2020-01-01T00:00:00Z, last at 2020-01-01T00:11:02Z)"},
+		{desc: "new failure", advance: time.Second, message: "bang", want: "Warning Sync bang"},
+		{desc: "success", advance: time.Second, success: true},
+		{desc: "failure after success", advance: time.Second, message: "bang", want: "Normal Sync bang"},
+	} {
+		now = now.Add(step.advance)
+		if step.success {
+			a.Success(ing)
+		} else {
+			a.Failure(recorder, ing, "Sync", step.message)
+		}
+		select {
+		case got := <-recorder.Events:
+			if got != step.want {
+				t.Errorf("%s: got event %q, want %q", step.desc, got, step.want)
+			}
+		default:
+			if step.want != "" {
+				t.Errorf("%s: got no event, want %q", step.desc, step.want)
+			}
+		}
+	}
+}
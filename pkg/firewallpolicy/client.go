@@ -0,0 +1,119 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewallpolicy
+
+import (
+	"fmt"
+	"net/http"
+
+	"google.golang.org/api/googleapi"
+	"k8s.io/ingress-gce/pkg/restapi"
+)
+
+const computeBasePath = "https://compute.googleapis.com/compute/v1/"
+
+// Rule is a rule of a network firewall policy. See
+// https://cloud.google.com/compute/docs/reference/rest/v1/networkFirewallPolicies.
+type Rule struct {
+	// Priority identifies the rule in its policy.
+	Priority              int64        `json:"priority"`
+	RuleName              string       `json:"ruleName,omitempty"`
+	Description           string       `json:"description,omitempty"`
+	Direction             string       `json:"direction,omitempty"`
+	Action                string       `json:"action,omitempty"`
+	Match                 *RuleMatcher `json:"match,omitempty"`
+	TargetServiceAccounts []string     `json:"targetServiceAccounts,omitempty"`
+}
+
+// RuleMatcher is the traffic matched by a rule.
+type RuleMatcher struct {
+	SrcIPRanges   []string        `json:"srcIpRanges,omitempty"`
+	Layer4Configs []*Layer4Config `json:"layer4Configs,omitempty"`
+}
+
+// Layer4Config is a protocol and the ports of the protocol matched by a rule.
+type Layer4Config struct {
+	IPProtocol string   `json:"ipProtocol"`
+	Ports      []string `json:"ports,omitempty"`
+}
+
+// Client manages the rules of a network firewall policy.
+type Client interface {
+	// GetRule returns the rule with the given priority. A 404 error is
+	// returned if there is none.
+	GetRule(priority int64) (*Rule, error)
+	// AddRule adds the rule to the policy.
+	AddRule(rule *Rule) error
+	// PatchRule replaces the rule with the priority of rule.
+	PatchRule(rule *Rule) error
+	// RemoveRule removes the rule with the given priority.
+	RemoveRule(priority int64) error
+}
+
+// restClient is a Client using the Compute Engine REST API.
+type restClient struct {
+	api *restapi.Client
+	// policyURL is the URL of the global or regional firewall policy.
+	policyURL string
+}
+
+// NewClient returns a Client of the policy in the given project using the
+// given authenticated HTTP client. The policy is global if region is empty.
+func NewClient(client *http.Client, project, region, policy string) Client {
+	policyURL := fmt.Sprintf("%sprojects/%s/global/firewallPolicies/%s", computeBasePath, project, policy)
+	if region != "" {
+		policyURL = fmt.Sprintf("%sprojects/%s/regions/%s/firewallPolicies/%s", computeBasePath, project, region, policy)
+	}
+	return &restClient{api: restapi.NewClient(client), policyURL: policyURL}
+}
+
+type firewallPolicy struct {
+	Rules []*Rule `json:"rules"`
+}
+
+// GetRule implements Client. The rules are looked up in the policy, as the
+// getRule method does not report missing rules as not found.
+func (c *restClient) GetRule(priority int64) (*Rule, error) {
+	policy := &firewallPolicy{}
+	if err := c.api.Do(http.MethodGet, c.policyURL, nil, policy); err != nil {
+		return nil, err
+	}
+	for _, rule := range policy.Rules {
+		if rule.Priority == priority {
+			return rule, nil
+		}
+	}
+	return nil, &googleapi.Error{
+		Code:    http.StatusNotFound,
+		Message: fmt.Sprintf("no rule with priority %d in firewall policy %s", priority, c.policyURL),
+	}
+}
+
+// AddRule implements Client.
+func (c *restClient) AddRule(rule *Rule) error {
+	return c.api.DoComputeOperation(http.MethodPost, c.policyURL+"/addRule", rule)
+}
+
+// PatchRule implements Client.
+func (c *restClient) PatchRule(rule *Rule) error {
+	return c.api.DoComputeOperation(http.MethodPost, fmt.Sprintf("%s/patchRule?priority=%d", c.policyURL, rule.Priority), rule)
+}
+
+// RemoveRule implements Client.
+func (c *restClient) RemoveRule(priority int64) error {
+	return c.api.DoComputeOperation(http.MethodPost, fmt.Sprintf("%s/removeRule?priority=%d", c.policyURL, priority), nil)
+}
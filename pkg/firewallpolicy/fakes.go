@@ -0,0 +1,73 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewallpolicy
+
+import (
+	"fmt"
+	"net/http"
+
+	"google.golang.org/api/googleapi"
+)
+
+// FakeClient is a Client storing the rules of a policy in memory.
+type FakeClient struct {
+	Rules map[int64]*Rule
+}
+
+// NewFakeClient returns a new FakeClient.
+func NewFakeClient() *FakeClient {
+	return &FakeClient{Rules: map[int64]*Rule{}}
+}
+
+// GetRule implements Client.
+func (f *FakeClient) GetRule(priority int64) (*Rule, error) {
+	rule, ok := f.Rules[priority]
+	if !ok {
+		return nil, &googleapi.Error{Code: http.StatusNotFound}
+	}
+	copied := *rule
+	return &copied, nil
+}
+
+// AddRule implements Client.
+func (f *FakeClient) AddRule(rule *Rule) error {
+	if _, ok := f.Rules[rule.Priority]; ok {
+		return &googleapi.Error{Code: http.StatusBadRequest, Message: fmt.Sprintf("rule with priority %d already exists", rule.Priority)}
+	}
+	added := *rule
+	f.Rules[rule.Priority] = &added
+	return nil
+}
+
+// PatchRule implements Client.
+func (f *FakeClient) PatchRule(rule *Rule) error {
+	if _, ok := f.Rules[rule.Priority]; !ok {
+		return &googleapi.Error{Code: http.StatusNotFound}
+	}
+	patched := *rule
+	f.Rules[rule.Priority] = &patched
+	return nil
+}
+
+// RemoveRule implements Client.
+func (f *FakeClient) RemoveRule(priority int64) error {
+	if _, ok := f.Rules[priority]; !ok {
+		return &googleapi.Error{Code: http.StatusNotFound}
+	}
+	delete(f.Rules, priority)
+	return nil
+}
@@ -20,18 +20,22 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strconv"
+	"sync"
 	"time"
 
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/api/networking/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
 	listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/ingress-gce/pkg/annotations"
 	"k8s.io/ingress-gce/pkg/common/operator"
 	"k8s.io/ingress-gce/pkg/context"
 	"k8s.io/ingress-gce/pkg/controller/translator"
 	"k8s.io/ingress-gce/pkg/flags"
+	"k8s.io/ingress-gce/pkg/loadbalancers"
 	"k8s.io/ingress-gce/pkg/loadbalancers/features"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/klog"
@@ -47,6 +51,12 @@ var (
 	ErrNoILBIngress = errors.New("no ILB Ingress found")
 )
 
+// probePortCacheTTL is how long the ports of the readiness probes found by
+// negHealthCheckPorts are cached. The pods of a Service do not trigger firewall
+// syncs, so a changed probe is only picked up once its entry expires or the
+// Service changes.
+const probePortCacheTTL = 10 * time.Minute
+
 // FirewallController synchronizes the firewall rule for all ingresses.
 type FirewallController struct {
 	ctx          *context.ControllerContext
@@ -55,13 +65,28 @@ type FirewallController struct {
 	translator   *translator.Translator
 	nodeLister   cache.Indexer
 	hasSynced    func() bool
+	// probePorts caches the readiness probe ports of the NEG service ports,
+	// so that their pods are not listed on every sync.
+	probePorts cache.Store
+
+	errLock sync.Mutex
+	// syncErr is the error of the last sync of the firewall rule.
+	syncErr error
 }
 
 // NewFirewallController returns a new firewall controller.
 func NewFirewallController(
 	ctx *context.ControllerContext,
 	portRanges []string) *FirewallController {
-	firewallPool := NewFirewallPool(ctx.Cloud, ctx.ClusterNamer, gce.LoadBalancerSrcRanges(), portRanges)
+	if flags.F.FirewallNEGTargetPortsOnly {
+		// The node ports in use are passed to each sync instead.
+		portRanges = nil
+	}
+	var cloud Firewall = ctx.Cloud
+	if ctx.FirewallPolicyClient != nil {
+		cloud = NewPolicyFirewall(ctx.Cloud, ctx.FirewallPolicyClient, flags.F.FirewallPolicyRulePriority)
+	}
+	firewallPool := NewFirewallPool(cloud, ctx.ClusterNamer, gce.LoadBalancerSrcRanges(), portRanges)
 
 	fwc := &FirewallController{
 		ctx:          ctx,
@@ -69,29 +94,32 @@ func NewFirewallController(
 		translator:   translator.NewTranslator(ctx),
 		nodeLister:   ctx.NodeInformer.GetIndexer(),
 		hasSynced:    ctx.HasSynced,
+		probePorts: cache.NewTTLStore(func(obj interface{}) (string, error) {
+			return obj.(*cachedProbePort).key, nil
+		}, probePortCacheTTL),
 	}
 
 	fwc.queue = utils.NewPeriodicTaskQueue("", "firewall", fwc.sync)
 
 	// Ingress event handlers.
-	ctx.IngressInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+	ctx.AddIngressEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			addIng := obj.(*v1beta1.Ingress)
-			if !utils.IsGCEIngress(addIng) && !utils.IsGCEMultiClusterIngress(addIng) {
+			if !utils.IsGCEIngress(addIng, fwc.ctx.IngressClasses) && !utils.IsGCEMultiClusterIngress(addIng) {
 				return
 			}
 			fwc.queue.Enqueue(queueKey)
 		},
 		DeleteFunc: func(obj interface{}) {
 			delIng := obj.(*v1beta1.Ingress)
-			if !utils.IsGCEIngress(delIng) && !utils.IsGCEMultiClusterIngress(delIng) {
+			if !utils.IsGCEIngress(delIng, fwc.ctx.IngressClasses) && !utils.IsGCEMultiClusterIngress(delIng) {
 				return
 			}
 			fwc.queue.Enqueue(queueKey)
 		},
 		UpdateFunc: func(old, cur interface{}) {
 			curIng := cur.(*v1beta1.Ingress)
-			if !utils.IsGCEIngress(curIng) && !utils.IsGCEMultiClusterIngress(curIng) {
+			if !utils.IsGCEIngress(curIng, fwc.ctx.IngressClasses) && !utils.IsGCEMultiClusterIngress(curIng) {
 				return
 			}
 			fwc.queue.Enqueue(queueKey)
@@ -152,13 +180,20 @@ func (fwc *FirewallController) sync(key string) error {
 	klog.V(3).Infof("Syncing firewall")
 
 	gceIngresses := operator.Ingresses(fwc.ctx.Ingresses().List()).Filter(func(ing *v1beta1.Ingress) bool {
-		return utils.IsGCEIngress(ing)
+		return utils.IsGCEIngress(ing, fwc.ctx.IngressClasses)
 	}).AsList()
 
-	// If there are no more ingresses, then delete the firewall rule.
+	// If there are no more ingresses nor retained load balancers, then delete
+	// the firewall rule.
 	if len(gceIngresses) == 0 {
-		fwc.firewallPool.GC()
-		return nil
+		retained, err := loadbalancers.ListRetainedLoadBalancers(fwc.ctx.RetainedLoadBalancerInformer)
+		if err != nil {
+			return err
+		}
+		if len(retained) == 0 {
+			fwc.firewallPool.GC()
+			return nil
+		}
 	}
 
 	// gceSvcPorts contains the ServicePorts used by only single-cluster ingress.
@@ -167,7 +202,11 @@ func (fwc *FirewallController) sync(key string) error {
 	if err != nil {
 		return err
 	}
-	negPorts := fwc.translator.GatherEndpointPorts(gceSvcPorts)
+	ports := fwc.translator.GatherEndpointPorts(gceSvcPorts)
+	ports = append(ports, fwc.negHealthCheckPorts(gceSvcPorts)...)
+	if flags.F.FirewallNEGTargetPortsOnly {
+		ports = append(ports, igNodePorts(gceSvcPorts)...)
+	}
 
 	var additionalRanges []string
 	if flags.F.EnableL7Ilb {
@@ -182,26 +221,108 @@ func (fwc *FirewallController) sync(key string) error {
 	}
 
 	// Ensure firewall rule for the cluster and pass any NEG endpoint ports.
-	if err := fwc.firewallPool.Sync(nodeNames, negPorts, additionalRanges); err != nil {
+	err = fwc.firewallPool.Sync(nodeNames, ports, additionalRanges)
+	fwc.setSyncError(err)
+	if err != nil {
 		if fwErr, ok := err.(*FirewallXPNError); ok {
 			// XPN: Raise an event on each ingress
-			for _, ing := range gceIngresses {
-				if annotations.FromIngress(ing).SuppressFirewallXPNError() {
-					continue
-				}
-				fwc.ctx.Recorder(ing.Namespace).Eventf(ing, apiv1.EventTypeNormal, "XPN", fwErr.Message)
-			}
+			fwc.recordXPNError(gceIngresses, fwErr)
 		} else {
 			return err
 		}
+	} else {
+		fwc.clearFirewallSuggestion()
 	}
 	return nil
 }
 
+// SyncError returns the error of the last sync of the firewall rule, nil if
+// it succeeded.
+func (fwc *FirewallController) SyncError() error {
+	fwc.errLock.Lock()
+	defer fwc.errLock.Unlock()
+	return fwc.syncErr
+}
+
+func (fwc *FirewallController) setSyncError(err error) {
+	fwc.errLock.Lock()
+	defer fwc.errLock.Unlock()
+	fwc.syncErr = err
+}
+
+// negHealthCheckPorts returns the ports health checked on the endpoints of NEG
+// backends which may differ from their target ports: the port set in the
+// BackendConfig, the health check port of the Service, or the port of the
+// readiness probe.
+func (fwc *FirewallController) negHealthCheckPorts(svcPorts []utils.ServicePort) []string {
+	ports := sets.NewString()
+	for _, sp := range svcPorts {
+		if !sp.NEGEnabled {
+			continue
+		}
+		if sp.BackendConfig != nil && sp.BackendConfig.Spec.HealthCheck != nil && sp.BackendConfig.Spec.HealthCheck.Port != nil {
+			ports.Insert(strconv.FormatInt(*sp.BackendConfig.Spec.HealthCheck.Port, 10))
+			continue
+		}
+		if sp.HealthCheckPort != 0 {
+			ports.Insert(strconv.FormatInt(sp.HealthCheckPort, 10))
+			continue
+		}
+		if port := fwc.probePort(sp); port != "" {
+			ports.Insert(port)
+		}
+	}
+	return ports.List()
+}
+
+// cachedProbePort is the readiness probe port of the service port with the
+// given key, empty if it has none, found at the given version of its Service.
+type cachedProbePort struct {
+	key             string
+	resourceVersion string
+	port            string
+}
+
+// probePort returns the numeric port of the readiness probe of the NEG
+// service port, empty if it has none. The port is cached until it expires or
+// the Service changes.
+func (fwc *FirewallController) probePort(sp utils.ServicePort) string {
+	obj, exists, err := fwc.ctx.ServiceInformer.GetIndexer().GetByKey(sp.ID.Service.String())
+	if err != nil || !exists {
+		return ""
+	}
+	resourceVersion := obj.(*apiv1.Service).ResourceVersion
+	key := sp.ID.String()
+	if item, ok, err := fwc.probePorts.GetByKey(key); err == nil && ok && item.(*cachedProbePort).resourceVersion == resourceVersion {
+		return item.(*cachedProbePort).port
+	}
+	probe, err := fwc.translator.GetProbe(sp)
+	if err != nil {
+		return ""
+	}
+	port := ""
+	if probe != nil && probe.Handler.HTTPGet != nil && probe.Handler.HTTPGet.Port.Type == intstr.Int {
+		port = probe.Handler.HTTPGet.Port.String()
+	}
+	fwc.probePorts.Add(&cachedProbePort{key: key, resourceVersion: resourceVersion, port: port})
+	return port
+}
+
+// igNodePorts returns the node ports of the instance group backends.
+func igNodePorts(svcPorts []utils.ServicePort) []string {
+	ports := sets.NewString()
+	for _, sp := range svcPorts {
+		if !sp.NEGEnabled && sp.NodePort != 0 {
+			ports.Insert(strconv.FormatInt(sp.NodePort, 10))
+		}
+	}
+	return ports.List()
+}
+
 func (fwc *FirewallController) ilbFirewallSrcRange(gceIngresses []*v1beta1.Ingress) (string, error) {
 	ilbEnabled := false
 	for _, ing := range gceIngresses {
-		if utils.IsGCEL7ILBIngress(ing) {
+		if utils.IsGCEL7ILBIngress(ing, fwc.ctx.IngressClasses) {
 			ilbEnabled = true
 			break
 		}
@@ -17,14 +17,18 @@ limitations under the License.
 package firewalls
 
 import (
+	"reflect"
 	"testing"
 	"time"
 
 	api_v1 "k8s.io/api/core/v1"
 	"k8s.io/api/networking/v1beta1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes/fake"
+	backendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/backendconfig/v1beta1"
 	backendconfigclient "k8s.io/ingress-gce/pkg/backendconfig/client/clientset/versioned/fake"
+	"k8s.io/ingress-gce/pkg/flags"
 	test "k8s.io/ingress-gce/pkg/test"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/legacy-cloud-providers/gce"
@@ -101,3 +105,101 @@ func TestFirewallCreateDelete(t *testing.T) {
 		t.Fatalf("cloud.GetFirewall(%v) = _, %v, want _, 404 error", ruleName, err)
 	}
 }
+
+// TestFirewallNEGTargetPortsOnly asserts that only the node ports in use are
+// opened instead of the node port range.
+func TestFirewallNEGTargetPortsOnly(t *testing.T) {
+	flags.F.FirewallNEGTargetPortsOnly = true
+	defer func() { flags.F.FirewallNEGTargetPortsOnly = false }()
+	fwc := newFirewallController()
+
+	defaultSvc := test.NewService(test.DefaultBeSvcPort.ID.Service, api_v1.ServiceSpec{
+		Type: api_v1.ServiceTypeNodePort,
+		Ports: []api_v1.ServicePort{
+			{
+				Name:     "http",
+				Port:     80,
+				NodePort: 30000,
+			},
+		},
+	})
+	fwc.ctx.ServiceInformer.GetIndexer().Add(defaultSvc)
+	ing := test.NewIngress(types.NamespacedName{Name: "my-ingress", Namespace: "default"}, v1beta1.IngressSpec{})
+	fwc.ctx.IngressInformer.GetIndexer().Add(ing)
+
+	key, _ := utils.KeyFunc(queueKey)
+	if err := fwc.sync(key); err != nil {
+		t.Fatalf("fwc.sync() = %v, want nil", err)
+	}
+
+	fw, err := fwc.ctx.Cloud.GetFirewall(ruleName)
+	if err != nil {
+		t.Fatalf("cloud.GetFirewall(%v) = _, %v, want _, nil", ruleName, err)
+	}
+	if got, want := fw.Allowed[0].Ports, []string{"30000"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("firewall allows ports %v, want %v", got, want)
+	}
+}
+
+func TestNEGHealthCheckPorts(t *testing.T) {
+	fwc := newFirewallController()
+	port := int64(8080)
+
+	svcPorts := []utils.ServicePort{
+		{NodePort: 30001},
+		{
+			NEGEnabled: true,
+			BackendConfig: &backendconfigv1beta1.BackendConfig{
+				Spec: backendconfigv1beta1.BackendConfigSpec{HealthCheck: &backendconfigv1beta1.HealthCheckConfig{Port: &port}},
+			},
+		},
+		{NEGEnabled: true, HealthCheckPort: 9000},
+	}
+	if got, want := fwc.negHealthCheckPorts(svcPorts), []string{"8080", "9000"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("negHealthCheckPorts() = %v, want %v", got, want)
+	}
+	if got, want := igNodePorts(svcPorts), []string{"30001"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("igNodePorts() = %v, want %v", got, want)
+	}
+}
+
+// TestNEGHealthCheckProbePorts asserts that the readiness probe ports are
+// cached until the Service changes.
+func TestNEGHealthCheckProbePorts(t *testing.T) {
+	defer func(enable bool) { flags.F.EnableNEGProbeHealthChecks = enable }(flags.F.EnableNEGProbeHealthChecks)
+	flags.F.EnableNEGProbeHealthChecks = true
+
+	fwc := newFirewallController()
+	svcName := types.NamespacedName{Name: "my-service", Namespace: "default"}
+	svc := test.NewService(svcName, api_v1.ServiceSpec{
+		Selector: map[string]string{"app": "web"},
+		Ports:    []api_v1.ServicePort{{Port: 80, TargetPort: intstr.FromInt(8080)}},
+	})
+	svc.ResourceVersion = "1"
+	fwc.ctx.ServiceInformer.GetIndexer().Add(svc)
+	pod := &api_v1.Pod{
+		ObjectMeta: meta_v1.ObjectMeta{Name: "web", Namespace: "default", Labels: map[string]string{"app": "web"}},
+		Spec: api_v1.PodSpec{Containers: []api_v1.Container{{
+			Ports: []api_v1.ContainerPort{{ContainerPort: 8080}, {ContainerPort: 9090}, {ContainerPort: 9091}},
+			ReadinessProbe: &api_v1.Probe{Handler: api_v1.Handler{HTTPGet: &api_v1.HTTPGetAction{Port: intstr.FromInt(9090)}}},
+		}}},
+	}
+	fwc.ctx.PodInformer.GetIndexer().Add(pod)
+	svcPorts := []utils.ServicePort{{ID: utils.ServicePortID{Service: svcName, Port: intstr.FromInt(80)}, Port: 80, NEGEnabled: true}}
+
+	if got, want := fwc.negHealthCheckPorts(svcPorts), []string{"9090"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("negHealthCheckPorts() = %v, want %v", got, want)
+	}
+
+	pod.Spec.Containers[0].ReadinessProbe.Handler.HTTPGet.Port = intstr.FromInt(9091)
+	fwc.ctx.PodInformer.GetIndexer().Update(pod)
+	if got, want := fwc.negHealthCheckPorts(svcPorts), []string{"9090"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("negHealthCheckPorts() with a cached probe = %v, want %v", got, want)
+	}
+
+	svc.ResourceVersion = "2"
+	fwc.ctx.ServiceInformer.GetIndexer().Update(svc)
+	if got, want := fwc.negHealthCheckPorts(svcPorts), []string{"9091"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("negHealthCheckPorts() after a Service update = %v, want %v", got, want)
+	}
+}
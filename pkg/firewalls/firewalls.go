@@ -23,6 +23,8 @@ import (
 
 	"google.golang.org/api/compute/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
+	firewallsuggestionv1beta1 "k8s.io/ingress-gce/pkg/apis/firewallsuggestion/v1beta1"
+	"k8s.io/ingress-gce/pkg/flags"
 	"k8s.io/ingress-gce/pkg/utils"
 	namer_util "k8s.io/ingress-gce/pkg/utils/namer"
 	"k8s.io/klog"
@@ -39,7 +41,7 @@ const (
 // FirewallRules manages firewall rules.
 type FirewallRules struct {
 	cloud     Firewall
-	namer     *namer_util.Namer
+	namer     namer_util.IngressNamer
 	srcRanges []string
 	// TODO(rramkumar): Eliminate this variable. We should just pass in
 	// all the port ranges to open with each call to Sync()
@@ -49,7 +51,7 @@ type FirewallRules struct {
 // NewFirewallPool creates a new firewall rule manager.
 // cloud: the cloud object implementing Firewall.
 // namer: cluster namer.
-func NewFirewallPool(cloud Firewall, namer *namer_util.Namer, l7SrcRanges []string, nodePortRanges []string) SingleFirewallPool {
+func NewFirewallPool(cloud Firewall, namer namer_util.IngressNamer, l7SrcRanges []string, nodePortRanges []string) SingleFirewallPool {
 	_, err := netset.ParseIPNets(l7SrcRanges...)
 	if err != nil {
 		klog.Fatalf("Could not parse L7 src ranges %v for firewall rule: %v", l7SrcRanges, err)
@@ -66,15 +68,15 @@ func NewFirewallPool(cloud Firewall, namer *namer_util.Namer, l7SrcRanges []stri
 func (fr *FirewallRules) Sync(nodeNames, additionalPorts, additionalRanges []string) error {
 	klog.V(4).Infof("Sync(%v)", nodeNames)
 	name := fr.namer.FirewallRule()
-	existingFirewall, _ := fr.cloud.GetFirewall(name)
+	existingFirewall, err := fr.cloud.GetFirewall(name)
+	if err != nil && !utils.IsNotFoundError(err) {
+		return err
+	}
 
-	// Retrieve list of target tags from node names. This may be configured in
-	// gce.conf or computed by the GCE cloudprovider package.
-	targetTags, err := fr.cloud.GetNodeTags(nodeNames)
+	targetTags, targetServiceAccounts, err := fr.targets(nodeNames)
 	if err != nil {
 		return err
 	}
-	sort.Strings(targetTags)
 
 	// De-dupe ports
 	ports := sets.NewString(fr.portRanges...)
@@ -95,7 +97,8 @@ func (fr *FirewallRules) Sync(nodeNames, additionalPorts, additionalRanges []str
 				Ports:      ports.List(),
 			},
 		},
-		TargetTags: targetTags,
+		TargetTags:            targetTags,
+		TargetServiceAccounts: targetServiceAccounts,
 	}
 
 	if existingFirewall == nil {
@@ -113,6 +116,31 @@ func (fr *FirewallRules) Sync(nodeNames, additionalPorts, additionalRanges []str
 	return fr.updateFirewall(expectedFirewall)
 }
 
+// targets returns the target tags or, if configured, the target service
+// accounts of the firewall rule.
+func (fr *FirewallRules) targets(nodeNames []string) ([]string, []string, error) {
+	if len(flags.F.FirewallTargetSAs) > 0 {
+		return nil, sets.NewString(flags.F.FirewallTargetSAs...).List(), nil
+	}
+	if flags.F.FirewallPolicy != "" {
+		// Network firewall policies have no network tags, so the rule
+		// applies to all the instances of the network.
+		return nil, nil, nil
+	}
+	if len(flags.F.FirewallTargetTags) > 0 {
+		return sets.NewString(flags.F.FirewallTargetTags...).List(), nil, nil
+	}
+
+	// Retrieve list of target tags from node names. This may be configured in
+	// gce.conf or computed by the GCE cloudprovider package.
+	targetTags, err := fr.cloud.GetNodeTags(nodeNames)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(targetTags)
+	return targetTags, nil, nil
+}
+
 // GC deletes the firewall rule.
 func (fr *FirewallRules) GC() error {
 	name := fr.namer.FirewallRule()
@@ -132,7 +160,7 @@ func (fr *FirewallRules) createFirewall(f *compute.Firewall) error {
 	if utils.IsForbiddenError(err) && fr.cloud.OnXPN() {
 		gcloudCmd := gce.FirewallToGCloudCreateCmd(f, fr.cloud.NetworkProjectID())
 		klog.V(3).Infof("Could not create L7 firewall on XPN cluster: %v. Raising event for cmd: %q", err, gcloudCmd)
-		return newFirewallXPNError(err, gcloudCmd)
+		return newFirewallXPNError(err, gcloudCmd, newFirewallSuggestion(firewallsuggestionv1beta1.OperationCreate, f, fr.cloud.NetworkProjectID(), gcloudCmd))
 	}
 	return err
 }
@@ -142,7 +170,7 @@ func (fr *FirewallRules) updateFirewall(f *compute.Firewall) error {
 	if utils.IsForbiddenError(err) && fr.cloud.OnXPN() {
 		gcloudCmd := gce.FirewallToGCloudUpdateCmd(f, fr.cloud.NetworkProjectID())
 		klog.V(3).Infof("Could not update L7 firewall on XPN cluster: %v. Raising event for cmd: %q", err, gcloudCmd)
-		return newFirewallXPNError(err, gcloudCmd)
+		return newFirewallXPNError(err, gcloudCmd, newFirewallSuggestion(firewallsuggestionv1beta1.OperationUpdate, f, fr.cloud.NetworkProjectID(), gcloudCmd))
 	}
 	return err
 }
@@ -155,21 +183,25 @@ func (fr *FirewallRules) deleteFirewall(name string) error {
 	} else if utils.IsForbiddenError(err) && fr.cloud.OnXPN() {
 		gcloudCmd := gce.FirewallToGCloudDeleteCmd(name, fr.cloud.NetworkProjectID())
 		klog.V(3).Infof("Could not attempt delete of L7 firewall on XPN cluster: %v. %q needs to be ran.", err, gcloudCmd)
-		return newFirewallXPNError(err, gcloudCmd)
+		return newFirewallXPNError(err, gcloudCmd, newFirewallSuggestion(firewallsuggestionv1beta1.OperationDelete, &compute.Firewall{Name: name}, fr.cloud.NetworkProjectID(), gcloudCmd))
 	}
 	return err
 }
 
-func newFirewallXPNError(internal error, cmd string) *FirewallXPNError {
+func newFirewallXPNError(internal error, cmd string, suggestion *firewallsuggestionv1beta1.FirewallSuggestionSpec) *FirewallXPNError {
 	return &FirewallXPNError{
-		Internal: internal,
-		Message:  fmt.Sprintf("Firewall change required by network admin: `%v`", cmd),
+		Internal:   internal,
+		Message:    fmt.Sprintf("Firewall change required by network admin: `%v`", cmd),
+		Suggestion: suggestion,
 	}
 }
 
 type FirewallXPNError struct {
 	Internal error
 	Message  string
+	// Suggestion is the firewall change required, in a form which can be
+	// consumed by automation in the network project.
+	Suggestion *firewallsuggestionv1beta1.FirewallSuggestionSpec
 }
 
 func (f *FirewallXPNError) Error() string {
@@ -182,6 +214,11 @@ func equal(expected *compute.Firewall, existing *compute.Firewall) bool {
 		return false
 	}
 
+	if !sets.NewString(expected.TargetServiceAccounts...).Equal(sets.NewString(existing.TargetServiceAccounts...)) {
+		klog.V(5).Infof("Expected target service accounts %v, actually %v", expected.TargetServiceAccounts, existing.TargetServiceAccounts)
+		return false
+	}
+
 	expectedAllowed := allowedToStrings(expected.Allowed)
 	existingAllowed := allowedToStrings(existing.Allowed)
 	if !sets.NewString(expectedAllowed...).Equal(sets.NewString(existingAllowed...)) {
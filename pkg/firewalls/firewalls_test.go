@@ -17,11 +17,14 @@ limitations under the License.
 package firewalls
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 
 	"google.golang.org/api/compute/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
+	firewallsuggestionv1beta1 "k8s.io/ingress-gce/pkg/apis/firewallsuggestion/v1beta1"
+	"k8s.io/ingress-gce/pkg/flags"
 	"k8s.io/ingress-gce/pkg/utils/namer"
 )
 
@@ -182,6 +185,61 @@ func TestFirewallPoolGC(t *testing.T) {
 	}
 }
 
+func TestFirewallPoolSyncTargets(t *testing.T) {
+	defer func() {
+		flags.F.FirewallTargetTags = nil
+		flags.F.FirewallTargetSAs = nil
+	}()
+
+	nodes := []string{"node-a", "node-b"}
+	testCases := []struct {
+		desc       string
+		tags       []string
+		sas        []string
+		expectTags []string
+		expectSAs  []string
+	}{
+		{
+			desc:       "tags of the nodes",
+			expectTags: nodes,
+		},
+		{
+			desc:       "configured tags",
+			tags:       []string{"pool-b", "pool-a"},
+			expectTags: []string{"pool-a", "pool-b"},
+		},
+		{
+			desc:      "configured service accounts",
+			sas:       []string{"ingress-nodes@project.iam.gserviceaccount.com"},
+			expectSAs: []string{"ingress-nodes@project.iam.gserviceaccount.com"},
+		},
+	}
+
+	// The test cases share the firewall rule so that each one updates it.
+	fwp := NewFakeFirewallsProvider(false, false)
+	fp := NewFirewallPool(fwp, defaultNamer, srcRanges, portRanges())
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			flags.F.FirewallTargetTags = tc.tags
+			flags.F.FirewallTargetSAs = tc.sas
+
+			if err := fp.Sync(nodes, nil, nil); err != nil {
+				t.Fatalf("fp.Sync(%v, nil, nil) = %v; want nil", nodes, err)
+			}
+			f, err := fwp.GetFirewall(ruleName)
+			if err != nil {
+				t.Fatalf("GetFirewall(%q) = %v", ruleName, err)
+			}
+			if !sets.NewString(f.TargetTags...).Equal(sets.NewString(tc.expectTags...)) {
+				t.Errorf("Got target tags %v, want %v", f.TargetTags, tc.expectTags)
+			}
+			if !sets.NewString(f.TargetServiceAccounts...).Equal(sets.NewString(tc.expectSAs...)) {
+				t.Errorf("Got target service accounts %v, want %v", f.TargetServiceAccounts, tc.expectSAs)
+			}
+		})
+	}
+}
+
 // TestSyncOnXPNWithPermission tests that firwall sync continues to work when OnXPN=true
 func TestSyncOnXPNWithPermission(t *testing.T) {
 	// Fake XPN cluster with permission
@@ -206,6 +264,8 @@ func TestSyncXPNReadOnly(t *testing.T) {
 	err := fp.Sync(nodes, nil, nil)
 	if fwErr, ok := err.(*FirewallXPNError); !ok || !strings.Contains(fwErr.Message, "create") {
 		t.Errorf("Expected firewall sync error with a user message. Received err: %v", err)
+	} else if fwErr.Suggestion == nil || fwErr.Suggestion.Operation != firewallsuggestionv1beta1.OperationCreate || fwErr.Suggestion.Firewall.Name != ruleName {
+		t.Errorf("Expected firewall sync error with a suggestion to create %q. Received suggestion: %+v", ruleName, fwErr.Suggestion)
 	}
 
 	// Manually create the firewall
@@ -234,11 +294,15 @@ func TestSyncXPNReadOnly(t *testing.T) {
 	err = fp.Sync(nodes, nil, nil)
 	if fwErr, ok := err.(*FirewallXPNError); !ok || !strings.Contains(fwErr.Message, "update") {
 		t.Errorf("Expected firewall sync error with a user message. Received err: %v", err)
+	} else if fwErr.Suggestion == nil || fwErr.Suggestion.Operation != firewallsuggestionv1beta1.OperationUpdate || !reflect.DeepEqual(fwErr.Suggestion.Firewall.TargetTags, nodes) {
+		t.Errorf("Expected firewall sync error with a suggestion to update the target tags to %v. Received suggestion: %+v", nodes, fwErr.Suggestion)
 	}
 
 	err = fp.GC()
 	if fwErr, ok := err.(*FirewallXPNError); !ok || !strings.Contains(fwErr.Message, "delete") {
 		t.Errorf("Expected firewall sync error with a user message. Received err: %v", err)
+	} else if fwErr.Suggestion == nil || fwErr.Suggestion.Operation != firewallsuggestionv1beta1.OperationDelete {
+		t.Errorf("Expected firewall sync error with a suggestion to delete %q. Received suggestion: %+v", ruleName, fwErr.Suggestion)
 	}
 }
 
@@ -0,0 +1,124 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalls
+
+import (
+	"fmt"
+	"net/http"
+
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	"k8s.io/ingress-gce/pkg/firewallpolicy"
+	"k8s.io/klog"
+)
+
+// policyFirewall is a Firewall managing a rule of a network firewall policy
+// instead of a VPC firewall rule. The rule is identified by its priority in
+// the policy, and carries the name of the firewall as rule name.
+type policyFirewall struct {
+	// Firewall provides the node tags and network of the cluster.
+	Firewall
+	client   firewallpolicy.Client
+	priority int64
+}
+
+// NewPolicyFirewall returns a Firewall which manages the rule with the given
+// priority of the firewall policy of client. Network firewall policies do
+// not support network tags, so the target tags of the firewalls are ignored.
+func NewPolicyFirewall(cloud Firewall, client firewallpolicy.Client, priority int64) Firewall {
+	return &policyFirewall{Firewall: cloud, client: client, priority: priority}
+}
+
+// GetFirewall implements Firewall. A rule with the priority but another name
+// is not returned, as it is not managed by the controller.
+func (pf *policyFirewall) GetFirewall(name string) (*compute.Firewall, error) {
+	rule, err := pf.client.GetRule(pf.priority)
+	if err != nil {
+		return nil, err
+	}
+	if rule.RuleName != name {
+		return nil, fmt.Errorf("priority %d of the firewall policy is used by rule %q", pf.priority, rule.RuleName)
+	}
+	return ruleToFirewall(rule), nil
+}
+
+// CreateFirewall implements Firewall.
+func (pf *policyFirewall) CreateFirewall(f *compute.Firewall) error {
+	return pf.client.AddRule(pf.firewallToRule(f))
+}
+
+// UpdateFirewall implements Firewall.
+func (pf *policyFirewall) UpdateFirewall(f *compute.Firewall) error {
+	return pf.client.PatchRule(pf.firewallToRule(f))
+}
+
+// DeleteFirewall implements Firewall.
+func (pf *policyFirewall) DeleteFirewall(name string) error {
+	rule, err := pf.client.GetRule(pf.priority)
+	if err != nil {
+		return err
+	}
+	if rule.RuleName != name {
+		klog.V(3).Infof("Not removing rule %q with priority %d of the firewall policy, it is not %q", rule.RuleName, pf.priority, name)
+		return &googleapi.Error{Code: http.StatusNotFound}
+	}
+	return pf.client.RemoveRule(pf.priority)
+}
+
+// OnXPN implements Firewall. The gcloud commands of FirewallXPNErrors are
+// for VPC firewall rules, so permission errors are returned as is.
+func (pf *policyFirewall) OnXPN() bool {
+	return false
+}
+
+func (pf *policyFirewall) firewallToRule(f *compute.Firewall) *firewallpolicy.Rule {
+	rule := &firewallpolicy.Rule{
+		Priority:              pf.priority,
+		RuleName:              f.Name,
+		Description:           f.Description,
+		Direction:             "INGRESS",
+		Action:                "allow",
+		Match:                 &firewallpolicy.RuleMatcher{SrcIPRanges: f.SourceRanges},
+		TargetServiceAccounts: f.TargetServiceAccounts,
+	}
+	for _, allowed := range f.Allowed {
+		rule.Match.Layer4Configs = append(rule.Match.Layer4Configs, &firewallpolicy.Layer4Config{
+			IPProtocol: allowed.IPProtocol,
+			Ports:      allowed.Ports,
+		})
+	}
+	return rule
+}
+
+func ruleToFirewall(rule *firewallpolicy.Rule) *compute.Firewall {
+	f := &compute.Firewall{
+		Name:                  rule.RuleName,
+		Description:           rule.Description,
+		TargetServiceAccounts: rule.TargetServiceAccounts,
+	}
+	if rule.Match == nil {
+		return f
+	}
+	f.SourceRanges = rule.Match.SrcIPRanges
+	for _, l4 := range rule.Match.Layer4Configs {
+		f.Allowed = append(f.Allowed, &compute.FirewallAllowed{
+			IPProtocol: l4.IPProtocol,
+			Ports:      l4.Ports,
+		})
+	}
+	return f
+}
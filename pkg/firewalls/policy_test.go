@@ -0,0 +1,95 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalls
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/ingress-gce/pkg/firewallpolicy"
+	"k8s.io/ingress-gce/pkg/flags"
+)
+
+func TestFirewallPoolSyncPolicy(t *testing.T) {
+	defer func(policy string) { flags.F.FirewallPolicy = policy }(flags.F.FirewallPolicy)
+	flags.F.FirewallPolicy = "policy"
+	const priority = 1000
+
+	client := firewallpolicy.NewFakeClient()
+	fp := NewFirewallPool(NewPolicyFirewall(NewFakeFirewallsProvider(false, false), client, priority), defaultNamer, srcRanges, portRanges())
+	nodes := []string{"node-a", "node-b", "node-c"}
+
+	if err := fp.Sync(nodes, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := &firewallpolicy.Rule{
+		Priority:    priority,
+		RuleName:    ruleName,
+		Description: "GCE L7 firewall rule",
+		Direction:   "INGRESS",
+		Action:      "allow",
+		Match: &firewallpolicy.RuleMatcher{
+			SrcIPRanges:   srcRanges,
+			Layer4Configs: []*firewallpolicy.Layer4Config{{IPProtocol: "tcp", Ports: portRanges()}},
+		},
+	}
+	verifyPolicyRule(t, client, want)
+
+	// An update of the ports patches the rule.
+	if err := fp.Sync(nodes, []string{"8080"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	want.Match.Layer4Configs[0].Ports = append(portRanges(), "8080")
+	verifyPolicyRule(t, client, want)
+
+	if err := fp.GC(); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.Rules) != 0 {
+		t.Errorf("Rules = %v, want none after GC", client.Rules)
+	}
+
+	// A rule of another name with the priority is neither replaced nor removed.
+	other := &firewallpolicy.Rule{Priority: priority, RuleName: "other"}
+	client.Rules[priority] = other
+	if err := fp.Sync(nodes, nil, nil); err == nil || !strings.Contains(err.Error(), `used by rule "other"`) {
+		t.Errorf("Sync() = %v, want error as the priority is in use", err)
+	}
+	if err := fp.GC(); err != nil {
+		t.Fatal(err)
+	}
+	if got := client.Rules[priority]; !reflect.DeepEqual(got, other) {
+		t.Errorf("Rules[%d] = %+v, want %+v", priority, got, other)
+	}
+}
+
+func verifyPolicyRule(t *testing.T, client *firewallpolicy.FakeClient, want *firewallpolicy.Rule) {
+	t.Helper()
+	got, err := client.GetRule(want.Priority)
+	if err != nil {
+		t.Fatalf("GetRule(%d) = %v", want.Priority, err)
+	}
+	if !sets.NewString(got.Match.SrcIPRanges...).Equal(sets.NewString(want.Match.SrcIPRanges...)) {
+		t.Errorf("SrcIPRanges = %v, want %v", got.Match.SrcIPRanges, want.Match.SrcIPRanges)
+	}
+	got.Match.SrcIPRanges = want.Match.SrcIPRanges
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Rule = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalls
+
+import (
+	"encoding/json"
+
+	"google.golang.org/api/compute/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/api/networking/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/ingress-gce/pkg/annotations"
+	apisfirewallsuggestion "k8s.io/ingress-gce/pkg/apis/firewallsuggestion"
+	firewallsuggestionv1beta1 "k8s.io/ingress-gce/pkg/apis/firewallsuggestion/v1beta1"
+	"k8s.io/ingress-gce/pkg/crd"
+	"k8s.io/klog"
+)
+
+// FirewallSuggestionAnnotationKey is the annotation of the XPN events raised
+// on Ingresses which holds the suggested firewall change as JSON.
+const FirewallSuggestionAnnotationKey = "networking.gke.io/firewall-suggestion"
+
+// SuggestionCRDMeta returns the metadata of the FirewallSuggestion CRD.
+func SuggestionCRDMeta() *crd.CRDMeta {
+	return crd.NewCRDMeta(
+		apisfirewallsuggestion.GroupName,
+		"v1beta1",
+		"FirewallSuggestion",
+		"FirewallSuggestionList",
+		"firewallsuggestion",
+		"firewallsuggestions",
+	)
+}
+
+// newFirewallSuggestion returns the suggestion to apply op to the firewall
+// rule f in the network project.
+func newFirewallSuggestion(op string, f *compute.Firewall, project, cmd string) *firewallsuggestionv1beta1.FirewallSuggestionSpec {
+	rule := firewallsuggestionv1beta1.FirewallRule{
+		Name:                  f.Name,
+		Network:               f.Network,
+		Description:           f.Description,
+		SourceRanges:          f.SourceRanges,
+		TargetTags:            f.TargetTags,
+		TargetServiceAccounts: f.TargetServiceAccounts,
+	}
+	for _, allowed := range f.Allowed {
+		rule.Allowed = append(rule.Allowed, firewallsuggestionv1beta1.FirewallAllowed{
+			IPProtocol: allowed.IPProtocol,
+			Ports:      allowed.Ports,
+		})
+	}
+	return &firewallsuggestionv1beta1.FirewallSuggestionSpec{
+		Operation: op,
+		Project:   project,
+		Firewall:  rule,
+		Command:   cmd,
+	}
+}
+
+// recordXPNError raises an event with the suggested firewall change on each
+// ingress, and stores the suggestion in a FirewallSuggestion when enabled.
+func (fwc *FirewallController) recordXPNError(ings []*v1beta1.Ingress, fwErr *FirewallXPNError) {
+	eventAnnotations := map[string]string{}
+	if fwErr.Suggestion != nil {
+		data, err := json.Marshal(fwErr.Suggestion)
+		if err != nil {
+			klog.Errorf("Failed to encode firewall suggestion %+v: %v", fwErr.Suggestion, err)
+		} else {
+			eventAnnotations[FirewallSuggestionAnnotationKey] = string(data)
+		}
+	}
+
+	for _, ing := range ings {
+		if annotations.FromIngress(ing).SuppressFirewallXPNError() {
+			continue
+		}
+		fwc.ctx.Recorder(ing.Namespace).AnnotatedEventf(ing, eventAnnotations, apiv1.EventTypeNormal, "XPN", fwErr.Message)
+	}
+
+	if fwc.ctx.FirewallSuggestionClient != nil && fwErr.Suggestion != nil {
+		if err := ensureFirewallSuggestion(fwc.ctx.FirewallSuggestionClient, fwc.ctx.ClusterNamer.FirewallRule(), fwErr.Suggestion); err != nil {
+			klog.Errorf("Failed to ensure FirewallSuggestion %q: %v", fwc.ctx.ClusterNamer.FirewallRule(), err)
+		}
+	}
+}
+
+// clearFirewallSuggestion deletes the FirewallSuggestion once the firewall
+// rule is up to date.
+func (fwc *FirewallController) clearFirewallSuggestion() {
+	if fwc.ctx.FirewallSuggestionClient == nil {
+		return
+	}
+	name := fwc.ctx.ClusterNamer.FirewallRule()
+	if err := fwc.ctx.FirewallSuggestionClient.Delete(name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		klog.Errorf("Failed to delete FirewallSuggestion %q: %v", name, err)
+	}
+}
+
+// ensureFirewallSuggestion creates or updates the FirewallSuggestion with
+// the given name so that its spec is the given spec.
+func ensureFirewallSuggestion(client dynamic.ResourceInterface, name string, spec *firewallsuggestionv1beta1.FirewallSuggestionSpec) error {
+	obj, err := toUnstructuredSuggestion(name, spec)
+	if err != nil {
+		return err
+	}
+
+	existing, err := client.Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		klog.V(2).Infof("Creating FirewallSuggestion %q for %s of firewall %q", name, spec.Operation, spec.Firewall.Name)
+		_, err = client.Create(obj, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	obj.SetResourceVersion(existing.GetResourceVersion())
+	_, err = client.Update(obj, metav1.UpdateOptions{})
+	return err
+}
+
+func toUnstructuredSuggestion(name string, spec *firewallsuggestionv1beta1.FirewallSuggestionSpec) (*unstructured.Unstructured, error) {
+	suggestion := &firewallsuggestionv1beta1.FirewallSuggestion{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: firewallsuggestionv1beta1.SchemeGroupVersion.String(),
+			Kind:       "FirewallSuggestion",
+		},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       *spec,
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(suggestion)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalls
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	firewallsuggestionv1beta1 "k8s.io/ingress-gce/pkg/apis/firewallsuggestion/v1beta1"
+)
+
+func TestToUnstructuredSuggestion(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		op       string
+		firewall *compute.Firewall
+	}{
+		{
+			desc: "create",
+			op:   firewallsuggestionv1beta1.OperationCreate,
+			firewall: &compute.Firewall{
+				Name:         ruleName,
+				Network:      "global/networks/default",
+				SourceRanges: srcRanges,
+				TargetTags:   []string{"node-a", "node-b"},
+				Allowed: []*compute.FirewallAllowed{
+					{IPProtocol: "tcp", Ports: portRanges()},
+				},
+			},
+		},
+		{
+			desc:     "delete",
+			op:       firewallsuggestionv1beta1.OperationDelete,
+			firewall: &compute.Firewall{Name: ruleName},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			spec := newFirewallSuggestion(tc.op, tc.firewall, "network-project", "gcloud compute firewall-rules")
+			obj, err := toUnstructuredSuggestion(ruleName, spec)
+			if err != nil {
+				t.Fatalf("toUnstructuredSuggestion(%q, %+v) = %v", ruleName, spec, err)
+			}
+			if obj.GetName() != ruleName || obj.GetKind() != "FirewallSuggestion" || obj.GetAPIVersion() != "networking.gke.io/v1beta1" {
+				t.Errorf("Got object %s %s %q, want FirewallSuggestion networking.gke.io/v1beta1 %q", obj.GetKind(), obj.GetAPIVersion(), obj.GetName(), ruleName)
+			}
+
+			suggestion := &firewallsuggestionv1beta1.FirewallSuggestion{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, suggestion); err != nil {
+				t.Fatalf("FromUnstructured() = %v", err)
+			}
+			if !reflect.DeepEqual(suggestion.Spec, *spec) {
+				t.Errorf("Got spec %+v, want %+v", suggestion.Spec, *spec)
+			}
+			if got := suggestion.Spec.Firewall; got.Name != tc.firewall.Name || len(got.Allowed) != len(tc.firewall.Allowed) {
+				t.Errorf("Got firewall %+v, want %+v", got, tc.firewall)
+			}
+		})
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	flag "github.com/spf13/pflag"
@@ -55,6 +56,11 @@ const (
 
 	// DefaultLockObjectName is the object name of the lock object.
 	DefaultLockObjectName = "ingress-gce-lock"
+
+	// ScopeGlobal selects global backend services and an external load balancer.
+	ScopeGlobal = "global"
+	// ScopeRegional selects regional backend services and an internal load balancer.
+	ScopeRegional = "regional"
 )
 
 var (
@@ -63,17 +69,22 @@ var (
 		APIServerHost               string
 		ClusterName                 string
 		ConfigFilePath              string
+		GCEKeyFile                  string
 		DefaultSvcHealthCheckPath   string
 		DefaultSvc                  string
 		DefaultSvcPortName          string
+		DefaultBackendGCEService    string
 		DeleteAllOnQuit             bool
 		EnableFrontendConfig        bool
 		GCERateLimit                RateLimitSpecs
 		GCEOperationPollInterval    time.Duration
+		GCECacheTTL                 time.Duration
 		HealthCheckPath             string
 		HealthzPort                 int
+		EnablePprof                 bool
 		InCluster                   bool
 		IngressClass                string
+		IngressClassScopes          IngressClassScopes
 		KubeConfigFile              string
 		ResyncPeriod                time.Duration
 		Version                     bool
@@ -81,17 +92,123 @@ var (
 		NodePortRanges              PortRanges
 		NegGCPeriod                 time.Duration
 		NegSyncerType               string
+		NegEndpointsCalculator      string
 		EnableReadinessReflector    bool
 		FinalizerAdd                bool
 		FinalizerRemove             bool
+		EnableNEGFinalizer          bool
+		GCCrawlPeriod               time.Duration
+		GCCrawlDryRun               bool
+		DiagnosticsPeriod           time.Duration
 		EnableL7Ilb                 bool
 		EnableCSM                   bool
 		CSMServiceNEGSkipNamespaces []string
+		EnableStartupChecks         bool
+		StartupCheckReport          string
+		PreserveManagedStaticIPs    bool
+		DisableInstanceGroups       bool
+		L7IlbProxySubnetCIDR        string
+		EnableDefaultConfigs        bool
+		DefaultConfigNamespace      string
+		OrgPolicyFile               string
+		NamespaceServiceAccounts    string
+		EnableSharedHealthChecks    bool
+		EnableNEGProbeHealthChecks  bool
+		FirewallNEGTargetPortsOnly  bool
+		NegAttachWarmPodsFirst      bool
+		NegCoalesceWindow           time.Duration
+		NegSyncerConcurrency        int
+		NegSyncerWorkers            int
+		NegMaxUnavailableEndpoints  int
+		NegMaxEndpoints             int
+		NegZoneSubnetworks          ZoneSubnetworks
+		EnableNEGReplacement        bool
+		NegSnapshotConfigMap        string
+		FirewallSuggestionNamespace string
+		EnableAlertPolicies         bool
+		EnableBackendServicesStatus bool
+		EnableRetainedLoadBalancers bool
+		FirewallTargetTags          []string
+		FirewallTargetSAs           []string
+		SSLCertExpiryWarningPeriod  time.Duration
+		FirewallPolicy              string
+		FirewallPolicyRegion        string
+		FirewallPolicyRulePriority  int64
+		MaxIGSize                   int
+		Namer                       string
+		NodeIncludeUnschedulable    bool
+		NodeIncludeNotReady         bool
+		NodeExcludeTaints           []string
+		EnableMTUChecks             bool
+		NodeMTULabel                string
+		EnableNEGMigration          bool
+		NEGMigrationTimeout         time.Duration
+		EnableProxyKeepAlive        bool
+		EnableMutualTLS             bool
+		RunL4Controller             bool
+		L4SubsetSizePerZone         int
+		EnableIngressClasses        bool
+		EnableGateways              bool
+		EnableV2FrontendNamer       bool
+		ShardIngresses              bool
+		SyncErrorWarningThreshold   int
+		SyncStuckThreshold          time.Duration
+		WebhookPort                 int
+		WebhookCertFile             string
+		WebhookKeyFile              string
+		StrictAnnotationValidation  bool
+		PropagatedLabels            []string
+		ReloadConfigMap             string
+		EnableQuotaChecks           bool
+		EnableAsyncOperations       bool
 
 		LeaderElection LeaderElectionConfiguration
 	}{}
+
+	// reloadLock guards the fields of F which --reload-config-map sets while
+	// the controller runs.
+	reloadLock sync.RWMutex
 )
 
+// ReloadableFlags are the flags which --reload-config-map sets while the
+// controller runs.
+type ReloadableFlags struct {
+	PreserveManagedStaticIPs   bool
+	SyncStuckThreshold         time.Duration
+	SSLCertExpiryWarningPeriod time.Duration
+	NodeIncludeUnschedulable   bool
+	NodeIncludeNotReady        bool
+	NegAttachWarmPodsFirst     bool
+	EnableSharedHealthChecks   bool
+	MaxIGSize                  int
+}
+
+// Reloadable returns the current value of the ReloadableFlags. The sync loops
+// must read these flags through it rather than F, which the reload updates
+// concurrently.
+func Reloadable() ReloadableFlags {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+	return ReloadableFlags{
+		PreserveManagedStaticIPs:   F.PreserveManagedStaticIPs,
+		SyncStuckThreshold:         F.SyncStuckThreshold,
+		SSLCertExpiryWarningPeriod: F.SSLCertExpiryWarningPeriod,
+		NodeIncludeUnschedulable:   F.NodeIncludeUnschedulable,
+		NodeIncludeNotReady:        F.NodeIncludeNotReady,
+		NegAttachWarmPodsFirst:     F.NegAttachWarmPodsFirst,
+		EnableSharedHealthChecks:   F.EnableSharedHealthChecks,
+		MaxIGSize:                  F.MaxIGSize,
+	}
+}
+
+// UpdateReloadable calls update, which sets some ReloadableFlags, while
+// Reloadable is blocked.
+func UpdateReloadable(update func() error) error {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+	return update()
+}
+
 type LeaderElectionConfiguration struct {
 	config.LeaderElectionConfiguration
 
@@ -140,6 +257,10 @@ resources.`)
 	flag.StringVar(&F.ConfigFilePath, "config-file-path", "",
 		`Path to a file containing the gce config. If left unspecified this
 controller only works with default zones.`)
+	flag.StringVar(&F.GCEKeyFile, "gce-key-file", "",
+		`Path to a service account key file used for the GCE API when neither
+Workload Identity nor the metadata server provide credentials, e.g. outside of GCP.
+The gce config file must then set the project-id, local-zone and network-name.`)
 	flag.StringVar(&F.DefaultSvcHealthCheckPath, "default-backend-health-check-path", "/healthz",
 		`Path used to health-check the default backend service. This path must serve a 200 page.
 Flags default-backend-service and default-backend-service-port should never be empty - default
@@ -150,6 +271,11 @@ form namespace/name.`)
 	flag.StringVar(&F.DefaultSvcPortName, "default-backend-service-port", "http",
 		`Specify the default service's port used to serve a 404 page for the default backend. Takes
 only the port's name - not its number.`)
+	flag.StringVar(&F.DefaultBackendGCEService, "default-backend-gce-service", "",
+		`Optional, name or self-link of an existing global backend service of the
+project used as the default backend of the external Ingresses without one,
+instead of default-backend-service which is then not required to exist. The
+controller does not manage this backend service.`)
 	flag.BoolVar(&F.DeleteAllOnQuit, "delete-all-on-quit", false,
 		`If true, the controller will delete all Ingress and the associated
 external cloud resources as it's shutting down. Mostly used for testing. In
@@ -168,11 +294,18 @@ If you want to still use the default, simply specify it along with your other
 values.`)
 	flag.DurationVar(&F.GCEOperationPollInterval, "gce-operation-poll-interval", time.Second,
 		`Minimum time between polling requests to GCE for checking the status of an operation.`)
+	flag.DurationVar(&F.GCECacheTTL, "gce-cache-ttl", 0,
+		`Optional, cache the NEGs, backend services and health checks read from GCE for
+this long, so that the repeated reads of a sync don't each call the API. Writes
+by the controller invalidate the cached resource. Disabled if zero.`)
 	flag.StringVar(&F.HealthCheckPath, "health-check-path", "/",
 		`Path used to health-check a backend service. All Services must serve a
 200 page on this path. Currently this is only configurable globally.`)
 	flag.IntVar(&F.HealthzPort, "healthz-port", 8081,
 		`Port to run healthz server. Must match the health check port in yaml.`)
+	flag.BoolVar(&F.EnablePprof, "enable-pprof", false,
+		`Optional, serve the pprof profiles on /debug/pprof/ and the expvar variables
+on /debug/vars of the healthz server.`)
 	flag.BoolVar(&F.InCluster, "running-in-cluster", true,
 		`Optional, if this controller is running in a kubernetes cluster, use
 the pod secrets for creating a Kubernetes client.`)
@@ -186,6 +319,11 @@ the pod secrets for creating a Kubernetes client.`)
 		`Print the version of the controller and exit`)
 	flag.StringVar(&F.IngressClass, "ingress-class", "",
 		`If set, overrides what ingress classes are managed by the controller.`)
+	flag.Var(&F.IngressClassScopes, "ingress-class-scopes",
+		`Optional, backend service scope of additional ingress classes managed by
+the controller, which also selects the load balancer flavor. CSV of class=scope
+where scope is "global" or "regional". Regional classes require --enable-l7-ilb.
+Example: --ingress-class-scopes=internal-apps=regional,external-apps=global`)
 	flag.Var(&F.NodePortRanges, "node-port-ranges", `Node port/port-ranges whitelisted for the
 L7 load balancing. CSV values accepted. Example: -node-port-ranges=80,8080,400-500`)
 
@@ -195,15 +333,273 @@ L7 load balancing. CSV values accepted. Example: -node-port-ranges=80,8080,400-5
 	flag.DurationVar(&F.NegGCPeriod, "neg-gc-period", 120*time.Second,
 		`Relist and garbage collect NEGs this often.`)
 	flag.StringVar(&F.NegSyncerType, "neg-syncer-type", "transaction", "Define the NEG syncer type to use. Valid values are \"batch\" and \"transaction\"")
+	flag.StringVar(&F.NegEndpointsCalculator, "neg-endpoints-calculator", "endpoints", "Name of the registered endpoints calculator used by the transaction NEG syncer to compute NEG endpoints. The default \"endpoints\" uses the Endpoints of the service.")
 	flag.BoolVar(&F.EnableReadinessReflector, "enable-readiness-reflector", true, "Enable NEG Readiness Reflector")
+	flag.StringVar(&F.Namer, "namer", "default", "Name of the registered namer used to name the GCE resources of Ingresses. The default \"default\" uses the standard naming scheme.")
 	flag.BoolVar(&F.FinalizerAdd, "enable-finalizer-add",
 		F.FinalizerAdd, "Enable adding Finalizer to Ingress.")
 	flag.BoolVar(&F.FinalizerRemove, "enable-finalizer-remove",
 		F.FinalizerRemove, "Enable removing Finalizer from Ingress.")
+	flag.DurationVar(&F.GCCrawlPeriod, "gc-crawl-period", 0,
+		`Optional, list all the GCE resources of the load balancers of the cluster
+this often, and delete those which are not used by any Ingress or Service anymore,
+e.g. resources leaked while the controller was down. Resources are deleted when
+found orphaned by two consecutive crawls. Disabled if 0.`)
+	flag.BoolVar(&F.GCCrawlDryRun, "gc-crawl-dry-run", false,
+		`Optional, only report the orphaned GCE resources found by --gc-crawl-period
+instead of deleting them.`)
+	flag.DurationVar(&F.DiagnosticsPeriod, "diagnostics-period", 0,
+		`Optional, scan the Ingresses and Services this often for frequent
+misconfigurations: NEG annotations exposing missing ports, missing
+BackendConfigs, backend Services of the wrong type, and firewall rules denied by
+an organization policy. Findings are raised as warning Events and written to the
+cluster-scoped DiagnosticReport "ingress-gce", whose CRD is installed when set.
+Disabled if 0.`)
+	flag.BoolVar(&F.EnableNEGFinalizer, "enable-neg-finalizer", false,
+		`Optional, add a finalizer to the Services with NEGs, so that their NEGs
+are deleted before the Services are. Disabling it removes the finalizer from
+the Services.`)
 	flag.BoolVar(&F.EnableL7Ilb, "enable-l7-ilb", false,
 		`Optional, whether or not to enable L7-ILB.`)
+	flag.StringVar(&F.L7IlbProxySubnetCIDR, "l7-ilb-proxy-subnet-cidr", "",
+		`Optional, IP range of the proxy-only subnet created by the controller for
+L7-ILB when the network of the cluster has none in its region. If empty, a
+missing proxy-only subnet is reported on the Ingress and has to be created manually.`)
+	flag.BoolVar(&F.EnableDefaultConfigs, "enable-default-configs", false,
+		`Optional, whether or not to apply the BackendConfig and FrontendConfig named
+"default" to the Services and Ingresses of their namespace. Fields set in a
+referenced config take precedence over the namespace default, which takes
+precedence over the default in --default-config-namespace.`)
+	flag.StringVar(&F.DefaultConfigNamespace, "default-config-namespace", "kube-system",
+		`Namespace of the cluster-wide default BackendConfig and FrontendConfig, used
+with --enable-default-configs.`)
+	flag.StringVar(&F.OrgPolicyFile, "org-policy-file", "",
+		`Optional, path to a JSON file with the effective organization policies of the
+project, as output by "gcloud resource-manager org-policies list --effective
+--format=json". Ingresses which would violate one of them are reported with an
+event instead of being retried. The file is re-read on every sync.`)
+	flag.StringVar(&F.NamespaceServiceAccounts, "namespace-service-accounts-configmap", "",
+		`Optional, "namespace/name" of a ConfigMap mapping namespaces to the emails of GCP
+service accounts. The load balancers of the Ingresses of a mapped namespace are
+created and updated as its service account, so that GCP audit logs attribute the
+changes to the tenant. The controller must be able to create access tokens for
+these service accounts.`)
+	flag.BoolVar(&F.EnableSharedHealthChecks, "enable-shared-health-checks", false,
+		`Optional, share a single health check between the backend services with
+identical health check settings instead of creating one per backend service.
+Shared health checks are deleted once no backend service references them.
+Does not apply to L7-ILB.`)
+	flag.BoolVar(&F.EnableNEGProbeHealthChecks, "enable-neg-probe-health-checks", false,
+		`Optional, use the port and scheme of the readiness probes of the pods in the
+health checks of NEG backends, even if they differ from the serving port and
+protocol, and update the path, host and port of the health checks when the
+probe picked among the pods of the Service changes, e.g. during a rollout.`)
+	flag.BoolVar(&F.FirewallNEGTargetPortsOnly, "firewall-neg-target-ports-only", false,
+		`Optional, open only the target ports of NEG backends, and the node ports of the
+Services used by instance group backends, in the L7 firewall rule instead of
+--node-port-ranges.`)
+	flag.BoolVar(&F.NegAttachWarmPodsFirst, "neg-attach-warm-pods-first", false,
+		`Optional, when more endpoints need to be attached to a NEG than fit in a single
+batch, attach the endpoints of the pods that have been Ready the longest first.
+Only applies to the transaction NEG syncer.`)
+	flag.DurationVar(&F.NegCoalesceWindow, "neg-coalesce-window", 0,
+		`Optional, delay the calls attaching or detaching NEG endpoints by this window
+to coalesce the calls of all syncers for the same NEG, zone and operation
+into a single call of up to 500 endpoints. Disabled if zero.`)
+	flag.IntVar(&F.NegSyncerConcurrency, "neg-syncer-concurrency", 0,
+		`Optional, maximum number of NEG syncers syncing at the same time. Unlimited
+if zero.`)
+	flag.IntVar(&F.NegSyncerWorkers, "neg-syncer-workers", 0,
+		`Optional, maximum number of calls of each NEG syncer attaching or detaching
+endpoints at the same time. Unlimited if zero.`)
+	flag.IntVar(&F.NegMaxUnavailableEndpoints, "neg-max-unavailable-endpoints", 0,
+		`Optional, maximum number of endpoints of Ready pods being detached from a NEG
+in a zone at the same time, the others being detached once they are done.
+Unlimited if zero. Only applies to the transaction NEG syncer.`)
+	flag.IntVar(&F.NegMaxEndpoints, "neg-max-endpoints", 10000,
+		`Optional, maximum number of endpoints of a NEG in a zone. The endpoints of a
+Service beyond it are left out of the NEG with a warning event, the lowest IPs
+being kept. Unlimited if zero. Only applies to the transaction NEG syncer.`)
+	flag.Var(&F.NegZoneSubnetworks, "neg-zone-subnetworks",
+		`Optional, subnetwork of the NEGs of each zone, for clusters whose nodes use a
+different subnetwork per zone. CSV of zone=subnetwork URL. The NEGs of the other
+zones use the subnetwork of the cluster.
+Example: --neg-zone-subnetworks=us-central1-a=projects/p/regions/us-central1/subnetworks/a`)
+	flag.BoolVar(&F.EnableNEGReplacement, "enable-neg-replacement", false,
+		`Optional, recreate the NEGs of another endpoint type, network or subnetwork
+even if backend services of the cluster use them, by moving their traffic to a
+temporary replacement NEG. Otherwise they are left as is until unlinked. Only
+applies to the transaction NEG syncer.`)
+	flag.StringVar(&F.NegSnapshotConfigMap, "neg-snapshot-configmap", "",
+		`Optional, "namespace/name" of a ConfigMap the NEG controller saves a hash of
+the endpoints of each NEG to on graceful shutdown. On startup, the first sync of
+a NEG whose target endpoints and size match the saved hash skips listing its
+endpoints. Only applies to the transaction NEG syncer.`)
+	flag.StringVar(&F.FirewallSuggestionNamespace, "firewall-suggestion-namespace", "",
+		`Optional, namespace of the FirewallSuggestion resources describing the firewall
+changes which the controller cannot make itself on Shared VPC clusters. The
+FirewallSuggestion CRD is installed when set. The suggested changes are always
+attached to the XPN events of the Ingresses.`)
+	flag.BoolVar(&F.EnableAlertPolicies, "enable-alert-policies", false,
+		`Optional, whether or not to manage the Cloud Monitoring alert policies on the
+5xx rate and latency of backend services, as configured in BackendConfigs. The
+controller must be granted roles/monitoring.alertPolicyEditor.`)
+	flag.BoolVar(&F.EnableBackendServicesStatus, "enable-backend-services-status", false,
+		`Optional, whether or not to list the self-links of the backend services of the
+ports of Services and of their health checks in the
+cloud.google.com/backend-services annotation of the Services.`)
+	flag.BoolVar(&F.EnableRetainedLoadBalancers, "enable-retained-load-balancers", false,
+		`Optional, whether or not to retain the cloud resources of the Ingresses annotated
+with networking.gke.io/retain-resources when they are deleted, recording them in
+RetainedLoadBalancers. The RetainedLoadBalancer CRD is installed when set.`)
+	flag.StringSliceVar(&F.FirewallTargetTags, "firewall-target-tags", []string{},
+		`Optional, network tags the L7 firewall rule applies to, e.g. the tags of the
+node pools serving Ingress traffic. By default, the rule applies to the network
+tags of the instances of all the ready nodes.`)
+	flag.StringSliceVar(&F.FirewallTargetSAs, "firewall-target-service-accounts", []string{},
+		`Optional, service accounts of the instances the L7 firewall rule applies to,
+instead of network tags. Cannot be used with --firewall-target-tags.`)
+	flag.DurationVar(&F.SSLCertExpiryWarningPeriod, "ssl-cert-expiry-warning-period", 30*24*time.Hour,
+		`Optional, raise a warning event on an Ingress on each sync when one of the
+certificates of its target https proxy expires within this period. Set to 0 to
+disable the events. The expiry times are always published as metrics.`)
+	flag.StringVar(&F.FirewallPolicy, "firewall-policy", "",
+		`Optional, name of a network firewall policy of the network project in
+which the L7 firewall rule is managed, instead of a VPC firewall rule. The
+policy must be associated with the network. As firewall policies do not
+support network tags, the rule applies to all the instances of the network
+unless --firewall-target-service-accounts is set.`)
+	flag.StringVar(&F.FirewallPolicyRegion, "firewall-policy-region", "",
+		`Optional, region of the regional network firewall policy set with
+--firewall-policy. The policy is global if not set.`)
+	flag.Int64Var(&F.FirewallPolicyRulePriority, "firewall-policy-rule-priority", 1000,
+		`Optional, priority of the L7 firewall rule in the policy set with
+--firewall-policy. The priority must not be used by another rule.`)
+	flag.BoolVar(&F.NodeIncludeUnschedulable, "node-filter-include-unschedulable", false,
+		`Optional, keep cordoned (unschedulable) nodes in the instance groups, so
+that they keep serving traffic while they are drained.`)
+	flag.BoolVar(&F.NodeIncludeNotReady, "node-filter-include-not-ready", false,
+		`Optional, keep nodes whose Ready condition is not true in the instance
+groups, leaving it to the health checks to stop sending traffic to them.`)
+	flag.StringSliceVar(&F.NodeExcludeTaints, "node-filter-exclude-taints", []string{},
+		`Optional, keys of node taints which exclude the nodes from the instance
+groups, in addition to the taint of nodes deleted by the cluster autoscaler.`)
+	flag.BoolVar(&F.EnableMTUChecks, "enable-mtu-checks", false,
+		`Optional, check the MTU of the nodes, e.g. with Tier_1 networking or gVNIC
+and jumbo frames, against the MTU of the network and of the load balancer data
+path, and raise a warning event on the services of Ingresses when packets may
+be black holed.`)
+	flag.StringVar(&F.NodeMTULabel, "node-mtu-label", "",
+		`Optional, key of the node label holding the MTU of the network interface of
+the node, for --enable-mtu-checks. Nodes without the label are assumed to use
+the MTU of the network.`)
+	flag.BoolVar(&F.EnableNEGMigration, "enable-neg-migration", false,
+		`Optional, when NEGs get enabled on the service of an Ingress backend, keep
+the load balancer on the instance groups until the NEGs have healthy endpoints
+instead of switching at once.`)
+	flag.DurationVar(&F.NEGMigrationTimeout, "neg-migration-timeout", 10*time.Minute,
+		`Optional, time after which the load balancer switches from instance groups
+to NEGs with --enable-neg-migration, even if the NEGs have no healthy endpoint.`)
+	flag.BoolVar(&F.EnableProxyKeepAlive, "enable-proxy-keepalive", false,
+		`Optional, set the client HTTP keepalive timeout of the target proxies of
+Ingresses from the httpKeepAliveTimeoutSec of their FrontendConfig.`)
+	flag.BoolVar(&F.EnableMutualTLS, "enable-mutual-tls", false,
+		`Optional, attach a ServerTlsPolicy validating the client certificates to
+the target https proxies of Ingresses from the mutualTLS of their
+FrontendConfig.`)
+	flag.BoolVar(&F.RunL4Controller, "run-l4-controller", false,
+		`Optional, provision the internal load balancers of LoadBalancer Services,
+and the external ones annotated with cloud.google.com/l4-rbs: enabled, with
+regional backend services pointing to GCE_VM_IP NEGs of node subsets instead
+of instance groups or target pools of all nodes. The service controller of the
+cloud provider must skip these Services.`)
+	flag.IntVar(&F.L4SubsetSizePerZone, "l4-subset-size-per-zone", 25,
+		`Optional, maximum number of nodes per zone backing each load balancer of
+--run-l4-controller.`)
+	flag.BoolVar(&F.EnableIngressClasses, "enable-ingress-classes", false,
+		`Optional, handle the Ingresses whose ingress class annotation names an
+IngressClass with controller k8s.io/ingress-gce, and apply the
+GCPIngressParams referenced by the parameters of the IngressClass. Ingresses
+without annotation belong to the default IngressClass, if any.`)
+	flag.BoolVar(&F.EnableGateways, "enable-gateways", false,
+		`Optional, provision load balancers for the Gateways of the
+gke-l7-global-external-managed and gke-l7-rilb GatewayClasses and their
+HTTPRoutes, through the same resources as for Ingresses.`)
+	flag.BoolVar(&F.ShardIngresses, "shard-ingresses", false,
+		`Optional, spread the namespaces over the replicas of the controller, which
+each sync the Ingresses of their namespaces. Replicas join the shard ring with a
+Lease named after --lock-object-name in --lock-object-namespace. The other
+controllers only run on the leader, so --leader-elect must be set.`)
+	flag.IntVar(&F.SyncErrorWarningThreshold, "sync-error-warning-threshold", 3,
+		`Optional, number of consecutive failed syncs of an Ingress after which its
+sync errors are recorded as Warning events rather than Normal events. Repeats of
+the same error are collapsed into one event with their count.`)
+	flag.DurationVar(&F.SyncStuckThreshold, "sync-stuck-threshold", 30*time.Minute,
+		`Optional, duration after which a sync of an Ingress which did not return
+fails /healthz, so that the stuck controller is restarted. 0 disables the check.`)
+	flag.IntVar(&F.WebhookPort, "webhook-port", 0,
+		`Optional, port of the validating admission webhook rejecting invalid NEG and
+BackendConfig annotations of Services, FrontendConfig annotations of Ingresses,
+and invalid BackendConfigs and FrontendConfigs. The webhook serves /validate
+over TLS with --webhook-cert-file and --webhook-key-file. 0 disables it.`)
+	flag.StringVar(&F.WebhookCertFile, "webhook-cert-file", "",
+		`Optional, path to the TLS certificate of the validating admission webhook.`)
+	flag.StringVar(&F.WebhookKeyFile, "webhook-key-file", "",
+		`Optional, path to the TLS key of the validating admission webhook.`)
+	flag.BoolVar(&F.StrictAnnotationValidation, "strict-annotation-validation", false,
+		`Optional, reject the NEG and BackendConfig annotations of Services with
+unknown fields, out of range ports or invalid names, which are otherwise accepted
+with an InvalidAnnotation warning event. It will be the default in the next
+release.`)
+	flag.StringSliceVar(&F.PropagatedLabels, "propagated-labels", []string{},
+		`Optional, keys of the labels of Ingresses and of their Services copied to the
+labels of their forwarding rules, for cost attribution and resource search, and
+recorded in the description of their URL maps and target proxies.`)
+	flag.BoolVar(&F.EnableV2FrontendNamer, "enable-v2-frontend-namer", false,
+		`Optional, name the frontend resources of new Ingresses with the v2 naming
+scheme, which embeds hashes so that long namespaces and names do not collide.
+Existing Ingresses keep their naming scheme, recorded in their
+networking.gke.io/naming-scheme annotation, and are only migrated to v2 while
+they have no IP, without traffic disruption.`)
+	flag.IntVar(&F.MaxIGSize, "max-ig-size", 1000,
+		`Optional, maximum number of instances in each instance group of a zone.
+The nodes of zones with more nodes are spread over several instance groups
+(shards), all of which are added to the backend services. Set to 0 for no
+limit.`)
 	flag.BoolVar(&F.EnableCSM, "enable-csm", false, "Enable CSM(Istio) support")
 	flag.StringSliceVar(&F.CSMServiceNEGSkipNamespaces, "csm-service-skip-namespaces", []string{}, "Only for CSM mode, skip the NEG creation for Services in the given namespaces.")
+	flag.BoolVar(&F.EnableStartupChecks, "enable-startup-checks", false,
+		`Optional, whether or not to verify API enablement, IAM permissions and
+VPC-native status on startup, which lists cloud resources and writes the results
+to a ConfigMap.`)
+	flag.BoolVar(&F.DisableInstanceGroups, "disable-instance-groups", false,
+		`Optional, whether or not to stop managing instance groups. Only use on clusters
+where every Ingress backend, including the default backend, uses NEGs. The
+controller then stops syncing nodes and deletes its instance groups once they
+are no longer used by any backend service.`)
+	flag.BoolVar(&F.PreserveManagedStaticIPs, "preserve-managed-static-ips", false,
+		`Optional, whether or not to keep the static IPs reserved for Ingresses with the
+networking.gke.io/managed-static-ip annotation when the Ingresses are deleted.
+A recreated Ingress with the same name gets the same IP.`)
+	flag.StringVar(&F.StartupCheckReport, "startup-check-report", "kube-system/ingress-gce-startup-checks",
+		`ConfigMap the startup check report is written to. Takes the form namespace/name.`)
+	flag.StringVar(&F.ReloadConfigMap, "reload-config-map", "",
+		`Optional, ConfigMap whose data sets flags of the running controller, keyed by
+flag name, e.g. max-ig-size or gce-ratelimit with its specs separated by ';'.
+Only the flags read on each use can be reloaded, the others are ignored. The
+flags removed from the ConfigMap get back their command line value. Takes the
+form namespace/name.`)
+	flag.BoolVar(&F.EnableQuotaChecks, "enable-quota-checks", false,
+		`Optional, check the NETWORK_ENDPOINT_GROUPS, BACKEND_SERVICES and
+HEALTH_CHECKS quotas of the project before creating the NEGs of a service or
+the backend services of an Ingress, and raise a warning event instead of
+failing midway when the resources which do not exist yet would exceed them.`)
+	flag.BoolVar(&F.EnableAsyncOperations, "enable-async-operations", false,
+		`Optional, start the operations adding and removing the nodes of the
+instance groups without waiting for them, and poll them every
+--gce-operation-poll-interval in a loop shared by all zones, which syncs a zone
+again once its operations are done. This frees the sync workers while many
+zonal operations are outstanding.`)
 }
 
 type RateLimitSpecs struct {
@@ -268,3 +664,86 @@ func (c *PortRanges) Values() []string {
 func (c *PortRanges) Type() string {
 	return "portRanges"
 }
+
+// IngressClassScopes maps ingress class names to a backend service scope.
+type IngressClassScopes struct {
+	scopes map[string]string
+}
+
+// String is the method to format the flag's value, part of the flag.Value interface.
+func (c *IngressClassScopes) String() string {
+	var pairs []string
+	for class, scope := range c.scopes {
+		pairs = append(pairs, class+"="+scope)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set supports a value of CSV or the flag repeated multiple times.
+func (c *IngressClassScopes) Set(value string) error {
+	if c.scopes == nil {
+		c.scopes = map[string]string{}
+	}
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("invalid ingress class scope %q, expected class=scope", pair)
+		}
+		if kv[1] != ScopeGlobal && kv[1] != ScopeRegional {
+			return fmt.Errorf("invalid scope %q for ingress class %q, expected %q or %q", kv[1], kv[0], ScopeGlobal, ScopeRegional)
+		}
+		c.scopes[kv[0]] = kv[1]
+	}
+	return nil
+}
+
+// Scope returns the scope configured for the given ingress class, if any.
+func (c *IngressClassScopes) Scope(class string) (string, bool) {
+	scope, ok := c.scopes[class]
+	return scope, ok
+}
+
+func (c *IngressClassScopes) Type() string {
+	return "ingressClassScopes"
+}
+
+// ZoneSubnetworks maps zones to the URL of a subnetwork.
+type ZoneSubnetworks struct {
+	subnetworks map[string]string
+}
+
+// String is the method to format the flag's value, part of the flag.Value interface.
+func (c *ZoneSubnetworks) String() string {
+	var pairs []string
+	for zone, subnetwork := range c.subnetworks {
+		pairs = append(pairs, zone+"="+subnetwork)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set supports a value of CSV or the flag repeated multiple times.
+func (c *ZoneSubnetworks) Set(value string) error {
+	if c.subnetworks == nil {
+		c.subnetworks = map[string]string{}
+	}
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return fmt.Errorf("invalid zone subnetwork %q, expected zone=subnetwork", pair)
+		}
+		c.subnetworks[kv[0]] = kv[1]
+	}
+	return nil
+}
+
+// Subnetwork returns the subnetwork configured for the given zone, if any.
+func (c *ZoneSubnetworks) Subnetwork(zone string) (string, bool) {
+	subnetwork, ok := c.subnetworks[zone]
+	return subnetwork, ok
+}
+
+func (c *ZoneSubnetworks) Type() string {
+	return "zoneSubnetworks"
+}
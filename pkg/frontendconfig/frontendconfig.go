@@ -18,6 +18,7 @@ package frontendconfig
 
 import (
 	"errors"
+	"fmt"
 
 	"k8s.io/api/networking/v1beta1"
 	"k8s.io/ingress-gce/pkg/annotations"
@@ -25,8 +26,15 @@ import (
 	frontendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1"
 	"k8s.io/ingress-gce/pkg/common/operator"
 	"k8s.io/ingress-gce/pkg/crd"
+	"k8s.io/ingress-gce/pkg/utils"
 )
 
+// DefaultFrontendConfigName is the name of the FrontendConfig applied to the
+// Ingresses of its namespace, when default configs are enabled. The
+// FrontendConfig with this name in the cluster default config namespace
+// applies to all namespaces.
+const DefaultFrontendConfigName = "default"
+
 var (
 	ErrFrontendConfigDoesNotExist = errors.New("no FrontendConfig for Ingress exists.")
 )
@@ -62,3 +70,84 @@ func FrontendConfigForIngress(feConfigs []*frontendconfigv1beta1.FrontendConfig,
 	// would mean we have a bug somewhere in the operator or annotation processing.
 	return matches[0], nil
 }
+
+// WithDefaults returns a copy of feConfig whose unset spec fields are set
+// from the default FrontendConfig of the namespace, and then from the default
+// FrontendConfig of the cluster. feConfig may be nil, in which case the
+// merged defaults are returned, or nil if there are none.
+func WithDefaults(feConfigs []*frontendconfigv1beta1.FrontendConfig, feConfig *frontendconfigv1beta1.FrontendConfig, namespace, clusterNamespace string) (*frontendconfigv1beta1.FrontendConfig, error) {
+	namespaces := []string{namespace}
+	if clusterNamespace != "" && clusterNamespace != namespace {
+		namespaces = append(namespaces, clusterNamespace)
+	}
+	merged := feConfig.DeepCopy()
+	for _, ns := range namespaces {
+		defaultConfig := findFrontendConfig(feConfigs, ns, DefaultFrontendConfigName)
+		if defaultConfig == nil {
+			continue
+		}
+		if merged == nil {
+			merged = defaultConfig.DeepCopy()
+			continue
+		}
+		if err := utils.MergeUnsetFields(&merged.Spec, &defaultConfig.DeepCopy().Spec); err != nil {
+			return nil, err
+		}
+	}
+	return merged, nil
+}
+
+func findFrontendConfig(feConfigs []*frontendconfigv1beta1.FrontendConfig, namespace, name string) *frontendconfigv1beta1.FrontendConfig {
+	for _, feConfig := range feConfigs {
+		if feConfig.Namespace == namespace && feConfig.Name == name {
+			return feConfig
+		}
+	}
+	return nil
+}
+
+// Validate returns an error if the FrontendConfig has an invalid spec.
+func Validate(feConfig *frontendconfigv1beta1.FrontendConfig) error {
+	switch feConfig.Spec.QuicOverride {
+	case "", frontendconfigv1beta1.QuicOverrideNone, frontendconfigv1beta1.QuicOverrideEnable, frontendconfigv1beta1.QuicOverrideDisable:
+	default:
+		return fmt.Errorf("FrontendConfig %s/%s has invalid quicOverride %q, must be one of %s, %s or %s", feConfig.Namespace, feConfig.Name, feConfig.Spec.QuicOverride,
+			frontendconfigv1beta1.QuicOverrideNone, frontendconfigv1beta1.QuicOverrideEnable, frontendconfigv1beta1.QuicOverrideDisable)
+	}
+	if timeout := feConfig.Spec.HttpKeepAliveTimeoutSec; timeout != 0 && (timeout < frontendconfigv1beta1.MinHttpKeepAliveTimeoutSec || timeout > frontendconfigv1beta1.MaxHttpKeepAliveTimeoutSec) {
+		return fmt.Errorf("FrontendConfig %s/%s has invalid httpKeepAliveTimeoutSec %d, must be between %d and %d", feConfig.Namespace, feConfig.Name, timeout,
+			frontendconfigv1beta1.MinHttpKeepAliveTimeoutSec, frontendconfigv1beta1.MaxHttpKeepAliveTimeoutSec)
+	}
+	switch feConfig.Spec.NetworkTier {
+	case "", frontendconfigv1beta1.NetworkTierPremium, frontendconfigv1beta1.NetworkTierStandard:
+	default:
+		return fmt.Errorf("FrontendConfig %s/%s has invalid networkTier %q, must be %s or %s", feConfig.Namespace, feConfig.Name, feConfig.Spec.NetworkTier,
+			frontendconfigv1beta1.NetworkTierPremium, frontendconfigv1beta1.NetworkTierStandard)
+	}
+	ports := map[int64]bool{}
+	for _, port := range feConfig.Spec.HttpsPorts {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("FrontendConfig %s/%s has invalid httpsPorts %v, port %d must be between 1 and 65535", feConfig.Namespace, feConfig.Name, feConfig.Spec.HttpsPorts, port)
+		}
+		if ports[port] {
+			return fmt.Errorf("FrontendConfig %s/%s has invalid httpsPorts %v, port %d is listed twice", feConfig.Namespace, feConfig.Name, feConfig.Spec.HttpsPorts, port)
+		}
+		ports[port] = true
+	}
+	if mtls := feConfig.Spec.MutualTLS; mtls != nil {
+		if mtls.ServerTlsPolicy != "" && mtls.TrustConfig != "" {
+			return fmt.Errorf("FrontendConfig %s/%s has invalid mutualTLS, serverTlsPolicy and trustConfig are mutually exclusive", feConfig.Namespace, feConfig.Name)
+		}
+		switch mtls.ClientValidationMode {
+		case "":
+		case frontendconfigv1beta1.ClientValidationModeRejectInvalid, frontendconfigv1beta1.ClientValidationModeAllowInvalid:
+			if mtls.TrustConfig == "" {
+				return fmt.Errorf("FrontendConfig %s/%s has invalid mutualTLS, clientValidationMode requires trustConfig", feConfig.Namespace, feConfig.Name)
+			}
+		default:
+			return fmt.Errorf("FrontendConfig %s/%s has invalid mutualTLS clientValidationMode %q, must be %s or %s", feConfig.Namespace, feConfig.Name, mtls.ClientValidationMode,
+				frontendconfigv1beta1.ClientValidationModeRejectInvalid, frontendconfigv1beta1.ClientValidationModeAllowInvalid)
+		}
+	}
+	return nil
+}
@@ -1,9 +1,11 @@
 package frontendconfig
 
 import (
+	"reflect"
 	"testing"
 
 	"k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	frontendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1"
 	"k8s.io/ingress-gce/pkg/test"
 )
@@ -49,3 +51,99 @@ func TestFrontendConfigForIngress(t *testing.T) {
 		})
 	}
 }
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		desc             string
+		quicOverride     string
+		keepAliveTimeout int64
+		networkTier      string
+		httpsPorts       []int64
+		mutualTLS        *frontendconfigv1beta1.MutualTLSConfig
+		wantErr          bool
+	}{
+		{desc: "unset", quicOverride: ""},
+		{desc: "none", quicOverride: frontendconfigv1beta1.QuicOverrideNone},
+		{desc: "enable", quicOverride: frontendconfigv1beta1.QuicOverrideEnable},
+		{desc: "disable", quicOverride: frontendconfigv1beta1.QuicOverrideDisable},
+		{desc: "invalid", quicOverride: "enabled", wantErr: true},
+		{desc: "keepalive timeout", keepAliveTimeout: 620},
+		{desc: "keepalive timeout too low", keepAliveTimeout: 1, wantErr: true},
+		{desc: "keepalive timeout too high", keepAliveTimeout: 3600, wantErr: true},
+		{desc: "premium tier", networkTier: frontendconfigv1beta1.NetworkTierPremium},
+		{desc: "standard tier", networkTier: frontendconfigv1beta1.NetworkTierStandard},
+		{desc: "invalid tier", networkTier: "standard", wantErr: true},
+		{desc: "https ports", httpsPorts: []int64{443, 8443}},
+		{desc: "invalid https port", httpsPorts: []int64{443, 70000}, wantErr: true},
+		{desc: "duplicate https port", httpsPorts: []int64{8443, 8443}, wantErr: true},
+		{desc: "detached mutual TLS", mutualTLS: &frontendconfigv1beta1.MutualTLSConfig{}},
+		{desc: "server TLS policy", mutualTLS: &frontendconfigv1beta1.MutualTLSConfig{ServerTlsPolicy: "policy"}},
+		{desc: "trust config", mutualTLS: &frontendconfigv1beta1.MutualTLSConfig{TrustConfig: "trust", ClientValidationMode: frontendconfigv1beta1.ClientValidationModeAllowInvalid}},
+		{desc: "server TLS policy and trust config", mutualTLS: &frontendconfigv1beta1.MutualTLSConfig{ServerTlsPolicy: "policy", TrustConfig: "trust"}, wantErr: true},
+		{desc: "validation mode without trust config", mutualTLS: &frontendconfigv1beta1.MutualTLSConfig{ClientValidationMode: frontendconfigv1beta1.ClientValidationModeRejectInvalid}, wantErr: true},
+		{desc: "invalid validation mode", mutualTLS: &frontendconfigv1beta1.MutualTLSConfig{TrustConfig: "trust", ClientValidationMode: "ALLOW"}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			feConfig := test.FrontendConfig.DeepCopy()
+			feConfig.Spec.QuicOverride = tc.quicOverride
+			feConfig.Spec.HttpKeepAliveTimeoutSec = tc.keepAliveTimeout
+			feConfig.Spec.NetworkTier = tc.networkTier
+			feConfig.Spec.HttpsPorts = tc.httpsPorts
+			feConfig.Spec.MutualTLS = tc.mutualTLS
+			if err := Validate(feConfig); (err != nil) != tc.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithDefaults(t *testing.T) {
+	newConfig := func(namespace, name, quicOverride string) *frontendconfigv1beta1.FrontendConfig {
+		return &frontendconfigv1beta1.FrontendConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec:       frontendconfigv1beta1.FrontendConfigSpec{QuicOverride: quicOverride},
+		}
+	}
+	feConfigs := []*frontendconfigv1beta1.FrontendConfig{
+		newConfig("kube-system", DefaultFrontendConfigName, frontendconfigv1beta1.QuicOverrideDisable),
+		newConfig("ns1", "other", frontendconfigv1beta1.QuicOverrideEnable),
+	}
+
+	testCases := []struct {
+		desc      string
+		feConfig  *frontendconfigv1beta1.FrontendConfig
+		namespace string
+		want      *frontendconfigv1beta1.FrontendConfig
+	}{
+		{
+			desc:      "cluster default",
+			namespace: "ns1",
+			want:      newConfig("kube-system", DefaultFrontendConfigName, frontendconfigv1beta1.QuicOverrideDisable),
+		},
+		{
+			desc:      "referenced config takes precedence",
+			feConfig:  newConfig("ns1", "config", frontendconfigv1beta1.QuicOverrideEnable),
+			namespace: "ns1",
+			want:      newConfig("ns1", "config", frontendconfigv1beta1.QuicOverrideEnable),
+		},
+		{
+			desc:      "unset field of referenced config",
+			feConfig:  newConfig("ns1", "config", ""),
+			namespace: "ns1",
+			want:      newConfig("ns1", "config", frontendconfigv1beta1.QuicOverrideDisable),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := WithDefaults(feConfigs, tc.feConfig, tc.namespace, "kube-system")
+			if err != nil {
+				t.Fatalf("WithDefaults() = %v, want nil", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("WithDefaults() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -35,7 +35,7 @@ type DefaultValidatorEnv struct {
 	k8s   *kubernetes.Clientset
 	bc    *bcclient.Clientset
 	gce   cloud.Cloud
-	namer *namer.Namer
+	namer namer.IngressNamer
 }
 
 // NewDefaultValidatorEnv returns a new ValidatorEnv.
@@ -86,6 +86,6 @@ func (e *DefaultValidatorEnv) Cloud() cloud.Cloud {
 }
 
 // DefaultValidatorEnv implements ValidatorEnv.
-func (e *DefaultValidatorEnv) Namer() *namer.Namer {
+func (e *DefaultValidatorEnv) Namer() namer.IngressNamer {
 	return e.namer
 }
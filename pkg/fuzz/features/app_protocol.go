@@ -97,7 +97,7 @@ func (v *appProtocolValidator) CheckResponse(host, path string, resp *http.Respo
 		if !(strings.HasPrefix(r.HTTPVersion, "1.") && r.TLS) {
 			return fuzz.CheckResponseContinue, fmt.Errorf("expected HTTP/1.x response with TLS configured on request: %+v", r)
 		}
-	case annotations.ProtocolHTTP2:
+	case annotations.ProtocolHTTP2, annotations.ProtocolGRPC:
 		if !strings.HasPrefix(r.HTTPVersion, "2.") {
 			return fuzz.CheckResponseContinue, fmt.Errorf("expected HTTP/2.x response: %+v", resp)
 		}
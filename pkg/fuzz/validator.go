@@ -42,7 +42,7 @@ type ValidatorEnv interface {
 	BackendConfigs() (map[string]*backendconfig.BackendConfig, error)
 	Services() (map[string]*v1.Service, error)
 	Cloud() cloud.Cloud
-	Namer() *namer.Namer
+	Namer() namer.IngressNamer
 }
 
 // MockValidatorEnv is an environment that is used for mock testing.
@@ -50,7 +50,7 @@ type MockValidatorEnv struct {
 	BackendConfigsMap map[string]*backendconfig.BackendConfig
 	ServicesMap       map[string]*v1.Service
 	MockCloud         *cloud.MockGCE
-	IngressNamer      *namer.Namer
+	IngressNamer      namer.IngressNamer
 }
 
 // BackendConfigs implements ValidatorEnv.
@@ -69,7 +69,7 @@ func (e *MockValidatorEnv) Cloud() cloud.Cloud {
 }
 
 // Cloud implements ValidatorEnv.
-func (e *MockValidatorEnv) Namer() *namer.Namer {
+func (e *MockValidatorEnv) Namer() namer.IngressNamer {
 	return e.IngressNamer
 }
 
@@ -0,0 +1,263 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/ingress-gce/pkg/gatewaymigration"
+	"k8s.io/klog"
+)
+
+var (
+	// GatewayGVR is the resource of the Gateways.
+	GatewayGVR = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1beta1", Resource: "gateways"}
+	// HTTPRouteGVR is the resource of the HTTPRoutes.
+	HTTPRouteGVR = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1beta1", Resource: "httproutes"}
+)
+
+// Ingresses provides the Ingresses translated from the Gateways of the
+// supported GatewayClasses and their HTTPRoutes. Ingresses are translated
+// from the informer caches when they are read, so they are complete as soon
+// as the informers have synced.
+type Ingresses struct {
+	gatewayInformer cache.SharedIndexInformer
+	routeInformer   cache.SharedIndexInformer
+	client          dynamic.Interface
+	recorder        func(namespace string) record.EventRecorder
+
+	lock sync.Mutex
+	// last holds the last Ingress passed to the event handlers for the key
+	// of each Gateway.
+	last     map[string]*v1beta1.Ingress
+	handlers []cache.ResourceEventHandler
+}
+
+// NewIngresses returns the Ingresses of the Gateways of the given namespace.
+func NewIngresses(client dynamic.Interface, namespace string, resyncPeriod time.Duration, recorder func(namespace string) record.EventRecorder) *Ingresses {
+	i := &Ingresses{
+		gatewayInformer: dynamicinformer.NewFilteredDynamicInformer(client, GatewayGVR, namespace, resyncPeriod, cache.Indexers{}, nil).Informer(),
+		routeInformer:   dynamicinformer.NewFilteredDynamicInformer(client, HTTPRouteGVR, namespace, resyncPeriod, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, nil).Informer(),
+		client:          client,
+		recorder:        recorder,
+		last:            map[string]*v1beta1.Ingress{},
+	}
+	i.gatewayInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    i.gatewayChanged,
+		UpdateFunc: func(old, cur interface{}) { i.gatewayChanged(cur) },
+		DeleteFunc: i.gatewayChanged,
+	})
+	i.routeInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: i.routeChanged,
+		UpdateFunc: func(old, cur interface{}) {
+			i.routeChanged(old)
+			i.routeChanged(cur)
+		},
+		DeleteFunc: i.routeChanged,
+	})
+	return i
+}
+
+// Run starts the informers of the Gateways and HTTPRoutes.
+func (i *Ingresses) Run(stopCh <-chan struct{}) {
+	go i.gatewayInformer.Run(stopCh)
+	go i.routeInformer.Run(stopCh)
+}
+
+// HasSynced returns true if the informers of the Gateways and HTTPRoutes
+// have synced.
+func (i *Ingresses) HasSynced() bool {
+	return i.gatewayInformer.HasSynced() && i.routeInformer.HasSynced()
+}
+
+// AddEventHandler adds a handler of the changes of the Ingresses.
+func (i *Ingresses) AddEventHandler(handler cache.ResourceEventHandler) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.handlers = append(i.handlers, handler)
+}
+
+// List returns the Ingresses of all Gateways of the supported classes. The
+// Ingresses last passed to the event handlers are returned, so that the
+// Gateways are only translated again when they or their HTTPRoutes change.
+func (i *Ingresses) List() []interface{} {
+	var ret []interface{}
+	for _, key := range i.gatewayInformer.GetStore().ListKeys() {
+		i.lock.Lock()
+		ing, ok := i.last[key]
+		i.lock.Unlock()
+		if !ok {
+			// The event handlers have not run for the Gateway yet.
+			ing, _, ok = i.translate(key)
+		}
+		if ok {
+			ret = append(ret, ing)
+		}
+	}
+	return ret
+}
+
+// GetByKey returns the Ingress of the Gateway with the given key.
+func (i *Ingresses) GetByKey(key string) (interface{}, bool, error) {
+	ing, _, ok := i.translate(key)
+	if !ok {
+		return nil, false, nil
+	}
+	return ing, true, nil
+}
+
+// Owns returns true if the Ingress was translated from a Gateway.
+func (i *Ingresses) Owns(ing *v1beta1.Ingress) bool {
+	return IsGatewayIngress(ing)
+}
+
+// UpdateStatus sets the address of the Gateway of an Ingress to the IP of its
+// load balancer.
+func (i *Ingresses) UpdateStatus(ing *v1beta1.Ingress, ip string) error {
+	if ip == "" {
+		return nil
+	}
+	key := ing.Namespace + "/" + ing.Name
+	obj, exists, err := i.gatewayInformer.GetStore().GetByKey(key)
+	if err != nil || !exists {
+		return err
+	}
+	gw := obj.(*unstructured.Unstructured).DeepCopy()
+	addresses := []interface{}{map[string]interface{}{"type": "IPAddress", "value": ip}}
+	if current, _, _ := unstructured.NestedSlice(gw.Object, "status", "addresses"); reflect.DeepEqual(current, addresses) {
+		return nil
+	}
+	if err := unstructured.SetNestedSlice(gw.Object, addresses, "status", "addresses"); err != nil {
+		return err
+	}
+	klog.Infof("Updating Gateway %s with IP %s", key, ip)
+	if _, err := i.client.Resource(GatewayGVR).Namespace(gw.GetNamespace()).UpdateStatus(gw, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+	i.recorder(gw.GetNamespace()).Eventf(gw, apiv1.EventTypeNormal, "CREATE", "ip: %v", ip)
+	return nil
+}
+
+// translate returns the Ingress of the Gateway with the given key and the
+// features of the Gateway which were skipped. Returns false if the Gateway
+// does not exist or its class is not supported.
+func (i *Ingresses) translate(key string) (*v1beta1.Ingress, []error, bool) {
+	obj, exists, err := i.gatewayInformer.GetStore().GetByKey(key)
+	if err != nil || !exists {
+		return nil, nil, false
+	}
+	gw := &gatewaymigration.Gateway{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.(*unstructured.Unstructured).Object, gw); err != nil {
+		klog.Errorf("Failed to convert Gateway %s: %v", key, err)
+		return nil, nil, false
+	}
+	if _, ok := classes[gw.Spec.GatewayClassName]; !ok {
+		return nil, nil, false
+	}
+	objs, err := i.routeInformer.GetIndexer().ByIndex(cache.NamespaceIndex, gw.Namespace)
+	if err != nil {
+		klog.Errorf("Failed to list HTTPRoutes of namespace %s: %v", gw.Namespace, err)
+		return nil, nil, false
+	}
+	var routes []*gatewaymigration.HTTPRoute
+	for _, obj := range objs {
+		route := &gatewaymigration.HTTPRoute{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.(*unstructured.Unstructured).Object, route); err != nil {
+			klog.Errorf("Failed to convert HTTPRoute %s/%s: %v", obj.(*unstructured.Unstructured).GetNamespace(), obj.(*unstructured.Unstructured).GetName(), err)
+			continue
+		}
+		routes = append(routes, route)
+	}
+	ing, errs := ToIngress(gw, routes)
+	return ing, errs, true
+}
+
+func (i *Ingresses) gatewayChanged(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		klog.Errorf("Failed to get key of Gateway: %v", err)
+		return
+	}
+	i.sync(key)
+}
+
+// routeChanged syncs the Gateways the HTTPRoute is attached to.
+func (i *Ingresses) routeChanged(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	route := &gatewaymigration.HTTPRoute{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, route); err != nil {
+		klog.Errorf("Failed to convert HTTPRoute %s/%s: %v", u.GetNamespace(), u.GetName(), err)
+		return
+	}
+	for _, ref := range route.Spec.ParentRefs {
+		if ref.Namespace == "" || ref.Namespace == route.Namespace {
+			i.sync(route.Namespace + "/" + ref.Name)
+		}
+	}
+}
+
+// sync passes the change of the Ingress of the Gateway with the given key to
+// the event handlers, and records the features of the Gateway which were
+// skipped when the Ingress changes.
+func (i *Ingresses) sync(key string) {
+	ing, errs, exists := i.translate(key)
+
+	i.lock.Lock()
+	last, existed := i.last[key]
+	if exists {
+		i.last[key] = ing
+	} else {
+		delete(i.last, key)
+	}
+	handlers := i.handlers
+	i.lock.Unlock()
+
+	for _, h := range handlers {
+		switch {
+		case exists && existed:
+			h.OnUpdate(last, ing)
+		case exists:
+			h.OnAdd(ing)
+		case existed:
+			h.OnDelete(last)
+		}
+	}
+	if !exists || (existed && reflect.DeepEqual(last, ing)) {
+		return
+	}
+	for _, err := range errs {
+		i.recorder(ing.Namespace).Eventf(ing, apiv1.EventTypeWarning, "Translate", err.Error())
+	}
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"testing"
+
+	"k8s.io/api/networking/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/gatewaymigration"
+)
+
+func TestIngressesList(t *testing.T) {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(newGateway(gatewaymigration.ExternalGatewayClass, httpListener))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := &Ingresses{
+		gatewayInformer: cache.NewSharedIndexInformer(&cache.ListWatch{}, &unstructured.Unstructured{}, 0, cache.Indexers{}),
+		routeInformer:   cache.NewSharedIndexInformer(&cache.ListWatch{}, &unstructured.Unstructured{}, 0, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}),
+		last:            map[string]*v1beta1.Ingress{},
+	}
+	i.gatewayInformer.GetStore().Add(&unstructured.Unstructured{Object: obj})
+
+	// The Gateway is translated until the event handlers have run for it.
+	got := i.List()
+	if len(got) != 1 || got[0].(*v1beta1.Ingress).Name != "gw" {
+		t.Fatalf("List() = %v, want the Ingress of Gateway gw", got)
+	}
+
+	// Then the Ingress last passed to the event handlers is returned.
+	last := &v1beta1.Ingress{}
+	i.last[testNamespace+"/gw"] = last
+	if got := i.List(); len(got) != 1 || got[0] != last {
+		t.Errorf("List() = %v, want the last Ingress of Gateway gw", got)
+	}
+}
@@ -0,0 +1,471 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/ingress-gce/pkg/annotations"
+	"k8s.io/ingress-gce/pkg/gatewaymigration"
+)
+
+const (
+	pathMatchExact              = "Exact"
+	pathMatchPrefix             = "PathPrefix"
+	valueMatchExact             = "Exact"
+	valueMatchRegularExpression = "RegularExpression"
+)
+
+// classes maps the GatewayClasses of the Gateways handled by the controller
+// to the ingress class of their load balancers. They are the classes the
+// migration tool generates for Ingresses.
+var classes = map[string]string{
+	gatewaymigration.ExternalGatewayClass: annotations.GceIngressClass,
+	gatewaymigration.InternalGatewayClass: annotations.GceL7ILBIngressClass,
+}
+
+// redirectResponseCodes maps the status codes of the RequestRedirect filter
+// to the redirect response codes of the route actions annotation.
+var redirectResponseCodes = map[int]string{
+	0:   "",
+	301: "MOVED_PERMANENTLY_DEFAULT",
+	302: "FOUND",
+}
+
+// IsGatewayIngress returns true if the Ingress was translated from a Gateway.
+func IsGatewayIngress(ing *v1beta1.Ingress) bool {
+	return ing.APIVersion == gatewaymigration.GatewayAPIVersion && ing.Kind == "Gateway"
+}
+
+// Attached returns true if the HTTPRoute is attached to the Gateway. Only
+// HTTPRoutes of the namespace of the Gateway can be attached to it.
+func Attached(gw *gatewaymigration.Gateway, route *gatewaymigration.HTTPRoute) bool {
+	if route.Namespace != gw.Namespace {
+		return false
+	}
+	for _, ref := range route.Spec.ParentRefs {
+		if ref.Name == gw.Name && (ref.Namespace == "" || ref.Namespace == gw.Namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// ToIngress translates a Gateway and its HTTPRoutes into an Ingress with the
+// namespace, name and UID of the Gateway, which is synced like the Ingresses
+// of the cluster. The Ingress has the type of the Gateway, so the events
+// recorded for it refer to the Gateway. HTTPRoutes which are not attached to
+// the Gateway are ignored. Listeners and rules of HTTPRoutes without an
+// Ingress equivalent are skipped and returned as errors.
+func ToIngress(gw *gatewaymigration.Gateway, routes []*gatewaymigration.HTTPRoute) (*v1beta1.Ingress, []error) {
+	class, ok := classes[gw.Spec.GatewayClassName]
+	if !ok {
+		return nil, []error{fmt.Errorf("GatewayClass %q is not supported", gw.Spec.GatewayClassName)}
+	}
+	t := &translation{
+		ing: &v1beta1.Ingress{
+			TypeMeta: metav1.TypeMeta{APIVersion: gatewaymigration.GatewayAPIVersion, Kind: "Gateway"},
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   gw.Namespace,
+				Name:        gw.Name,
+				UID:         gw.UID,
+				Annotations: map[string]string{annotations.IngressClassKey: class},
+			},
+		},
+		paths:   map[string][]v1beta1.HTTPIngressPath{},
+		actions: map[hostPath]*annotations.RouteAction{},
+	}
+	t.listeners(gw)
+
+	var attached []*gatewaymigration.HTTPRoute
+	for _, route := range routes {
+		if Attached(gw, route) {
+			attached = append(attached, route)
+		}
+	}
+	// Conflicting rules are resolved in favor of the oldest HTTPRoute.
+	sort.Slice(attached, func(i, j int) bool {
+		ti, tj := attached[i].CreationTimestamp, attached[j].CreationTimestamp
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+		return attached[i].Name < attached[j].Name
+	})
+	for _, route := range attached {
+		for i, rule := range route.Spec.Rules {
+			if err := t.rule(route, rule); err != nil {
+				t.errs = append(t.errs, fmt.Errorf("rule %d of HTTPRoute %s/%s was skipped: %v", i, route.Namespace, route.Name, err))
+			}
+		}
+	}
+	if err := t.finish(); err != nil {
+		t.errs = append(t.errs, err)
+	}
+	return t.ing, t.errs
+}
+
+type hostPath struct {
+	host string
+	path string
+}
+
+// translation holds the state of a single ToIngress call.
+type translation struct {
+	ing *v1beta1.Ingress
+	// hosts are the hosts of the Ingress rules, in the order of the
+	// HTTPRoutes which use them.
+	hosts   []string
+	paths   map[string][]v1beta1.HTTPIngressPath
+	actions map[hostPath]*annotations.RouteAction
+	errs    []error
+}
+
+func (t *translation) listeners(gw *gatewaymigration.Gateway) {
+	allowHTTP := false
+	for _, l := range gw.Spec.Listeners {
+		switch {
+		case l.Protocol == "HTTP" && l.Port == 80:
+			allowHTTP = true
+		case l.Protocol == "HTTPS" && l.Port == 443 && l.TLS != nil && (l.TLS.Mode == "" || l.TLS.Mode == "Terminate"):
+			for _, ref := range l.TLS.CertificateRefs {
+				t.ing.Spec.TLS = append(t.ing.Spec.TLS, v1beta1.IngressTLS{SecretName: ref.Name})
+			}
+			if certs := l.TLS.Options[gatewaymigration.PreSharedCertsOption]; certs != "" {
+				t.ing.Annotations[annotations.PreSharedCertKey] = certs
+			}
+		default:
+			t.errs = append(t.errs, fmt.Errorf("listener %q was skipped: only HTTP on port 80 and HTTPS on port 443 terminating TLS are supported", l.Name))
+		}
+	}
+	if !allowHTTP {
+		t.ing.Annotations[annotations.AllowHTTPKey] = "false"
+	}
+	for _, addr := range gw.Spec.Addresses {
+		if addr.Type != "NamedAddress" || t.ing.Annotations[annotations.IngressClassKey] != annotations.GceIngressClass {
+			t.errs = append(t.errs, fmt.Errorf("address %q was skipped: only named addresses of external Gateways are supported", addr.Value))
+			continue
+		}
+		t.ing.Annotations[annotations.StaticIPNameKey] = addr.Value
+	}
+}
+
+// match is a path match of a rule, with the header and query parameter
+// conditions of the conditional route it is translated to, if any.
+type match struct {
+	path        string
+	exact       bool
+	headers     []annotations.HeaderMatch
+	queryParams []annotations.QueryParamMatch
+}
+
+func (m *match) conditional() bool {
+	return len(m.headers) > 0 || len(m.queryParams) > 0
+}
+
+// rule adds the paths and route actions of a rule of an HTTPRoute. Either
+// the whole rule is translated, or an error is returned and nothing is added.
+// Only the paths already routed by an older HTTPRoute or rule are skipped,
+// each with its own error.
+func (t *translation) rule(route *gatewaymigration.HTTPRoute, rule gatewaymigration.HTTPRouteRule) error {
+	backend, weighted, err := backends(route, rule.BackendRefs)
+	if err != nil {
+		return err
+	}
+	var redirect *gatewaymigration.HTTPRequestRedirectFilter
+	var rewrite *gatewaymigration.HTTPURLRewriteFilter
+	for _, f := range rule.Filters {
+		switch {
+		case f.Type == "RequestRedirect" && f.RequestRedirect != nil:
+			redirect = f.RequestRedirect
+		case f.Type == "URLRewrite" && f.URLRewrite != nil:
+			rewrite = f.URLRewrite
+		default:
+			return fmt.Errorf("filter %s is not supported", f.Type)
+		}
+	}
+	if redirect != nil && (rewrite != nil || backend != nil) {
+		return fmt.Errorf("RequestRedirect filter cannot be combined with URLRewrite filters or backendRefs")
+	}
+	if redirect == nil && backend == nil {
+		return fmt.Errorf("rule has no backendRefs")
+	}
+
+	matches := rule.Matches
+	if len(matches) == 0 {
+		matches = []gatewaymigration.HTTPRouteMatch{{}}
+	}
+	// Translate everything which can fail before adding anything.
+	var translated []match
+	var rewrites []*annotations.URLRewrite
+	for _, m := range matches {
+		tm, err := toMatch(m)
+		if err != nil {
+			return err
+		}
+		if tm.conditional() && (redirect != nil || rewrite != nil || len(weighted) > 0) {
+			return fmt.Errorf("matches on headers or query parameters cannot be combined with filters or several backendRefs")
+		}
+		var r *annotations.URLRewrite
+		if rewrite != nil {
+			if r, err = toRewrite(rewrite, tm.exact); err != nil {
+				return err
+			}
+		}
+		translated = append(translated, tm)
+		rewrites = append(rewrites, r)
+	}
+	var r *annotations.URLRedirect
+	if redirect != nil {
+		if r, err = toRedirect(redirect); err != nil {
+			return err
+		}
+	}
+
+	hosts := route.Spec.Hostnames
+	if len(hosts) == 0 {
+		hosts = []string{""}
+	}
+	for _, host := range hosts {
+		for i, m := range translated {
+			if m.conditional() {
+				action := t.action(host, m.path)
+				action.Routes = append(action.Routes, annotations.ConditionalRoute{
+					Headers:     m.headers,
+					QueryParams: m.queryParams,
+					ServiceName: backend.ServiceName,
+					ServicePort: backend.ServicePort,
+				})
+				continue
+			}
+			if t.hasPath(host, m.path) {
+				t.errs = append(t.errs, fmt.Errorf("path %q of host %q of HTTPRoute %s/%s was skipped: it is already routed by an older HTTPRoute or rule", m.path, host, route.Namespace, route.Name))
+				continue
+			}
+			path := v1beta1.HTTPIngressPath{Path: m.path}
+			if backend != nil {
+				path.Backend = *backend
+			}
+			t.addPath(host, path)
+			if r != nil {
+				t.action(host, m.path).Redirect = r
+			}
+			if rewrites[i] != nil {
+				t.action(host, m.path).Rewrite = rewrites[i]
+			}
+			if len(weighted) > 0 {
+				t.action(host, m.path).WeightedBackends = weighted
+			}
+		}
+	}
+	return nil
+}
+
+// finish adds the paths which only have conditional routes and the route
+// actions annotation to the Ingress. Requests to these paths which do not
+// match any condition are sent to the default backend.
+func (t *translation) finish() error {
+	var actions []annotations.RouteAction
+	for _, host := range t.hosts {
+		for _, p := range t.paths[host] {
+			if action, ok := t.actions[hostPath{host, p.Path}]; ok {
+				actions = append(actions, *action)
+			}
+		}
+	}
+	var missing []hostPath
+	for key := range t.actions {
+		if !t.hasPath(key.host, key.path) {
+			missing = append(missing, key)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		if missing[i].host != missing[j].host {
+			return missing[i].host < missing[j].host
+		}
+		return missing[i].path < missing[j].path
+	})
+	for _, key := range missing {
+		t.addPath(key.host, v1beta1.HTTPIngressPath{Path: key.path})
+		actions = append(actions, *t.actions[key])
+	}
+	for _, host := range t.hosts {
+		t.ing.Spec.Rules = append(t.ing.Spec.Rules, v1beta1.IngressRule{
+			Host:             host,
+			IngressRuleValue: v1beta1.IngressRuleValue{HTTP: &v1beta1.HTTPIngressRuleValue{Paths: t.paths[host]}},
+		})
+	}
+	if len(actions) == 0 {
+		return nil
+	}
+	sort.SliceStable(actions, func(i, j int) bool {
+		if actions[i].Host != actions[j].Host {
+			return actions[i].Host < actions[j].Host
+		}
+		return actions[i].Path < actions[j].Path
+	})
+	content, err := json.Marshal(actions)
+	if err != nil {
+		return err
+	}
+	t.ing.Annotations[annotations.RouteActionsKey] = string(content)
+	return nil
+}
+
+func (t *translation) hasPath(host, path string) bool {
+	for _, p := range t.paths[host] {
+		if p.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *translation) addPath(host string, path v1beta1.HTTPIngressPath) {
+	if _, ok := t.paths[host]; !ok {
+		t.hosts = append(t.hosts, host)
+	}
+	t.paths[host] = append(t.paths[host], path)
+}
+
+func (t *translation) action(host, path string) *annotations.RouteAction {
+	key := hostPath{host, path}
+	if _, ok := t.actions[key]; !ok {
+		t.actions[key] = &annotations.RouteAction{Host: host, Path: path}
+	}
+	return t.actions[key]
+}
+
+// backends returns the backend of the paths of a rule, and the weighted
+// backends splitting their traffic if the rule has several backendRefs.
+func backends(route *gatewaymigration.HTTPRoute, refs []gatewaymigration.HTTPBackendRef) (*v1beta1.IngressBackend, []annotations.WeightedBackend, error) {
+	if len(refs) == 0 {
+		return nil, nil, nil
+	}
+	var weighted []annotations.WeightedBackend
+	for _, ref := range refs {
+		if ref.Kind != "" && ref.Kind != "Service" {
+			return nil, nil, fmt.Errorf("backendRef %q of kind %s is not supported", ref.Name, ref.Kind)
+		}
+		if ref.Namespace != "" && ref.Namespace != route.Namespace {
+			return nil, nil, fmt.Errorf("backendRef %s/%s is not in the namespace of the HTTPRoute", ref.Namespace, ref.Name)
+		}
+		weight := int64(1)
+		if ref.Weight != nil {
+			weight = int64(*ref.Weight)
+		}
+		if weight > annotations.MaxBackendWeight {
+			return nil, nil, fmt.Errorf("weight %d of backendRef %q is larger than %d", weight, ref.Name, annotations.MaxBackendWeight)
+		}
+		weighted = append(weighted, annotations.WeightedBackend{ServiceName: ref.Name, ServicePort: intstr.FromInt(int(ref.Port)), Weight: weight})
+	}
+	backend := &v1beta1.IngressBackend{ServiceName: weighted[0].ServiceName, ServicePort: weighted[0].ServicePort}
+	if len(weighted) == 1 {
+		return backend, nil, nil
+	}
+	return backend, weighted, nil
+}
+
+// toMatch translates a match of an HTTPRoute. Path prefixes are translated
+// to trailing wildcards, as the migration tool does the other way around.
+func toMatch(m gatewaymigration.HTTPRouteMatch) (match, error) {
+	var ret match
+	switch {
+	case m.Path == nil:
+		ret.path = "/*"
+	case m.Path.Type == "" || m.Path.Type == pathMatchPrefix:
+		ret.path = strings.TrimSuffix(m.Path.Value, "/") + "/*"
+	case m.Path.Type == pathMatchExact:
+		ret.path = m.Path.Value
+		ret.exact = true
+	default:
+		return match{}, fmt.Errorf("path match type %s is not supported", m.Path.Type)
+	}
+	for _, h := range m.Headers {
+		exact, regex, err := valueMatch(h.Type, h.Value)
+		if err != nil {
+			return match{}, fmt.Errorf("header %q: %v", h.Name, err)
+		}
+		ret.headers = append(ret.headers, annotations.HeaderMatch{Name: h.Name, Exact: exact, Regex: regex})
+	}
+	for _, q := range m.QueryParams {
+		exact, regex, err := valueMatch(q.Type, q.Value)
+		if err != nil {
+			return match{}, fmt.Errorf("query parameter %q: %v", q.Name, err)
+		}
+		ret.queryParams = append(ret.queryParams, annotations.QueryParamMatch{Name: q.Name, Exact: exact, Regex: regex})
+	}
+	return ret, nil
+}
+
+func valueMatch(matchType, value string) (string, string, error) {
+	switch matchType {
+	case "", valueMatchExact:
+		return value, "", nil
+	case valueMatchRegularExpression:
+		return "", value, nil
+	}
+	return "", "", fmt.Errorf("match type %s is not supported", matchType)
+}
+
+func toRedirect(f *gatewaymigration.HTTPRequestRedirectFilter) (*annotations.URLRedirect, error) {
+	code, ok := redirectResponseCodes[f.StatusCode]
+	if !ok {
+		return nil, fmt.Errorf("redirect status code %d is not supported", f.StatusCode)
+	}
+	r := &annotations.URLRedirect{Host: f.Hostname, ResponseCode: code}
+	switch f.Scheme {
+	case "":
+	case "https":
+		r.HTTPS = true
+	default:
+		return nil, fmt.Errorf("redirect scheme %s is not supported", f.Scheme)
+	}
+	if f.Path != nil {
+		switch f.Path.Type {
+		case "ReplaceFullPath":
+			r.Path = f.Path.ReplaceFullPath
+		case "ReplacePrefixMatch":
+			r.PathPrefix = f.Path.ReplacePrefixMatch
+		default:
+			return nil, fmt.Errorf("path modifier %s is not supported", f.Path.Type)
+		}
+	}
+	return r, nil
+}
+
+// toRewrite translates a URLRewrite filter. Replacing the full path of an
+// exact match is equivalent to replacing its prefix.
+func toRewrite(f *gatewaymigration.HTTPURLRewriteFilter, exact bool) (*annotations.URLRewrite, error) {
+	r := &annotations.URLRewrite{Host: f.Hostname}
+	if f.Path != nil {
+		switch {
+		case f.Path.Type == "ReplacePrefixMatch":
+			r.PathPrefix = f.Path.ReplacePrefixMatch
+		case f.Path.Type == "ReplaceFullPath" && exact:
+			r.PathPrefix = f.Path.ReplaceFullPath
+		default:
+			return nil, fmt.Errorf("path modifier %s is not supported for rewrites of path prefixes", f.Path.Type)
+		}
+	}
+	return r, nil
+}
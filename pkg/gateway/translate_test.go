@@ -0,0 +1,254 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/ingress-gce/pkg/annotations"
+	"k8s.io/ingress-gce/pkg/gatewaymigration"
+)
+
+const testNamespace = "default"
+
+func newGateway(class string, listeners ...gatewaymigration.Listener) *gatewaymigration.Gateway {
+	return &gatewaymigration.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: testNamespace, UID: "uid"},
+		Spec:       gatewaymigration.GatewaySpec{GatewayClassName: class, Listeners: listeners},
+	}
+}
+
+var httpListener = gatewaymigration.Listener{Name: "http", Port: 80, Protocol: "HTTP"}
+
+func newRoute(name string, age int, hosts []string, rules ...gatewaymigration.HTTPRouteRule) *gatewaymigration.HTTPRoute {
+	return &gatewaymigration.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         testNamespace,
+			CreationTimestamp: metav1.NewTime(time.Unix(0, 0).Add(-time.Duration(age) * time.Hour)),
+		},
+		Spec: gatewaymigration.HTTPRouteSpec{
+			ParentRefs: []gatewaymigration.ParentReference{{Name: "gw"}},
+			Hostnames:  hosts,
+			Rules:      rules,
+		},
+	}
+}
+
+func prefix(path string) []gatewaymigration.HTTPRouteMatch {
+	return []gatewaymigration.HTTPRouteMatch{{Path: &gatewaymigration.HTTPPathMatch{Type: "PathPrefix", Value: path}}}
+}
+
+func backendRef(name string, weight ...int32) gatewaymigration.HTTPBackendRef {
+	ref := gatewaymigration.HTTPBackendRef{Name: name, Port: 80}
+	if len(weight) > 0 {
+		ref.Weight = &weight[0]
+	}
+	return ref
+}
+
+func newIngress(annotationsMap map[string]string, rules ...v1beta1.IngressRule) *v1beta1.Ingress {
+	ing := &v1beta1.Ingress{
+		TypeMeta:   metav1.TypeMeta{APIVersion: gatewaymigration.GatewayAPIVersion, Kind: "Gateway"},
+		ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: testNamespace, UID: "uid", Annotations: annotationsMap},
+		Spec:       v1beta1.IngressSpec{Rules: rules},
+	}
+	return ing
+}
+
+func rule(host string, paths ...v1beta1.HTTPIngressPath) v1beta1.IngressRule {
+	return v1beta1.IngressRule{Host: host, IngressRuleValue: v1beta1.IngressRuleValue{HTTP: &v1beta1.HTTPIngressRuleValue{Paths: paths}}}
+}
+
+func path(p, svc string) v1beta1.HTTPIngressPath {
+	ret := v1beta1.HTTPIngressPath{Path: p}
+	if svc != "" {
+		ret.Backend = v1beta1.IngressBackend{ServiceName: svc, ServicePort: intstr.FromInt(80)}
+	}
+	return ret
+}
+
+func TestToIngress(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		gw       *gatewaymigration.Gateway
+		routes   []*gatewaymigration.HTTPRoute
+		want     *v1beta1.Ingress
+		wantErrs int
+	}{
+		{
+			desc: "paths of several hosts",
+			gw:   newGateway(gatewaymigration.ExternalGatewayClass, httpListener),
+			routes: []*gatewaymigration.HTTPRoute{
+				newRoute("app", 1, []string{"foo.com", "bar.com"},
+					gatewaymigration.HTTPRouteRule{Matches: prefix("/api/"), BackendRefs: []gatewaymigration.HTTPBackendRef{backendRef("api")}},
+					gatewaymigration.HTTPRouteRule{
+						Matches:     []gatewaymigration.HTTPRouteMatch{{Path: &gatewaymigration.HTTPPathMatch{Type: "Exact", Value: "/login"}}},
+						BackendRefs: []gatewaymigration.HTTPBackendRef{backendRef("login")},
+					},
+				),
+				newRoute("default", 0, nil, gatewaymigration.HTTPRouteRule{BackendRefs: []gatewaymigration.HTTPBackendRef{backendRef("web")}}),
+			},
+			want: newIngress(map[string]string{annotations.IngressClassKey: annotations.GceIngressClass},
+				rule("foo.com", path("/api/*", "api"), path("/login", "login")),
+				rule("bar.com", path("/api/*", "api"), path("/login", "login")),
+				rule("", path("/*", "web")),
+			),
+		},
+		{
+			desc: "HTTPS listener and named address",
+			gw: func() *gatewaymigration.Gateway {
+				gw := newGateway(gatewaymigration.ExternalGatewayClass, gatewaymigration.Listener{
+					Name:     "https",
+					Port:     443,
+					Protocol: "HTTPS",
+					TLS: &gatewaymigration.GatewayTLSConfig{
+						Mode:            "Terminate",
+						CertificateRefs: []gatewaymigration.SecretObjectReference{{Name: "cert"}},
+						Options:         map[string]string{gatewaymigration.PreSharedCertsOption: "shared"},
+					},
+				})
+				gw.Spec.Addresses = []gatewaymigration.GatewayAddress{{Type: "NamedAddress", Value: "ip"}}
+				return gw
+			}(),
+			want: func() *v1beta1.Ingress {
+				ing := newIngress(map[string]string{
+					annotations.IngressClassKey:  annotations.GceIngressClass,
+					annotations.AllowHTTPKey:     "false",
+					annotations.PreSharedCertKey: "shared",
+					annotations.StaticIPNameKey:  "ip",
+				})
+				ing.Spec.TLS = []v1beta1.IngressTLS{{SecretName: "cert"}}
+				return ing
+			}(),
+		},
+		{
+			desc: "internal Gateway with unsupported listener and address",
+			gw: func() *gatewaymigration.Gateway {
+				gw := newGateway(gatewaymigration.InternalGatewayClass, httpListener, gatewaymigration.Listener{Name: "alt", Port: 8080, Protocol: "HTTP"})
+				gw.Spec.Addresses = []gatewaymigration.GatewayAddress{{Type: "NamedAddress", Value: "ip"}}
+				return gw
+			}(),
+			want:     newIngress(map[string]string{annotations.IngressClassKey: annotations.GceL7ILBIngressClass}),
+			wantErrs: 2,
+		},
+		{
+			desc: "weighted backends, conditional routes and redirects",
+			gw:   newGateway(gatewaymigration.ExternalGatewayClass, httpListener),
+			routes: []*gatewaymigration.HTTPRoute{
+				newRoute("app", 0, nil,
+					gatewaymigration.HTTPRouteRule{BackendRefs: []gatewaymigration.HTTPBackendRef{backendRef("app", 90), backendRef("canary", 10)}},
+					gatewaymigration.HTTPRouteRule{
+						Matches: []gatewaymigration.HTTPRouteMatch{{
+							Path:    &gatewaymigration.HTTPPathMatch{Type: "PathPrefix", Value: "/beta"},
+							Headers: []gatewaymigration.HTTPHeaderMatch{{Name: "Cookie", Type: "RegularExpression", Value: ".*beta.*"}},
+						}},
+						BackendRefs: []gatewaymigration.HTTPBackendRef{backendRef("beta")},
+					},
+					gatewaymigration.HTTPRouteRule{
+						Matches: prefix("/old"),
+						Filters: []gatewaymigration.HTTPRouteFilter{{
+							Type: "RequestRedirect",
+							RequestRedirect: &gatewaymigration.HTTPRequestRedirectFilter{
+								Scheme:     "https",
+								Path:       &gatewaymigration.HTTPPathModifier{Type: "ReplacePrefixMatch", ReplacePrefixMatch: "/new"},
+								StatusCode: 302,
+							},
+						}},
+					},
+				),
+			},
+			want: newIngress(map[string]string{
+				annotations.IngressClassKey: annotations.GceIngressClass,
+				annotations.RouteActionsKey: `[{"path":"/*","weightedBackends":[{"serviceName":"app","servicePort":80,"weight":90},{"serviceName":"canary","servicePort":80,"weight":10}]},` +
+					`{"path":"/beta/*","routes":[{"headers":[{"name":"Cookie","regex":".*beta.*"}],"serviceName":"beta","servicePort":80}]},` +
+					`{"path":"/old/*","redirect":{"pathPrefix":"/new","https":true,"responseCode":"FOUND"}}]`,
+			}, rule("", path("/*", "app"), path("/old/*", ""), path("/beta/*", ""))),
+		},
+		{
+			desc: "conflicts and unsupported rules",
+			gw:   newGateway(gatewaymigration.ExternalGatewayClass, httpListener),
+			routes: []*gatewaymigration.HTTPRoute{
+				newRoute("new", 0, nil,
+					gatewaymigration.HTTPRouteRule{Matches: prefix("/"), BackendRefs: []gatewaymigration.HTTPBackendRef{backendRef("new")}},
+					gatewaymigration.HTTPRouteRule{
+						Matches:     []gatewaymigration.HTTPRouteMatch{{Path: &gatewaymigration.HTTPPathMatch{Type: "RegularExpression", Value: "/a.*"}}},
+						BackendRefs: []gatewaymigration.HTTPBackendRef{backendRef("regex")},
+					},
+					gatewaymigration.HTTPRouteRule{
+						Matches:     prefix("/headers"),
+						Filters:     []gatewaymigration.HTTPRouteFilter{{Type: "RequestHeaderModifier"}},
+						BackendRefs: []gatewaymigration.HTTPBackendRef{backendRef("headers")},
+					},
+					gatewaymigration.HTTPRouteRule{
+						Matches:     prefix("/other"),
+						BackendRefs: []gatewaymigration.HTTPBackendRef{{Namespace: "other", Name: "other", Port: 80}},
+					},
+				),
+				newRoute("old", 1, nil, gatewaymigration.HTTPRouteRule{BackendRefs: []gatewaymigration.HTTPBackendRef{backendRef("old")}}),
+				func() *gatewaymigration.HTTPRoute {
+					route := newRoute("detached", 2, nil, gatewaymigration.HTTPRouteRule{BackendRefs: []gatewaymigration.HTTPBackendRef{backendRef("detached")}})
+					route.Spec.ParentRefs[0].Name = "other"
+					return route
+				}(),
+			},
+			want:     newIngress(map[string]string{annotations.IngressClassKey: annotations.GceIngressClass}, rule("", path("/*", "old"))),
+			wantErrs: 4,
+		},
+		{
+			desc: "rule with an unsupported rewrite adds no paths",
+			gw:   newGateway(gatewaymigration.ExternalGatewayClass, httpListener),
+			routes: []*gatewaymigration.HTTPRoute{
+				newRoute("app", 0, []string{"foo.com", "bar.com"}, gatewaymigration.HTTPRouteRule{
+					Matches: prefix("/app"),
+					Filters: []gatewaymigration.HTTPRouteFilter{{
+						Type:       "URLRewrite",
+						URLRewrite: &gatewaymigration.HTTPURLRewriteFilter{Path: &gatewaymigration.HTTPPathModifier{Type: "ReplaceFullPath", ReplaceFullPath: "/"}},
+					}},
+					BackendRefs: []gatewaymigration.HTTPBackendRef{backendRef("app")},
+				}),
+			},
+			want:     newIngress(map[string]string{annotations.IngressClassKey: annotations.GceIngressClass}),
+			wantErrs: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, errs := ToIngress(tc.gw, tc.routes)
+			if len(errs) != tc.wantErrs {
+				t.Errorf("ToIngress() returned errors %v, want %d errors", errs, tc.wantErrs)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ToIngress() = %+v\nwant %+v", got, tc.want)
+				if got != nil {
+					t.Logf("route actions: %s", got.Annotations[annotations.RouteActionsKey])
+				}
+			}
+		})
+	}
+}
+
+func TestToIngressUnsupportedClass(t *testing.T) {
+	if ing, errs := ToIngress(newGateway("istio", httpListener), nil); ing != nil || len(errs) != 1 {
+		t.Errorf("ToIngress() = %v, %v, want nil Ingress and an error", ing, errs)
+	}
+}
@@ -0,0 +1,554 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gatewaymigration
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/annotations"
+	frontendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1"
+	"k8s.io/ingress-gce/pkg/backendconfig"
+	"k8s.io/ingress-gce/pkg/controller/translator"
+	"k8s.io/ingress-gce/pkg/frontendconfig"
+)
+
+const (
+	pathMatchExact  = "Exact"
+	pathMatchPrefix = "PathPrefix"
+)
+
+// redirectStatusCodes maps the redirect response codes of the route actions
+// annotation to the status codes supported by the RequestRedirect filter.
+var redirectStatusCodes = map[string]int{
+	"":                          301,
+	"MOVED_PERMANENTLY_DEFAULT": 301,
+	"FOUND":                     302,
+}
+
+// Issue is a feature of an object which has no equivalent in the generated
+// Gateway API resources and needs to be migrated manually.
+type Issue struct {
+	// Object is the kind and namespaced name of the object using the feature.
+	Object  string
+	Feature string
+	Message string
+}
+
+// Result holds the generated resources and the migration report.
+type Result struct {
+	Gateways        []*Gateway
+	HTTPRoutes      []*HTTPRoute
+	BackendPolicies []*GCPBackendPolicy
+	Issues          []Issue
+}
+
+// WriteManifests writes the generated resources to w as a multi-document
+// YAML stream.
+func (r *Result) WriteManifests(w io.Writer) error {
+	var objs []interface{}
+	for _, gw := range r.Gateways {
+		objs = append(objs, gw)
+	}
+	for _, route := range r.HTTPRoutes {
+		objs = append(objs, route)
+	}
+	for _, policy := range r.BackendPolicies {
+		objs = append(objs, policy)
+	}
+	serializer := json.NewYAMLSerializer(json.DefaultMetaFactory, nil, nil)
+	for _, obj := range objs {
+		// The generated types are not registered in a scheme, they are
+		// serialized through their unstructured representation.
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w, "---"); err != nil {
+			return err
+		}
+		if err := serializer.Encode(&unstructured.Unstructured{Object: content}, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteReport writes the features which could not be migrated to w.
+func (r *Result) WriteReport(w io.Writer) error {
+	if len(r.Issues) == 0 {
+		_, err := fmt.Fprintln(w, "All features were migrated.")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "OBJECT\tFEATURE\tMESSAGE")
+	for _, issue := range r.Issues {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", issue.Object, issue.Feature, issue.Message)
+	}
+	return tw.Flush()
+}
+
+// Converter generates Gateway API resources equivalent to Ingresses and the
+// BackendConfigs and FrontendConfigs they use.
+type Converter struct {
+	serviceLister       cache.Store
+	backendConfigLister cache.Store
+	frontendConfigs     []*frontendconfigv1beta1.FrontendConfig
+}
+
+// NewConverter returns a new Converter.
+func NewConverter(serviceLister, backendConfigLister cache.Store, frontendConfigs []*frontendconfigv1beta1.FrontendConfig) *Converter {
+	return &Converter{
+		serviceLister:       serviceLister,
+		backendConfigLister: backendConfigLister,
+		frontendConfigs:     frontendConfigs,
+	}
+}
+
+// conversion holds the state of a single Convert call.
+type conversion struct {
+	*Converter
+	result *Result
+	// policies maps the key of a Service to the BackendConfig its
+	// GCPBackendPolicy was generated from.
+	policies map[string]string
+}
+
+// Convert generates the Gateway API resources for the given Ingresses.
+func (c *Converter) Convert(ings []*v1beta1.Ingress) *Result {
+	sorted := append([]*v1beta1.Ingress{}, ings...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Namespace != sorted[j].Namespace {
+			return sorted[i].Namespace < sorted[j].Namespace
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	conv := &conversion{Converter: c, result: &Result{}, policies: map[string]string{}}
+	for _, ing := range sorted {
+		conv.convertIngress(ing)
+	}
+	sort.Slice(conv.result.BackendPolicies, func(i, j int) bool {
+		pi, pj := conv.result.BackendPolicies[i], conv.result.BackendPolicies[j]
+		if pi.Namespace != pj.Namespace {
+			return pi.Namespace < pj.Namespace
+		}
+		return pi.Name < pj.Name
+	})
+	return conv.result
+}
+
+func (c *conversion) issue(object, feature, format string, args ...interface{}) {
+	c.result.Issues = append(c.result.Issues, Issue{Object: object, Feature: feature, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *conversion) convertIngress(ing *v1beta1.Ingress) {
+	obj := fmt.Sprintf("Ingress %s/%s", ing.Namespace, ing.Name)
+	ingAnnotations := annotations.FromIngress(ing)
+
+	var class string
+	switch ingAnnotations.IngressClass() {
+	case "", annotations.GceIngressClass:
+		class = ExternalGatewayClass
+	case annotations.GceL7ILBIngressClass:
+		class = InternalGatewayClass
+	default:
+		c.issue(obj, "ingressClass", "Ingress class %q has no GatewayClass equivalent, the Ingress was skipped", ingAnnotations.IngressClass())
+		return
+	}
+
+	gw := &Gateway{
+		TypeMeta:   metav1.TypeMeta{APIVersion: GatewayAPIVersion, Kind: "Gateway"},
+		ObjectMeta: metav1.ObjectMeta{Name: ing.Name, Namespace: ing.Namespace},
+		Spec:       GatewaySpec{GatewayClassName: class},
+	}
+	if ingAnnotations.AllowHTTP() {
+		gw.Spec.Listeners = append(gw.Spec.Listeners, Listener{Name: "http", Port: 80, Protocol: "HTTP"})
+	}
+	var certRefs []SecretObjectReference
+	for _, tls := range ing.Spec.TLS {
+		if tls.SecretName != "" {
+			certRefs = append(certRefs, SecretObjectReference{Name: tls.SecretName})
+		}
+	}
+	if preSharedCerts := ingAnnotations.UseNamedTLS(); len(certRefs) > 0 || preSharedCerts != "" {
+		tls := &GatewayTLSConfig{Mode: "Terminate", CertificateRefs: certRefs}
+		if preSharedCerts != "" {
+			tls.Options = map[string]string{PreSharedCertsOption: preSharedCerts}
+		}
+		gw.Spec.Listeners = append(gw.Spec.Listeners, Listener{Name: "https", Port: 443, Protocol: "HTTPS", TLS: tls})
+	}
+	if len(gw.Spec.Listeners) == 0 {
+		c.issue(obj, "allowHTTP", "HTTP is disabled and no certificate is configured, the Gateway has no listener")
+	}
+	if ip := ingAnnotations.StaticIPName(); ip != "" {
+		gw.Spec.Addresses = []GatewayAddress{{Type: "NamedAddress", Value: ip}}
+	}
+	if urlMap := ingAnnotations.URLMap(); urlMap != "" {
+		c.issue(obj, "urlMap", "URL map %q has no Gateway equivalent, the HTTPRoutes are converted from the Ingress spec instead", urlMap)
+	}
+	if ingAnnotations.FrontendConfig() != "" {
+		feConfig, err := frontendconfig.FrontendConfigForIngress(c.frontendConfigs, ing)
+		if err != nil {
+			c.issue(obj, "frontendConfig", "%v", err)
+		} else {
+			feObj := fmt.Sprintf("FrontendConfig %s/%s", feConfig.Namespace, feConfig.Name)
+			if feConfig.Spec.QuicOverride != "" {
+				c.issue(feObj, "quicOverride", "QUIC override %s has no Gateway equivalent", feConfig.Spec.QuicOverride)
+			}
+			if feConfig.Spec.HttpKeepAliveTimeoutSec != 0 {
+				c.issue(feObj, "httpKeepAliveTimeoutSec", "HTTP keepalive timeout %ds has no Gateway equivalent", feConfig.Spec.HttpKeepAliveTimeoutSec)
+			}
+			if feConfig.Spec.NetworkTier != "" {
+				c.issue(feObj, "networkTier", "network tier %s has no Gateway equivalent", feConfig.Spec.NetworkTier)
+			}
+			if feConfig.Spec.AllowGlobalAccess != nil {
+				c.issue(feObj, "allowGlobalAccess", "global access %t has no Gateway equivalent", *feConfig.Spec.AllowGlobalAccess)
+			}
+			if feConfig.Spec.MutualTLS != nil {
+				c.issue(feObj, "mutualTLS", "mutual TLS has no Gateway equivalent, attach a ServerTlsPolicy to the Gateway proxy instead")
+			}
+			if ports := feConfig.Spec.HttpsPorts; len(ports) > 0 {
+				addHTTPSPorts(gw, ports)
+			}
+		}
+	}
+	c.result.Gateways = append(c.result.Gateways, gw)
+
+	actions, err := ingAnnotations.RouteActions()
+	if err != nil {
+		c.issue(obj, "routeActions", "%v", err)
+	}
+	used := make([]bool, len(actions))
+	findAction := func(host, path string) *annotations.RouteAction {
+		for i := range actions {
+			if actions[i].Host == host && actions[i].Path == path {
+				used[i] = true
+				return &actions[i]
+			}
+		}
+		return nil
+	}
+
+	if ing.Spec.Backend != nil {
+		route := newHTTPRoute(ing, ing.Name+"-default", "")
+		if ref, ok := c.backendRef(ing, ing.Spec.Backend.ServiceName, ing.Spec.Backend.ServicePort); ok {
+			route.Spec.Rules = append(route.Spec.Rules, HTTPRouteRule{BackendRefs: []HTTPBackendRef{ref}})
+			c.result.HTTPRoutes = append(c.result.HTTPRoutes, route)
+		}
+	}
+	for i, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		route := newHTTPRoute(ing, fmt.Sprintf("%s-%d", ing.Name, i), rule.Host)
+		for _, p := range rule.HTTP.Paths {
+			match, ok := pathMatch(p.Path)
+			if !ok {
+				c.issue(obj, "path", "path %q of host %q has no HTTPRoute path match equivalent", p.Path, rule.Host)
+				continue
+			}
+			route.Spec.Rules = append(route.Spec.Rules, c.convertPath(ing, match, p.Backend, findAction(rule.Host, p.Path))...)
+		}
+		if len(route.Spec.Rules) > 0 {
+			c.result.HTTPRoutes = append(c.result.HTTPRoutes, route)
+		}
+	}
+	for i, action := range actions {
+		if !used[i] {
+			c.issue(obj, "routeActions", "route action for host %q and path %q does not match any path of the Ingress", action.Host, action.Path)
+		}
+	}
+}
+
+// addHTTPSPorts moves the https listener of the Gateway to the first of the
+// given ports, and adds a listener with the same TLS config for each other
+// port.
+func addHTTPSPorts(gw *Gateway, ports []int64) {
+	for i := range gw.Spec.Listeners {
+		listener := gw.Spec.Listeners[i]
+		if listener.Name != "https" {
+			continue
+		}
+		gw.Spec.Listeners[i].Port = int32(ports[0])
+		for _, port := range ports[1:] {
+			gw.Spec.Listeners = append(gw.Spec.Listeners, Listener{Name: fmt.Sprintf("https-%d", port), Port: int32(port), Protocol: "HTTPS", TLS: listener.TLS})
+		}
+		return
+	}
+}
+
+func newHTTPRoute(ing *v1beta1.Ingress, name, host string) *HTTPRoute {
+	route := &HTTPRoute{
+		TypeMeta:   metav1.TypeMeta{APIVersion: GatewayAPIVersion, Kind: "HTTPRoute"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ing.Namespace},
+		Spec:       HTTPRouteSpec{ParentRefs: []ParentReference{{Name: ing.Name}}},
+	}
+	if host != "" {
+		route.Spec.Hostnames = []string{host}
+	}
+	return route
+}
+
+// pathMatch returns the HTTPRoute path match equivalent to an Ingress path.
+// Only trailing wildcards are supported.
+func pathMatch(path string) (HTTPPathMatch, bool) {
+	switch {
+	case path == "" || path == "/*":
+		return HTTPPathMatch{Type: pathMatchPrefix, Value: "/"}, true
+	case strings.HasSuffix(path, "/*") && !strings.Contains(strings.TrimSuffix(path, "/*"), "*"):
+		return HTTPPathMatch{Type: pathMatchPrefix, Value: strings.TrimSuffix(path, "/*")}, true
+	case !strings.Contains(path, "*"):
+		return HTTPPathMatch{Type: pathMatchExact, Value: path}, true
+	}
+	return HTTPPathMatch{}, false
+}
+
+// convertPath returns the rules of a path of the Ingress, including the rules
+// of the conditional routes of its route action.
+func (c *conversion) convertPath(ing *v1beta1.Ingress, match HTTPPathMatch, backend v1beta1.IngressBackend, action *annotations.RouteAction) []HTTPRouteRule {
+	obj := fmt.Sprintf("Ingress %s/%s", ing.Namespace, ing.Name)
+	var rules []HTTPRouteRule
+	rule := HTTPRouteRule{Matches: []HTTPRouteMatch{{Path: &match}}}
+	if action != nil {
+		if action.SecurityPolicy != "" {
+			c.issue(obj, "routeActions", "security policy %q of path %q has no HTTPRoute equivalent, apply it with the GCPBackendPolicy of a Service dedicated to the path", action.SecurityPolicy, match.Value)
+		}
+		for _, r := range action.Routes {
+			if routeRule, ok := c.convertConditionalRoute(ing, match, r); ok {
+				rules = append(rules, routeRule)
+			}
+		}
+		// The backend of the path in the Ingress spec is a placeholder.
+		if action.BackendService != "" {
+			c.issue(obj, "routeActions", "backend service %q of path %q has no HTTPRoute equivalent, route the path to a Service instead", action.BackendService, match.Value)
+			return rules
+		}
+		if action.Redirect != nil {
+			rule.Filters = []HTTPRouteFilter{c.redirectFilter(obj, match, action.Redirect)}
+			return append(rules, rule)
+		}
+		if action.Rewrite != nil {
+			rule.Filters = []HTTPRouteFilter{{
+				Type: "URLRewrite",
+				URLRewrite: &HTTPURLRewriteFilter{
+					Hostname: action.Rewrite.Host,
+					Path:     pathModifier(match, "", action.Rewrite.PathPrefix),
+				},
+			}}
+		}
+		if len(action.WeightedBackends) > 0 {
+			for _, wb := range action.WeightedBackends {
+				ref, ok := c.backendRef(ing, wb.ServiceName, wb.ServicePort)
+				if !ok {
+					continue
+				}
+				weight := int32(wb.Weight)
+				ref.Weight = &weight
+				rule.BackendRefs = append(rule.BackendRefs, ref)
+			}
+			return append(rules, rule)
+		}
+	}
+	if ref, ok := c.backendRef(ing, backend.ServiceName, backend.ServicePort); ok {
+		rule.BackendRefs = []HTTPBackendRef{ref}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func (c *conversion) convertConditionalRoute(ing *v1beta1.Ingress, match HTTPPathMatch, r annotations.ConditionalRoute) (HTTPRouteRule, bool) {
+	obj := fmt.Sprintf("Ingress %s/%s", ing.Namespace, ing.Name)
+	routeMatch := HTTPRouteMatch{Path: &match}
+	for _, h := range r.Headers {
+		matchType, value, ok := valueMatch(h.Exact, h.Regex)
+		if !ok {
+			c.issue(obj, "routeActions", "presence match on header %q of path %q has no HTTPRoute equivalent, the route to %q was skipped", h.Name, match.Value, r.ServiceName)
+			return HTTPRouteRule{}, false
+		}
+		routeMatch.Headers = append(routeMatch.Headers, HTTPHeaderMatch{Type: matchType, Name: h.Name, Value: value})
+	}
+	for _, q := range r.QueryParams {
+		matchType, value, ok := valueMatch(q.Exact, q.Regex)
+		if !ok {
+			c.issue(obj, "routeActions", "presence match on query parameter %q of path %q has no HTTPRoute equivalent, the route to %q was skipped", q.Name, match.Value, r.ServiceName)
+			return HTTPRouteRule{}, false
+		}
+		routeMatch.QueryParams = append(routeMatch.QueryParams, HTTPQueryParamMatch{Type: matchType, Name: q.Name, Value: value})
+	}
+	ref, ok := c.backendRef(ing, r.ServiceName, r.ServicePort)
+	if !ok {
+		return HTTPRouteRule{}, false
+	}
+	return HTTPRouteRule{Matches: []HTTPRouteMatch{routeMatch}, BackendRefs: []HTTPBackendRef{ref}}, true
+}
+
+// valueMatch returns the match type and value of an exact or regex match.
+// Presence matches are not supported.
+func valueMatch(exact, regex string) (string, string, bool) {
+	switch {
+	case exact != "":
+		return "Exact", exact, true
+	case regex != "":
+		return "RegularExpression", regex, true
+	}
+	return "", "", false
+}
+
+func (c *conversion) redirectFilter(obj string, match HTTPPathMatch, redirect *annotations.URLRedirect) HTTPRouteFilter {
+	filter := &HTTPRequestRedirectFilter{
+		Hostname: redirect.Host,
+		Path:     pathModifier(match, redirect.Path, redirect.PathPrefix),
+	}
+	if redirect.HTTPS {
+		filter.Scheme = "https"
+	}
+	code, ok := redirectStatusCodes[redirect.ResponseCode]
+	if !ok {
+		// Fall back to the supported code with the same permanence.
+		code = 302
+		if redirect.ResponseCode == "PERMANENT_REDIRECT" {
+			code = 301
+		}
+		c.issue(obj, "routeActions", "redirect response code %s of path %q is not supported by HTTPRoute, using %d", redirect.ResponseCode, match.Value, code)
+	}
+	filter.StatusCode = code
+	if redirect.StripQuery {
+		c.issue(obj, "routeActions", "stripping the query of redirects of path %q has no HTTPRoute equivalent", match.Value)
+	}
+	return HTTPRouteFilter{Type: "RequestRedirect", RequestRedirect: filter}
+}
+
+// pathModifier returns the path modifier replacing the full path or the
+// matched prefix. Replacing the prefix of an exact match is equivalent to
+// replacing the full path.
+func pathModifier(match HTTPPathMatch, fullPath, prefix string) *HTTPPathModifier {
+	switch {
+	case fullPath != "":
+		return &HTTPPathModifier{Type: "ReplaceFullPath", ReplaceFullPath: fullPath}
+	case prefix != "" && match.Type == pathMatchExact:
+		return &HTTPPathModifier{Type: "ReplaceFullPath", ReplaceFullPath: prefix}
+	case prefix != "":
+		return &HTTPPathModifier{Type: "ReplacePrefixMatch", ReplacePrefixMatch: prefix}
+	}
+	return nil
+}
+
+// backendRef returns the reference to the given service port and generates
+// the GCPBackendPolicy of the service from its BackendConfig.
+func (c *conversion) backendRef(ing *v1beta1.Ingress, svcName string, port intstr.IntOrString) (HTTPBackendRef, bool) {
+	obj := fmt.Sprintf("Ingress %s/%s", ing.Namespace, ing.Name)
+	item, exists, err := c.serviceLister.GetByKey(ing.Namespace + "/" + svcName)
+	if err != nil || !exists {
+		c.issue(obj, "backend", "Service %s/%s was not found, its routes were skipped", ing.Namespace, svcName)
+		return HTTPBackendRef{}, false
+	}
+	svc := item.(*apiv1.Service)
+	svcPort := translator.ServicePort(*svc, port)
+	if svcPort == nil {
+		c.issue(obj, "backend", "port %s of Service %s/%s was not found, its routes were skipped", port.String(), ing.Namespace, svcName)
+		return HTTPBackendRef{}, false
+	}
+	c.ensureBackendPolicy(svc, svcPort)
+	return HTTPBackendRef{Name: svcName, Port: svcPort.Port}, true
+}
+
+// ensureBackendPolicy generates the GCPBackendPolicy of the service from the
+// BackendConfig of the service port, if it was not generated yet.
+func (c *conversion) ensureBackendPolicy(svc *apiv1.Service, svcPort *apiv1.ServicePort) {
+	svcObj := fmt.Sprintf("Service %s/%s", svc.Namespace, svc.Name)
+	beConfig, err := backendconfig.GetBackendConfigForServicePort(c.backendConfigLister, svc, svcPort)
+	if err == backendconfig.ErrNoBackendConfigForPort {
+		beConfig, err = nil, nil
+	}
+	if err != nil {
+		c.issue(svcObj, "backendConfig", "%v", err)
+		return
+	}
+	configName := ""
+	if beConfig != nil {
+		configName = beConfig.Name
+	}
+	key := svc.Namespace + "/" + svc.Name
+	if prev, ok := c.policies[key]; ok {
+		if prev != configName {
+			c.issue(svcObj, "backendConfig", "ports use different BackendConfigs but GCPBackendPolicy applies to all ports of a Service, only BackendConfig %q was migrated", prev)
+		}
+		return
+	}
+	c.policies[key] = configName
+	if beConfig == nil {
+		return
+	}
+
+	configObj := fmt.Sprintf("BackendConfig %s/%s", beConfig.Namespace, beConfig.Name)
+	spec := beConfig.Spec
+	config := &GCPBackendPolicyConfig{TimeoutSec: spec.TimeoutSec}
+	if spec.ConnectionDraining != nil {
+		config.ConnectionDraining = &ConnectionDrainingConfig{DrainingTimeoutSec: spec.ConnectionDraining.DrainingTimeoutSec}
+	}
+	if spec.SessionAffinity != nil {
+		config.SessionAffinity = &SessionAffinityConfig{
+			Type:         spec.SessionAffinity.AffinityType,
+			CookieTTLSec: spec.SessionAffinity.AffinityCookieTtlSec,
+		}
+	}
+	if spec.SecurityPolicy != nil {
+		config.SecurityPolicy = spec.SecurityPolicy.Name
+	}
+	if spec.Iap != nil && spec.Iap.Enabled {
+		config.IAP = &IAPConfig{Enabled: true}
+		if creds := spec.Iap.OAuthClientCredentials; creds != nil {
+			config.IAP.ClientID = creds.ClientID
+			if creds.SecretName != "" {
+				config.IAP.OAuth2ClientSecret = &SecretObjectReference{Name: creds.SecretName}
+			}
+		}
+	}
+	if spec.Cdn != nil && spec.Cdn.Enabled {
+		c.issue(configObj, "cdn", "Cloud CDN is not supported by Gateways")
+	}
+	if spec.CustomRequestHeaders != nil && len(spec.CustomRequestHeaders.Headers) > 0 {
+		c.issue(configObj, "customRequestHeaders", "custom request headers have no GCPBackendPolicy equivalent, use a RequestHeaderModifier filter on the HTTPRoute rules instead")
+	}
+	if spec.HealthCheck != nil {
+		c.issue(configObj, "healthCheck", "health check settings have no GCPBackendPolicy equivalent, create a HealthCheckPolicy for the Service instead")
+	}
+	if spec.Alerting != nil && spec.Alerting.Enabled {
+		c.issue(configObj, "alerting", "alert policies are not managed for Gateways, create the Cloud Monitoring alert policies separately")
+	}
+
+	c.result.BackendPolicies = append(c.result.BackendPolicies, &GCPBackendPolicy{
+		TypeMeta:   metav1.TypeMeta{APIVersion: PolicyAPIVersion, Kind: "GCPBackendPolicy"},
+		ObjectMeta: metav1.ObjectMeta{Name: svc.Name, Namespace: svc.Namespace},
+		Spec: GCPBackendPolicySpec{
+			Default:   config,
+			TargetRef: PolicyTargetReference{Group: "", Kind: "Service", Name: svc.Name},
+		},
+	})
+}
@@ -0,0 +1,280 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gatewaymigration
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/annotations"
+	backendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/backendconfig/v1beta1"
+	frontendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1"
+)
+
+const testNamespace = "default"
+
+func newTestConverter(t *testing.T) *Converter {
+	t.Helper()
+	svcLister := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, name := range []string{"app", "app-canary", "app-beta"} {
+		svc := &apiv1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+			Spec:       apiv1.ServiceSpec{Ports: []apiv1.ServicePort{{Name: "http", Port: 80}}},
+		}
+		if name == "app" {
+			svc.Annotations = map[string]string{annotations.BackendConfigKey: `{"default":"app-config"}`}
+		}
+		svcLister.Add(svc)
+	}
+
+	timeout := int64(42)
+	beConfigLister := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	beConfigLister.Add(&backendconfigv1beta1.BackendConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-config", Namespace: testNamespace},
+		Spec: backendconfigv1beta1.BackendConfigSpec{
+			TimeoutSec:     &timeout,
+			SecurityPolicy: &backendconfigv1beta1.SecurityPolicyConfig{Name: "policy"},
+			Cdn:            &backendconfigv1beta1.CDNConfig{Enabled: true},
+		},
+	})
+
+	feConfigs := []*frontendconfigv1beta1.FrontendConfig{{
+		ObjectMeta: metav1.ObjectMeta{Name: "fe-config", Namespace: testNamespace},
+		Spec:       frontendconfigv1beta1.FrontendConfigSpec{QuicOverride: frontendconfigv1beta1.QuicOverrideEnable, HttpsPorts: []int64{443, 8443}},
+	}}
+	return NewConverter(svcLister, beConfigLister, feConfigs)
+}
+
+func newTestIngress(annotations map[string]string, paths ...string) *v1beta1.Ingress {
+	ing := &v1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "ing", Namespace: testNamespace, Annotations: annotations},
+		Spec: v1beta1.IngressSpec{
+			Backend: &v1beta1.IngressBackend{ServiceName: "app", ServicePort: intstr.FromString("http")},
+		},
+	}
+	if len(paths) > 0 {
+		rule := v1beta1.IngressRule{Host: "foo.com", IngressRuleValue: v1beta1.IngressRuleValue{HTTP: &v1beta1.HTTPIngressRuleValue{}}}
+		for _, p := range paths {
+			rule.HTTP.Paths = append(rule.HTTP.Paths, v1beta1.HTTPIngressPath{
+				Path:    p,
+				Backend: v1beta1.IngressBackend{ServiceName: "app", ServicePort: intstr.FromInt(80)},
+			})
+		}
+		ing.Spec.Rules = []v1beta1.IngressRule{rule}
+	}
+	return ing
+}
+
+func issueFeatures(issues []Issue) []string {
+	var features []string
+	for _, issue := range issues {
+		features = append(features, issue.Feature)
+	}
+	return features
+}
+
+func TestConvertGateway(t *testing.T) {
+	ing := newTestIngress(map[string]string{
+		annotations.StaticIPNameKey:   "my-ip",
+		annotations.PreSharedCertKey:  "cert-a,cert-b",
+		annotations.FrontendConfigKey: "fe-config",
+	})
+	ing.Spec.TLS = []v1beta1.IngressTLS{{SecretName: "tls-secret"}}
+
+	result := newTestConverter(t).Convert([]*v1beta1.Ingress{ing})
+	if len(result.Gateways) != 1 {
+		t.Fatalf("Got %d Gateways, want 1", len(result.Gateways))
+	}
+	gw := result.Gateways[0]
+	if gw.Spec.GatewayClassName != ExternalGatewayClass {
+		t.Errorf("Got GatewayClassName %q, want %q", gw.Spec.GatewayClassName, ExternalGatewayClass)
+	}
+	tls := &GatewayTLSConfig{
+		Mode:            "Terminate",
+		CertificateRefs: []SecretObjectReference{{Name: "tls-secret"}},
+		Options:         map[string]string{PreSharedCertsOption: "cert-a,cert-b"},
+	}
+	wantListeners := []Listener{
+		{Name: "http", Port: 80, Protocol: "HTTP"},
+		{Name: "https", Port: 443, Protocol: "HTTPS", TLS: tls},
+		{Name: "https-8443", Port: 8443, Protocol: "HTTPS", TLS: tls},
+	}
+	if !reflect.DeepEqual(gw.Spec.Listeners, wantListeners) {
+		t.Errorf("Got listeners %+v, want %+v", gw.Spec.Listeners, wantListeners)
+	}
+	wantAddresses := []GatewayAddress{{Type: "NamedAddress", Value: "my-ip"}}
+	if !reflect.DeepEqual(gw.Spec.Addresses, wantAddresses) {
+		t.Errorf("Got addresses %+v, want %+v", gw.Spec.Addresses, wantAddresses)
+	}
+
+	if len(result.BackendPolicies) != 1 {
+		t.Fatalf("Got %d GCPBackendPolicies, want 1", len(result.BackendPolicies))
+	}
+	policy := result.BackendPolicies[0]
+	if policy.Spec.TargetRef.Name != "app" || *policy.Spec.Default.TimeoutSec != 42 || policy.Spec.Default.SecurityPolicy != "policy" {
+		t.Errorf("Got GCPBackendPolicy %+v, want timeout and security policy of app-config for app", policy.Spec)
+	}
+
+	wantIssues := []string{"quicOverride", "cdn"}
+	if got := issueFeatures(result.Issues); !reflect.DeepEqual(got, wantIssues) {
+		t.Errorf("Got issues %v, want %v", result.Issues, wantIssues)
+	}
+
+	var buf bytes.Buffer
+	if err := result.WriteManifests(&buf); err != nil {
+		t.Fatalf("WriteManifests() = %v, want nil", err)
+	}
+	for _, want := range []string{"kind: Gateway", "kind: HTTPRoute", "kind: GCPBackendPolicy", "gatewayClassName: " + ExternalGatewayClass} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Manifests do not contain %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestConvertHTTPRoutes(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		ing        *v1beta1.Ingress
+		wantRules  []HTTPRouteRule
+		wantIssues []string
+	}{
+		{
+			desc: "paths",
+			ing:  newTestIngress(nil, "/*", "/api/*", "/exact", "/bad*/x"),
+			wantRules: []HTTPRouteRule{
+				{Matches: []HTTPRouteMatch{{Path: &HTTPPathMatch{Type: "PathPrefix", Value: "/"}}}, BackendRefs: []HTTPBackendRef{{Name: "app", Port: 80}}},
+				{Matches: []HTTPRouteMatch{{Path: &HTTPPathMatch{Type: "PathPrefix", Value: "/api"}}}, BackendRefs: []HTTPBackendRef{{Name: "app", Port: 80}}},
+				{Matches: []HTTPRouteMatch{{Path: &HTTPPathMatch{Type: "Exact", Value: "/exact"}}}, BackendRefs: []HTTPBackendRef{{Name: "app", Port: 80}}},
+			},
+			wantIssues: []string{"cdn", "path"},
+		},
+		{
+			desc: "rewrite and redirect",
+			ing: newTestIngress(map[string]string{
+				annotations.RouteActionsKey: `[{"host":"foo.com","path":"/api/*","rewrite":{"pathPrefix":"/v1"}},` +
+					`{"host":"foo.com","path":"/old","redirect":{"https":true,"pathPrefix":"/new","responseCode":"SEE_OTHER","stripQuery":true}}]`,
+			}, "/api/*", "/old"),
+			wantRules: []HTTPRouteRule{
+				{
+					Matches:     []HTTPRouteMatch{{Path: &HTTPPathMatch{Type: "PathPrefix", Value: "/api"}}},
+					Filters:     []HTTPRouteFilter{{Type: "URLRewrite", URLRewrite: &HTTPURLRewriteFilter{Path: &HTTPPathModifier{Type: "ReplacePrefixMatch", ReplacePrefixMatch: "/v1"}}}},
+					BackendRefs: []HTTPBackendRef{{Name: "app", Port: 80}},
+				},
+				{
+					Matches: []HTTPRouteMatch{{Path: &HTTPPathMatch{Type: "Exact", Value: "/old"}}},
+					Filters: []HTTPRouteFilter{{Type: "RequestRedirect", RequestRedirect: &HTTPRequestRedirectFilter{
+						Scheme:     "https",
+						Path:       &HTTPPathModifier{Type: "ReplaceFullPath", ReplaceFullPath: "/new"},
+						StatusCode: 302,
+					}}},
+				},
+			},
+			wantIssues: []string{"cdn", "routeActions", "routeActions"},
+		},
+		{
+			desc: "weighted backends and conditional routes",
+			ing: newTestIngress(map[string]string{
+				annotations.RouteActionsKey: `[{"host":"foo.com","path":"/*",` +
+					`"weightedBackends":[{"serviceName":"app","servicePort":80,"weight":90},{"serviceName":"app-canary","servicePort":"http","weight":10}],` +
+					`"routes":[{"headers":[{"name":"x-beta","exact":"1"}],"serviceName":"app-beta","servicePort":80},` +
+					`{"queryParams":[{"name":"debug","present":true}],"serviceName":"app-beta","servicePort":80}]}]`,
+			}, "/*"),
+			wantRules: []HTTPRouteRule{
+				{
+					Matches:     []HTTPRouteMatch{{Path: &HTTPPathMatch{Type: "PathPrefix", Value: "/"}, Headers: []HTTPHeaderMatch{{Type: "Exact", Name: "x-beta", Value: "1"}}}},
+					BackendRefs: []HTTPBackendRef{{Name: "app-beta", Port: 80}},
+				},
+				{
+					Matches:     []HTTPRouteMatch{{Path: &HTTPPathMatch{Type: "PathPrefix", Value: "/"}}},
+					BackendRefs: []HTTPBackendRef{{Name: "app", Port: 80, Weight: int32Ptr(90)}, {Name: "app-canary", Port: 80, Weight: int32Ptr(10)}},
+				},
+			},
+			wantIssues: []string{"cdn", "routeActions"},
+		},
+		{
+			desc: "existing backend service",
+			ing: newTestIngress(map[string]string{
+				annotations.RouteActionsKey: `[{"host":"foo.com","path":"/fn/*","backendService":"serverless"}]`,
+			}, "/*", "/fn/*"),
+			wantRules: []HTTPRouteRule{
+				{Matches: []HTTPRouteMatch{{Path: &HTTPPathMatch{Type: "PathPrefix", Value: "/"}}}, BackendRefs: []HTTPBackendRef{{Name: "app", Port: 80}}},
+			},
+			wantIssues: []string{"cdn", "routeActions"},
+		},
+		{
+			desc: "user URL map",
+			ing:  newTestIngress(map[string]string{annotations.URLMapKey: "my-url-map"}, "/*"),
+			wantRules: []HTTPRouteRule{
+				{Matches: []HTTPRouteMatch{{Path: &HTTPPathMatch{Type: "PathPrefix", Value: "/"}}}, BackendRefs: []HTTPBackendRef{{Name: "app", Port: 80}}},
+			},
+			wantIssues: []string{"urlMap", "cdn"},
+		},
+		{
+			desc: "missing service",
+			ing: func() *v1beta1.Ingress {
+				ing := newTestIngress(nil, "/*")
+				ing.Spec.Rules[0].HTTP.Paths[0].Backend.ServiceName = "missing"
+				return ing
+			}(),
+			wantIssues: []string{"cdn", "backend"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			result := newTestConverter(t).Convert([]*v1beta1.Ingress{tc.ing})
+			var gotRules []HTTPRouteRule
+			for _, route := range result.HTTPRoutes {
+				if route.Name == "ing-default" {
+					continue
+				}
+				if !reflect.DeepEqual(route.Spec.Hostnames, []string{"foo.com"}) || route.Spec.ParentRefs[0].Name != "ing" {
+					t.Errorf("Got route %s with hostnames %v and parents %v, want foo.com and ing", route.Name, route.Spec.Hostnames, route.Spec.ParentRefs)
+				}
+				gotRules = append(gotRules, route.Spec.Rules...)
+			}
+			if !reflect.DeepEqual(gotRules, tc.wantRules) {
+				t.Errorf("Got rules %+v, want %+v", gotRules, tc.wantRules)
+			}
+			if got := issueFeatures(result.Issues); !reflect.DeepEqual(got, tc.wantIssues) {
+				t.Errorf("Got issues %v, want %v", result.Issues, tc.wantIssues)
+			}
+		})
+	}
+}
+
+func TestConvertUnsupportedClass(t *testing.T) {
+	ing := newTestIngress(map[string]string{annotations.IngressClassKey: "nginx"}, "/*")
+	result := newTestConverter(t).Convert([]*v1beta1.Ingress{ing})
+	if len(result.Gateways) != 0 || len(result.HTTPRoutes) != 0 {
+		t.Errorf("Got %d Gateways and %d HTTPRoutes, want none", len(result.Gateways), len(result.HTTPRoutes))
+	}
+	if got := issueFeatures(result.Issues); !reflect.DeepEqual(got, []string{"ingressClass"}) {
+		t.Errorf("Got issues %v, want ingressClass", result.Issues)
+	}
+}
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
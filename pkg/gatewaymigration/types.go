@@ -0,0 +1,224 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gatewaymigration
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The types below are the subset of the Gateway API and of the GKE Gateway
+// policies needed to express the features of an Ingress. They are only used
+// to generate manifests, so they carry no defaulting or validation.
+
+const (
+	// GatewayAPIVersion is the API version of the generated Gateway API resources.
+	GatewayAPIVersion = "gateway.networking.k8s.io/v1beta1"
+	// PolicyAPIVersion is the API version of the generated GKE policies.
+	PolicyAPIVersion = "networking.gke.io/v1"
+
+	// ExternalGatewayClass is the GatewayClass equivalent to the gce Ingress class.
+	ExternalGatewayClass = "gke-l7-global-external-managed"
+	// InternalGatewayClass is the GatewayClass equivalent to the gce-internal Ingress class.
+	InternalGatewayClass = "gke-l7-rilb"
+
+	// PreSharedCertsOption is the listener TLS option referencing pre-shared certificates.
+	PreSharedCertsOption = "networking.gke.io/pre-shared-certs"
+)
+
+// Gateway describes a load balancer frontend.
+type Gateway struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec GatewaySpec `json:"spec"`
+}
+
+// GatewaySpec is the spec of a Gateway.
+type GatewaySpec struct {
+	GatewayClassName string           `json:"gatewayClassName"`
+	Listeners        []Listener       `json:"listeners"`
+	Addresses        []GatewayAddress `json:"addresses,omitempty"`
+}
+
+// Listener is a port and protocol on which a Gateway accepts connections.
+type Listener struct {
+	Name     string            `json:"name"`
+	Port     int32             `json:"port"`
+	Protocol string            `json:"protocol"`
+	TLS      *GatewayTLSConfig `json:"tls,omitempty"`
+}
+
+// GatewayTLSConfig is the TLS configuration of a Listener.
+type GatewayTLSConfig struct {
+	Mode            string                  `json:"mode"`
+	CertificateRefs []SecretObjectReference `json:"certificateRefs,omitempty"`
+	Options         map[string]string       `json:"options,omitempty"`
+}
+
+// SecretObjectReference references a Secret holding a certificate.
+type SecretObjectReference struct {
+	Name string `json:"name"`
+}
+
+// GatewayAddress is an address requested for a Gateway.
+type GatewayAddress struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// HTTPRoute routes HTTP requests of a Gateway to backends.
+type HTTPRoute struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec HTTPRouteSpec `json:"spec"`
+}
+
+// HTTPRouteSpec is the spec of an HTTPRoute.
+type HTTPRouteSpec struct {
+	ParentRefs []ParentReference `json:"parentRefs"`
+	Hostnames  []string          `json:"hostnames,omitempty"`
+	Rules      []HTTPRouteRule   `json:"rules"`
+}
+
+// ParentReference references the Gateway of an HTTPRoute. An empty
+// namespace refers to the namespace of the HTTPRoute.
+type ParentReference struct {
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// HTTPRouteRule sends the requests matching any of its matches to its backends.
+type HTTPRouteRule struct {
+	Matches     []HTTPRouteMatch  `json:"matches,omitempty"`
+	Filters     []HTTPRouteFilter `json:"filters,omitempty"`
+	BackendRefs []HTTPBackendRef  `json:"backendRefs,omitempty"`
+}
+
+// HTTPRouteMatch matches requests on their path, headers and query parameters.
+type HTTPRouteMatch struct {
+	Path        *HTTPPathMatch        `json:"path,omitempty"`
+	Headers     []HTTPHeaderMatch     `json:"headers,omitempty"`
+	QueryParams []HTTPQueryParamMatch `json:"queryParams,omitempty"`
+}
+
+// HTTPPathMatch matches the path of a request.
+type HTTPPathMatch struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// HTTPHeaderMatch matches a header of a request.
+type HTTPHeaderMatch struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HTTPQueryParamMatch matches a query parameter of a request.
+type HTTPQueryParamMatch struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HTTPRouteFilter modifies requests matching a rule.
+type HTTPRouteFilter struct {
+	Type            string                     `json:"type"`
+	URLRewrite      *HTTPURLRewriteFilter      `json:"urlRewrite,omitempty"`
+	RequestRedirect *HTTPRequestRedirectFilter `json:"requestRedirect,omitempty"`
+}
+
+// HTTPURLRewriteFilter rewrites the host and path of a request.
+type HTTPURLRewriteFilter struct {
+	Hostname string            `json:"hostname,omitempty"`
+	Path     *HTTPPathModifier `json:"path,omitempty"`
+}
+
+// HTTPRequestRedirectFilter redirects a request.
+type HTTPRequestRedirectFilter struct {
+	Scheme     string            `json:"scheme,omitempty"`
+	Hostname   string            `json:"hostname,omitempty"`
+	Path       *HTTPPathModifier `json:"path,omitempty"`
+	StatusCode int               `json:"statusCode,omitempty"`
+}
+
+// HTTPPathModifier replaces the full path or the matched prefix of a request.
+type HTTPPathModifier struct {
+	Type               string `json:"type"`
+	ReplaceFullPath    string `json:"replaceFullPath,omitempty"`
+	ReplacePrefixMatch string `json:"replacePrefixMatch,omitempty"`
+}
+
+// HTTPBackendRef references a Service port receiving requests of a rule. An
+// empty kind refers to a Service and an empty namespace to the namespace of
+// the HTTPRoute.
+type HTTPBackendRef struct {
+	Kind      string `json:"kind,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Port      int32  `json:"port"`
+	Weight    *int32 `json:"weight,omitempty"`
+}
+
+// GCPBackendPolicy configures the backend services of a Service.
+type GCPBackendPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec GCPBackendPolicySpec `json:"spec"`
+}
+
+// GCPBackendPolicySpec is the spec of a GCPBackendPolicy.
+type GCPBackendPolicySpec struct {
+	Default   *GCPBackendPolicyConfig `json:"default,omitempty"`
+	TargetRef PolicyTargetReference   `json:"targetRef"`
+}
+
+// GCPBackendPolicyConfig holds the backend service settings of a GCPBackendPolicy.
+type GCPBackendPolicyConfig struct {
+	TimeoutSec         *int64                    `json:"timeoutSec,omitempty"`
+	ConnectionDraining *ConnectionDrainingConfig `json:"connectionDraining,omitempty"`
+	SessionAffinity    *SessionAffinityConfig    `json:"sessionAffinity,omitempty"`
+	SecurityPolicy     string                    `json:"securityPolicy,omitempty"`
+	IAP                *IAPConfig                `json:"iap,omitempty"`
+}
+
+// ConnectionDrainingConfig configures connection draining.
+type ConnectionDrainingConfig struct {
+	DrainingTimeoutSec int64 `json:"drainingTimeoutSec,omitempty"`
+}
+
+// SessionAffinityConfig configures session affinity.
+type SessionAffinityConfig struct {
+	Type         string `json:"type,omitempty"`
+	CookieTTLSec *int64 `json:"cookieTtlSec,omitempty"`
+}
+
+// IAPConfig configures Identity-Aware Proxy.
+type IAPConfig struct {
+	Enabled            bool                   `json:"enabled"`
+	ClientID           string                 `json:"clientID,omitempty"`
+	OAuth2ClientSecret *SecretObjectReference `json:"oauth2ClientSecret,omitempty"`
+}
+
+// PolicyTargetReference references the object a policy applies to.
+type PolicyTargetReference struct {
+	Group string `json:"group"`
+	Kind  string `json:"kind"`
+	Name  string `json:"name"`
+}
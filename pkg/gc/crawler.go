@@ -0,0 +1,382 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/annotations"
+	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/flags"
+	"k8s.io/ingress-gce/pkg/loadbalancers/features"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/ingress-gce/pkg/utils/namer"
+	"k8s.io/klog"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+const (
+	forwardingRules       = "forwardingRules"
+	targetHttpProxies     = "targetHttpProxies"
+	targetHttpsProxies    = "targetHttpsProxies"
+	urlMaps               = "urlMaps"
+	sslCertificates       = "sslCertificates"
+	backendServices       = "backendServices"
+	healthChecks          = "healthChecks"
+	networkEndpointGroups = "networkEndpointGroups"
+)
+
+// DesiredFunc returns the keys of the Ingresses whose load balancers are kept
+// and the names of the backend services they use. Nothing is deleted when it
+// returns an error, as the resources it failed to return would be.
+type DesiredFunc func() (ingressKeys []string, backendServices []string, err error)
+
+// Crawler periodically lists all the GCE resources of the load balancers of
+// the cluster, and deletes those no longer used by the Ingresses and
+// Services. It complements the garbage collection of the controllers, which
+// only deletes the resources of the objects they know about, and so misses
+// the resources leaked by crashes or by objects deleted while the controller
+// was down.
+//
+// A resource is used if it belongs to the load balancer of an Ingress, is
+// desired by the controller, is listed in the NEG status of a Service, or is
+// referenced by a used resource. Resources are only deleted when they were
+// already orphaned in the previous crawl, so that the resources created by a
+// sync in progress, and not referenced yet, are left alone.
+type Crawler struct {
+	cloud         *gce.Cloud
+	negCloud      negtypes.NetworkEndpointGroupCloud
+	namer         namer.IngressNamer
+	serviceLister cache.Indexer
+	desired       DesiredFunc
+	dryRun        bool
+
+	// orphans are the IDs of the resources found orphaned by the previous
+	// crawl.
+	orphans sets.String
+}
+
+// NewCrawler returns a Crawler of the resources of the cluster. With dryRun,
+// the orphaned resources are only reported.
+func NewCrawler(cloud *gce.Cloud, negCloud negtypes.NetworkEndpointGroupCloud, namer namer.IngressNamer, serviceLister cache.Indexer, desired DesiredFunc, dryRun bool) *Crawler {
+	return &Crawler{
+		cloud:         cloud,
+		negCloud:      negCloud,
+		namer:         namer,
+		serviceLister: serviceLister,
+		desired:       desired,
+		dryRun:        dryRun,
+		orphans:       sets.NewString(),
+	}
+}
+
+// Run crawls the resources every period once the informers synced, until
+// stopCh is closed.
+func (c *Crawler) Run(hasSynced cache.InformerSynced, period time.Duration, stopCh <-chan struct{}) {
+	if !cache.WaitForCacheSync(stopCh, hasSynced) {
+		return
+	}
+	wait.Until(func() {
+		if err := c.Crawl(); err != nil {
+			klog.Errorf("Failed to garbage collect orphaned GCE resources: %v", err)
+		}
+	}, period, stopCh)
+}
+
+// resource is a GCE resource of the cluster.
+type resource struct {
+	// kind is the collection of the resource in the GCE API, e.g.
+	// "backendServices".
+	kind    string
+	name    string
+	key     *meta.Key
+	version meta.Version
+	obj     interface{}
+}
+
+// id identifies the resource across crawls.
+func (r *resource) id() string {
+	return fmt.Sprintf("%s/%s", r.kind, r.key)
+}
+
+// Crawl lists the resources of the cluster, and deletes those found orphaned
+// by this crawl and the previous one.
+func (c *Crawler) Crawl() error {
+	resources, err := c.list()
+	if err != nil {
+		return err
+	}
+	used, err := c.roots(resources)
+	if err != nil {
+		return fmt.Errorf("error getting the desired resources: %v", err)
+	}
+	// The resources are listed in the order they reference each other, so
+	// one pass finds all the used resources.
+	for _, r := range resources {
+		if used.Has(ref(r.kind, r.name)) {
+			used.Insert(references(r.obj)...)
+		}
+	}
+
+	var errs []error
+	orphans := sets.NewString()
+	for _, r := range resources {
+		if used.Has(ref(r.kind, r.name)) {
+			continue
+		}
+		orphans.Insert(r.id())
+		if c.dryRun {
+			klog.Warningf("Found orphaned GCE resource %s", r.id())
+			continue
+		}
+		if !c.orphans.Has(r.id()) {
+			klog.V(2).Infof("Found orphaned GCE resource %s, deleting it on the next crawl", r.id())
+			continue
+		}
+		klog.V(2).Infof("Deleting orphaned GCE resource %s", r.id())
+		if err := c.delete(r); err != nil {
+			// Resources still referenced by other resources are retried
+			// on the next crawl, once these are deleted.
+			errs = append(errs, fmt.Errorf("failed to delete %s: %v", r.id(), err))
+		}
+	}
+	c.orphans = orphans
+	if len(errs) > 0 {
+		return utils.JoinErrs(errs)
+	}
+	return nil
+}
+
+// roots returns the references of the resources used by the Ingresses and
+// Services of the cluster, among the listed resources.
+func (c *Crawler) roots(resources []*resource) (sets.String, error) {
+	used := sets.NewString()
+	ingressKeys, backends, err := c.desired()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range ingressKeys {
+		lbName := c.namer.LoadBalancer(key)
+		used.Insert(
+			ref(forwardingRules, c.namer.ForwardingRule(lbName, namer.HTTPProtocol)),
+			ref(forwardingRules, c.namer.ForwardingRule(lbName, namer.HTTPSProtocol)),
+			ref(targetHttpProxies, c.namer.TargetProxy(lbName, namer.HTTPProtocol)),
+			ref(targetHttpsProxies, c.namer.TargetProxy(lbName, namer.HTTPSProtocol)),
+			ref(urlMaps, c.namer.UrlMap(lbName)),
+		)
+		// The names of the additional https forwarding rules depend on
+		// the ports of the FrontendConfig of the Ingress.
+		for _, r := range resources {
+			if r.kind == forwardingRules && c.namer.IsHTTPSForwardingRuleForPort(lbName, r.name) {
+				used.Insert(ref(r.kind, r.name))
+			}
+		}
+	}
+	for _, name := range backends {
+		used.Insert(ref(backendServices, name))
+	}
+	for _, obj := range c.serviceLister.List() {
+		svc := obj.(*apiv1.Service)
+		status, ok := svc.Annotations[annotations.NEGStatusKey]
+		if !ok {
+			continue
+		}
+		negStatus, err := annotations.ParseNegStatus(status)
+		if err != nil {
+			klog.Warningf("Failed to parse NEG status of service %s/%s: %v", svc.Namespace, svc.Name, err)
+			continue
+		}
+		for _, name := range negStatus.NetworkEndpointGroups {
+			used.Insert(ref(networkEndpointGroups, name))
+		}
+	}
+	return used, nil
+}
+
+// list lists the resources of the cluster, in the order they reference each
+// other.
+func (c *Crawler) list() ([]*resource, error) {
+	var resources []*resource
+	scopes := []meta.KeyType{meta.Global}
+	if flags.F.EnableL7Ilb {
+		scopes = append(scopes, meta.Regional)
+	}
+	for _, scope := range scopes {
+		versions := features.GAResourceVersions
+		if scope == meta.Regional {
+			versions = features.L7ILBVersions()
+		}
+		key, err := composite.CreateKey(c.cloud, "", scope)
+		if err != nil {
+			return nil, err
+		}
+		for _, kind := range []string{forwardingRules, targetHttpsProxies, targetHttpProxies, urlMaps, sslCertificates, backendServices, healthChecks} {
+			objs, version, err := c.listKind(kind, key, versions)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list %s %s: %v", scope, kind, err)
+			}
+			for name, obj := range objs {
+				if !c.namer.NameBelongsToCluster(name) {
+					continue
+				}
+				rKey := *key
+				rKey.Name = name
+				resources = append(resources, &resource{kind: kind, name: name, key: &rKey, version: version, obj: obj})
+			}
+		}
+	}
+
+	negs, err := c.negCloud.AggregatedListNetworkEndpointGroup()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", networkEndpointGroups, err)
+	}
+	for zone, list := range negs {
+		for _, neg := range list {
+			if !c.namer.IsNEG(neg.Name) {
+				continue
+			}
+			resources = append(resources, &resource{kind: networkEndpointGroups, name: neg.Name, key: meta.ZonalKey(neg.Name, zone), obj: neg})
+		}
+	}
+	return resources, nil
+}
+
+// listKind lists the resources of a kind by name, along with the API version
+// they were listed with.
+func (c *Crawler) listKind(kind string, key *meta.Key, versions *features.ResourceVersions) (map[string]interface{}, meta.Version, error) {
+	objs := map[string]interface{}{}
+	switch kind {
+	case forwardingRules:
+		list, err := composite.ListForwardingRules(c.cloud, key, versions.ForwardingRule)
+		for _, obj := range list {
+			objs[obj.Name] = obj
+		}
+		return objs, versions.ForwardingRule, err
+	case targetHttpProxies:
+		list, err := composite.ListTargetHttpProxies(c.cloud, key, versions.TargetHttpProxy)
+		for _, obj := range list {
+			objs[obj.Name] = obj
+		}
+		return objs, versions.TargetHttpProxy, err
+	case targetHttpsProxies:
+		list, err := composite.ListTargetHttpsProxies(c.cloud, key, versions.TargetHttpsProxy)
+		for _, obj := range list {
+			objs[obj.Name] = obj
+		}
+		return objs, versions.TargetHttpsProxy, err
+	case urlMaps:
+		list, err := composite.ListUrlMaps(c.cloud, key, versions.UrlMap)
+		for _, obj := range list {
+			objs[obj.Name] = obj
+		}
+		return objs, versions.UrlMap, err
+	case sslCertificates:
+		list, err := composite.ListSslCertificates(c.cloud, key, versions.SslCertificate)
+		for _, obj := range list {
+			objs[obj.Name] = obj
+		}
+		return objs, versions.SslCertificate, err
+	case backendServices:
+		list, err := composite.ListBackendServices(c.cloud, key, versions.BackendService)
+		for _, obj := range list {
+			objs[obj.Name] = obj
+		}
+		return objs, versions.BackendService, err
+	case healthChecks:
+		list, err := composite.ListHealthChecks(c.cloud, key, versions.HealthCheck)
+		for _, obj := range list {
+			objs[obj.Name] = obj
+		}
+		return objs, versions.HealthCheck, err
+	}
+	return nil, "", fmt.Errorf("unknown resource kind %q", kind)
+}
+
+// delete deletes the resource, ignoring resources already deleted.
+func (c *Crawler) delete(r *resource) error {
+	var err error
+	switch r.kind {
+	case forwardingRules:
+		err = composite.DeleteForwardingRule(c.cloud, r.key, r.version)
+	case targetHttpProxies:
+		err = composite.DeleteTargetHttpProxy(c.cloud, r.key, r.version)
+	case targetHttpsProxies:
+		err = composite.DeleteTargetHttpsProxy(c.cloud, r.key, r.version)
+	case urlMaps:
+		err = composite.DeleteUrlMap(c.cloud, r.key, r.version)
+	case sslCertificates:
+		err = composite.DeleteSslCertificate(c.cloud, r.key, r.version)
+	case backendServices:
+		err = composite.DeleteBackendService(c.cloud, r.key, r.version)
+	case healthChecks:
+		err = composite.DeleteHealthCheck(c.cloud, r.key, r.version)
+	case networkEndpointGroups:
+		err = c.negCloud.DeleteNetworkEndpointGroup(r.name, r.key.Zone)
+	default:
+		err = fmt.Errorf("unknown resource kind %q", r.kind)
+	}
+	return utils.IgnoreHTTPNotFound(err)
+}
+
+// ref returns the reference of a resource, the last two segments of its URL.
+func ref(kind, name string) string {
+	return kind + "/" + name
+}
+
+// references returns the references of the resources linked by the URLs in
+// the fields of obj, at any depth.
+func references(obj interface{}) []string {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		klog.Errorf("Failed to marshal %T: %v", obj, err)
+		return nil
+	}
+	var fields interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		klog.Errorf("Failed to unmarshal %T: %v", obj, err)
+		return nil
+	}
+	var refs []string
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case string:
+			if parts := strings.Split(v, "/"); len(parts) >= 2 {
+				refs = append(refs, ref(parts[len(parts)-2], parts[len(parts)-1]))
+			}
+		case []interface{}:
+			for _, e := range v {
+				walk(e)
+			}
+		case map[string]interface{}:
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+	walk(fields)
+	return refs
+}
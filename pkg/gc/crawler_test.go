@@ -0,0 +1,245 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gc
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"google.golang.org/api/compute/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/annotations"
+	"k8s.io/ingress-gce/pkg/composite"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/ingress-gce/pkg/utils/namer"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+// createLoadBalancer creates the forwarding rules, target proxy, URL map,
+// backend service and health check of the load balancer of an Ingress, and
+// returns the name of the backend service.
+func createLoadBalancer(t *testing.T, cloud *gce.Cloud, n *namer.Namer, ingKey string, nodePort int64) string {
+	t.Helper()
+	lbName := n.LoadBalancer(ingKey)
+	fwName := n.ForwardingRule(lbName, namer.HTTPProtocol)
+	tpName := n.TargetProxy(lbName, namer.HTTPProtocol)
+	umName := n.UrlMap(lbName)
+	beName := n.IGBackend(nodePort)
+
+	if err := composite.CreateHealthCheck(cloud, meta.GlobalKey(beName), &composite.HealthCheck{Name: beName}); err != nil {
+		t.Fatalf("CreateHealthCheck(%s) = %v", beName, err)
+	}
+	if err := composite.CreateBackendService(cloud, meta.GlobalKey(beName), &composite.BackendService{Name: beName, HealthChecks: []string{"global/healthChecks/" + beName}}); err != nil {
+		t.Fatalf("CreateBackendService(%s) = %v", beName, err)
+	}
+	if err := composite.CreateUrlMap(cloud, meta.GlobalKey(umName), &composite.UrlMap{Name: umName, DefaultService: "global/backendServices/" + beName}); err != nil {
+		t.Fatalf("CreateUrlMap(%s) = %v", umName, err)
+	}
+	if err := composite.CreateTargetHttpProxy(cloud, meta.GlobalKey(tpName), &composite.TargetHttpProxy{Name: tpName, UrlMap: "global/urlMaps/" + umName}); err != nil {
+		t.Fatalf("CreateTargetHttpProxy(%s) = %v", tpName, err)
+	}
+	for _, name := range []string{fwName, n.HTTPSForwardingRuleForPort(lbName, 8443)} {
+		if err := composite.CreateForwardingRule(cloud, meta.GlobalKey(name), &composite.ForwardingRule{Name: name, Target: "global/targetHttpProxies/" + tpName}); err != nil {
+			t.Fatalf("CreateForwardingRule(%s) = %v", name, err)
+		}
+	}
+	return beName
+}
+
+func TestCrawl(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		dryRun        bool
+		expectDeleted bool
+	}{
+		{
+			desc:          "orphans are deleted by the second crawl",
+			expectDeleted: true,
+		},
+		{
+			desc:   "orphans are only reported in dry run",
+			dryRun: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			cloud := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+			negCloud := negtypes.NewFakeNetworkEndpointGroupCloud("test-subnetwork", "test-network")
+			n := namer.NewNamer("uid1", "fw1")
+
+			liveBackend := createLoadBalancer(t, cloud, n, "ns/live", 30001)
+			orphanBackend := createLoadBalancer(t, cloud, n, "ns/gone", 30002)
+			foreignBackend := "foreign-backend"
+			if err := composite.CreateBackendService(cloud, meta.GlobalKey(foreignBackend), &composite.BackendService{Name: foreignBackend}); err != nil {
+				t.Fatalf("CreateBackendService(%s) = %v", foreignBackend, err)
+			}
+
+			liveNEG := n.NEG("ns", "live", 80)
+			orphanNEG := n.NEG("ns", "gone", 80)
+			for _, name := range []string{liveNEG, orphanNEG} {
+				if err := negCloud.CreateNetworkEndpointGroup(&compute.NetworkEndpointGroup{Name: name}, negtypes.TestZone1); err != nil {
+					t.Fatalf("CreateNetworkEndpointGroup(%s) = %v", name, err)
+				}
+			}
+			status, err := json.Marshal(annotations.NegStatus{
+				NetworkEndpointGroups: annotations.PortNegMap{"80": liveNEG},
+				Zones:                 []string{negtypes.TestZone1},
+			})
+			if err != nil {
+				t.Fatalf("Failed to marshal NEG status: %v", err)
+			}
+			serviceLister := cache.NewIndexer(cache.MetaNamespaceKeyFunc, utils.NewNamespaceIndexer())
+			serviceLister.Add(&apiv1.Service{ObjectMeta: metav1.ObjectMeta{
+				Name:        "live",
+				Namespace:   "ns",
+				Annotations: map[string]string{annotations.NEGStatusKey: string(status)},
+			}})
+
+			desired := func() ([]string, []string, error) { return []string{"ns/live"}, nil, nil }
+			crawler := NewCrawler(cloud, negCloud, n, serviceLister, desired, tc.dryRun)
+			for i := 0; i < 2; i++ {
+				if err := crawler.Crawl(); err != nil {
+					t.Fatalf("Crawl() = %v", err)
+				}
+				// Nothing is deleted by the first crawl.
+				deleted := tc.expectDeleted && i == 1
+
+				liveLB := n.LoadBalancer("ns/live")
+				orphanLB := n.LoadBalancer("ns/gone")
+				for _, check := range []struct {
+					desc   string
+					get    func() error
+					exists bool
+				}{
+					{"live forwarding rule", getForwardingRule(cloud, n.ForwardingRule(liveLB, namer.HTTPProtocol)), true},
+					{"live additional forwarding rule", getForwardingRule(cloud, n.HTTPSForwardingRuleForPort(liveLB, 8443)), true},
+					{"live URL map", getUrlMap(cloud, n.UrlMap(liveLB)), true},
+					{"live backend service", getBackendService(cloud, liveBackend), true},
+					{"live health check", getHealthCheck(cloud, liveBackend), true},
+					{"foreign backend service", getBackendService(cloud, foreignBackend), true},
+					{"live NEG", getNEG(negCloud, liveNEG), true},
+					{"orphaned forwarding rule", getForwardingRule(cloud, n.ForwardingRule(orphanLB, namer.HTTPProtocol)), !deleted},
+					{"orphaned additional forwarding rule", getForwardingRule(cloud, n.HTTPSForwardingRuleForPort(orphanLB, 8443)), !deleted},
+					{"orphaned target proxy", getTargetHttpProxy(cloud, n.TargetProxy(orphanLB, namer.HTTPProtocol)), !deleted},
+					{"orphaned URL map", getUrlMap(cloud, n.UrlMap(orphanLB)), !deleted},
+					{"orphaned backend service", getBackendService(cloud, orphanBackend), !deleted},
+					{"orphaned health check", getHealthCheck(cloud, orphanBackend), !deleted},
+					{"orphaned NEG", getNEG(negCloud, orphanNEG), !deleted},
+				} {
+					if err := check.get(); (err == nil) != check.exists {
+						t.Errorf("After crawl %d, %s exists = %v, want %v", i+1, check.desc, err == nil, check.exists)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCrawlDesiredError(t *testing.T) {
+	cloud := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	negCloud := negtypes.NewFakeNetworkEndpointGroupCloud("test-subnetwork", "test-network")
+	n := namer.NewNamer("uid1", "fw1")
+	backend := createLoadBalancer(t, cloud, n, "ns/unknown", 30001)
+	serviceLister := cache.NewIndexer(cache.MetaNamespaceKeyFunc, utils.NewNamespaceIndexer())
+
+	desiredErr := fmt.Errorf("informer not synced")
+	desired := func() ([]string, []string, error) { return nil, nil, desiredErr }
+	crawler := NewCrawler(cloud, negCloud, n, serviceLister, desired, false)
+	for i := 0; i < 2; i++ {
+		if err := crawler.Crawl(); err == nil {
+			t.Fatalf("Crawl() = nil, want an error")
+		}
+	}
+	// Nothing is deleted while the desired resources are unknown.
+	lbName := n.LoadBalancer("ns/unknown")
+	for desc, get := range map[string]func() error{
+		"forwarding rule": getForwardingRule(cloud, n.ForwardingRule(lbName, namer.HTTPProtocol)),
+		"URL map":         getUrlMap(cloud, n.UrlMap(lbName)),
+		"backend service": getBackendService(cloud, backend),
+	} {
+		if err := get(); err != nil {
+			t.Errorf("Get %s = %v, want it to exist", desc, err)
+		}
+	}
+}
+
+func getForwardingRule(cloud *gce.Cloud, name string) func() error {
+	return func() error {
+		_, err := composite.GetForwardingRule(cloud, meta.GlobalKey(name), meta.VersionGA)
+		return err
+	}
+}
+
+func getTargetHttpProxy(cloud *gce.Cloud, name string) func() error {
+	return func() error {
+		_, err := composite.GetTargetHttpProxy(cloud, meta.GlobalKey(name), meta.VersionGA)
+		return err
+	}
+}
+
+func getUrlMap(cloud *gce.Cloud, name string) func() error {
+	return func() error {
+		_, err := composite.GetUrlMap(cloud, meta.GlobalKey(name), meta.VersionGA)
+		return err
+	}
+}
+
+func getBackendService(cloud *gce.Cloud, name string) func() error {
+	return func() error {
+		_, err := composite.GetBackendService(cloud, meta.GlobalKey(name), meta.VersionGA)
+		return err
+	}
+}
+
+func getHealthCheck(cloud *gce.Cloud, name string) func() error {
+	return func() error {
+		_, err := composite.GetHealthCheck(cloud, meta.GlobalKey(name), meta.VersionGA)
+		return err
+	}
+}
+
+func getNEG(negCloud negtypes.NetworkEndpointGroupCloud, name string) func() error {
+	return func() error {
+		_, err := negCloud.GetNetworkEndpointGroup(name, negtypes.TestZone1)
+		return err
+	}
+}
+
+func TestReferences(t *testing.T) {
+	bs := &composite.BackendService{
+		Name:         "bs",
+		SelfLink:     "https://www.googleapis.com/compute/v1/projects/p/global/backendServices/bs",
+		HealthChecks: []string{"https://www.googleapis.com/compute/v1/projects/p/global/healthChecks/hc"},
+		Backends: []*composite.Backend{
+			{Group: "https://www.googleapis.com/compute/v1/projects/p/zones/z/networkEndpointGroups/neg"},
+		},
+		Description: "plain text",
+	}
+	got := sets.NewString(references(bs)...)
+	for _, want := range []string{"backendServices/bs", "healthChecks/hc", "networkEndpointGroups/neg"} {
+		if !got.Has(want) {
+			t.Errorf("references() = %v, want %q", got.List(), want)
+		}
+	}
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package healthchecks
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -28,6 +30,7 @@ import (
 	"google.golang.org/api/compute/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/ingress-gce/pkg/annotations"
+	backendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/backendconfig/v1beta1"
 	"k8s.io/ingress-gce/pkg/composite"
 	"k8s.io/ingress-gce/pkg/loadbalancers/features"
 	"k8s.io/ingress-gce/pkg/utils"
@@ -65,6 +68,9 @@ const (
 	// backends, the port or named port specified in the Backend Service is
 	// used for health checking.
 	UseServingPortSpecification = "USE_SERVING_PORT"
+	// USE_FIXED_PORT: The port number in the port field is used for health
+	// checking.
+	UseFixedPortSpecification = "USE_FIXED_PORT"
 
 	// TODO: revendor the GCE API go client so that this error will not be hit.
 	newHealthCheckErrorMessageTemplate = "the %v health check configuration on the existing health check %v is nil. " +
@@ -79,7 +85,7 @@ type HealthChecks struct {
 	path string
 	// defaultBackend is the default health check path for the default backend.
 	defaultBackendPath string
-	namer              *namer_util.Namer
+	namer              namer_util.IngressNamer
 	// This is a workaround which allows us to not have to maintain
 	// a separate health checker for the default backend.
 	defaultBackendSvc types.NamespacedName
@@ -88,7 +94,7 @@ type HealthChecks struct {
 // NewHealthChecker creates a new health checker.
 // cloud: the cloud object implementing SingleHealthCheck.
 // defaultHealthCheckPath: is the HTTP path to use for health checks.
-func NewHealthChecker(cloud HealthCheckProvider, healthCheckPath string, defaultBackendHealthCheckPath string, namer *namer_util.Namer, defaultBackendSvc types.NamespacedName) HealthChecker {
+func NewHealthChecker(cloud HealthCheckProvider, healthCheckPath string, defaultBackendHealthCheckPath string, namer namer_util.IngressNamer, defaultBackendSvc types.NamespacedName) HealthChecker {
 	return &HealthChecks{cloud, healthCheckPath, defaultBackendHealthCheckPath, namer, defaultBackendSvc}
 }
 
@@ -96,11 +102,11 @@ func NewHealthChecker(cloud HealthCheckProvider, healthCheckPath string, default
 func (h *HealthChecks) New(sp utils.ServicePort) *HealthCheck {
 	var hc *HealthCheck
 	if sp.NEGEnabled && !sp.L7ILBEnabled {
-		hc = DefaultNEGHealthCheck(sp.Protocol)
+		hc = DefaultNEGHealthCheck(sp.BackendProtocol())
 	} else if sp.L7ILBEnabled {
-		hc = defaultILBHealthCheck(sp.Protocol)
+		hc = defaultILBHealthCheck(sp.BackendProtocol())
 	} else {
-		hc = DefaultHealthCheck(sp.NodePort, sp.Protocol)
+		hc = DefaultHealthCheck(sp.NodePort, sp.BackendProtocol())
 	}
 	// port is the key for retrieving existing health-check
 	// TODO: rename backend-service and health-check to not use port as key
@@ -110,6 +116,41 @@ func (h *HealthChecks) New(sp utils.ServicePort) *HealthCheck {
 	return hc
 }
 
+// Share implements HealthChecker.
+func (h *HealthChecks) Share(hc *HealthCheck) {
+	if hc.forILB {
+		return
+	}
+	hc.Name = h.namer.SharedHealthCheck(hc.SettingsHash())
+}
+
+// GCShared implements HealthChecker.
+func (h *HealthChecks) GCShared(links []string) error {
+	refs := map[string]int{}
+	for _, link := range links {
+		name, err := utils.KeyName(link)
+		if err != nil {
+			return err
+		}
+		refs[name]++
+	}
+
+	hcs, err := h.cloud.ListHealthChecks()
+	if err != nil {
+		return err
+	}
+	for _, hc := range hcs {
+		if !h.namer.IsSharedHealthCheck(hc.Name) || refs[hc.Name] > 0 {
+			continue
+		}
+		klog.V(2).Infof("Deleting shared health check %v, it is no longer referenced", hc.Name)
+		if err := utils.IgnoreHTTPNotFound(h.Delete(hc.Name, meta.Global)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Sync retrieves a health check based on port, checks type and settings and updates/creates if necessary.
 // Sync is only called by the backends.Add func - it's not a pool like other resources.
 func (h *HealthChecks) Sync(hc *HealthCheck) (string, error) {
@@ -127,6 +168,7 @@ func (h *HealthChecks) Sync(hc *HealthCheck) (string, error) {
 			return "", err
 		}
 
+		hc.reconcileManagedFields(nil)
 		if err = h.create(hc); err != nil {
 			return "", err
 		}
@@ -135,6 +177,7 @@ func (h *HealthChecks) Sync(hc *HealthCheck) (string, error) {
 	}
 
 	if needToUpdate(existingHC, hc) {
+		hc.reconcileManagedFields(existingHC)
 		err = h.update(existingHC, hc)
 		return existingHC.SelfLink, err
 	}
@@ -155,7 +198,7 @@ func (h *HealthChecks) Sync(hc *HealthCheck) (string, error) {
 func (h *HealthChecks) createILB(hc *HealthCheck) error {
 	cloud := h.cloud.(*gce.Cloud)
 
-	if len(hc.PortSpecification) > 0 {
+	if len(hc.PortSpecification) > 0 && hc.PortSpecification != UseFixedPortSpecification {
 		hc.Port = 0
 	}
 	hc.merge()
@@ -262,16 +305,25 @@ func (h *HealthChecks) update(oldHC, newHC *HealthCheck) error {
 func mergeHealthcheck(oldHC, newHC *HealthCheck) *HealthCheck {
 	portSpec := newHC.PortSpecification
 	port := newHC.Port
+	requestPath, host := newHC.RequestPath, newHC.Host
 	newHC.HTTPHealthCheck = oldHC.HTTPHealthCheck
+	if newHC.ForProbe {
+		newHC.RequestPath, newHC.Host = requestPath, host
+	}
 
 	// Cannot specify both portSpecification and port field.
 	if newHC.ForNEG {
 		newHC.HTTPHealthCheck.Port = 0
+		if portSpec == UseFixedPortSpecification {
+			newHC.HTTPHealthCheck.Port = port
+		}
 		newHC.PortSpecification = portSpec
 	} else {
 		newHC.PortSpecification = ""
 		newHC.Port = port
 	}
+	// Settings from the BackendConfig always win over the existing ones.
+	newHC.applyBackendConfig()
 	return newHC
 }
 
@@ -461,9 +513,18 @@ type HealthCheck struct {
 	computealpha.HealthCheck
 	//compositeHealthCheck composite.HealthCheck
 	ForNEG bool
+	// ForProbe is set when the HTTP settings of a NEG health check were
+	// derived from the readiness probe of the serving pods with
+	// --enable-neg-probe-health-checks. Unlike defaults, these are reconciled
+	// on the existing health check so that probe changes are picked up.
+	ForProbe bool
 	// forILB designates whether the health check is for an ILB
 	// This means that the HC should be alpha + regional
 	forILB bool
+	// backendConfig holds the health check parameters specified by the user
+	// in a BackendConfig. These are authoritative and take precedence over
+	// both inferred values and values on the existing health check.
+	backendConfig *backendconfigv1beta1.HealthCheckConfig
 }
 
 // NewHealthCheck creates a HealthCheck which abstracts nested structs away
@@ -504,6 +565,64 @@ func NewHealthCheck(hc *computealpha.HealthCheck) (*HealthCheck, error) {
 	return v, err
 }
 
+// UpdateFromBackendConfig overrides the health check parameters with the ones
+// specified in the BackendConfig. It must be called after any inferred settings
+// (e.g. from a readiness probe) have been applied.
+func (hc *HealthCheck) UpdateFromBackendConfig(c *backendconfigv1beta1.HealthCheckConfig) {
+	if c == nil {
+		return
+	}
+	hc.backendConfig = c
+	hc.applyBackendConfig()
+}
+
+func (hc *HealthCheck) applyBackendConfig() {
+	c := hc.backendConfig
+	if c == nil {
+		return
+	}
+	if c.CheckIntervalSec != nil {
+		hc.CheckIntervalSec = *c.CheckIntervalSec
+	}
+	if c.TimeoutSec != nil {
+		hc.TimeoutSec = *c.TimeoutSec
+	}
+	if c.HealthyThreshold != nil {
+		hc.HealthyThreshold = *c.HealthyThreshold
+	}
+	if c.UnhealthyThreshold != nil {
+		hc.UnhealthyThreshold = *c.UnhealthyThreshold
+	}
+	if c.Type != nil {
+		hc.Type = *c.Type
+	}
+	if c.RequestPath != nil {
+		hc.RequestPath = *c.RequestPath
+	}
+	if c.Port != nil {
+		hc.Port = *c.Port
+		// A fixed port cannot be combined with USE_SERVING_PORT.
+		if hc.PortSpecification != "" {
+			hc.PortSpecification = UseFixedPortSpecification
+		}
+	}
+	hc.Description = "Kubernetes L7 health check generated with BackendConfig settings."
+}
+
+// SettingsHash returns a hash of the settings of the health check, which
+// identifies the health checks that can be shared by backend services.
+func (hc *HealthCheck) SettingsHash() string {
+	settings := *hc
+	settings.Name = ""
+	settings.Description = ""
+	data, err := json.Marshal(settings.ToAlphaComputeHealthCheck())
+	if err != nil {
+		klog.Errorf("Failed to marshal health check %v: %v", hc.Name, err)
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])[:16]
+}
+
 // Protocol returns the type cased to AppProtocol
 func (hc *HealthCheck) Protocol() annotations.AppProtocol {
 	return annotations.AppProtocol(hc.Type)
@@ -518,7 +637,7 @@ func (hc *HealthCheck) ToComputeHealthCheck() (*compute.HealthCheck, error) {
 // ToBetaComputeHealthCheck returns a valid computebeta.HealthCheck object
 func (hc *HealthCheck) ToBetaComputeHealthCheck() (*computebeta.HealthCheck, error) {
 	// Cannot specify both portSpecification and port field.
-	if len(hc.PortSpecification) > 0 {
+	if len(hc.PortSpecification) > 0 && hc.PortSpecification != UseFixedPortSpecification {
 		hc.Port = 0
 	}
 	hc.merge()
@@ -528,7 +647,7 @@ func (hc *HealthCheck) ToBetaComputeHealthCheck() (*computebeta.HealthCheck, err
 // ToAlphaComputeHealthCheck returns a valid computealpha.HealthCheck object
 func (hc *HealthCheck) ToAlphaComputeHealthCheck() *computealpha.HealthCheck {
 	// Cannot specify both portSpecification and port field.
-	if len(hc.PortSpecification) > 0 {
+	if len(hc.PortSpecification) > 0 && hc.PortSpecification != UseFixedPortSpecification {
 		hc.Port = 0
 	}
 	hc.merge()
@@ -580,9 +699,48 @@ func needToUpdate(old, new *HealthCheck) bool {
 		klog.V(2).Infof("Updating health check %v because it has port specification %q but need %q", old.Name, old.PortSpecification, new.PortSpecification)
 		return true
 	}
+
+	if new.PortSpecification == UseFixedPortSpecification && old.Port != new.Port {
+		klog.V(2).Infof("Updating health check %v because it has port %d but need %d", old.Name, old.Port, new.Port)
+		return true
+	}
+
+	if new.ForProbe && (old.RequestPath != new.RequestPath || old.Host != new.Host || old.Port != new.Port) {
+		klog.V(2).Infof("Updating health check %v because the readiness probe changed", old.Name)
+		return true
+	}
+
+	if field, ok := backendConfigDiff(old, new); ok {
+		klog.V(2).Infof("Updating health check %v because its %v differs from the BackendConfig", old.Name, field)
+		return true
+	}
 	return false
 }
 
+// backendConfigDiff returns the first field specified in the BackendConfig of
+// new which differs on old.
+func backendConfigDiff(old, new *HealthCheck) (string, bool) {
+	c := new.backendConfig
+	if c == nil {
+		return "", false
+	}
+	switch {
+	case c.CheckIntervalSec != nil && old.CheckIntervalSec != *c.CheckIntervalSec:
+		return "checkIntervalSec", true
+	case c.TimeoutSec != nil && old.TimeoutSec != *c.TimeoutSec:
+		return "timeoutSec", true
+	case c.HealthyThreshold != nil && old.HealthyThreshold != *c.HealthyThreshold:
+		return "healthyThreshold", true
+	case c.UnhealthyThreshold != nil && old.UnhealthyThreshold != *c.UnhealthyThreshold:
+		return "unhealthyThreshold", true
+	case c.RequestPath != nil && old.RequestPath != *c.RequestPath:
+		return "requestPath", true
+	case c.Port != nil && old.Port != *c.Port:
+		return "port", true
+	}
+	return "", false
+}
+
 // toV1HealthCheck converts alpha health check to v1 health check.
 // WARNING: alpha health check has a additional PORT_SPECIFICATION field.
 // This field will be omitted after conversion.
@@ -26,6 +26,7 @@ import (
 	computealpha "google.golang.org/api/compute/v0.alpha"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/ingress-gce/pkg/annotations"
+	backendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/backendconfig/v1beta1"
 	"k8s.io/ingress-gce/pkg/utils"
 	namer_util "k8s.io/ingress-gce/pkg/utils/namer"
 	"k8s.io/legacy-cloud-providers/gce"
@@ -320,6 +321,253 @@ func TestHealthCheckUpdate(t *testing.T) {
 	}
 }
 
+func TestHealthCheckFromBackendConfig(t *testing.T) {
+	i64 := func(v int64) *int64 { return &v }
+	str := func(v string) *string { return &v }
+
+	config := &backendconfigv1beta1.HealthCheckConfig{
+		CheckIntervalSec:   i64(7),
+		TimeoutSec:         i64(3),
+		HealthyThreshold:   i64(2),
+		UnhealthyThreshold: i64(4),
+		RequestPath:        str("/custom"),
+		Port:               i64(8080),
+	}
+
+	testCases := []struct {
+		desc     string
+		sp       utils.ServicePort
+		version  meta.Version
+		portSpec string
+	}{
+		{
+			desc:    "instance group",
+			sp:      utils.ServicePort{NodePort: 3000, Protocol: annotations.ProtocolHTTP},
+			version: meta.VersionGA,
+		},
+		{
+			desc:     "network endpoint group",
+			sp:       utils.ServicePort{NodePort: 3001, Protocol: annotations.ProtocolHTTP, NEGEnabled: true},
+			version:  meta.VersionBeta,
+			portSpec: UseFixedPortSpecification,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+			(fakeGCE.Compute().(*cloud.MockGCE)).MockHealthChecks.UpdateHook = mock.UpdateHealthCheckHook
+			(fakeGCE.Compute().(*cloud.MockGCE)).MockBetaHealthChecks.UpdateHook = mock.UpdateBetaHealthCheckHook
+			healthChecks := NewHealthChecker(fakeGCE, "/", "/healthz", namer, defaultBackendSvc)
+
+			// Create the health check with inferred settings only.
+			if _, err := healthChecks.Sync(healthChecks.New(tc.sp)); err != nil {
+				t.Fatalf("Sync() = %v, want nil", err)
+			}
+
+			// Every sync re-infers the settings; the BackendConfig must win
+			// each time and never be reverted.
+			for i := 0; i < 2; i++ {
+				hc := healthChecks.New(tc.sp)
+				hc.UpdateFromBackendConfig(config)
+				if _, err := healthChecks.Sync(hc); err != nil {
+					t.Fatalf("Sync() = %v, want nil", err)
+				}
+
+				got, err := healthChecks.Get(hc.Name, tc.version, meta.Global)
+				if err != nil {
+					t.Fatalf("Get() = %v, want nil", err)
+				}
+				if got.CheckIntervalSec != 7 || got.TimeoutSec != 3 || got.HealthyThreshold != 2 || got.UnhealthyThreshold != 4 {
+					t.Errorf("got interval/timeout/thresholds %d/%d/%d/%d, want 7/3/2/4", got.CheckIntervalSec, got.TimeoutSec, got.HealthyThreshold, got.UnhealthyThreshold)
+				}
+				if got.RequestPath != "/custom" {
+					t.Errorf("got RequestPath %q, want %q", got.RequestPath, "/custom")
+				}
+				if got.Port != 8080 || got.PortSpecification != tc.portSpec {
+					t.Errorf("got Port %d and PortSpecification %q, want 8080 and %q", got.Port, got.PortSpecification, tc.portSpec)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthCheckProbeChange(t *testing.T) {
+	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	(fakeGCE.Compute().(*cloud.MockGCE)).MockBetaHealthChecks.UpdateHook = mock.UpdateBetaHealthCheckHook
+	healthChecks := NewHealthChecker(fakeGCE, "/", "/healthz", namer, defaultBackendSvc)
+	sp := utils.ServicePort{NodePort: 3000, Protocol: annotations.ProtocolHTTP, NEGEnabled: true}
+
+	for _, path := range []string{"/ready", "/v2/ready"} {
+		hc := healthChecks.New(sp)
+		hc.RequestPath = path
+		hc.ForProbe = true
+		if _, err := healthChecks.Sync(hc); err != nil {
+			t.Fatalf("Sync() = %v, want nil", err)
+		}
+
+		got, err := healthChecks.Get(hc.Name, meta.VersionBeta, meta.Global)
+		if err != nil {
+			t.Fatalf("Get() = %v, want nil", err)
+		}
+		if got.RequestPath != path {
+			t.Errorf("got RequestPath %q, want %q", got.RequestPath, path)
+		}
+	}
+}
+
+func TestNeedToUpdateBackendConfig(t *testing.T) {
+	i64 := func(v int64) *int64 { return &v }
+
+	existing := DefaultHealthCheck(3000, annotations.ProtocolHTTP)
+	testCases := []struct {
+		desc   string
+		config *backendconfigv1beta1.HealthCheckConfig
+		want   bool
+	}{
+		{
+			desc: "no BackendConfig",
+			want: false,
+		},
+		{
+			desc:   "BackendConfig matches existing",
+			config: &backendconfigv1beta1.HealthCheckConfig{CheckIntervalSec: i64(existing.CheckIntervalSec)},
+			want:   false,
+		},
+		{
+			desc:   "BackendConfig differs from existing",
+			config: &backendconfigv1beta1.HealthCheckConfig{UnhealthyThreshold: i64(3)},
+			want:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			hc := DefaultHealthCheck(3000, annotations.ProtocolHTTP)
+			hc.UpdateFromBackendConfig(tc.config)
+			if got := needToUpdate(existing, hc); got != tc.want {
+				t.Errorf("needToUpdate() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReconcileManagedFields(t *testing.T) {
+	i64 := func(v int64) *int64 { return &v }
+	existing := func(interval int64, lastApplied map[string]int64) *HealthCheck {
+		hc := DefaultHealthCheck(3000, annotations.ProtocolHTTP)
+		hc.CheckIntervalSec = interval
+		hc.Description = "user description"
+		if lastApplied != nil {
+			hc.Description = healthCheckDescription{ManagedFields: lastApplied}.String()
+		}
+		return hc
+	}
+	defaults := DefaultHealthCheck(3000, annotations.ProtocolHTTP)
+	lastApplied := func(interval int64) map[string]int64 {
+		return map[string]int64{
+			"checkIntervalSec":   interval,
+			"timeoutSec":         defaults.TimeoutSec,
+			"healthyThreshold":   defaults.HealthyThreshold,
+			"unhealthyThreshold": defaults.UnhealthyThreshold,
+		}
+	}
+
+	testCases := []struct {
+		desc         string
+		old          *HealthCheck
+		config       *backendconfigv1beta1.HealthCheckConfig
+		wantInterval int64
+		wantManaged  bool
+	}{
+		{
+			desc:         "new health check",
+			wantInterval: defaults.CheckIntervalSec,
+			wantManaged:  true,
+		},
+		{
+			desc:         "field set by the controller is reconciled",
+			old:          existing(42, lastApplied(42)),
+			wantInterval: defaults.CheckIntervalSec,
+			wantManaged:  true,
+		},
+		{
+			desc:         "field edited by a user is kept",
+			old:          existing(42, lastApplied(defaults.CheckIntervalSec)),
+			wantInterval: 42,
+		},
+		{
+			desc:         "field of a legacy health check without last applied values is reconciled",
+			old:          existing(42, nil),
+			wantInterval: defaults.CheckIntervalSec,
+			wantManaged:  true,
+		},
+		{
+			desc:         "field edited by a user is owned by the BackendConfig",
+			old:          existing(42, lastApplied(defaults.CheckIntervalSec)),
+			config:       &backendconfigv1beta1.HealthCheckConfig{CheckIntervalSec: i64(7)},
+			wantInterval: 7,
+			wantManaged:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			hc := DefaultHealthCheck(3000, annotations.ProtocolHTTP)
+			hc.UpdateFromBackendConfig(tc.config)
+			hc.reconcileManagedFields(tc.old)
+
+			if hc.CheckIntervalSec != tc.wantInterval {
+				t.Errorf("got CheckIntervalSec %d, want %d", hc.CheckIntervalSec, tc.wantInterval)
+			}
+			desc := healthCheckDescriptionFromString(hc.Description)
+			if desc.Description == "" {
+				t.Errorf("description %q lost its text", hc.Description)
+			}
+			managed, ok := desc.ManagedFields["checkIntervalSec"]
+			if ok != tc.wantManaged || (ok && managed != tc.wantInterval) {
+				t.Errorf("got managed checkIntervalSec %d (%t), want %d (%t)", managed, ok, tc.wantInterval, tc.wantManaged)
+			}
+		})
+	}
+}
+
+func TestHealthCheckKeepsUserEdits(t *testing.T) {
+	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	(fakeGCE.Compute().(*cloud.MockGCE)).MockHealthChecks.UpdateHook = mock.UpdateHealthCheckHook
+	healthChecks := NewHealthChecker(fakeGCE, "/", "/healthz", namer, defaultBackendSvc)
+	sp := utils.ServicePort{NodePort: 3000, Protocol: annotations.ProtocolHTTP}
+
+	hc := healthChecks.New(sp)
+	if _, err := healthChecks.Sync(hc); err != nil {
+		t.Fatalf("Sync() = %v, want nil", err)
+	}
+
+	// A user edits the interval by hand.
+	existing, err := fakeGCE.GetHealthCheck(hc.Name)
+	if err != nil {
+		t.Fatalf("GetHealthCheck() = %v, want nil", err)
+	}
+	existing.CheckIntervalSec = 42
+	if err := fakeGCE.UpdateHealthCheck(existing); err != nil {
+		t.Fatalf("UpdateHealthCheck() = %v, want nil", err)
+	}
+
+	// An update triggered by another field keeps the edit.
+	hc = healthChecks.New(sp)
+	hc.Type = string(annotations.ProtocolHTTPS)
+	if _, err := healthChecks.Sync(hc); err != nil {
+		t.Fatalf("Sync() = %v, want nil", err)
+	}
+	got, err := healthChecks.Get(hc.Name, meta.VersionGA, meta.Global)
+	if err != nil {
+		t.Fatalf("Get() = %v, want nil", err)
+	}
+	if got.Protocol() != annotations.ProtocolHTTPS || got.CheckIntervalSec != 42 {
+		t.Errorf("got protocol %v and CheckIntervalSec %d, want %v and 42", got.Protocol(), got.CheckIntervalSec, annotations.ProtocolHTTPS)
+	}
+}
+
 func TestAlphaHealthCheck(t *testing.T) {
 	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
 	healthChecks := NewHealthChecker(fakeGCE, "/", "/healthz", namer, defaultBackendSvc)
@@ -342,6 +590,22 @@ func TestAlphaHealthCheck(t *testing.T) {
 	}
 }
 
+func TestGRPCHealthCheck(t *testing.T) {
+	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	healthChecks := NewHealthChecker(fakeGCE, "/", "/healthz", namer, defaultBackendSvc)
+	sp := utils.ServicePort{Port: 8080, Protocol: annotations.ProtocolGRPC, NEGEnabled: true}
+	hc := healthChecks.New(sp)
+	if hc.Protocol() != annotations.ProtocolHTTP2 {
+		t.Errorf("got hc.Protocol() = %q, want %q", hc.Protocol(), annotations.ProtocolHTTP2)
+	}
+	if _, err := healthChecks.Sync(hc); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if _, err := healthChecks.Get(hc.Name, meta.VersionAlpha, meta.Global); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+}
+
 func TestVersion(t *testing.T) {
 	t.Parallel()
 	testCases := []struct {
@@ -40,6 +40,7 @@ type HealthCheckProvider interface {
 	UpdateBetaHealthCheck(hc *computebeta.HealthCheck) error
 	UpdateHealthCheck(hc *compute.HealthCheck) error
 	DeleteHealthCheck(name string) error
+	ListHealthChecks() ([]*compute.HealthCheck, error)
 	GetAlphaHealthCheck(name string) (*computealpha.HealthCheck, error)
 	GetBetaHealthCheck(name string) (*computebeta.HealthCheck, error)
 	GetHealthCheck(name string) (*compute.HealthCheck, error)
@@ -48,6 +49,12 @@ type HealthCheckProvider interface {
 // HealthChecker is an interface to manage cloud HTTPHealthChecks.
 type HealthChecker interface {
 	New(sp utils.ServicePort) *HealthCheck
+	// Share names hc after its settings, so that it is shared by all backend
+	// services with the same health check settings.
+	Share(hc *HealthCheck)
+	// GCShared deletes the shared health checks which are not referenced by
+	// any of the given health check links.
+	GCShared(links []string) error
 	Sync(hc *HealthCheck) (string, error)
 	Delete(name string, scope meta.KeyType) error
 	Get(name string, version meta.Version, scope meta.KeyType) (*HealthCheck, error)
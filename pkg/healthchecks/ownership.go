@@ -0,0 +1,115 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthchecks
+
+import (
+	"encoding/json"
+
+	backendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/backendconfig/v1beta1"
+	"k8s.io/klog"
+)
+
+// healthCheckDescription is stored in the description of the health checks
+// created by the controller. ManagedFields holds the values of the fields last
+// set by the controller, so that a three-way diff between these, the existing
+// health check and the desired one tells apart the fields edited by users.
+type healthCheckDescription struct {
+	Description   string           `json:"description,omitempty"`
+	ManagedFields map[string]int64 `json:"kubernetes.io/managed-fields,omitempty"`
+}
+
+// String returns the string representation of a healthCheckDescription.
+func (desc healthCheckDescription) String() string {
+	descJSON, err := json.Marshal(desc)
+	if err != nil {
+		klog.Errorf("Failed to generate health check description: %v, falling back to %q", err, desc.Description)
+		return desc.Description
+	}
+	return string(descJSON)
+}
+
+// healthCheckDescriptionFromString parses a healthCheckDescription. Plain
+// descriptions, e.g. of health checks created by older controllers or by
+// users, have no managed fields.
+func healthCheckDescriptionFromString(descString string) healthCheckDescription {
+	var desc healthCheckDescription
+	if err := json.Unmarshal([]byte(descString), &desc); err != nil {
+		return healthCheckDescription{Description: descString}
+	}
+	return desc
+}
+
+// managedField is a health check field which users may edit by hand.
+type managedField struct {
+	name string
+	// value returns the address of the field in hc.
+	value func(hc *HealthCheck) *int64
+	// inBackendConfig returns whether the field is specified by c.
+	inBackendConfig func(c *backendconfigv1beta1.HealthCheckConfig) bool
+}
+
+var managedFields = []managedField{
+	{
+		name:            "checkIntervalSec",
+		value:           func(hc *HealthCheck) *int64 { return &hc.CheckIntervalSec },
+		inBackendConfig: func(c *backendconfigv1beta1.HealthCheckConfig) bool { return c.CheckIntervalSec != nil },
+	},
+	{
+		name:            "timeoutSec",
+		value:           func(hc *HealthCheck) *int64 { return &hc.TimeoutSec },
+		inBackendConfig: func(c *backendconfigv1beta1.HealthCheckConfig) bool { return c.TimeoutSec != nil },
+	},
+	{
+		name:            "healthyThreshold",
+		value:           func(hc *HealthCheck) *int64 { return &hc.HealthyThreshold },
+		inBackendConfig: func(c *backendconfigv1beta1.HealthCheckConfig) bool { return c.HealthyThreshold != nil },
+	},
+	{
+		name:            "unhealthyThreshold",
+		value:           func(hc *HealthCheck) *int64 { return &hc.UnhealthyThreshold },
+		inBackendConfig: func(c *backendconfigv1beta1.HealthCheckConfig) bool { return c.UnhealthyThreshold != nil },
+	},
+}
+
+// reconcileManagedFields keeps the values of the fields of the existing health
+// check old which differ from the ones last set by the controller, unless the
+// BackendConfig of hc specifies them, and records the fields set by the
+// controller in the description of hc. old is nil if hc is being created. The
+// fields without a value last set by the controller, e.g. of health checks
+// created by older controllers, are owned by the controller.
+func (hc *HealthCheck) reconcileManagedFields(old *HealthCheck) {
+	var lastApplied map[string]int64
+	if old != nil {
+		lastApplied = healthCheckDescriptionFromString(old.Description).ManagedFields
+	}
+	managed := map[string]int64{}
+	for _, f := range managedFields {
+		value := f.value(hc)
+		if old != nil && (hc.backendConfig == nil || !f.inBackendConfig(hc.backendConfig)) {
+			oldValue := *f.value(old)
+			if last, ok := lastApplied[f.name]; ok && oldValue != *value && last != oldValue {
+				klog.V(2).Infof("Keeping %v = %d edited on health check %v instead of %d", f.name, oldValue, hc.Name, *value)
+				*value = oldValue
+				continue
+			}
+		}
+		managed[f.name] = *value
+	}
+	desc := healthCheckDescriptionFromString(hc.Description)
+	desc.ManagedFields = managed
+	hc.Description = desc.String()
+}
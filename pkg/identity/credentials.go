@@ -0,0 +1,187 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"k8s.io/klog"
+)
+
+// CredentialSource is where the GCE credentials of the controller come from.
+type CredentialSource string
+
+const (
+	// WorkloadIdentitySource is the GKE metadata server of Workload Identity,
+	// serving the tokens of the service account of the Kubernetes service
+	// account of the controller.
+	WorkloadIdentitySource = CredentialSource("workload-identity")
+	// MetadataSource is the metadata server of the VM, serving the tokens of
+	// the service account of the node.
+	MetadataSource = CredentialSource("metadata")
+	// KeyFileSource is a service account key file.
+	KeyFileSource = CredentialSource("key-file")
+)
+
+// tokenRefreshMargin is how long before their expiry the tokens of a key
+// file are refreshed, so that requests never use a token about to expire.
+const tokenRefreshMargin = 5 * time.Minute
+
+// metadataClient is the part of the metadata server API used to find the
+// credentials.
+type metadataClient interface {
+	OnGCE() bool
+	Get(suffix string) (string, error)
+}
+
+type defaultMetadataClient struct{}
+
+func (defaultMetadataClient) OnGCE() bool                       { return metadata.OnGCE() }
+func (defaultMetadataClient) Get(suffix string) (string, error) { return metadata.Get(suffix) }
+
+// Credentials are the GCE credentials of the controller.
+type Credentials struct {
+	// Source is where the credentials come from.
+	Source CredentialSource
+	// Email is the email of the service account, empty if unknown.
+	Email string
+
+	keyJSON []byte
+}
+
+// FindCredentials returns the first available credentials of Workload
+// Identity, the metadata server and the given service account key file.
+func FindCredentials(keyFile string) (*Credentials, error) {
+	return findCredentials(defaultMetadataClient{}, keyFile)
+}
+
+func findCredentials(md metadataClient, keyFile string) (*Credentials, error) {
+	if md.OnGCE() {
+		email, err := md.Get("instance/service-accounts/default/email")
+		if err == nil {
+			source := MetadataSource
+			if isWorkloadIdentity(md) {
+				source = WorkloadIdentitySource
+			}
+			return &Credentials{Source: source, Email: email}, nil
+		}
+		klog.Warningf("Metadata server has no service account: %v", err)
+	}
+	if keyFile == "" {
+		return nil, fmt.Errorf("no GCE credentials: neither Workload Identity nor the metadata server are available, and no key file is set")
+	}
+	keyJSON, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key file: %v", err)
+	}
+	config, err := google.JWTConfigFromJSON(keyJSON)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing key file %q: %v", keyFile, err)
+	}
+	return &Credentials{Source: KeyFileSource, Email: config.Email, keyJSON: keyJSON}, nil
+}
+
+// isWorkloadIdentity returns true if the metadata server is the GKE metadata
+// server of Workload Identity, which conceals the kube-env attribute of the
+// nodes of GKE clusters.
+func isWorkloadIdentity(md metadataClient) bool {
+	if _, err := md.Get("instance/attributes/cluster-name"); err != nil {
+		return false
+	}
+	_, err := md.Get("instance/attributes/kube-env")
+	_, concealed := err.(metadata.NotDefinedError)
+	return concealed
+}
+
+func (c *Credentials) String() string {
+	if c.Email == "" {
+		return string(c.Source)
+	}
+	return fmt.Sprintf("%s (%s)", c.Source, c.Email)
+}
+
+// TokenSource returns the source of the access tokens with the given scopes.
+// The scopes of the metadata server tokens are those of the VM, or all for
+// Workload Identity. The tokens are refreshed before they expire.
+func (c *Credentials) TokenSource(scopes ...string) (oauth2.TokenSource, error) {
+	if c.Source != KeyFileSource {
+		return google.ComputeTokenSource(""), nil
+	}
+	config, err := google.JWTConfigFromJSON(c.keyJSON, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	return NewRefreshingTokenSource(config.TokenSource(context.Background()), tokenRefreshMargin), nil
+}
+
+// Client returns an HTTP client authenticated with the access tokens with the
+// given scopes.
+func (c *Credentials) Client(scopes ...string) (*http.Client, error) {
+	if c.Source != KeyFileSource {
+		return google.DefaultClient(context.Background(), scopes...)
+	}
+	ts, err := c.TokenSource(scopes...)
+	if err != nil {
+		return nil, err
+	}
+	return oauth2.NewClient(context.Background(), ts), nil
+}
+
+// refreshingTokenSource is an oauth2.TokenSource which refreshes its token
+// margin before it expires, and keeps using it while it is valid if the
+// refresh fails.
+type refreshingTokenSource struct {
+	base   oauth2.TokenSource
+	margin time.Duration
+	now    func() time.Time
+
+	lock  sync.Mutex
+	token *oauth2.Token
+}
+
+// NewRefreshingTokenSource returns a token source refreshing the tokens of
+// base margin before they expire.
+func NewRefreshingTokenSource(base oauth2.TokenSource, margin time.Duration) oauth2.TokenSource {
+	return &refreshingTokenSource{base: base, margin: margin, now: time.Now}
+}
+
+// Token implements oauth2.TokenSource.
+func (s *refreshingTokenSource) Token() (*oauth2.Token, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.token != nil && (s.token.Expiry.IsZero() || s.now().Add(s.margin).Before(s.token.Expiry)) {
+		return s.token, nil
+	}
+	token, err := s.base.Token()
+	if err != nil {
+		if s.token != nil && s.now().Before(s.token.Expiry) {
+			klog.Warningf("Failed to refresh access token, using the current one until it expires at %v: %v", s.token.Expiry, err)
+			return s.token, nil
+		}
+		return nil, err
+	}
+	s.token = token
+	return token, nil
+}
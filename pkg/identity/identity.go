@@ -0,0 +1,121 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package identity provides the GCE clients used for mutations on the
+// resources of the Ingresses of a namespace. In multi-tenant clusters, each
+// namespace can be mapped to a GCP service account so that GCP audit logs
+// attribute changes to the tenant instead of the controller.
+package identity
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+// refreshPeriod is how often the namespace to service account mapping is
+// re-read from the ConfigMap.
+const refreshPeriod = time.Minute
+
+// CloudProvider returns the GCE client to use for the resources of the
+// Ingresses of a namespace.
+type CloudProvider interface {
+	Cloud(namespace string) (*gce.Cloud, error)
+}
+
+// NewCloudFunc returns a GCE client authenticated as the service account.
+type NewCloudFunc func(serviceAccount string) (*gce.Cloud, error)
+
+// namespaceCloudProvider implements CloudProvider with the mapping of
+// namespaces to service account emails in the data of a ConfigMap.
+// Namespaces which are not mapped use the default client.
+type namespaceCloudProvider struct {
+	kubeClient   kubernetes.Interface
+	configMap    types.NamespacedName
+	defaultCloud *gce.Cloud
+	newCloud     NewCloudFunc
+	now          func() time.Time
+
+	// lock protects the fields below.
+	lock            sync.Mutex
+	serviceAccounts map[string]string
+	refreshed       time.Time
+	// clouds caches the clients by service account.
+	clouds map[string]*gce.Cloud
+}
+
+// NewNamespaceCloudProvider returns a CloudProvider reading the service
+// account of each namespace from the given ConfigMap.
+func NewNamespaceCloudProvider(kubeClient kubernetes.Interface, configMap types.NamespacedName, defaultCloud *gce.Cloud, newCloud NewCloudFunc) CloudProvider {
+	return &namespaceCloudProvider{
+		kubeClient:   kubeClient,
+		configMap:    configMap,
+		defaultCloud: defaultCloud,
+		newCloud:     newCloud,
+		now:          time.Now,
+		clouds:       map[string]*gce.Cloud{},
+	}
+}
+
+// Cloud implements CloudProvider.
+func (p *namespaceCloudProvider) Cloud(namespace string) (*gce.Cloud, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.serviceAccounts == nil || p.now().Sub(p.refreshed) > refreshPeriod {
+		p.refresh()
+	}
+	sa, ok := p.serviceAccounts[namespace]
+	if !ok {
+		return p.defaultCloud, nil
+	}
+	if cloud, ok := p.clouds[sa]; ok {
+		return cloud, nil
+	}
+	cloud, err := p.newCloud(sa)
+	if err != nil {
+		return nil, fmt.Errorf("error creating GCE client for service account %q of namespace %q: %v", sa, namespace, err)
+	}
+	klog.V(2).Infof("Using service account %q for the resources of namespace %q", sa, namespace)
+	p.clouds[sa] = cloud
+	return cloud, nil
+}
+
+// refresh re-reads the mapping from the ConfigMap. The previous mapping is
+// kept on errors, a missing ConfigMap maps no namespace.
+func (p *namespaceCloudProvider) refresh() {
+	cm, err := p.kubeClient.CoreV1().ConfigMaps(p.configMap.Namespace).Get(p.configMap.Name, meta_v1.GetOptions{})
+	switch {
+	case err == nil:
+		p.serviceAccounts = cm.Data
+	case errors.IsNotFound(err):
+		klog.V(4).Infof("ConfigMap %v not found, no namespace has a service account", p.configMap)
+		p.serviceAccounts = map[string]string{}
+	default:
+		klog.Errorf("Failed to get ConfigMap %v, keeping the previous namespace service accounts: %v", p.configMap, err)
+		if p.serviceAccounts == nil {
+			p.serviceAccounts = map[string]string{}
+		}
+	}
+	p.refreshed = p.now()
+}
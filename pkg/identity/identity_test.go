@@ -0,0 +1,140 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+var configMapName = types.NamespacedName{Namespace: "kube-system", Name: "namespace-service-accounts"}
+
+func newConfigMap(data map[string]string) *apiv1.ConfigMap {
+	return &apiv1.ConfigMap{
+		ObjectMeta: meta_v1.ObjectMeta{Namespace: configMapName.Namespace, Name: configMapName.Name},
+		Data:       data,
+	}
+}
+
+func TestNamespaceCloudProvider(t *testing.T) {
+	defaultCloud := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	tenantCloud := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+
+	testCases := []struct {
+		desc      string
+		configMap *apiv1.ConfigMap
+		newErr    error
+		namespace string
+		want      *gce.Cloud
+		wantSA    string
+		wantErr   bool
+	}{
+		{
+			desc:      "no ConfigMap",
+			namespace: "tenant",
+			want:      defaultCloud,
+		},
+		{
+			desc:      "namespace not mapped",
+			configMap: newConfigMap(map[string]string{"tenant": "tenant@project.iam.gserviceaccount.com"}),
+			namespace: "other",
+			want:      defaultCloud,
+		},
+		{
+			desc:      "namespace mapped",
+			configMap: newConfigMap(map[string]string{"tenant": "tenant@project.iam.gserviceaccount.com"}),
+			namespace: "tenant",
+			want:      tenantCloud,
+			wantSA:    "tenant@project.iam.gserviceaccount.com",
+		},
+		{
+			desc:      "client creation fails",
+			configMap: newConfigMap(map[string]string{"tenant": "tenant@project.iam.gserviceaccount.com"}),
+			newErr:    fmt.Errorf("no credentials"),
+			namespace: "tenant",
+			wantSA:    "tenant@project.iam.gserviceaccount.com",
+			wantErr:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			kubeClient := fake.NewSimpleClientset()
+			if tc.configMap != nil {
+				kubeClient = fake.NewSimpleClientset(tc.configMap)
+			}
+			var gotSA string
+			p := NewNamespaceCloudProvider(kubeClient, configMapName, defaultCloud, func(sa string) (*gce.Cloud, error) {
+				gotSA = sa
+				return tenantCloud, tc.newErr
+			})
+
+			got, err := p.Cloud(tc.namespace)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("Cloud(%q) = _, %v, want error %t", tc.namespace, err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("Cloud(%q) returned the wrong client", tc.namespace)
+			}
+			if gotSA != tc.wantSA {
+				t.Errorf("Cloud(%q) created a client for %q, want %q", tc.namespace, gotSA, tc.wantSA)
+			}
+		})
+	}
+}
+
+func TestNamespaceCloudProviderRefresh(t *testing.T) {
+	defaultCloud := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	kubeClient := fake.NewSimpleClientset()
+	clients := 0
+	p := NewNamespaceCloudProvider(kubeClient, configMapName, defaultCloud, func(sa string) (*gce.Cloud, error) {
+		clients++
+		return gce.NewFakeGCECloud(gce.DefaultTestClusterValues()), nil
+	}).(*namespaceCloudProvider)
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	if got, _ := p.Cloud("tenant"); got != defaultCloud {
+		t.Fatalf("Cloud(tenant) did not return the default client without a ConfigMap")
+	}
+
+	// The mapping is not re-read before the refresh period.
+	cm := newConfigMap(map[string]string{"tenant": "tenant@project.iam.gserviceaccount.com"})
+	if _, err := kubeClient.CoreV1().ConfigMaps(cm.Namespace).Create(cm); err != nil {
+		t.Fatalf("Create(%v) = %v", cm.Name, err)
+	}
+	if got, _ := p.Cloud("tenant"); got != defaultCloud {
+		t.Errorf("Cloud(tenant) did not return the default client before the refresh period")
+	}
+
+	now = now.Add(2 * refreshPeriod)
+	first, err := p.Cloud("tenant")
+	if err != nil || first == defaultCloud {
+		t.Fatalf("Cloud(tenant) = _, %v, want the client of the service account", err)
+	}
+	second, _ := p.Cloud("tenant")
+	if first != second || clients != 1 {
+		t.Errorf("Cloud(tenant) created %d clients, want the client to be cached", clients)
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+const (
+	cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+	// generateAccessTokenURL is the IAM Credentials API method minting
+	// access tokens of a service account.
+	generateAccessTokenURL = "https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/%s:generateAccessToken"
+)
+
+// NewImpersonatedCloud returns a GCE client for the same project, network and
+// location as base, authenticated with short-lived access tokens of the given
+// service account. The credentials of the controller must be granted
+// roles/iam.serviceAccountTokenCreator on the service account.
+func NewImpersonatedCloud(base *gce.Cloud, credentials *Credentials, serviceAccount string) (*gce.Cloud, error) {
+	client, err := credentials.Client(cloudPlatformScope)
+	if err != nil {
+		return nil, fmt.Errorf("error getting %v credentials: %v", credentials, err)
+	}
+	zone, err := base.GetZone(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	ts := oauth2.ReuseTokenSource(nil, &impersonatedTokenSource{
+		client:         client,
+		serviceAccount: serviceAccount,
+	})
+	return gce.CreateGCECloud(&gce.CloudConfig{
+		APIEndpoint:      strings.TrimSuffix(base.ComputeServices().GA.BasePath, "projects/"),
+		ProjectID:        base.ProjectID(),
+		NetworkProjectID: base.NetworkProjectID(),
+		Region:           base.Region(),
+		Zone:             zone.FailureDomain,
+		NetworkURL:       base.NetworkURL(),
+		SubnetworkURL:    base.SubnetworkURL(),
+		TokenSource:      ts,
+	})
+}
+
+// impersonatedTokenSource is an oauth2.TokenSource returning access tokens of
+// a service account.
+type impersonatedTokenSource struct {
+	client         *http.Client
+	serviceAccount string
+}
+
+type generateAccessTokenRequest struct {
+	Scope []string `json:"scope"`
+}
+
+type generateAccessTokenResponse struct {
+	AccessToken string    `json:"accessToken"`
+	ExpireTime  time.Time `json:"expireTime"`
+}
+
+// Token implements oauth2.TokenSource.
+func (s *impersonatedTokenSource) Token() (*oauth2.Token, error) {
+	body, err := json.Marshal(generateAccessTokenRequest{Scope: []string{cloudPlatformScope}})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Post(fmt.Sprintf(generateAccessTokenURL, s.serviceAccount), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error generating access token for %q: %v", s.serviceAccount, err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading access token of %q: %v", s.serviceAccount, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error generating access token for %q: %s: %s", s.serviceAccount, resp.Status, data)
+	}
+	var token generateAccessTokenResponse
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("error parsing access token of %q: %v", s.serviceAccount, err)
+	}
+	return &oauth2.Token{AccessToken: token.AccessToken, TokenType: "Bearer", Expiry: token.ExpireTime}, nil
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// testIamPermissionsURL is the Resource Manager API method returning the
+// permissions the caller has on a project.
+var testIamPermissionsURL = "https://cloudresourcemanager.googleapis.com/v1/projects/%s:testIamPermissions"
+
+// OperationPermissions maps the compute API operations the controller calls,
+// named <Resource>.<Method> as in the cloud library, to the IAM permissions
+// they need: that of the method and the use permissions of the resources the
+// method references.
+var OperationPermissions = map[string][]string{
+	"Addresses.Get": {"compute.addresses.get"},
+
+	"BackendServices.Delete":            {"compute.backendServices.delete"},
+	"BackendServices.Get":               {"compute.backendServices.get"},
+	"BackendServices.Insert":            {"compute.backendServices.create", "compute.healthChecks.useReadOnly", "compute.instanceGroups.use", "compute.networkEndpointGroups.use"},
+	"BackendServices.List":              {"compute.backendServices.list"},
+	"BackendServices.SetSecurityPolicy": {"compute.backendServices.setSecurityPolicy", "compute.securityPolicies.use"},
+	"BackendServices.Update":            {"compute.backendServices.update", "compute.healthChecks.useReadOnly", "compute.instanceGroups.use", "compute.networkEndpointGroups.use"},
+
+	"Firewalls.Delete": {"compute.firewalls.delete", "compute.networks.updatePolicy"},
+	"Firewalls.Get":    {"compute.firewalls.get"},
+	"Firewalls.Insert": {"compute.firewalls.create", "compute.networks.updatePolicy"},
+	"Firewalls.Patch":  {"compute.firewalls.update", "compute.networks.updatePolicy"},
+	"Firewalls.Update": {"compute.firewalls.update", "compute.networks.updatePolicy"},
+
+	"ForwardingRules.Delete": {"compute.forwardingRules.delete"},
+	"ForwardingRules.Get":    {"compute.forwardingRules.get"},
+	"ForwardingRules.Insert": {"compute.forwardingRules.create", "compute.addresses.use"},
+	"ForwardingRules.List":   {"compute.forwardingRules.list"},
+
+	"GlobalAddresses.Delete": {"compute.globalAddresses.delete"},
+	"GlobalAddresses.Get":    {"compute.globalAddresses.get"},
+	"GlobalAddresses.Insert": {"compute.globalAddresses.create"},
+	"GlobalAddresses.List":   {"compute.globalAddresses.list"},
+
+	"GlobalForwardingRules.Delete":    {"compute.globalForwardingRules.delete"},
+	"GlobalForwardingRules.Get":       {"compute.globalForwardingRules.get"},
+	"GlobalForwardingRules.Insert":    {"compute.globalForwardingRules.create", "compute.globalAddresses.use", "compute.targetHttpProxies.use", "compute.targetHttpsProxies.use"},
+	"GlobalForwardingRules.List":      {"compute.globalForwardingRules.list"},
+	"GlobalForwardingRules.SetTarget": {"compute.globalForwardingRules.setTarget", "compute.targetHttpProxies.use", "compute.targetHttpsProxies.use"},
+
+	"HealthChecks.Delete": {"compute.healthChecks.delete"},
+	"HealthChecks.Get":    {"compute.healthChecks.get"},
+	"HealthChecks.Insert": {"compute.healthChecks.create"},
+	"HealthChecks.List":   {"compute.healthChecks.list"},
+	"HealthChecks.Update": {"compute.healthChecks.update"},
+
+	"InstanceGroups.AddInstances":    {"compute.instanceGroups.update", "compute.instances.use"},
+	"InstanceGroups.AggregatedList":  {"compute.instanceGroups.list"},
+	"InstanceGroups.Delete":          {"compute.instanceGroups.delete"},
+	"InstanceGroups.Get":             {"compute.instanceGroups.get"},
+	"InstanceGroups.Insert":          {"compute.instanceGroups.create"},
+	"InstanceGroups.List":            {"compute.instanceGroups.list"},
+	"InstanceGroups.ListInstances":   {"compute.instanceGroups.list"},
+	"InstanceGroups.RemoveInstances": {"compute.instanceGroups.update"},
+	"InstanceGroups.SetNamedPorts":   {"compute.instanceGroups.update"},
+
+	// The node tags of the firewall rules are read from the instances.
+	"Instances.List": {"compute.instances.list"},
+
+	"NetworkEndpointGroups.AggregatedList":         {"compute.networkEndpointGroups.list"},
+	"NetworkEndpointGroups.AttachNetworkEndpoints": {"compute.networkEndpointGroups.attachNetworkEndpoints", "compute.instances.use"},
+	"NetworkEndpointGroups.Delete":                 {"compute.networkEndpointGroups.delete"},
+	"NetworkEndpointGroups.DetachNetworkEndpoints": {"compute.networkEndpointGroups.detachNetworkEndpoints"},
+	"NetworkEndpointGroups.Get":                    {"compute.networkEndpointGroups.get"},
+	"NetworkEndpointGroups.Insert":                 {"compute.networkEndpointGroups.create"},
+	"NetworkEndpointGroups.List":                   {"compute.networkEndpointGroups.list"},
+	"NetworkEndpointGroups.ListNetworkEndpoints":   {"compute.networkEndpointGroups.get"},
+
+	"SslCertificates.Delete": {"compute.sslCertificates.delete"},
+	"SslCertificates.Get":    {"compute.sslCertificates.get"},
+	"SslCertificates.Insert": {"compute.sslCertificates.create"},
+	"SslCertificates.List":   {"compute.sslCertificates.list"},
+
+	"TargetHttpProxies.Delete":    {"compute.targetHttpProxies.delete"},
+	"TargetHttpProxies.Get":       {"compute.targetHttpProxies.get"},
+	"TargetHttpProxies.Insert":    {"compute.targetHttpProxies.create", "compute.urlMaps.use"},
+	"TargetHttpProxies.SetUrlMap": {"compute.targetHttpProxies.setUrlMap", "compute.urlMaps.use"},
+
+	"TargetHttpsProxies.Delete":             {"compute.targetHttpsProxies.delete"},
+	"TargetHttpsProxies.Get":                {"compute.targetHttpsProxies.get"},
+	"TargetHttpsProxies.Insert":             {"compute.targetHttpsProxies.create", "compute.urlMaps.use", "compute.sslCertificates.get"},
+	"TargetHttpsProxies.SetQuicOverride":    {"compute.targetHttpsProxies.setQuicOverride"},
+	"TargetHttpsProxies.SetSslCertificates": {"compute.targetHttpsProxies.setSslCertificates", "compute.sslCertificates.get"},
+	"TargetHttpsProxies.SetSslPolicy":       {"compute.targetHttpsProxies.setSslPolicy", "compute.sslPolicies.use"},
+	"TargetHttpsProxies.SetUrlMap":          {"compute.targetHttpsProxies.setUrlMap", "compute.urlMaps.use"},
+
+	"UrlMaps.Delete": {"compute.urlMaps.delete"},
+	"UrlMaps.Get":    {"compute.urlMaps.get"},
+	"UrlMaps.Insert": {"compute.urlMaps.create", "compute.backendServices.use"},
+	"UrlMaps.List":   {"compute.urlMaps.list"},
+	"UrlMaps.Update": {"compute.urlMaps.update", "compute.backendServices.use"},
+
+	// The cloud provider lists the zones of the region of the cluster when
+	// it starts.
+	"Zones.List": {"compute.zones.list"},
+}
+
+// MinimumPermissions are the IAM permissions the controller needs on the
+// project to manage the load balancers of Ingresses: those of all the
+// OperationPermissions, sorted.
+var MinimumPermissions = operationsPermissions(OperationPermissions)
+
+// operationsPermissions returns the sorted permissions of all the operations.
+func operationsPermissions(operations map[string][]string) []string {
+	permissions := sets.NewString()
+	for _, p := range operations {
+		permissions.Insert(p...)
+	}
+	return permissions.List()
+}
+
+// MissingPermissionsError is returned when the credentials of the controller
+// lack some of the required permissions on the project.
+type MissingPermissionsError struct {
+	// Project is the project on which the permissions are missing.
+	Project string
+	// Credentials describes the credentials which lack the permissions.
+	Credentials string
+	// Missing are the missing permissions, sorted.
+	Missing []string
+}
+
+func (e *MissingPermissionsError) Error() string {
+	return fmt.Sprintf("credentials %s are missing %d permission(s) on project %q: %s", e.Credentials, len(e.Missing), e.Project, strings.Join(e.Missing, ", "))
+}
+
+type testIamPermissionsMessage struct {
+	Permissions []string `json:"permissions"`
+}
+
+// CheckPermissions returns a *MissingPermissionsError if the caller of client,
+// authenticated with the given credentials, lacks some of the permissions on
+// the project.
+func CheckPermissions(client *http.Client, credentials *Credentials, project string, permissions []string) error {
+	body, err := json.Marshal(testIamPermissionsMessage{Permissions: permissions})
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(fmt.Sprintf(testIamPermissionsURL, project), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error testing permissions on project %q: %v", project, err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading permissions on project %q: %v", project, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error testing permissions on project %q: %s: %s", project, resp.Status, data)
+	}
+	var granted testIamPermissionsMessage
+	if err := json.Unmarshal(data, &granted); err != nil {
+		return fmt.Errorf("error parsing permissions on project %q: %v", project, err)
+	}
+	missing := sets.NewString(permissions...)
+	missing.Delete(granted.Permissions...)
+	if missing.Len() == 0 {
+		return nil
+	}
+	return &MissingPermissionsError{Project: project, Credentials: credentials.String(), Missing: missing.List()}
+}
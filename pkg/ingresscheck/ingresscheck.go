@@ -0,0 +1,346 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ingresscheck compares the GCE resources of the load balancer of an
+// Ingress with the resources the controller is expected to have created.
+package ingresscheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	computebeta "google.golang.org/api/compute/v0.beta"
+	compute "google.golang.org/api/compute/v1"
+	"k8s.io/api/networking/v1beta1"
+	"k8s.io/ingress-gce/pkg/annotations"
+	"k8s.io/ingress-gce/pkg/utils"
+	namer_util "k8s.io/ingress-gce/pkg/utils/namer"
+)
+
+// Kind is the kind of a GCE resource.
+type Kind string
+
+const (
+	KindForwardingRule       = Kind("ForwardingRule")
+	KindTargetHTTPProxy      = Kind("TargetHttpProxy")
+	KindTargetHTTPSProxy     = Kind("TargetHttpsProxy")
+	KindURLMap               = Kind("UrlMap")
+	KindBackendService       = Kind("BackendService")
+	KindNetworkEndpointGroup = Kind("NetworkEndpointGroup")
+	KindInstanceGroup        = Kind("InstanceGroup")
+	KindHealthCheck          = Kind("HealthCheck")
+	KindFirewall             = Kind("Firewall")
+)
+
+// kindResources are the resource types of the URLs of the kinds.
+var kindResources = map[Kind]string{
+	KindForwardingRule:       "forwardingRules",
+	KindTargetHTTPProxy:      "targetHttpProxies",
+	KindTargetHTTPSProxy:     "targetHttpsProxies",
+	KindURLMap:               "urlMaps",
+	KindBackendService:       "backendServices",
+	KindNetworkEndpointGroup: "networkEndpointGroups",
+	KindInstanceGroup:        "instanceGroups",
+	KindHealthCheck:          "healthChecks",
+	KindFirewall:             "firewalls",
+}
+
+// Resource is a GCE resource of the load balancer of an Ingress, and the
+// resources it references.
+type Resource struct {
+	Kind Kind
+	Name string
+	// Zone is the zone of zonal resources, empty until the resource is
+	// found referenced by its parent.
+	Zone     string
+	Children []*Resource
+}
+
+func (r *Resource) String() string {
+	if r.Zone != "" {
+		return fmt.Sprintf("%s %s/%s", r.Kind, r.Zone, r.Name)
+	}
+	return fmt.Sprintf("%s %s", r.Kind, r.Name)
+}
+
+// Drift is a difference between the expected and the actual GCE resources.
+type Drift struct {
+	Resource string
+	Message  string
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s: %s", d.Resource, d.Message)
+}
+
+// Expected returns the graph of the GCE resources of the load balancer of
+// the Ingress, given the URL map translated from it, rooted at its forwarding
+// rules and firewall rule. Only global external load balancers are
+// supported.
+func Expected(namer namer_util.IngressNamer, ing *v1beta1.Ingress, urlMap *utils.GCEURLMap) []*Resource {
+	// Same as the load balancer names of the controller.
+	lbName := namer_util.IngressKeyFunc(ing)
+	if utils.NamingScheme(ing) == annotations.NamingSchemeV2 {
+		lbName = namer.LoadBalancerV2(lbName)
+	}
+	lbName = namer.LoadBalancer(lbName)
+
+	um := &Resource{Kind: KindURLMap, Name: namer.UrlMap(lbName)}
+	seen := map[string]bool{}
+	addBackend := func(sp utils.ServicePort) {
+		name := sp.BackendName(namer)
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		be := &Resource{Kind: KindBackendService, Name: name}
+		if sp.ExternalBackendService == "" {
+			group := &Resource{Kind: KindInstanceGroup, Name: namer.InstanceGroup()}
+			if sp.NEGEnabled {
+				group = &Resource{Kind: KindNetworkEndpointGroup, Name: namer.NEG(sp.ID.Service.Namespace, sp.ID.Service.Name, sp.Port)}
+			}
+			// Unless shared, health checks are named after their backend
+			// service.
+			be.Children = []*Resource{group, {Kind: KindHealthCheck, Name: name}}
+		}
+		um.Children = append(um.Children, be)
+	}
+	if urlMap.DefaultBackend != nil {
+		addBackend(*urlMap.DefaultBackend)
+	}
+	for _, hostRule := range urlMap.HostRules {
+		for _, rule := range hostRule.Paths {
+			if rule.Redirect != nil {
+				continue
+			}
+			if len(rule.WeightedBackends) == 0 {
+				addBackend(rule.Backend)
+			}
+			for _, wb := range rule.WeightedBackends {
+				addBackend(wb.Backend)
+			}
+			for _, route := range rule.ConditionalRoutes {
+				addBackend(route.Backend)
+			}
+		}
+	}
+
+	var roots []*Resource
+	ingAnnotations := annotations.FromIngress(ing)
+	if ingAnnotations.AllowHTTP() {
+		roots = append(roots, &Resource{
+			Kind: KindForwardingRule,
+			Name: namer.ForwardingRule(lbName, namer_util.HTTPProtocol),
+			Children: []*Resource{{
+				Kind:     KindTargetHTTPProxy,
+				Name:     namer.TargetProxy(lbName, namer_util.HTTPProtocol),
+				Children: []*Resource{um},
+			}},
+		})
+	}
+	if len(ing.Spec.TLS) > 0 || ingAnnotations.UseNamedTLS() != "" {
+		roots = append(roots, &Resource{
+			Kind: KindForwardingRule,
+			Name: namer.ForwardingRule(lbName, namer_util.HTTPSProtocol),
+			Children: []*Resource{{
+				Kind:     KindTargetHTTPSProxy,
+				Name:     namer.TargetProxy(lbName, namer_util.HTTPSProtocol),
+				Children: []*Resource{um},
+			}},
+		})
+	}
+	return append(roots, &Resource{Kind: KindFirewall, Name: namer.FirewallRule()})
+}
+
+// Print writes the resource graph to w, one resource per line indented by
+// its depth.
+func Print(w io.Writer, roots []*Resource) {
+	var print func(r *Resource, depth int)
+	print = func(r *Resource, depth int) {
+		fmt.Fprintf(w, "%s%s\n", strings.Repeat("  ", depth), r)
+		for _, child := range r.Children {
+			print(child, depth+1)
+		}
+	}
+	for _, r := range roots {
+		print(r, 0)
+	}
+}
+
+// Checker queries GCE for the resources of a graph.
+type Checker struct {
+	cloud cloud.Cloud
+	namer namer_util.IngressNamer
+}
+
+// NewChecker returns a Checker querying the given cloud. The namer is the
+// namer of the expected resources.
+func NewChecker(cloud cloud.Cloud, namer namer_util.IngressNamer) *Checker {
+	return &Checker{cloud: cloud, namer: namer}
+}
+
+// Check returns the differences between the graph and the actual resources:
+// missing resources, and references to missing or unexpected resources.
+func (c *Checker) Check(ctx context.Context, roots []*Resource) []Drift {
+	var drifts []Drift
+	for _, r := range roots {
+		drifts = append(drifts, c.check(ctx, r)...)
+	}
+	return drifts
+}
+
+// check gets the resource and checks the resources it references.
+func (c *Checker) check(ctx context.Context, r *Resource) []Drift {
+	var links []string
+	var err error
+	switch r.Kind {
+	case KindForwardingRule:
+		var fr *compute.ForwardingRule
+		if fr, err = c.cloud.GlobalForwardingRules().Get(ctx, meta.GlobalKey(r.Name)); err == nil {
+			links = []string{fr.Target}
+		}
+	case KindTargetHTTPProxy:
+		var proxy *compute.TargetHttpProxy
+		if proxy, err = c.cloud.TargetHttpProxies().Get(ctx, meta.GlobalKey(r.Name)); err == nil {
+			links = []string{proxy.UrlMap}
+		}
+	case KindTargetHTTPSProxy:
+		var proxy *compute.TargetHttpsProxy
+		if proxy, err = c.cloud.TargetHttpsProxies().Get(ctx, meta.GlobalKey(r.Name)); err == nil {
+			links = []string{proxy.UrlMap}
+		}
+	case KindURLMap:
+		// Route rules are only returned by the beta API.
+		var um *computebeta.UrlMap
+		if um, err = c.cloud.BetaUrlMaps().Get(ctx, meta.GlobalKey(r.Name)); err == nil {
+			links = urlMapBackendServices(um)
+		}
+	case KindBackendService:
+		var be *compute.BackendService
+		if be, err = c.cloud.BackendServices().Get(ctx, meta.GlobalKey(r.Name)); err == nil {
+			for _, backend := range be.Backends {
+				links = append(links, backend.Group)
+			}
+			links = append(links, be.HealthChecks...)
+		}
+	case KindNetworkEndpointGroup:
+		_, err = c.cloud.NetworkEndpointGroups().Get(ctx, meta.ZonalKey(r.Name, r.Zone))
+	case KindInstanceGroup:
+		_, err = c.cloud.InstanceGroups().Get(ctx, meta.ZonalKey(r.Name, r.Zone))
+	case KindHealthCheck:
+		_, err = c.cloud.HealthChecks().Get(ctx, meta.GlobalKey(r.Name))
+	case KindFirewall:
+		_, err = c.cloud.Firewalls().Get(ctx, meta.GlobalKey(r.Name))
+	default:
+		err = fmt.Errorf("unknown resource kind %q", r.Kind)
+	}
+	if err != nil {
+		return []Drift{{Resource: r.String(), Message: fmt.Sprintf("cannot be read: %v", err)}}
+	}
+	return c.checkLinks(ctx, r, links)
+}
+
+// checkLinks checks that the links of the resource reference its children,
+// and only them, and checks the referenced children.
+func (c *Checker) checkLinks(ctx context.Context, r *Resource, links []string) []Drift {
+	var drifts []Drift
+	referenced := make([]bool, len(r.Children))
+	seen := map[string]bool{}
+	for _, link := range links {
+		if link == "" || seen[link] {
+			continue
+		}
+		seen[link] = true
+		resource, name, zone := "", path.Base(link), ""
+		if id, err := cloud.ParseResourceURL(link); err == nil {
+			resource, name, zone = id.Resource, id.Key.Name, id.Key.Zone
+		}
+		found := false
+		for i, child := range r.Children {
+			if !c.matches(child, resource, name) {
+				continue
+			}
+			found = true
+			referenced[i] = true
+			actual := *child
+			actual.Name, actual.Zone = name, zone
+			drifts = append(drifts, c.check(ctx, &actual)...)
+			break
+		}
+		if !found {
+			drifts = append(drifts, Drift{Resource: r.String(), Message: fmt.Sprintf("references unexpected resource %s", link)})
+		}
+	}
+	for i, child := range r.Children {
+		if !referenced[i] {
+			drifts = append(drifts, Drift{Resource: child.String(), Message: fmt.Sprintf("is not referenced by %s", r)})
+		}
+	}
+	return drifts
+}
+
+// matches returns true if the resource of the given type and name is the
+// expected resource r. The type is ignored if unknown. Shared health checks
+// and instance group shards have names the graph does not predict.
+func (c *Checker) matches(r *Resource, resource, name string) bool {
+	if resource != "" && resource != kindResources[r.Kind] {
+		return false
+	}
+	if name == r.Name {
+		return true
+	}
+	switch r.Kind {
+	case KindHealthCheck:
+		return c.namer.IsSharedHealthCheck(name)
+	case KindInstanceGroup:
+		_, ok := c.namer.InstanceGroupShardIndex(name)
+		return ok
+	}
+	return false
+}
+
+// urlMapBackendServices returns the links to the backend services referenced
+// by the URL map.
+func urlMapBackendServices(um *computebeta.UrlMap) []string {
+	links := []string{um.DefaultService}
+	addRouteAction := func(action *computebeta.HttpRouteAction) {
+		if action == nil {
+			return
+		}
+		for _, wb := range action.WeightedBackendServices {
+			links = append(links, wb.BackendService)
+		}
+	}
+	addRouteAction(um.DefaultRouteAction)
+	for _, pm := range um.PathMatchers {
+		links = append(links, pm.DefaultService)
+		addRouteAction(pm.DefaultRouteAction)
+		for _, rule := range pm.PathRules {
+			links = append(links, rule.Service)
+			addRouteAction(rule.RouteAction)
+		}
+		for _, rule := range pm.RouteRules {
+			links = append(links, rule.Service)
+			addRouteAction(rule.RouteAction)
+		}
+	}
+	return links
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingresscheck
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	computebeta "google.golang.org/api/compute/v0.beta"
+	compute "google.golang.org/api/compute/v1"
+	"k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/ingress-gce/pkg/utils"
+	namer_util "k8s.io/ingress-gce/pkg/utils/namer"
+)
+
+const (
+	project = "mock-project"
+	zone    = "us-central1-b"
+)
+
+func link(resource string, key *meta.Key) string {
+	return cloud.SelfLink(meta.VersionGA, project, resource, key)
+}
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	namer := namer_util.NewNamer("uid1", "fw1")
+	ing := &v1beta1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "ing"}}
+	negPort := utils.ServicePort{
+		ID:         utils.ServicePortID{Service: types.NamespacedName{Namespace: "default", Name: "neg-svc"}, Port: intstr.FromInt(80)},
+		Port:       80,
+		NEGEnabled: true,
+	}
+	igPort := utils.ServicePort{
+		ID:       utils.ServicePortID{Service: types.NamespacedName{Namespace: "default", Name: "ig-svc"}, Port: intstr.FromInt(80)},
+		Port:     80,
+		NodePort: 30001,
+	}
+	urlMap := utils.NewGCEURLMap()
+	urlMap.DefaultBackend = &negPort
+	urlMap.PutPathRulesForHost("foo.com", []utils.PathRule{{Path: "/ig", Backend: igPort}})
+
+	roots := Expected(namer, ing, urlMap)
+	var out bytes.Buffer
+	Print(&out, roots)
+	lbName := namer.LoadBalancer(namer_util.IngressKeyFunc(ing))
+	negBackend, igBackend := negPort.BackendName(namer), igPort.BackendName(namer)
+	for _, want := range []string{
+		"ForwardingRule " + namer.ForwardingRule(lbName, namer_util.HTTPProtocol),
+		"  TargetHttpProxy " + namer.TargetProxy(lbName, namer_util.HTTPProtocol),
+		"    UrlMap " + namer.UrlMap(lbName),
+		"      BackendService " + negBackend,
+		"        NetworkEndpointGroup " + namer.NEG("default", "neg-svc", 80),
+		"        InstanceGroup " + namer.InstanceGroup(),
+		"Firewall " + namer.FirewallRule(),
+	} {
+		if !strings.Contains(out.String(), want+"\n") {
+			t.Errorf("Print() = %q, want a line %q", out.String(), want)
+		}
+	}
+	if strings.Contains(out.String(), "TargetHttpsProxy") {
+		t.Errorf("Print() = %q, want no HTTPS proxy for an Ingress without TLS", out.String())
+	}
+
+	mock := cloud.NewMockGCE(&cloud.SingleProjectRouter{ID: project})
+	proxyKey := meta.GlobalKey(namer.TargetProxy(lbName, namer_util.HTTPProtocol))
+	umKey := meta.GlobalKey(namer.UrlMap(lbName))
+	negKey := meta.ZonalKey(namer.NEG("default", "neg-svc", 80), zone)
+	igKey := meta.ZonalKey(namer.InstanceGroup(), zone)
+	mock.GlobalForwardingRules().Insert(ctx, meta.GlobalKey(namer.ForwardingRule(lbName, namer_util.HTTPProtocol)), &compute.ForwardingRule{Target: link("targetHttpProxies", proxyKey)})
+	mock.TargetHttpProxies().Insert(ctx, proxyKey, &compute.TargetHttpProxy{UrlMap: link("urlMaps", umKey)})
+	mock.BetaUrlMaps().Insert(ctx, umKey, &computebeta.UrlMap{
+		DefaultService: link("backendServices", meta.GlobalKey(negBackend)),
+		PathMatchers: []*computebeta.PathMatcher{{
+			DefaultService: link("backendServices", meta.GlobalKey(negBackend)),
+			PathRules:      []*computebeta.PathRule{{Paths: []string{"/ig"}, Service: link("backendServices", meta.GlobalKey(igBackend))}},
+		}},
+	})
+	for name, group := range map[string]string{negBackend: link("networkEndpointGroups", negKey), igBackend: link("instanceGroups", igKey)} {
+		mock.BackendServices().Insert(ctx, meta.GlobalKey(name), &compute.BackendService{
+			Backends:     []*compute.Backend{{Group: group}},
+			HealthChecks: []string{link("healthChecks", meta.GlobalKey(name))},
+		})
+		mock.HealthChecks().Insert(ctx, meta.GlobalKey(name), &compute.HealthCheck{})
+	}
+	mock.NetworkEndpointGroups().Insert(ctx, negKey, &compute.NetworkEndpointGroup{})
+	mock.InstanceGroups().Insert(ctx, igKey, &compute.InstanceGroup{})
+	mock.Firewalls().Insert(ctx, meta.GlobalKey(namer.FirewallRule()), &compute.Firewall{})
+
+	checker := NewChecker(mock, namer)
+	if drifts := checker.Check(ctx, roots); len(drifts) != 0 {
+		t.Errorf("Check() = %v, want no drift", drifts)
+	}
+
+	// A health check shared by the backend services is expected.
+	sharedHC := meta.GlobalKey(namer.SharedHealthCheck("hash"))
+	mock.HealthChecks().Insert(ctx, sharedHC, &compute.HealthCheck{})
+	mock.BackendServices().Delete(ctx, meta.GlobalKey(igBackend))
+	mock.BackendServices().Insert(ctx, meta.GlobalKey(igBackend), &compute.BackendService{
+		Backends:     []*compute.Backend{{Group: link("instanceGroups", igKey)}},
+		HealthChecks: []string{link("healthChecks", sharedHC)},
+	})
+	if drifts := checker.Check(ctx, roots); len(drifts) != 0 {
+		t.Errorf("Check() = %v with a shared health check, want no drift", drifts)
+	}
+
+	mock.NetworkEndpointGroups().Delete(ctx, negKey)
+	mock.BackendServices().Delete(ctx, meta.GlobalKey(igBackend))
+	mock.BackendServices().Insert(ctx, meta.GlobalKey(igBackend), &compute.BackendService{
+		Backends: []*compute.Backend{{Group: link("instanceGroups", meta.ZonalKey("other-ig", zone))}},
+	})
+	var got []string
+	for _, drift := range checker.Check(ctx, roots) {
+		got = append(got, drift.String())
+	}
+	for _, want := range []string{
+		"NetworkEndpointGroup " + zone + "/" + negKey.Name + ": cannot be read",
+		"BackendService " + igBackend + ": references unexpected resource",
+		"InstanceGroup " + namer.InstanceGroup() + ": is not referenced by BackendService " + igBackend,
+		"HealthCheck " + igBackend + ": is not referenced by BackendService " + igBackend,
+	} {
+		found := false
+		for _, drift := range got {
+			if strings.HasPrefix(drift, want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Check() = %q, want a drift starting with %q", got, want)
+		}
+	}
+	if len(got) != 4 {
+		t.Errorf("Check() = %q, want 4 drifts", got)
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ingressclass resolves the IngressClasses of the controller and
+// their GCPIngressParams.
+package ingressclass
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/apis/gcpingressparams"
+	paramsv1beta1 "k8s.io/ingress-gce/pkg/apis/gcpingressparams/v1beta1"
+	"k8s.io/ingress-gce/pkg/crd"
+	"k8s.io/ingress-gce/pkg/flags"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/klog"
+)
+
+const (
+	// ControllerName is the controller of the IngressClasses handled by
+	// this controller, in their spec.controller.
+	ControllerName = "k8s.io/ingress-gce"
+	// DefaultClassAnnotation marks the default IngressClass of the cluster.
+	DefaultClassAnnotation = "ingressclass.kubernetes.io/is-default-class"
+
+	paramsKind = "GCPIngressParams"
+)
+
+var (
+	// IngressClassGVR is the resource of IngressClasses, which the vendored
+	// client does not know yet.
+	IngressClassGVR = schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1beta1", Resource: "ingressclasses"}
+	// ParamsGVR is the resource of GCPIngressParams.
+	ParamsGVR = paramsv1beta1.SchemeGroupVersion.WithResource("gcpingressparams")
+)
+
+// ParamsCRDMeta returns the metadata of the cluster-scoped GCPIngressParams
+// CRD.
+func ParamsCRDMeta() *crd.CRDMeta {
+	meta := crd.NewCRDMeta(
+		gcpingressparams.GroupName,
+		"v1beta1",
+		paramsKind,
+		"GCPIngressParamsList",
+		"gcpingressparams",
+		"gcpingressparams",
+	)
+	meta.SetClusterScoped()
+	return meta
+}
+
+// Registry implements utils.IngressClassLookup from the stores of the
+// IngressClass and GCPIngressParams informers.
+type Registry struct {
+	classes cache.Store
+	params  cache.Store
+}
+
+// NewRegistry returns a new Registry.
+func NewRegistry(classes, params cache.Store) *Registry {
+	return &Registry{classes: classes, params: params}
+}
+
+// Params implements utils.IngressClassLookup.
+func (r *Registry) Params(class string) (*utils.IngressClassParams, bool) {
+	obj, exists, err := r.classes.GetByKey(class)
+	if err != nil || !exists {
+		return nil, false
+	}
+	ingClass := obj.(*unstructured.Unstructured)
+	if controller, _, _ := unstructured.NestedString(ingClass.Object, "spec", "controller"); controller != ControllerName {
+		return nil, false
+	}
+	params := &utils.IngressClassParams{Scope: flags.ScopeGlobal}
+	ref, found, _ := unstructured.NestedStringMap(ingClass.Object, "spec", "parameters")
+	if !found {
+		return params, true
+	}
+	if ref["apiGroup"] != gcpingressparams.GroupName || ref["kind"] != paramsKind {
+		params.Err = fmt.Errorf("IngressClass %s references parameters of kind %s in API group %q, only %s in %s are supported", class, ref["kind"], ref["apiGroup"], paramsKind, gcpingressparams.GroupName)
+		return params, true
+	}
+	obj, exists, err = r.params.GetByKey(ref["name"])
+	if err != nil || !exists {
+		params.Err = fmt.Errorf("%s %s of IngressClass %s not found", paramsKind, ref["name"], class)
+		return params, true
+	}
+	spec := &paramsv1beta1.GCPIngressParams{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.(*unstructured.Unstructured).Object, spec); err != nil {
+		params.Err = fmt.Errorf("invalid %s %s of IngressClass %s: %v", paramsKind, ref["name"], class, err)
+		return params, true
+	}
+	if err := applyParams(params, &spec.Spec); err != nil {
+		params.Err = fmt.Errorf("invalid %s %s of IngressClass %s: %v", paramsKind, ref["name"], class, err)
+	}
+	return params, true
+}
+
+// DefaultClass implements utils.IngressClassLookup. If several IngressClasses
+// are marked as default, which the API server rejects new Ingresses for, none
+// is the default.
+func (r *Registry) DefaultClass() string {
+	var defaults []string
+	for _, obj := range r.classes.List() {
+		ingClass := obj.(*unstructured.Unstructured)
+		if ingClass.GetAnnotations()[DefaultClassAnnotation] == "true" {
+			defaults = append(defaults, ingClass.GetName())
+		}
+	}
+	if len(defaults) > 1 {
+		sort.Strings(defaults)
+		klog.Warningf("Several IngressClasses are marked as default: %v", defaults)
+		return ""
+	}
+	if len(defaults) == 0 {
+		return ""
+	}
+	return defaults[0]
+}
+
+// applyParams validates spec and sets its settings on params.
+func applyParams(params *utils.IngressClassParams, spec *paramsv1beta1.GCPIngressParamsSpec) error {
+	switch spec.LoadBalancerType {
+	case "", paramsv1beta1.LoadBalancerTypeExternal:
+		params.Scope = flags.ScopeGlobal
+	case paramsv1beta1.LoadBalancerTypeInternal:
+		params.Scope = flags.ScopeRegional
+	default:
+		return fmt.Errorf("loadBalancerType must be %s or %s, not %q", paramsv1beta1.LoadBalancerTypeExternal, paramsv1beta1.LoadBalancerTypeInternal, spec.LoadBalancerType)
+	}
+	switch spec.NetworkTier {
+	case "", paramsv1beta1.NetworkTierPremium, paramsv1beta1.NetworkTierStandard:
+		params.NetworkTier = spec.NetworkTier
+	default:
+		return fmt.Errorf("networkTier must be %s or %s, not %q", paramsv1beta1.NetworkTierPremium, paramsv1beta1.NetworkTierStandard, spec.NetworkTier)
+	}
+	if be := spec.DefaultBackend; be != nil {
+		if be.Namespace == "" || be.ServiceName == "" || (be.ServicePort.IntValue() == 0 && be.ServicePort.StrVal == "") {
+			return fmt.Errorf("defaultBackend must have a namespace, a serviceName and a servicePort")
+		}
+		params.DefaultBackend = &utils.ServicePortID{
+			Service: types.NamespacedName{Namespace: be.Namespace, Name: be.ServiceName},
+			Port:    be.ServicePort,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingressclass
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/flags"
+	"k8s.io/ingress-gce/pkg/utils"
+)
+
+func newIngressClass(name, controller string, params map[string]interface{}) *unstructured.Unstructured {
+	spec := map[string]interface{}{"controller": controller}
+	if params != nil {
+		spec["parameters"] = params
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1beta1",
+		"kind":       "IngressClass",
+		"metadata":   map[string]interface{}{"name": name},
+		"spec":       spec,
+	}}
+}
+
+func newParams(name string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.gke.io/v1beta1",
+		"kind":       "GCPIngressParams",
+		"metadata":   map[string]interface{}{"name": name},
+		"spec":       spec,
+	}}
+}
+
+func paramsRef(name string) map[string]interface{} {
+	return map[string]interface{}{"apiGroup": "networking.gke.io", "kind": "GCPIngressParams", "name": name}
+}
+
+func TestParams(t *testing.T) {
+	classes := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	params := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, obj := range []*unstructured.Unstructured{
+		newIngressClass("plain", ControllerName, nil),
+		newIngressClass("other", "example.com/other", nil),
+		newIngressClass("internal", ControllerName, paramsRef("internal")),
+		newIngressClass("backend", ControllerName, paramsRef("backend")),
+		newIngressClass("missing", ControllerName, paramsRef("missing")),
+		newIngressClass("invalid", ControllerName, paramsRef("invalid")),
+		newIngressClass("foreign", ControllerName, map[string]interface{}{"apiGroup": "example.com", "kind": "Params", "name": "x"}),
+	} {
+		classes.Add(obj)
+	}
+	for _, obj := range []*unstructured.Unstructured{
+		newParams("internal", map[string]interface{}{"loadBalancerType": "Internal", "networkTier": "PREMIUM"}),
+		newParams("backend", map[string]interface{}{"defaultBackend": map[string]interface{}{"namespace": "ns", "serviceName": "svc", "servicePort": int64(80)}}),
+		newParams("invalid", map[string]interface{}{"loadBalancerType": "Regional"}),
+	} {
+		params.Add(obj)
+	}
+	registry := NewRegistry(classes, params)
+
+	testCases := []struct {
+		desc    string
+		class   string
+		wantOK  bool
+		want    *utils.IngressClassParams
+		wantErr bool
+	}{
+		{desc: "class without parameters", class: "plain", wantOK: true, want: &utils.IngressClassParams{Scope: flags.ScopeGlobal}},
+		{desc: "class of another controller", class: "other"},
+		{desc: "unknown class", class: "unknown"},
+		{desc: "internal load balancers", class: "internal", wantOK: true, want: &utils.IngressClassParams{Scope: flags.ScopeRegional, NetworkTier: "PREMIUM"}},
+		{
+			desc:   "default backend",
+			class:  "backend",
+			wantOK: true,
+			want: &utils.IngressClassParams{
+				Scope:          flags.ScopeGlobal,
+				DefaultBackend: &utils.ServicePortID{Service: types.NamespacedName{Namespace: "ns", Name: "svc"}, Port: intstr.FromInt(80)},
+			},
+		},
+		{desc: "missing parameters", class: "missing", wantOK: true, wantErr: true},
+		{desc: "invalid parameters", class: "invalid", wantOK: true, wantErr: true},
+		{desc: "parameters of another API group", class: "foreign", wantOK: true, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, ok := registry.Params(tc.class)
+			if ok != tc.wantOK {
+				t.Fatalf("Params(%q) = _, %v, want %v", tc.class, ok, tc.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if (got.Err != nil) != tc.wantErr {
+				t.Fatalf("Params(%q).Err = %v, want error %v", tc.class, got.Err, tc.wantErr)
+			}
+			if tc.want != nil && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Params(%q) = %+v, want %+v", tc.class, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDefaultClass(t *testing.T) {
+	defaultClass := func(name string) *unstructured.Unstructured {
+		obj := newIngressClass(name, ControllerName, nil)
+		obj.SetAnnotations(map[string]string{DefaultClassAnnotation: "true"})
+		return obj
+	}
+	testCases := []struct {
+		desc    string
+		classes []*unstructured.Unstructured
+		want    string
+	}{
+		{desc: "no default", classes: []*unstructured.Unstructured{newIngressClass("a", ControllerName, nil)}},
+		{desc: "one default", classes: []*unstructured.Unstructured{newIngressClass("a", ControllerName, nil), defaultClass("b")}, want: "b"},
+		{desc: "several defaults", classes: []*unstructured.Unstructured{defaultClass("a"), defaultClass("b")}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			classes := cache.NewStore(cache.MetaNamespaceKeyFunc)
+			for _, obj := range tc.classes {
+				classes.Add(obj)
+			}
+			if got := NewRegistry(classes, cache.NewStore(cache.MetaNamespaceKeyFunc)).DefaultClass(); got != tc.want {
+				t.Errorf("DefaultClass() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instances
+
+import (
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	compute "google.golang.org/api/compute/v1"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+// NewAsyncInstanceGroups returns the AsyncInstanceGroups of the project of
+// cloud.
+func NewAsyncInstanceGroups(gceCloud *gce.Cloud) AsyncInstanceGroups {
+	return &asyncInstanceGroups{gceCloud: gceCloud}
+}
+
+type asyncInstanceGroups struct {
+	gceCloud *gce.Cloud
+}
+
+// StartAddInstances implements AsyncInstanceGroups.
+func (a *asyncInstanceGroups) StartAddInstances(name, zone string, instanceRefs []*compute.InstanceReference) (*compute.Operation, error) {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+	req := &compute.InstanceGroupsAddInstancesRequest{Instances: instanceRefs}
+	return a.gceCloud.ComputeServices().GA.InstanceGroups.AddInstances(a.gceCloud.ProjectID(), zone, name, req).Context(ctx).Do()
+}
+
+// StartRemoveInstances implements AsyncInstanceGroups.
+func (a *asyncInstanceGroups) StartRemoveInstances(name, zone string, instanceRefs []*compute.InstanceReference) (*compute.Operation, error) {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+	req := &compute.InstanceGroupsRemoveInstancesRequest{Instances: instanceRefs}
+	return a.gceCloud.ComputeServices().GA.InstanceGroups.RemoveInstances(a.gceCloud.ProjectID(), zone, name, req).Context(ctx).Do()
+}
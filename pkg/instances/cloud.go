@@ -0,0 +1,60 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instances
+
+import (
+	"path"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	compute "google.golang.org/api/compute/v1"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+// NewCloudInstanceGroups returns the InstanceGroups of the project of cloud.
+func NewCloudInstanceGroups(gceCloud *gce.Cloud) InstanceGroups {
+	return &cloudInstanceGroups{Cloud: gceCloud}
+}
+
+// cloudInstanceGroups adds the aggregated listing of instance groups, which
+// the cloud provider lacks, to gce.Cloud.
+type cloudInstanceGroups struct {
+	*gce.Cloud
+}
+
+// AggregatedListInstanceGroups implements InstanceGroups.
+func (c *cloudInstanceGroups) AggregatedListInstanceGroups() (map[string][]*compute.InstanceGroup, error) {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+	igs := map[string][]*compute.InstanceGroup{}
+	call := c.ComputeServices().GA.InstanceGroups.AggregatedList(c.ProjectID())
+	err := call.Pages(ctx, func(list *compute.InstanceGroupAggregatedList) error {
+		for scope, items := range list.Items {
+			// Instance groups are zonal, the keys are "zones/<zone>".
+			if !strings.HasPrefix(scope, "zones/") {
+				continue
+			}
+			zone := path.Base(scope)
+			igs[zone] = append(igs[zone], items.InstanceGroups...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return igs, nil
+}
@@ -29,12 +29,13 @@ import (
 )
 
 // NewFakeInstanceGroups creates a new FakeInstanceGroups.
-func NewFakeInstanceGroups(nodes sets.String, namer *namer.Namer) *FakeInstanceGroups {
+func NewFakeInstanceGroups(nodes sets.String, namer namer.IngressNamer) *FakeInstanceGroups {
 	return &FakeInstanceGroups{
 		instances:        nodes,
 		listResult:       getInstanceList(nodes),
 		namer:            namer,
 		zonesToInstances: map[string][]string{},
+		members:          map[string]sets.String{},
 	}
 }
 
@@ -65,8 +66,14 @@ type FakeInstanceGroups struct {
 	getResult        *compute.InstanceGroup
 	listResult       *compute.InstanceGroupsListInstances
 	calls            []int
-	namer            *namer.Namer
+	namer            namer.IngressNamer
 	zonesToInstances map[string][]string
+	// members are the instances of each instance group, by zone/name.
+	members map[string]sets.String
+	// zonalLists and aggregatedLists count the calls listing instance
+	// groups.
+	zonalLists      int
+	aggregatedLists int
 }
 
 // GetInstanceGroup fakes getting an instance group from the cloud.
@@ -94,27 +101,61 @@ func (f *FakeInstanceGroups) DeleteInstanceGroup(name, zone string) error {
 	newGroups := []*compute.InstanceGroup{}
 	found := false
 	for _, ig := range f.instanceGroups {
-		if ig.Name == name {
+		if ig.Name == name && ig.Zone == zone {
 			found = true
 			continue
 		}
 		newGroups = append(newGroups, ig)
 	}
 	if !found {
-		return fmt.Errorf("instance group %v not found", name)
+		return utils.FakeGoogleAPINotFoundErr()
 	}
 	f.instanceGroups = newGroups
 	return nil
 }
 
 // ListInstancesInInstanceGroup fakes listing instances in an instance group.
+// Until instances are added to or removed from an instance group, it has the
+// instances the fake was created with.
 func (f *FakeInstanceGroups) ListInstancesInInstanceGroup(name, zone string, state string) ([]*compute.InstanceWithNamedPorts, error) {
+	if members, ok := f.members[zone+"/"+name]; ok {
+		return getInstanceList(members).Items, nil
+	}
 	return f.listResult.Items, nil
 }
 
 // ListInstancesGroups fakes listing instancegroups in a zone
 func (f *FakeInstanceGroups) ListInstanceGroups(zone string) ([]*compute.InstanceGroup, error) {
-	return f.instanceGroups, nil
+	f.zonalLists++
+	var igs []*compute.InstanceGroup
+	for _, ig := range f.instanceGroups {
+		if ig.Zone == zone {
+			igs = append(igs, ig)
+		}
+	}
+	return igs, nil
+}
+
+// AggregatedListInstanceGroups fakes listing the instancegroups of all zones.
+func (f *FakeInstanceGroups) AggregatedListInstanceGroups() (map[string][]*compute.InstanceGroup, error) {
+	f.aggregatedLists++
+	igs := map[string][]*compute.InstanceGroup{}
+	for _, ig := range f.instanceGroups {
+		igs[ig.Zone] = append(igs[ig.Zone], ig)
+	}
+	return igs, nil
+}
+
+// groupMembers returns the instances of an instance group.
+func (f *FakeInstanceGroups) groupMembers(name, zone string) sets.String {
+	key := zone + "/" + name
+	if _, ok := f.members[key]; !ok {
+		f.members[key] = sets.NewString()
+		for _, ins := range f.listResult.Items {
+			f.members[key].Insert(toInstanceNames([]*compute.InstanceReference{{Instance: ins.Instance}})...)
+		}
+	}
+	return f.members[key]
 }
 
 // AddInstancesToInstanceGroup fakes adding instances to an instance group.
@@ -122,6 +163,7 @@ func (f *FakeInstanceGroups) AddInstancesToInstanceGroup(name, zone string, inst
 	instanceNames := toInstanceNames(instanceRefs)
 	f.calls = append(f.calls, utils.AddInstances)
 	f.instances.Insert(instanceNames...)
+	f.groupMembers(name, zone).Insert(instanceNames...)
 	if _, ok := f.zonesToInstances[zone]; !ok {
 		f.zonesToInstances[zone] = []string{}
 	}
@@ -139,6 +181,7 @@ func (f *FakeInstanceGroups) RemoveInstancesFromInstanceGroup(name, zone string,
 	instanceNames := toInstanceNames(instanceRefs)
 	f.calls = append(f.calls, utils.RemoveInstances)
 	f.instances.Delete(instanceNames...)
+	f.groupMembers(name, zone).Delete(instanceNames...)
 	l, ok := f.zonesToInstances[zone]
 	if !ok {
 		return nil
@@ -209,3 +252,22 @@ func toInstanceNames(instanceRefs []*compute.InstanceReference) []string {
 	}
 	return instanceNames
 }
+
+// StartAddInstances fakes starting to add instances to an instance group. The
+// instances are added right away, and the returned operation is running.
+func (f *FakeInstanceGroups) StartAddInstances(name, zone string, instanceRefs []*compute.InstanceReference) (*compute.Operation, error) {
+	if err := f.AddInstancesToInstanceGroup(name, zone, instanceRefs); err != nil {
+		return nil, err
+	}
+	return &compute.Operation{Name: "add-" + name, Zone: zone, Status: "RUNNING"}, nil
+}
+
+// StartRemoveInstances fakes starting to remove instances from an instance
+// group. The instances are removed right away, and the returned operation is
+// running.
+func (f *FakeInstanceGroups) StartRemoveInstances(name, zone string, instanceRefs []*compute.InstanceReference) (*compute.Operation, error) {
+	if err := f.RemoveInstancesFromInstanceGroup(name, zone, instanceRefs); err != nil {
+		return nil, err
+	}
+	return &compute.Operation{Name: "remove-" + name, Zone: zone, Status: "RUNNING"}, nil
+}
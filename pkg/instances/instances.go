@@ -19,35 +19,64 @@ package instances
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"k8s.io/ingress-gce/pkg/utils/namer"
 	"k8s.io/klog"
 
 	"google.golang.org/api/compute/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
 
+	"k8s.io/ingress-gce/pkg/flags"
+	"k8s.io/ingress-gce/pkg/operations"
 	"k8s.io/ingress-gce/pkg/utils"
 )
 
 const (
 	// State string required by gce library to list all instances.
 	allInstances = "ALL"
+	// shardCacheTTL is how long the shards of the cluster instance group
+	// of a zone are cached, in case they are created or deleted out of band.
+	shardCacheTTL = 10 * time.Minute
 )
 
 // Instances implements NodePool.
 type Instances struct {
 	cloud InstanceGroups
 	ZoneLister
-	namer *namer.Namer
+	namer namer.IngressNamer
+
+	// async, tracker and enqueue are set if the operations of Sync are
+	// tracked instead of waited for.
+	async   AsyncInstanceGroups
+	tracker *operations.Tracker
+	enqueue func(key string)
+
+	// shardCache caches the shards of the cluster instance group by zone,
+	// so that GetShards does not list the instance groups of a zone for
+	// every backend linked on every sync. It is refreshed by the aggregated
+	// listings and invalidated when the controller creates or deletes
+	// instance groups.
+	shardCache cache.Store
+}
+
+// cachedShards are the shards of the cluster instance group in the zone.
+type cachedShards struct {
+	zone   string
+	shards []*compute.InstanceGroup
 }
 
 // NewNodePool creates a new node pool.
 // - cloud: implements InstanceGroups, used to sync Kubernetes nodes with
 //   members of the cloud InstanceGroup.
-func NewNodePool(cloud InstanceGroups, namer *namer.Namer) NodePool {
+func NewNodePool(cloud InstanceGroups, namer namer.IngressNamer) NodePool {
 	return &Instances{
 		cloud: cloud,
 		namer: namer,
+		shardCache: cache.NewTTLStore(func(obj interface{}) (string, error) {
+			return obj.(*cachedShards).zone, nil
+		}, shardCacheTTL),
 	}
 }
 
@@ -58,26 +87,138 @@ func (i *Instances) Init(zl ZoneLister) {
 	i.ZoneLister = zl
 }
 
+// TrackOperations implements NodePool.
+func (i *Instances) TrackOperations(async AsyncInstanceGroups, tracker *operations.Tracker, enqueue func(key string)) {
+	i.async = async
+	i.tracker = tracker
+	i.enqueue = enqueue
+}
+
 // EnsureInstanceGroupsAndPorts creates or gets an instance group if it doesn't exist
-// and adds the given ports to it. Returns a list of one instance group per zone,
-// all of which have the exact same named ports.
+// and adds the given ports to it. Returns a list of the instance groups of each zone,
+// including all the shards of the cluster instance group, all of which have the exact
+// same named ports.
 func (i *Instances) EnsureInstanceGroupsAndPorts(name string, ports []int64) (igs []*compute.InstanceGroup, err error) {
 	zones, err := i.ListZones()
 	if err != nil {
 		return nil, err
 	}
 
+	shardsByZone, err := i.zoneShards(name, zones)
+	if err != nil {
+		return nil, err
+	}
 	for _, zone := range zones {
 		ig, err := i.ensureInstanceGroupAndPorts(name, zone, ports)
 		if err != nil {
 			return nil, err
 		}
-
 		igs = append(igs, ig)
+
+		shards := shardsByZone[zone]
+		for shard := 1; shard < len(shards); shard++ {
+			if shards[shard] == nil {
+				continue
+			}
+			ig, err := i.ensureInstanceGroupAndPorts(shards[shard].Name, zone, ports)
+			if err != nil {
+				return nil, err
+			}
+			igs = append(igs, ig)
+		}
 	}
 	return igs, nil
 }
 
+// GetShards returns the instance groups of the zone which make up the given
+// instance group: all the shards of the cluster instance group, or just the
+// given instance group otherwise.
+func (i *Instances) GetShards(name, zone string) ([]*compute.InstanceGroup, error) {
+	shards, err := i.shards(name, zone)
+	if err != nil {
+		return nil, err
+	}
+	var igs []*compute.InstanceGroup
+	for _, ig := range shards {
+		if ig != nil {
+			igs = append(igs, ig)
+		}
+	}
+	if len(igs) == 0 {
+		return nil, utils.FakeGoogleAPINotFoundErr()
+	}
+	return igs, nil
+}
+
+// shards returns the instance groups of the zone indexed by shard. Zones with
+// more nodes than --max-ig-size have several shards of the cluster instance
+// group. Other instance groups have a single shard. Missing shards are nil.
+// The shards of the cluster instance group are cached, see shardCache.
+func (i *Instances) shards(name, zone string) ([]*compute.InstanceGroup, error) {
+	if name != i.namer.InstanceGroup() {
+		ig, err := i.cloud.GetInstanceGroup(name, zone)
+		if err != nil {
+			return nil, utils.IgnoreHTTPNotFound(err)
+		}
+		return []*compute.InstanceGroup{ig}, nil
+	}
+
+	if item, ok, err := i.shardCache.GetByKey(zone); err == nil && ok {
+		return item.(*cachedShards).shards, nil
+	}
+	igs, err := i.cloud.ListInstanceGroups(zone)
+	if err != nil {
+		return nil, err
+	}
+	shards := i.indexShards(igs)
+	i.shardCache.Add(&cachedShards{zone: zone, shards: shards})
+	return shards, nil
+}
+
+// zoneShards returns the shards of the instance group in each of the zones,
+// see shards. The instance groups of all the zones are listed with a single
+// aggregated call, rather than a call per zone.
+func (i *Instances) zoneShards(name string, zones []string) (map[string][]*compute.InstanceGroup, error) {
+	shardsByZone := map[string][]*compute.InstanceGroup{}
+	if name != i.namer.InstanceGroup() {
+		for _, zone := range zones {
+			shards, err := i.shards(name, zone)
+			if err != nil {
+				return nil, err
+			}
+			shardsByZone[zone] = shards
+		}
+		return shardsByZone, nil
+	}
+
+	igsByZone, err := i.cloud.AggregatedListInstanceGroups()
+	if err != nil {
+		return nil, err
+	}
+	for _, zone := range zones {
+		shardsByZone[zone] = i.indexShards(igsByZone[zone])
+		i.shardCache.Add(&cachedShards{zone: zone, shards: shardsByZone[zone]})
+	}
+	return shardsByZone, nil
+}
+
+// indexShards returns the shards of the cluster instance group among igs,
+// indexed by shard.
+func (i *Instances) indexShards(igs []*compute.InstanceGroup) []*compute.InstanceGroup {
+	var shards []*compute.InstanceGroup
+	for _, ig := range igs {
+		shard, ok := i.namer.InstanceGroupShardIndex(ig.Name)
+		if !ok {
+			continue
+		}
+		for len(shards) <= shard {
+			shards = append(shards, nil)
+		}
+		shards[shard] = ig
+	}
+	return shards
+}
+
 func (i *Instances) ensureInstanceGroupAndPorts(name, zone string, ports []int64) (*compute.InstanceGroup, error) {
 	ig, err := i.Get(name, zone)
 	if err != nil && !utils.IsHTTPErrorCode(err, http.StatusNotFound) {
@@ -87,6 +228,7 @@ func (i *Instances) ensureInstanceGroupAndPorts(name, zone string, ports []int64
 
 	if ig == nil {
 		klog.V(3).Infof("Creating instance group %v/%v.", zone, name)
+		defer i.shardCache.Delete(&cachedShards{zone: zone})
 		if err = i.cloud.CreateInstanceGroup(&compute.InstanceGroup{Name: name}, zone); err != nil {
 			// Error may come back with StatusConflict meaning the instance group was created by another controller
 			// possibly the Service Controller for internal load balancers.
@@ -146,18 +288,31 @@ func (i *Instances) DeleteInstanceGroup(name string) error {
 	if err != nil {
 		return err
 	}
+	shardsByZone, err := i.zoneShards(name, zones)
+	if err != nil {
+		errs = append(errs, err)
+	}
 	for _, zone := range zones {
-		if err := i.cloud.DeleteInstanceGroup(name, zone); err != nil {
-			if utils.IsNotFoundError(err) {
-				klog.V(3).Infof("Instance group %v in zone %v did not exist", name, zone)
-			} else if utils.IsInUsedByError(err) {
-				klog.V(3).Infof("Could not delete instance group %v in zone %v because it's still in use. Ignoring: %v", name, zone, err)
+		names := sets.NewString(name)
+		for _, ig := range shardsByZone[zone] {
+			if ig != nil {
+				names.Insert(ig.Name)
+			}
+		}
+		for _, name := range names.List() {
+			if err := i.cloud.DeleteInstanceGroup(name, zone); err != nil {
+				if utils.IsNotFoundError(err) {
+					klog.V(3).Infof("Instance group %v in zone %v did not exist", name, zone)
+				} else if utils.IsInUsedByError(err) {
+					klog.V(3).Infof("Could not delete instance group %v in zone %v because it's still in use. Ignoring: %v", name, zone, err)
+				} else {
+					errs = append(errs, err)
+				}
 			} else {
-				errs = append(errs, err)
+				klog.V(3).Infof("Deleted instance group %v in zone %v", name, zone)
 			}
-		} else {
-			klog.V(3).Infof("Deleted instance group %v in zone %v", name, zone)
 		}
+		i.shardCache.Delete(&cachedShards{zone: zone})
 	}
 	if len(errs) == 0 {
 		return nil
@@ -165,26 +320,19 @@ func (i *Instances) DeleteInstanceGroup(name string) error {
 	return fmt.Errorf("%v", errs)
 }
 
-// list lists all instances in all zones.
-func (i *Instances) list(name string) (sets.String, error) {
+// list lists all instances of the instance group in the zone.
+func (i *Instances) list(name, zone string) (sets.String, error) {
 	nodeNames := sets.NewString()
-	zones, err := i.ListZones()
+	instances, err := i.cloud.ListInstancesInInstanceGroup(name, zone, allInstances)
 	if err != nil {
 		return nodeNames, err
 	}
-
-	for _, zone := range zones {
-		instances, err := i.cloud.ListInstancesInInstanceGroup(name, zone, allInstances)
+	for _, ins := range instances {
+		name, err := utils.KeyName(ins.Instance)
 		if err != nil {
 			return nodeNames, err
 		}
-		for _, ins := range instances {
-			name, err := utils.KeyName(ins.Instance)
-			if err != nil {
-				return nodeNames, err
-			}
-			nodeNames.Insert(name)
-		}
+		nodeNames.Insert(name)
 	}
 	return nodeNames, nil
 }
@@ -208,15 +356,12 @@ func (i *Instances) List() ([]string, error) {
 		return nil, err
 	}
 
+	igsByZone, err := i.cloud.AggregatedListInstanceGroups()
+	if err != nil {
+		return nil, err
+	}
 	for _, zone := range zones {
-		igsForZone, err := i.cloud.ListInstanceGroups(zone)
-		if err != nil {
-			return nil, err
-		}
-
-		for _, ig := range igsForZone {
-			igs = append(igs, ig)
-		}
+		igs = append(igs, igsByZone[zone]...)
 	}
 
 	var names []string
@@ -283,7 +428,8 @@ func (i *Instances) Sync(nodes []string) (err error) {
 
 	defer func() {
 		// The node pool is only responsible for syncing nodes to instance
-		// groups. It never creates/deletes, so if an instance groups is
+		// groups. It only creates the additional shards of large zones, so
+		// if an instance groups is
 		// not found there's nothing it can do about it anyway. Most cases
 		// this will happen because the backend pool has deleted the instance
 		// group, however if it happens because a user deletes the IG by mistake
@@ -294,38 +440,161 @@ func (i *Instances) Sync(nodes []string) (err error) {
 		}
 	}()
 
-	pool, err := i.List()
+	zones, err := i.ListZones()
 	if err != nil {
 		return err
 	}
+	shardsByZone, err := i.zoneShards(i.namer.InstanceGroup(), zones)
+	if err != nil {
+		return err
+	}
+	nodesByZone := i.splitNodesByZone(nodes)
+	for _, zone := range zones {
+		if err = i.syncZone(zone, shardsByZone[zone], sets.NewString(nodesByZone[zone]...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	for _, igName := range pool {
-		gceNodes := sets.NewString()
-		gceNodes, err = i.list(igName)
-		if err != nil {
+// syncZone syncs the kubernetes nodes of the zone with the instances in the
+// given shards of the cluster instance group of the zone. Shards are added when
+// there are more nodes than fit in the existing shards, and nodes are moved
+// from the shards which are no longer needed into the others.
+func (i *Instances) syncZone(zone string, shards []*compute.InstanceGroup, kubeNodes sets.String) error {
+	trackerKey := "instance-groups/" + zone
+	if i.tracker != nil {
+		// The zone is synced again once its operations are done.
+		if i.tracker.Pending(trackerKey) {
+			klog.V(3).Infof("Operations of instance groups in zone %v are pending, not syncing its nodes", zone)
+			return nil
+		}
+		if err := i.tracker.Result(trackerKey); err != nil {
 			return err
 		}
-		kubeNodes := sets.NewString(nodes...)
+	}
 
-		// A node deleted via kubernetes could still exist as a gce vm. We don't
-		// want to route requests to it. Similarly, a node added to kubernetes
-		// needs to get added to the instance group so we do route requests to it.
+	name := i.namer.InstanceGroup()
+	if len(shards) == 0 || shards[0] == nil {
+		// The backend pool creates the instance group, see Sync.
+		klog.V(3).Infof("Instance group %v/%v does not exist, not syncing its nodes", zone, name)
+		return nil
+	}
 
-		removeNodes := gceNodes.Difference(kubeNodes).List()
-		addNodes := kubeNodes.Difference(gceNodes).List()
-		if len(removeNodes) != 0 {
-			klog.V(4).Infof("Removing nodes from IG: %v", removeNodes)
-			if err = i.Remove(igName, removeNodes); err != nil {
+	// A node deleted via kubernetes could still exist as a gce vm. We don't
+	// want to route requests to it. Similarly, a node added to kubernetes
+	// needs to get added to the instance group so we do route requests to it.
+	gceNodes := make([]sets.String, len(shards))
+	for shard, ig := range shards {
+		gceNodes[shard] = sets.NewString()
+		if ig == nil {
+			continue
+		}
+		nodes, err := i.list(ig.Name, zone)
+		if err != nil {
+			return err
+		}
+		gceNodes[shard] = nodes
+	}
+	wantNodes := assignShards(gceNodes, kubeNodes, flags.Reloadable().MaxIGSize)
+
+	// Instances can only be in a single load balanced instance group, so
+	// nodes moving between shards are removed before they are added.
+	for shard, nodes := range gceNodes {
+		var want sets.String
+		if shard < len(wantNodes) {
+			want = wantNodes[shard]
+		}
+		if removeNodes := nodes.Difference(want).List(); len(removeNodes) != 0 {
+			klog.V(4).Infof("Removing nodes from IG %v: %v", i.namer.InstanceGroupShard(shard), removeNodes)
+			refs := i.cloud.ToInstanceReferences(zone, removeNodes)
+			if i.tracker != nil {
+				op, err := i.async.StartRemoveInstances(i.namer.InstanceGroupShard(shard), zone, refs)
+				if err != nil {
+					return err
+				}
+				i.tracker.Track(trackerKey, op, i.enqueue)
+			} else if err := i.cloud.RemoveInstancesFromInstanceGroup(i.namer.InstanceGroupShard(shard), zone, refs); err != nil {
 				return err
 			}
 		}
-
-		if len(addNodes) != 0 {
-			klog.V(4).Infof("Adding nodes to IG: %v", addNodes)
-			if err = i.Add(igName, addNodes); err != nil {
+	}
+	if i.tracker != nil && i.tracker.Pending(trackerKey) {
+		// The nodes are added by the sync following the removals.
+		return nil
+	}
+	for shard, nodes := range wantNodes {
+		var existing sets.String
+		if shard < len(gceNodes) {
+			existing = gceNodes[shard]
+		}
+		addNodes := nodes.Difference(existing).List()
+		if len(addNodes) == 0 {
+			continue
+		}
+		shardName := i.namer.InstanceGroupShard(shard)
+		if shard >= len(shards) || shards[shard] == nil {
+			klog.V(2).Infof("Adding instance group shard %v/%v for %d nodes", zone, shardName, kubeNodes.Len())
+			if _, err := i.ensureInstanceGroupAndPorts(shardName, zone, namedPortNumbers(shards[0])); err != nil {
+				return err
+			}
+		}
+		klog.V(4).Infof("Adding nodes to IG %v: %v", shardName, addNodes)
+		refs := i.cloud.ToInstanceReferences(zone, addNodes)
+		if i.tracker != nil {
+			op, err := i.async.StartAddInstances(shardName, zone, refs)
+			if err != nil {
 				return err
 			}
+			i.tracker.Track(trackerKey, op, i.enqueue)
+		} else if err := i.cloud.AddInstancesToInstanceGroup(shardName, zone, refs); err != nil {
+			return err
 		}
 	}
 	return nil
 }
+
+// assignShards returns the nodes which belong in each shard, given the nodes
+// currently in each shard. The fewest shards which can hold the nodes with at
+// most maxSize nodes each are used. Nodes stay in their shard if possible, and
+// the others are added to the shards with the fewest nodes.
+func assignShards(current []sets.String, nodes sets.String, maxSize int) []sets.String {
+	numShards := 1
+	if maxSize > 0 && nodes.Len() > maxSize {
+		numShards = (nodes.Len() + maxSize - 1) / maxSize
+	}
+	shards := make([]sets.String, numShards)
+	assigned := sets.NewString()
+	for shard := range shards {
+		shards[shard] = sets.NewString()
+		if shard >= len(current) {
+			continue
+		}
+		for _, node := range current[shard].Intersection(nodes).Difference(assigned).List() {
+			if maxSize > 0 && shards[shard].Len() >= maxSize {
+				break
+			}
+			shards[shard].Insert(node)
+			assigned.Insert(node)
+		}
+	}
+	for _, node := range nodes.Difference(assigned).List() {
+		smallest := 0
+		for shard := range shards {
+			if shards[shard].Len() < shards[smallest].Len() {
+				smallest = shard
+			}
+		}
+		shards[smallest].Insert(node)
+	}
+	return shards
+}
+
+// namedPortNumbers returns the ports of the named ports of the instance group.
+func namedPortNumbers(ig *compute.InstanceGroup) []int64 {
+	var ports []int64
+	for _, np := range ig.NamedPorts {
+		ports = append(ports, np.Port)
+	}
+	return ports
+}
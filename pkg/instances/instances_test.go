@@ -17,9 +17,18 @@ limitations under the License.
 package instances
 
 import (
+	"net/http"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 
+	"google.golang.org/api/compute/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/ingress-gce/pkg/flags"
+	"k8s.io/ingress-gce/pkg/operations"
+	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/ingress-gce/pkg/utils/namer"
 )
 
@@ -82,6 +91,70 @@ func TestNodePoolSync(t *testing.T) {
 	}
 }
 
+func TestNodePoolSyncTrackedOperations(t *testing.T) {
+	f := NewFakeInstanceGroups(sets.NewString("n1", "n2"), defaultNamer)
+	pool := newNodePool(f, defaultZone)
+	pool.EnsureInstanceGroupsAndPorts(defaultNamer.InstanceGroup(), []int64{80})
+
+	// Operations are done once their name is in done.
+	var lock sync.Mutex
+	done := map[string]*compute.OperationError{}
+	get := func(op *compute.Operation) (*compute.Operation, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if opErr, ok := done[op.Name]; ok {
+			return &compute.Operation{Name: op.Name, Status: "DONE", Error: opErr}, nil
+		}
+		return op, nil
+	}
+	setDone := func(name string, opErr *compute.OperationError) {
+		lock.Lock()
+		defer lock.Unlock()
+		done[name] = opErr
+	}
+	tracker := operations.NewTracker(get, 10*time.Millisecond)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go tracker.Run(stopCh)
+	enqueued := make(chan string, 10)
+	pool.TrackOperations(f, tracker, func(key string) { enqueued <- key })
+	waitEnqueued := func() {
+		select {
+		case <-enqueued:
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Fatalf("Zone not enqueued after its operations are done")
+		}
+	}
+
+	// n2 is removed, and n3 is only added once the removal is done.
+	if err := pool.Sync([]string{"n1", "n3"}); err != nil {
+		t.Fatalf("pool.Sync() = %v, want nil", err)
+	}
+	if want := sets.NewString("n1"); !f.instances.Equal(want) {
+		t.Errorf("Got instances %v, want %v", f.instances.List(), want.List())
+	}
+	f.calls = []int{}
+	if err := pool.Sync([]string{"n1", "n3"}); err != nil || len(f.calls) != 0 {
+		t.Errorf("pool.Sync() = %v with calls %v while the operations are pending, want nil without calls", err, f.calls)
+	}
+
+	setDone("remove-"+defaultNamer.InstanceGroup(), nil)
+	waitEnqueued()
+	if err := pool.Sync([]string{"n1", "n3"}); err != nil {
+		t.Fatalf("pool.Sync() = %v, want nil", err)
+	}
+	if want := sets.NewString("n1", "n3"); !f.instances.Equal(want) {
+		t.Errorf("Got instances %v, want %v", f.instances.List(), want.List())
+	}
+
+	// The errors of failed operations are returned by the next sync.
+	setDone("add-"+defaultNamer.InstanceGroup(), &compute.OperationError{Errors: []*compute.OperationErrorErrors{{Message: "failed"}}})
+	waitEnqueued()
+	if err := pool.Sync([]string{"n1", "n3"}); err == nil {
+		t.Errorf("pool.Sync() = nil after a failed operation, want error")
+	}
+}
+
 func TestSetNamedPorts(t *testing.T) {
 	f := NewFakeInstanceGroups(sets.NewString([]string{"ig"}...), defaultNamer)
 	pool := newNodePool(f, defaultZone)
@@ -131,3 +204,189 @@ func TestSetNamedPorts(t *testing.T) {
 		}
 	}
 }
+
+func TestNodePoolSyncShards(t *testing.T) {
+	defer func(size int) { flags.F.MaxIGSize = size }(flags.F.MaxIGSize)
+	flags.F.MaxIGSize = 2
+
+	f := NewFakeInstanceGroups(sets.NewString(), defaultNamer)
+	pool := newNodePool(f, defaultZone)
+	if _, err := pool.EnsureInstanceGroupsAndPorts(defaultNamer.InstanceGroup(), []int64{80}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		desc       string
+		nodes      []string
+		wantShards int
+	}{
+		{desc: "shards added", nodes: []string{"n1", "n2", "n3", "n4", "n5"}, wantShards: 3},
+		{desc: "nodes moved out of unneeded shard", nodes: []string{"n1", "n4", "n5"}, wantShards: 2},
+		{desc: "single shard", nodes: []string{"n6"}, wantShards: 1},
+	} {
+		if err := pool.Sync(tc.nodes); err != nil {
+			t.Fatalf("%s: Sync(%v) = %v", tc.desc, tc.nodes, err)
+		}
+		igs, err := pool.GetShards(defaultNamer.InstanceGroup(), defaultZone)
+		if err != nil {
+			t.Fatalf("%s: GetShards() = %v", tc.desc, err)
+		}
+		gotNodes := sets.NewString()
+		nonEmpty := 0
+		for _, ig := range igs {
+			members := f.groupMembers(ig.Name, defaultZone)
+			if members.Len() > flags.F.MaxIGSize {
+				t.Errorf("%s: instance group %v has %d nodes, want at most %d", tc.desc, ig.Name, members.Len(), flags.F.MaxIGSize)
+			}
+			if members.Len() > 0 {
+				nonEmpty++
+			}
+			if len(ig.NamedPorts) != 1 || ig.NamedPorts[0].Port != 80 {
+				t.Errorf("%s: instance group %v has named ports %v, want port 80", tc.desc, ig.Name, ig.NamedPorts)
+			}
+			gotNodes = gotNodes.Union(members)
+		}
+		if nonEmpty != tc.wantShards {
+			t.Errorf("%s: got %d non-empty shards, want %d", tc.desc, nonEmpty, tc.wantShards)
+		}
+		if want := sets.NewString(tc.nodes...); !gotNodes.Equal(want) {
+			t.Errorf("%s: instance groups have nodes %v, want %v", tc.desc, gotNodes.List(), want.List())
+		}
+	}
+}
+
+func TestNodePoolAggregatedList(t *testing.T) {
+	f := NewFakeInstanceGroups(sets.NewString(), defaultNamer)
+	pool := NewNodePool(f, defaultNamer)
+	pool.Init(&FakeZoneLister{[]string{"zone-a", "zone-b", "zone-c"}})
+
+	// Each operation on the cluster instance group lists the instance
+	// groups of all the zones with a single call.
+	for _, tc := range []struct {
+		desc string
+		op   func() error
+	}{
+		{desc: "EnsureInstanceGroupsAndPorts", op: func() error {
+			_, err := pool.EnsureInstanceGroupsAndPorts(defaultNamer.InstanceGroup(), []int64{80})
+			return err
+		}},
+		{desc: "Sync", op: func() error { return pool.Sync([]string{"n1", "n2"}) }},
+		{desc: "List", op: func() error {
+			names, err := pool.List()
+			if len(names) != 3 {
+				t.Errorf("List() = %v, want the instance groups of the 3 zones", names)
+			}
+			return err
+		}},
+		{desc: "DeleteInstanceGroup", op: func() error { return pool.DeleteInstanceGroup(defaultNamer.InstanceGroup()) }},
+	} {
+		f.zonalLists, f.aggregatedLists = 0, 0
+		if err := tc.op(); err != nil {
+			t.Fatalf("%s: %v", tc.desc, err)
+		}
+		if f.zonalLists != 0 || f.aggregatedLists != 1 {
+			t.Errorf("%s: got %d zonal and %d aggregated list calls, want 0 and 1", tc.desc, f.zonalLists, f.aggregatedLists)
+		}
+	}
+}
+
+func TestNodePoolGetShardsCache(t *testing.T) {
+	f := NewFakeInstanceGroups(sets.NewString(), defaultNamer)
+	pool := NewNodePool(f, defaultNamer)
+	pool.Init(&FakeZoneLister{[]string{"zone-a", "zone-b"}})
+
+	if _, err := pool.EnsureInstanceGroupsAndPorts(defaultNamer.InstanceGroup(), []int64{80}); err != nil {
+		t.Fatalf("EnsureInstanceGroupsAndPorts() = %v, want nil", err)
+	}
+	// The instance groups created by EnsureInstanceGroupsAndPorts are listed
+	// once, and then served from the cache.
+	f.zonalLists, f.aggregatedLists = 0, 0
+	for _, zone := range []string{"zone-a", "zone-b", "zone-a"} {
+		igs, err := pool.GetShards(defaultNamer.InstanceGroup(), zone)
+		if err != nil || len(igs) != 1 {
+			t.Fatalf("GetShards(%q) = %v, %v, want 1 instance group", zone, igs, err)
+		}
+	}
+	if f.zonalLists != 2 || f.aggregatedLists != 0 {
+		t.Errorf("Got %d zonal and %d aggregated list calls, want 2 and 0", f.zonalLists, f.aggregatedLists)
+	}
+
+	// The listing of the next sync refreshes the cache.
+	if _, err := pool.EnsureInstanceGroupsAndPorts(defaultNamer.InstanceGroup(), []int64{80}); err != nil {
+		t.Fatalf("EnsureInstanceGroupsAndPorts() = %v, want nil", err)
+	}
+	f.zonalLists = 0
+	if _, err := pool.GetShards(defaultNamer.InstanceGroup(), "zone-a"); err != nil {
+		t.Fatalf("GetShards() = %v, want nil", err)
+	}
+	if f.zonalLists != 0 {
+		t.Errorf("Got %d zonal list calls after a sync, want 0", f.zonalLists)
+	}
+
+	if err := pool.DeleteInstanceGroup(defaultNamer.InstanceGroup()); err != nil {
+		t.Fatalf("DeleteInstanceGroup() = %v, want nil", err)
+	}
+	if _, err := pool.GetShards(defaultNamer.InstanceGroup(), "zone-a"); !utils.IsHTTPErrorCode(err, http.StatusNotFound) {
+		t.Errorf("GetShards() after DeleteInstanceGroup() = %v, want a not found error", err)
+	}
+}
+
+func TestAssignShards(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		current [][]string
+		nodes   []string
+		maxSize int
+		want    [][]string
+	}{
+		{
+			desc:    "no limit",
+			current: [][]string{{"n1"}},
+			nodes:   []string{"n1", "n2", "n3"},
+			want:    [][]string{{"n1", "n2", "n3"}},
+		},
+		{
+			desc:    "new nodes spread over new shards",
+			nodes:   []string{"n1", "n2", "n3", "n4", "n5"},
+			maxSize: 2,
+			want:    [][]string{{"n1", "n4"}, {"n2", "n5"}, {"n3"}},
+		},
+		{
+			desc:    "nodes stay in their shard",
+			current: [][]string{{"n3", "n4"}, {"n1"}},
+			nodes:   []string{"n1", "n2", "n3", "n4"},
+			maxSize: 2,
+			want:    [][]string{{"n3", "n4"}, {"n1", "n2"}},
+		},
+		{
+			desc:    "nodes of unneeded shards are moved",
+			current: [][]string{{"n1"}, {"n2"}, {"n3"}},
+			nodes:   []string{"n1", "n2", "n3"},
+			maxSize: 2,
+			want:    [][]string{{"n1", "n3"}, {"n2"}},
+		},
+		{
+			desc:    "nodes of full shards are moved",
+			current: [][]string{{"n1", "n2", "n3"}},
+			nodes:   []string{"n1", "n2", "n3"},
+			maxSize: 2,
+			want:    [][]string{{"n1", "n2"}, {"n3"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var current []sets.String
+			for _, nodes := range tc.current {
+				current = append(current, sets.NewString(nodes...))
+			}
+			var got [][]string
+			for _, shard := range assignShards(current, sets.NewString(tc.nodes...), tc.maxSize) {
+				got = append(got, shard.List())
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("assignShards() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -18,6 +18,7 @@ package instances
 
 import (
 	compute "google.golang.org/api/compute/v1"
+	"k8s.io/ingress-gce/pkg/operations"
 )
 
 // zoneLister manages lookups for GCE instance groups/instances to zones.
@@ -40,7 +41,15 @@ type NodePool interface {
 	Remove(groupName string, nodeNames []string) error
 	Sync(nodeNames []string) error
 	Get(name, zone string) (*compute.InstanceGroup, error)
+	// GetShards returns all the instance groups of a zone which make up the
+	// given instance group.
+	GetShards(name, zone string) ([]*compute.InstanceGroup, error)
 	List() ([]string, error)
+	// TrackOperations makes Sync start the operations changing the
+	// instances of the instance groups with async, without waiting for
+	// them. The tracker calls enqueue once the operations of a zone are
+	// done, so that the zone gets synced again.
+	TrackOperations(async AsyncInstanceGroups, tracker *operations.Tracker, enqueue func(key string))
 }
 
 // InstanceGroups is an interface for managing gce instances groups, and the instances therein.
@@ -49,6 +58,9 @@ type InstanceGroups interface {
 	CreateInstanceGroup(ig *compute.InstanceGroup, zone string) error
 	DeleteInstanceGroup(name, zone string) error
 	ListInstanceGroups(zone string) ([]*compute.InstanceGroup, error)
+	// AggregatedListInstanceGroups returns the instance groups of all the
+	// zones of the project, by zone, with a single call.
+	AggregatedListInstanceGroups() (map[string][]*compute.InstanceGroup, error)
 
 	// TODO: Refactor for modulatiry.
 	ListInstancesInInstanceGroup(name, zone string, state string) ([]*compute.InstanceWithNamedPorts, error)
@@ -57,3 +69,10 @@ type InstanceGroups interface {
 	ToInstanceReferences(zone string, instanceNames []string) (refs []*compute.InstanceReference)
 	SetNamedPortsOfInstanceGroup(igName, zone string, namedPorts []*compute.NamedPort) error
 }
+
+// AsyncInstanceGroups starts the operations changing the instances of
+// instance groups, without waiting for them to complete.
+type AsyncInstanceGroups interface {
+	StartAddInstances(name, zone string, instanceRefs []*compute.InstanceReference) (*compute.Operation, error)
+	StartRemoveInstances(name, zone string, instanceRefs []*compute.InstanceReference) (*compute.Operation, error)
+}
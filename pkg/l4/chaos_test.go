@@ -0,0 +1,301 @@
+//go:build chaos
+// +build chaos
+
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package l4
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/mock"
+	"google.golang.org/api/compute/v1"
+	api_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/annotations"
+	backendconfigclient "k8s.io/ingress-gce/pkg/backendconfig/client/clientset/versioned/fake"
+	"k8s.io/ingress-gce/pkg/chaos"
+	"k8s.io/ingress-gce/pkg/context"
+	"k8s.io/ingress-gce/pkg/firewalls"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/ingress-gce/pkg/utils"
+	namer_util "k8s.io/ingress-gce/pkg/utils/namer"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+// The chaos harness syncs the load balancers of Services while GCE calls
+// fail or get delayed and the controller restarts, and checks that the
+// controller converges once the faults stop. Run it with:
+//
+//	go test -tags chaos ./pkg/l4/ -run TestChaos
+const (
+	chaosRounds      = 40
+	chaosRestartRate = 0.1
+	chaosServices    = 6
+	// convergeRounds is the number of fault-free rounds in which all
+	// Services must be synced without error.
+	convergeRounds = 5
+)
+
+var chaosConfig = chaos.Config{
+	ErrorRate: 0.2,
+	DelayRate: 0.05,
+	Delay:     time.Millisecond,
+	Seed:      time.Now().UnixNano(),
+}
+
+// detachCounter counts the endpoints detached from NEGs.
+type detachCounter struct {
+	negtypes.NetworkEndpointGroupCloud
+	lock     sync.Mutex
+	detached int
+}
+
+func (d *detachCounter) DetachNetworkEndpoints(name, zone string, endpoints []*compute.NetworkEndpoint) error {
+	err := d.NetworkEndpointGroupCloud.DetachNetworkEndpoints(name, zone, endpoints)
+	if err == nil {
+		d.lock.Lock()
+		d.detached += len(endpoints)
+		d.lock.Unlock()
+	}
+	return err
+}
+
+func (d *detachCounter) Detached() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.detached
+}
+
+type chaosHarness struct {
+	t          *testing.T
+	kubeClient kubernetes.Interface
+	fakeGCE    *gce.Cloud
+	negCloud   *detachCounter
+	firewall   firewalls.Firewall
+	injector   *chaos.Injector
+	namer      *namer_util.Namer
+
+	controller *Controller
+	stopCh     chan struct{}
+	restarts   int
+}
+
+func newChaosHarness(t *testing.T) *chaosHarness {
+	t.Logf("Chaos seed: %d", chaosConfig.Seed)
+	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	mockGCE := fakeGCE.Compute().(*cloud.MockGCE)
+	mockGCE.MockHealthChecks.UpdateHook = mock.UpdateHealthCheckHook
+	mockGCE.MockBetaRegionHealthChecks.UpdateHook = mock.UpdateBetaRegionHealthCheckHook
+	mockGCE.MockRegionBackendServices.UpdateHook = mock.UpdateRegionBackendServiceHook
+	injector := chaos.NewInjector(chaosConfig)
+	injector.InjectMockFaults(mockGCE)
+
+	h := &chaosHarness{
+		t:          t,
+		kubeClient: fake.NewSimpleClientset(),
+		fakeGCE:    fakeGCE,
+		negCloud:   &detachCounter{NetworkEndpointGroupCloud: injector.NetworkEndpointGroupCloud(negtypes.NewFakeNetworkEndpointGroupCloud("test-subnetwork", "test-network"))},
+		firewall:   injector.Firewall(firewalls.NewFakeFirewallsProvider(false, false)),
+		injector:   injector,
+		namer:      namer_util.NewNamer("uid1", "fw1"),
+	}
+	for _, zone := range []string{"zone-a", "zone-b", "zone-c"} {
+		for _, node := range newTestNodes(zone, 4) {
+			node.Status.Conditions = []api_v1.NodeCondition{{Type: api_v1.NodeReady, Status: api_v1.ConditionTrue}}
+			if _, err := h.kubeClient.CoreV1().Nodes().Create(node); err != nil {
+				t.Fatalf("Create(%s) = %v", node.Name, err)
+			}
+		}
+	}
+	for i := 0; i < chaosServices; i++ {
+		svc := newTestService(80, 443)
+		svc.Name = fmt.Sprintf("svc-%d", i)
+		if i%2 == 1 {
+			svc.Annotations = map[string]string{annotations.RBSAnnotationKey: annotations.RBSEnabled}
+		}
+		if _, err := h.kubeClient.CoreV1().Services(svc.Namespace).Create(svc); err != nil {
+			t.Fatalf("Create(%s) = %v", svc.Name, err)
+		}
+	}
+	h.restart()
+	return h
+}
+
+// restart replaces the controller and its informers by new ones, as when
+// the controller restarts.
+func (h *chaosHarness) restart() {
+	if h.stopCh != nil {
+		close(h.stopCh)
+		h.restarts++
+	}
+	ctxConfig := context.ControllerContextConfig{Namespace: api_v1.NamespaceAll, ResyncPeriod: time.Minute}
+	ctx := context.NewControllerContext(h.kubeClient, nil, backendconfigclient.NewSimpleClientset(), nil, h.fakeGCE, h.namer, ctxConfig)
+	h.controller = NewController(ctx, 2)
+	h.controller.l4 = NewL4(h.fakeGCE, h.negCloud, h.firewall, h.namer, 2)
+	h.stopCh = make(chan struct{})
+	ctx.Start(h.stopCh)
+	if !cache.WaitForCacheSync(h.stopCh, ctx.HasSynced) {
+		h.t.Fatalf("Informers did not sync")
+	}
+}
+
+// syncAll syncs all the Services once and returns the number of errors.
+func (h *chaosHarness) syncAll() int {
+	errors := 0
+	for i := 0; i < chaosServices; i++ {
+		if err := h.controller.sync(fmt.Sprintf("ns/svc-%d", i)); err != nil {
+			errors++
+		}
+	}
+	return errors
+}
+
+// runChaos syncs the Services with faults and restarts.
+func (h *chaosHarness) runChaos() {
+	h.injector.SetEnabled(true)
+	for round := 0; round < chaosRounds; round++ {
+		if h.injector.Roll(chaosRestartRate) {
+			h.restart()
+		}
+		h.syncAll()
+	}
+	h.injector.SetEnabled(false)
+	h.t.Logf("Injected %d errors and %d restarts so far", h.injector.Errors(), h.restarts)
+}
+
+// converge syncs the Services without faults until they all sync without
+// error, after waiting for the informers to catch up with the updates of
+// the Services.
+func (h *chaosHarness) converge() {
+	for round := 0; round < convergeRounds; round++ {
+		h.waitForInformers()
+		if h.syncAll() == 0 {
+			return
+		}
+	}
+	h.t.Fatalf("Services did not converge in %d rounds without faults", convergeRounds)
+}
+
+func (h *chaosHarness) waitForInformers() {
+	err := wait.Poll(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		for i := 0; i < chaosServices; i++ {
+			latest, err := h.kubeClient.CoreV1().Services("ns").Get(fmt.Sprintf("svc-%d", i), meta_v1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			obj, exists, err := h.controller.serviceLister.GetByKey("ns/" + latest.Name)
+			if err != nil || !exists || obj.(*api_v1.Service).ResourceVersion != latest.ResourceVersion {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		h.t.Fatalf("Informers did not catch up: %v", err)
+	}
+}
+
+func TestChaos(t *testing.T) {
+	h := newChaosHarness(t)
+	defer func() { close(h.stopCh) }()
+
+	h.runChaos()
+	h.converge()
+	for i := 0; i < chaosServices; i++ {
+		svc, err := h.kubeClient.CoreV1().Services("ns").Get(fmt.Sprintf("svc-%d", i), meta_v1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Get(svc-%d) = %v", i, err)
+		}
+		if !utils.HasFinalizer(svc.ObjectMeta, utils.ILBFinalizerV2) && !utils.HasFinalizer(svc.ObjectMeta, utils.NetLBFinalizerV2) {
+			t.Errorf("Service %s has no finalizer", svc.Name)
+		}
+		name := h.namer.L4Backend(svc.Namespace, svc.Name)
+		if _, err := h.fakeGCE.GetRegionForwardingRule(name, h.fakeGCE.Region()); err != nil {
+			t.Errorf("GetRegionForwardingRule(%q) = %v", name, err)
+		}
+	}
+	// The nodes never change, so no endpoint must ever be detached.
+	if detached := h.negCloud.Detached(); detached != 0 {
+		t.Errorf("Detached %d endpoints from NEGs while the nodes did not change", detached)
+	}
+
+	// Turning the Services into ClusterIP Services deletes their load
+	// balancers.
+	for i := 0; i < chaosServices; i++ {
+		svc, err := h.kubeClient.CoreV1().Services("ns").Get(fmt.Sprintf("svc-%d", i), meta_v1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Get(svc-%d) = %v", i, err)
+		}
+		svc.Spec.Type = api_v1.ServiceTypeClusterIP
+		if _, err := h.kubeClient.CoreV1().Services("ns").Update(svc); err != nil {
+			t.Fatalf("Update(%s) = %v", svc.Name, err)
+		}
+	}
+	h.waitForInformers()
+	h.runChaos()
+	h.converge()
+	h.checkNoOrphans()
+}
+
+// checkNoOrphans checks that no GCE resource or finalizer of the load
+// balancers remains.
+func (h *chaosHarness) checkNoOrphans() {
+	mockGCE := h.fakeGCE.Compute().(*cloud.MockGCE)
+	for resource, count := range map[string]int{
+		"forwarding rules":       len(mockGCE.MockForwardingRules.Objects),
+		"backend services":       len(mockGCE.MockRegionBackendServices.Objects),
+		"health checks":          len(mockGCE.MockHealthChecks.Objects),
+		"regional health checks": len(mockGCE.MockBetaRegionHealthChecks.Objects),
+	} {
+		if count != 0 {
+			h.t.Errorf("%d %s remain", count, resource)
+		}
+	}
+	negs, err := h.negCloud.AggregatedListNetworkEndpointGroup()
+	if err != nil {
+		h.t.Fatalf("AggregatedListNetworkEndpointGroup() = %v", err)
+	}
+	for zone, zoneNEGs := range negs {
+		for _, neg := range zoneNEGs {
+			h.t.Errorf("NEG %s remains in zone %s", neg.Name, zone)
+		}
+	}
+	for i := 0; i < chaosServices; i++ {
+		name := h.namer.L4Backend("ns", fmt.Sprintf("svc-%d", i))
+		for _, fw := range []string{name, healthCheckFirewall(name)} {
+			if _, err := h.firewall.GetFirewall(fw); !utils.IsNotFoundError(err) {
+				h.t.Errorf("GetFirewall(%q) = %v, want not found", fw, err)
+			}
+		}
+		svc, err := h.kubeClient.CoreV1().Services("ns").Get(fmt.Sprintf("svc-%d", i), meta_v1.GetOptions{})
+		if err != nil {
+			h.t.Fatalf("Get(svc-%d) = %v", i, err)
+		}
+		if len(svc.Finalizers) != 0 {
+			h.t.Errorf("Service %s still has finalizers %v", svc.Name, svc.Finalizers)
+		}
+	}
+}
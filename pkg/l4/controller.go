@@ -0,0 +1,299 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package l4
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	api_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/annotations"
+	"k8s.io/ingress-gce/pkg/context"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/klog"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+// Controller syncs the load balancers of the LoadBalancer Services with the
+// internal load balancer annotation, and of the external LoadBalancer Services
+// with the regional backend service annotation.
+type Controller struct {
+	ctx            *context.ControllerContext
+	l4             *L4
+	serviceLister  cache.Indexer
+	nodeLister     cache.Indexer
+	endpointLister cache.Indexer
+	queue          utils.TaskQueue
+}
+
+// NewController returns a new L4 controller.
+func NewController(ctx *context.ControllerContext, subsetSize int) *Controller {
+	c := &Controller{
+		ctx:            ctx,
+		l4:             NewL4(ctx.Cloud, negtypes.NewAdapter(ctx.Cloud), ctx.Cloud, ctx.ClusterNamer, subsetSize),
+		serviceLister:  ctx.ServiceInformer.GetIndexer(),
+		nodeLister:     ctx.NodeInformer.GetIndexer(),
+		endpointLister: ctx.EndpointInformer.GetIndexer(),
+	}
+	c.queue = utils.NewPeriodicTaskQueue("l4", "services", c.sync)
+
+	ctx.ServiceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if svc := obj.(*api_v1.Service); managed(svc) {
+				c.queue.Enqueue(svc)
+			}
+		},
+		UpdateFunc: func(old, cur interface{}) {
+			svc := cur.(*api_v1.Service)
+			if !managed(svc) {
+				return
+			}
+			if !reflect.DeepEqual(old.(*api_v1.Service).Spec, svc.Spec) || svc.DeletionTimestamp != nil || !reflect.DeepEqual(old.(*api_v1.Service).Annotations, svc.Annotations) {
+				c.queue.Enqueue(svc)
+			}
+		},
+	})
+	ctx.NodeInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { c.enqueueAll() },
+		DeleteFunc: func(interface{}) { c.enqueueAll() },
+		UpdateFunc: func(old, cur interface{}) {
+			if utils.GetNodeConditionPredicate()(old.(*api_v1.Node)) != utils.GetNodeConditionPredicate()(cur.(*api_v1.Node)) {
+				c.enqueueAll()
+			}
+		},
+	})
+	// Endpoints decide the nodes of services with the Local external
+	// traffic policy.
+	ctx.EndpointInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(old, cur interface{}) {
+			ep := cur.(*api_v1.Endpoints)
+			if reflect.DeepEqual(old.(*api_v1.Endpoints).Subsets, ep.Subsets) {
+				return
+			}
+			obj, exists, err := c.serviceLister.GetByKey(ep.Namespace + "/" + ep.Name)
+			if err != nil || !exists {
+				return
+			}
+			if svc := obj.(*api_v1.Service); (wantsILB(svc) || wantsNetLB(svc)) && svc.Spec.ExternalTrafficPolicy == api_v1.ServiceExternalTrafficPolicyTypeLocal {
+				c.queue.Enqueue(svc)
+			}
+		},
+	})
+	return c
+}
+
+// Run a goroutine to process updates for the controller.
+func (c *Controller) Run() {
+	c.queue.Run()
+}
+
+// Shutdown shuts down the goroutine that processes service updates.
+func (c *Controller) Shutdown() {
+	c.queue.Shutdown()
+}
+
+// enqueueAll enqueues all the services with a load balancer of the
+// controller.
+func (c *Controller) enqueueAll() {
+	for _, obj := range c.serviceLister.List() {
+		if svc := obj.(*api_v1.Service); wantsILB(svc) || wantsNetLB(svc) {
+			c.queue.Enqueue(svc)
+		}
+	}
+}
+
+func (c *Controller) sync(key string) error {
+	obj, exists, err := c.serviceLister.GetByKey(key)
+	if err != nil {
+		return fmt.Errorf("error getting service %s: %v", key, err)
+	}
+	if !exists {
+		// Services are only removed after the finalizer, so the load
+		// balancer is already gone.
+		klog.V(3).Infof("Service %s does not exist, skipping sync", key)
+		return nil
+	}
+	svc := obj.(*api_v1.Service)
+	svcClient := c.ctx.KubeClient.CoreV1().Services(svc.Namespace)
+
+	// A service switching between internal and external keeps the names of
+	// its resources, so the old load balancer is deleted first.
+	for _, lb := range c.loadBalancers() {
+		if svc.DeletionTimestamp == nil && lb.wants(svc) {
+			continue
+		}
+		if !utils.HasFinalizer(svc.ObjectMeta, lb.finalizer) {
+			continue
+		}
+		klog.V(2).Infof("Deleting %s load balancer of service %s", lb.scheme, key)
+		if err := lb.ensureDeleted(svc); err != nil {
+			c.ctx.Recorder(svc.Namespace).Eventf(svc, api_v1.EventTypeWarning, "DeleteLoadBalancerFailed", "Error deleting load balancer: %v", err)
+			return err
+		}
+		if svc.DeletionTimestamp == nil {
+			if err := c.updateStatus(svc, &api_v1.LoadBalancerStatus{}); err != nil {
+				return err
+			}
+		}
+		c.ctx.Recorder(svc.Namespace).Eventf(svc, api_v1.EventTypeNormal, "DeletedLoadBalancer", "Deleted load balancer")
+		if err := utils.RemoveServiceFinalizer(svc, lb.finalizer, svcClient); err != nil {
+			return err
+		}
+		// Sync the service again from its updated version.
+		if svc.DeletionTimestamp == nil && (wantsILB(svc) || wantsNetLB(svc)) {
+			c.queue.Enqueue(svc)
+		}
+		return nil
+	}
+	if svc.DeletionTimestamp != nil {
+		return nil
+	}
+
+	for _, lb := range c.loadBalancers() {
+		if !lb.wants(svc) {
+			continue
+		}
+		if err := utils.AddServiceFinalizer(svc, lb.finalizer, svcClient); err != nil {
+			return err
+		}
+		nodes, err := c.nodes(svc)
+		if err != nil {
+			return err
+		}
+		status, err := lb.ensure(svc, nodes)
+		if err != nil {
+			c.ctx.Recorder(svc.Namespace).Eventf(svc, api_v1.EventTypeWarning, "SyncLoadBalancerFailed", "Error syncing load balancer: %v", err)
+			return err
+		}
+		if reflect.DeepEqual(svc.Status.LoadBalancer, *status) {
+			return nil
+		}
+		if err := c.updateStatus(svc, status); err != nil {
+			return err
+		}
+		c.ctx.Recorder(svc.Namespace).Eventf(svc, api_v1.EventTypeNormal, "EnsuredLoadBalancer", "Ensured load balancer")
+	}
+	return nil
+}
+
+// loadBalancer is a kind of load balancer synced by the controller.
+type loadBalancer struct {
+	scheme        cloud.LbScheme
+	finalizer     string
+	wants         func(*api_v1.Service) bool
+	ensure        func(*api_v1.Service, []*api_v1.Node) (*api_v1.LoadBalancerStatus, error)
+	ensureDeleted func(*api_v1.Service) error
+}
+
+func (c *Controller) loadBalancers() []loadBalancer {
+	return []loadBalancer{
+		{
+			scheme:        cloud.SchemeInternal,
+			finalizer:     utils.ILBFinalizerV2,
+			wants:         wantsILB,
+			ensure:        c.l4.EnsureInternalLoadBalancer,
+			ensureDeleted: c.l4.EnsureInternalLoadBalancerDeleted,
+		},
+		{
+			scheme:        cloud.SchemeExternal,
+			finalizer:     utils.NetLBFinalizerV2,
+			wants:         wantsNetLB,
+			ensure:        c.l4.EnsureExternalLoadBalancer,
+			ensureDeleted: c.l4.EnsureExternalLoadBalancerDeleted,
+		},
+	}
+}
+
+// nodes returns the nodes that can back the load balancer of the service.
+// These are the ready nodes running endpoints of services with the Local
+// external traffic policy, and all ready nodes otherwise.
+func (c *Controller) nodes(svc *api_v1.Service) ([]*api_v1.Node, error) {
+	nodes, err := listers.NewNodeLister(c.nodeLister).ListWithPredicate(utils.GetNodeConditionPredicate())
+	if err != nil {
+		return nil, err
+	}
+	if svc.Spec.ExternalTrafficPolicy != api_v1.ServiceExternalTrafficPolicyTypeLocal {
+		return nodes, nil
+	}
+	obj, exists, err := c.endpointLister.GetByKey(svc.Namespace + "/" + svc.Name)
+	if err != nil || !exists {
+		return nil, err
+	}
+	endpointNodes := sets.NewString()
+	for _, subset := range obj.(*api_v1.Endpoints).Subsets {
+		for _, addr := range subset.Addresses {
+			if addr.NodeName != nil {
+				endpointNodes.Insert(*addr.NodeName)
+			}
+		}
+	}
+	var result []*api_v1.Node
+	for _, node := range nodes {
+		if endpointNodes.Has(node.Name) {
+			result = append(result, node)
+		}
+	}
+	return result, nil
+}
+
+// updateStatus updates the status of the latest version of the service, as
+// the finalizer may just have been added to it.
+func (c *Controller) updateStatus(svc *api_v1.Service, status *api_v1.LoadBalancerStatus) error {
+	svcClient := c.ctx.KubeClient.CoreV1().Services(svc.Namespace)
+	latest, err := svcClient.Get(svc.Name, meta_v1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error getting service %s/%s: %v", svc.Namespace, svc.Name, err)
+	}
+	latest.Status.LoadBalancer = *status
+	if _, err := svcClient.UpdateStatus(latest); err != nil {
+		return fmt.Errorf("error updating status of service %s/%s: %v", svc.Namespace, svc.Name, err)
+	}
+	return nil
+}
+
+// wantsILB returns true if the service is a LoadBalancer Service with the
+// internal load balancer annotation.
+func wantsILB(svc *api_v1.Service) bool {
+	if svc.Spec.Type != api_v1.ServiceTypeLoadBalancer {
+		return false
+	}
+	lbType, ok := gce.GetLoadBalancerAnnotationType(svc)
+	return ok && lbType == gce.LBTypeInternal
+}
+
+// wantsNetLB returns true if the service is an external LoadBalancer Service
+// with the regional backend service annotation.
+func wantsNetLB(svc *api_v1.Service) bool {
+	if svc.Spec.Type != api_v1.ServiceTypeLoadBalancer || wantsILB(svc) {
+		return false
+	}
+	return svc.Annotations[annotations.RBSAnnotationKey] == annotations.RBSEnabled
+}
+
+// managed returns true if the service has or had a load balancer of the
+// controller.
+func managed(svc *api_v1.Service) bool {
+	return wantsILB(svc) || wantsNetLB(svc) ||
+		utils.HasFinalizer(svc.ObjectMeta, utils.ILBFinalizerV2) ||
+		utils.HasFinalizer(svc.ObjectMeta, utils.NetLBFinalizerV2)
+}
@@ -0,0 +1,604 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package l4
+
+import (
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"google.golang.org/api/compute/v1"
+	api_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/ingress-gce/pkg/annotations"
+	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/firewalls"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/ingress-gce/pkg/utils/namer"
+	"k8s.io/klog"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+const (
+	// maxForwardingRulePorts is the number of ports a forwarding rule can
+	// list, forwarding rules of services with more ports forward all ports.
+	maxForwardingRulePorts = 5
+
+	// Health check settings of the cloud provider for L4 load balancers.
+	healthCheckIntervalSec        = 8
+	healthCheckTimeoutSec         = 1
+	healthCheckHealthyThreshold   = 1
+	healthCheckUnhealthyThreshold = 3
+)
+
+// L4 ensures the GCE resources of the load balancers of LoadBalancer
+// Services. Instead of instance groups or target pools of all nodes, the
+// backend service of each load balancer points to zonal GCE_VM_IP NEGs holding
+// a subset of the nodes, so that the load balancers of large clusters stay
+// within the backend limits of GCE.
+type L4 struct {
+	cloud    *gce.Cloud
+	negCloud negtypes.NetworkEndpointGroupCloud
+	firewall firewalls.Firewall
+	namer    namer.IngressNamer
+	// subsetSize is the maximum number of nodes per zone in the NEGs of a
+	// load balancer.
+	subsetSize int
+}
+
+// NewL4 returns a new L4.
+func NewL4(cloud *gce.Cloud, negCloud negtypes.NetworkEndpointGroupCloud, firewall firewalls.Firewall, namer namer.IngressNamer, subsetSize int) *L4 {
+	return &L4{
+		cloud:      cloud,
+		negCloud:   negCloud,
+		firewall:   firewall,
+		namer:      namer,
+		subsetSize: subsetSize,
+	}
+}
+
+// EnsureInternalLoadBalancer ensures the internal load balancer of the
+// service, backed by a subset of the given nodes, and returns its status.
+// For services with the Local external traffic policy, nodes must only
+// contain the nodes running endpoints of the service.
+func (l *L4) EnsureInternalLoadBalancer(svc *api_v1.Service, nodes []*api_v1.Node) (*api_v1.LoadBalancerStatus, error) {
+	return l.ensureLoadBalancer(svc, nodes, cloud.SchemeInternal)
+}
+
+// EnsureExternalLoadBalancer ensures the external network load balancer of
+// the service, with a regional backend service backed by a subset of the
+// given nodes, and returns its status.
+func (l *L4) EnsureExternalLoadBalancer(svc *api_v1.Service, nodes []*api_v1.Node) (*api_v1.LoadBalancerStatus, error) {
+	return l.ensureLoadBalancer(svc, nodes, cloud.SchemeExternal)
+}
+
+// EnsureInternalLoadBalancerDeleted deletes the GCE resources of the internal
+// load balancer of the service.
+func (l *L4) EnsureInternalLoadBalancerDeleted(svc *api_v1.Service) error {
+	return l.ensureLoadBalancerDeleted(svc, cloud.SchemeInternal)
+}
+
+// EnsureExternalLoadBalancerDeleted deletes the GCE resources of the external
+// load balancer of the service.
+func (l *L4) EnsureExternalLoadBalancerDeleted(svc *api_v1.Service) error {
+	return l.ensureLoadBalancerDeleted(svc, cloud.SchemeExternal)
+}
+
+func (l *L4) ensureLoadBalancer(svc *api_v1.Service, nodes []*api_v1.Node, scheme cloud.LbScheme) (*api_v1.LoadBalancerStatus, error) {
+	name := l.namer.L4Backend(svc.Namespace, svc.Name)
+	ports, protocol, err := servicePorts(svc)
+	if err != nil {
+		return nil, err
+	}
+	description := fmt.Sprintf(`{"kubernetes.io/service-name":"%s/%s"}`, svc.Namespace, svc.Name)
+
+	negLinks, err := l.ensureNEGs(name, subsetNodes(nodes, svc.Namespace+"/"+svc.Name, l.subsetSize))
+	if err != nil {
+		return nil, fmt.Errorf("error ensuring NEGs: %v", err)
+	}
+	hcLink, hcPort, err := l.ensureHealthCheck(name, description, svc, scheme)
+	if err != nil {
+		return nil, fmt.Errorf("error ensuring health check: %v", err)
+	}
+	bsLink, err := l.ensureBackendService(name, description, svc, scheme, protocol, hcLink, negLinks)
+	if err != nil {
+		return nil, fmt.Errorf("error ensuring backend service: %v", err)
+	}
+
+	nodeNames := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		nodeNames = append(nodeNames, node.Name)
+	}
+	sourceRanges := svc.Spec.LoadBalancerSourceRanges
+	if len(sourceRanges) == 0 {
+		sourceRanges = []string{"0.0.0.0/0"}
+	}
+	if err := l.ensureFirewall(name, description, sourceRanges, protocol, ports, nodeNames); err != nil {
+		return nil, fmt.Errorf("error ensuring firewall rule: %v", err)
+	}
+	hcPorts := []string{strconv.Itoa(int(hcPort))}
+	if err := l.ensureFirewall(healthCheckFirewall(name), description, gce.LoadBalancerSrcRanges(), string(api_v1.ProtocolTCP), hcPorts, nodeNames); err != nil {
+		return nil, fmt.Errorf("error ensuring health check firewall rule: %v", err)
+	}
+
+	fr, err := l.ensureForwardingRule(name, description, svc, scheme, protocol, ports, bsLink)
+	if err != nil {
+		return nil, fmt.Errorf("error ensuring forwarding rule: %v", err)
+	}
+	return &api_v1.LoadBalancerStatus{Ingress: []api_v1.LoadBalancerIngress{{IP: fr.IPAddress}}}, nil
+}
+
+func (l *L4) ensureLoadBalancerDeleted(svc *api_v1.Service, scheme cloud.LbScheme) error {
+	name := l.namer.L4Backend(svc.Namespace, svc.Name)
+	if err := utils.IgnoreHTTPNotFound(l.cloud.DeleteRegionForwardingRule(name, l.cloud.Region())); err != nil {
+		return fmt.Errorf("error deleting forwarding rule %s: %v", name, err)
+	}
+	l.releaseAddress(name, l.cloud.Region())
+	for _, fw := range []string{name, healthCheckFirewall(name)} {
+		if err := utils.IgnoreHTTPNotFound(l.firewall.DeleteFirewall(fw)); err != nil {
+			return fmt.Errorf("error deleting firewall rule %s: %v", fw, err)
+		}
+	}
+	if err := utils.IgnoreHTTPNotFound(l.cloud.DeleteRegionBackendService(name, l.cloud.Region())); err != nil {
+		return fmt.Errorf("error deleting backend service %s: %v", name, err)
+	}
+	key, version := l.healthCheckKey(name, scheme)
+	if err := utils.IgnoreHTTPNotFound(composite.DeleteHealthCheck(l.cloud, key, version)); err != nil {
+		return fmt.Errorf("error deleting health check %s: %v", name, err)
+	}
+	negs, err := l.negCloud.AggregatedListNetworkEndpointGroup()
+	if err != nil {
+		return err
+	}
+	for zone, zoneNEGs := range negs {
+		for _, neg := range zoneNEGs {
+			if neg.Name != name {
+				continue
+			}
+			klog.V(2).Infof("Deleting NEG %s in zone %s", name, zone)
+			if err := utils.IgnoreHTTPNotFound(l.negCloud.DeleteNetworkEndpointGroup(name, zone)); err != nil {
+				return fmt.Errorf("error deleting NEG %s in zone %s: %v", name, zone, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ensureNEGs ensures a GCE_VM_IP NEG in each zone of nodesByZone holding the
+// nodes of the zone, and returns the links of the NEGs.
+func (l *L4) ensureNEGs(name string, nodesByZone map[string][]*api_v1.Node) ([]string, error) {
+	var links []string
+	zones := make([]string, 0, len(nodesByZone))
+	for zone := range nodesByZone {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+	for _, zone := range zones {
+		neg, err := l.negCloud.GetNetworkEndpointGroup(name, zone)
+		if utils.IsNotFoundError(err) {
+			klog.V(2).Infof("Creating NEG %s in zone %s", name, zone)
+			neg = &compute.NetworkEndpointGroup{
+				Name:                name,
+				NetworkEndpointType: string(negtypes.VmIpEndpointType),
+				Network:             l.negCloud.NetworkURL(),
+				Subnetwork:          l.negCloud.SubnetworkURL(),
+			}
+			if err = l.negCloud.CreateNetworkEndpointGroup(neg, zone); err == nil {
+				neg, err = l.negCloud.GetNetworkEndpointGroup(name, zone)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := l.ensureNEGEndpoints(name, zone, nodesByZone[zone]); err != nil {
+			return nil, err
+		}
+		links = append(links, neg.SelfLink)
+	}
+	return links, nil
+}
+
+// ensureNEGEndpoints attaches the nodes to the NEG in the zone and detaches
+// the other endpoints.
+func (l *L4) ensureNEGEndpoints(name, zone string, nodes []*api_v1.Node) error {
+	want := map[string]*compute.NetworkEndpoint{}
+	for _, node := range nodes {
+		ip := nodeInternalIP(node)
+		if ip == "" {
+			klog.Warningf("Node %s has no internal IP, skipping it for NEG %s", node.Name, name)
+			continue
+		}
+		want[node.Name] = &compute.NetworkEndpoint{Instance: node.Name, IpAddress: ip}
+	}
+	current, err := l.negCloud.ListNetworkEndpoints(name, zone, false)
+	if err != nil {
+		return err
+	}
+	var detach []*compute.NetworkEndpoint
+	for _, ep := range current {
+		if wantEP, ok := want[ep.NetworkEndpoint.Instance]; ok && wantEP.IpAddress == ep.NetworkEndpoint.IpAddress {
+			delete(want, ep.NetworkEndpoint.Instance)
+			continue
+		}
+		detach = append(detach, ep.NetworkEndpoint)
+	}
+	if len(detach) > 0 {
+		klog.V(2).Infof("Detaching %d endpoints from NEG %s in zone %s", len(detach), name, zone)
+		if err := l.negCloud.DetachNetworkEndpoints(name, zone, detach); err != nil {
+			return err
+		}
+	}
+	if len(want) == 0 {
+		return nil
+	}
+	attach := make([]*compute.NetworkEndpoint, 0, len(want))
+	for _, ep := range want {
+		attach = append(attach, ep)
+	}
+	sort.Slice(attach, func(i, j int) bool { return attach[i].Instance < attach[j].Instance })
+	klog.V(2).Infof("Attaching %d endpoints to NEG %s in zone %s", len(attach), name, zone)
+	return l.negCloud.AttachNetworkEndpoints(name, zone, attach)
+}
+
+// ensureHealthCheck ensures the HTTP health check of the nodes backing the
+// service, and returns its link and port. Services with the Local external
+// traffic policy are checked on their health check node port, so that only
+// the nodes running endpoints are healthy. The other services are checked on
+// the health endpoint of kube-proxy.
+func (l *L4) ensureHealthCheck(name, description string, svc *api_v1.Service, scheme cloud.LbScheme) (string, int32, error) {
+	port, path := gce.GetNodesHealthCheckPort(), gce.GetNodesHealthCheckPath()
+	if svc.Spec.ExternalTrafficPolicy == api_v1.ServiceExternalTrafficPolicyTypeLocal && svc.Spec.HealthCheckNodePort != 0 {
+		port, path = svc.Spec.HealthCheckNodePort, "/healthz"
+	}
+	key, version := l.healthCheckKey(name, scheme)
+	want := &composite.HealthCheck{
+		Version:            version,
+		Name:               name,
+		Description:        description,
+		Type:               "HTTP",
+		CheckIntervalSec:   healthCheckIntervalSec,
+		TimeoutSec:         healthCheckTimeoutSec,
+		HealthyThreshold:   healthCheckHealthyThreshold,
+		UnhealthyThreshold: healthCheckUnhealthyThreshold,
+		HttpHealthCheck: &composite.HTTPHealthCheck{
+			Port:        int64(port),
+			RequestPath: path,
+		},
+	}
+	hc, err := composite.GetHealthCheck(l.cloud, key, version)
+	if utils.IsNotFoundError(err) {
+		klog.V(2).Infof("Creating health check %s", name)
+		if err := composite.CreateHealthCheck(l.cloud, key, want); err != nil {
+			return "", 0, err
+		}
+		hc, err = composite.GetHealthCheck(l.cloud, key, version)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if hc.HttpHealthCheck == nil || hc.HttpHealthCheck.Port != want.HttpHealthCheck.Port || hc.HttpHealthCheck.RequestPath != want.HttpHealthCheck.RequestPath {
+		klog.V(2).Infof("Updating health check %s", name)
+		if err := composite.UpdateHealthCheck(l.cloud, key, want); err != nil {
+			return "", 0, err
+		}
+	}
+	return hc.SelfLink, port, nil
+}
+
+// healthCheckKey returns the key and the API version of the health check of
+// a load balancer. Backend services of external network load balancers only
+// accept regional health checks, which are not in the GA API.
+func (l *L4) healthCheckKey(name string, scheme cloud.LbScheme) (*meta.Key, meta.Version) {
+	if scheme == cloud.SchemeExternal {
+		return meta.RegionalKey(name, l.cloud.Region()), meta.VersionBeta
+	}
+	return meta.GlobalKey(name), meta.VersionGA
+}
+
+// ensureBackendService ensures the regional backend service of the service,
+// pointing to the given NEGs, and returns its link.
+func (l *L4) ensureBackendService(name, description string, svc *api_v1.Service, scheme cloud.LbScheme, protocol, hcLink string, negLinks []string) (string, error) {
+	want := &compute.BackendService{
+		Name:                name,
+		Description:         description,
+		Protocol:            protocol,
+		LoadBalancingScheme: string(scheme),
+		HealthChecks:        []string{hcLink},
+		SessionAffinity:     sessionAffinity(svc),
+	}
+	for _, link := range negLinks {
+		want.Backends = append(want.Backends, &compute.Backend{Group: link, BalancingMode: "CONNECTION"})
+	}
+	region := l.cloud.Region()
+	bs, err := l.cloud.GetRegionBackendService(name, region)
+	if utils.IsNotFoundError(err) {
+		klog.V(2).Infof("Creating backend service %s", name)
+		if err := l.cloud.CreateRegionBackendService(want, region); err != nil {
+			return "", err
+		}
+		bs, err = l.cloud.GetRegionBackendService(name, region)
+	}
+	if err != nil {
+		return "", err
+	}
+	if bs.Protocol != want.Protocol || bs.LoadBalancingScheme != want.LoadBalancingScheme || bs.SessionAffinity != want.SessionAffinity || !reflect.DeepEqual(bs.HealthChecks, want.HealthChecks) || !sameGroups(bs.Backends, want.Backends) {
+		klog.V(2).Infof("Updating backend service %s", name)
+		want.Fingerprint = bs.Fingerprint
+		if err := l.cloud.UpdateRegionBackendService(want, region); err != nil {
+			return "", err
+		}
+	}
+	return bs.SelfLink, nil
+}
+
+// ensureFirewall ensures the firewall rule allowing the ports from the source
+// ranges to the nodes.
+func (l *L4) ensureFirewall(name, description string, sourceRanges []string, protocol string, ports []string, nodeNames []string) error {
+	targetTags, err := l.firewall.GetNodeTags(nodeNames)
+	if err != nil {
+		return err
+	}
+	want := &compute.Firewall{
+		Name:         name,
+		Description:  description,
+		Network:      l.firewall.NetworkURL(),
+		SourceRanges: sourceRanges,
+		TargetTags:   targetTags,
+		Allowed:      []*compute.FirewallAllowed{{IPProtocol: strings.ToLower(protocol), Ports: ports}},
+	}
+	fw, err := l.firewall.GetFirewall(name)
+	if utils.IsNotFoundError(err) {
+		klog.V(2).Infof("Creating firewall rule %s", name)
+		return l.firewall.CreateFirewall(want)
+	}
+	if err != nil {
+		return err
+	}
+	if sets.NewString(fw.SourceRanges...).Equal(sets.NewString(sourceRanges...)) &&
+		sets.NewString(fw.TargetTags...).Equal(sets.NewString(targetTags...)) &&
+		reflect.DeepEqual(fw.Allowed, want.Allowed) {
+		return nil
+	}
+	klog.V(2).Infof("Updating firewall rule %s", name)
+	return l.firewall.UpdateFirewall(want)
+}
+
+// ensureForwardingRule ensures the forwarding rule of the service. Forwarding
+// rules cannot be updated, so a rule with other settings is deleted and
+// created again. Internal forwarding rules list the ports of the service,
+// external ones forward the range between its lowest and highest port.
+func (l *L4) ensureForwardingRule(name, description string, svc *api_v1.Service, scheme cloud.LbScheme, protocol string, ports []string, bsLink string) (*compute.ForwardingRule, error) {
+	want := &compute.ForwardingRule{
+		Name:                name,
+		Description:         description,
+		IPAddress:           svc.Spec.LoadBalancerIP,
+		IPProtocol:          protocol,
+		LoadBalancingScheme: string(scheme),
+		BackendService:      bsLink,
+	}
+	switch {
+	case scheme == cloud.SchemeExternal:
+		want.PortRange = portRange(svc)
+	case len(ports) > maxForwardingRulePorts:
+		want.AllPorts = true
+	default:
+		want.Ports = ports
+	}
+	if scheme == cloud.SchemeInternal {
+		want.Network = l.cloud.NetworkURL()
+		want.Subnetwork = l.cloud.SubnetworkURL()
+	}
+	region := l.cloud.Region()
+	fr, err := l.cloud.GetRegionForwardingRule(name, region)
+	if err != nil && !utils.IsNotFoundError(err) {
+		return nil, err
+	}
+	if fr != nil && !forwardingRuleEqual(fr, want) {
+		// Keep the IP of the service when it has no requested IP, it would
+		// otherwise get a new ephemeral IP.
+		if want.IPAddress == "" {
+			want.IPAddress = fr.IPAddress
+			release, err := l.reserveAddress(name, fr, region)
+			if err != nil {
+				return nil, err
+			}
+			defer release()
+		}
+		klog.V(2).Infof("Deleting forwarding rule %s to recreate it", name)
+		if err := utils.IgnoreHTTPNotFound(l.cloud.DeleteRegionForwardingRule(name, region)); err != nil {
+			return nil, err
+		}
+		fr = nil
+	}
+	if fr == nil && want.IPAddress == "" {
+		// Recreate the forwarding rule with the IP reserved by a previous
+		// sync which failed to recreate it.
+		addr, err := l.cloud.GetRegionAddress(name, region)
+		if err != nil && !utils.IsNotFoundError(err) {
+			return nil, err
+		}
+		if addr != nil {
+			want.IPAddress = addr.Address
+			defer l.releaseAddress(name, region)
+		}
+	}
+	if fr == nil {
+		klog.V(2).Infof("Creating forwarding rule %s", name)
+		if err := l.cloud.CreateRegionForwardingRule(want, region); err != nil {
+			return nil, err
+		}
+		if fr, err = l.cloud.GetRegionForwardingRule(name, region); err != nil {
+			return nil, err
+		}
+	}
+	return fr, nil
+}
+
+// reserveAddress reserves the IP address of the forwarding rule under the
+// given name, unless it is already reserved by the user, so that it is not
+// released when the forwarding rule is deleted. The returned func releases
+// the reservation once the forwarding rule is recreated with the address.
+func (l *L4) reserveAddress(name string, fr *compute.ForwardingRule, region string) (func(), error) {
+	release := func() { l.releaseAddress(name, region) }
+	if addr, err := l.cloud.GetRegionAddressByIP(region, fr.IPAddress); err == nil {
+		if addr.Name == name {
+			return release, nil
+		}
+		return func() {}, nil
+	} else if !utils.IsNotFoundError(err) {
+		return nil, err
+	}
+	addr := &compute.Address{
+		Name:        name,
+		Description: fmt.Sprintf("IP of forwarding rule %s kept while it is recreated", name),
+		Address:     fr.IPAddress,
+		AddressType: "EXTERNAL",
+	}
+	if fr.LoadBalancingScheme == string(cloud.SchemeInternal) {
+		addr.AddressType = "INTERNAL"
+		addr.Subnetwork = fr.Subnetwork
+	}
+	klog.V(2).Infof("Reserving IP %s of forwarding rule %s", fr.IPAddress, name)
+	if err := l.cloud.ReserveRegionAddress(addr, region); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// releaseAddress deletes the reservation made by reserveAddress. A failure
+// is only logged, the reservation is released by the next recreation.
+func (l *L4) releaseAddress(name, region string) {
+	if err := utils.IgnoreHTTPNotFound(l.cloud.DeleteRegionAddress(name, region)); err != nil {
+		klog.Errorf("Failed to release the IP reserved as %s: %v", name, err)
+	}
+}
+
+// forwardingRuleEqual returns true if the existing forwarding rule has the
+// settings of want. An IP address is only compared if one is requested.
+func forwardingRuleEqual(existing, want *compute.ForwardingRule) bool {
+	return (want.IPAddress == "" || existing.IPAddress == want.IPAddress) &&
+		existing.IPProtocol == want.IPProtocol &&
+		existing.LoadBalancingScheme == want.LoadBalancingScheme &&
+		existing.AllPorts == want.AllPorts &&
+		existing.PortRange == want.PortRange &&
+		sets.NewString(existing.Ports...).Equal(sets.NewString(want.Ports...)) &&
+		utils.EqualResourceIDs(existing.BackendService, want.BackendService)
+}
+
+// sameGroups returns true if both lists of backends point to the same groups.
+func sameGroups(a, b []*compute.Backend) bool {
+	groups := func(backends []*compute.Backend) sets.String {
+		s := sets.NewString()
+		for _, be := range backends {
+			s.Insert(be.Group)
+		}
+		return s
+	}
+	return groups(a).Equal(groups(b))
+}
+
+// servicePorts returns the ports and the protocol of the service. The ports
+// of a load balancer share one protocol.
+func servicePorts(svc *api_v1.Service) ([]string, string, error) {
+	if len(svc.Spec.Ports) == 0 {
+		return nil, "", fmt.Errorf("service %s/%s has no ports", svc.Namespace, svc.Name)
+	}
+	protocol := svc.Spec.Ports[0].Protocol
+	var ports []string
+	for _, port := range svc.Spec.Ports {
+		if port.Protocol != protocol {
+			return nil, "", fmt.Errorf("service %s/%s mixes protocols %s and %s, which load balancers do not support", svc.Namespace, svc.Name, protocol, port.Protocol)
+		}
+		ports = append(ports, strconv.Itoa(int(port.Port)))
+	}
+	return ports, string(protocol), nil
+}
+
+// portRange returns the range between the lowest and the highest port of
+// the service.
+func portRange(svc *api_v1.Service) string {
+	min, max := svc.Spec.Ports[0].Port, svc.Spec.Ports[0].Port
+	for _, port := range svc.Spec.Ports[1:] {
+		if port.Port < min {
+			min = port.Port
+		}
+		if port.Port > max {
+			max = port.Port
+		}
+	}
+	return fmt.Sprintf("%d-%d", min, max)
+}
+
+func sessionAffinity(svc *api_v1.Service) string {
+	if svc.Spec.SessionAffinity == api_v1.ServiceAffinityClientIP {
+		return "CLIENT_IP"
+	}
+	return "NONE"
+}
+
+func healthCheckFirewall(name string) string {
+	return name + "-hc"
+}
+
+func nodeInternalIP(node *api_v1.Node) string {
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == api_v1.NodeInternalIP {
+			return addr.Address
+		}
+	}
+	return ""
+}
+
+// subsetNodes groups the nodes by zone and picks at most size nodes in each
+// zone. The nodes are ordered by a hash of the node name salted with the
+// service key, so that each load balancer picks a stable subset and the
+// subsets of different load balancers are spread over the nodes.
+func subsetNodes(nodes []*api_v1.Node, svcKey string, size int) map[string][]*api_v1.Node {
+	hash := func(node *api_v1.Node) uint32 {
+		h := fnv.New32a()
+		h.Write([]byte(svcKey + "/" + node.Name))
+		return h.Sum32()
+	}
+	byZone := map[string][]*api_v1.Node{}
+	for _, node := range nodes {
+		zone := node.Labels[annotations.ZoneKey]
+		if zone == "" {
+			klog.Warningf("Node %s has no zone label, skipping it", node.Name)
+			continue
+		}
+		byZone[zone] = append(byZone[zone], node)
+	}
+	for zone, zoneNodes := range byZone {
+		sort.Slice(zoneNodes, func(i, j int) bool {
+			hi, hj := hash(zoneNodes[i]), hash(zoneNodes[j])
+			if hi != hj {
+				return hi < hj
+			}
+			return zoneNodes[i].Name < zoneNodes[j].Name
+		})
+		if size > 0 && len(zoneNodes) > size {
+			byZone[zone] = zoneNodes[:size]
+		}
+	}
+	return byZone
+}
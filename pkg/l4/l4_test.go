@@ -0,0 +1,314 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package l4
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/mock"
+	"google.golang.org/api/compute/v1"
+	api_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/ingress-gce/pkg/annotations"
+	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/firewalls"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/ingress-gce/pkg/utils"
+	namer_util "k8s.io/ingress-gce/pkg/utils/namer"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+func newTestL4(subsetSize int) (*L4, *negtypes.FakeNetworkEndpointGroupCloud) {
+	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	(fakeGCE.Compute().(*cloud.MockGCE)).MockHealthChecks.UpdateHook = mock.UpdateHealthCheckHook
+	(fakeGCE.Compute().(*cloud.MockGCE)).MockBetaRegionHealthChecks.UpdateHook = mock.UpdateBetaRegionHealthCheckHook
+	(fakeGCE.Compute().(*cloud.MockGCE)).MockRegionBackendServices.UpdateHook = mock.UpdateRegionBackendServiceHook
+	// Forwarding rules without requested IP get an ephemeral IP.
+	(fakeGCE.Compute().(*cloud.MockGCE)).MockForwardingRules.InsertHook = func(ctx context.Context, key *meta.Key, obj *compute.ForwardingRule, m *cloud.MockForwardingRules) (bool, error) {
+		if obj.IPAddress == "" {
+			obj.IPAddress = "1.2.3.4"
+		}
+		return false, nil
+	}
+	negCloud := negtypes.NewFakeNetworkEndpointGroupCloud("test-subnetwork", "test-network")
+	namer := namer_util.NewNamer("uid1", "fw1")
+	return NewL4(fakeGCE, negCloud, firewalls.NewFakeFirewallsProvider(false, false), namer, subsetSize), negCloud.(*negtypes.FakeNetworkEndpointGroupCloud)
+}
+
+func newTestService(ports ...int32) *api_v1.Service {
+	svc := &api_v1.Service{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:        "svc",
+			Namespace:   "ns",
+			Annotations: map[string]string{gce.ServiceAnnotationLoadBalancerType: string(gce.LBTypeInternal)},
+		},
+		Spec: api_v1.ServiceSpec{Type: api_v1.ServiceTypeLoadBalancer},
+	}
+	for _, port := range ports {
+		svc.Spec.Ports = append(svc.Spec.Ports, api_v1.ServicePort{Port: port, Protocol: api_v1.ProtocolTCP})
+	}
+	return svc
+}
+
+func newTestNodes(zone string, count int) []*api_v1.Node {
+	var nodes []*api_v1.Node
+	for i := 0; i < count; i++ {
+		nodes = append(nodes, &api_v1.Node{
+			ObjectMeta: meta_v1.ObjectMeta{
+				Name:   fmt.Sprintf("%s-node-%d", zone, i),
+				Labels: map[string]string{annotations.ZoneKey: zone},
+			},
+			Status: api_v1.NodeStatus{
+				Addresses: []api_v1.NodeAddress{{Type: api_v1.NodeInternalIP, Address: fmt.Sprintf("10.0.%d.%d", len(zone), i)}},
+			},
+		})
+	}
+	return nodes
+}
+
+func TestEnsureInternalLoadBalancer(t *testing.T) {
+	l, negCloud := newTestL4(2)
+	svc := newTestService(80, 443)
+	nodes := append(newTestNodes("zone-a", 3), newTestNodes("zone-bb", 1)...)
+
+	if _, err := l.EnsureInternalLoadBalancer(svc, nodes); err != nil {
+		t.Fatalf("EnsureInternalLoadBalancer() = %v", err)
+	}
+	name := l.namer.L4Backend(svc.Namespace, svc.Name)
+
+	for zone, want := range map[string]int{"zone-a": 2, "zone-bb": 1} {
+		if _, err := negCloud.GetNetworkEndpointGroup(name, zone); err != nil {
+			t.Fatalf("GetNetworkEndpointGroup(%q, %q) = %v", name, zone, err)
+		}
+		eps, err := negCloud.ListNetworkEndpoints(name, zone, false)
+		if err != nil {
+			t.Fatalf("ListNetworkEndpoints(%q, %q) = %v", name, zone, err)
+		}
+		if len(eps) != want {
+			t.Errorf("NEG in zone %q has %d endpoints, want %d", zone, len(eps), want)
+		}
+	}
+	bs, err := l.cloud.GetRegionBackendService(name, l.cloud.Region())
+	if err != nil {
+		t.Fatalf("GetRegionBackendService(%q) = %v", name, err)
+	}
+	if len(bs.Backends) != 2 || bs.LoadBalancingScheme != string(cloud.SchemeInternal) || bs.Protocol != "TCP" {
+		t.Errorf("Got backend service %+v, want 2 backends, scheme INTERNAL and protocol TCP", bs)
+	}
+	hc, err := l.cloud.GetHealthCheck(name)
+	if err != nil {
+		t.Fatalf("GetHealthCheck(%q) = %v", name, err)
+	}
+	if hc.HttpHealthCheck.Port != int64(gce.GetNodesHealthCheckPort()) {
+		t.Errorf("Got health check port %d, want %d", hc.HttpHealthCheck.Port, gce.GetNodesHealthCheckPort())
+	}
+	fr, err := l.cloud.GetRegionForwardingRule(name, l.cloud.Region())
+	if err != nil {
+		t.Fatalf("GetRegionForwardingRule(%q) = %v", name, err)
+	}
+	if len(fr.Ports) != 2 || !utils.EqualResourceIDs(fr.BackendService, bs.SelfLink) {
+		t.Errorf("Got forwarding rule %+v, want ports 80 and 443 to %s", fr, bs.SelfLink)
+	}
+	for _, fw := range []string{name, healthCheckFirewall(name)} {
+		if _, err := l.firewall.GetFirewall(fw); err != nil {
+			t.Errorf("GetFirewall(%q) = %v", fw, err)
+		}
+	}
+
+	// Switching to the Local external traffic policy moves the health check
+	// to the health check node port, and a node leaving detaches it.
+	svc.Spec.ExternalTrafficPolicy = api_v1.ServiceExternalTrafficPolicyTypeLocal
+	svc.Spec.HealthCheckNodePort = 30123
+	if _, err := l.EnsureInternalLoadBalancer(svc, nodes[:1]); err != nil {
+		t.Fatalf("EnsureInternalLoadBalancer() = %v", err)
+	}
+	if hc, _ = l.cloud.GetHealthCheck(name); hc.HttpHealthCheck.Port != 30123 {
+		t.Errorf("Got health check port %d, want 30123", hc.HttpHealthCheck.Port)
+	}
+	if eps, _ := negCloud.ListNetworkEndpoints(name, "zone-a", false); len(eps) != 1 || eps[0].NetworkEndpoint.Instance != nodes[0].Name {
+		t.Errorf("Got endpoints %v in zone-a, want only %s", eps, nodes[0].Name)
+	}
+	if bs, _ = l.cloud.GetRegionBackendService(name, l.cloud.Region()); len(bs.Backends) != 1 {
+		t.Errorf("Got %d backends, want 1", len(bs.Backends))
+	}
+
+	if err := l.EnsureInternalLoadBalancerDeleted(svc); err != nil {
+		t.Fatalf("EnsureInternalLoadBalancerDeleted() = %v", err)
+	}
+	if _, err := l.cloud.GetRegionForwardingRule(name, l.cloud.Region()); !utils.IsNotFoundError(err) {
+		t.Errorf("GetRegionForwardingRule(%q) = %v, want not found", name, err)
+	}
+	if _, err := l.cloud.GetRegionBackendService(name, l.cloud.Region()); !utils.IsNotFoundError(err) {
+		t.Errorf("GetRegionBackendService(%q) = %v, want not found", name, err)
+	}
+	for _, zone := range []string{"zone-a", "zone-bb"} {
+		if _, err := negCloud.GetNetworkEndpointGroup(name, zone); err == nil {
+			t.Errorf("NEG %q in zone %q still exists", name, zone)
+		}
+	}
+}
+
+func TestEnsureExternalLoadBalancer(t *testing.T) {
+	l, negCloud := newTestL4(2)
+	svc := newTestService(8080, 80)
+	svc.Annotations = map[string]string{annotations.RBSAnnotationKey: annotations.RBSEnabled}
+	nodes := newTestNodes("zone-a", 3)
+
+	if _, err := l.EnsureExternalLoadBalancer(svc, nodes); err != nil {
+		t.Fatalf("EnsureExternalLoadBalancer() = %v", err)
+	}
+	name := l.namer.L4Backend(svc.Namespace, svc.Name)
+
+	if eps, err := negCloud.ListNetworkEndpoints(name, "zone-a", false); err != nil || len(eps) != 2 {
+		t.Errorf("ListNetworkEndpoints(%q, zone-a) = %v, %v, want 2 endpoints", name, eps, err)
+	}
+	hcKey, hcVersion := l.healthCheckKey(name, cloud.SchemeExternal)
+	hc, err := composite.GetHealthCheck(l.cloud, hcKey, hcVersion)
+	if err != nil {
+		t.Fatalf("GetHealthCheck(%v) = %v", hcKey, err)
+	}
+	bs, err := l.cloud.GetRegionBackendService(name, l.cloud.Region())
+	if err != nil {
+		t.Fatalf("GetRegionBackendService(%q) = %v", name, err)
+	}
+	if bs.LoadBalancingScheme != string(cloud.SchemeExternal) || len(bs.HealthChecks) != 1 || !utils.EqualResourceIDs(bs.HealthChecks[0], hc.SelfLink) {
+		t.Errorf("Got backend service %+v, want scheme EXTERNAL and health check %s", bs, hc.SelfLink)
+	}
+	fr, err := l.cloud.GetRegionForwardingRule(name, l.cloud.Region())
+	if err != nil {
+		t.Fatalf("GetRegionForwardingRule(%q) = %v", name, err)
+	}
+	if fr.LoadBalancingScheme != string(cloud.SchemeExternal) || fr.PortRange != "80-8080" || len(fr.Ports) != 0 || fr.Subnetwork != "" {
+		t.Errorf("Got forwarding rule %+v, want scheme EXTERNAL and port range 80-8080", fr)
+	}
+
+	// Changing the ports recreates the forwarding rule, which keeps its IP.
+	ip := fr.IPAddress
+	svc.Spec.Ports[0].Port = 443
+	if _, err := l.EnsureExternalLoadBalancer(svc, nodes); err != nil {
+		t.Fatalf("EnsureExternalLoadBalancer() = %v", err)
+	}
+	if fr, _ = l.cloud.GetRegionForwardingRule(name, l.cloud.Region()); fr.PortRange != "80-443" || fr.IPAddress != ip {
+		t.Errorf("Got port range %q and IP %q, want 80-443 and %q", fr.PortRange, fr.IPAddress, ip)
+	}
+	if _, err := l.cloud.GetRegionAddress(name, l.cloud.Region()); !utils.IsNotFoundError(err) {
+		t.Errorf("GetRegionAddress(%q) = %v, want the reservation of the IP to be released", name, err)
+	}
+
+	if err := l.EnsureExternalLoadBalancerDeleted(svc); err != nil {
+		t.Fatalf("EnsureExternalLoadBalancerDeleted() = %v", err)
+	}
+	if _, err := composite.GetHealthCheck(l.cloud, hcKey, hcVersion); !utils.IsNotFoundError(err) {
+		t.Errorf("GetHealthCheck(%v) = %v, want not found", hcKey, err)
+	}
+	if _, err := l.cloud.GetRegionForwardingRule(name, l.cloud.Region()); !utils.IsNotFoundError(err) {
+		t.Errorf("GetRegionForwardingRule(%q) = %v, want not found", name, err)
+	}
+}
+
+func TestWantsLoadBalancer(t *testing.T) {
+	ilb := newTestService(80)
+	netLB := newTestService(80)
+	netLB.Annotations = map[string]string{annotations.RBSAnnotationKey: annotations.RBSEnabled}
+	legacy := newTestService(80)
+	legacy.Annotations = nil
+	clusterIP := newTestService(80)
+	clusterIP.Spec.Type = api_v1.ServiceTypeClusterIP
+
+	testCases := []struct {
+		desc      string
+		svc       *api_v1.Service
+		wantILB   bool
+		wantNetLB bool
+	}{
+		{desc: "internal", svc: ilb, wantILB: true},
+		{desc: "external with regional backend service", svc: netLB, wantNetLB: true},
+		{desc: "external with target pool", svc: legacy},
+		{desc: "not a load balancer", svc: clusterIP},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := wantsILB(tc.svc); got != tc.wantILB {
+				t.Errorf("wantsILB() = %v, want %v", got, tc.wantILB)
+			}
+			if got := wantsNetLB(tc.svc); got != tc.wantNetLB {
+				t.Errorf("wantsNetLB() = %v, want %v", got, tc.wantNetLB)
+			}
+		})
+	}
+}
+
+func TestServicePorts(t *testing.T) {
+	mixed := newTestService(80, 53)
+	mixed.Spec.Ports[1].Protocol = api_v1.ProtocolUDP
+
+	testCases := []struct {
+		desc    string
+		svc     *api_v1.Service
+		want    []string
+		wantErr bool
+	}{
+		{desc: "single port", svc: newTestService(80), want: []string{"80"}},
+		{desc: "several ports", svc: newTestService(80, 8080), want: []string{"80", "8080"}},
+		{desc: "no ports", svc: newTestService(), wantErr: true},
+		{desc: "mixed protocols", svc: mixed, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, _, err := servicePorts(tc.svc)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("servicePorts() = %v, want error %v", err, tc.wantErr)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("servicePorts() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSubsetNodes(t *testing.T) {
+	nodes := append(newTestNodes("zone-a", 10), newTestNodes("zone-b", 3)...)
+
+	subset := subsetNodes(nodes, "ns/svc", 5)
+	if len(subset["zone-a"]) != 5 || len(subset["zone-b"]) != 3 {
+		t.Fatalf("Got %d and %d nodes, want 5 and 3", len(subset["zone-a"]), len(subset["zone-b"]))
+	}
+	// Subsets are stable regardless of the order of the nodes.
+	reversed := make([]*api_v1.Node, len(nodes))
+	for i, node := range nodes {
+		reversed[len(nodes)-1-i] = node
+	}
+	again := subsetNodes(reversed, "ns/svc", 5)
+	for i := range subset["zone-a"] {
+		if subset["zone-a"][i].Name != again["zone-a"][i].Name {
+			t.Errorf("Subset changed with the order of the nodes: %v, %v", subset["zone-a"][i].Name, again["zone-a"][i].Name)
+		}
+	}
+	// Other services pick other subsets.
+	other := subsetNodes(nodes, "ns/other", 5)
+	same := true
+	for i := range subset["zone-a"] {
+		same = same && subset["zone-a"][i].Name == other["zone-a"][i].Name
+	}
+	if same {
+		t.Errorf("Services ns/svc and ns/other got the same subset")
+	}
+}
@@ -17,18 +17,27 @@ limitations under the License.
 package loadbalancers
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 
 	"google.golang.org/api/compute/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/ingress-gce/pkg/annotations"
+	"k8s.io/ingress-gce/pkg/composite"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/ingress-gce/pkg/utils/namer"
 	"k8s.io/klog"
 )
 
-// checkStaticIP reserves a static IP allocated to the Forwarding Rule.
+// checkStaticIP reserves a static IP allocated to the http Forwarding Rule, or
+// else to the https Forwarding Rule.
 func (l *L7) checkStaticIP() (err error) {
-	if l.fw == nil || l.fw.IPAddress == "" {
+	fw := l.fw
+	if fw == nil {
+		fw = l.fws
+	}
+	if fw == nil || fw.IPAddress == "" {
 		return fmt.Errorf("will not create static IP without a forwarding rule")
 	}
 	// Don't manage staticIPs if the user has specified an IP.
@@ -37,20 +46,20 @@ func (l *L7) checkStaticIP() (err error) {
 		return nil
 	}
 	staticIPName := l.namer.ForwardingRule(l.Name, namer.HTTPProtocol)
-	ip, _ := l.cloud.GetGlobalAddress(staticIPName)
+	ip, _ := l.getStaticIP(staticIPName)
 	if ip == nil {
 		klog.V(3).Infof("Creating static ip %v", staticIPName)
-		err = l.cloud.ReserveGlobalAddress(&compute.Address{Name: staticIPName, Address: l.fw.IPAddress})
+		err = l.reserveStaticIP(&compute.Address{Name: staticIPName, Address: fw.IPAddress})
 		if err != nil {
 			if utils.IsHTTPErrorCode(err, http.StatusConflict) ||
 				utils.IsHTTPErrorCode(err, http.StatusBadRequest) {
 				klog.V(3).Infof("IP %v(%v) is already reserved, assuming it is OK to use.",
-					l.fw.IPAddress, staticIPName)
+					fw.IPAddress, staticIPName)
 				return nil
 			}
 			return err
 		}
-		ip, err = l.cloud.GetGlobalAddress(staticIPName)
+		ip, err = l.getStaticIP(staticIPName)
 		if err != nil {
 			return err
 		}
@@ -58,3 +67,107 @@ func (l *L7) checkStaticIP() (err error) {
 	l.ip = ip
 	return nil
 }
+
+// loadStaticIP sets the static IP of the l7 to the one reserved by
+// checkStaticIP, if any, so that the forwarding rules keep their IP. The
+// static IP is read through the cache of the pool.
+func (l *L7) loadStaticIP() error {
+	name := l.namer.ForwardingRule(l.Name, namer.HTTPProtocol)
+	ip, err := l.staticIPs.get(l.staticIPKey(name), func() (*compute.Address, error) {
+		ip, err := l.getStaticIP(name)
+		if utils.IsNotFoundError(err) {
+			return nil, nil
+		}
+		return ip, err
+	})
+	if err != nil {
+		return err
+	}
+	l.ip = ip
+	return nil
+}
+
+// ensureManagedStaticIP reserves the static IP owned by the controller for
+// this l7, before the forwarding rules are created. If a forwarding rule
+// already exists, its IP is reserved so the Ingress keeps its IP.
+func (l *L7) ensureManagedStaticIP() error {
+	if l.runtimeInfo.StaticIPName != "" {
+		klog.V(3).Infof("Not managing static IP of %v, user specified static IP %v", l.Name, l.runtimeInfo.StaticIPName)
+		return nil
+	}
+	if l.Regional() {
+		klog.Warningf("Managed static IPs are not supported for regional load balancer %v, ignoring %v annotation", l.Name, annotations.ManagedStaticIPKey)
+		return nil
+	}
+	staticIPName := l.namer.ForwardingRule(l.Name, namer.HTTPProtocol)
+	ip, err := l.getStaticIP(staticIPName)
+	if utils.IgnoreHTTPNotFound(err) != nil {
+		return err
+	}
+	if ip == nil {
+		address, err := l.existingForwardingRuleIP()
+		if err != nil {
+			return err
+		}
+		description, err := l.managedStaticIPDescription()
+		if err != nil {
+			return err
+		}
+		klog.V(3).Infof("Reserving managed static ip %v(%v)", staticIPName, address)
+		if err := l.reserveStaticIP(&compute.Address{Name: staticIPName, Address: address, Description: description}); err != nil {
+			return err
+		}
+		if ip, err = l.getStaticIP(staticIPName); err != nil {
+			return err
+		}
+	}
+	l.ip = ip
+	return nil
+}
+
+// existingForwardingRuleIP returns the IP of the existing HTTP or HTTPS
+// forwarding rule of this l7, or an empty string if there is none.
+func (l *L7) existingForwardingRuleIP() (string, error) {
+	for _, protocol := range []namer.NamerProtocol{namer.HTTPProtocol, namer.HTTPSProtocol} {
+		key, err := l.forwardingRuleKey(l.namer.ForwardingRule(l.Name, protocol))
+		if err != nil {
+			return "", err
+		}
+		fw, err := composite.GetForwardingRule(l.cloud, key, l.Versions().ForwardingRule)
+		if utils.IgnoreHTTPNotFound(err) != nil {
+			return "", err
+		}
+		if fw != nil && fw.IPAddress != "" {
+			return fw.IPAddress, nil
+		}
+	}
+	return "", nil
+}
+
+// managedStaticIPDescription returns the description of a static IP reserved
+// by ensureManagedStaticIP. It marks the IP as managed, so that it can be
+// recognized when the l7 is deleted without its Ingress.
+func (l *L7) managedStaticIPDescription() (string, error) {
+	if l.runtimeInfo.Ingress == nil {
+		return "", fmt.Errorf("missing Ingress object to construct description for %s", l.Name)
+	}
+	ing := l.runtimeInfo.Ingress
+	b, err := json.Marshal(map[string]string{
+		"kubernetes.io/ingress-name":   types.NamespacedName{Namespace: ing.Namespace, Name: ing.Name}.String(),
+		annotations.ManagedStaticIPKey: "true",
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// isManagedStaticIP returns true if the static IP was reserved by
+// ensureManagedStaticIP.
+func isManagedStaticIP(ip *compute.Address) bool {
+	var description map[string]string
+	if err := json.Unmarshal([]byte(ip.Description), &description); err != nil {
+		return false
+	}
+	return description[annotations.ManagedStaticIPKey] == "true"
+}
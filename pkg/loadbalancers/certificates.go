@@ -18,17 +18,31 @@ package loadbalancers
 
 import (
 	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"k8s.io/ingress-gce/pkg/composite"
 	"net/http"
 	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/ingress-gce/pkg/flags"
+	"k8s.io/ingress-gce/pkg/loadbalancers/metrics"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/klog"
 )
 
-const SslCertificateMissing = "SslCertificateMissing"
+const (
+	SslCertificateMissing = "SslCertificateMissing"
+	// SslCertificateRotation is the event reason for the steps of a cert
+	// rotation on a target https proxy.
+	SslCertificateRotation = "SslCertificateRotation"
+	// SslCertificateExpiring is the event reason for certs which expire
+	// within --ssl-cert-expiry-warning-period, or have expired.
+	SslCertificateExpiring = "SslCertificateExpiring"
+)
 
 func (l *L7) checkSSLCert() error {
 	// Use both pre-shared and secret-based certs if available,
@@ -63,6 +77,47 @@ func (l *L7) checkSSLCert() error {
 	return nil
 }
 
+// checkCertExpiry publishes the expiry time of the certs of the target https
+// proxy and raises an event on the Ingress for the certs close to expiry.
+// Since Ingresses are resynced periodically, so are the checks.
+func (l *L7) checkCertExpiry() {
+	for _, cert := range l.sslCerts {
+		expiry, err := certExpiry(cert)
+		if err != nil {
+			klog.V(3).Infof("Cannot get expiry time of SslCertificate %v: %v", cert.Name, err)
+			continue
+		}
+		metrics.ObserveSSLCertificateExpiry(cert.Name, expiry)
+
+		period := flags.Reloadable().SSLCertExpiryWarningPeriod
+		if period <= 0 || time.Until(expiry) > period {
+			continue
+		}
+		if expiry.Before(time.Now()) {
+			l.recorder.Eventf(l.runtimeInfo.Ingress, corev1.EventTypeWarning, SslCertificateExpiring, "SslCertificate %v expired at %v", cert.Name, expiry.Format(time.RFC3339))
+		} else {
+			l.recorder.Eventf(l.runtimeInfo.Ingress, corev1.EventTypeWarning, SslCertificateExpiring, "SslCertificate %v expires at %v", cert.Name, expiry.Format(time.RFC3339))
+		}
+	}
+}
+
+// certExpiry returns the expiry time of the cert, as reported by GCE or, if
+// not reported yet, as found in its PEM encoded certificate.
+func certExpiry(cert *composite.SslCertificate) (time.Time, error) {
+	if cert.ExpireTime != "" {
+		return time.Parse(time.RFC3339, cert.ExpireTime)
+	}
+	block, _ := pem.Decode([]byte(cert.Certificate))
+	if block == nil {
+		return time.Time{}, fmt.Errorf("no PEM encoded certificate")
+	}
+	x509Cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return x509Cert.NotAfter, nil
+}
+
 // createSslCertificates creates SslCertificates based on kubernetes secrets in Ingress configuration.
 func (l *L7) createSslCertificates(existingCerts []*composite.SslCertificate) ([]*composite.SslCertificate, error) {
 	var result []*composite.SslCertificate
@@ -255,6 +310,23 @@ func (l *L7) deleteOldSSLCerts() {
 	if len(l.oldSSLCerts) == 0 {
 		return
 	}
+	// Certs are only deleted once the target proxy no longer references them,
+	// e.g. a failed proxy update must not leave the proxy without its certs.
+	linksInUse, err := l.getSslCertLinkInUse()
+	if err != nil && !utils.IsHTTPErrorCode(err, http.StatusNotFound) {
+		klog.Warningf("Skipping cleanup of old SSL certificates for %v, failed to get target proxy: %v", l.Name, err)
+		return
+	}
+	namesInUse := sets.NewString()
+	for _, link := range linksInUse {
+		name, err := utils.KeyName(link)
+		if err != nil {
+			klog.Warningf("Skipping cleanup of old SSL certificates for %v, cannot get cert name: %v", l.Name, err)
+			return
+		}
+		namesInUse.Insert(name)
+	}
+
 	certsMap := getMapfromCertList(l.sslCerts)
 	for _, cert := range l.oldSSLCerts {
 		if !l.namer.IsCertUsedForLB(l.Name, cert.Name) && !l.namer.IsLegacySSLCert(l.Name, cert.Name) {
@@ -265,11 +337,17 @@ func (l *L7) deleteOldSSLCerts() {
 			// cert found in current map
 			continue
 		}
+		if namesInUse.Has(cert.Name) {
+			klog.V(3).Infof("Retaining old SSL Certificate %s, still in use by target proxy", cert.Name)
+			continue
+		}
 		klog.V(3).Infof("Cleaning up old SSL Certificate %s", cert.Name)
 		key, _ := l.CreateKey(cert.Name)
 		if certErr := utils.IgnoreHTTPNotFound(composite.DeleteSslCertificate(l.cloud, key, l.Versions().SslCertificate)); certErr != nil {
 			klog.Errorf("Old cert %s delete failed - %v", cert.Name, certErr)
+			continue
 		}
+		metrics.DeleteSSLCertificate(cert.Name)
 	}
 }
 
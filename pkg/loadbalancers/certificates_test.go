@@ -0,0 +1,150 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loadbalancers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"k8s.io/api/networking/v1beta1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/flags"
+)
+
+// selfSignedCert returns a PEM encoded self-signed cert expiring at notAfter.
+func selfSignedCert(t *testing.T, notAfter time.Time) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate() = %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestCertExpiry(t *testing.T) {
+	notAfter := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	testCases := []struct {
+		desc    string
+		cert    *composite.SslCertificate
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			desc: "expire time reported by GCE",
+			cert: &composite.SslCertificate{ExpireTime: "2030-01-02T03:04:05Z", Certificate: "cert"},
+			want: notAfter,
+		},
+		{
+			desc: "expire time from PEM certificate",
+			cert: &composite.SslCertificate{Certificate: selfSignedCert(t, notAfter)},
+			want: notAfter,
+		},
+		{
+			desc:    "invalid PEM certificate",
+			cert:    &composite.SslCertificate{Certificate: "cert"},
+			wantErr: true,
+		},
+		{
+			desc:    "invalid expire time",
+			cert:    &composite.SslCertificate{ExpireTime: "tomorrow"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := certExpiry(tc.cert)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("certExpiry() = %v, want err %v", err, tc.wantErr)
+			}
+			if !got.Equal(tc.want) {
+				t.Errorf("certExpiry() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckCertExpiry(t *testing.T) {
+	defer func(period time.Duration) { flags.F.SSLCertExpiryWarningPeriod = period }(flags.F.SSLCertExpiryWarningPeriod)
+	now := time.Now()
+
+	testCases := []struct {
+		desc       string
+		period     time.Duration
+		expiry     time.Time
+		wantEvents int
+	}{
+		{
+			desc:       "expires within the period",
+			period:     30 * 24 * time.Hour,
+			expiry:     now.Add(24 * time.Hour),
+			wantEvents: 1,
+		},
+		{
+			desc:       "expired",
+			period:     30 * 24 * time.Hour,
+			expiry:     now.Add(-24 * time.Hour),
+			wantEvents: 1,
+		},
+		{
+			desc:   "expires after the period",
+			period: 30 * 24 * time.Hour,
+			expiry: now.Add(60 * 24 * time.Hour),
+		},
+		{
+			desc:   "warnings disabled",
+			expiry: now.Add(24 * time.Hour),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			flags.F.SSLCertExpiryWarningPeriod = tc.period
+			recorder := record.NewFakeRecorder(10)
+			l7 := &L7{
+				runtimeInfo: &L7RuntimeInfo{Ingress: &v1beta1.Ingress{}},
+				recorder:    recorder,
+				sslCerts: []*composite.SslCertificate{
+					{Name: "cert", ExpireTime: tc.expiry.Format(time.RFC3339)},
+				},
+			}
+			l7.checkCertExpiry()
+			if got := len(recorder.Events); got != tc.wantEvents {
+				t.Errorf("checkCertExpiry() raised %d events, want %d", got, tc.wantEvents)
+			}
+		})
+	}
+}
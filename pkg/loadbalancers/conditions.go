@@ -0,0 +1,135 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loadbalancers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/ingress-gce/pkg/annotations"
+)
+
+// Types of the conditions of an Ingress, one per stage of its sync.
+const (
+	UrlMapReady       = "UrlMapReady"
+	CertificatesReady = "CertificatesReady"
+	BackendsHealthy   = "BackendsHealthy"
+	FrontendReady     = "FrontendReady"
+)
+
+// Reasons of the conditions of an Ingress.
+const (
+	ReasonSynced     = "Synced"
+	ReasonSyncFailed = "SyncFailed"
+	ReasonUnhealthy  = "Unhealthy"
+)
+
+// Condition is the state of a stage of the sync of an Ingress. The v1beta1
+// Ingress status has no conditions, so they are recorded in the
+// ingress.kubernetes.io/conditions annotation.
+type Condition struct {
+	Type   string                 `json:"type"`
+	Status metav1.ConditionStatus `json:"status"`
+	Reason string                 `json:"reason,omitempty"`
+	// Message is the error of a failed stage.
+	Message            string      `json:"message,omitempty"`
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+}
+
+// Conditions are the conditions updated by a sync, by type. A nil condition
+// removes the condition, e.g. CertificatesReady once the Ingress has no TLS.
+// The stages which did not run leave their condition unchanged.
+type Conditions map[string]*Condition
+
+// Set sets the condition of the given type.
+func (c Conditions) Set(condType string, status metav1.ConditionStatus, reason, message string) {
+	if c == nil {
+		return
+	}
+	c[condType] = &Condition{Type: condType, Status: status, Reason: reason, Message: message}
+}
+
+// SetError sets the condition of the given type from the error of its stage.
+func (c Conditions) SetError(condType string, err error) {
+	if err != nil {
+		c.Set(condType, metav1.ConditionFalse, ReasonSyncFailed, err.Error())
+		return
+	}
+	c.Set(condType, metav1.ConditionTrue, ReasonSynced, "")
+}
+
+// Remove removes the condition of the given type.
+func (c Conditions) Remove(condType string) {
+	if c == nil {
+		return
+	}
+	c[condType] = nil
+}
+
+// ConditionsAnnotationKey is the annotation recording the conditions of an
+// Ingress.
+var ConditionsAnnotationKey = fmt.Sprintf("%v/conditions", annotations.StatusPrefix)
+
+// MergeConditions returns the value of the conditions annotation given its
+// existing value and the conditions updated by a sync, and whether it
+// changed. The transition time of a condition is only updated when its status
+// changes.
+func MergeConditions(existing string, updated Conditions, now metav1.Time) (string, bool, error) {
+	var old []Condition
+	if existing != "" {
+		if err := json.Unmarshal([]byte(existing), &old); err != nil {
+			// The annotation is owned by the controller, overwrite it.
+			old = nil
+		}
+	}
+	byType := map[string]Condition{}
+	for _, cond := range old {
+		byType[cond.Type] = cond
+	}
+	for condType, cond := range updated {
+		if cond == nil {
+			delete(byType, condType)
+			continue
+		}
+		merged := *cond
+		merged.LastTransitionTime = now
+		if prev, ok := byType[condType]; ok && prev.Status == cond.Status {
+			merged.LastTransitionTime = prev.LastTransitionTime
+		}
+		byType[condType] = merged
+	}
+
+	var types []string
+	for condType := range byType {
+		types = append(types, condType)
+	}
+	if len(types) == 0 && existing == "" {
+		return "", false, nil
+	}
+	sort.Strings(types)
+	conds := []Condition{}
+	for _, condType := range types {
+		conds = append(conds, byType[condType])
+	}
+	b, err := json.Marshal(conds)
+	if err != nil {
+		return "", false, err
+	}
+	return string(b), string(b) != existing, nil
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loadbalancers
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMergeConditions(t *testing.T) {
+	t1 := metav1.NewTime(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	t2 := metav1.NewTime(t1.Add(time.Hour))
+
+	conds := Conditions{}
+	conds.SetError(UrlMapReady, nil)
+	conds.SetError(CertificatesReady, fmt.Errorf("secret not found"))
+	value, changed, err := MergeConditions("", conds, t1)
+	if err != nil || !changed {
+		t.Fatalf("MergeConditions() = _, %v, %v, want _, true, nil", changed, err)
+	}
+
+	// An unchanged status keeps its transition time, and a removed
+	// condition is dropped.
+	conds = Conditions{}
+	conds.SetError(UrlMapReady, nil)
+	conds.Remove(CertificatesReady)
+	conds.SetError(FrontendReady, fmt.Errorf("quota exceeded"))
+	value, changed, err = MergeConditions(value, conds, t2)
+	if err != nil || !changed {
+		t.Fatalf("MergeConditions() = _, %v, %v, want _, true, nil", changed, err)
+	}
+	var got []Condition
+	if err := json.Unmarshal([]byte(value), &got); err != nil {
+		t.Fatalf("json.Unmarshal(%q) = %v", value, err)
+	}
+	want := []Condition{
+		{Type: FrontendReady, Status: metav1.ConditionFalse, Reason: ReasonSyncFailed, Message: "quota exceeded", LastTransitionTime: t2},
+		{Type: UrlMapReady, Status: metav1.ConditionTrue, Reason: ReasonSynced, LastTransitionTime: t1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("conditions = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Type != want[i].Type || got[i].Status != want[i].Status || got[i].Reason != want[i].Reason || got[i].Message != want[i].Message || !got[i].LastTransitionTime.Equal(&want[i].LastTransitionTime) {
+			t.Errorf("conditions[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// Nothing changes if the sync did not update any condition.
+	if _, changed, err := MergeConditions(value, Conditions{}, t2); err != nil || changed {
+		t.Errorf("MergeConditions() = _, %v, %v, want _, false, nil", changed, err)
+	}
+}
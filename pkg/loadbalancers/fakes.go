@@ -24,7 +24,7 @@ import (
 	"google.golang.org/api/compute/v1"
 )
 
-const FakeCertQuota = 15
+const FakeCertQuota = 20
 
 var testIPManager = testIP{}
 
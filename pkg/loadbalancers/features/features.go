@@ -21,11 +21,19 @@ import (
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 	"k8s.io/api/networking/v1beta1"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/ingress-gce/pkg/annotations"
+	"k8s.io/ingress-gce/pkg/flags"
 	"k8s.io/ingress-gce/pkg/utils"
 )
 
 const (
 	FeatureL7ILB = "L7ILB"
+	// FeatureRouteActions is enabled by URL rewrites and redirects, which
+	// are only supported by the beta UrlMap API.
+	FeatureRouteActions = "RouteActions"
+	// FeatureLabels is enabled by --propagated-labels, as the labels of
+	// forwarding rules are only supported by the beta API.
+	FeatureLabels = "Labels"
 )
 
 var GAResourceVersions = NewResourceVersions()
@@ -51,7 +59,9 @@ var (
 	// require using different versions for each resource.
 	// must not be nil
 	featureToVersions = map[string]*ResourceVersions{
-		FeatureL7ILB: &l7IlbVersions,
+		FeatureL7ILB:        &l7IlbVersions,
+		FeatureRouteActions: &routeActionsVersions,
+		FeatureLabels:       &labelsVersions,
 	}
 
 	// scopeToFeatures stores the mapping from the required resource type
@@ -72,6 +82,26 @@ var (
 		BackendService:   meta.VersionBeta,
 		HealthCheck:      meta.VersionBeta,
 	}
+
+	labelsVersions = ResourceVersions{
+		UrlMap:           meta.VersionGA,
+		ForwardingRule:   meta.VersionBeta,
+		TargetHttpProxy:  meta.VersionGA,
+		TargetHttpsProxy: meta.VersionGA,
+		SslCertificate:   meta.VersionGA,
+		BackendService:   meta.VersionGA,
+		HealthCheck:      meta.VersionGA,
+	}
+
+	routeActionsVersions = ResourceVersions{
+		UrlMap:           meta.VersionBeta,
+		ForwardingRule:   meta.VersionGA,
+		TargetHttpProxy:  meta.VersionGA,
+		TargetHttpsProxy: meta.VersionGA,
+		SslCertificate:   meta.VersionGA,
+		BackendService:   meta.VersionGA,
+		HealthCheck:      meta.VersionGA,
+	}
 )
 
 func NewResourceVersions() *ResourceVersions {
@@ -99,11 +129,17 @@ func (r *ResourceVersions) merge(other *ResourceVersions) *ResourceVersions {
 }
 
 // featuresFromIngress returns the features enabled by an ingress
-func featuresFromIngress(ing *v1beta1.Ingress) []string {
+func featuresFromIngress(ing *v1beta1.Ingress, classes utils.IngressClassLookup) []string {
 	var result []string
-	if utils.IsGCEL7ILBIngress(ing) {
+	if utils.IsGCEL7ILBIngress(ing, classes) {
 		result = append(result, FeatureL7ILB)
 	}
+	if _, ok := ing.Annotations[annotations.RouteActionsKey]; ok {
+		result = append(result, FeatureRouteActions)
+	}
+	if len(flags.F.PropagatedLabels) > 0 {
+		result = append(result, FeatureLabels)
+	}
 	return result
 }
 
@@ -156,11 +192,11 @@ func scopeFromFeatures(features []string) meta.KeyType {
 
 // TODO: (shance) refactor scope to be per-resource
 // ScopeFromIngress returns the required scope of features for an Ingress
-func ScopeFromIngress(ing *v1beta1.Ingress) meta.KeyType {
-	return scopeFromFeatures(featuresFromIngress(ing))
+func ScopeFromIngress(ing *v1beta1.Ingress, classes utils.IngressClassLookup) meta.KeyType {
+	return scopeFromFeatures(featuresFromIngress(ing, classes))
 }
 
 // VersionFromIngress returns a ResourceVersions struct containing all of the resources per version
-func VersionsFromIngress(ing *v1beta1.Ingress) *ResourceVersions {
-	return versionsFromFeatures(featuresFromIngress(ing))
+func VersionsFromIngress(ing *v1beta1.Ingress, classes utils.IngressClassLookup) *ResourceVersions {
+	return versionsFromFeatures(featuresFromIngress(ing, classes))
 }
@@ -100,7 +100,7 @@ func TestScopeFromIngress(t *testing.T) {
 	scopeToFeatures = fakeScopeToFeatures
 	for _, tc := range testCases {
 		t.Run(tc.desc, func(t *testing.T) {
-			result := ScopeFromIngress(&tc.ing)
+			result := ScopeFromIngress(&tc.ing, nil)
 
 			if result != tc.scope {
 				t.Fatalf("want scope %s, got %s", tc.scope, result)
@@ -19,17 +19,23 @@ package loadbalancers
 import (
 	"fmt"
 
+	frontendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1"
 	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/flags"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/ingress-gce/pkg/utils/namer"
 	"k8s.io/klog"
 )
 
 const (
-	httpDefaultPortRange  = "80-80"
-	httpsDefaultPortRange = "443-443"
+	httpDefaultPortRange = "80-80"
 )
 
+// setForwardingRuleGlobalAccess sets the global access of an internal
+// forwarding rule. It is a variable so that tests, whose fake cloud does not
+// implement the call, can replace it.
+var setForwardingRuleGlobalAccess = composite.SetAllowGlobalAccessForForwardingRule
+
 func (l *L7) checkHttpForwardingRule() (err error) {
 	if l.tp == nil {
 		return fmt.Errorf("cannot create forwarding rule without proxy")
@@ -51,7 +57,7 @@ func (l *L7) checkHttpsForwardingRule() (err error) {
 	}
 	name := l.namer.ForwardingRule(l.Name, namer.HTTPSProtocol)
 	address, _ := l.getEffectiveIP()
-	fws, err := l.checkForwardingRule(name, l.tps.SelfLink, address, httpsDefaultPortRange)
+	fws, err := l.checkForwardingRule(name, l.tps.SelfLink, address, portRange(l.httpsPorts()[0]))
 	if err != nil {
 		return err
 	}
@@ -60,7 +66,7 @@ func (l *L7) checkHttpsForwardingRule() (err error) {
 }
 
 func (l *L7) checkForwardingRule(name, proxyLink, ip, portRange string) (fw *composite.ForwardingRule, err error) {
-	key, err := l.CreateKey(name)
+	key, err := l.forwardingRuleKey(name)
 	if err != nil {
 		return nil, err
 	}
@@ -76,6 +82,9 @@ func (l *L7) checkForwardingRule(name, proxyLink, ip, portRange string) (fw *com
 	}
 	if fw == nil {
 		klog.V(3).Infof("Creating forwarding rule for proxy %q and ip %v:%v", proxyLink, ip, portRange)
+		if err := l.deleteOtherTierForwardingRule(name); err != nil {
+			return nil, err
+		}
 		description, err := l.description()
 		if err != nil {
 			return nil, err
@@ -89,22 +98,43 @@ func (l *L7) checkForwardingRule(name, proxyLink, ip, portRange string) (fw *com
 			Description: description,
 			Version:     version,
 		}
+		if len(flags.F.PropagatedLabels) > 0 {
+			rule.Labels = gceLabels(l.propagatedLabels())
+		}
+		if l.standardTier() {
+			rule.NetworkTier = frontendconfigv1beta1.NetworkTierStandard
+		}
 
 		// Update rule for L7-ILB
-		if utils.IsGCEL7ILBIngress(l.runtimeInfo.Ingress) {
+		if utils.IsGCEL7ILBIngress(l.runtimeInfo.Ingress, l.runtimeInfo.IngressClasses) {
 			rule.LoadBalancingScheme = "INTERNAL_MANAGED"
+			if allow, ok := l.allowGlobalAccess(); ok {
+				rule.AllowGlobalAccess = allow
+			}
 		}
 		if err = composite.CreateForwardingRule(l.cloud, key, rule); err != nil {
 			return nil, err
 		}
-		key, err = l.CreateKey(name)
+		fw, err = composite.GetForwardingRule(l.cloud, key, version)
 		if err != nil {
 			return nil, err
 		}
-		fw, err = composite.GetForwardingRule(l.cloud, key, version)
-		if err != nil {
+	}
+	if len(flags.F.PropagatedLabels) > 0 {
+		if labels := mergeLabels(fw.Labels, gceLabels(l.propagatedLabels())); !equalLabels(fw.Labels, labels) {
+			klog.V(3).Infof("Forwarding rule %v has labels %v, setting %v", fw.Name, fw.Labels, labels)
+			if err := setForwardingRuleLabels(l.cloud, key, fw, labels); err != nil {
+				return nil, err
+			}
+			fw.Labels = labels
+		}
+	}
+	if allow, ok := l.allowGlobalAccess(); ok && fw.AllowGlobalAccess != allow {
+		klog.V(3).Infof("Forwarding rule %v has allowGlobalAccess %t, setting %t", fw.Name, fw.AllowGlobalAccess, allow)
+		if err := setForwardingRuleGlobalAccess(l.cloud, key, fw, allow); err != nil {
 			return nil, err
 		}
+		fw.AllowGlobalAccess = allow
 	}
 	// TODO: If the port range and protocol don't match, recreate the rule
 	if utils.EqualResourceIDs(fw.Target, proxyLink) {
@@ -112,10 +142,6 @@ func (l *L7) checkForwardingRule(name, proxyLink, ip, portRange string) (fw *com
 	} else {
 		klog.V(3).Infof("Forwarding rule %v has the wrong proxy, setting %v overwriting %v",
 			fw.Name, fw.Target, proxyLink)
-		key, err := l.CreateKey(fw.Name)
-		if err != nil {
-			return nil, err
-		}
 		if err := composite.SetProxyForForwardingRule(l.cloud, key, fw, proxyLink); err != nil {
 			return nil, err
 		}
@@ -123,6 +149,17 @@ func (l *L7) checkForwardingRule(name, proxyLink, ip, portRange string) (fw *com
 	return fw, nil
 }
 
+// allowGlobalAccess returns the global access of the forwarding rules
+// configured in the FrontendConfig of the Ingress, and false if the setting
+// of the forwarding rules is not managed, which is also the case for external
+// load balancers.
+func (l *L7) allowGlobalAccess() (bool, bool) {
+	if !l.Regional() || l.runtimeInfo.FrontendConfig == nil || l.runtimeInfo.FrontendConfig.Spec.AllowGlobalAccess == nil {
+		return false, false
+	}
+	return *l.runtimeInfo.FrontendConfig.Spec.AllowGlobalAccess, true
+}
+
 // getEffectiveIP returns a string with the IP to use in the HTTP and HTTPS
 // forwarding rules, and a boolean indicating if this is an IP the controller
 // should manage or not.
@@ -0,0 +1,153 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loadbalancers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"google.golang.org/api/compute/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/klog"
+)
+
+// defaultHttpsPort is the port of the https forwarding rule, unless the
+// FrontendConfig of the Ingress sets other ports.
+const defaultHttpsPort = 443
+
+// httpsPorts returns the ports served by the target https proxy of the l7.
+// The first port is served by the https forwarding rule, and the others by
+// additional forwarding rules.
+func (l *L7) httpsPorts() []int64 {
+	if feConfig := l.runtimeInfo.FrontendConfig; feConfig != nil && len(feConfig.Spec.HttpsPorts) > 0 {
+		return feConfig.Spec.HttpsPorts
+	}
+	return []int64{defaultHttpsPort}
+}
+
+// portRange returns the port range of a forwarding rule serving one port.
+func portRange(port int64) string {
+	return fmt.Sprintf("%d-%d", port, port)
+}
+
+// validateHttpsPorts returns an error if the l7 has additional https ports
+// which its scope does not support.
+func (l *L7) validateHttpsPorts() error {
+	// The forwarding rules of internal load balancers can only share an IP
+	// reserved for that purpose.
+	if ports := l.httpsPorts(); l.Regional() && len(ports) > 1 {
+		return fmt.Errorf("internal load balancers serve a single https port, not %v", ports)
+	}
+	return nil
+}
+
+// checkHttpsPortForwardingRules ensures the additional https forwarding rules
+// of the l7, which point to its target https proxy with the IP of its https
+// forwarding rule, and deletes those of the ports which were removed.
+func (l *L7) checkHttpsPortForwardingRules() error {
+	keep := map[string]bool{}
+	for _, port := range l.httpsPorts()[1:] {
+		name := l.namer.HTTPSForwardingRuleForPort(l.Name, port)
+		if _, err := l.checkForwardingRule(name, l.tps.SelfLink, l.fws.IPAddress, portRange(port)); err != nil {
+			return err
+		}
+		keep[name] = true
+	}
+	key, err := l.forwardingRuleKey("")
+	if err != nil {
+		return err
+	}
+	return l.deleteHttpsPortForwardingRules(key, keep)
+}
+
+// deleteHttpsPortForwardingRules deletes the additional https forwarding rules
+// of the l7 in the scope of the given key, except those to keep. The rules are
+// found by listing the forwarding rules of the scope with the name prefix of
+// the l7, so that the rules of the ports which were removed are deleted even
+// though they are not known.
+func (l *L7) deleteHttpsPortForwardingRules(scopeKey *meta.Key, keep map[string]bool) error {
+	version := l.Versions().ForwardingRule
+	rules, err := composite.ListForwardingRulesWithPrefix(l.cloud, scopeKey, version, l.namer.HTTPSForwardingRuleForPortPrefix(l.Name))
+	if err != nil {
+		return err
+	}
+	for _, fw := range rules {
+		if keep[fw.Name] || !l.namer.IsHTTPSForwardingRuleForPort(l.Name, fw.Name) {
+			continue
+		}
+		klog.V(2).Infof("Deleting https forwarding rule %v(%v)", fw.Name, fw.PortRange)
+		key := *scopeKey
+		key.Name = fw.Name
+		if err := utils.IgnoreHTTPNotFound(composite.DeleteForwardingRule(l.cloud, &key, version)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// staticIPCacheTTL is how long the static IPs loaded by loadStaticIP are
+// cached, in case they are reserved or deleted out of band.
+const staticIPCacheTTL = 10 * time.Minute
+
+// staticIPCache caches the static IPs loaded by loadStaticIP, including the
+// missing ones, so that the https only l7s don't get their static IP on every
+// sync. The reservations and deletions of the static IPs by the controller
+// invalidate their entries.
+type staticIPCache struct {
+	store cache.Store
+}
+
+// cachedStaticIP is the static IP with the given key, nil if it is missing.
+type cachedStaticIP struct {
+	key string
+	ip  *compute.Address
+}
+
+func newStaticIPCache() *staticIPCache {
+	return &staticIPCache{store: cache.NewTTLStore(func(obj interface{}) (string, error) {
+		return obj.(*cachedStaticIP).key, nil
+	}, staticIPCacheTTL)}
+}
+
+// get returns the cached static IP with the given key, or the one returned by
+// load, which is cached unless it returns an error. A nil cache always calls
+// load.
+func (c *staticIPCache) get(key string, load func() (*compute.Address, error)) (*compute.Address, error) {
+	if c == nil {
+		return load()
+	}
+	if item, ok, err := c.store.GetByKey(key); err == nil && ok {
+		return item.(*cachedStaticIP).ip, nil
+	}
+	ip, err := load()
+	if err != nil {
+		return nil, err
+	}
+	c.store.Add(&cachedStaticIP{key: key, ip: ip})
+	return ip, nil
+}
+
+// invalidate deletes the cached static IP with the given key, if any.
+func (c *staticIPCache) invalidate(key string) {
+	if c == nil {
+		return
+	}
+	c.store.Delete(&cachedStaticIP{key: key})
+}
@@ -32,6 +32,8 @@ import (
 	"k8s.io/ingress-gce/pkg/backends"
 	"k8s.io/ingress-gce/pkg/composite"
 	"k8s.io/ingress-gce/pkg/loadbalancers/features"
+	"k8s.io/ingress-gce/pkg/loadbalancers/metrics"
+	"k8s.io/ingress-gce/pkg/targetproxy"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/ingress-gce/pkg/utils/namer"
 	"k8s.io/klog"
@@ -60,16 +62,33 @@ type L7RuntimeInfo struct {
 	TLSName string
 	// Ingress is the processed Ingress API object.
 	Ingress *v1beta1.Ingress
+	// ServiceLabels are the labels of the Services of Ingress, merged in the
+	// order of their namespaced names, the first Service winning on
+	// conflict.
+	ServiceLabels map[string]string
+	// IngressClasses looks up the parameters of the IngressClass of Ingress,
+	// nil if IngressClasses are disabled.
+	IngressClasses utils.IngressClassLookup
 	// AllowHTTP will not setup :80, if TLS is nil and AllowHTTP is set,
 	// no loadbalancer is created.
 	AllowHTTP bool
 	// The name of a Global Static IP. If specified, the IP associated with
 	// this name is used in the Forwarding Rules for this loadbalancer.
 	StaticIPName string
+	// ManagedStaticIP indicates that the controller should reserve a static IP
+	// before creating the forwarding rules, rather than promoting their ephemeral IP.
+	ManagedStaticIP bool
 	// UrlMap is our internal representation of a url map.
 	UrlMap *utils.GCEURLMap
+	// UserURLMap is the name or the self link of a URL map not managed by
+	// the controller, which the target proxies use instead of the url map
+	// of UrlMap. Empty if not set.
+	UserURLMap string
 	// FrontendConfig is the type which encapsulates features for the load balancer.
 	FrontendConfig *frontendconfigv1beta1.FrontendConfig
+	// Conditions collects the conditions of the stages of the sync, nil if
+	// they are not collected.
+	Conditions Conditions
 }
 
 // TLSCerts encapsulates .pem encoded TLS information.
@@ -99,8 +118,14 @@ type L7 struct {
 	ingress v1beta1.Ingress
 	// cloud is an interface to manage loadbalancers in the GCE cloud.
 	cloud *gce.Cloud
+	// proxyClient sets the target proxy settings which the compute API
+	// version in use does not expose, nil if disabled.
+	proxyClient targetproxy.Client
 	// um is the UrlMap associated with this L7.
 	um *composite.UrlMap
+	// userURLMap is the key of the URL map of the target proxies when it is
+	// not um, nil otherwise.
+	userURLMap *meta.Key
 	// tp is the TargetHTTPProxy associated with this L7.
 	tp *composite.TargetHttpProxy
 	// tps is the TargetHTTPSProxy associated with this L7.
@@ -111,6 +136,9 @@ type L7 struct {
 	fws *composite.ForwardingRule
 	// ip is the static-ip associated with both GlobalForwardingRules.
 	ip *compute.Address
+	// staticIPs caches the static IPs loaded by loadStaticIP, nil if they
+	// are not cached.
+	staticIPs *staticIPCache
 	// sslCerts is the list of ssl certs associated with the targetHTTPSProxy.
 	sslCerts []*composite.SslCertificate
 	// oldSSLCerts is the list of certs that used to be hooked up to the
@@ -119,7 +147,7 @@ type L7 struct {
 	// prevents leakage if there's a failure along the way.
 	oldSSLCerts []*composite.SslCertificate
 	// namer is used to compute names of the various sub-components of an L7.
-	namer *namer.Namer
+	namer namer.IngressNamer
 	// recorder is used to generate k8s Events.
 	recorder record.EventRecorder
 	// resource type stores the KeyType of the resources in the loadbalancer (e.g. Regional)
@@ -128,7 +156,7 @@ type L7 struct {
 
 // Version() returns the struct listing the versions for every resource
 func (l *L7) Versions() *features.ResourceVersions {
-	return features.VersionsFromIngress(&l.ingress)
+	return features.VersionsFromIngress(&l.ingress, l.runtimeInfo.IngressClasses)
 }
 
 // CreateKey creates a meta.Key for use with composite types
@@ -152,13 +180,36 @@ func (l *L7) UrlMap() *composite.UrlMap {
 }
 
 func (l *L7) edgeHop() error {
+	err := l.ensureComputeURLMap()
+	if err == nil {
+		err = l.checkUserURLMap()
+	}
+	l.runtimeInfo.Conditions.SetError(UrlMapReady, err)
+	if err != nil {
+		return err
+	}
+	err = l.edgeHopFrontend()
+	l.runtimeInfo.Conditions.SetError(FrontendReady, err)
+	return err
+}
+
+// edgeHopFrontend ensures the resources in front of the url map.
+func (l *L7) edgeHopFrontend() error {
 	// Keeps track if we will "try" to setup frontend resources based on user configuration.
 	// If user configuration dictates we do not, then we emit an event.
 	willConfigureFrontend := false
 
-	if err := l.ensureComputeURLMap(); err != nil {
+	if err := l.validateNetworkTier(); err != nil {
+		return err
+	}
+	if err := l.validateHttpsPorts(); err != nil {
 		return err
 	}
+	if l.runtimeInfo.ManagedStaticIP {
+		if err := l.ensureManagedStaticIP(); err != nil {
+			return err
+		}
+	}
 	if l.runtimeInfo.AllowHTTP {
 		willConfigureFrontend = true
 		if err := l.edgeHopHttp(); err != nil {
@@ -179,6 +230,15 @@ func (l *L7) edgeHop() error {
 		if err := l.edgeHopHttps(); err != nil {
 			return err
 		}
+	} else {
+		l.runtimeInfo.Conditions.Remove(CertificatesReady)
+	}
+
+	if err := l.ensureKeepAliveTimeout(); err != nil {
+		return err
+	}
+	if err := l.ensureMutualTLS(); err != nil {
+		return err
 	}
 
 	if !willConfigureFrontend {
@@ -200,14 +260,34 @@ func (l *L7) edgeHopHttp() error {
 
 func (l *L7) edgeHopHttps() error {
 	defer l.deleteOldSSLCerts()
-	if err := l.checkSSLCert(); err != nil {
+	err := l.checkSSLCert()
+	l.checkCertExpiry()
+	l.runtimeInfo.Conditions.SetError(CertificatesReady, err)
+	if err != nil {
 		return err
 	}
 
 	if err := l.checkHttpsProxy(); err != nil {
 		return err
 	}
-	return l.checkHttpsForwardingRule()
+	// The static IP reserved for the additional https ports of an https
+	// only l7 is kept once they are removed.
+	if l.ip == nil && !l.Regional() {
+		if err := l.loadStaticIP(); err != nil {
+			return err
+		}
+	}
+	if err := l.checkHttpsForwardingRule(); err != nil {
+		return err
+	}
+	// The additional https forwarding rules share the IP of the https
+	// forwarding rule, which must be static.
+	if len(l.httpsPorts()) > 1 && l.ip == nil {
+		if err := l.checkStaticIP(); err != nil {
+			return err
+		}
+	}
+	return l.checkHttpsPortForwardingRules()
 }
 
 // GetIP returns the ip associated with the forwarding rule for this l7.
@@ -246,10 +326,31 @@ func (l *L7) Cleanup(versions *features.ResourceVersions) error {
 		return err
 	}
 
-	ip, err := l.cloud.GetGlobalAddress(fwName)
-	if ip != nil && utils.IgnoreHTTPNotFound(err) == nil {
-		klog.V(2).Infof("Deleting static IP %v(%v)", ip.Name, ip.Address)
-		if err := utils.IgnoreHTTPNotFound(l.cloud.DeleteGlobalAddress(ip.Name)); err != nil {
+	scopeKey, err := l.CreateKey("")
+	if err != nil {
+		return err
+	}
+	if err := l.deleteHttpsPortForwardingRules(scopeKey, nil); err != nil {
+		return err
+	}
+
+	if err := l.deleteStaticIP(false); err != nil {
+		return err
+	}
+
+	// The forwarding rules and static IP of Standard tier load balancers
+	// are regional, the tier of the l7 may be unknown here.
+	if !l.Regional() {
+		for _, name := range []string{fwName, fwsName} {
+			klog.V(2).Infof("Deleting regional forwarding rule %v", name)
+			if err := utils.IgnoreHTTPNotFound(composite.DeleteForwardingRule(l.cloud, meta.RegionalKey(name, l.cloud.Region()), versions.ForwardingRule)); err != nil {
+				return err
+			}
+		}
+		if err := l.deleteHttpsPortForwardingRules(meta.RegionalKey("", l.cloud.Region()), nil); err != nil {
+			return err
+		}
+		if err := l.deleteStaticIP(true); err != nil {
 			return err
 		}
 	}
@@ -271,6 +372,9 @@ func (l *L7) Cleanup(versions *features.ResourceVersions) error {
 	if err := utils.IgnoreHTTPNotFound(composite.DeleteTargetHttpsProxy(l.cloud, key, versions.TargetHttpsProxy)); err != nil {
 		return err
 	}
+	if err := l.deleteServerTlsPolicy(); err != nil {
+		return err
+	}
 
 	// Delete the SSL cert if it is from a secret, not referencing a pre-created GCE cert or managed certificates.
 	secretsSslCerts, err := l.getIngressManagedSslCerts()
@@ -288,7 +392,9 @@ func (l *L7) Cleanup(versions *features.ResourceVersions) error {
 			if err := utils.IgnoreHTTPNotFound(composite.DeleteSslCertificate(l.cloud, key, versions.SslCertificate)); err != nil {
 				klog.Errorf("Old cert delete failed - %v", err)
 				certErr = err
+				continue
 			}
+			metrics.DeleteSSLCertificate(cert.Name)
 		}
 		l.sslCerts = nil
 		if certErr != nil {
@@ -304,6 +410,7 @@ func (l *L7) Cleanup(versions *features.ResourceVersions) error {
 	if err := utils.IgnoreHTTPNotFound(composite.DeleteUrlMap(l.cloud, key, versions.UrlMap)); err != nil {
 		return err
 	}
+	metrics.DeleteURLMap(umName)
 
 	return nil
 }
@@ -337,7 +444,11 @@ func GetLBAnnotations(l7 *L7, existing map[string]string, backendSyncer backends
 		certs = append(certs, cert.Name)
 	}
 
-	existing[fmt.Sprintf("%v/url-map", annotations.StatusPrefix)] = l7.um.Name
+	if l7.userURLMap != nil {
+		existing[fmt.Sprintf("%v/url-map", annotations.StatusPrefix)] = l7.userURLMap.Name
+	} else {
+		existing[fmt.Sprintf("%v/url-map", annotations.StatusPrefix)] = l7.um.Name
+	}
 	// Forwarding rule and target proxy might not exist if allowHTTP == false
 	if l7.fw != nil {
 		existing[fmt.Sprintf("%v/forwarding-rule", annotations.StatusPrefix)] = l7.fw.Name
@@ -383,5 +494,15 @@ func (l *L7) description() (string, error) {
 	ingressName := l.runtimeInfo.Ingress.ObjectMeta.Name
 	namespacedName := types.NamespacedName{Name: ingressName, Namespace: namespace}
 
-	return fmt.Sprintf(`{"kubernetes.io/ingress-name": %q}`, namespacedName.String()), nil
+	labels := l.propagatedLabels()
+	if len(labels) == 0 {
+		return fmt.Sprintf(`{"kubernetes.io/ingress-name": %q}`, namespacedName.String()), nil
+	}
+	// Record the labels in the description of the resources which have no
+	// labels.
+	labelsJSON, err := json.Marshal(labels)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`{"kubernetes.io/ingress-name": %q, "kubernetes.io/ingress-labels": %s}`, namespacedName.String(), labelsJSON), nil
 }
@@ -18,13 +18,17 @@ package loadbalancers
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/ingress-gce/pkg/composite"
 	"k8s.io/ingress-gce/pkg/events"
 	"k8s.io/ingress-gce/pkg/flags"
+	"k8s.io/ingress-gce/pkg/identity"
 	"k8s.io/ingress-gce/pkg/loadbalancers/features"
+	"k8s.io/ingress-gce/pkg/loadbalancers/metrics"
+	"k8s.io/ingress-gce/pkg/targetproxy"
 	"k8s.io/ingress-gce/pkg/utils/namer"
 	"k8s.io/klog"
 	"k8s.io/legacy-cloud-providers/gce"
@@ -33,38 +37,76 @@ import (
 // L7s implements LoadBalancerPool.
 type L7s struct {
 	cloud            *gce.Cloud
-	namer            *namer.Namer
+	namer            namer.IngressNamer
 	recorderProducer events.RecorderProducer
+
+	// namespaceClouds returns the client used to create and update the load
+	// balancer of an Ingress. If nil, cloud is used for all Ingresses.
+	namespaceClouds identity.CloudProvider
+	// proxyClient sets the target proxy settings which the compute API
+	// version in use does not expose, nil if disabled.
+	proxyClient targetproxy.Client
+
+	// staticIPs caches the static IPs of the l7s serving https only.
+	staticIPs *staticIPCache
+
+	// proxySubnetLock protects proxySubnetFound.
+	proxySubnetLock sync.Mutex
+	// proxySubnetFound is true once an active proxy-only subnet was found or
+	// created for L7-ILB, so that it is only verified once.
+	proxySubnetFound bool
 }
 
 // Namer returns the namer associated with the L7s.
-func (l *L7s) Namer() *namer.Namer {
+func (l *L7s) Namer() namer.IngressNamer {
 	return l.namer
 }
 
 // NewLoadBalancerPool returns a new loadbalancer pool.
 // - cloud: implements LoadBalancers. Used to sync L7 loadbalancer resources
 //	 with the cloud.
-func NewLoadBalancerPool(cloud *gce.Cloud, namer *namer.Namer, recorderProducer events.RecorderProducer) LoadBalancerPool {
+// - namespaceClouds: optional, provides the clients used to ensure the
+//	 loadbalancers of the Ingresses of each namespace.
+// - proxyClient: optional, sets the target proxy settings which the compute
+//	 API version in use does not expose.
+func NewLoadBalancerPool(cloud *gce.Cloud, namespaceClouds identity.CloudProvider, proxyClient targetproxy.Client, namer namer.IngressNamer, recorderProducer events.RecorderProducer) LoadBalancerPool {
+	metrics.RegisterMetrics()
 	return &L7s{
 		cloud:            cloud,
+		namespaceClouds:  namespaceClouds,
+		proxyClient:      proxyClient,
 		namer:            namer,
 		recorderProducer: recorderProducer,
+		staticIPs:        newStaticIPCache(),
 	}
 }
 
 // Ensure ensures a loadbalancer and its resources given the RuntimeInfo
 func (l *L7s) Ensure(ri *L7RuntimeInfo) (*L7, error) {
+	cloud := l.cloud
+	if l.namespaceClouds != nil {
+		var err error
+		if cloud, err = l.namespaceClouds.Cloud(ri.Ingress.Namespace); err != nil {
+			return nil, err
+		}
+	}
 	lb := &L7{
 		runtimeInfo: ri,
 		Name:        l.namer.LoadBalancer(ri.Name),
-		cloud:       l.cloud,
+		cloud:       cloud,
+		proxyClient: l.proxyClient,
+		staticIPs:   l.staticIPs,
 		namer:       l.namer,
 		recorder:    l.recorderProducer.Recorder(ri.Ingress.Namespace),
-		scope:       features.ScopeFromIngress(ri.Ingress),
+		scope:       features.ScopeFromIngress(ri.Ingress, ri.IngressClasses),
 		ingress:     *ri.Ingress,
 	}
 
+	if lb.Regional() {
+		if err := l.ensureProxyOnlySubnet(flags.F.L7IlbProxySubnetCIDR); err != nil {
+			return nil, err
+		}
+	}
 	if err := lb.edgeHop(); err != nil {
 		return nil, fmt.Errorf("loadbalancer %v does not exist: %v", lb.Name, err)
 	}
@@ -77,6 +119,7 @@ func (l *L7s) Delete(name string, versions *features.ResourceVersions, scope met
 		runtimeInfo: &L7RuntimeInfo{Name: name},
 		Name:        l.namer.LoadBalancer(name),
 		cloud:       l.cloud,
+		staticIPs:   l.staticIPs,
 		namer:       l.namer,
 		scope:       scope,
 	}
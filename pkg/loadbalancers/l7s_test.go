@@ -297,10 +297,10 @@ func newTestLoadBalancerPool() LoadBalancerPool {
 	namer := namer_util.NewNamer(testClusterName, "fw1")
 	fakeGCECloud := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
 	ctx := &context.ControllerContext{}
-	return NewLoadBalancerPool(fakeGCECloud, namer, ctx)
+	return NewLoadBalancerPool(fakeGCECloud, nil, nil, namer, ctx)
 }
 
-func createFakeLoadbalancer(cloud *gce.Cloud, namer *namer_util.Namer, lbKey string, versions *features.ResourceVersions, scope meta.KeyType) {
+func createFakeLoadbalancer(cloud *gce.Cloud, namer namer_util.IngressNamer, lbKey string, versions *features.ResourceVersions, scope meta.KeyType) {
 	lbName := namer.LoadBalancer(lbKey)
 	key, _ := composite.CreateKey(cloud, "", scope)
 
@@ -317,7 +317,7 @@ func createFakeLoadbalancer(cloud *gce.Cloud, namer *namer_util.Namer, lbKey str
 
 }
 
-func removeFakeLoadBalancer(cloud *gce.Cloud, namer *namer_util.Namer, lbKey string, versions *features.ResourceVersions, scope meta.KeyType) {
+func removeFakeLoadBalancer(cloud *gce.Cloud, namer namer_util.IngressNamer, lbKey string, versions *features.ResourceVersions, scope meta.KeyType) {
 	lbName := namer.LoadBalancer(lbKey)
 
 	key, _ := composite.CreateKey(cloud, "", scope)
@@ -333,7 +333,7 @@ func removeFakeLoadBalancer(cloud *gce.Cloud, namer *namer_util.Namer, lbKey str
 	cloud.DeleteGlobalAddress(namer.ForwardingRule(lbName, namer_util.HTTPProtocol))
 }
 
-func checkFakeLoadBalancer(cloud *gce.Cloud, namer *namer_util.Namer, lbKey string, versions *features.ResourceVersions, scope meta.KeyType, expectPresent bool) error {
+func checkFakeLoadBalancer(cloud *gce.Cloud, namer namer_util.IngressNamer, lbKey string, versions *features.ResourceVersions, scope meta.KeyType, expectPresent bool) error {
 	var err error
 	lbName := namer.LoadBalancer(lbKey)
 	key, _ := composite.CreateKey(cloud, namer.ForwardingRule(lbName, namer_util.HTTPProtocol), scope)
@@ -0,0 +1,132 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loadbalancers
+
+import (
+	"sort"
+	"strings"
+
+	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/flags"
+	"k8s.io/klog"
+)
+
+// maxGCELabelLength is the maximum length of the keys and values of the
+// labels of GCE resources.
+const maxGCELabelLength = 63
+
+// setForwardingRuleLabels sets the labels of a forwarding rule. It is a
+// variable so that tests, whose fake cloud does not implement the call, can
+// replace it.
+var setForwardingRuleLabels = composite.SetLabelsForForwardingRule
+
+// propagatedLabels returns the labels of the Ingress and of its Services
+// with the keys of --propagated-labels, the labels of the Ingress winning on
+// conflict.
+func (l *L7) propagatedLabels() map[string]string {
+	if l.runtimeInfo.Ingress == nil {
+		return nil
+	}
+	labels := map[string]string{}
+	for _, key := range flags.F.PropagatedLabels {
+		if value, ok := l.runtimeInfo.Ingress.Labels[key]; ok {
+			labels[key] = value
+		} else if value, ok := l.runtimeInfo.ServiceLabels[key]; ok {
+			labels[key] = value
+		}
+	}
+	return labels
+}
+
+// mergeLabels returns the existing labels of a resource with the desired
+// labels set and the other keys of --propagated-labels removed, keeping the
+// labels the controller does not manage.
+func mergeLabels(existing, desired map[string]string) map[string]string {
+	keys := map[string]string{}
+	for _, key := range flags.F.PropagatedLabels {
+		keys[key] = ""
+	}
+	managed := gceLabels(keys)
+	result := map[string]string{}
+	for key, value := range existing {
+		if _, ok := managed[key]; !ok {
+			result[key] = value
+		}
+	}
+	for key, value := range desired {
+		result[key] = value
+	}
+	return result
+}
+
+// gceLabels converts Kubernetes labels to labels of GCE resources, whose keys
+// and values only have lowercase letters, digits, '_' and '-', at most 63
+// characters, and whose keys start with a letter.
+func gceLabels(labels map[string]string) map[string]string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	// Sort the keys, so that the same label is skipped at every sync.
+	sort.Strings(keys)
+
+	result := map[string]string{}
+	for _, key := range keys {
+		gceKey := gceLabelValue(key)
+		if gceKey == "" || gceKey[0] < 'a' || gceKey[0] > 'z' {
+			gceKey = gceLabelValue("k" + gceKey)
+		}
+		if _, ok := result[gceKey]; ok {
+			klog.Warningf("Label %q collides with another label as GCE label %q, skipping it", key, gceKey)
+			continue
+		}
+		result[gceKey] = gceLabelValue(labels[key])
+	}
+	return result
+}
+
+// gceLabelValue lowercases s, replaces its characters other than letters,
+// digits, '_' and '-' with '_' and truncates it to 63 characters.
+func gceLabelValue(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '_'
+	}, s)
+	if len(s) > maxGCELabelLength {
+		s = s[:maxGCELabelLength]
+	}
+	return s
+}
+
+// equalLabels returns true if the labels are equal, nil and empty labels
+// being equal.
+func equalLabels(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
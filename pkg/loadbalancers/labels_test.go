@@ -0,0 +1,103 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loadbalancers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/ingress-gce/pkg/flags"
+)
+
+func TestGCELabels(t *testing.T) {
+	for _, tc := range []struct {
+		desc   string
+		labels map[string]string
+		want   map[string]string
+	}{
+		{
+			desc:   "valid labels",
+			labels: map[string]string{"team": "payments", "cost-center": "cc_42"},
+			want:   map[string]string{"team": "payments", "cost-center": "cc_42"},
+		},
+		{
+			desc:   "prefixed key and uppercase value",
+			labels: map[string]string{"example.com/team": "Payments.EU"},
+			want:   map[string]string{"example_com_team": "payments_eu"},
+		},
+		{
+			desc:   "key starting with a digit",
+			labels: map[string]string{"1team": ""},
+			want:   map[string]string{"k1team": ""},
+		},
+		{
+			desc:   "long value",
+			labels: map[string]string{"team": strings.Repeat("a", 70)},
+			want:   map[string]string{"team": strings.Repeat("a", 63)},
+		},
+		{
+			desc:   "colliding keys",
+			labels: map[string]string{"a.team": "1", "a/team": "2"},
+			want:   map[string]string{"a_team": "1"},
+		},
+	} {
+		if got := gceLabels(tc.labels); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: gceLabels(%v) = %v, want %v", tc.desc, tc.labels, got, tc.want)
+		}
+	}
+}
+
+func TestMergeLabels(t *testing.T) {
+	defer func(labels []string) { flags.F.PropagatedLabels = labels }(flags.F.PropagatedLabels)
+	flags.F.PropagatedLabels = []string{"team", "example.com/Cost-Center"}
+
+	for _, tc := range []struct {
+		desc     string
+		existing map[string]string
+		desired  map[string]string
+		want     map[string]string
+	}{
+		{
+			desc:    "no existing labels",
+			desired: map[string]string{"team": "payments"},
+			want:    map[string]string{"team": "payments"},
+		},
+		{
+			desc:     "changed label",
+			existing: map[string]string{"team": "payments"},
+			desired:  map[string]string{"team": "search"},
+			want:     map[string]string{"team": "search"},
+		},
+		{
+			desc:     "stale label",
+			existing: map[string]string{"team": "payments", "example_com_cost-center": "42"},
+			desired:  map[string]string{"team": "payments"},
+			want:     map[string]string{"team": "payments"},
+		},
+		{
+			desc:     "unmanaged label",
+			existing: map[string]string{"team": "payments", "owner": "alice"},
+			desired:  map[string]string{},
+			want:     map[string]string{"owner": "alice"},
+		},
+	} {
+		if got := mergeLabels(tc.existing, tc.desired); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: mergeLabels(%v, %v) = %v, want %v", tc.desc, tc.existing, tc.desired, got, tc.want)
+		}
+	}
+}
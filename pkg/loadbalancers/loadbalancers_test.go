@@ -20,23 +20,32 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
 
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/mock"
+	computebeta "google.golang.org/api/compute/v0.beta"
 	"google.golang.org/api/compute/v1"
 	"google.golang.org/api/googleapi"
 	"k8s.io/api/networking/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/ingress-gce/pkg/annotations"
+	backendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/backendconfig/v1beta1"
+	frontendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1"
+	"k8s.io/ingress-gce/pkg/backends"
 	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/controller/errors"
 	"k8s.io/ingress-gce/pkg/events"
+	"k8s.io/ingress-gce/pkg/flags"
 	"k8s.io/ingress-gce/pkg/instances"
 	"k8s.io/ingress-gce/pkg/loadbalancers/features"
+	"k8s.io/ingress-gce/pkg/targetproxy"
 	"k8s.io/ingress-gce/pkg/utils"
 	namer_util "k8s.io/ingress-gce/pkg/utils/namer"
 	"k8s.io/kubernetes/pkg/util/slice"
@@ -50,6 +59,8 @@ const (
 	defaultZone    = "zone-a"
 	defaultVersion = meta.VersionGA
 	defaultScope   = meta.Global
+
+	proxySubnetName = "proxy-only"
 )
 
 var (
@@ -97,6 +108,14 @@ func newTestJig(t *testing.T) *testJig {
 		return nil
 	}
 	mockGCE.MockGlobalForwardingRules.InsertHook = InsertGlobalForwardingRuleHook
+	// L7-ILB requires a proxy-only subnet in the region of the cluster.
+	proxySubnet := &computebeta.Subnetwork{
+		Name:    proxySubnetName,
+		Network: fakeGCE.NetworkURL(),
+		Purpose: internalHTTPSLoadBalancerPurpose,
+		Role:    activeSubnetRole,
+	}
+	mockGCE.BetaSubnetworks().Insert(context.Background(), meta.RegionalKey(proxySubnetName, fakeGCE.Region()), proxySubnet)
 
 	return &testJig{
 		pool:    newFakeLoadBalancerPool(fakeGCE, t, namer),
@@ -146,7 +165,7 @@ func newFakeLoadBalancerPool(cloud *gce.Cloud, t *testing.T, namer *namer_util.N
 	nodePool := instances.NewNodePool(fakeIGs, namer)
 	nodePool.Init(&instances.FakeZoneLister{Zones: []string{defaultZone}})
 
-	return NewLoadBalancerPool(cloud, namer, events.RecorderProducerMock{})
+	return NewLoadBalancerPool(cloud, nil, nil, namer, events.RecorderProducerMock{})
 }
 
 func newILBIngress() *v1beta1.Ingress {
@@ -249,6 +268,535 @@ func TestCreateHTTPSLoadBalancer(t *testing.T) {
 	verifyHTTPSForwardingRuleAndProxyLinks(t, j, l7)
 }
 
+func TestPropagatedLabels(t *testing.T) {
+	j := newTestJig(t)
+	defer func(labels []string) { flags.F.PropagatedLabels = labels }(flags.F.PropagatedLabels)
+	flags.F.PropagatedLabels = []string{"team", "example.com/Cost-Center"}
+
+	var setCalls []map[string]string
+	defer func(orig func(*gce.Cloud, *meta.Key, *composite.ForwardingRule, map[string]string) error) {
+		setForwardingRuleLabels = orig
+	}(setForwardingRuleLabels)
+	setForwardingRuleLabels = func(_ *gce.Cloud, _ *meta.Key, _ *composite.ForwardingRule, labels map[string]string) error {
+		setCalls = append(setCalls, labels)
+		return nil
+	}
+
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	ing := newIngress()
+	ing.Labels = map[string]string{"team": "Payments", "app": "web"}
+	lbInfo := &L7RuntimeInfo{
+		Name:          j.namer.LoadBalancer(ingressName),
+		AllowHTTP:     true,
+		UrlMap:        gceUrlMap,
+		Ingress:       ing,
+		ServiceLabels: map[string]string{"team": "search", "example.com/Cost-Center": "42"},
+	}
+
+	l7, err := j.pool.Ensure(lbInfo)
+	if err != nil || l7 == nil {
+		t.Fatalf("j.pool.Ensure(%v) = %v, want nil", lbInfo, err)
+	}
+	if got := l7.Versions().ForwardingRule; got != meta.VersionBeta {
+		t.Errorf("Got forwarding rule version %q, want %q", got, meta.VersionBeta)
+	}
+	key, err := composite.CreateKey(j.fakeGCE, j.FWName(l7.Name, false), l7.scope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw, err := composite.GetForwardingRule(j.fakeGCE, key, meta.VersionBeta)
+	if err != nil {
+		t.Fatalf("GetForwardingRule(%v) = _, %v, want nil", key, err)
+	}
+	wantLabels := map[string]string{"team": "payments", "example_com_cost-center": "42"}
+	if !reflect.DeepEqual(fw.Labels, wantLabels) {
+		t.Errorf("Got labels %v on created forwarding rule, want %v", fw.Labels, wantLabels)
+	}
+	if len(setCalls) != 0 {
+		t.Errorf("Got label set calls %v on creation, want none", setCalls)
+	}
+	wantDescription := `{"kubernetes.io/ingress-name": "namespace1/test", "kubernetes.io/ingress-labels": {"example.com/Cost-Center":"42","team":"Payments"}}`
+	if fw.Description != wantDescription {
+		t.Errorf("Got description %q, want %q", fw.Description, wantDescription)
+	}
+
+	// Removing the label from the Ingress updates the existing rule with the
+	// label of the Service.
+	delete(ing.Labels, "team")
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("j.pool.Ensure(%v) = %v, want nil", lbInfo, err)
+	}
+	wantLabels["team"] = "search"
+	if !reflect.DeepEqual(setCalls, []map[string]string{wantLabels}) {
+		t.Errorf("Got label set calls %v, want [%v]", setCalls, wantLabels)
+	}
+}
+
+func TestHTTPSProxyQuicOverride(t *testing.T) {
+	j := newTestJig(t)
+
+	var setCalls []string
+	defer func(orig func(*gce.Cloud, *meta.Key, *composite.TargetHttpsProxy, string) error) {
+		setQuicOverride = orig
+	}(setQuicOverride)
+	setQuicOverride = func(_ *gce.Cloud, _ *meta.Key, _ *composite.TargetHttpsProxy, quicOverride string) error {
+		setCalls = append(setCalls, quicOverride)
+		return nil
+	}
+
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	feConfig := &frontendconfigv1beta1.FrontendConfig{
+		Spec: frontendconfigv1beta1.FrontendConfigSpec{QuicOverride: frontendconfigv1beta1.QuicOverrideEnable},
+	}
+	lbInfo := &L7RuntimeInfo{
+		Name:           j.namer.LoadBalancer(ingressName),
+		AllowHTTP:      false,
+		TLS:            []*TLSCerts{createCert("key", "cert", "name")},
+		UrlMap:         gceUrlMap,
+		Ingress:        newIngress(),
+		FrontendConfig: feConfig,
+	}
+
+	l7, err := j.pool.Ensure(lbInfo)
+	if err != nil || l7 == nil {
+		t.Fatalf("j.pool.Ensure(%v) = %v, want nil", lbInfo, err)
+	}
+	key, err := composite.CreateKey(j.fakeGCE, j.TPName(l7.Name, true), l7.scope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tps, err := composite.GetTargetHttpsProxy(j.fakeGCE, key, l7.Versions().TargetHttpsProxy)
+	if err != nil {
+		t.Fatalf("GetTargetHttpsProxy(%v) = _, %v, want nil", key, err)
+	}
+	if tps.QuicOverride != frontendconfigv1beta1.QuicOverrideEnable {
+		t.Errorf("Got QuicOverride %q on created proxy, want %q", tps.QuicOverride, frontendconfigv1beta1.QuicOverrideEnable)
+	}
+	if len(setCalls) != 0 {
+		t.Errorf("Got QuicOverride set calls %v on creation, want none", setCalls)
+	}
+
+	// Changing the FrontendConfig updates the existing proxy.
+	feConfig.Spec.QuicOverride = frontendconfigv1beta1.QuicOverrideDisable
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("j.pool.Ensure(%v) = %v, want nil", lbInfo, err)
+	}
+	if !reflect.DeepEqual(setCalls, []string{frontendconfigv1beta1.QuicOverrideDisable}) {
+		t.Errorf("Got QuicOverride set calls %v, want [%s]", setCalls, frontendconfigv1beta1.QuicOverrideDisable)
+	}
+
+	// An empty QuicOverride leaves the proxy unchanged.
+	setCalls = nil
+	feConfig.Spec.QuicOverride = ""
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("j.pool.Ensure(%v) = %v, want nil", lbInfo, err)
+	}
+	if len(setCalls) != 0 {
+		t.Errorf("Got QuicOverride set calls %v for empty QuicOverride, want none", setCalls)
+	}
+}
+
+func TestProxyKeepAliveTimeout(t *testing.T) {
+	defer func(orig bool) { flags.F.EnableProxyKeepAlive = orig }(flags.F.EnableProxyKeepAlive)
+	flags.F.EnableProxyKeepAlive = true
+	j := newTestJig(t)
+	proxyClient := targetproxy.NewFakeClient()
+	j.pool = NewLoadBalancerPool(j.fakeGCE, nil, proxyClient, j.namer, events.RecorderProducerMock{})
+
+	lbName := j.namer.LoadBalancer(ingressName)
+	proxyClient.Proxies[targetproxy.HTTP][j.TPName(lbName, false)] = &targetproxy.Proxy{Name: j.TPName(lbName, false)}
+	proxyClient.Proxies[targetproxy.HTTPS][j.TPName(lbName, true)] = &targetproxy.Proxy{Name: j.TPName(lbName, true), HttpKeepAliveTimeoutSec: 610}
+
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	feConfig := &frontendconfigv1beta1.FrontendConfig{
+		Spec: frontendconfigv1beta1.FrontendConfigSpec{HttpKeepAliveTimeoutSec: 620},
+	}
+	lbInfo := &L7RuntimeInfo{
+		Name:           lbName,
+		AllowHTTP:      true,
+		TLS:            []*TLSCerts{createCert("key", "cert", "name")},
+		UrlMap:         gceUrlMap,
+		Ingress:        newIngress(),
+		FrontendConfig: feConfig,
+	}
+
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("j.pool.Ensure(%v) = %v, want nil", lbInfo, err)
+	}
+	for _, collection := range []string{targetproxy.HTTP, targetproxy.HTTPS} {
+		for name, proxy := range proxyClient.Proxies[collection] {
+			if proxy.HttpKeepAliveTimeoutSec != 620 {
+				t.Errorf("Got HttpKeepAliveTimeoutSec %d for %s %s, want 620", proxy.HttpKeepAliveTimeoutSec, collection, name)
+			}
+		}
+	}
+
+	// An unset timeout leaves the proxies unchanged, without getting them.
+	feConfig.Spec.HttpKeepAliveTimeoutSec = 0
+	delete(proxyClient.Proxies[targetproxy.HTTP], j.TPName(lbName, false))
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("j.pool.Ensure(%v) = %v, want nil", lbInfo, err)
+	}
+	if got := proxyClient.Proxies[targetproxy.HTTPS][j.TPName(lbName, true)].HttpKeepAliveTimeoutSec; got != 620 {
+		t.Errorf("Got HttpKeepAliveTimeoutSec %d for https proxy, want 620", got)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	defer func(orig bool) { flags.F.EnableMutualTLS = orig }(flags.F.EnableMutualTLS)
+	flags.F.EnableMutualTLS = true
+	j := newTestJig(t)
+	proxyClient := targetproxy.NewFakeClient()
+	j.pool = NewLoadBalancerPool(j.fakeGCE, nil, proxyClient, j.namer, events.RecorderProducerMock{})
+
+	lbName := j.namer.LoadBalancer(ingressName)
+	tpsName := j.TPName(lbName, true)
+	proxyClient.Proxies[targetproxy.HTTPS][tpsName] = &targetproxy.Proxy{Name: tpsName}
+
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	feConfig := &frontendconfigv1beta1.FrontendConfig{
+		Spec: frontendconfigv1beta1.FrontendConfigSpec{
+			MutualTLS: &frontendconfigv1beta1.MutualTLSConfig{TrustConfig: "trust"},
+		},
+	}
+	lbInfo := &L7RuntimeInfo{
+		Name:           lbName,
+		AllowHTTP:      false,
+		TLS:            []*TLSCerts{createCert("key", "cert", "name")},
+		UrlMap:         gceUrlMap,
+		Ingress:        newIngress(),
+		FrontendConfig: feConfig,
+	}
+	managedURL := targetproxy.ServerTlsPolicyURL(targetproxy.FakeProject, tpsName)
+
+	// A trust config gets a managed policy.
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("j.pool.Ensure(%v) = %v, want nil", lbInfo, err)
+	}
+	if got := proxyClient.Proxies[targetproxy.HTTPS][tpsName].ServerTlsPolicy; got != managedURL {
+		t.Errorf("Got ServerTlsPolicy %q, want %q", got, managedURL)
+	}
+	wantPolicy := targetproxy.MtlsPolicy{
+		ClientValidationMode:        frontendconfigv1beta1.ClientValidationModeRejectInvalid,
+		ClientValidationTrustConfig: fmt.Sprintf("projects/%s/locations/global/trustConfigs/trust", j.fakeGCE.ProjectID()),
+	}
+	if policy, ok := proxyClient.Policies[tpsName]; !ok || *policy.MtlsPolicy != wantPolicy {
+		t.Errorf("Got ServerTlsPolicy %+v, want mtlsPolicy %+v", policy, wantPolicy)
+	}
+
+	// Changing the validation mode updates the managed policy.
+	feConfig.Spec.MutualTLS.ClientValidationMode = frontendconfigv1beta1.ClientValidationModeAllowInvalid
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("j.pool.Ensure(%v) = %v, want nil", lbInfo, err)
+	}
+	if got := proxyClient.Policies[tpsName].MtlsPolicy.ClientValidationMode; got != frontendconfigv1beta1.ClientValidationModeAllowInvalid {
+		t.Errorf("Got clientValidationMode %q, want %q", got, frontendconfigv1beta1.ClientValidationModeAllowInvalid)
+	}
+
+	// An existing policy replaces the managed one, which is deleted.
+	feConfig.Spec.MutualTLS = &frontendconfigv1beta1.MutualTLSConfig{ServerTlsPolicy: "existing"}
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("j.pool.Ensure(%v) = %v, want nil", lbInfo, err)
+	}
+	if got, want := proxyClient.Proxies[targetproxy.HTTPS][tpsName].ServerTlsPolicy, targetproxy.ServerTlsPolicyURL(targetproxy.FakeProject, "existing"); got != want {
+		t.Errorf("Got ServerTlsPolicy %q, want %q", got, want)
+	}
+	if _, ok := proxyClient.Policies[tpsName]; ok {
+		t.Errorf("Managed ServerTlsPolicy %s was not deleted", tpsName)
+	}
+
+	// An unset config leaves the proxy unchanged, and an empty one detaches
+	// the policy.
+	feConfig.Spec.MutualTLS = nil
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("j.pool.Ensure(%v) = %v, want nil", lbInfo, err)
+	}
+	if got := proxyClient.Proxies[targetproxy.HTTPS][tpsName].ServerTlsPolicy; got == "" {
+		t.Errorf("Got no ServerTlsPolicy for an unset mutualTLS, want it unchanged")
+	}
+	feConfig.Spec.MutualTLS = &frontendconfigv1beta1.MutualTLSConfig{}
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("j.pool.Ensure(%v) = %v, want nil", lbInfo, err)
+	}
+	if got := proxyClient.Proxies[targetproxy.HTTPS][tpsName].ServerTlsPolicy; got != "" {
+		t.Errorf("Got ServerTlsPolicy %q for an empty mutualTLS, want none", got)
+	}
+}
+
+func TestForwardingRuleGlobalAccess(t *testing.T) {
+	j := newTestJig(t)
+
+	var setCalls []bool
+	defer func(orig func(*gce.Cloud, *meta.Key, *composite.ForwardingRule, bool) error) {
+		setForwardingRuleGlobalAccess = orig
+	}(setForwardingRuleGlobalAccess)
+	setForwardingRuleGlobalAccess = func(_ *gce.Cloud, _ *meta.Key, _ *composite.ForwardingRule, allow bool) error {
+		setCalls = append(setCalls, allow)
+		return nil
+	}
+
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	allow := true
+	feConfig := &frontendconfigv1beta1.FrontendConfig{
+		Spec: frontendconfigv1beta1.FrontendConfigSpec{AllowGlobalAccess: &allow},
+	}
+	lbInfo := &L7RuntimeInfo{
+		Name:           j.namer.LoadBalancer(ingressName),
+		AllowHTTP:      true,
+		UrlMap:         gceUrlMap,
+		Ingress:        newILBIngress(),
+		FrontendConfig: feConfig,
+	}
+
+	l7, err := j.pool.Ensure(lbInfo)
+	if err != nil || l7 == nil {
+		t.Fatalf("j.pool.Ensure(%v) = %v, want nil", lbInfo, err)
+	}
+	key := meta.RegionalKey(j.FWName(lbInfo.Name, false), j.fakeGCE.Region())
+	fw, err := composite.GetForwardingRule(j.fakeGCE, key, meta.VersionBeta)
+	if err != nil {
+		t.Fatalf("GetForwardingRule(%v) = %v, want nil", key, err)
+	}
+	if !fw.AllowGlobalAccess {
+		t.Errorf("Got forwarding rule allowGlobalAccess false, want true")
+	}
+	if len(setCalls) != 0 {
+		t.Errorf("Got global access set to %v for the new forwarding rule, want no call", setCalls)
+	}
+
+	// The existing forwarding rule is updated when the setting changes.
+	allow = false
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("j.pool.Ensure(%v) = %v, want nil", lbInfo, err)
+	}
+	if !reflect.DeepEqual(setCalls, []bool{false}) {
+		t.Errorf("Got global access set to %v, want [false]", setCalls)
+	}
+
+	// The setting of the forwarding rule is left unchanged if unset.
+	feConfig.Spec.AllowGlobalAccess = nil
+	setCalls = nil
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("j.pool.Ensure(%v) = %v, want nil", lbInfo, err)
+	}
+	if len(setCalls) != 0 {
+		t.Errorf("Got global access set to %v without setting, want no call", setCalls)
+	}
+}
+
+// healthySyncer reports all the backends healthy.
+type healthySyncer struct {
+	backends.Syncer
+}
+
+func (healthySyncer) Status(string, meta.Version, meta.KeyType) (string, error) {
+	return "HEALTHY", nil
+}
+
+func TestUserURLMap(t *testing.T) {
+	j := newTestJig(t)
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	lbInfo := &L7RuntimeInfo{
+		Name:       j.namer.LoadBalancer(ingressName),
+		AllowHTTP:  true,
+		UrlMap:     gceUrlMap,
+		Ingress:    newIngress(),
+		UserURLMap: "user-map",
+	}
+	if _, err := j.pool.Ensure(lbInfo); err == nil {
+		t.Fatalf("j.pool.Ensure(%v) = nil, want error for a missing URL map", lbInfo)
+	}
+
+	userMap := &composite.UrlMap{Name: "user-map", DefaultService: "global/backendServices/user-backend"}
+	if err := composite.CreateUrlMap(j.fakeGCE, meta.GlobalKey("user-map"), userMap); err != nil {
+		t.Fatal(err)
+	}
+	proxyURLMap := func() string {
+		t.Helper()
+		tp, err := composite.GetTargetHttpProxy(j.fakeGCE, meta.GlobalKey(j.TPName(lbInfo.Name, false)), meta.VersionGA)
+		if err != nil {
+			t.Fatalf("GetTargetHttpProxy() = %v", err)
+		}
+		return tp.UrlMap
+	}
+	for _, link := range []string{"user-map", "https://www.googleapis.com/compute/v1/projects/test-project/global/urlMaps/user-map"} {
+		lbInfo.UserURLMap = link
+		l7, err := j.pool.Ensure(lbInfo)
+		if err != nil {
+			t.Fatalf("j.pool.Ensure(%v) = %v, want nil", lbInfo, err)
+		}
+		if got := proxyURLMap(); !strings.HasSuffix(got, "global/urlMaps/user-map") {
+			t.Errorf("Got target proxy URL map %q with %q, want user-map", got, link)
+		}
+		status, err := GetLBAnnotations(l7, nil, healthySyncer{})
+		if err != nil {
+			t.Fatalf("GetLBAnnotations() = %v", err)
+		}
+		if got := status[annotations.StatusPrefix+"/url-map"]; got != "user-map" {
+			t.Errorf("Got url-map status %q, want user-map", got)
+		}
+	}
+
+	// The URL map of the Ingress is still synced, and the user's URL map is
+	// left unchanged.
+	if _, err := composite.GetUrlMap(j.fakeGCE, meta.GlobalKey(j.UMName(lbInfo.Name)), meta.VersionGA); err != nil {
+		t.Errorf("GetUrlMap(%q) = %v, want nil", j.UMName(lbInfo.Name), err)
+	}
+	um, err := composite.GetUrlMap(j.fakeGCE, meta.GlobalKey("user-map"), meta.VersionGA)
+	if err != nil || !strings.HasSuffix(um.DefaultService, "/backendServices/user-backend") {
+		t.Errorf("GetUrlMap(user-map) = %+v, %v, want default service user-backend", um, err)
+	}
+
+	lbInfo.UserURLMap = "projects/test-project/regions/us-central1/urlMaps/user-map"
+	if _, err := j.pool.Ensure(lbInfo); err == nil {
+		t.Errorf("j.pool.Ensure(%v) = nil, want error for a regional URL map", lbInfo)
+	}
+	lbInfo.UserURLMap = "projects/other-project/global/urlMaps/user-map"
+	if _, err := j.pool.Ensure(lbInfo); err == nil {
+		t.Errorf("j.pool.Ensure(%v) = nil, want error for a URL map of another project", lbInfo)
+	}
+
+	lbInfo.UserURLMap = ""
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("j.pool.Ensure(%v) = %v, want nil", lbInfo, err)
+	}
+	if got := proxyURLMap(); !strings.HasSuffix(got, "global/urlMaps/"+j.UMName(lbInfo.Name)) {
+		t.Errorf("Got target proxy URL map %q, want %q", got, j.UMName(lbInfo.Name))
+	}
+}
+
+func TestHttpsPorts(t *testing.T) {
+	j := newTestJig(t)
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	feConfig := &frontendconfigv1beta1.FrontendConfig{
+		Spec: frontendconfigv1beta1.FrontendConfigSpec{HttpsPorts: []int64{443, 8443}},
+	}
+	lbInfo := &L7RuntimeInfo{
+		Name:           j.namer.LoadBalancer(ingressName),
+		AllowHTTP:      false,
+		TLS:            []*TLSCerts{createCert("key", "cert", "name")},
+		UrlMap:         gceUrlMap,
+		Ingress:        newIngress(),
+		FrontendConfig: feConfig,
+	}
+	fwsKey := meta.GlobalKey(j.FWName(lbInfo.Name, true))
+	portKey := meta.GlobalKey(j.namer.HTTPSForwardingRuleForPort(lbInfo.Name, 8443))
+
+	l7, err := j.pool.Ensure(lbInfo)
+	if err != nil {
+		t.Fatalf("j.pool.Ensure(%v) = %v, want nil", lbInfo, err)
+	}
+	fws, err := composite.GetForwardingRule(j.fakeGCE, fwsKey, meta.VersionGA)
+	if err != nil {
+		t.Fatalf("GetForwardingRule(%v) = %v, want nil", fwsKey, err)
+	}
+	fwp, err := composite.GetForwardingRule(j.fakeGCE, portKey, meta.VersionGA)
+	if err != nil {
+		t.Fatalf("GetForwardingRule(%v) = %v, want nil", portKey, err)
+	}
+	if fws.PortRange != "443-443" || fwp.PortRange != "8443-8443" {
+		t.Errorf("Got port ranges %q and %q, want 443-443 and 8443-8443", fws.PortRange, fwp.PortRange)
+	}
+	if fwp.IPAddress != fws.IPAddress || !utils.EqualResourceIDs(fwp.Target, fws.Target) {
+		t.Errorf("Got additional forwarding rule %+v, want the IP and target of %+v", fwp, fws)
+	}
+	if l7.ip == nil || l7.ip.Address != fws.IPAddress {
+		t.Errorf("Got static IP %+v, want %q", l7.ip, fws.IPAddress)
+	}
+
+	// Serving a single port other than 443 moves the https forwarding rule
+	// to it, and deletes the additional forwarding rule.
+	feConfig.Spec.HttpsPorts = []int64{8443}
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("j.pool.Ensure(%v) = %v, want nil", lbInfo, err)
+	}
+	if fws, err := composite.GetForwardingRule(j.fakeGCE, fwsKey, meta.VersionGA); err != nil || fws.PortRange != "8443-8443" {
+		t.Errorf("GetForwardingRule(%v) = %+v, %v, want port range 8443-8443", fwsKey, fws, err)
+	}
+	if _, err := composite.GetForwardingRule(j.fakeGCE, portKey, meta.VersionGA); !utils.IsNotFoundError(err) {
+		t.Errorf("GetForwardingRule(%v) = %v, want not found", portKey, err)
+	}
+
+	feConfig.Spec.HttpsPorts = []int64{443, 8443}
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("j.pool.Ensure(%v) = %v, want nil", lbInfo, err)
+	}
+	if err := j.pool.Delete(lbInfo.Name, features.GAResourceVersions, defaultScope); err != nil {
+		t.Fatalf("pool.Delete() = %v, want nil", err)
+	}
+	if _, err := composite.GetForwardingRule(j.fakeGCE, portKey, meta.VersionGA); !utils.IsNotFoundError(err) {
+		t.Errorf("GetForwardingRule(%v) = %v, want not found", portKey, err)
+	}
+}
+
+func TestHttpsPortsCalls(t *testing.T) {
+	j := newTestJig(t)
+	addressGets, listed := 0, 0
+	j.mock.MockGlobalAddresses.GetHook = func(ctx context.Context, key *meta.Key, m *cloud.MockGlobalAddresses) (bool, *compute.Address, error) {
+		addressGets++
+		return false, nil, nil
+	}
+	j.mock.MockGlobalForwardingRules.ListHook = func(ctx context.Context, fl *filter.F, m *cloud.MockGlobalForwardingRules) (bool, []*compute.ForwardingRule, error) {
+		for _, obj := range m.Objects {
+			if fl.Match(obj.ToGA()) {
+				listed++
+			}
+		}
+		return false, nil, nil
+	}
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	lbInfo := &L7RuntimeInfo{
+		Name:      j.namer.LoadBalancer(ingressName),
+		AllowHTTP: false,
+		TLS:       []*TLSCerts{createCert("key", "cert", "name")},
+		UrlMap:    gceUrlMap,
+		Ingress:   newIngress(),
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := j.pool.Ensure(lbInfo); err != nil {
+			t.Fatalf("j.pool.Ensure(%v) = %v, want nil", lbInfo, err)
+		}
+	}
+	// The missing static IP of the https only l7 is cached, and the
+	// additional https forwarding rules are listed by name, which excludes
+	// the https forwarding rule.
+	if addressGets != 1 {
+		t.Errorf("Got the static IP %d times in 3 syncs, want 1", addressGets)
+	}
+	if listed != 0 {
+		t.Errorf("Listed %d forwarding rules, want 0", listed)
+	}
+}
+
+func TestValidateHttpsPorts(t *testing.T) {
+	ports := &frontendconfigv1beta1.FrontendConfig{Spec: frontendconfigv1beta1.FrontendConfigSpec{HttpsPorts: []int64{443, 8443}}}
+	port := &frontendconfigv1beta1.FrontendConfig{Spec: frontendconfigv1beta1.FrontendConfigSpec{HttpsPorts: []int64{8443}}}
+	for _, tc := range []struct {
+		desc     string
+		scope    meta.KeyType
+		feConfig *frontendconfigv1beta1.FrontendConfig
+		wantErr  bool
+	}{
+		{desc: "external default port", scope: meta.Global},
+		{desc: "external additional port", scope: meta.Global, feConfig: ports},
+		{desc: "internal other port", scope: meta.Regional, feConfig: port},
+		{desc: "internal additional port", scope: meta.Regional, feConfig: ports, wantErr: true},
+	} {
+		l7 := &L7{runtimeInfo: &L7RuntimeInfo{FrontendConfig: tc.feConfig}, scope: tc.scope}
+		if err := l7.validateHttpsPorts(); (err != nil) != tc.wantErr {
+			t.Errorf("%s: validateHttpsPorts() = %v, want error: %t", tc.desc, err, tc.wantErr)
+		}
+	}
+}
+
 func verifyHTTPSForwardingRuleAndProxyLinks(t *testing.T, j *testJig, l7 *L7) {
 	t.Helper()
 	lbName := j.namer.LoadBalancer(ingressName)
@@ -352,6 +900,100 @@ func TestCertUpdate(t *testing.T) {
 	verifyCertAndProxyLink(expectCerts, expectCerts, j, t)
 }
 
+// Test that a replaced cert is not deleted while the target proxy still references it.
+func TestCertRetainedWhileInUse(t *testing.T) {
+	j := newTestJig(t)
+
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	gceUrlMap.PutPathRulesForHost("bar.example.com", []utils.PathRule{utils.PathRule{Path: "/bar", Backend: utils.ServicePort{NodePort: 30000}}})
+	lbName := j.namer.LoadBalancer(ingressName)
+	certName1 := j.namer.SSLCertName(lbName, GetCertHash("cert"))
+	certName2 := j.namer.SSLCertName(lbName, GetCertHash("cert2"))
+
+	lbInfo := &L7RuntimeInfo{
+		Name:      lbName,
+		AllowHTTP: false,
+		TLS:       []*TLSCerts{createCert("key", "cert", "name")},
+		UrlMap:    gceUrlMap,
+		Ingress:   newIngress(),
+	}
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("pool.Ensure() = err %v", err)
+	}
+	expectCerts := map[string]string{certName1: "cert"}
+	verifyCertAndProxyLink(expectCerts, expectCerts, j, t)
+
+	// Fail the target proxy update, the proxy still references the first cert.
+	setSslCertificatesHook := j.mock.MockTargetHttpsProxies.SetSslCertificatesHook
+	j.mock.MockTargetHttpsProxies.SetSslCertificatesHook = func(ctx context.Context, key *meta.Key, request *compute.TargetHttpsProxiesSetSslCertificatesRequest, proxies *cloud.MockTargetHttpsProxies) error {
+		return fmt.Errorf("injected error")
+	}
+	lbInfo.TLS = []*TLSCerts{createCert("key2", "cert2", "name")}
+	if _, err := j.pool.Ensure(lbInfo); err == nil {
+		t.Fatalf("pool.Ensure() = nil, want error")
+	}
+	verifyCertAndProxyLink(map[string]string{certName1: "cert", certName2: "cert2"}, map[string]string{certName1: "cert"}, j, t)
+
+	// Once the proxy is updated the first cert is cleaned up.
+	j.mock.MockTargetHttpsProxies.SetSslCertificatesHook = setSslCertificatesHook
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("pool.Ensure() = err %v", err)
+	}
+	expectCerts = map[string]string{certName2: "cert2"}
+	verifyCertAndProxyLink(expectCerts, expectCerts, j, t)
+}
+
+// Test that deleteOldSSLCerts keeps a replaced cert until the target proxy no longer references it.
+func TestDeleteOldSSLCertsInUse(t *testing.T) {
+	j := newTestJig(t)
+
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	lbInfo := &L7RuntimeInfo{
+		Name:      j.namer.LoadBalancer(ingressName),
+		AllowHTTP: false,
+		TLS:       []*TLSCerts{createCert("key", "cert", "name")},
+		UrlMap:    gceUrlMap,
+		Ingress:   newIngress(),
+	}
+	l7, err := j.pool.Ensure(lbInfo)
+	if err != nil {
+		t.Fatalf("pool.Ensure() = err %v", err)
+	}
+	oldCert := l7.sslCerts[0]
+
+	// Replace the cert while the target proxy still references the old one.
+	key, err := composite.CreateKey(j.fakeGCE, j.namer.SSLCertName(lbInfo.Name, GetCertHash("cert2")), defaultScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCert := &composite.SslCertificate{Name: key.Name, Certificate: "cert2", PrivateKey: "key2", Version: defaultVersion}
+	if err := composite.CreateSslCertificate(j.fakeGCE, key, newCert); err != nil {
+		t.Fatalf("CreateSslCertificate() = %v", err)
+	}
+	l7.oldSSLCerts = []*composite.SslCertificate{oldCert}
+	l7.sslCerts = []*composite.SslCertificate{newCert}
+	l7.deleteOldSSLCerts()
+	verifyCertAndProxyLink(map[string]string{oldCert.Name: "cert", newCert.Name: "cert2"}, map[string]string{oldCert.Name: "cert"}, j, t)
+
+	// Once the target proxy references the new cert, the old one is deleted.
+	proxyKey, err := composite.CreateKey(j.fakeGCE, j.TPName(lbInfo.Name, true), defaultScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy, err := composite.GetTargetHttpsProxy(j.fakeGCE, proxyKey, defaultVersion)
+	if err != nil {
+		t.Fatalf("GetTargetHttpsProxy() = %v", err)
+	}
+	newCertLink := cloud.SelfLink(meta.VersionGA, "test-project", "sslCertificates", meta.GlobalKey(newCert.Name))
+	if err := composite.SetSslCertificateForTargetHttpsProxy(j.fakeGCE, proxyKey, proxy, []string{newCertLink}); err != nil {
+		t.Fatalf("SetSslCertificateForTargetHttpsProxy() = %v", err)
+	}
+	l7.deleteOldSSLCerts()
+	verifyCertAndProxyLink(map[string]string{newCert.Name: "cert2"}, map[string]string{newCert.Name: "cert2"}, j, t)
+}
+
 // Test that multiple secrets with the same certificate value don't cause a sync error.
 func TestMultipleSecretsWithSameCert(t *testing.T) {
 	j := newTestJig(t)
@@ -489,7 +1131,7 @@ func TestMultipleCertRetentionAfterRestart(t *testing.T) {
 	verifyCertAndProxyLink(expectCerts, expectCerts, j, t)
 }
 
-//TestUpgradeToNewCertNames verifies that certs uploaded using the old naming convention
+// TestUpgradeToNewCertNames verifies that certs uploaded using the old naming convention
 // are picked up and deleted when upgrading to the new scheme.
 func TestUpgradeToNewCertNames(t *testing.T) {
 	j := newTestJig(t)
@@ -549,8 +1191,8 @@ func TestUpgradeToNewCertNames(t *testing.T) {
 	verifyCertAndProxyLink(expectCerts, expectCerts, j, t)
 }
 
-// Tests uploading 15 certs which is the limit for the fake loadbalancer. Ensures that creation of the 16th cert fails.
-// Tests uploading 10 certs which is the target proxy limit. Uploading 11th cert should fail.
+// Tests uploading 20 certs which is the limit for the fake loadbalancer. Ensures that creation of the 21st cert fails.
+// Tests uploading 15 certs which is the target proxy limit. Uploading 16th cert should fail.
 func TestMaxCertsUpload(t *testing.T) {
 	j := newTestJig(t)
 
@@ -597,7 +1239,11 @@ func TestMaxCertsUpload(t *testing.T) {
 	if err == nil {
 		t.Fatalf("Assigning more than %d certs should have errored out", TargetProxyCertLimit)
 	}
-	// load balancer will contain the extra cert, but target proxy will not
+	// load balancer will contain the extra cert, but target proxy will not.
+	// The certs the target proxy still references are not deleted either.
+	for certName, cert := range expectCerts {
+		expectCertsExtra[certName] = cert
+	}
 	verifyCertAndProxyLink(expectCertsExtra, expectCerts, j, t)
 	// Removing the extra cert from ingress spec should delete it
 	lbInfo.TLS = lbInfo.TLS[:TargetProxyCertLimit]
@@ -922,6 +1568,58 @@ func TestCreateHTTPSLoadBalancerAnnotationCert(t *testing.T) {
 	verifyHTTPSForwardingRuleAndProxyLinks(t, j, l7)
 }
 
+// TestPreSharedCertRotation verifies that new pre-shared certs are attached
+// to the target proxy before the old ones are removed.
+func TestPreSharedCertRotation(t *testing.T) {
+	j := newTestJig(t)
+
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	gceUrlMap.PutPathRulesForHost("bar.example.com", []utils.PathRule{utils.PathRule{Path: "/bar", Backend: utils.ServicePort{NodePort: 30000}}})
+	lbInfo := &L7RuntimeInfo{
+		Name:      j.namer.LoadBalancer(ingressName),
+		AllowHTTP: false,
+		TLSName:   "old-cert",
+		UrlMap:    gceUrlMap,
+		Ingress:   newIngress(),
+	}
+
+	for _, name := range []string{"old-cert", "new-cert"} {
+		key, err := composite.CreateKey(j.fakeGCE, name, defaultScope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := composite.CreateSslCertificate(j.fakeGCE, key, &composite.SslCertificate{Name: name, Certificate: name}); err != nil {
+			t.Fatalf("CreateSslCertificate(%q) = %v", name, err)
+		}
+	}
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("pool.Ensure() = err %v", err)
+	}
+
+	var updates [][]string
+	setSslCertificatesHook := j.mock.MockTargetHttpsProxies.SetSslCertificatesHook
+	j.mock.MockTargetHttpsProxies.SetSslCertificatesHook = func(ctx context.Context, key *meta.Key, request *compute.TargetHttpsProxiesSetSslCertificatesRequest, proxies *cloud.MockTargetHttpsProxies) error {
+		var names []string
+		for _, link := range request.SslCertificates {
+			name, _ := utils.KeyName(link)
+			names = append(names, name)
+		}
+		updates = append(updates, names)
+		return setSslCertificatesHook(ctx, key, request, proxies)
+	}
+
+	lbInfo.TLSName = "new-cert"
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("pool.Ensure() = err %v", err)
+	}
+	expectUpdates := [][]string{{"old-cert", "new-cert"}, {"new-cert"}}
+	if !reflect.DeepEqual(updates, expectUpdates) {
+		t.Errorf("Got target proxy cert updates %v, want %v", updates, expectUpdates)
+	}
+	verifyCertAndProxyLink(map[string]string{"old-cert": "old-cert", "new-cert": "new-cert"}, map[string]string{"new-cert": "new-cert"}, j, t)
+}
+
 func TestCreateBothLoadBalancers(t *testing.T) {
 	// This should create 2 forwarding rules and target proxies
 	// but they should use the same urlmap, and have the same
@@ -1075,6 +1773,45 @@ func TestPoolSyncNoChanges(t *testing.T) {
 	}
 }
 
+func TestPoolSyncURLMapFingerprintConflict(t *testing.T) {
+	j := newTestJig(t)
+
+	// Count the updates and reject the first one as a concurrent modification.
+	updateCalls := 0
+	j.mock.MockUrlMaps.UpdateHook = func(ctx context.Context, key *meta.Key, obj *compute.UrlMap, m *cloud.MockUrlMaps) error {
+		updateCalls++
+		if updateCalls == 1 {
+			return &googleapi.Error{Code: http.StatusPreconditionFailed, Message: "fingerprint mismatch"}
+		}
+		return mock.UpdateURLMapHook(ctx, key, obj, m)
+	}
+
+	urlMap := func(hosts int) *utils.GCEURLMap {
+		um := utils.NewGCEURLMap()
+		um.DefaultBackend = &utils.ServicePort{NodePort: 30000}
+		for i := 0; i < hosts; i++ {
+			um.PutPathRulesForHost(fmt.Sprintf("host-%d.example.com", i), []utils.PathRule{{Path: "/", Backend: utils.ServicePort{NodePort: 30001}}})
+		}
+		return um
+	}
+
+	lbInfo := &L7RuntimeInfo{Name: j.namer.LoadBalancer(ingressName), AllowHTTP: true, UrlMap: urlMap(10), Ingress: newIngress()}
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("pool.Ensure() = err %v", err)
+	}
+
+	// The 120 new hosts are added by a single update, after a retry.
+	lbInfo.UrlMap = urlMap(130)
+	l7, err := j.pool.Ensure(lbInfo)
+	if err != nil {
+		t.Fatalf("pool.Ensure() = err %v", err)
+	}
+	if updateCalls != 2 {
+		t.Errorf("got %d URL map updates, want 2", updateCalls)
+	}
+	verifyURLMap(t, j, l7.UrlMap().Name, lbInfo.UrlMap)
+}
+
 func TestNameParsing(t *testing.T) {
 	clusterName := "123"
 	firewallName := clusterName
@@ -1485,3 +2222,277 @@ func TestSecretBasedToPreSharedCertUpdateWithErrors(t *testing.T) {
 	}
 	verifyCertAndProxyLink(expectCerts, expectCerts, j, t)
 }
+
+func TestManagedStaticIP(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		preserve     bool
+		wantReleased bool
+	}{
+		{desc: "released on delete", preserve: false, wantReleased: true},
+		{desc: "preserved on delete", preserve: true, wantReleased: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			defer func(preserve bool) { flags.F.PreserveManagedStaticIPs = preserve }(flags.F.PreserveManagedStaticIPs)
+			flags.F.PreserveManagedStaticIPs = tc.preserve
+
+			j := newTestJig(t)
+			j.mock.MockGlobalAddresses.InsertHook = func(ctx context.Context, key *meta.Key, obj *compute.Address, m *cloud.MockGlobalAddresses) (bool, error) {
+				if obj.Address == "" {
+					obj.Address = "1.2.3.4"
+				}
+				return false, nil
+			}
+			gceUrlMap := utils.NewGCEURLMap()
+			gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+			lbInfo := &L7RuntimeInfo{
+				Name:            j.namer.LoadBalancer(ingressName),
+				AllowHTTP:       true,
+				ManagedStaticIP: true,
+				UrlMap:          gceUrlMap,
+				Ingress:         newIngress(),
+			}
+			l7, err := j.pool.Ensure(lbInfo)
+			if err != nil {
+				t.Fatalf("pool.Ensure() = %v, want nil", err)
+			}
+
+			ipName := j.FWName(lbInfo.Name, false)
+			ip, err := j.fakeGCE.GetGlobalAddress(ipName)
+			if err != nil {
+				t.Fatalf("GetGlobalAddress(%q) = %v, want nil", ipName, err)
+			}
+			if !isManagedStaticIP(ip) {
+				t.Errorf("Got static IP description %q, want managed static IP", ip.Description)
+			}
+			if got := l7.GetIP(); got != ip.Address {
+				t.Errorf("Got forwarding rule IP %q, want %q", got, ip.Address)
+			}
+			if l7.ip == nil || l7.ip.Name != ipName {
+				t.Errorf("Got l7 static IP %+v, want %q", l7.ip, ipName)
+			}
+
+			if err := j.pool.Delete(lbInfo.Name, features.GAResourceVersions, defaultScope); err != nil {
+				t.Fatalf("pool.Delete() = %v, want nil", err)
+			}
+			ip, _ = j.fakeGCE.GetGlobalAddress(ipName)
+			if released := ip == nil; released != tc.wantReleased {
+				t.Errorf("Got static IP released = %t, want %t", released, tc.wantReleased)
+			}
+		})
+	}
+}
+
+func TestManagedStaticIPKeepsExistingIP(t *testing.T) {
+	j := newTestJig(t)
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	lbInfo := &L7RuntimeInfo{
+		Name:      j.namer.LoadBalancer(ingressName),
+		AllowHTTP: true,
+		UrlMap:    gceUrlMap,
+		Ingress:   newIngress(),
+	}
+	l7, err := j.pool.Ensure(lbInfo)
+	if err != nil {
+		t.Fatalf("pool.Ensure() = %v, want nil", err)
+	}
+	ephemeralIP := l7.GetIP()
+
+	lbInfo.ManagedStaticIP = true
+	if l7, err = j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("pool.Ensure() = %v, want nil", err)
+	}
+	ip, err := j.fakeGCE.GetGlobalAddress(j.FWName(lbInfo.Name, false))
+	if err != nil {
+		t.Fatalf("GetGlobalAddress() = %v, want nil", err)
+	}
+	if ip.Address != ephemeralIP || l7.GetIP() != ephemeralIP {
+		t.Errorf("Got static IP %q and forwarding rule IP %q, want %q", ip.Address, l7.GetIP(), ephemeralIP)
+	}
+}
+
+func TestStandardNetworkTier(t *testing.T) {
+	j := newTestJig(t)
+	j.mock.MockForwardingRules.InsertHook = func(ctx context.Context, key *meta.Key, obj *compute.ForwardingRule, m *cloud.MockForwardingRules) (bool, error) {
+		if obj.IPAddress == "" {
+			obj.IPAddress = "0.0.0.2"
+		}
+		return false, nil
+	}
+	j.mock.MockAddresses.InsertHook = func(ctx context.Context, key *meta.Key, obj *compute.Address, m *cloud.MockAddresses) (bool, error) {
+		if obj.Address == "" {
+			obj.Address = "1.2.3.5"
+		}
+		return false, nil
+	}
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	feConfig := &frontendconfigv1beta1.FrontendConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "config"},
+		Spec:       frontendconfigv1beta1.FrontendConfigSpec{NetworkTier: frontendconfigv1beta1.NetworkTierStandard},
+	}
+	lbInfo := &L7RuntimeInfo{
+		Name:            j.namer.LoadBalancer(ingressName),
+		AllowHTTP:       true,
+		ManagedStaticIP: true,
+		UrlMap:          gceUrlMap,
+		Ingress:         newIngress(),
+		FrontendConfig:  feConfig,
+	}
+	fwName := j.FWName(lbInfo.Name, false)
+	regionalKey := meta.RegionalKey(fwName, j.fakeGCE.Region())
+	globalKey := meta.GlobalKey(fwName)
+
+	l7, err := j.pool.Ensure(lbInfo)
+	if err != nil {
+		t.Fatalf("pool.Ensure() = %v, want nil", err)
+	}
+	fw, err := composite.GetForwardingRule(j.fakeGCE, regionalKey, meta.VersionGA)
+	if err != nil {
+		t.Fatalf("GetForwardingRule(%v) = %v, want nil", regionalKey, err)
+	}
+	if fw.NetworkTier != frontendconfigv1beta1.NetworkTierStandard {
+		t.Errorf("Got forwarding rule network tier %q, want %q", fw.NetworkTier, frontendconfigv1beta1.NetworkTierStandard)
+	}
+	if _, err := composite.GetForwardingRule(j.fakeGCE, globalKey, meta.VersionGA); !utils.IsNotFoundError(err) {
+		t.Errorf("GetForwardingRule(%v) = %v, want not found", globalKey, err)
+	}
+	ip, err := j.fakeGCE.GetRegionAddress(fwName, j.fakeGCE.Region())
+	if err != nil {
+		t.Fatalf("GetRegionAddress(%q) = %v, want nil", fwName, err)
+	}
+	if ip.NetworkTier != frontendconfigv1beta1.NetworkTierStandard || l7.GetIP() != ip.Address {
+		t.Errorf("Got static IP %+v and forwarding rule IP %q, want a %s tier static IP of the forwarding rule", ip, l7.GetIP(), frontendconfigv1beta1.NetworkTierStandard)
+	}
+
+	// Switching to the Premium tier replaces the regional forwarding rule
+	// and static IP with global ones.
+	feConfig.Spec.NetworkTier = frontendconfigv1beta1.NetworkTierPremium
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("pool.Ensure() = %v, want nil", err)
+	}
+	if _, err := composite.GetForwardingRule(j.fakeGCE, globalKey, meta.VersionGA); err != nil {
+		t.Errorf("GetForwardingRule(%v) = %v, want nil", globalKey, err)
+	}
+	if _, err := composite.GetForwardingRule(j.fakeGCE, regionalKey, meta.VersionGA); !utils.IsNotFoundError(err) {
+		t.Errorf("GetForwardingRule(%v) = %v, want not found", regionalKey, err)
+	}
+	if ip, _ := j.fakeGCE.GetRegionAddress(fwName, j.fakeGCE.Region()); ip != nil {
+		t.Errorf("Got regional static IP %+v, want nil", ip)
+	}
+
+	// Cleanup deletes the resources of both tiers.
+	feConfig.Spec.NetworkTier = frontendconfigv1beta1.NetworkTierStandard
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("pool.Ensure() = %v, want nil", err)
+	}
+	if err := j.pool.Delete(lbInfo.Name, features.GAResourceVersions, defaultScope); err != nil {
+		t.Fatalf("pool.Delete() = %v, want nil", err)
+	}
+	for _, key := range []*meta.Key{globalKey, regionalKey} {
+		if _, err := composite.GetForwardingRule(j.fakeGCE, key, meta.VersionGA); !utils.IsNotFoundError(err) {
+			t.Errorf("GetForwardingRule(%v) = %v, want not found", key, err)
+		}
+	}
+	if ip, _ := j.fakeGCE.GetRegionAddress(fwName, j.fakeGCE.Region()); ip != nil {
+		t.Errorf("Got regional static IP %+v, want nil", ip)
+	}
+}
+
+func TestValidateNetworkTier(t *testing.T) {
+	cdnMap := utils.NewGCEURLMap()
+	cdnMap.DefaultBackend = &utils.ServicePort{
+		NodePort:      31234,
+		BackendConfig: &backendconfigv1beta1.BackendConfig{Spec: backendconfigv1beta1.BackendConfigSpec{Cdn: &backendconfigv1beta1.CDNConfig{Enabled: true}}},
+	}
+	tierConfig := func(tier string) *frontendconfigv1beta1.FrontendConfig {
+		return &frontendconfigv1beta1.FrontendConfig{Spec: frontendconfigv1beta1.FrontendConfigSpec{NetworkTier: tier}}
+	}
+
+	for _, tc := range []struct {
+		desc    string
+		scope   meta.KeyType
+		info    *L7RuntimeInfo
+		wantErr bool
+	}{
+		{desc: "default tier", scope: meta.Global, info: &L7RuntimeInfo{StaticIPName: "ip", UrlMap: cdnMap}},
+		{desc: "premium tier", scope: meta.Global, info: &L7RuntimeInfo{StaticIPName: "ip", UrlMap: cdnMap, FrontendConfig: tierConfig(frontendconfigv1beta1.NetworkTierPremium)}},
+		{desc: "standard tier", scope: meta.Global, info: &L7RuntimeInfo{FrontendConfig: tierConfig(frontendconfigv1beta1.NetworkTierStandard)}},
+		{desc: "standard tier with global static IP", scope: meta.Global, info: &L7RuntimeInfo{StaticIPName: "ip", FrontendConfig: tierConfig(frontendconfigv1beta1.NetworkTierStandard)}, wantErr: true},
+		{desc: "standard tier with Cloud CDN", scope: meta.Global, info: &L7RuntimeInfo{UrlMap: cdnMap, FrontendConfig: tierConfig(frontendconfigv1beta1.NetworkTierStandard)}, wantErr: true},
+		{desc: "internal load balancer with tier", scope: meta.Regional, info: &L7RuntimeInfo{FrontendConfig: tierConfig(frontendconfigv1beta1.NetworkTierPremium)}, wantErr: true},
+	} {
+		l7 := &L7{runtimeInfo: tc.info, scope: tc.scope}
+		if err := l7.validateNetworkTier(); (err != nil) != tc.wantErr {
+			t.Errorf("%s: validateNetworkTier() = %v, want error: %t", tc.desc, err, tc.wantErr)
+		}
+	}
+}
+
+func TestEnsureProxyOnlySubnet(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		subnet     *computebeta.Subnetwork
+		cidr       string
+		wantErr    bool
+		wantCreate bool
+	}{
+		{
+			desc:   "active proxy-only subnet",
+			subnet: &computebeta.Subnetwork{Purpose: internalHTTPSLoadBalancerPurpose, Role: activeSubnetRole},
+		},
+		{
+			desc:   "active regional managed proxy subnet",
+			subnet: &computebeta.Subnetwork{Purpose: regionalManagedProxyPurpose, Role: activeSubnetRole},
+		},
+		{
+			desc:    "backup proxy-only subnet",
+			subnet:  &computebeta.Subnetwork{Purpose: internalHTTPSLoadBalancerPurpose, Role: "BACKUP"},
+			wantErr: true,
+		},
+		{
+			desc:    "private subnet",
+			subnet:  &computebeta.Subnetwork{Purpose: "PRIVATE"},
+			wantErr: true,
+		},
+		{
+			desc:       "missing subnet with CIDR",
+			cidr:       "10.129.0.0/23",
+			wantCreate: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			j := newTestJig(t)
+			ctx := context.Background()
+			region := j.fakeGCE.Region()
+			if err := j.mock.BetaSubnetworks().Delete(ctx, meta.RegionalKey(proxySubnetName, region)); err != nil {
+				t.Fatalf("BetaSubnetworks().Delete() = %v", err)
+			}
+			if tc.subnet != nil {
+				tc.subnet.Network = j.fakeGCE.NetworkURL()
+				j.mock.BetaSubnetworks().Insert(ctx, meta.RegionalKey("subnet", region), tc.subnet)
+			}
+
+			l7s := j.pool.(*L7s)
+			err := l7s.ensureProxyOnlySubnet(tc.cidr)
+			if _, ok := err.(errors.ErrMissingProxyOnlySubnet); ok != tc.wantErr {
+				t.Errorf("ensureProxyOnlySubnet(%q) = %v, want ErrMissingProxyOnlySubnet? %t", tc.cidr, err, tc.wantErr)
+			}
+			created, _ := j.mock.BetaSubnetworks().Get(ctx, meta.RegionalKey(j.namer.ProxyOnlySubnet(), region))
+			if gotCreate := created != nil; gotCreate != tc.wantCreate {
+				t.Errorf("Got proxy-only subnet created = %t, want %t", gotCreate, tc.wantCreate)
+			}
+			if created != nil && (created.IpCidrRange != tc.cidr || !isActiveProxyOnlySubnet(created)) {
+				t.Errorf("Got proxy-only subnet %+v, want active proxy-only subnet with range %q", created, tc.cidr)
+			}
+			if err == nil && !l7s.proxySubnetFound {
+				t.Errorf("l7s.proxySubnetFound = false, want true")
+			}
+		})
+	}
+}
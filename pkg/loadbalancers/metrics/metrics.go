@@ -0,0 +1,124 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/ingress-gce/pkg/metrics"
+)
+
+const (
+	l7Subsystem = "l7"
+
+	urlMapHostRulesKey            = "url_map_host_rules"
+	urlMapPathRulesKey            = "url_map_path_rules"
+	urlMapFingerprintConflictsKey = "url_map_fingerprint_conflicts_total"
+	sslCertificateExpiryKey       = "ssl_certificate_expiry_timestamp_seconds"
+)
+
+var (
+	urlMapLabels = []string{
+		"url_map", // The name of the URL map.
+	}
+
+	sslCertificateLabels = []string{
+		"ssl_certificate", // The name of the SslCertificate.
+	}
+
+	// URLMapHostRules is the number of host rules of each URL map.
+	URLMapHostRules = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.GLBC_NAMESPACE,
+			Subsystem: l7Subsystem,
+			Name:      urlMapHostRulesKey,
+			Help:      "Number of host rules of a URL map",
+		},
+		urlMapLabels,
+	)
+
+	// URLMapPathRules is the number of path and route rules of each URL map.
+	URLMapPathRules = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.GLBC_NAMESPACE,
+			Subsystem: l7Subsystem,
+			Name:      urlMapPathRulesKey,
+			Help:      "Number of path and route rules of a URL map",
+		},
+		urlMapLabels,
+	)
+
+	// URLMapFingerprintConflicts counts the URL map updates rejected because
+	// the URL map was modified concurrently.
+	URLMapFingerprintConflicts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.GLBC_NAMESPACE,
+			Subsystem: l7Subsystem,
+			Name:      urlMapFingerprintConflictsKey,
+			Help:      "Number of URL map updates rejected because of a stale fingerprint",
+		},
+		urlMapLabels,
+	)
+
+	// SSLCertificateExpiry is the expiry time of each SslCertificate used by
+	// a target https proxy.
+	SSLCertificateExpiry = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.GLBC_NAMESPACE,
+			Subsystem: l7Subsystem,
+			Name:      sslCertificateExpiryKey,
+			Help:      "Expiry time of an SSL certificate in seconds since the epoch",
+		},
+		sslCertificateLabels,
+	)
+)
+
+var register sync.Once
+
+func RegisterMetrics() {
+	register.Do(func() {
+		prometheus.MustRegister(URLMapHostRules)
+		prometheus.MustRegister(URLMapPathRules)
+		prometheus.MustRegister(URLMapFingerprintConflicts)
+		prometheus.MustRegister(SSLCertificateExpiry)
+	})
+}
+
+// ObserveURLMapSize publishes the size of the given URL map.
+func ObserveURLMapSize(name string, hostRules, pathRules int) {
+	URLMapHostRules.WithLabelValues(name).Set(float64(hostRules))
+	URLMapPathRules.WithLabelValues(name).Set(float64(pathRules))
+}
+
+// DeleteURLMap removes the metrics of a deleted URL map.
+func DeleteURLMap(name string) {
+	URLMapHostRules.DeleteLabelValues(name)
+	URLMapPathRules.DeleteLabelValues(name)
+	URLMapFingerprintConflicts.DeleteLabelValues(name)
+}
+
+// ObserveSSLCertificateExpiry publishes the expiry time of the given cert.
+func ObserveSSLCertificateExpiry(name string, expiry time.Time) {
+	SSLCertificateExpiry.WithLabelValues(name).Set(float64(expiry.Unix()))
+}
+
+// DeleteSSLCertificate removes the metrics of a deleted cert.
+func DeleteSSLCertificate(name string) {
+	SSLCertificateExpiry.DeleteLabelValues(name)
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loadbalancers
+
+import (
+	"fmt"
+	"strings"
+
+	frontendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1"
+	"k8s.io/ingress-gce/pkg/flags"
+	"k8s.io/ingress-gce/pkg/targetproxy"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/ingress-gce/pkg/utils/namer"
+	"k8s.io/klog"
+)
+
+// mutualTLS returns the mutual TLS configuration of the target https proxy
+// from the FrontendConfig of the Ingress. Nil means the ServerTlsPolicy of
+// the proxy is not managed, which is also the case for regional load
+// balancers and when mutual TLS is disabled.
+func (l *L7) mutualTLS() *frontendconfigv1beta1.MutualTLSConfig {
+	if l.proxyClient == nil || !flags.F.EnableMutualTLS || l.runtimeInfo.FrontendConfig == nil || l.Regional() {
+		return nil
+	}
+	return l.runtimeInfo.FrontendConfig.Spec.MutualTLS
+}
+
+// ensureMutualTLS attaches the ServerTlsPolicy configured in the FrontendConfig
+// of the Ingress to the target https proxy. A TrustConfig gets a policy owned
+// by the controller, named after the proxy, which is deleted once detached.
+func (l *L7) ensureMutualTLS() error {
+	mtls := l.mutualTLS()
+	if mtls == nil || l.tps == nil {
+		return nil
+	}
+	managedName := l.namer.TargetProxy(l.Name, namer.HTTPSProtocol)
+	managedURL := l.proxyClient.ServerTlsPolicyURL(managedName)
+	var url string
+	switch {
+	case mtls.TrustConfig != "":
+		if err := l.ensureServerTlsPolicy(managedName, mtls); err != nil {
+			return err
+		}
+		url = managedURL
+	case mtls.ServerTlsPolicy != "":
+		url = l.proxyClient.ServerTlsPolicyURL(mtls.ServerTlsPolicy)
+	}
+
+	proxy, err := l.proxyClient.Get(targetproxy.HTTPS, l.tps.Name)
+	if err != nil {
+		return err
+	}
+	if proxy.ServerTlsPolicy == url {
+		return nil
+	}
+	previous := proxy.ServerTlsPolicy
+	klog.V(3).Infof("Proxy %q has ServerTlsPolicy %q, setting %q", proxy.Name, previous, url)
+	proxy.ServerTlsPolicy = url
+	if url == "" {
+		proxy.NullFields = []string{"serverTlsPolicy"}
+	}
+	if err := l.proxyClient.Patch(targetproxy.HTTPS, proxy); err != nil {
+		return err
+	}
+	if previous == managedURL {
+		return l.deleteServerTlsPolicy()
+	}
+	return nil
+}
+
+// ensureServerTlsPolicy creates or updates the ServerTlsPolicy with the given
+// name, which validates the client certificates with the TrustConfig.
+func (l *L7) ensureServerTlsPolicy(name string, mtls *frontendconfigv1beta1.MutualTLSConfig) error {
+	mode := mtls.ClientValidationMode
+	if mode == "" {
+		mode = frontendconfigv1beta1.ClientValidationModeRejectInvalid
+	}
+	trustConfig := mtls.TrustConfig
+	if !strings.Contains(trustConfig, "/") {
+		trustConfig = fmt.Sprintf("projects/%s/locations/global/trustConfigs/%s", l.cloud.ProjectID(), trustConfig)
+	}
+	want := &targetproxy.MtlsPolicy{ClientValidationMode: mode, ClientValidationTrustConfig: trustConfig}
+
+	policy, err := l.proxyClient.GetServerTlsPolicy(name)
+	if utils.IsNotFoundError(err) {
+		klog.V(2).Infof("Creating ServerTlsPolicy %v for trust config %v", name, trustConfig)
+		return l.proxyClient.CreateServerTlsPolicy(name, &targetproxy.ServerTlsPolicy{
+			Description: fmt.Sprintf("mTLS policy of load balancer %v", l.Name),
+			MtlsPolicy:  want,
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if policy.MtlsPolicy != nil && *policy.MtlsPolicy == *want {
+		return nil
+	}
+	klog.V(2).Infof("Updating ServerTlsPolicy %v for trust config %v", name, trustConfig)
+	return l.proxyClient.PatchServerTlsPolicy(name, &targetproxy.ServerTlsPolicy{MtlsPolicy: want})
+}
+
+// deleteServerTlsPolicy deletes the ServerTlsPolicy owned by the controller
+// for the target https proxy of the l7, if any.
+func (l *L7) deleteServerTlsPolicy() error {
+	if l.proxyClient == nil || !flags.F.EnableMutualTLS || l.Regional() {
+		return nil
+	}
+	name := l.namer.TargetProxy(l.Name, namer.HTTPSProtocol)
+	klog.V(2).Infof("Deleting ServerTlsPolicy %v", name)
+	return utils.IgnoreHTTPNotFound(l.proxyClient.DeleteServerTlsPolicy(name))
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loadbalancers
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"google.golang.org/api/compute/v1"
+	"k8s.io/ingress-gce/pkg/annotations"
+	frontendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1"
+	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/flags"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/ingress-gce/pkg/utils/namer"
+	"k8s.io/klog"
+)
+
+// networkTier returns the network tier of the forwarding rules and static IP
+// of the l7, which is set by its FrontendConfig, or else by its IngressClass,
+// and is PREMIUM by default. Regional load balancers are internal and have no
+// network tier.
+func (l *L7) networkTier() string {
+	if l.Regional() {
+		return ""
+	}
+	if feConfig := l.runtimeInfo.FrontendConfig; feConfig != nil && feConfig.Spec.NetworkTier != "" {
+		return feConfig.Spec.NetworkTier
+	}
+	if l.runtimeInfo.Ingress != nil {
+		if params, ok := utils.IngressClassParamsFor(l.runtimeInfo.Ingress, l.runtimeInfo.IngressClasses); ok && params.NetworkTier != "" {
+			return params.NetworkTier
+		}
+	}
+	return frontendconfigv1beta1.NetworkTierPremium
+}
+
+// standardTier returns true if the l7 is in the Standard network tier, whose
+// forwarding rules and static IP are regional even though its proxies and
+// url map are global.
+func (l *L7) standardTier() bool {
+	return l.networkTier() == frontendconfigv1beta1.NetworkTierStandard
+}
+
+// validateNetworkTier returns an error if the l7 uses features which are not
+// available in its network tier.
+func (l *L7) validateNetworkTier() error {
+	if l.Regional() {
+		if feConfig := l.runtimeInfo.FrontendConfig; feConfig != nil && feConfig.Spec.NetworkTier != "" {
+			return fmt.Errorf("FrontendConfig %s/%s sets networkTier %s, which is not supported by internal load balancers", feConfig.Namespace, feConfig.Name, feConfig.Spec.NetworkTier)
+		}
+		return nil
+	}
+	if !l.standardTier() {
+		return nil
+	}
+	if l.runtimeInfo.StaticIPName != "" {
+		return fmt.Errorf("the %s network tier does not support the global static IP %q of annotation %q, reserve a regional static IP instead",
+			frontendconfigv1beta1.NetworkTierStandard, l.runtimeInfo.StaticIPName, annotations.StaticIPNameKey)
+	}
+	if l.runtimeInfo.UrlMap != nil {
+		for _, sp := range l.runtimeInfo.UrlMap.AllServicePorts() {
+			if sp.BackendConfig != nil && sp.BackendConfig.Spec.Cdn != nil && sp.BackendConfig.Spec.Cdn.Enabled {
+				return fmt.Errorf("the %s network tier does not support Cloud CDN, which is enabled for backend %v", frontendconfigv1beta1.NetworkTierStandard, sp.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// forwardingRuleKey returns the key of the forwarding rule of the l7 with the
+// given name, which is regional in the Standard network tier.
+func (l *L7) forwardingRuleKey(name string) (*meta.Key, error) {
+	if l.standardTier() {
+		return meta.RegionalKey(name, l.cloud.Region()), nil
+	}
+	return l.CreateKey(name)
+}
+
+// deleteOtherTierForwardingRule deletes the forwarding rule with the given
+// name and the static IP owned by the controller of the other network tier,
+// which are in the other scope, so that the l7 can switch tiers. It is only
+// called when the forwarding rule of the current tier does not exist.
+func (l *L7) deleteOtherTierForwardingRule(name string) error {
+	if l.Regional() {
+		return nil
+	}
+	key := meta.RegionalKey(name, l.cloud.Region())
+	if l.standardTier() {
+		var err error
+		if key, err = l.CreateKey(name); err != nil {
+			return err
+		}
+	}
+	if err := utils.IgnoreHTTPNotFound(composite.DeleteForwardingRule(l.cloud, key, l.Versions().ForwardingRule)); err != nil {
+		return err
+	}
+	return l.deleteStaticIP(!l.standardTier())
+}
+
+// getStaticIP returns the static IP with the given name in the scope of the
+// network tier of the l7.
+func (l *L7) getStaticIP(name string) (*compute.Address, error) {
+	if l.standardTier() {
+		return l.cloud.GetRegionAddress(name, l.cloud.Region())
+	}
+	return l.cloud.GetGlobalAddress(name)
+}
+
+// staticIPKey returns the key of the static IP with the given name in the
+// scope of the network tier of the l7, in the static IP cache.
+func (l *L7) staticIPKey(name string) string {
+	if l.standardTier() {
+		return l.cloud.Region() + "/" + name
+	}
+	return name
+}
+
+// reserveStaticIP reserves the static IP in the scope of the network tier of
+// the l7.
+func (l *L7) reserveStaticIP(ip *compute.Address) error {
+	defer l.staticIPs.invalidate(l.staticIPKey(ip.Name))
+	if l.standardTier() {
+		ip.NetworkTier = frontendconfigv1beta1.NetworkTierStandard
+		return l.cloud.ReserveRegionAddress(ip, l.cloud.Region())
+	}
+	return l.cloud.ReserveGlobalAddress(ip)
+}
+
+// deleteStaticIP deletes the global or regional static IP owned by the
+// controller for the l7, unless it is a managed static IP which is preserved.
+func (l *L7) deleteStaticIP(regional bool) error {
+	name := l.namer.ForwardingRule(l.Name, namer.HTTPProtocol)
+	var ip *compute.Address
+	var err error
+	if regional {
+		ip, err = l.cloud.GetRegionAddress(name, l.cloud.Region())
+	} else {
+		ip, err = l.cloud.GetGlobalAddress(name)
+	}
+	if ip == nil || utils.IgnoreHTTPNotFound(err) != nil {
+		return nil
+	}
+	if isManagedStaticIP(ip) && flags.Reloadable().PreserveManagedStaticIPs {
+		klog.V(2).Infof("Preserving managed static IP %v(%v)", ip.Name, ip.Address)
+		return nil
+	}
+	klog.V(2).Infof("Deleting static IP %v(%v)", ip.Name, ip.Address)
+	if regional {
+		defer l.staticIPs.invalidate(l.cloud.Region() + "/" + name)
+		return utils.IgnoreHTTPNotFound(l.cloud.DeleteRegionAddress(ip.Name, l.cloud.Region()))
+	}
+	defer l.staticIPs.invalidate(name)
+	return utils.IgnoreHTTPNotFound(l.cloud.DeleteGlobalAddress(ip.Name))
+}
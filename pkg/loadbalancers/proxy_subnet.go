@@ -0,0 +1,93 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loadbalancers
+
+import (
+	"context"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	computebeta "google.golang.org/api/compute/v0.beta"
+	"k8s.io/ingress-gce/pkg/controller/errors"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/klog"
+)
+
+const (
+	// Purposes of the subnets reserved for the proxies of regional managed
+	// load balancers. REGIONAL_MANAGED_PROXY supersedes INTERNAL_HTTPS_LOAD_BALANCER.
+	internalHTTPSLoadBalancerPurpose = "INTERNAL_HTTPS_LOAD_BALANCER"
+	regionalManagedProxyPurpose      = "REGIONAL_MANAGED_PROXY"
+
+	activeSubnetRole = "ACTIVE"
+)
+
+// ensureProxyOnlySubnet verifies that the network of the cluster has an
+// active proxy-only subnet in its region, which L7-ILB requires. A missing
+// subnet is created if a CIDR is given, otherwise ErrMissingProxyOnlySubnet
+// is returned.
+func (l *L7s) ensureProxyOnlySubnet(cidr string) error {
+	l.proxySubnetLock.Lock()
+	defer l.proxySubnetLock.Unlock()
+	if l.proxySubnetFound {
+		return nil
+	}
+
+	ctx := context.Background()
+	region := l.cloud.Region()
+	subnets, err := l.cloud.Compute().BetaSubnetworks().List(ctx, region, filter.None)
+	if err != nil {
+		return err
+	}
+	for _, subnet := range subnets {
+		if isActiveProxyOnlySubnet(subnet) && sameNetwork(subnet.Network, l.cloud.NetworkURL()) {
+			klog.V(3).Infof("Found proxy-only subnet %v in region %v", subnet.Name, region)
+			l.proxySubnetFound = true
+			return nil
+		}
+	}
+
+	if cidr == "" {
+		return errors.ErrMissingProxyOnlySubnet{Network: l.cloud.NetworkURL(), Region: region}
+	}
+	subnet := &computebeta.Subnetwork{
+		Name:        l.namer.ProxyOnlySubnet(),
+		Description: "Proxy-only subnet for internal HTTP(S) load balancers, created by the Ingress controller",
+		Network:     l.cloud.NetworkURL(),
+		IpCidrRange: cidr,
+		Purpose:     internalHTTPSLoadBalancerPurpose,
+		Role:        activeSubnetRole,
+	}
+	klog.V(2).Infof("Creating proxy-only subnet %v(%v) in region %v", subnet.Name, cidr, region)
+	if err := l.cloud.Compute().BetaSubnetworks().Insert(ctx, meta.RegionalKey(subnet.Name, region), subnet); err != nil {
+		return err
+	}
+	l.proxySubnetFound = true
+	return nil
+}
+
+func isActiveProxyOnlySubnet(subnet *computebeta.Subnetwork) bool {
+	if subnet.Purpose != internalHTTPSLoadBalancerPurpose && subnet.Purpose != regionalManagedProxyPurpose {
+		return false
+	}
+	return subnet.Role == activeSubnetRole
+}
+
+// sameNetwork returns true if the given network URLs refer to the same network.
+func sameNetwork(a, b string) bool {
+	return a == b || utils.EqualResourceIDs(a, b)
+}
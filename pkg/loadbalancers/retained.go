@@ -0,0 +1,131 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loadbalancers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"k8s.io/api/networking/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/annotations"
+	apisretainedloadbalancer "k8s.io/ingress-gce/pkg/apis/retainedloadbalancer"
+	retainedloadbalancerv1beta1 "k8s.io/ingress-gce/pkg/apis/retainedloadbalancer/v1beta1"
+	"k8s.io/ingress-gce/pkg/crd"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/klog"
+)
+
+// retainedResourceKeys are the status annotations of an Ingress naming the
+// frontend resources of its load balancer.
+var retainedResourceKeys = []string{"url-map", "forwarding-rule", "target-proxy", "https-forwarding-rule", "https-target-proxy", "static-ip", "ssl-cert"}
+
+// RetainedLoadBalancerCRDMeta returns the metadata of the RetainedLoadBalancer
+// CRD.
+func RetainedLoadBalancerCRDMeta() *crd.CRDMeta {
+	return crd.NewCRDMeta(
+		apisretainedloadbalancer.GroupName,
+		"v1beta1",
+		"RetainedLoadBalancer",
+		"RetainedLoadBalancerList",
+		"retainedloadbalancer",
+		"retainedloadbalancers",
+	)
+}
+
+// NewRetainedLoadBalancerSpec returns the record of the load balancer of the
+// Ingress with the given name, whose resources are read from the status
+// annotations of the Ingress. classes looks up the IngressClass of the Ingress.
+func NewRetainedLoadBalancerSpec(ing *v1beta1.Ingress, lbName string, classes utils.IngressClassLookup) retainedloadbalancerv1beta1.RetainedLoadBalancerSpec {
+	spec := retainedloadbalancerv1beta1.RetainedLoadBalancerSpec{
+		LoadBalancer: lbName,
+		NamingScheme: utils.NamingScheme(ing),
+		Regional:     utils.IsGCEL7ILBIngress(ing, classes),
+	}
+	for _, key := range retainedResourceKeys {
+		if name := ing.Annotations[fmt.Sprintf("%v/%v", annotations.StatusPrefix, key)]; name != "" {
+			if spec.Resources == nil {
+				spec.Resources = map[string]string{}
+			}
+			spec.Resources[key] = name
+		}
+	}
+	backendState := map[string]string{}
+	if val, ok := ing.Annotations[fmt.Sprintf("%v/backends", annotations.StatusPrefix)]; ok {
+		if err := json.Unmarshal([]byte(val), &backendState); err != nil {
+			klog.Warningf("Ignoring the invalid backends annotation of Ingress %s/%s: %v", ing.Namespace, ing.Name, err)
+		}
+	}
+	for name := range backendState {
+		spec.BackendServices = append(spec.BackendServices, name)
+	}
+	sort.Strings(spec.BackendServices)
+	return spec
+}
+
+// EnsureRetainedLoadBalancer creates the RetainedLoadBalancer of the Ingress
+// with the given spec unless it exists. Returns true if it was created.
+func EnsureRetainedLoadBalancer(client dynamic.NamespaceableResourceInterface, ing *v1beta1.Ingress, spec retainedloadbalancerv1beta1.RetainedLoadBalancerSpec) (bool, error) {
+	record := &retainedloadbalancerv1beta1.RetainedLoadBalancer{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: retainedloadbalancerv1beta1.SchemeGroupVersion.String(),
+			Kind:       "RetainedLoadBalancer",
+		},
+		ObjectMeta: metav1.ObjectMeta{Namespace: ing.Namespace, Name: ing.Name},
+		Spec:       spec,
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(record)
+	if err != nil {
+		return false, err
+	}
+	_, err = client.Namespace(ing.Namespace).Create(&unstructured.Unstructured{Object: content}, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	klog.V(2).Infof("Created RetainedLoadBalancer %s/%s for load balancer %q", ing.Namespace, ing.Name, spec.LoadBalancer)
+	return true, nil
+}
+
+// ListRetainedLoadBalancers returns the RetainedLoadBalancers of all the
+// namespaces from the informer. Returns nil if the informer is nil.
+func ListRetainedLoadBalancers(informer cache.SharedIndexInformer) ([]*retainedloadbalancerv1beta1.RetainedLoadBalancer, error) {
+	if informer == nil {
+		return nil, nil
+	}
+	var ret []*retainedloadbalancerv1beta1.RetainedLoadBalancer
+	for _, obj := range informer.GetStore().List() {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return nil, fmt.Errorf("unexpected RetainedLoadBalancer type %T", obj)
+		}
+		record := &retainedloadbalancerv1beta1.RetainedLoadBalancer{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, record); err != nil {
+			return nil, fmt.Errorf("error converting RetainedLoadBalancer %s/%s: %v", u.GetNamespace(), u.GetName(), err)
+		}
+		ret = append(ret, record)
+	}
+	return ret, nil
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loadbalancers
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/ingress-gce/pkg/annotations"
+	retainedloadbalancerv1beta1 "k8s.io/ingress-gce/pkg/apis/retainedloadbalancer/v1beta1"
+)
+
+func TestNewRetainedLoadBalancerSpec(t *testing.T) {
+	for _, tc := range []struct {
+		desc        string
+		annotations map[string]string
+		want        retainedloadbalancerv1beta1.RetainedLoadBalancerSpec
+	}{
+		{
+			desc: "no status",
+			want: retainedloadbalancerv1beta1.RetainedLoadBalancerSpec{LoadBalancer: "lb", NamingScheme: annotations.NamingSchemeV1},
+		},
+		{
+			desc: "external load balancer",
+			annotations: map[string]string{
+				annotations.NamingSchemeKey:              annotations.NamingSchemeV2,
+				"ingress.kubernetes.io/url-map":          "k8s2-um-uid1-ns-ing",
+				"ingress.kubernetes.io/target-proxy":     "k8s2-tp-uid1-ns-ing",
+				"ingress.kubernetes.io/forwarding-rule":  "k8s2-fr-uid1-ns-ing",
+				"ingress.kubernetes.io/static-ip":        "k8s2-fr-uid1-ns-ing",
+				"ingress.kubernetes.io/backends":         `{"k8s1-uid1-ns-svc-80-hash":"HEALTHY","k8s1-uid1-kube-system-default-http-backend-80-hash":"Unknown"}`,
+				"ingress.kubernetes.io/unrelated-status": "value",
+			},
+			want: retainedloadbalancerv1beta1.RetainedLoadBalancerSpec{
+				LoadBalancer: "lb",
+				NamingScheme: annotations.NamingSchemeV2,
+				Resources: map[string]string{
+					"url-map":         "k8s2-um-uid1-ns-ing",
+					"target-proxy":    "k8s2-tp-uid1-ns-ing",
+					"forwarding-rule": "k8s2-fr-uid1-ns-ing",
+					"static-ip":       "k8s2-fr-uid1-ns-ing",
+				},
+				BackendServices: []string{"k8s1-uid1-kube-system-default-http-backend-80-hash", "k8s1-uid1-ns-svc-80-hash"},
+			},
+		},
+		{
+			desc: "internal load balancer with invalid backends status",
+			annotations: map[string]string{
+				annotations.IngressClassKey:      annotations.GceL7ILBIngressClass,
+				"ingress.kubernetes.io/url-map":  "k8s2-um-uid1-ns-ing",
+				"ingress.kubernetes.io/backends": "invalid",
+			},
+			want: retainedloadbalancerv1beta1.RetainedLoadBalancerSpec{
+				LoadBalancer: "lb",
+				NamingScheme: annotations.NamingSchemeV1,
+				Regional:     true,
+				Resources:    map[string]string{"url-map": "k8s2-um-uid1-ns-ing"},
+			},
+		},
+	} {
+		ing := &v1beta1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "ing", Annotations: tc.annotations}}
+		if got := NewRetainedLoadBalancerSpec(ing, "lb", nil); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: NewRetainedLoadBalancerSpec() = %+v, want %+v", tc.desc, got, tc.want)
+		}
+	}
+}
@@ -17,35 +17,43 @@ limitations under the License.
 package loadbalancers
 
 import (
-	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/flags"
+	"k8s.io/ingress-gce/pkg/targetproxy"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/ingress-gce/pkg/utils/namer"
 	"k8s.io/klog"
 )
 
 const (
-	// Every target https proxy accepts upto 10 ssl certificates.
-	TargetProxyCertLimit = 10
+	// Every target https proxy accepts upto 15 ssl certificates.
+	TargetProxyCertLimit = 15
 )
 
+// setQuicOverride sets the QUIC override of a target https proxy. It is a
+// variable so that it can be replaced in tests, as the call is not
+// supported by the fake cloud.
+var setQuicOverride = composite.SetQuicOverrideForTargetHttpsProxy
+
 // checkProxy ensures the correct TargetHttpProxy for a loadbalancer
 func (l *L7) checkProxy() (err error) {
-	key, err := l.CreateKey(l.um.Name)
+	urlMapLink, err := l.proxyURLMapLink()
 	if err != nil {
 		return err
 	}
-	resourceID := cloud.ResourceID{ProjectID: "", Resource: "urlMaps", Key: key}
-	urlMapLink := resourceID.ResourcePath()
 	proxyName := l.namer.TargetProxy(l.Name, namer.HTTPProtocol)
-	key, err = l.CreateKey(proxyName)
+	key, err := l.CreateKey(proxyName)
 	if err != nil {
 		return err
 	}
 	version := l.Versions().TargetHttpProxy
 	proxy, _ := composite.GetTargetHttpProxy(l.cloud, key, version)
 	if proxy == nil {
-		klog.V(3).Infof("Creating new http proxy for urlmap %v", l.um.Name)
+		klog.V(3).Infof("Creating new http proxy for urlmap %v", urlMapLink)
 		description, err := l.description()
 		if err != nil {
 			return err
@@ -95,14 +103,12 @@ func (l *L7) checkHttpsProxy() (err error) {
 		return nil
 	}
 
-	key, err := l.CreateKey(l.um.Name)
+	urlMapLink, err := l.proxyURLMapLink()
 	if err != nil {
 		return err
 	}
-	resourceID := cloud.ResourceID{ProjectID: "", Resource: "urlMaps", Key: key}
-	urlMapLink := resourceID.ResourcePath()
 	proxyName := l.namer.TargetProxy(l.Name, namer.HTTPSProtocol)
-	key, err = l.CreateKey(proxyName)
+	key, err := l.CreateKey(proxyName)
 	if err != nil {
 		return err
 	}
@@ -113,12 +119,13 @@ func (l *L7) checkHttpsProxy() (err error) {
 		return err
 	}
 	if proxy == nil {
-		klog.V(3).Infof("Creating new https proxy for urlmap %q", l.um.Name)
+		klog.V(3).Infof("Creating new https proxy for urlmap %q", urlMapLink)
 		newProxy := &composite.TargetHttpsProxy{
-			Name:        proxyName,
-			UrlMap:      urlMapLink,
-			Description: description,
-			Version:     version,
+			Name:         proxyName,
+			UrlMap:       urlMapLink,
+			Description:  description,
+			Version:      version,
+			QuicOverride: l.quicOverride(),
 		}
 
 		for _, c := range l.sslCerts {
@@ -164,19 +171,152 @@ func (l *L7) checkHttpsProxy() (err error) {
 		for _, cert := range l.sslCerts {
 			sslCertURLs = append(sslCertURLs, cert.SelfLink)
 		}
+		if err := l.rotateSslCertificates(proxy, sslCertURLs); err != nil {
+			return err
+		}
+	}
+
+	if quicOverride := l.quicOverride(); quicOverride != "" && proxy.QuicOverride != quicOverride {
+		klog.V(3).Infof("Https proxy %q has QuicOverride %q, setting %q", proxy.Name, proxy.QuicOverride, quicOverride)
 		key, err := l.CreateKey(proxy.Name)
 		if err != nil {
 			return err
 		}
-		if err := composite.SetSslCertificateForTargetHttpsProxy(l.cloud, key, proxy, sslCertURLs); err != nil {
+		if err := setQuicOverride(l.cloud, key, proxy, quicOverride); err != nil {
 			return err
 		}
-
+		proxy.QuicOverride = quicOverride
 	}
 	l.tps = proxy
 	return nil
 }
 
+// quicOverride returns the QUIC override of the https proxy configured in the
+// FrontendConfig of the Ingress. An empty string means the setting of the
+// proxy is not managed. QUIC is not supported for regional load balancers.
+func (l *L7) quicOverride() string {
+	if l.runtimeInfo.FrontendConfig == nil || l.Regional() {
+		return ""
+	}
+	return l.runtimeInfo.FrontendConfig.Spec.QuicOverride
+}
+
+// ensureKeepAliveTimeout sets the client HTTP keepalive timeout of the target
+// proxies to the one configured in the FrontendConfig of the Ingress.
+func (l *L7) ensureKeepAliveTimeout() error {
+	timeout := l.keepAliveTimeout()
+	if timeout == 0 {
+		return nil
+	}
+	if l.tp != nil {
+		if err := l.setKeepAliveTimeout(targetproxy.HTTP, l.tp.Name, timeout); err != nil {
+			return err
+		}
+	}
+	if l.tps != nil {
+		if err := l.setKeepAliveTimeout(targetproxy.HTTPS, l.tps.Name, timeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *L7) setKeepAliveTimeout(collection, name string, timeout int64) error {
+	proxy, err := l.proxyClient.Get(collection, name)
+	if err != nil {
+		return err
+	}
+	if proxy.HttpKeepAliveTimeoutSec == timeout {
+		return nil
+	}
+	klog.V(3).Infof("Proxy %q has HttpKeepAliveTimeoutSec %d, setting %d", name, proxy.HttpKeepAliveTimeoutSec, timeout)
+	proxy.HttpKeepAliveTimeoutSec = timeout
+	return l.proxyClient.Patch(collection, proxy)
+}
+
+// keepAliveTimeout returns the client HTTP keepalive timeout of the proxies
+// configured in the FrontendConfig of the Ingress. Zero means the setting of
+// the proxies is not managed, which is also the case for regional load
+// balancers and when the keepalive timeout is disabled.
+func (l *L7) keepAliveTimeout() int64 {
+	if l.proxyClient == nil || !flags.F.EnableProxyKeepAlive || l.runtimeInfo.FrontendConfig == nil || l.Regional() {
+		return 0
+	}
+	return l.runtimeInfo.FrontendConfig.Spec.HttpKeepAliveTimeoutSec
+}
+
+// rotateSslCertificates replaces the certs of the https proxy with the given
+// list. New certs are attached alongside the existing ones first, so that
+// clients never see the proxy without a matching cert, and the old certs are
+// only removed once the first update is confirmed.
+func (l *L7) rotateSslCertificates(proxy *composite.TargetHttpsProxy, sslCertURLs []string) error {
+	key, err := l.CreateKey(proxy.Name)
+	if err != nil {
+		return err
+	}
+
+	union := append([]string{}, proxy.SslCertificates...)
+	var added int
+	for _, link := range sslCertURLs {
+		if !containsResourceID(proxy.SslCertificates, link) {
+			union = append(union, link)
+			added++
+		}
+	}
+	removed := len(union) - len(sslCertURLs)
+
+	if added == 0 || removed == 0 || len(union) > TargetProxyCertLimit {
+		if added > 0 && removed > 0 {
+			klog.V(3).Infof("Cannot attach %d new certs alongside %d existing certs of https proxy %q without exceeding the limit of %d, replacing certs directly",
+				added, len(proxy.SslCertificates), proxy.Name, TargetProxyCertLimit)
+		}
+		return l.setSslCertificates(key, proxy, sslCertURLs)
+	}
+
+	klog.V(3).Infof("Rotating certs of https proxy %q: attaching %d new certs before removing %d old certs", proxy.Name, added, removed)
+	if err := l.setSslCertificates(key, proxy, union); err != nil {
+		return err
+	}
+	l.recorder.Eventf(l.runtimeInfo.Ingress, corev1.EventTypeNormal, SslCertificateRotation,
+		"Attached %d new SSL certificates to target proxy %s, removing %d old certificates", added, proxy.Name, removed)
+	if err := l.setSslCertificates(key, proxy, sslCertURLs); err != nil {
+		return err
+	}
+	l.recorder.Eventf(l.runtimeInfo.Ingress, corev1.EventTypeNormal, SslCertificateRotation,
+		"Removed %d old SSL certificates from target proxy %s", removed, proxy.Name)
+	return nil
+}
+
+// setSslCertificates sets the certs of the https proxy and verifies that the
+// proxy references exactly the given certs afterwards.
+func (l *L7) setSslCertificates(key *meta.Key, proxy *composite.TargetHttpsProxy, sslCertURLs []string) error {
+	if err := composite.SetSslCertificateForTargetHttpsProxy(l.cloud, key, proxy, sslCertURLs); err != nil {
+		return err
+	}
+	updated, err := composite.GetTargetHttpsProxy(l.cloud, key, proxy.Version)
+	if err != nil {
+		return err
+	}
+	if len(updated.SslCertificates) != len(sslCertURLs) {
+		return fmt.Errorf("https proxy %q has certs %v after update, expected %v", proxy.Name, updated.SslCertificates, sslCertURLs)
+	}
+	for _, link := range sslCertURLs {
+		if !containsResourceID(updated.SslCertificates, link) {
+			return fmt.Errorf("https proxy %q has certs %v after update, expected %v", proxy.Name, updated.SslCertificates, sslCertURLs)
+		}
+	}
+	return nil
+}
+
+func containsResourceID(links []string, link string) bool {
+	for _, l := range links {
+		if l == link || utils.EqualResourceIDs(l, link) {
+			return true
+		}
+	}
+	return false
+}
+
 func (l *L7) getSslCertLinkInUse() ([]string, error) {
 	proxyName := l.namer.TargetProxy(l.Name, namer.HTTPSProtocol)
 	key, err := l.CreateKey(proxyName)
@@ -20,11 +20,17 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/ingress-gce/pkg/annotations"
 	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/loadbalancers/metrics"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/ingress-gce/pkg/utils/namer"
 	"k8s.io/klog"
@@ -33,6 +39,14 @@ import (
 const (
 	// The gce api uses the name of a path rule to match a host rule.
 	hostRulePrefix = "host"
+
+	// defaultRedirectResponseCode is the response code GCE uses for redirects
+	// if none is specified.
+	defaultRedirectResponseCode = "MOVED_PERMANENTLY_DEFAULT"
+
+	// maxFingerprintRetries is the number of times an update rejected because
+	// the URL map was modified concurrently is retried.
+	maxFingerprintRetries = 3
 )
 
 // ensureComputeURLMap retrieves the current URLMap and overwrites it if incorrect. If the resource
@@ -63,26 +77,107 @@ func (l *L7) ensureComputeURLMap() error {
 		if err := composite.CreateUrlMap(l.cloud, key, expectedMap); err != nil {
 			return fmt.Errorf("CreateUrlMap: %v", err)
 		}
-		l.um = expectedMap
+		l.setURLMap(expectedMap)
 		return nil
 	}
 
 	if mapsEqual(currentMap, expectedMap) {
 		klog.V(4).Infof("URLMap for %q is unchanged", l.Name)
-		l.um = currentMap
+		l.setURLMap(currentMap)
 		return nil
 	}
 
 	klog.V(3).Infof("Updating URLMap for %q", l.Name)
-	expectedMap.Fingerprint = currentMap.Fingerprint
-	if err := composite.UpdateUrlMap(l.cloud, key, expectedMap); err != nil {
-		return fmt.Errorf("UpdateURLMap: %v", err)
+	if err := l.updateURLMap(key, currentMap, expectedMap); err != nil {
+		return err
+	}
+
+	l.setURLMap(expectedMap)
+	return nil
+}
+
+// setURLMap records the synced URL map and publishes its size.
+func (l *L7) setURLMap(um *composite.UrlMap) {
+	l.um = um
+	pathRules := 0
+	for _, pm := range um.PathMatchers {
+		pathRules += len(pm.PathRules) + len(pm.RouteRules)
 	}
+	metrics.ObserveURLMapSize(um.Name, len(um.HostRules), pathRules)
+}
 
-	l.um = expectedMap
+// checkUserURLMap checks that the URL map of the URLMapKey annotation exists
+// in the project and scope of the l7. The controller still syncs the URL map translated
+// from the Ingress, which the l7 is garbage collected from, but never
+// modifies the user's URL map.
+func (l *L7) checkUserURLMap() error {
+	l.userURLMap = nil
+	if l.runtimeInfo.UserURLMap == "" {
+		return nil
+	}
+	name := l.runtimeInfo.UserURLMap
+	if strings.Contains(name, "/") {
+		id, err := cloud.ParseResourceURL(name)
+		if err != nil || id.Key == nil || id.Resource != "urlMaps" {
+			return fmt.Errorf("%s annotation has invalid URL map %q", annotations.URLMapKey, name)
+		}
+		if id.ProjectID != l.cloud.ProjectID() {
+			return fmt.Errorf("%s annotation has URL map %q, which is not in project %q of the cluster", annotations.URLMapKey, name, l.cloud.ProjectID())
+		}
+		if id.Key.Type() != l.scope {
+			return fmt.Errorf("%s annotation has %s URL map %q, want a %s one", annotations.URLMapKey, id.Key.Type(), name, l.scope)
+		}
+		name = id.Key.Name
+	}
+	key, err := l.CreateKey(name)
+	if err != nil {
+		return err
+	}
+	if _, err := composite.GetUrlMap(l.cloud, key, l.Versions().UrlMap); err != nil {
+		return fmt.Errorf("error getting URL map %q of the %s annotation: %v", name, annotations.URLMapKey, err)
+	}
+	l.userURLMap = key
 	return nil
 }
 
+// proxyURLMapLink returns the relative resource path of the URL map of the
+// target proxies of the l7.
+func (l *L7) proxyURLMapLink() (string, error) {
+	key := l.userURLMap
+	if key == nil {
+		var err error
+		if key, err = l.CreateKey(l.um.Name); err != nil {
+			return "", err
+		}
+	}
+	resourceID := cloud.ResourceID{ProjectID: "", Resource: "urlMaps", Key: key}
+	return resourceID.ResourcePath(), nil
+}
+
+// updateURLMap replaces the current URL map with the expected one. Updates
+// rejected because of a stale fingerprint are retried from a fresh read of
+// the URL map.
+func (l *L7) updateURLMap(key *meta.Key, current, expected *composite.UrlMap) error {
+	for conflicts := 0; ; conflicts++ {
+		expected.Fingerprint = current.Fingerprint
+		err := composite.UpdateUrlMap(l.cloud, key, expected)
+		if err == nil {
+			return nil
+		}
+		if !utils.IsHTTPErrorCode(err, http.StatusPreconditionFailed) || conflicts >= maxFingerprintRetries {
+			return fmt.Errorf("UpdateURLMap: %v", err)
+		}
+		metrics.URLMapFingerprintConflicts.WithLabelValues(expected.Name).Inc()
+		klog.V(2).Infof("URLMap %q was modified concurrently, retrying: %v", expected.Name, err)
+		if current, err = composite.GetUrlMap(l.cloud, key, expected.Version); err != nil {
+			return fmt.Errorf("GetUrlMap: %v", err)
+		}
+		if mapsEqual(current, expected) {
+			return nil
+		}
+	}
+}
+
 // getBackendNames returns the names of backends in this L7 urlmap.
 func getBackendNames(computeURLMap *composite.UrlMap) ([]string, error) {
 	beNames := sets.NewString()
@@ -93,8 +188,24 @@ func getBackendNames(computeURLMap *composite.UrlMap) ([]string, error) {
 		}
 		beNames.Insert(name)
 
+		var links []string
 		for _, pathRule := range pathMatcher.PathRules {
-			name, err = utils.KeyName(pathRule.Service)
+			links = append(links, pathRule.Service)
+		}
+		for _, routeRule := range pathMatcher.RouteRules {
+			links = append(links, routeRule.Service)
+			if routeRule.RouteAction != nil {
+				for _, wb := range routeRule.RouteAction.WeightedBackendServices {
+					links = append(links, wb.BackendService)
+				}
+			}
+		}
+		for _, link := range links {
+			if link == "" {
+				// Redirects and weighted rules do not reference a single backend.
+				continue
+			}
+			name, err = utils.KeyName(link)
 			if err != nil {
 				return nil, err
 			}
@@ -123,60 +234,142 @@ func mapsEqual(a, b *composite.UrlMap) bool {
 		return false
 	}
 	for i := range a.HostRules {
-		a := a.HostRules[i]
-		b := b.HostRules[i]
-		if a.Description != b.Description {
+		if !hostRulesEqual(a.HostRules[i], b.HostRules[i]) {
 			return false
 		}
-		if len(a.Hosts) != len(b.Hosts) {
+	}
+	if len(a.PathMatchers) != len(b.PathMatchers) {
+		return false
+	}
+	for i := range a.PathMatchers {
+		if !pathMatchersEqual(a.PathMatchers[i], b.PathMatchers[i]) {
 			return false
 		}
-		for i := range a.Hosts {
-			if a.Hosts[i] != b.Hosts[i] {
-				return false
-			}
-		}
-		if a.PathMatcher != b.PathMatcher {
+	}
+	return true
+}
+
+// hostRulesEqual compares two host rules of compute.UrlMaps.
+func hostRulesEqual(a, b *composite.HostRule) bool {
+	if a.Description != b.Description {
+		return false
+	}
+	if len(a.Hosts) != len(b.Hosts) {
+		return false
+	}
+	for i := range a.Hosts {
+		if a.Hosts[i] != b.Hosts[i] {
 			return false
 		}
 	}
-	if len(a.PathMatchers) != len(b.PathMatchers) {
+	return a.PathMatcher == b.PathMatcher
+}
+
+// pathMatchersEqual compares two path matchers of compute.UrlMaps.
+func pathMatchersEqual(a, b *composite.PathMatcher) bool {
+	if !utils.EqualResourcePaths(a.DefaultService, b.DefaultService) {
 		return false
 	}
-	for i := range a.PathMatchers {
-		a := a.PathMatchers[i]
-		b := b.PathMatchers[i]
-		if !utils.EqualResourcePaths(a.DefaultService, b.DefaultService) {
+	if a.Description != b.Description {
+		return false
+	}
+	if a.Name != b.Name {
+		return false
+	}
+	if len(a.PathRules) != len(b.PathRules) {
+		return false
+	}
+	for i := range a.PathRules {
+		a := a.PathRules[i]
+		b := b.PathRules[i]
+		if len(a.Paths) != len(b.Paths) {
 			return false
 		}
-		if a.Description != b.Description {
+		for i := range a.Paths {
+			if a.Paths[i] != b.Paths[i] {
+				return false
+			}
+		}
+		if !serviceLinksEqual(a.Service, b.Service) {
 			return false
 		}
-		if a.Name != b.Name {
+		if !routeActionsEqual(a.RouteAction, b.RouteAction) {
 			return false
 		}
-		if len(a.PathRules) != len(b.PathRules) {
+		if !reflect.DeepEqual(a.UrlRedirect, b.UrlRedirect) {
 			return false
 		}
-		for i := range a.PathRules {
-			a := a.PathRules[i]
-			b := b.PathRules[i]
-			if len(a.Paths) != len(b.Paths) {
+	}
+	return routeRulesEqual(a.RouteRules, b.RouteRules)
+}
+
+// routeRulesEqual compares the route rules generated by the controller.
+func routeRulesEqual(a, b []*composite.HttpRouteRule) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		a := a[i]
+		b := b[i]
+		if len(a.MatchRules) != len(b.MatchRules) {
+			return false
+		}
+		for i := range a.MatchRules {
+			a := a.MatchRules[i]
+			b := b.MatchRules[i]
+			if a.PrefixMatch != b.PrefixMatch || a.FullPathMatch != b.FullPathMatch {
 				return false
 			}
-			for i := range a.Paths {
-				if a.Paths[i] != b.Paths[i] {
-					return false
-				}
-			}
-			if !utils.EqualResourcePaths(a.Service, b.Service) {
+			if !headerMatchesEqual(a.HeaderMatches, b.HeaderMatches) || !queryParameterMatchesEqual(a.QueryParameterMatches, b.QueryParameterMatches) {
 				return false
 			}
 		}
+		if !serviceLinksEqual(a.Service, b.Service) {
+			return false
+		}
+		if !routeActionsEqual(a.RouteAction, b.RouteAction) {
+			return false
+		}
+		if !reflect.DeepEqual(a.UrlRedirect, b.UrlRedirect) {
+			return false
+		}
+	}
+	return true
+}
+
+func headerMatchesEqual(a, b []*composite.HttpHeaderMatch) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].HeaderName != b[i].HeaderName || a[i].PresentMatch != b[i].PresentMatch || a[i].ExactMatch != b[i].ExactMatch || a[i].RegexMatch != b[i].RegexMatch {
+			return false
+		}
 	}
 	return true
 }
 
+func queryParameterMatchesEqual(a, b []*composite.HttpQueryParameterMatch) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].PresentMatch != b[i].PresentMatch || a[i].ExactMatch != b[i].ExactMatch || a[i].RegexMatch != b[i].RegexMatch {
+			return false
+		}
+	}
+	return true
+}
+
+// serviceLinksEqual compares two backend service links, either of which may
+// be empty for rules which do not reference a single backend service.
+func serviceLinksEqual(a, b string) bool {
+	if a == "" || b == "" {
+		return a == b
+	}
+	return utils.EqualResourcePaths(a, b)
+}
+
 // toCompositeURLMap translates the given hostname: endpoint->port mapping into a gce url map.
 //
 // HostRule: Conceptually contains all PathRules for a given host.
@@ -218,7 +411,7 @@ func mapsEqual(a, b *composite.UrlMap) bool {
 // and remove the mapping. When a new path is added to a host (happens
 // more frequently than service deletion) we just need to lookup the 1
 // pathmatcher of the host.
-func toCompositeURLMap(lbName string, g *utils.GCEURLMap, namer *namer.Namer, key *meta.Key) *composite.UrlMap {
+func toCompositeURLMap(lbName string, g *utils.GCEURLMap, namer namer.IngressNamer, key *meta.Key) *composite.UrlMap {
 	defaultBackendName := g.DefaultBackend.BackendName(namer)
 	key.Name = defaultBackendName
 	resourceID := cloud.ResourceID{ProjectID: "", Resource: "backendServices", Key: key}
@@ -243,22 +436,199 @@ func toCompositeURLMap(lbName string, g *utils.GCEURLMap, namer *namer.Namer, ke
 			PathRules:      []*composite.PathRule{},
 		}
 
+		if needsRouteRules(hostRule.Paths) {
+			// Path rules cannot split traffic between backends or match on
+			// headers and a path matcher cannot mix path rules with route
+			// rules, so all paths of the host are converted to route rules.
+			pathMatcher.RouteRules = toCompositeRouteRules(hostRule.Paths, namer, key)
+			m.PathMatchers = append(m.PathMatchers, pathMatcher)
+			continue
+		}
+
 		// GCE ensures that matched rule with longest prefix wins.
 		for _, rule := range hostRule.Paths {
-			beName := rule.Backend.BackendName(namer)
-			key.Name = beName
-			resourceID := cloud.ResourceID{ProjectID: "", Resource: "backendServices", Key: key}
-			beLink := resourceID.ResourcePath()
-			pathMatcher.PathRules = append(pathMatcher.PathRules, &composite.PathRule{
-				Paths:   []string{rule.Path},
-				Service: beLink,
-			})
+			pathRule := &composite.PathRule{Paths: []string{rule.Path}}
+			if rule.Redirect != nil {
+				pathRule.UrlRedirect = toCompositeRedirect(rule.Redirect)
+			} else {
+				pathRule.Service = backendServiceLink(rule.Backend, namer, key)
+				pathRule.RouteAction = toCompositeRouteAction(rule, namer, key)
+			}
+			pathMatcher.PathRules = append(pathMatcher.PathRules, pathRule)
 		}
 		m.PathMatchers = append(m.PathMatchers, pathMatcher)
 	}
 	return m
 }
 
+// backendServiceLink returns the relative resource path of the backend
+// service of the given ServicePort.
+func backendServiceLink(sp utils.ServicePort, namer namer.IngressNamer, key *meta.Key) string {
+	key.Name = sp.BackendName(namer)
+	resourceID := cloud.ResourceID{ProjectID: "", Resource: "backendServices", Key: key}
+	return resourceID.ResourcePath()
+}
+
+func needsRouteRules(rules []utils.PathRule) bool {
+	for _, rule := range rules {
+		if len(rule.WeightedBackends) > 0 || len(rule.ConditionalRoutes) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// toCompositeRouteRules converts path rules to route rules. Unlike path rules,
+// route rules are evaluated in order, so rules are sorted from the most to the
+// least specific match to preserve the longest match semantics of path rules.
+// The conditional routes of a path precede the rule of the path itself.
+func toCompositeRouteRules(rules []utils.PathRule, namer namer.IngressNamer, key *meta.Key) []*composite.HttpRouteRule {
+	matches := make([]*composite.HttpRouteRuleMatch, len(rules))
+	order := make([]int, len(rules))
+	for i, rule := range rules {
+		matches[i] = toCompositeRouteMatch(rule.Path)
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return routeMatchLess(matches[order[i]], matches[order[j]])
+	})
+
+	var routeRules []*composite.HttpRouteRule
+	for _, i := range order {
+		rule := rules[i]
+		for _, route := range rule.ConditionalRoutes {
+			match := toCompositeRouteMatch(rule.Path)
+			for _, h := range route.Headers {
+				match.HeaderMatches = append(match.HeaderMatches, &composite.HttpHeaderMatch{
+					HeaderName:   h.Name,
+					PresentMatch: h.Present,
+					ExactMatch:   h.Exact,
+					RegexMatch:   h.Regex,
+				})
+			}
+			for _, q := range route.QueryParams {
+				match.QueryParameterMatches = append(match.QueryParameterMatches, &composite.HttpQueryParameterMatch{
+					Name:         q.Name,
+					PresentMatch: q.Present,
+					ExactMatch:   q.Exact,
+					RegexMatch:   q.Regex,
+				})
+			}
+			routeRules = append(routeRules, &composite.HttpRouteRule{
+				MatchRules: []*composite.HttpRouteRuleMatch{match},
+				Service:    backendServiceLink(route.Backend, namer, key),
+			})
+		}
+
+		routeRule := &composite.HttpRouteRule{MatchRules: []*composite.HttpRouteRuleMatch{matches[i]}}
+		if rule.Redirect != nil {
+			routeRule.UrlRedirect = toCompositeRedirect(rule.Redirect)
+		} else {
+			routeRule.RouteAction = toCompositeRouteAction(rule, namer, key)
+			if len(rule.WeightedBackends) == 0 {
+				routeRule.Service = backendServiceLink(rule.Backend, namer, key)
+			}
+		}
+		routeRules = append(routeRules, routeRule)
+	}
+	return routeRules
+}
+
+// toCompositeRouteMatch converts a path of the Ingress spec to a route rule
+// match. Paths ending with /* match by prefix, other paths match exactly.
+func toCompositeRouteMatch(path string) *composite.HttpRouteRuleMatch {
+	if strings.HasSuffix(path, "/*") {
+		return &composite.HttpRouteRuleMatch{PrefixMatch: strings.TrimSuffix(path, "*")}
+	}
+	return &composite.HttpRouteRuleMatch{FullPathMatch: path}
+}
+
+// routeMatchLess orders longer matches first and full path matches before
+// prefix matches of the same length. A request matched by both a full path
+// and a prefix always matches the longer one first.
+func routeMatchLess(a, b *composite.HttpRouteRuleMatch) bool {
+	aPath, bPath := a.PrefixMatch+a.FullPathMatch, b.PrefixMatch+b.FullPathMatch
+	if len(aPath) != len(bPath) {
+		return len(aPath) > len(bPath)
+	}
+	return a.FullPathMatch != "" && b.FullPathMatch == ""
+}
+
+// toCompositeRouteAction returns the route action of a path rule forwarding
+// to backends, or nil if the default forwarding behavior applies.
+func toCompositeRouteAction(rule utils.PathRule, namer namer.IngressNamer, key *meta.Key) *composite.HttpRouteAction {
+	if rule.Rewrite == nil && len(rule.WeightedBackends) == 0 {
+		return nil
+	}
+	routeAction := &composite.HttpRouteAction{}
+	if rule.Rewrite != nil {
+		routeAction.UrlRewrite = &composite.UrlRewrite{
+			HostRewrite:       rule.Rewrite.Host,
+			PathPrefixRewrite: rule.Rewrite.PathPrefix,
+		}
+	}
+	for _, wb := range rule.WeightedBackends {
+		weighted := &composite.WeightedBackendService{
+			BackendService: backendServiceLink(wb.Backend, namer, key),
+			Weight:         wb.Weight,
+		}
+		if wb.Weight == 0 {
+			// A zero weight drains the backend and must be sent explicitly.
+			weighted.ForceSendFields = []string{"Weight"}
+		}
+		routeAction.WeightedBackendServices = append(routeAction.WeightedBackendServices, weighted)
+	}
+	return routeAction
+}
+
+// toCompositeRedirect converts a redirect from the route actions annotation.
+// The default response code is set explicitly since GCE returns it on reads.
+func toCompositeRedirect(r *annotations.URLRedirect) *composite.HttpRedirectAction {
+	responseCode := r.ResponseCode
+	if responseCode == "" {
+		responseCode = defaultRedirectResponseCode
+	}
+	return &composite.HttpRedirectAction{
+		HostRedirect:         r.Host,
+		PathRedirect:         r.Path,
+		PrefixRedirect:       r.PathPrefix,
+		HttpsRedirect:        r.HTTPS,
+		StripQuery:           r.StripQuery,
+		RedirectResponseCode: responseCode,
+	}
+}
+
+// routeActionsEqual compares the URL rewrites and weighted backends of two
+// route actions. Other fields of the route action are not managed by the
+// controller.
+func routeActionsEqual(a, b *composite.HttpRouteAction) bool {
+	var aRewrite, bRewrite *composite.UrlRewrite
+	var aWeighted, bWeighted []*composite.WeightedBackendService
+	if a != nil {
+		aRewrite = a.UrlRewrite
+		aWeighted = a.WeightedBackendServices
+	}
+	if b != nil {
+		bRewrite = b.UrlRewrite
+		bWeighted = b.WeightedBackendServices
+	}
+	if (aRewrite == nil) != (bRewrite == nil) {
+		return false
+	}
+	if aRewrite != nil && (aRewrite.HostRewrite != bRewrite.HostRewrite || aRewrite.PathPrefixRewrite != bRewrite.PathPrefixRewrite) {
+		return false
+	}
+	if len(aWeighted) != len(bWeighted) {
+		return false
+	}
+	for i := range aWeighted {
+		if !utils.EqualResourcePaths(aWeighted[i].BackendService, bWeighted[i].BackendService) || aWeighted[i].Weight != bWeighted[i].Weight {
+			return false
+		}
+	}
+	return true
+}
+
 // getNameForPathMatcher returns a name for a pathMatcher based on the given host rule.
 // The host rule can be a regex, the path matcher name used to associate the 2 cannot.
 func getNameForPathMatcher(hostRule string) string {
@@ -21,6 +21,7 @@ import (
 
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/ingress-gce/pkg/annotations"
 	"k8s.io/ingress-gce/pkg/composite"
 	"k8s.io/ingress-gce/pkg/utils"
 	namer_util "k8s.io/ingress-gce/pkg/utils/namer"
@@ -87,6 +88,230 @@ func TestToComputeURLMap(t *testing.T) {
 	}
 }
 
+func TestToComputeURLMapRouteActions(t *testing.T) {
+	t.Parallel()
+
+	gceURLMap := &utils.GCEURLMap{
+		DefaultBackend: &utils.ServicePort{NodePort: 30000},
+		HostRules: []utils.HostRule{
+			{
+				Hostname: "abc.com",
+				Paths: []utils.PathRule{
+					{
+						Path:    "/api/*",
+						Backend: utils.ServicePort{NodePort: 32000},
+						Rewrite: &annotations.URLRewrite{PathPrefix: "/"},
+					},
+					{
+						Path:     "/old/*",
+						Backend:  utils.ServicePort{NodePort: 32500},
+						Redirect: &annotations.URLRedirect{PathPrefix: "/new/", HTTPS: true},
+					},
+				},
+			},
+		},
+	}
+	wantPathRules := []*composite.PathRule{
+		{
+			Paths:   []string{"/api/*"},
+			Service: "global/backendServices/k8s-be-32000--uid1",
+			RouteAction: &composite.HttpRouteAction{
+				UrlRewrite: &composite.UrlRewrite{PathPrefixRewrite: "/"},
+			},
+		},
+		{
+			Paths: []string{"/old/*"},
+			UrlRedirect: &composite.HttpRedirectAction{
+				PrefixRedirect:       "/new/",
+				HttpsRedirect:        true,
+				RedirectResponseCode: defaultRedirectResponseCode,
+			},
+		},
+	}
+
+	namer := namer_util.NewNamer("uid1", "fw1")
+	gotComputeURLMap := toCompositeURLMap("lb-name", gceURLMap, namer, meta.GlobalKey("lb-name"))
+	wantComputeURLMap := toCompositeURLMap("lb-name", gceURLMap, namer, meta.GlobalKey("lb-name"))
+	wantComputeURLMap.PathMatchers[0].PathRules = wantPathRules
+	if !mapsEqual(gotComputeURLMap, wantComputeURLMap) {
+		t.Errorf("toComputeURLMap() = \n%+v\n   want\n%+v", gotComputeURLMap.PathMatchers[0].PathRules, wantPathRules)
+	}
+
+	// The redirect does not reference a backend.
+	gotNames, err := getBackendNames(gotComputeURLMap)
+	if err != nil {
+		t.Fatalf("getBackendNames() = %v", err)
+	}
+	if want := sets.NewString("k8s-be-30000--uid1", "k8s-be-32000--uid1"); !want.Equal(sets.NewString(gotNames...)) {
+		t.Errorf("getBackendNames() = %v, want %v", gotNames, want.List())
+	}
+
+	// Changing the rewrite is detected.
+	changed := toCompositeURLMap("lb-name", gceURLMap, namer, meta.GlobalKey("lb-name"))
+	changed.PathMatchers[0].PathRules[0].RouteAction.UrlRewrite.PathPrefixRewrite = "/v2/"
+	if mapsEqual(gotComputeURLMap, changed) {
+		t.Errorf("mapsEqual() = true for maps with different rewrites, want false")
+	}
+}
+
+func TestToComputeURLMapWeightedBackends(t *testing.T) {
+	t.Parallel()
+
+	gceURLMap := &utils.GCEURLMap{
+		DefaultBackend: &utils.ServicePort{NodePort: 30000},
+		HostRules: []utils.HostRule{
+			{
+				Hostname: "abc.com",
+				Paths: []utils.PathRule{
+					{
+						Path:    "/*",
+						Backend: utils.ServicePort{NodePort: 32000},
+						WeightedBackends: []utils.WeightedServicePort{
+							{Backend: utils.ServicePort{NodePort: 32000}, Weight: 90},
+							{Backend: utils.ServicePort{NodePort: 32500}, Weight: 10},
+						},
+					},
+					{
+						Path:    "/api/*",
+						Backend: utils.ServicePort{NodePort: 33000},
+					},
+					{
+						Path:    "/api/health",
+						Backend: utils.ServicePort{NodePort: 34000},
+					},
+					{
+						Path:     "/old/*",
+						Backend:  utils.ServicePort{NodePort: 33000},
+						Redirect: &annotations.URLRedirect{PathPrefix: "/new/"},
+					},
+				},
+			},
+		},
+	}
+	wantRouteRules := []*composite.HttpRouteRule{
+		{
+			MatchRules: []*composite.HttpRouteRuleMatch{{FullPathMatch: "/api/health"}},
+			Service:    "global/backendServices/k8s-be-34000--uid1",
+		},
+		{
+			MatchRules: []*composite.HttpRouteRuleMatch{{PrefixMatch: "/api/"}},
+			Service:    "global/backendServices/k8s-be-33000--uid1",
+		},
+		{
+			MatchRules: []*composite.HttpRouteRuleMatch{{PrefixMatch: "/old/"}},
+			UrlRedirect: &composite.HttpRedirectAction{
+				PrefixRedirect:       "/new/",
+				RedirectResponseCode: defaultRedirectResponseCode,
+			},
+		},
+		{
+			MatchRules: []*composite.HttpRouteRuleMatch{{PrefixMatch: "/"}},
+			RouteAction: &composite.HttpRouteAction{
+				WeightedBackendServices: []*composite.WeightedBackendService{
+					{BackendService: "global/backendServices/k8s-be-32000--uid1", Weight: 90},
+					{BackendService: "global/backendServices/k8s-be-32500--uid1", Weight: 10},
+				},
+			},
+		},
+	}
+
+	namer := namer_util.NewNamer("uid1", "fw1")
+	gotComputeURLMap := toCompositeURLMap("lb-name", gceURLMap, namer, meta.GlobalKey("lb-name"))
+	pathMatcher := gotComputeURLMap.PathMatchers[0]
+	if len(pathMatcher.PathRules) != 0 {
+		t.Errorf("Got path rules %+v, want none", pathMatcher.PathRules)
+	}
+	if !routeRulesEqual(pathMatcher.RouteRules, wantRouteRules) {
+		t.Errorf("Got route rules %+v, want %+v", pathMatcher.RouteRules, wantRouteRules)
+	}
+
+	gotNames, err := getBackendNames(gotComputeURLMap)
+	if err != nil {
+		t.Fatalf("getBackendNames() = %v", err)
+	}
+	want := sets.NewString("k8s-be-30000--uid1", "k8s-be-32000--uid1", "k8s-be-32500--uid1", "k8s-be-33000--uid1", "k8s-be-34000--uid1")
+	if !want.Equal(sets.NewString(gotNames...)) {
+		t.Errorf("getBackendNames() = %v, want %v", gotNames, want.List())
+	}
+
+	// Changing a weight is detected.
+	changed := toCompositeURLMap("lb-name", gceURLMap, namer, meta.GlobalKey("lb-name"))
+	changed.PathMatchers[0].RouteRules[3].RouteAction.WeightedBackendServices[1].Weight = 50
+	if mapsEqual(gotComputeURLMap, changed) {
+		t.Errorf("mapsEqual() = true for maps with different weights, want false")
+	}
+}
+
+func TestToComputeURLMapConditionalRoutes(t *testing.T) {
+	t.Parallel()
+
+	gceURLMap := &utils.GCEURLMap{
+		DefaultBackend: &utils.ServicePort{NodePort: 30000},
+		HostRules: []utils.HostRule{
+			{
+				Hostname: "abc.com",
+				Paths: []utils.PathRule{
+					{
+						Path:    "/*",
+						Backend: utils.ServicePort{NodePort: 32000},
+						ConditionalRoutes: []utils.ConditionalRoute{
+							{
+								Headers: []annotations.HeaderMatch{{Name: "Cookie", Regex: ".*beta=true.*"}},
+								Backend: utils.ServicePort{NodePort: 32500},
+							},
+							{
+								QueryParams: []annotations.QueryParamMatch{{Name: "canary", Exact: "1"}},
+								Backend:     utils.ServicePort{NodePort: 33000},
+							},
+						},
+					},
+					{
+						Path:    "/api/*",
+						Backend: utils.ServicePort{NodePort: 34000},
+					},
+				},
+			},
+		},
+	}
+	wantRouteRules := []*composite.HttpRouteRule{
+		{
+			MatchRules: []*composite.HttpRouteRuleMatch{{PrefixMatch: "/api/"}},
+			Service:    "global/backendServices/k8s-be-34000--uid1",
+		},
+		{
+			MatchRules: []*composite.HttpRouteRuleMatch{{
+				PrefixMatch:   "/",
+				HeaderMatches: []*composite.HttpHeaderMatch{{HeaderName: "Cookie", RegexMatch: ".*beta=true.*"}},
+			}},
+			Service: "global/backendServices/k8s-be-32500--uid1",
+		},
+		{
+			MatchRules: []*composite.HttpRouteRuleMatch{{
+				PrefixMatch:           "/",
+				QueryParameterMatches: []*composite.HttpQueryParameterMatch{{Name: "canary", ExactMatch: "1"}},
+			}},
+			Service: "global/backendServices/k8s-be-33000--uid1",
+		},
+		{
+			MatchRules: []*composite.HttpRouteRuleMatch{{PrefixMatch: "/"}},
+			Service:    "global/backendServices/k8s-be-32000--uid1",
+		},
+	}
+
+	namer := namer_util.NewNamer("uid1", "fw1")
+	gotComputeURLMap := toCompositeURLMap("lb-name", gceURLMap, namer, meta.GlobalKey("lb-name"))
+	if got := gotComputeURLMap.PathMatchers[0].RouteRules; !routeRulesEqual(got, wantRouteRules) {
+		t.Errorf("Got route rules %+v, want %+v", got, wantRouteRules)
+	}
+
+	// Changing a header match is detected.
+	changed := toCompositeURLMap("lb-name", gceURLMap, namer, meta.GlobalKey("lb-name"))
+	changed.PathMatchers[0].RouteRules[1].MatchRules[0].HeaderMatches[0].RegexMatch = ".*alpha=true.*"
+	if mapsEqual(gotComputeURLMap, changed) {
+		t.Errorf("mapsEqual() = true for maps with different header matches, want false")
+	}
+}
+
 func testCompositeURLMap() *composite.UrlMap {
 	return &composite.UrlMap{
 		Name:           "k8s-um-lb-name",
@@ -0,0 +1,47 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const invalidAnnotationsKey = "invalid_annotations_total"
+
+var (
+	// InvalidAnnotations counts the syncs of objects which found an invalid
+	// annotation, by key of the annotation.
+	InvalidAnnotations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: GLBC_NAMESPACE,
+			Name:      invalidAnnotationsKey,
+			Help:      "Number of syncs which found an invalid annotation",
+		},
+		[]string{"annotation"},
+	)
+
+	registerAnnotationMetrics sync.Once
+)
+
+// RegisterAnnotationMetrics registers the metrics of the annotations.
+func RegisterAnnotationMetrics() {
+	registerAnnotationMetrics.Do(func() {
+		prometheus.MustRegister(InvalidAnnotations)
+	})
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	gceAPISubsystem = "gce_api"
+
+	gceAPIRequestsKey        = "requests_total"
+	gceAPIRequestDurationKey = "request_duration_seconds"
+	gceAPIRateLimitedKey     = "rate_limited_total"
+
+	// transportErrorCode is the code of the calls which got no response.
+	transportErrorCode = "error"
+)
+
+var (
+	gceAPILabels = []string{
+		"version",  // API version, e.g. v1 or beta.
+		"resource", // Resource type, e.g. backendServices.
+		"method",   // API method, e.g. Get or AttachNetworkEndpoints.
+	}
+
+	// GCEAPIRequests counts the calls to the GCE API by HTTP status code.
+	GCEAPIRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: GLBC_NAMESPACE,
+			Subsystem: gceAPISubsystem,
+			Name:      gceAPIRequestsKey,
+			Help:      "Number of calls to the GCE API by HTTP status code",
+		},
+		append(gceAPILabels, "code"),
+	)
+
+	// GCEAPIRequestDuration is the latency of the calls to the GCE API.
+	GCEAPIRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: GLBC_NAMESPACE,
+			Subsystem: gceAPISubsystem,
+			Name:      gceAPIRequestDurationKey,
+			Help:      "Latency of a call to the GCE API",
+		},
+		gceAPILabels,
+	)
+
+	// GCEAPIRateLimited counts the calls to the GCE API rejected because of
+	// rate limits or quotas, by reason of the error.
+	GCEAPIRateLimited = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: GLBC_NAMESPACE,
+			Subsystem: gceAPISubsystem,
+			Name:      gceAPIRateLimitedKey,
+			Help:      "Number of calls to the GCE API rejected by rate limits or quotas",
+		},
+		append(gceAPILabels, "reason"),
+	)
+)
+
+// rateLimitReasons are the reasons of the errors of the GCE API for calls
+// exceeding rate limits or quotas.
+var rateLimitReasons = map[string]bool{
+	"rateLimitExceeded":     true,
+	"userRateLimitExceeded": true,
+	"quotaExceeded":         true,
+}
+
+var instrumentDefaultTransport sync.Once
+
+// InstrumentDefaultTransport records the metrics of the calls to the GCE API
+// made with http.DefaultTransport, which the GCE clients use under their
+// oauth2 transport, and registers the metrics.
+func InstrumentDefaultTransport() {
+	instrumentDefaultTransport.Do(func() {
+		prometheus.MustRegister(GCEAPIRequests)
+		prometheus.MustRegister(GCEAPIRequestDuration)
+		prometheus.MustRegister(GCEAPIRateLimited)
+		http.DefaultTransport = NewGCEAPITransport(http.DefaultTransport)
+	})
+}
+
+// NewGCEAPITransport returns a http.RoundTripper recording the metrics of the
+// calls to the GCE API made through base. Other requests are not recorded.
+func NewGCEAPITransport(base http.RoundTripper) http.RoundTripper {
+	return &gceAPITransport{base: base}
+}
+
+type gceAPITransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *gceAPITransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	labels, ok := gceAPICallLabels(req)
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	GCEAPIRequestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	if err != nil {
+		GCEAPIRequests.WithLabelValues(append(labels, transportErrorCode)...).Inc()
+		return resp, err
+	}
+	GCEAPIRequests.WithLabelValues(append(labels, strconv.Itoa(resp.StatusCode))...).Inc()
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusForbidden {
+		if reason, ok := rateLimitReason(resp); ok {
+			GCEAPIRateLimited.WithLabelValues(append(labels, reason)...).Inc()
+		}
+	}
+	return resp, nil
+}
+
+// gceAPICallLabels returns the version, resource type and method of a call to
+// the compute API, e.g. v1, backendServices and Get for a GET of
+// /compute/v1/projects/p/global/backendServices/bs, or false for other
+// requests.
+func gceAPICallLabels(req *http.Request) ([]string, bool) {
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	// compute/{version}/projects/{project}/...
+	if len(parts) < 4 || parts[0] != "compute" || parts[2] != "projects" {
+		return nil, false
+	}
+	version, parts := parts[1], parts[4:]
+	switch {
+	case len(parts) == 0:
+		return []string{version, "projects", collectionMethod(req.Method, true)}, true
+	case parts[0] == "global":
+		parts = parts[1:]
+	case parts[0] == "regions" || parts[0] == "zones":
+		if len(parts) <= 2 {
+			return []string{version, parts[0], collectionMethod(req.Method, len(parts) == 2)}, true
+		}
+		parts = parts[2:]
+	case parts[0] == "aggregated":
+		if len(parts) < 2 {
+			return nil, false
+		}
+		return []string{version, parts[1], "AggregatedList"}, true
+	default:
+		// Methods of the project, e.g. setCommonInstanceMetadata.
+		return []string{version, "projects", upperFirst(parts[0])}, true
+	}
+	if len(parts) == 0 {
+		return nil, false
+	}
+	if len(parts) > 2 {
+		// Custom methods of a resource, e.g.
+		// networkEndpointGroups/neg/attachNetworkEndpoints.
+		return []string{version, parts[0], upperFirst(parts[len(parts)-1])}, true
+	}
+	return []string{version, parts[0], collectionMethod(req.Method, len(parts) == 2)}, true
+}
+
+// collectionMethod returns the standard method of a HTTP method on a
+// collection, or on a resource of the collection if named.
+func collectionMethod(httpMethod string, named bool) string {
+	switch httpMethod {
+	case http.MethodGet:
+		if named {
+			return "Get"
+		}
+		return "List"
+	case http.MethodPost:
+		return "Insert"
+	case http.MethodDelete:
+		return "Delete"
+	case http.MethodPatch:
+		return "Patch"
+	case http.MethodPut:
+		return "Update"
+	}
+	return httpMethod
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// rateLimitReason returns the reason of the error of resp if it is a rate
+// limit or quota error. The body of resp is restored for the caller.
+func rateLimitReason(resp *http.Response) (string, bool) {
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return "", false
+	}
+	var apiErr struct {
+		Error struct {
+			Errors []struct {
+				Reason string `json:"reason"`
+			} `json:"errors"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &apiErr); err == nil {
+		for _, item := range apiErr.Error.Errors {
+			if rateLimitReasons[item.Reason] {
+				return item.Reason, true
+			}
+		}
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return "tooManyRequests", true
+	}
+	return "", false
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestGCEAPICallLabels(t *testing.T) {
+	for _, tc := range []struct {
+		method string
+		path   string
+		want   []string
+	}{
+		{http.MethodGet, "/compute/v1/projects/p/global/backendServices/bs", []string{"v1", "backendServices", "Get"}},
+		{http.MethodGet, "/compute/beta/projects/p/global/backendServices", []string{"beta", "backendServices", "List"}},
+		{http.MethodPost, "/compute/v1/projects/p/global/urlMaps", []string{"v1", "urlMaps", "Insert"}},
+		{http.MethodDelete, "/compute/v1/projects/p/regions/r/forwardingRules/fr", []string{"v1", "forwardingRules", "Delete"}},
+		{http.MethodPost, "/compute/v1/projects/p/zones/z/networkEndpointGroups/neg/attachNetworkEndpoints", []string{"v1", "networkEndpointGroups", "AttachNetworkEndpoints"}},
+		{http.MethodGet, "/compute/v1/projects/p/zones/z", []string{"v1", "zones", "Get"}},
+		{http.MethodGet, "/compute/v1/projects/p/aggregated/networkEndpointGroups", []string{"v1", "networkEndpointGroups", "AggregatedList"}},
+		{http.MethodGet, "/compute/v1/projects/p", []string{"v1", "projects", "Get"}},
+		{http.MethodPost, "/compute/v1/projects/p/setCommonInstanceMetadata", []string{"v1", "projects", "SetCommonInstanceMetadata"}},
+		{http.MethodGet, "/computeMetadata/v1/instance/zone", nil},
+		{http.MethodGet, "/v3/projects/p/alertPolicies", nil},
+	} {
+		req := httptest.NewRequest(tc.method, "https://compute.googleapis.com"+tc.path, nil)
+		got, ok := gceAPICallLabels(req)
+		if ok != (tc.want != nil) || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("gceAPICallLabels(%s %s) = %v, %v, want %v", tc.method, tc.path, got, ok, tc.want)
+		}
+	}
+}
+
+func TestGCEAPITransport(t *testing.T) {
+	const quotaError = `{"error":{"code":403,"errors":[{"reason":"quotaExceeded","message":"Quota exceeded"}]}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(quotaError))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewGCEAPITransport(http.DefaultTransport)}
+	resp, err := client.Post(server.URL+"/compute/v1/projects/p/global/urlMaps", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Post() = %v, want nil", err)
+	}
+	defer resp.Body.Close()
+	// The body is still readable by the GCE client.
+	if body, err := ioutil.ReadAll(resp.Body); err != nil || string(body) != quotaError {
+		t.Errorf("ReadAll() = %q, %v, want %q, nil", body, err, quotaError)
+	}
+
+	for _, tc := range []struct {
+		desc   string
+		metric interface {
+			Write(*dto.Metric) error
+		}
+	}{
+		{"requests", GCEAPIRequests.WithLabelValues("v1", "urlMaps", "Insert", "403")},
+		{"rate limited", GCEAPIRateLimited.WithLabelValues("v1", "urlMaps", "Insert", "quotaExceeded")},
+	} {
+		var m dto.Metric
+		if err := tc.metric.Write(&m); err != nil {
+			t.Fatalf("Write() = %v, want nil", err)
+		}
+		if got := m.GetCounter().GetValue(); got != 1 {
+			t.Errorf("%s = %v, want 1", tc.desc, got)
+		}
+	}
+}
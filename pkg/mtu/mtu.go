@@ -0,0 +1,149 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mtu
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	api_v1 "k8s.io/api/core/v1"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/klog"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+const (
+	// DefaultMTU is the MTU of VPC networks which do not set one. It is also
+	// the largest MTU the load balancer data path, including health checks,
+	// is guaranteed to support.
+	DefaultMTU = 1460
+	// tcpIPHeaderSize is the size of the IPv4 and TCP headers without options,
+	// i.e. the difference between the MTU and the TCP MSS.
+	tcpIPHeaderSize = 40
+	// networkMTUTTL is how long the MTU of the network is cached.
+	networkMTUTTL = 10 * time.Minute
+)
+
+// Checker checks the MTU of the nodes, e.g. with Tier_1 networking or gVNIC
+// and jumbo frames, against the MTU of the load balancer data path.
+type Checker struct {
+	// nodeMTULabel is the key of the node label holding the MTU of the node
+	// network interface. Nodes without it use the MTU of the network.
+	nodeMTULabel string
+	// getNetworkMTU returns the MTU of the cluster network.
+	getNetworkMTU func() (int64, error)
+
+	lock       sync.Mutex
+	networkMTU int64
+	fetched    time.Time
+}
+
+// NewChecker returns a Checker of the nodes of the cluster network of cloud.
+func NewChecker(cloud *gce.Cloud, nodeMTULabel string) *Checker {
+	return &Checker{
+		nodeMTULabel: nodeMTULabel,
+		getNetworkMTU: func() (int64, error) {
+			name, err := utils.KeyName(cloud.NetworkURL())
+			if err != nil {
+				return 0, err
+			}
+			network, err := cloud.Compute().AlphaNetworks().Get(context.Background(), meta.GlobalKey(name))
+			if err != nil {
+				return 0, err
+			}
+			return network.Mtu, nil
+		},
+	}
+}
+
+// NetworkMTU returns the MTU of the cluster network.
+func (c *Checker) NetworkMTU() (int64, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.fetched.IsZero() && time.Since(c.fetched) < networkMTUTTL {
+		return c.networkMTU, nil
+	}
+	mtu, err := c.getNetworkMTU()
+	if err != nil {
+		return 0, err
+	}
+	if mtu == 0 {
+		mtu = DefaultMTU
+	}
+	c.networkMTU, c.fetched = mtu, time.Now()
+	return mtu, nil
+}
+
+// Check returns the problems of the data path from the load balancers to the
+// given nodes which may black hole packets.
+func (c *Checker) Check(nodes []*api_v1.Node) ([]string, error) {
+	networkMTU, err := c.NetworkMTU()
+	if err != nil {
+		return nil, err
+	}
+	return checkNodes(networkMTU, nodes, c.nodeMTULabel), nil
+}
+
+func checkNodes(networkMTU int64, nodes []*api_v1.Node, nodeMTULabel string) []string {
+	var largerThanNetwork, largerThanLB []string
+	maxMTU := networkMTU
+	for _, node := range nodes {
+		mtu := networkMTU
+		if value, ok := node.Labels[nodeMTULabel]; ok && nodeMTULabel != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				klog.V(3).Infof("Ignoring invalid MTU %q of node %s: %v", value, node.Name, err)
+			} else {
+				mtu = parsed
+			}
+		}
+		if mtu > networkMTU {
+			largerThanNetwork = append(largerThanNetwork, node.Name)
+		}
+		if mtu > DefaultMTU {
+			largerThanLB = append(largerThanLB, node.Name)
+		}
+		if mtu > maxMTU {
+			maxMTU = mtu
+		}
+	}
+
+	var problems []string
+	if len(largerThanNetwork) > 0 {
+		problems = append(problems, fmt.Sprintf("Nodes %s use a larger MTU than the %d bytes of the network, packets larger than the network MTU are dropped.", nodeList(largerThanNetwork), networkMTU))
+	}
+	if len(largerThanLB) > 0 {
+		problems = append(problems, fmt.Sprintf("Nodes %s use an MTU of up to %d bytes, larger than the %d bytes supported by the load balancer data path. Allow ICMP fragmentation needed messages from the load balancer and health check source ranges, or clamp the TCP MSS of the backends to %d bytes.", nodeList(largerThanLB), maxMTU, DefaultMTU, DefaultMTU-tcpIPHeaderSize))
+	}
+	return problems
+}
+
+// nodeList returns a short description of the node names.
+func nodeList(names []string) string {
+	const maxNames = 3
+	sort.Strings(names)
+	if len(names) <= maxNames {
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(names[:maxNames], ", "), len(names)-maxNames)
+}
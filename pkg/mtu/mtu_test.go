@@ -0,0 +1,104 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mtu
+
+import (
+	"reflect"
+	"testing"
+
+	api_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testMTULabel = "example.com/mtu"
+
+func newNode(name, mtu string) *api_v1.Node {
+	node := &api_v1.Node{ObjectMeta: meta_v1.ObjectMeta{Name: name, Labels: map[string]string{}}}
+	if mtu != "" {
+		node.Labels[testMTULabel] = mtu
+	}
+	return node
+}
+
+func TestCheckNodes(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		networkMTU int64
+		nodes      []*api_v1.Node
+		label      string
+		want       []string
+	}{
+		{
+			desc:       "default MTU",
+			networkMTU: DefaultMTU,
+			nodes:      []*api_v1.Node{newNode("n1", ""), newNode("n2", "1460")},
+			label:      testMTULabel,
+		},
+		{
+			desc:       "jumbo frames network",
+			networkMTU: 8896,
+			nodes:      []*api_v1.Node{newNode("n1", "")},
+			label:      testMTULabel,
+			want: []string{
+				"Nodes n1 use an MTU of up to 8896 bytes, larger than the 1460 bytes supported by the load balancer data path. Allow ICMP fragmentation needed messages from the load balancer and health check source ranges, or clamp the TCP MSS of the backends to 1420 bytes.",
+			},
+		},
+		{
+			desc:       "nodes larger than the network",
+			networkMTU: DefaultMTU,
+			nodes:      []*api_v1.Node{newNode("n5", "8896"), newNode("n4", "8896"), newNode("n3", "8896"), newNode("n2", "1500"), newNode("n1", "")},
+			label:      testMTULabel,
+			want: []string{
+				"Nodes n2, n3, n4 and 1 more use a larger MTU than the 1460 bytes of the network, packets larger than the network MTU are dropped.",
+				"Nodes n2, n3, n4 and 1 more use an MTU of up to 8896 bytes, larger than the 1460 bytes supported by the load balancer data path. Allow ICMP fragmentation needed messages from the load balancer and health check source ranges, or clamp the TCP MSS of the backends to 1420 bytes.",
+			},
+		},
+		{
+			desc:       "invalid and ignored labels",
+			networkMTU: DefaultMTU,
+			nodes:      []*api_v1.Node{newNode("n1", "jumbo"), newNode("n2", "8896")},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := checkNodes(tc.networkMTU, tc.nodes, tc.label); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("checkNodes() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNetworkMTUCached(t *testing.T) {
+	calls := 0
+	c := &Checker{getNetworkMTU: func() (int64, error) {
+		calls++
+		return 0, nil
+	}}
+	for i := 0; i < 2; i++ {
+		mtu, err := c.NetworkMTU()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mtu != DefaultMTU {
+			t.Errorf("NetworkMTU() = %d, want %d", mtu, DefaultMTU)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("got %d network lookups, want 1", calls)
+	}
+}
@@ -18,7 +18,10 @@ package neg
 
 import (
 	"fmt"
+	"reflect"
+	"sort"
 	"strconv"
+	"sync"
 	"time"
 
 	istioV1alpha3 "istio.io/api/networking/v1alpha3"
@@ -26,6 +29,7 @@ import (
 	"k8s.io/api/networking/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	apimachinerytypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -40,9 +44,12 @@ import (
 	"k8s.io/ingress-gce/pkg/annotations"
 	"k8s.io/ingress-gce/pkg/context"
 	"k8s.io/ingress-gce/pkg/flags"
+	gcemetrics "k8s.io/ingress-gce/pkg/metrics"
 	"k8s.io/ingress-gce/pkg/neg/metrics"
 	"k8s.io/ingress-gce/pkg/neg/readiness"
+	negsyncer "k8s.io/ingress-gce/pkg/neg/syncers"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/ingress-gce/pkg/quota"
 	"k8s.io/ingress-gce/pkg/utils"
 	namer_util "k8s.io/ingress-gce/pkg/utils/namer"
 	"k8s.io/klog"
@@ -51,6 +58,7 @@ import (
 func init() {
 	// register prometheus metrics
 	metrics.RegisterMetrics()
+	gcemetrics.RegisterAnnotationMetrics()
 }
 
 // Controller is network endpoint group controller.
@@ -62,14 +70,28 @@ type Controller struct {
 	recorder     record.EventRecorder
 	namer        negtypes.NetworkEndpointGroupNamer
 	zoneGetter   negtypes.ZoneGetter
+	// subnetworkURL is the subnetwork of the NEGs.
+	subnetworkURL string
+	// cloud lists the existing NEGs when checking quotas.
+	cloud negtypes.NetworkEndpointGroupCloud
+	// quota checks the NEGs to create against the quota of the project, nil
+	// if disabled.
+	quota *quota.Checker
+
+	// zones are the zones of the nodes last observed by syncZones.
+	zonesLock sync.Mutex
+	zones     []string
 
 	hasSynced                   func() bool
-	ingressLister               cache.Indexer
+	ingressLister               cache.Store
+	ingressClasses              utils.IngressClassLookup
 	serviceLister               cache.Indexer
 	client                      kubernetes.Interface
 	defaultBackendService       utils.ServicePort
 	destinationRuleLister       cache.Indexer
 	destinationRuleClient       dynamic.NamespaceableResourceInterface
+	serviceEntryLister          cache.Indexer
+	serviceEntryClient          dynamic.NamespaceableResourceInterface
 	enableCSM                   bool
 	csmServiceNEGSkipNamespaces []string
 
@@ -77,10 +99,17 @@ type Controller struct {
 	serviceQueue workqueue.RateLimitingInterface
 	// endpointQueue takes endpoint key as work item. Endpoint key with format "namespace/name".
 	endpointQueue workqueue.RateLimitingInterface
+	// endpointHashes are the hashes of the addresses of the Endpoints last
+	// enqueued, by key, to skip the updates which don't change them.
+	endpointHashLock sync.Mutex
+	endpointHashes   map[string]string
 
 	// destinationRuleQueue takes Istio DestinationRule key as work item. DestinationRule key with format "namespace/name"
 	destinationRuleQueue workqueue.RateLimitingInterface
 
+	// serviceEntryQueue takes Istio ServiceEntry key as work item. ServiceEntry key with format "namespace/name"
+	serviceEntryQueue workqueue.RateLimitingInterface
+
 	// syncTracker tracks the latest time that service and endpoint changes are processed
 	syncTracker utils.TimeTracker
 
@@ -111,7 +140,13 @@ func NewController(
 	recorder := eventBroadcaster.NewRecorder(scheme.Scheme,
 		apiv1.EventSource{Component: "neg-controller"})
 
-	manager := newSyncerManager(namer, recorder, cloud, zoneGetter, ctx.PodInformer.GetIndexer(), ctx.ServiceInformer.GetIndexer(), ctx.EndpointInformer.GetIndexer(), negSyncerType)
+	if flags.F.NegCoalesceWindow > 0 {
+		cloud = negsyncer.NewCoalescingCloud(cloud, flags.F.NegCoalesceWindow)
+	}
+	if flags.F.GCECacheTTL > 0 {
+		cloud = negsyncer.NewCachingCloud(cloud, flags.F.GCECacheTTL)
+	}
+	manager := newSyncerManager(namer, recorder, cloud, zoneGetter, ctx.PodInformer.GetIndexer(), ctx.ServiceInformer.GetIndexer(), ctx.EndpointInformer.GetIndexer(), ctx.NodeInformer.GetIndexer(), negSyncerType)
 	var reflector readiness.Reflector
 	if enableReadinessReflector {
 		reflector = readiness.NewReadinessReflector(ctx, manager)
@@ -119,6 +154,10 @@ func NewController(
 		reflector = &readiness.NoopReflector{}
 	}
 	manager.reflector = reflector
+	manager.snapshot = newSnapshot(ctx)
+	if ctx.Cloud != nil {
+		manager.backendServices = negtypes.NewBackendServiceAdapter(ctx.Cloud)
+	}
 
 	negController := &Controller{
 		client:                      ctx.KubeClient,
@@ -127,23 +166,29 @@ func NewController(
 		gcPeriod:                    gcPeriod,
 		recorder:                    recorder,
 		zoneGetter:                  zoneGetter,
+		subnetworkURL:               cloud.SubnetworkURL(),
+		cloud:                       cloud,
+		quota:                       ctx.Quota,
 		namer:                       namer,
 		defaultBackendService:       ctx.DefaultBackendSvcPort,
 		hasSynced:                   ctx.HasSynced,
-		ingressLister:               ctx.IngressInformer.GetIndexer(),
+		ingressLister:               ctx.IngressStore(),
+		ingressClasses:              ctx.IngressClasses,
 		serviceLister:               ctx.ServiceInformer.GetIndexer(),
 		serviceQueue:                workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
 		endpointQueue:               workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		endpointHashes:              map[string]string{},
+		serviceEntryQueue:           workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
 		syncTracker:                 utils.NewTimeTracker(),
 		reflector:                   reflector,
 		enableCSM:                   enableCSM,
 		csmServiceNEGSkipNamespaces: csmServiceNEGSkipNamespaces,
 	}
 
-	ctx.IngressInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+	ctx.AddIngressEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			addIng := obj.(*v1beta1.Ingress)
-			if !utils.IsGLBCIngress(addIng) {
+			if !utils.IsGLBCIngress(addIng, negController.ingressClasses) {
 				klog.V(4).Infof("Ignoring add for ingress %v based on annotation %v", namer_util.IngressKeyFunc(addIng), annotations.IngressClassKey)
 				return
 			}
@@ -151,7 +196,7 @@ func NewController(
 		},
 		DeleteFunc: func(obj interface{}) {
 			delIng := obj.(*v1beta1.Ingress)
-			if !utils.IsGLBCIngress(delIng) {
+			if !utils.IsGLBCIngress(delIng, negController.ingressClasses) {
 				klog.V(4).Infof("Ignoring delete for ingress %v based on annotation %v", namer_util.IngressKeyFunc(delIng), annotations.IngressClassKey)
 				return
 			}
@@ -160,7 +205,7 @@ func NewController(
 		UpdateFunc: func(old, cur interface{}) {
 			oldIng := cur.(*v1beta1.Ingress)
 			curIng := cur.(*v1beta1.Ingress)
-			if !utils.IsGLBCIngress(curIng) {
+			if !utils.IsGLBCIngress(curIng, negController.ingressClasses) {
 				klog.V(4).Infof("Ignoring update for ingress %v based on annotation %v", namer_util.IngressKeyFunc(curIng), annotations.IngressClassKey)
 				return
 			}
@@ -177,14 +222,29 @@ func NewController(
 		DeleteFunc: negController.enqueueService,
 		UpdateFunc: func(old, cur interface{}) {
 			negController.enqueueService(cur)
+			// The syncers read the zones the NEGs are pinned to from the
+			// Service, so they sync again when the zones change.
+			oldSvc, curSvc := old.(*apiv1.Service), cur.(*apiv1.Service)
+			if oldSvc.Annotations[annotations.NEGZonesKey] != curSvc.Annotations[annotations.NEGZonesKey] {
+				negController.manager.Sync(curSvc.Namespace, curSvc.Name)
+			}
 		},
 	})
 
 	ctx.EndpointInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    negController.enqueueEndpoint,
-		DeleteFunc: negController.enqueueEndpoint,
+		DeleteFunc: negController.enqueueDeletedEndpoint,
+		UpdateFunc: negController.enqueueEndpointUpdate,
+	})
+
+	nodeReady := utils.GetNodeConditionPredicate()
+	ctx.NodeInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { negController.syncZones() },
+		DeleteFunc: func(obj interface{}) { negController.syncZones() },
 		UpdateFunc: func(old, cur interface{}) {
-			negController.enqueueEndpoint(cur)
+			if nodeZonesChanged(nodeReady, old.(*apiv1.Node), cur.(*apiv1.Node)) {
+				negController.syncZones()
+			}
 		},
 	})
 
@@ -194,8 +254,10 @@ func NewController(
 			negController.reflector.SyncPod(pod)
 		},
 		UpdateFunc: func(old, cur interface{}) {
-			pod := cur.(*apiv1.Pod)
-			negController.reflector.SyncPod(pod)
+			oldPod, curPod := old.(*apiv1.Pod), cur.(*apiv1.Pod)
+			if podReadinessChanged(oldPod, curPod) {
+				negController.reflector.SyncPod(curPod)
+			}
 		},
 	})
 
@@ -210,11 +272,46 @@ func NewController(
 		})
 		negController.destinationRuleClient = ctx.DestinationRuleClient
 	}
+	if enableCSM && ctx.ServiceEntryInformer != nil {
+		negController.serviceEntryLister = ctx.ServiceEntryInformer.GetIndexer()
+		negController.serviceEntryClient = ctx.ServiceEntryClient
+		ctx.ServiceEntryInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    negController.enqueueServiceEntry,
+			DeleteFunc: negController.enqueueServiceEntry,
+			UpdateFunc: func(old, cur interface{}) {
+				negController.enqueueServiceEntry(cur)
+			},
+		})
+		ctx.PodInformer.AddEventHandler(negController.podServiceEntryHandlers())
+	}
 
 	ctx.AddHealthCheck("neg-controller", negController.IsHealthy)
 	return negController
 }
 
+// newSnapshot loads the NEG snapshot saved by the previous run and saves it
+// again on graceful shutdown. Returns nil if disabled.
+func newSnapshot(ctx *context.ControllerContext) *negsyncer.Snapshot {
+	if flags.F.NegSnapshotConfigMap == "" {
+		return nil
+	}
+	name, err := utils.ToNamespacedName(flags.F.NegSnapshotConfigMap)
+	if err != nil {
+		klog.Errorf("Failed to parse --neg-snapshot-configmap, NEG snapshots are disabled: %v", err)
+		return nil
+	}
+	snapshot, err := negsyncer.LoadSnapshot(ctx.KubeClient, name)
+	if err != nil {
+		klog.Warningf("Failed to load NEG snapshot from ConfigMap %s, all NEGs will be listed: %v", name, err)
+	}
+	ctx.AddShutdownHook(func() {
+		if err := snapshot.Save(ctx.KubeClient, name); err != nil {
+			klog.Warningf("Failed to save NEG snapshot to ConfigMap %s: %v", name, err)
+		}
+	})
+	return snapshot
+}
+
 func (c *Controller) Run(stopCh <-chan struct{}) {
 	wait.PollUntil(5*time.Second, func() (bool, error) {
 		klog.V(2).Infof("Waiting for initial sync")
@@ -229,6 +326,9 @@ func (c *Controller) Run(stopCh <-chan struct{}) {
 
 	go wait.Until(c.serviceWorker, time.Second, stopCh)
 	go wait.Until(c.endpointWorker, time.Second, stopCh)
+	if c.serviceEntryLister != nil {
+		go wait.Until(c.serviceEntryWorker, time.Second, stopCh)
+	}
 	go func() {
 		// Wait for gcPeriod to run the first GC
 		// This is to make sure that all services are fully processed before running GC.
@@ -255,6 +355,7 @@ func (c *Controller) stop() {
 	klog.V(2).Infof("Shutting down network endpoint group controller")
 	c.serviceQueue.ShutDown()
 	c.endpointQueue.ShutDown()
+	c.serviceEntryQueue.ShutDown()
 	c.manager.ShutDown()
 }
 
@@ -325,10 +426,23 @@ func (c *Controller) processService(key string) error {
 	if service == nil {
 		return fmt.Errorf("cannot convert to Service (%T)", obj)
 	}
+	if service.DeletionTimestamp != nil {
+		return c.processServiceDeletion(service)
+	}
 	negAnnotation, foundNEGAnnotation, err := annotations.FromService(service).NEGAnnotation()
+	if annotationErr, ok := err.(*annotations.AnnotationError); ok {
+		// Retrying does not fix the annotation, the Service is synced
+		// again once it is updated.
+		c.recorder.Event(service, apiv1.EventTypeWarning, "InvalidAnnotation", annotationErr.Error())
+		gcemetrics.InvalidAnnotations.WithLabelValues(annotationErr.Key).Inc()
+		return nil
+	}
 	if err != nil {
 		return err
 	}
+	if warning := annotations.FromService(service).AnnotationWarning(annotations.NEGAnnotationKey); warning != nil {
+		c.recorder.Event(service, apiv1.EventTypeWarning, "InvalidAnnotation", warning.WarningMessage())
+	}
 
 	portInfoMap := make(negtypes.PortInfoMap)
 	needNeg := false
@@ -379,6 +493,12 @@ func (c *Controller) processService(key string) error {
 
 	if needNeg {
 		klog.V(2).Infof("Syncing service %q", key)
+		if err := c.syncNegFinalizer(service, true); err != nil {
+			return err
+		}
+		if err := c.checkNEGZones(service); err != nil {
+			return err
+		}
 		if err := c.mergeIngressPortInfo(negAnnotation, service, types.NamespacedName{Namespace: namespace, Name: name}, &portInfoMap); err != nil {
 			return err
 		}
@@ -389,6 +509,9 @@ func (c *Controller) processService(key string) error {
 		if err := portInfoMap.Merge(csmPortInfoMap); err != nil {
 			return fmt.Errorf("failed to merge service ports referenced by Istio:DestinationRule (%v): %v", csmPortInfoMap, err)
 		}
+		if err := c.checkQuota(service, portInfoMap); err != nil {
+			return err
+		}
 		return c.manager.EnsureSyncers(namespace, name, portInfoMap)
 	}
 
@@ -396,16 +519,121 @@ func (c *Controller) processService(key string) error {
 	klog.V(4).Infof("Service %q does not need any NEG. Skipping", key)
 	// neg annotation is not found or NEG is not enabled
 	c.manager.StopSyncer(namespace, name)
+	if err := c.syncNegFinalizer(service, false); err != nil {
+		return err
+	}
 	// delete the annotation
 	return c.syncNegStatusAnnotation(namespace, name, make(negtypes.PortInfoMap))
 }
 
+// checkNEGZones raises a warning event on the service if its NEGs are pinned
+// to zones which are not zones of the cluster. They are ignored, and the NEGs
+// of a Service pinned to none of the zones of the cluster are not created.
+func (c *Controller) checkNEGZones(service *apiv1.Service) error {
+	pinned, ok := annotations.FromService(service).NEGZones()
+	if !ok {
+		return nil
+	}
+	zones, err := c.zoneGetter.ListZones()
+	if err != nil {
+		return err
+	}
+	negZones, unknown := negtypes.PinnedZones(zones, pinned)
+	if len(unknown) > 0 {
+		c.recorder.Eventf(service, apiv1.EventTypeWarning, "InvalidNEGZones", "Zones %v of annotation %s are not zones of the cluster %v", unknown, annotations.NEGZonesKey, zones)
+	}
+	if len(negZones) == 0 {
+		c.recorder.Eventf(service, apiv1.EventTypeWarning, "InvalidNEGZones", "Annotation %s pins the NEGs to none of the zones of the cluster %v", annotations.NEGZonesKey, zones)
+	}
+	return nil
+}
+
+// checkQuota raises a warning event on obj and returns an ErrQuotaExceeded if
+// its NEGs which do not exist yet would exceed the quota of the project.
+func (c *Controller) checkQuota(obj runtime.Object, portInfoMap negtypes.PortInfoMap) error {
+	if c.quota == nil || len(portInfoMap) == 0 {
+		return nil
+	}
+	zones, err := c.zoneGetter.ListZones()
+	if err != nil {
+		return err
+	}
+	if service, ok := obj.(*apiv1.Service); ok {
+		if pinned, ok := annotations.FromService(service).NEGZones(); ok {
+			zones, _ = negtypes.PinnedZones(zones, pinned)
+		}
+	}
+	var names []string
+	for _, portInfo := range portInfoMap {
+		for _, zone := range zones {
+			names = append(names, zone+"/"+portInfo.NegName)
+		}
+	}
+	existing := func() (sets.String, error) {
+		negs, err := c.cloud.AggregatedListNetworkEndpointGroup()
+		if err != nil {
+			return nil, err
+		}
+		have := sets.NewString()
+		for zone, zoneNegs := range negs {
+			for _, neg := range zoneNegs {
+				have.Insert(zone + "/" + neg.Name)
+			}
+		}
+		return have, nil
+	}
+	err = c.quota.Check(names, existing, quota.NetworkEndpointGroups)
+	if err != nil {
+		c.recorder.Event(obj, apiv1.EventTypeWarning, "QuotaExceeded", err.Error())
+	}
+	return err
+}
+
+// processServiceDeletion stops the syncers of a Service being deleted. If the
+// Service has the NEG finalizer, its NEGs are deleted before the finalizer is
+// removed, which fails while they are still used by backend services.
+func (c *Controller) processServiceDeletion(service *apiv1.Service) error {
+	c.manager.StopSyncer(service.Namespace, service.Name)
+	if !utils.HasFinalizer(service.ObjectMeta, utils.NegFinalizerKey) {
+		return nil
+	}
+	if status, ok := service.Annotations[annotations.NEGStatusKey]; ok {
+		negStatus, err := annotations.ParseNegStatus(status)
+		if err != nil {
+			// The NEGs are left to the garbage collection rather than
+			// blocking the deletion of the Service forever.
+			klog.Errorf("Failed to parse NEG status of service %s/%s: %v", service.Namespace, service.Name, err)
+		} else {
+			var negNames []string
+			for _, name := range negStatus.NetworkEndpointGroups {
+				negNames = append(negNames, name)
+			}
+			if err := c.manager.DeleteNEGs(negNames, negStatus.Zones); err != nil {
+				c.recorder.Eventf(service, apiv1.EventTypeWarning, "DeleteNEGs", "Failed to delete NEGs: %v", err)
+				return err
+			}
+		}
+	}
+	return utils.RemoveServiceFinalizer(service, utils.NegFinalizerKey, c.client.CoreV1().Services(service.Namespace))
+}
+
+// syncNegFinalizer adds the NEG finalizer to a Service which needs NEGs if
+// enabled, and removes it otherwise. The NEGs of Services which no longer
+// need them are deleted by the garbage collection.
+func (c *Controller) syncNegFinalizer(service *apiv1.Service, needNeg bool) error {
+	svcClient := c.client.CoreV1().Services(service.Namespace)
+	if needNeg && flags.F.EnableNEGFinalizer {
+		return utils.AddServiceFinalizer(service, utils.NegFinalizerKey, svcClient)
+	}
+	return utils.RemoveServiceFinalizer(service, utils.NegFinalizerKey, svcClient)
+}
+
 func (c *Controller) mergeIngressPortInfo(negAnnotation *annotations.NegAnnotation, service *apiv1.Service, name types.NamespacedName, portInfoMap *negtypes.PortInfoMap) error {
 	// handle NEGs used by ingress
 	if negAnnotation != nil && negAnnotation.NEGEnabledForIngress() {
 		// Only service ports referenced by ingress are synced for NEG
-		ings := getIngressServicesFromStore(c.ingressLister, service)
-		ingressSvcPorts := gatherPortMappingUsedByIngress(ings, service)
+		ings := getIngressServicesFromStore(c.ingressLister, c.ingressClasses, service)
+		ingressSvcPorts := gatherPortMappingUsedByIngress(ings, c.ingressClasses, service)
 		ingressPortInfoMap := negtypes.NewPortInfoMap(name.Namespace, name.Name, ingressSvcPorts, c.namer, true)
 		if err := portInfoMap.Merge(ingressPortInfoMap); err != nil {
 			return fmt.Errorf("failed to merge service ports referenced by ingress (%v): %v", ingressPortInfoMap, err)
@@ -440,7 +668,7 @@ func (c *Controller) mergeIngressPortInfo(negAnnotation *annotations.NegAnnotati
 func (c *Controller) defaultBackendServicePortInfoMap() negtypes.PortInfoMap {
 	for _, m := range c.ingressLister.List() {
 		ing := *m.(*v1beta1.Ingress)
-		if utils.IsGCEL7ILBIngress(&ing) && ing.Spec.Backend == nil {
+		if utils.IsGCEL7ILBIngress(&ing, c.ingressClasses) && ing.Spec.Backend == nil {
 			return negtypes.NewPortInfoMap(c.defaultBackendService.ID.Service.Namespace, c.defaultBackendService.ID.Service.Name, negtypes.SvcPortMap{80: c.defaultBackendService.TargetPort}, c.namer, false)
 		}
 
@@ -474,7 +702,14 @@ func (c *Controller) syncNegStatusAnnotation(namespace, name string, portMap neg
 		return nil
 	}
 
+	if pinned, ok := annotations.FromService(service).NEGZones(); ok {
+		zones, _ = negtypes.PinnedZones(zones, pinned)
+	}
+	sort.Strings(zones)
 	negStatus := annotations.NewNegStatus(zones, portMap.ToPortNegMap())
+	negStatus.NetworkEndpointType = string(negtypes.VmIpPortEndpointType)
+	negStatus.TargetPorts = portMap.ToPortTargetPortMap()
+	negStatus.Subnetwork = c.subnetworkURL
 	annotation, err := negStatus.Marshal()
 	if err != nil {
 		return err
@@ -532,6 +767,32 @@ func (c *Controller) syncDestinationRuleNegStatusAnnotation(namespace, destinati
 	return err
 }
 
+// syncZones enqueues the Services with NEGs when the zones of the ready
+// nodes changed, so that the zones of their NEG status annotation are
+// updated.
+func (c *Controller) syncZones() {
+	zones, err := c.zoneGetter.ListZones()
+	if err != nil {
+		klog.Errorf("Failed to list zones: %v", err)
+		return
+	}
+	sort.Strings(zones)
+	c.zonesLock.Lock()
+	changed := !reflect.DeepEqual(zones, c.zones)
+	c.zones = zones
+	c.zonesLock.Unlock()
+	if !changed {
+		return
+	}
+
+	klog.V(2).Infof("Zones changed to %v, syncing the Services with NEGs", zones)
+	for _, obj := range c.serviceLister.List() {
+		if _, ok := obj.(*apiv1.Service).Annotations[annotations.NEGStatusKey]; ok {
+			c.enqueueService(obj)
+		}
+	}
+}
+
 func (c *Controller) handleErr(err error, key interface{}) {
 	if err == nil {
 		c.serviceQueue.Forget(key)
@@ -554,9 +815,50 @@ func (c *Controller) enqueueEndpoint(obj interface{}) {
 		klog.Errorf("Failed to generate endpoint key: %v", err)
 		return
 	}
+	c.endpointHashLock.Lock()
+	if hash, err := endpointsHash(obj.(*apiv1.Endpoints)); err == nil {
+		c.endpointHashes[key] = hash
+	} else {
+		delete(c.endpointHashes, key)
+	}
+	c.endpointHashLock.Unlock()
+	c.endpointQueue.Add(key)
+}
+
+func (c *Controller) enqueueDeletedEndpoint(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		klog.Errorf("Failed to generate endpoint key: %v", err)
+		return
+	}
+	c.endpointHashLock.Lock()
+	delete(c.endpointHashes, key)
+	c.endpointHashLock.Unlock()
 	c.endpointQueue.Add(key)
 }
 
+// enqueueEndpointUpdate enqueues the updated Endpoints unless the update
+// only changed their metadata, e.g. the leader election annotations, since
+// the NEG syncers only depend on their addresses. The periodic resyncs of the
+// informer, which don't change the resourceVersion, are always enqueued.
+func (c *Controller) enqueueEndpointUpdate(old, cur interface{}) {
+	oldEndpoints, curEndpoints := old.(*apiv1.Endpoints), cur.(*apiv1.Endpoints)
+	if oldEndpoints.ResourceVersion != curEndpoints.ResourceVersion {
+		key, err := cache.MetaNamespaceKeyFunc(curEndpoints)
+		hash, hashErr := endpointsHash(curEndpoints)
+		if err == nil && hashErr == nil {
+			c.endpointHashLock.Lock()
+			unchanged := c.endpointHashes[key] == hash
+			c.endpointHashLock.Unlock()
+			if unchanged {
+				klog.V(4).Infof("Addresses of Endpoints %q are unchanged, skipping the update", key)
+				return
+			}
+		}
+	}
+	c.enqueueEndpoint(cur)
+}
+
 func (c *Controller) enqueueService(obj interface{}) {
 	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
 	if err != nil {
@@ -597,11 +899,11 @@ func (c *Controller) gc() {
 
 // gatherPortMappingUsedByIngress returns a map containing port:targetport
 // of all service ports of the service that are referenced by ingresses
-func gatherPortMappingUsedByIngress(ings []v1beta1.Ingress, svc *apiv1.Service) negtypes.SvcPortMap {
+func gatherPortMappingUsedByIngress(ings []v1beta1.Ingress, classes utils.IngressClassLookup, svc *apiv1.Service) negtypes.SvcPortMap {
 	servicePorts := sets.NewString()
 	ingressSvcPorts := make(negtypes.SvcPortMap)
 	for _, ing := range ings {
-		if utils.IsGLBCIngress(&ing) {
+		if utils.IsGLBCIngress(&ing, classes) {
 			utils.TraverseIngressBackends(&ing, func(id utils.ServicePortID) bool {
 				if id.Service.Name == svc.Name {
 					servicePorts.Insert(id.Port.String())
@@ -650,14 +952,14 @@ func gatherIngressServiceKeys(ing *v1beta1.Ingress) sets.String {
 	return set
 }
 
-func getIngressServicesFromStore(store cache.Store, svc *apiv1.Service) (ings []v1beta1.Ingress) {
+func getIngressServicesFromStore(store cache.Store, classes utils.IngressClassLookup, svc *apiv1.Service) (ings []v1beta1.Ingress) {
 	for _, m := range store.List() {
 		ing := *m.(*v1beta1.Ingress)
 		if ing.Namespace != svc.Namespace {
 			continue
 		}
 
-		if utils.IsGLBCIngress(&ing) {
+		if utils.IsGLBCIngress(&ing, classes) {
 			utils.TraverseIngressBackends(&ing, func(id utils.ServicePortID) bool {
 				if id.Service.Name == svc.Name {
 					ings = append(ings, ing)
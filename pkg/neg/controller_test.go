@@ -25,6 +25,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"google.golang.org/api/compute/v1"
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/api/networking/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -33,11 +36,14 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/ingress-gce/pkg/annotations"
 	backendconfigclient "k8s.io/ingress-gce/pkg/backendconfig/client/clientset/versioned/fake"
 	"k8s.io/ingress-gce/pkg/context"
+	"k8s.io/ingress-gce/pkg/controller/errors"
 	"k8s.io/ingress-gce/pkg/flags"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/ingress-gce/pkg/quota"
 	"k8s.io/ingress-gce/pkg/utils"
 	namer_util "k8s.io/ingress-gce/pkg/utils/namer"
 	"k8s.io/legacy-cloud-providers/gce"
@@ -214,6 +220,127 @@ func TestNewNEGService(t *testing.T) {
 	}
 }
 
+func TestInvalidNEGAnnotation(t *testing.T) {
+	t.Parallel()
+
+	controller := newTestController(fake.NewSimpleClientset())
+	defer controller.stop()
+	recorder := record.NewFakeRecorder(10)
+	controller.recorder = recorder
+	svc := newTestService(controller, false, []int32{})
+	svc.Annotations[annotations.NEGAnnotationKey] = `{"exposed_ports":{"80":{"name":80}}}`
+	controller.serviceLister.Add(svc)
+
+	if err := controller.processService(utils.ServiceKeyFunc(testServiceNamespace, testServiceName)); err != nil {
+		t.Fatalf("Failed to process service: %v", err)
+	}
+	validateSyncers(t, controller, 0, true)
+
+	want := `Warning InvalidAnnotation NEG annotation is invalid: exposed_ports["80"].name: must be a string`
+	select {
+	case got := <-recorder.Events:
+		if got != want {
+			t.Errorf("Got event %q, want %q", got, want)
+		}
+	default:
+		t.Errorf("Got no event, want %q", want)
+	}
+}
+
+func TestSyncZones(t *testing.T) {
+	t.Parallel()
+
+	controller := newTestController(fake.NewSimpleClientset())
+	defer controller.stop()
+	svc := newTestService(controller, false, []int32{80})
+	svc.Annotations[annotations.NEGStatusKey] = `{"network_endpoint_groups":{"80":"neg"}}`
+	controller.serviceLister.Add(svc)
+	otherSvc := svc.DeepCopy()
+	otherSvc.Name = "other"
+	otherSvc.Annotations = nil
+	controller.serviceLister.Add(otherSvc)
+
+	// The zones changed from the initial empty list.
+	controller.syncZones()
+	if got := controller.serviceQueue.Len(); got != 1 {
+		t.Fatalf("Got %d queued services after the zones changed, want 1", got)
+	}
+	key, _ := controller.serviceQueue.Get()
+	if want := utils.ServiceKeyFunc(testServiceNamespace, testServiceName); key != want {
+		t.Errorf("Got queued service %q, want %q", key, want)
+	}
+	controller.serviceQueue.Done(key)
+
+	controller.syncZones()
+	if got := controller.serviceQueue.Len(); got != 0 {
+		t.Errorf("Got %d queued services after the zones did not change, want 0", got)
+	}
+}
+
+func TestEnqueueEndpointUpdate(t *testing.T) {
+	t.Parallel()
+
+	controller := newTestController(fake.NewSimpleClientset())
+	defer controller.stop()
+	// queued returns the number of queued Endpoints, and empties the queue.
+	queued := func() int {
+		n := controller.endpointQueue.Len()
+		for i := 0; i < n; i++ {
+			key, _ := controller.endpointQueue.Get()
+			controller.endpointQueue.Done(key)
+		}
+		return n
+	}
+
+	endpoints := &apiv1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testServiceNamespace, Name: testServiceName, ResourceVersion: "1"},
+		Subsets: []apiv1.EndpointSubset{{
+			Addresses: []apiv1.EndpointAddress{{IP: "10.0.0.1"}},
+			Ports:     []apiv1.EndpointPort{{Port: 80}},
+		}},
+	}
+	controller.enqueueEndpoint(endpoints)
+	if got := queued(); got != 1 {
+		t.Errorf("Got %d queued Endpoints after they were added, want 1", got)
+	}
+
+	for _, tc := range []struct {
+		desc   string
+		update func(*apiv1.Endpoints)
+		want   int
+	}{
+		{desc: "resync", update: func(*apiv1.Endpoints) {}, want: 1},
+		{desc: "metadata-only update", update: func(ep *apiv1.Endpoints) {
+			ep.ResourceVersion = "2"
+			ep.Annotations = map[string]string{"leader": "me"}
+		}, want: 0},
+		{desc: "address update", update: func(ep *apiv1.Endpoints) {
+			ep.ResourceVersion = "3"
+			ep.Subsets[0].Addresses = append(ep.Subsets[0].Addresses, apiv1.EndpointAddress{IP: "10.0.0.2"})
+		}, want: 1},
+		{desc: "metadata-only update after the address update", update: func(ep *apiv1.Endpoints) {
+			ep.ResourceVersion = "4"
+			ep.Annotations = map[string]string{"leader": "you"}
+		}, want: 0},
+	} {
+		cur := endpoints.DeepCopy()
+		tc.update(cur)
+		controller.enqueueEndpointUpdate(endpoints, cur)
+		if got := queued(); got != tc.want {
+			t.Errorf("%s: got %d queued Endpoints, want %d", tc.desc, got, tc.want)
+		}
+		endpoints = cur
+	}
+
+	controller.enqueueDeletedEndpoint(endpoints)
+	if got := queued(); got != 1 {
+		t.Errorf("Got %d queued Endpoints after they were deleted, want 1", got)
+	}
+	if len(controller.endpointHashes) != 0 {
+		t.Errorf("Got hashes %v after the Endpoints were deleted, want none", controller.endpointHashes)
+	}
+}
+
 func TestEnableNEGServiceWithIngress(t *testing.T) {
 	t.Parallel()
 
@@ -305,6 +432,68 @@ func TestDisableNEGServiceWithIngress(t *testing.T) {
 	validateSyncers(t, controller, 3, true)
 }
 
+func TestNEGFinalizer(t *testing.T) {
+	// Not running in parallel since enabling global flag
+	flags.F.EnableNEGFinalizer = true
+	defer func() { flags.F.EnableNEGFinalizer = false }()
+
+	controller := newTestController(fake.NewSimpleClientset())
+	defer controller.stop()
+	controller.serviceLister.Add(newTestService(controller, false, []int32{80}))
+	svcClient := controller.client.CoreV1().Services(testServiceNamespace)
+	svcKey := utils.ServiceKeyFunc(testServiceNamespace, testServiceName)
+	if err := controller.processService(svcKey); err != nil {
+		t.Fatalf("Failed to process service: %v", err)
+	}
+	svc, err := svcClient.Get(testServiceName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get service: %v", err)
+	}
+	if !utils.HasFinalizer(svc.ObjectMeta, utils.NegFinalizerKey) {
+		t.Fatalf("Service finalizers = %v, want %q", svc.Finalizers, utils.NegFinalizerKey)
+	}
+
+	// Delete the service with NEGs in both zones.
+	cloud := controller.manager.(*syncerManager).cloud
+	negName := "test-neg"
+	zones := []string{negtypes.TestZone1, negtypes.TestZone2}
+	for _, zone := range zones {
+		if err := cloud.CreateNetworkEndpointGroup(&compute.NetworkEndpointGroup{Name: negName}, zone); err != nil {
+			t.Fatalf("Failed to create NEG %q in %q: %v", negName, zone, err)
+		}
+	}
+	status, err := json.Marshal(annotations.NegStatus{
+		NetworkEndpointGroups: annotations.PortNegMap{"80": negName},
+		Zones:                 zones,
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal NEG status: %v", err)
+	}
+	svc.Annotations[annotations.NEGStatusKey] = string(status)
+	now := metav1.Now()
+	svc.DeletionTimestamp = &now
+	if _, err := svcClient.Update(svc); err != nil {
+		t.Fatalf("Failed to update service: %v", err)
+	}
+	controller.serviceLister.Update(svc)
+	if err := controller.processService(svcKey); err != nil {
+		t.Fatalf("Failed to process service: %v", err)
+	}
+
+	for _, zone := range zones {
+		if neg, err := cloud.GetNetworkEndpointGroup(negName, zone); err == nil {
+			t.Errorf("NEG %q in %q was not deleted: %v", negName, zone, neg)
+		}
+	}
+	svc, err = svcClient.Get(testServiceName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get service: %v", err)
+	}
+	if utils.HasFinalizer(svc.ObjectMeta, utils.NegFinalizerKey) {
+		t.Errorf("Service finalizers = %v, want no %q", svc.Finalizers, utils.NegFinalizerKey)
+	}
+}
+
 func TestGatherPortMappingUsedByIngress(t *testing.T) {
 	t.Parallel()
 
@@ -396,7 +585,7 @@ func TestGatherPortMappingUsedByIngress(t *testing.T) {
 	for _, tc := range testCases {
 		controller := newTestController(fake.NewSimpleClientset())
 		defer controller.stop()
-		portMap := gatherPortMappingUsedByIngress(tc.ings, newTestService(controller, true, []int32{}))
+		portMap := gatherPortMappingUsedByIngress(tc.ings, nil, newTestService(controller, true, []int32{}))
 		if len(portMap) != len(tc.expect) {
 			t.Errorf("Expect %v ports, but got %v.", len(tc.expect), len(portMap))
 		}
@@ -477,6 +666,12 @@ func TestSyncNegAnnotation(t *testing.T) {
 				svcPorts = append(svcPorts, port.ServicePort)
 			}
 			validateServiceStateAnnotation(t, svc, svcPorts, controller.namer)
+			if len(tc.portMap) > 0 {
+				negStatus, _ := annotations.ParseNegStatus(svc.Annotations[annotations.NEGStatusKey])
+				if !reflect.DeepEqual(negStatus.TargetPorts, tc.portMap.ToPortTargetPortMap()) {
+					t.Errorf("Expect target ports %v, but got %v", tc.portMap.ToPortTargetPortMap(), negStatus.TargetPorts)
+				}
+			}
 		})
 	}
 }
@@ -658,6 +853,18 @@ func validateServiceStateAnnotation(t *testing.T, svc *apiv1.Service, svcPorts [
 	if !zoneInStatus.Equal(expectedZones) {
 		t.Fatalf("Expect Zone %v, but got %v", expectedZones.List(), zoneInStatus.List())
 	}
+
+	if negStatus.NetworkEndpointType != string(negtypes.VmIpPortEndpointType) {
+		t.Errorf("Expect network endpoint type %q, but got %q", negtypes.VmIpPortEndpointType, negStatus.NetworkEndpointType)
+	}
+	if negStatus.Subnetwork != "test-subnetwork" {
+		t.Errorf("Expect subnetwork %q, but got %q", "test-subnetwork", negStatus.Subnetwork)
+	}
+	for _, svcPort := range svcPorts {
+		if _, ok := negStatus.TargetPorts[strconv.Itoa(int(svcPort))]; !ok {
+			t.Errorf("Target port of service port %d was not found", svcPort)
+		}
+	}
 }
 
 func generateNegAnnotation(ingress bool, svcPorts []int32) string {
@@ -769,3 +976,37 @@ func newTestService(c *Controller, negIngress bool, negSvcPorts []int32) *apiv1.
 	c.client.CoreV1().Services(testServiceNamespace).Create(svc)
 	return svc
 }
+
+func TestCheckQuota(t *testing.T) {
+	controller := newTestController(fake.NewSimpleClientset())
+	defer controller.stop()
+	recorder := record.NewFakeRecorder(10)
+	controller.recorder = recorder
+
+	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	mockProjects := fakeGCE.Compute().(*cloud.MockGCE).Projects().(*cloud.MockProjects)
+	// The 2 ports of the service need 4 NEGs in the 2 zones, one too many.
+	mockProjects.Objects[*meta.GlobalKey(fakeGCE.ProjectID())] = &cloud.MockProjectsObj{Obj: &compute.Project{
+		Quotas: []*compute.Quota{{Metric: quota.NetworkEndpointGroups, Limit: 10, Usage: 7}},
+	}}
+	controller.quota = quota.NewChecker(fakeGCE)
+
+	service := newTestService(controller, true, []int32{80, 443})
+	portInfoMap := negtypes.NewPortInfoMap(service.Namespace, service.Name, negtypes.SvcPortMap{80: "8080", 443: "8443"}, controller.namer, false)
+	err := controller.checkQuota(service, portInfoMap)
+	if _, ok := err.(errors.ErrQuotaExceeded); !ok {
+		t.Fatalf("checkQuota() = %v, want ErrQuotaExceeded", err)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "QuotaExceeded") {
+		t.Errorf("Got event %q, want a QuotaExceeded event", event)
+	}
+
+	// NEGs which already exist do not need quota.
+	negName := portInfoMap[negtypes.PortInfoMapKey{ServicePort: 80}].NegName
+	if err := controller.cloud.CreateNetworkEndpointGroup(&compute.NetworkEndpointGroup{Name: negName}, negtypes.TestZone1); err != nil {
+		t.Fatalf("CreateNetworkEndpointGroup() = %v", err)
+	}
+	if err := controller.checkQuota(service, portInfoMap); err != nil {
+		t.Errorf("checkQuota() = %v, want nil", err)
+	}
+}
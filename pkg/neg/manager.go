@@ -17,7 +17,9 @@ limitations under the License.
 package neg
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"sync"
 
 	v1 "k8s.io/api/core/v1"
@@ -26,15 +28,27 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/ingress-gce/pkg/annotations"
+	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/flags"
+	"k8s.io/ingress-gce/pkg/neg/metrics"
 	"k8s.io/ingress-gce/pkg/neg/readiness"
 	negsyncer "k8s.io/ingress-gce/pkg/neg/syncers"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/klog"
 )
 
+// maxConcurrentNEGDeletions is the maximum number of NEGs deleted in parallel
+// during garbage collection.
+const maxConcurrentNEGDeletions = 10
+
 type serviceKey struct {
 	namespace string
 	name      string
+	// serviceEntry is true for the key of an Istio:ServiceEntry.
+	serviceEntry bool
 }
 
 func (k serviceKey) Key() string {
@@ -44,15 +58,22 @@ func (k serviceKey) Key() string {
 // syncerManager contains all the active syncer goroutines and manage their lifecycle.
 type syncerManager struct {
 	negSyncerType NegSyncerType
+	// endpointsCalculator is the name of the registered EndpointsCalculator
+	// used by transaction syncers.
+	endpointsCalculator string
 
 	namer      negtypes.NetworkEndpointGroupNamer
 	recorder   record.EventRecorder
 	cloud      negtypes.NetworkEndpointGroupCloud
 	zoneGetter negtypes.ZoneGetter
+	// backendServices unlinks the NEGs from the backend services of the
+	// cluster before deleting them, nil if disabled.
+	backendServices negtypes.BackendServiceCloud
 
 	podLister      cache.Indexer
 	serviceLister  cache.Indexer
 	endpointLister cache.Indexer
+	nodeLister     cache.Indexer
 
 	// TODO: lock per service instead of global lock
 	mu sync.Mutex
@@ -65,29 +86,47 @@ type syncerManager struct {
 	syncerMap map[negtypes.NegSyncerKey]negtypes.NegSyncer
 	// reflector handles NEG readiness gate and conditions for pods in NEG.
 	reflector readiness.Reflector
+	// syncLimiter limits the number of syncers syncing at the same time.
+	syncLimiter negsyncer.Limiter
+	// snapshot records the endpoints of the NEGs of the transaction syncers
+	// for a warm restart, nil if disabled.
+	snapshot *negsyncer.Snapshot
 }
 
-func newSyncerManager(namer negtypes.NetworkEndpointGroupNamer, recorder record.EventRecorder, cloud negtypes.NetworkEndpointGroupCloud, zoneGetter negtypes.ZoneGetter, podLister cache.Indexer, serviceLister cache.Indexer, endpointLister cache.Indexer, negSyncerType NegSyncerType) *syncerManager {
+func newSyncerManager(namer negtypes.NetworkEndpointGroupNamer, recorder record.EventRecorder, cloud negtypes.NetworkEndpointGroupCloud, zoneGetter negtypes.ZoneGetter, podLister cache.Indexer, serviceLister cache.Indexer, endpointLister cache.Indexer, nodeLister cache.Indexer, negSyncerType NegSyncerType) *syncerManager {
 	klog.V(2).Infof("NEG controller will use NEG syncer type: %q", negSyncerType)
 	return &syncerManager{
-		negSyncerType:  negSyncerType,
-		namer:          namer,
-		recorder:       recorder,
-		cloud:          cloud,
-		zoneGetter:     zoneGetter,
-		podLister:      podLister,
-		serviceLister:  serviceLister,
-		endpointLister: endpointLister,
-		svcPortMap:     make(map[serviceKey]negtypes.PortInfoMap),
-		syncerMap:      make(map[negtypes.NegSyncerKey]negtypes.NegSyncer),
+		negSyncerType:       negSyncerType,
+		endpointsCalculator: flags.F.NegEndpointsCalculator,
+		syncLimiter:         negsyncer.NewLimiter(flags.F.NegSyncerConcurrency),
+		namer:               namer,
+		recorder:            recorder,
+		cloud:               cloud,
+		zoneGetter:          zoneGetter,
+		podLister:           podLister,
+		serviceLister:       serviceLister,
+		endpointLister:      endpointLister,
+		nodeLister:          nodeLister,
+		svcPortMap:          make(map[serviceKey]negtypes.PortInfoMap),
+		syncerMap:           make(map[negtypes.NegSyncerKey]negtypes.NegSyncer),
 	}
 }
 
 // EnsureSyncer starts and stops syncers based on the input service ports.
 func (manager *syncerManager) EnsureSyncers(namespace, name string, newPorts negtypes.PortInfoMap) error {
+	return manager.ensureSyncers(getServiceKey(namespace, name), newPorts)
+}
+
+// EnsureServiceEntrySyncers starts and stops syncers based on the input
+// Istio:ServiceEntry ports.
+func (manager *syncerManager) EnsureServiceEntrySyncers(namespace, name string, newPorts negtypes.PortInfoMap) error {
+	return manager.ensureSyncers(serviceKey{namespace: namespace, name: name, serviceEntry: true}, newPorts)
+}
+
+func (manager *syncerManager) ensureSyncers(key serviceKey, newPorts negtypes.PortInfoMap) error {
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
-	key := getServiceKey(namespace, name)
+	namespace, name := key.namespace, key.name
 	currentPorts, ok := manager.svcPortMap[key]
 	if !ok {
 		currentPorts = make(negtypes.PortInfoMap)
@@ -102,10 +141,10 @@ func (manager *syncerManager) EnsureSyncers(namespace, name string, newPorts neg
 	removeCommonPorts(adds, removes)
 
 	manager.svcPortMap[key] = newPorts
-	klog.V(3).Infof("EnsureSyncer %v/%v: syncing %v ports, removing %v ports, adding %v ports", namespace, name, newPorts, removes, adds)
+	klog.V(3).Infof("EnsureSyncer %v: syncing %v ports, removing %v ports, adding %v ports", key.Key(), newPorts, removes, adds)
 
 	for svcPort, portInfo := range removes {
-		syncer, ok := manager.syncerMap[getSyncerKey(namespace, name, svcPort, portInfo)]
+		syncer, ok := manager.syncerMap[key.syncerKey(svcPort, portInfo)]
 		if ok {
 			syncer.Stop()
 		}
@@ -114,7 +153,7 @@ func (manager *syncerManager) EnsureSyncers(namespace, name string, newPorts neg
 	errList := []error{}
 	// Ensure a syncer is running for each port that is being added.
 	for svcPort, portInfo := range adds {
-		syncer, ok := manager.syncerMap[getSyncerKey(namespace, name, svcPort, portInfo)]
+		syncer, ok := manager.syncerMap[key.syncerKey(svcPort, portInfo)]
 		if !ok {
 			syncerKey := negtypes.NegSyncerKey{
 				Namespace:    namespace,
@@ -123,19 +162,42 @@ func (manager *syncerManager) EnsureSyncers(namespace, name string, newPorts neg
 				TargetPort:   portInfo.TargetPort,
 				Subset:       portInfo.Subset,
 				SubsetLabels: portInfo.SubsetLabels,
+				ServiceEntry: key.serviceEntry,
 			}
 
-			if manager.negSyncerType == transactionSyncer {
+			// The endpoints of Istio:ServiceEntries are not in Endpoints
+			// objects, so only the transaction syncer can compute them.
+			if manager.negSyncerType == transactionSyncer || key.serviceEntry {
+				calculatorName := manager.endpointsCalculator
+				if key.serviceEntry {
+					calculatorName = negsyncer.ServiceEntryEndpointsCalculator
+				}
+				calculator, err := negsyncer.NewEndpointsCalculator(calculatorName, negsyncer.EndpointsCalculatorParams{
+					Key:            syncerKey,
+					ZoneGetter:     manager.zoneGetter,
+					PodLister:      manager.podLister,
+					ServiceLister:  manager.serviceLister,
+					EndpointLister: manager.endpointLister,
+				})
+				if err != nil {
+					errList = append(errList, err)
+					continue
+				}
 				syncer = negsyncer.NewTransactionSyncer(
 					syncerKey,
 					portInfo.NegName,
 					manager.recorder,
 					manager.cloud,
 					manager.zoneGetter,
-					manager.podLister,
 					manager.serviceLister,
-					manager.endpointLister,
+					manager.podLister,
+					manager.nodeLister,
+					calculator,
 					manager.reflector,
+					manager.syncLimiter,
+					manager.snapshot,
+					manager.backendServices,
+					manager.namer,
 				)
 			} else {
 				// Use batch syncer by default
@@ -148,10 +210,11 @@ func (manager *syncerManager) EnsureSyncers(namespace, name string, newPorts neg
 					manager.serviceLister,
 					manager.endpointLister,
 					manager.podLister,
+					manager.syncLimiter,
 				)
 			}
 
-			manager.syncerMap[getSyncerKey(namespace, name, svcPort, portInfo)] = syncer
+			manager.syncerMap[key.syncerKey(svcPort, portInfo)] = syncer
 		}
 
 		if syncer.IsStopped() {
@@ -165,12 +228,20 @@ func (manager *syncerManager) EnsureSyncers(namespace, name string, newPorts neg
 
 // StopSyncer stops all syncers for the input service.
 func (manager *syncerManager) StopSyncer(namespace, name string) {
+	manager.stopSyncer(getServiceKey(namespace, name))
+}
+
+// StopServiceEntrySyncer stops all syncers for the input Istio:ServiceEntry.
+func (manager *syncerManager) StopServiceEntrySyncer(namespace, name string) {
+	manager.stopSyncer(serviceKey{namespace: namespace, name: name, serviceEntry: true})
+}
+
+func (manager *syncerManager) stopSyncer(key serviceKey) {
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
-	key := getServiceKey(namespace, name)
 	if ports, ok := manager.svcPortMap[key]; ok {
 		for svcPort, portInfo := range ports {
-			if syncer, ok := manager.syncerMap[getSyncerKey(namespace, name, svcPort, portInfo)]; ok {
+			if syncer, ok := manager.syncerMap[key.syncerKey(svcPort, portInfo)]; ok {
 				syncer.Stop()
 			}
 		}
@@ -181,12 +252,20 @@ func (manager *syncerManager) StopSyncer(namespace, name string) {
 
 // Sync signals all syncers related to the service to sync.
 func (manager *syncerManager) Sync(namespace, name string) {
+	manager.sync(getServiceKey(namespace, name))
+}
+
+// SyncServiceEntry signals all syncers related to the Istio:ServiceEntry to sync.
+func (manager *syncerManager) SyncServiceEntry(namespace, name string) {
+	manager.sync(serviceKey{namespace: namespace, name: name, serviceEntry: true})
+}
+
+func (manager *syncerManager) sync(key serviceKey) {
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
-	key := getServiceKey(namespace, name)
 	if portInfoMap, ok := manager.svcPortMap[key]; ok {
 		for svcPort, portInfo := range portInfoMap {
-			if syncer, ok := manager.syncerMap[getSyncerKey(namespace, name, svcPort, portInfo)]; ok {
+			if syncer, ok := manager.syncerMap[key.syncerKey(svcPort, portInfo)]; ok {
 				if !syncer.IsStopped() {
 					syncer.Sync()
 				}
@@ -224,7 +303,7 @@ func (manager *syncerManager) ReadinessGateEnabledNegs(namespace string, podLabe
 	defer manager.mu.Unlock()
 	ret := sets.NewString()
 	for svcKey, portMap := range manager.svcPortMap {
-		if svcKey.namespace != namespace {
+		if svcKey.namespace != namespace || svcKey.serviceEntry {
 			continue
 		}
 
@@ -257,7 +336,7 @@ func (manager *syncerManager) ReadinessGateEnabledNegs(namespace string, podLabe
 func (manager *syncerManager) ReadinessGateEnabled(syncerKey negtypes.NegSyncerKey) bool {
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
-	if v, ok := manager.svcPortMap[serviceKey{namespace: syncerKey.Namespace, name: syncerKey.Name}]; ok {
+	if v, ok := manager.svcPortMap[serviceKey{namespace: syncerKey.Namespace, name: syncerKey.Name, serviceEntry: syncerKey.ServiceEntry}]; ok {
 		if info, ok := v[negtypes.PortInfoMapKey{ServicePort: syncerKey.Port, Subset: syncerKey.Subset}]; ok {
 			return info.ReadinessGate
 		}
@@ -293,12 +372,19 @@ func (manager *syncerManager) garbageCollectNEG() error {
 		}
 	}
 
+	unpinnedZones, err := manager.unpinnedZones()
+	if err != nil {
+		return err
+	}
+
 	func() {
 		manager.mu.Lock()
 		defer manager.mu.Unlock()
 		for _, portInfoMap := range manager.svcPortMap {
 			for _, portInfo := range portInfoMap {
-				negNames.Delete(portInfo.NegName)
+				// The replacement of a NEG is deleted by its syncer once
+				// the NEG is recreated.
+				negNames.Delete(portInfo.NegName, negsyncer.ReplacementNEGName(portInfo.NegName))
 			}
 		}
 	}()
@@ -307,25 +393,219 @@ func (manager *syncerManager) garbageCollectNEG() error {
 	// The worst outcome of the race condition is that neg is deleted in the end but user actually specifies a neg.
 	// This would be resolved (sync neg) when the next endpoint update or resync arrives.
 	// TODO: avoid race condition here
-	for zone := range zoneNEGList {
-		for _, name := range negNames.List() {
-			if err := manager.ensureDeleteNetworkEndpointGroup(name, zone); err != nil {
-				return fmt.Errorf("failed to delete NEG %q in %q: %v", name, zone, err)
+	var toDelete []zonalNEG
+	for zone, list := range zoneNEGList {
+		for _, neg := range list {
+			if negNames.Has(neg.Name) || unpinnedZones[neg.Name].Has(zone) {
+				toDelete = append(toDelete, zonalNEG{name: neg.Name, zone: zone})
 			}
 		}
 	}
-	return nil
+
+	return manager.deleteNEGs(toDelete)
+}
+
+// unpinnedZones returns, by NEG name, the zones of the cluster the NEGs of
+// Services pinned to other zones with the cloud.google.com/neg-zones
+// annotation must be deleted from. The NEGs of a Service pinned to none of
+// the zones of the cluster are kept, as the annotation is likely wrong.
+func (manager *syncerManager) unpinnedZones() (map[string]sets.String, error) {
+	zones, err := manager.zoneGetter.ListZones()
+	if err != nil {
+		return nil, err
+	}
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	ret := map[string]sets.String{}
+	for key, portInfoMap := range manager.svcPortMap {
+		if key.serviceEntry {
+			continue
+		}
+		obj, exists, err := manager.serviceLister.GetByKey(key.Key())
+		if err != nil || !exists {
+			continue
+		}
+		pinned, ok := annotations.FromService(obj.(*v1.Service)).NEGZones()
+		if !ok {
+			continue
+		}
+		negZones, _ := negtypes.PinnedZones(zones, pinned)
+		if len(negZones) == 0 {
+			continue
+		}
+		unpinned := sets.NewString(zones...).Difference(sets.NewString(negZones...))
+		for _, portInfo := range portInfoMap {
+			ret[portInfo.NegName] = unpinned
+		}
+	}
+	return ret, nil
+}
+
+// DeleteNEGs deletes the NEGs with the given names in the given zones.
+func (manager *syncerManager) DeleteNEGs(negNames, zones []string) error {
+	var toDelete []zonalNEG
+	for _, name := range negNames {
+		for _, zone := range zones {
+			toDelete = append(toDelete, zonalNEG{name: name, zone: zone})
+		}
+	}
+	return manager.deleteNEGs(toDelete)
+}
+
+type zonalNEG struct {
+	name string
+	zone string
+}
+
+// deleteNEGs deletes the given NEGs. Each deletion waits for its operation to
+// complete, so NEGs are deleted concurrently to avoid serializing the
+// teardown of NEGs in many zones. The NEGs in use are unlinked from the
+// backend services of the cluster, updating each backend service once for all
+// of them, and deleted again.
+func (manager *syncerManager) deleteNEGs(toDelete []zonalNEG) error {
+	errList := &negsyncer.ErrorList{}
+	inUse := manager.deleteNEGsConcurrently(toDelete, errList)
+	if len(inUse) > 0 {
+		unlinked, err := manager.unlinkBackendServices(inUse)
+		if err != nil {
+			errList.Add(err)
+		}
+		for _, neg := range manager.deleteNEGsConcurrently(unlinked, errList) {
+			errList.Add(fmt.Errorf("failed to delete NEG %q in %q: still in use after unlinking it from the backend services", neg.name, neg.zone))
+		}
+	}
+	return utilerrors.NewAggregate(errList.List())
+}
+
+// deleteNEGsConcurrently deletes the given NEGs and adds the errors to
+// errList, except for the NEGs in use whose backend services can be unlinked,
+// which are returned.
+func (manager *syncerManager) deleteNEGsConcurrently(toDelete []zonalNEG, errList *negsyncer.ErrorList) []zonalNEG {
+	var lock sync.Mutex
+	var inUse []zonalNEG
+	workqueue.ParallelizeUntil(context.Background(), maxConcurrentNEGDeletions, len(toDelete), func(i int) {
+		neg := toDelete[i]
+		err := manager.ensureDeleteNetworkEndpointGroup(neg.name, neg.zone)
+		if utils.IsInUsedByError(err) && manager.backendServices != nil {
+			klog.V(2).Infof("NEG %q in %q is in use, unlinking it from the backend services before retrying: %v", neg.name, neg.zone, err)
+			lock.Lock()
+			defer lock.Unlock()
+			inUse = append(inUse, neg)
+			return
+		}
+		if err != nil {
+			errList.Add(fmt.Errorf("failed to delete NEG %q in %q: %v", neg.name, neg.zone, err))
+		}
+	})
+	return inUse
 }
 
 // ensureDeleteNetworkEndpointGroup ensures neg is delete from zone
 func (manager *syncerManager) ensureDeleteNetworkEndpointGroup(name, zone string) error {
-	_, err := manager.cloud.GetNetworkEndpointGroup(name, zone)
+	klog.V(2).Infof("Deleting NEG %q in %q.", name, zone)
+	err := manager.cloud.DeleteNetworkEndpointGroup(name, zone)
+	if utils.IsNotFoundError(err) {
+		klog.V(2).Infof("NEG %q in %q was already deleted.", name, zone)
+		err = nil
+	}
+	if err == nil {
+		metrics.DeleteNEG(name, zone)
+	}
+	return err
+}
+
+// unlinkBackendServices removes the given NEGs from the backends of the
+// backend services of the cluster, updating each backend service once, and
+// returns the NEGs which are no longer referenced. The backend services of the
+// cluster are named after their NEG, other backend services referencing the
+// NEGs are not modified and an error is returned, as the NEGs cannot be
+// deleted until they are unlinked by their owner.
+func (manager *syncerManager) unlinkBackendServices(negs []zonalNEG) ([]zonalNEG, error) {
+	backendServices, err := manager.backendServices.ListBackendServices()
 	if err != nil {
-		// Assume error is caused by not existing
-		return nil
+		return nil, err
 	}
-	klog.V(2).Infof("Deleting NEG %q in %q.", name, zone)
-	return manager.cloud.DeleteNetworkEndpointGroup(name, zone)
+	var errs []error
+	// referenced are the NEGs still referenced after the unlinking, with
+	// the external backend services referencing them by NEG name.
+	referenced := map[zonalNEG]bool{}
+	external := map[string]sets.String{}
+	for _, bs := range backendServices {
+		var backends []*composite.Backend
+		var removed []zonalNEG
+		for _, backend := range bs.Backends {
+			if neg, ok := negOfBackend(backend, negs); ok {
+				removed = append(removed, neg)
+				continue
+			}
+			backends = append(backends, backend)
+		}
+		if len(removed) == 0 {
+			continue
+		}
+		if !manager.namer.IsNEG(bs.Name) {
+			for _, neg := range removed {
+				referenced[neg] = true
+				if external[neg.name] == nil {
+					external[neg.name] = sets.NewString()
+				}
+				external[neg.name].Insert(bs.Name)
+			}
+			continue
+		}
+		klog.V(2).Infof("Unlinking NEGs %v from backend service %q.", removed, bs.Name)
+		bs.Backends = backends
+		if err := manager.backendServices.UpdateBackendService(bs); err != nil {
+			errs = append(errs, fmt.Errorf("failed to unlink backend service %q: %v", bs.Name, err))
+			for _, neg := range removed {
+				referenced[neg] = true
+			}
+		}
+	}
+
+	for name, bsNames := range external {
+		msg := fmt.Sprintf("NEG %q cannot be deleted as it is referenced by backend services not managed by this cluster: %s", name, strings.Join(bsNames.List(), ", "))
+		if svc := manager.negService(name); svc != nil {
+			manager.recorder.Event(svc, v1.EventTypeWarning, "NEGExternallyReferenced", msg)
+		} else {
+			klog.Warning(msg)
+		}
+		errs = append(errs, fmt.Errorf("%s", msg))
+	}
+	var unlinked []zonalNEG
+	for _, neg := range negs {
+		if !referenced[neg] {
+			unlinked = append(unlinked, neg)
+		}
+	}
+	return unlinked, utilerrors.NewAggregate(errs)
+}
+
+// negOfBackend returns the NEG among negs which is the group of the backend.
+func negOfBackend(backend *composite.Backend, negs []zonalNEG) (zonalNEG, bool) {
+	for _, neg := range negs {
+		if negtypes.IsNEGBackend(backend, neg.name, neg.zone) {
+			return neg, true
+		}
+	}
+	return zonalNEG{}, false
+}
+
+// negService returns the Service of the NEG, nil if none of the ports of the
+// Services in the cache is named after the NEG.
+func (manager *syncerManager) negService(negName string) *v1.Service {
+	for _, obj := range manager.serviceLister.List() {
+		svc, ok := obj.(*v1.Service)
+		if !ok {
+			continue
+		}
+		for _, port := range svc.Spec.Ports {
+			if manager.namer.NEG(svc.Namespace, svc.Name, port.Port) == negName {
+				return svc
+			}
+		}
+	}
+	return nil
 }
 
 // getSyncerKey encodes a service namespace, name, service port and targetPort into a string key
@@ -340,6 +620,14 @@ func getSyncerKey(namespace, name string, servicePortKey negtypes.PortInfoMapKey
 	}
 }
 
+// syncerKey returns the key of the syncer of a port of the service or
+// Istio:ServiceEntry.
+func (k serviceKey) syncerKey(servicePortKey negtypes.PortInfoMapKey, portInfo negtypes.PortInfo) negtypes.NegSyncerKey {
+	syncerKey := getSyncerKey(k.namespace, k.name, servicePortKey, portInfo)
+	syncerKey.ServiceEntry = k.serviceEntry
+	return syncerKey
+}
+
 func getServiceKey(namespace, name string) serviceKey {
 	return serviceKey{
 		namespace: namespace,
@@ -17,11 +17,14 @@ limitations under the License.
 package neg
 
 import (
+	"fmt"
+	"net/http"
 	"reflect"
 	"testing"
 	"time"
 
 	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
 	apiv1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -30,8 +33,11 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/ingress-gce/pkg/annotations"
 	backendconfigclient "k8s.io/ingress-gce/pkg/backendconfig/client/clientset/versioned/fake"
+	"k8s.io/ingress-gce/pkg/composite"
 	"k8s.io/ingress-gce/pkg/context"
+	"k8s.io/ingress-gce/pkg/neg/metrics"
 	"k8s.io/ingress-gce/pkg/neg/readiness"
 	"k8s.io/ingress-gce/pkg/neg/types"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
@@ -80,6 +86,7 @@ func NewTestSyncerManager(kubeClient kubernetes.Interface) *syncerManager {
 		context.PodInformer.GetIndexer(),
 		context.ServiceInformer.GetIndexer(),
 		context.EndpointInformer.GetIndexer(),
+		context.NodeInformer.GetIndexer(),
 		transactionSyncer,
 	)
 	manager.reflector = readiness.NewReadinessReflector(context, manager)
@@ -262,6 +269,47 @@ func TestEnsureAndStopSyncer(t *testing.T) {
 	manager.StopSyncer(svcNamespace2, svcName)
 }
 
+func TestEnsureAndStopServiceEntrySyncer(t *testing.T) {
+	t.Parallel()
+
+	manager := NewTestSyncerManager(fake.NewSimpleClientset())
+	svcPorts := negtypes.NewPortInfoMap(namespace1, name1, types.SvcPortMap{port1: targetPort1}, manager.namer, false)
+	sePorts := negtypes.NewPortInfoMapWithServiceEntry(namespace1, name1, types.SvcPortMap{port1: targetPort1}, manager.namer, map[string]string{labelKey1: labelValue1})
+	if err := manager.EnsureSyncers(namespace1, name1, svcPorts); err != nil {
+		t.Fatalf("EnsureSyncers() = %v, want nil", err)
+	}
+	if err := manager.EnsureServiceEntrySyncers(namespace1, name1, sePorts); err != nil {
+		t.Fatalf("EnsureServiceEntrySyncers() = %v, want nil", err)
+	}
+
+	// The Service and the ServiceEntry with the same name have their own NEGs.
+	svcKey := getSyncerKey(namespace1, name1, negtypes.PortInfoMapKey{ServicePort: port1}, negtypes.PortInfo{TargetPort: targetPort1})
+	seKey := svcKey
+	seKey.SubsetLabels = labelKey1 + "=" + labelValue1
+	seKey.ServiceEntry = true
+	for _, key := range []negtypes.NegSyncerKey{svcKey, seKey} {
+		if syncer, ok := manager.syncerMap[key]; !ok || syncer.IsStopped() {
+			t.Errorf("Expect syncer %v to be running", key.String())
+		}
+	}
+	wantNegName := manager.namer.NEGWithSubset(namespace1, name1, negtypes.ServiceEntrySubset, port1)
+	if got := manager.svcPortMap[serviceKey{namespace: namespace1, name: name1, serviceEntry: true}][negtypes.PortInfoMapKey{ServicePort: port1}].NegName; got != wantNegName {
+		t.Errorf("Got ServiceEntry NEG name %q, want %q", got, wantNegName)
+	}
+	if got := manager.svcPortMap[getServiceKey(namespace1, name1)][negtypes.PortInfoMapKey{ServicePort: port1}].NegName; got == wantNegName {
+		t.Errorf("Got Service NEG name %q, want a different name than the ServiceEntry NEG", got)
+	}
+
+	manager.StopServiceEntrySyncer(namespace1, name1)
+	if !manager.syncerMap[seKey].IsStopped() {
+		t.Errorf("Expect syncer %v to be stopped", seKey.String())
+	}
+	if manager.syncerMap[svcKey].IsStopped() {
+		t.Errorf("Expect syncer %v to be running", svcKey.String())
+	}
+	manager.StopSyncer(namespace1, name1)
+}
+
 func TestGarbageCollectionSyncer(t *testing.T) {
 	t.Parallel()
 
@@ -335,6 +383,286 @@ func TestGarbageCollectionNEG(t *testing.T) {
 	manager.StopSyncer(testServiceNamespace, testServiceName)
 }
 
+// failingDeleteNEGCloud fails the deletion of the NEGs in failNEGs.
+type failingDeleteNEGCloud struct {
+	negtypes.NetworkEndpointGroupCloud
+	failNEGs sets.String
+}
+
+func (f *failingDeleteNEGCloud) DeleteNetworkEndpointGroup(name string, zone string) error {
+	if f.failNEGs.Has(name) {
+		return fmt.Errorf("failed to delete NEG %q", name)
+	}
+	return f.NetworkEndpointGroupCloud.DeleteNetworkEndpointGroup(name, zone)
+}
+
+func TestGarbageCollectionNEGConcurrent(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		desc     string
+		failNEGs sets.String
+		wantErr  bool
+	}{
+		{
+			desc:     "all deletions succeed",
+			failNEGs: sets.NewString(),
+		},
+		{
+			desc:     "one deletion fails",
+			failNEGs: sets.NewString(namer_util.NewNamer(ClusterID, "").NEG("test", "test-1", 80)),
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			manager := NewTestSyncerManager(fake.NewSimpleClientset())
+			manager.cloud = &failingDeleteNEGCloud{NetworkEndpointGroupCloud: manager.cloud, failNEGs: tc.failNEGs}
+
+			for i := 0; i < 2*maxConcurrentNEGDeletions; i++ {
+				negName := manager.namer.NEG("test", fmt.Sprintf("test-%d", i), 80)
+				for _, zone := range []string{negtypes.TestZone1, negtypes.TestZone2} {
+					manager.cloud.CreateNetworkEndpointGroup(&compute.NetworkEndpointGroup{Name: negName}, zone)
+				}
+			}
+
+			err := manager.GC()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("GC() = %v, want error %v", err, tc.wantErr)
+			}
+
+			for _, zone := range []string{negtypes.TestZone1, negtypes.TestZone2} {
+				negs, _ := manager.cloud.ListNetworkEndpointGroup(zone)
+				remaining := sets.NewString()
+				for _, neg := range negs {
+					remaining.Insert(neg.Name)
+				}
+				if !remaining.Equal(tc.failNEGs) {
+					t.Errorf("Got remaining NEGs %v in zone %q, want %v", remaining.List(), zone, tc.failNEGs.List())
+				}
+			}
+		})
+	}
+}
+
+func TestGarbageCollectionUnpinnedNEG(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		desc       string
+		negZones   string
+		wantRemain []string
+	}{
+		{
+			desc:       "NEGs not pinned",
+			wantRemain: []string{negtypes.TestZone1, negtypes.TestZone2},
+		},
+		{
+			desc:       "NEGs pinned to a zone",
+			negZones:   negtypes.TestZone1,
+			wantRemain: []string{negtypes.TestZone1},
+		},
+		{
+			desc:       "NEGs pinned to unknown zones only",
+			negZones:   "unknown-zone",
+			wantRemain: []string{negtypes.TestZone1, negtypes.TestZone2},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			manager := NewTestSyncerManager(fake.NewSimpleClientset())
+			svc := &apiv1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: testServiceNamespace, Name: testServiceName}}
+			if tc.negZones != "" {
+				svc.Annotations = map[string]string{annotations.NEGZonesKey: tc.negZones}
+			}
+			manager.serviceLister.Add(svc)
+
+			negName := manager.namer.NEG(testServiceNamespace, testServiceName, 80)
+			manager.svcPortMap[getServiceKey(testServiceNamespace, testServiceName)] = negtypes.PortInfoMap{
+				negtypes.PortInfoMapKey{ServicePort: 80}: negtypes.PortInfo{TargetPort: "8080", NegName: negName},
+			}
+			for _, zone := range []string{negtypes.TestZone1, negtypes.TestZone2} {
+				manager.cloud.CreateNetworkEndpointGroup(&compute.NetworkEndpointGroup{Name: negName}, zone)
+			}
+
+			if err := manager.GC(); err != nil {
+				t.Fatalf("GC() = %v", err)
+			}
+			var remain []string
+			for _, zone := range []string{negtypes.TestZone1, negtypes.TestZone2} {
+				if _, err := manager.cloud.GetNetworkEndpointGroup(negName, zone); err == nil {
+					remain = append(remain, zone)
+				}
+			}
+			if !reflect.DeepEqual(remain, tc.wantRemain) {
+				t.Errorf("Got NEGs remaining in zones %v, want %v", remain, tc.wantRemain)
+			}
+		})
+	}
+}
+
+func TestEnsureDeleteNetworkEndpointGroupNotFound(t *testing.T) {
+	t.Parallel()
+
+	manager := NewTestSyncerManager(fake.NewSimpleClientset())
+	metrics.ObserveTruncatedEndpoints("does-not-exist", negtypes.TestZone1, 1)
+	if err := manager.ensureDeleteNetworkEndpointGroup("does-not-exist", negtypes.TestZone1); err != nil {
+		t.Errorf("ensureDeleteNetworkEndpointGroup() = %v, want nil", err)
+	}
+	if metrics.TruncatedEndpoints.DeleteLabelValues("does-not-exist", negtypes.TestZone1) {
+		t.Errorf("Got a truncated endpoints series for the deleted NEG, want none")
+	}
+}
+
+// inUseCloud is a NetworkEndpointGroupCloud failing to delete the NEGs
+// referenced by the backend services of a fakeBackendServiceCloud.
+type inUseCloud struct {
+	negtypes.NetworkEndpointGroupCloud
+	backendServices *fakeBackendServiceCloud
+}
+
+func (c *inUseCloud) DeleteNetworkEndpointGroup(name, zone string) error {
+	for _, bs := range c.backendServices.backendServices {
+		for _, backend := range bs.Backends {
+			if negtypes.IsNEGBackend(backend, name, zone) {
+				return &googleapi.Error{Code: http.StatusBadRequest, Message: fmt.Sprintf("The network endpoint group resource %q is already being used by %q", name, bs.Name)}
+			}
+		}
+	}
+	return c.NetworkEndpointGroupCloud.DeleteNetworkEndpointGroup(name, zone)
+}
+
+type fakeBackendServiceCloud struct {
+	backendServices []*composite.BackendService
+	// updates is the number of updates of the backend services.
+	updates int
+}
+
+func (f *fakeBackendServiceCloud) ListBackendServices() ([]*composite.BackendService, error) {
+	return f.backendServices, nil
+}
+
+func (f *fakeBackendServiceCloud) UpdateBackendService(bs *composite.BackendService) error {
+	f.updates++
+	for i := range f.backendServices {
+		if f.backendServices[i].Name == bs.Name {
+			f.backendServices[i] = bs
+			return nil
+		}
+	}
+	return negtypes.NotFoundError
+}
+
+func TestDeleteNEGsInUse(t *testing.T) {
+	t.Parallel()
+
+	negURL := func(name, zone string) string {
+		return fmt.Sprintf("https://www.googleapis.com/compute/beta/projects/p/zones/%s/networkEndpointGroups/%s", zone, name)
+	}
+
+	testCases := []struct {
+		desc string
+		// owned is true if the backend service referencing the NEG belongs
+		// to the cluster.
+		owned bool
+		// zones are the zones of the NEG being deleted.
+		zones       []string
+		wantErr     bool
+		wantEvents  int
+		wantUpdates int
+		wantGroups  func(negName, otherNEG string) []string
+	}{
+		{
+			desc:        "NEG referenced by a backend service of the cluster",
+			owned:       true,
+			zones:       []string{negtypes.TestZone1},
+			wantUpdates: 1,
+			wantGroups: func(negName, otherNEG string) []string {
+				return []string{negURL(negName, negtypes.TestZone2), negURL(otherNEG, negtypes.TestZone1)}
+			},
+		},
+		{
+			desc:        "NEGs of several zones are unlinked with a single update",
+			owned:       true,
+			zones:       []string{negtypes.TestZone1, negtypes.TestZone2},
+			wantUpdates: 1,
+			wantGroups: func(negName, otherNEG string) []string {
+				return []string{negURL(otherNEG, negtypes.TestZone1)}
+			},
+		},
+		{
+			desc:       "NEG referenced by an external backend service",
+			zones:      []string{negtypes.TestZone1},
+			wantErr:    true,
+			wantEvents: 1,
+			wantGroups: func(negName, otherNEG string) []string {
+				return []string{negURL(negName, negtypes.TestZone1), negURL(negName, negtypes.TestZone2), negURL(otherNEG, negtypes.TestZone1)}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			manager := NewTestSyncerManager(fake.NewSimpleClientset())
+			recorder := record.NewFakeRecorder(10)
+			manager.recorder = recorder
+			negName := manager.namer.NEG(testServiceNamespace, testServiceName, 80)
+			otherNEG := manager.namer.NEG(testServiceNamespace, testServiceName, 443)
+			manager.serviceLister.Add(&apiv1.Service{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testServiceNamespace, Name: testServiceName},
+				Spec:       apiv1.ServiceSpec{Ports: []apiv1.ServicePort{{Port: 80}}},
+			})
+
+			bsName := "external-backend-service"
+			if tc.owned {
+				bsName = negName
+			}
+			backendServices := &fakeBackendServiceCloud{backendServices: []*composite.BackendService{{
+				Name: bsName,
+				Backends: []*composite.Backend{
+					{Group: negURL(negName, negtypes.TestZone1)},
+					{Group: negURL(negName, negtypes.TestZone2)},
+					{Group: negURL(otherNEG, negtypes.TestZone1)},
+				},
+			}}}
+			manager.backendServices = backendServices
+			manager.cloud = &inUseCloud{NetworkEndpointGroupCloud: manager.cloud, backendServices: backendServices}
+			var toDelete []zonalNEG
+			for _, zone := range tc.zones {
+				manager.cloud.CreateNetworkEndpointGroup(&compute.NetworkEndpointGroup{Name: negName}, zone)
+				toDelete = append(toDelete, zonalNEG{name: negName, zone: zone})
+			}
+
+			err := manager.deleteNEGs(toDelete)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("deleteNEGs() = %v, want error: %t", err, tc.wantErr)
+			}
+			for _, zone := range tc.zones {
+				_, err = manager.cloud.GetNetworkEndpointGroup(negName, zone)
+				if deleted := err != nil; deleted == tc.wantErr {
+					t.Errorf("Got NEG in %q deleted: %t, want %t", zone, deleted, !tc.wantErr)
+				}
+			}
+			if got := len(recorder.Events); got != tc.wantEvents {
+				t.Errorf("Got %d events, want %d", got, tc.wantEvents)
+			}
+			if backendServices.updates != tc.wantUpdates {
+				t.Errorf("Got %d backend service updates, want %d", backendServices.updates, tc.wantUpdates)
+			}
+
+			var groups []string
+			for _, backend := range backendServices.backendServices[0].Backends {
+				groups = append(groups, backend.Group)
+			}
+			if wantGroups := tc.wantGroups(negName, otherNEG); !reflect.DeepEqual(groups, wantGroups) {
+				t.Errorf("Got backends %v, want %v", groups, wantGroups)
+			}
+		})
+	}
+}
+
 func TestReadinessGateEnabledNegs(t *testing.T) {
 	t.Parallel()
 
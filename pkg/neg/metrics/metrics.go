@@ -28,6 +28,8 @@ const (
 	negControllerSubsystem = "neg_controller"
 	syncLatencyKey         = "neg_sync_duration_seconds"
 	lastSyncTimestampKey   = "sync_timestamp"
+	truncatedEndpointsKey  = "neg_truncated_endpoints"
+	operationErrorsKey     = "neg_operation_errors"
 
 	resultSuccess = "success"
 	resultError   = "error"
@@ -64,6 +66,30 @@ var (
 		},
 		[]string{},
 	)
+
+	// TruncatedEndpoints is the number of endpoints left out of a NEG in a
+	// zone because they exceed the maximum number of endpoints per NEG.
+	TruncatedEndpoints = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.GLBC_NAMESPACE,
+			Subsystem: negControllerSubsystem,
+			Name:      truncatedEndpointsKey,
+			Help:      "Number of endpoints left out of a NEG because they exceed the maximum number of endpoints per NEG",
+		},
+		[]string{"neg", "zone"},
+	)
+
+	// OperationErrors is the number of failed calls attaching or detaching
+	// endpoints, by the type of their error.
+	OperationErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.GLBC_NAMESPACE,
+			Subsystem: negControllerSubsystem,
+			Name:      operationErrorsKey,
+			Help:      "Number of failed calls attaching or detaching NEG endpoints, by reason",
+		},
+		[]string{"operation", "reason"},
+	)
 )
 
 var register sync.Once
@@ -72,6 +98,8 @@ func RegisterMetrics() {
 	register.Do(func() {
 		prometheus.MustRegister(SyncLatency)
 		prometheus.MustRegister(LastSyncTimestamp)
+		prometheus.MustRegister(TruncatedEndpoints)
+		prometheus.MustRegister(OperationErrors)
 	})
 }
 
@@ -83,3 +111,18 @@ func ObserveNegSync(negName string, syncType syncType, err error, start time.Tim
 	}
 	SyncLatency.WithLabelValues(negName, string(syncType), result).Observe(time.Since(start).Seconds())
 }
+
+// ObserveTruncatedEndpoints publishes the number of endpoints left out of the
+// NEG in the zone, removing the series of the zone if there are none.
+func ObserveTruncatedEndpoints(negName, zone string, count int) {
+	if count == 0 {
+		TruncatedEndpoints.DeleteLabelValues(negName, zone)
+		return
+	}
+	TruncatedEndpoints.WithLabelValues(negName, zone).Set(float64(count))
+}
+
+// DeleteNEG removes the metrics of the NEG deleted in the zone.
+func DeleteNEG(negName, zone string) {
+	TruncatedEndpoints.DeleteLabelValues(negName, zone)
+}
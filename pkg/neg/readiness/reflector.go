@@ -213,6 +213,7 @@ func (r *readinessReflector) SyncPod(pod *v1.Pod) {
 
 	if !needToProcess(pod) {
 		klog.V(6).Infof("Skip processing pod %q", key)
+		return
 	}
 	r.queue.Add(key)
 }
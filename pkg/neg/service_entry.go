@@ -0,0 +1,209 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package neg
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	apimachinerytypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/annotations"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/klog"
+)
+
+// Istio:ServiceEntries with a workload selector get a NEG per port, whose
+// endpoints are the pods of the namespace matching the selector. This lets
+// load balancers route to mesh workloads which have no Service.
+
+func (c *Controller) serviceEntryWorker() {
+	for {
+		func() {
+			key, quit := c.serviceEntryQueue.Get()
+			if quit {
+				return
+			}
+			defer c.serviceEntryQueue.Done(key)
+			err := c.processServiceEntry(key.(string))
+			if err == nil {
+				c.serviceEntryQueue.Forget(key)
+				return
+			}
+			klog.Errorf("error processing Istio:ServiceEntry %q: %v", key, err)
+			c.serviceEntryQueue.AddRateLimited(key)
+		}()
+	}
+}
+
+// processServiceEntry ensures the NEGs of a ServiceEntry, and signals them
+// to sync as its pods changed.
+func (c *Controller) processServiceEntry(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	obj, exists, err := c.serviceEntryLister.GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		c.manager.StopServiceEntrySyncer(namespace, name)
+		return nil
+	}
+	seus := obj.(*unstructured.Unstructured)
+	portInfoMap, err := c.serviceEntryPortInfoMap(seus)
+	if err != nil {
+		return err
+	}
+	if len(portInfoMap) == 0 {
+		c.manager.StopServiceEntrySyncer(namespace, name)
+	} else {
+		if err := c.checkQuota(seus, portInfoMap); err != nil {
+			return err
+		}
+		if err := c.manager.EnsureServiceEntrySyncers(namespace, name, portInfoMap); err != nil {
+			return err
+		}
+		c.manager.SyncServiceEntry(namespace, name)
+	}
+	return c.syncServiceEntryNegStatusAnnotation(seus, portInfoMap)
+}
+
+// serviceEntryPortInfoMap returns the ports of the ServiceEntry which need
+// NEGs, none if it does not have a workload selector.
+func (c *Controller) serviceEntryPortInfoMap(seus *unstructured.Unstructured) (negtypes.PortInfoMap, error) {
+	se, err := castToServiceEntry(seus)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert Istio:ServiceEntry %s/%s: %v", seus.GetNamespace(), seus.GetName(), err)
+	}
+	workloadLabels := se.workloadLabels()
+	if workloadLabels == nil {
+		return negtypes.PortInfoMap{}, nil
+	}
+	return negtypes.NewPortInfoMapWithServiceEntry(seus.GetNamespace(), seus.GetName(), se.svcPortMap(), c.namer, workloadLabels), nil
+}
+
+// syncServiceEntryNegStatusAnnotation syncs the NEG status annotation of the
+// ServiceEntry, which has the same format as the one of Services.
+func (c *Controller) syncServiceEntryNegStatusAnnotation(seus *unstructured.Unstructured, portMap negtypes.PortInfoMap) error {
+	existing, hasAnnotation := seus.GetAnnotations()[annotations.NEGStatusKey]
+	var value interface{}
+	if len(portMap) == 0 {
+		if !hasAnnotation {
+			return nil
+		}
+		klog.V(2).Infof("Removing NEG status annotation from Istio:ServiceEntry %s/%s", seus.GetNamespace(), seus.GetName())
+	} else {
+		zones, err := c.zoneGetter.ListZones()
+		if err != nil {
+			return err
+		}
+		sort.Strings(zones)
+		negStatus := annotations.NewNegStatus(zones, portMap.ToPortNegMap())
+		negStatus.NetworkEndpointType = string(negtypes.VmIpPortEndpointType)
+		negStatus.TargetPorts = portMap.ToPortTargetPortMap()
+		negStatus.Subnetwork = c.subnetworkURL
+		annotation, err := negStatus.Marshal()
+		if err != nil {
+			return err
+		}
+		if hasAnnotation && existing == annotation {
+			return nil
+		}
+		klog.V(2).Infof("Updating NEG visibility annotation %q on Istio:ServiceEntry %s/%s.", annotation, seus.GetNamespace(), seus.GetName())
+		value = annotation
+	}
+	// A null value removes the annotation.
+	patchBytes, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{annotations.NEGStatusKey: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.serviceEntryClient.Namespace(seus.GetNamespace()).Patch(seus.GetName(), apimachinerytypes.MergePatchType, patchBytes, metav1.PatchOptions{})
+	return err
+}
+
+func (c *Controller) enqueueServiceEntry(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		klog.Errorf("Failed to generate Istio:ServiceEntry key: %v", err)
+		return
+	}
+	c.serviceEntryQueue.Add(key)
+}
+
+// enqueuePodServiceEntries enqueues the ServiceEntries whose workload
+// selector matches one of the given pod labels.
+func (c *Controller) enqueuePodServiceEntries(namespace string, podLabels ...map[string]string) {
+	objs, err := c.serviceEntryLister.ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil {
+		klog.Errorf("Failed to list Istio:ServiceEntries in namespace %q: %v", namespace, err)
+		return
+	}
+	for _, obj := range objs {
+		seus, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		se, err := castToServiceEntry(seus)
+		if err != nil || se.workloadLabels() == nil {
+			continue
+		}
+		selector := labels.SelectorFromSet(se.workloadLabels())
+		for _, l := range podLabels {
+			if selector.Matches(labels.Set(l)) {
+				c.enqueueServiceEntry(seus)
+				break
+			}
+		}
+	}
+}
+
+// podServiceEntryHandlers enqueue the ServiceEntries selecting the pods which
+// changed.
+func (c *Controller) podServiceEntryHandlers() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			pod := obj.(*apiv1.Pod)
+			c.enqueuePodServiceEntries(pod.Namespace, pod.Labels)
+		},
+		UpdateFunc: func(old, cur interface{}) {
+			oldPod, curPod := old.(*apiv1.Pod), cur.(*apiv1.Pod)
+			if !podEndpointChanged(oldPod, curPod) {
+				return
+			}
+			c.enqueuePodServiceEntries(curPod.Namespace, oldPod.Labels, curPod.Labels)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*apiv1.Pod); ok {
+				c.enqueuePodServiceEntries(pod.Namespace, pod.Labels)
+			}
+		},
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package neg
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+)
+
+func newServiceEntry(namespace, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	se := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.istio.io/v1alpha3",
+		"kind":       "ServiceEntry",
+		"spec":       spec,
+	}}
+	se.SetNamespace(namespace)
+	se.SetName(name)
+	return se
+}
+
+func TestServiceEntryPortInfoMap(t *testing.T) {
+	controller := newTestController(fake.NewSimpleClientset())
+	defer controller.stop()
+
+	ports := []interface{}{
+		map[string]interface{}{"number": int64(80), "name": "http", "targetPort": int64(8080)},
+		map[string]interface{}{"number": int64(443), "name": "https"},
+	}
+	for _, tc := range []struct {
+		desc string
+		spec map[string]interface{}
+		want negtypes.PortInfoMap
+	}{
+		{
+			desc: "no workload selector",
+			spec: map[string]interface{}{"hosts": []interface{}{"vm.example.com"}, "ports": ports},
+			want: negtypes.PortInfoMap{},
+		},
+		{
+			desc: "workload selector",
+			spec: map[string]interface{}{
+				"hosts":            []interface{}{"vm.example.com"},
+				"ports":            ports,
+				"workloadSelector": map[string]interface{}{"labels": map[string]interface{}{"app": "vm"}},
+			},
+			want: negtypes.NewPortInfoMapWithServiceEntry(testServiceNamespace, "se", negtypes.SvcPortMap{80: "8080", 443: "443"}, controller.namer, map[string]string{"app": "vm"}),
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := controller.serviceEntryPortInfoMap(newServiceEntry(testServiceNamespace, "se", tc.spec))
+			if err != nil {
+				t.Fatalf("serviceEntryPortInfoMap() = %v, want nil", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("serviceEntryPortInfoMap() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEnqueuePodServiceEntries(t *testing.T) {
+	controller := newTestController(fake.NewSimpleClientset())
+	defer controller.stop()
+	controller.serviceEntryLister = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	selector := map[string]interface{}{"labels": map[string]interface{}{"app": "vm"}}
+	controller.serviceEntryLister.Add(newServiceEntry(testServiceNamespace, "selected", map[string]interface{}{"workloadSelector": selector}))
+	controller.serviceEntryLister.Add(newServiceEntry(testServiceNamespace, "no-selector", map[string]interface{}{}))
+	controller.serviceEntryLister.Add(newServiceEntry("other", "other-namespace", map[string]interface{}{"workloadSelector": selector}))
+
+	controller.enqueuePodServiceEntries(testServiceNamespace, map[string]string{"app": "other"}, map[string]string{"app": "vm", "version": "v1"})
+	if got := controller.serviceEntryQueue.Len(); got != 1 {
+		t.Fatalf("Got %d ServiceEntries enqueued, want 1", got)
+	}
+	key, _ := controller.serviceEntryQueue.Get()
+	if key != testServiceNamespace+"/selected" {
+		t.Errorf("Got ServiceEntry %q enqueued, want %q", key, testServiceNamespace+"/selected")
+	}
+	controller.serviceEntryQueue.Done(key)
+
+	controller.enqueuePodServiceEntries(testServiceNamespace, map[string]string{"app": "other"})
+	if got := controller.serviceEntryQueue.Len(); got != 0 {
+		t.Errorf("Got %d ServiceEntries enqueued for a pod selected by none, want 0", got)
+	}
+}
@@ -31,6 +31,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/ingress-gce/pkg/flags"
 	"k8s.io/ingress-gce/pkg/neg/metrics"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
 	"k8s.io/klog"
@@ -58,9 +59,15 @@ type batchSyncer struct {
 	syncCh         chan interface{}
 	lastRetryDelay time.Duration
 	retryCount     int
+
+	// limiter limits the number of syncers syncing at the same time, and
+	// workers the number of operations of the syncer attaching or detaching
+	// endpoints at the same time.
+	limiter Limiter
+	workers Limiter
 }
 
-func NewBatchSyncer(svcPort negtypes.NegSyncerKey, networkEndpointGroupName string, recorder record.EventRecorder, cloud negtypes.NetworkEndpointGroupCloud, zoneGetter negtypes.ZoneGetter, serviceLister cache.Indexer, endpointLister cache.Indexer, podLister cache.Indexer) *batchSyncer {
+func NewBatchSyncer(svcPort negtypes.NegSyncerKey, networkEndpointGroupName string, recorder record.EventRecorder, cloud negtypes.NetworkEndpointGroupCloud, zoneGetter negtypes.ZoneGetter, serviceLister cache.Indexer, endpointLister cache.Indexer, podLister cache.Indexer, limiter Limiter) *batchSyncer {
 	klog.V(2).Infof("New syncer for service %s/%s Port %s NEG %q", svcPort.Namespace, svcPort.Name, svcPort.TargetPort, networkEndpointGroupName)
 	return &batchSyncer{
 		NegSyncerKey:   svcPort,
@@ -76,6 +83,8 @@ func NewBatchSyncer(svcPort negtypes.NegSyncerKey, networkEndpointGroupName stri
 		clock:          clock.RealClock{},
 		lastRetryDelay: time.Duration(0),
 		retryCount:     0,
+		limiter:        limiter,
+		workers:        NewLimiter(flags.F.NegSyncerWorkers),
 	}
 }
 
@@ -101,7 +110,9 @@ func (s *batchSyncer) Start() error {
 		for {
 			// equivalent to never retry
 			retryCh := make(<-chan time.Time)
+			s.limiter.Acquire()
 			err := s.sync()
+			s.limiter.Release()
 			if err != nil {
 				retryMesg := ""
 				if s.retryCount > maxRetries {
@@ -207,6 +218,19 @@ func (s *batchSyncer) sync() (err error) {
 	if err != nil {
 		return err
 	}
+	// The endpoints in the zones the NEGs are not pinned to are left out.
+	zones, pinned, err := negZones(s.NegSyncerKey, s.zoneGetter, s.serviceLister)
+	if err != nil {
+		return err
+	}
+	if pinned {
+		negZones := sets.NewString(zones...)
+		for zone := range targetMap {
+			if !negZones.Has(zone) {
+				delete(targetMap, zone)
+			}
+		}
+	}
 
 	currentMap, err := s.retrieveExistingZoneNetworkEndpointMap()
 	if err != nil {
@@ -224,15 +248,14 @@ func (s *batchSyncer) sync() (err error) {
 
 // ensureNetworkEndpointGroups ensures negs are created in the related zones.
 func (s *batchSyncer) ensureNetworkEndpointGroups() error {
-	var err error
-	zones, err := s.zoneGetter.ListZones()
+	zones, _, err := negZones(s.NegSyncerKey, s.zoneGetter, s.serviceLister)
 	if err != nil {
 		return err
 	}
 
 	var errList []error
 	for _, zone := range zones {
-		if err := ensureNetworkEndpointGroup(s.Namespace, s.Name, s.negName, zone, s.NegSyncerKey.String(), s.cloud, s.serviceLister, s.recorder); err != nil {
+		if err := ensureNetworkEndpointGroup(s.Namespace, s.Name, s.negName, zone, s.NegSyncerKey.String(), s.cloud, nil, s.serviceLister, s.recorder); err != nil {
 			errList = append(errList, err)
 		}
 	}
@@ -301,7 +324,7 @@ func (s *batchSyncer) toZoneNetworkEndpointMap(endpoints *apiv1.Endpoints, subse
 // retrieveExistingZoneNetworkEndpointMap lists existing network endpoints in the neg and return the zone and endpoints map
 // TODO: migrate to use the util function instead
 func (s *batchSyncer) retrieveExistingZoneNetworkEndpointMap() (map[string]sets.String, error) {
-	zones, err := s.zoneGetter.ListZones()
+	zones, _, err := negZones(s.NegSyncerKey, s.zoneGetter, s.serviceLister)
 	if err != nil {
 		return nil, err
 	}
@@ -413,7 +436,9 @@ func (s *batchSyncer) detachNetworkEndpoints(wg *sync.WaitGroup, zone string, ne
 
 func (s *batchSyncer) operationInternal(wg *sync.WaitGroup, zone string, networkEndpoints []*compute.NetworkEndpoint, errList *ErrorList, syncFunc func(name, zone string, endpoints []*compute.NetworkEndpoint) error, operationName string) {
 	defer wg.Done()
+	s.workers.Acquire()
 	err := syncFunc(s.negName, zone, networkEndpoints)
+	s.workers.Release()
 	if err != nil {
 		errList.Add(err)
 	}
@@ -421,7 +446,8 @@ func (s *batchSyncer) operationInternal(wg *sync.WaitGroup, zone string, network
 		if err == nil {
 			s.recorder.Eventf(svc, apiv1.EventTypeNormal, operationName, "%s %d network endpoint(s) (NEG %q in zone %q)", operationName, len(networkEndpoints), s.negName, zone)
 		} else {
-			s.recorder.Eventf(svc, apiv1.EventTypeWarning, operationName+"Failed", "Failed to %s %d network endpoint(s) (NEG %q in zone %q): %v", operationName, len(networkEndpoints), s.negName, zone, err)
+			reason, msg := operationFailedEvent(operationName, len(networkEndpoints), s.negName, zone, err)
+			s.recorder.Event(svc, apiv1.EventTypeWarning, reason, msg)
 		}
 	}
 }
@@ -66,7 +66,8 @@ func NewTestSyncer() *batchSyncer {
 		negtypes.NewFakeZoneGetter(),
 		context.ServiceInformer.GetIndexer(),
 		context.EndpointInformer.GetIndexer(),
-		context.PodInformer.GetIndexer())
+		context.PodInformer.GetIndexer(),
+		nil)
 }
 
 func TestStartAndStopSyncer(t *testing.T) {
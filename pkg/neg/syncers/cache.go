@@ -0,0 +1,99 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncers
+
+import (
+	"time"
+
+	"google.golang.org/api/compute/v1"
+	"k8s.io/client-go/tools/cache"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+)
+
+// cachedNEG is a NEG cached by zone and name.
+type cachedNEG struct {
+	key string
+	neg *compute.NetworkEndpointGroup
+}
+
+// cachingCloud is a NetworkEndpointGroupCloud caching the NEGs returned by
+// GetNetworkEndpointGroup until they expire, or a write to the NEG
+// invalidates them.
+type cachingCloud struct {
+	negtypes.NetworkEndpointGroupCloud
+	negs cache.Store
+}
+
+// NewCachingCloud returns a NetworkEndpointGroupCloud which caches the NEGs
+// returned by cloud for ttl.
+func NewCachingCloud(cloud negtypes.NetworkEndpointGroupCloud, ttl time.Duration) negtypes.NetworkEndpointGroupCloud {
+	return &cachingCloud{
+		NetworkEndpointGroupCloud: cloud,
+		negs: cache.NewTTLStore(func(obj interface{}) (string, error) {
+			return obj.(*cachedNEG).key, nil
+		}, ttl),
+	}
+}
+
+func negCacheKey(name, zone string) string {
+	return zone + "/" + name
+}
+
+// GetNetworkEndpointGroup implements NetworkEndpointGroupCloud.
+func (c *cachingCloud) GetNetworkEndpointGroup(name string, zone string) (*compute.NetworkEndpointGroup, error) {
+	key := negCacheKey(name, zone)
+	if item, ok, err := c.negs.GetByKey(key); err == nil && ok {
+		neg := *item.(*cachedNEG).neg
+		return &neg, nil
+	}
+	neg, err := c.NetworkEndpointGroupCloud.GetNetworkEndpointGroup(name, zone)
+	if err != nil {
+		return nil, err
+	}
+	cached := *neg
+	c.negs.Add(&cachedNEG{key: key, neg: &cached})
+	return neg, nil
+}
+
+// CreateNetworkEndpointGroup implements NetworkEndpointGroupCloud.
+func (c *cachingCloud) CreateNetworkEndpointGroup(neg *compute.NetworkEndpointGroup, zone string) error {
+	defer c.invalidate(neg.Name, zone)
+	return c.NetworkEndpointGroupCloud.CreateNetworkEndpointGroup(neg, zone)
+}
+
+// DeleteNetworkEndpointGroup implements NetworkEndpointGroupCloud.
+func (c *cachingCloud) DeleteNetworkEndpointGroup(name string, zone string) error {
+	defer c.invalidate(name, zone)
+	return c.NetworkEndpointGroupCloud.DeleteNetworkEndpointGroup(name, zone)
+}
+
+// AttachNetworkEndpoints implements NetworkEndpointGroupCloud.
+func (c *cachingCloud) AttachNetworkEndpoints(name, zone string, endpoints []*compute.NetworkEndpoint) error {
+	defer c.invalidate(name, zone)
+	return c.NetworkEndpointGroupCloud.AttachNetworkEndpoints(name, zone, endpoints)
+}
+
+// DetachNetworkEndpoints implements NetworkEndpointGroupCloud.
+func (c *cachingCloud) DetachNetworkEndpoints(name, zone string, endpoints []*compute.NetworkEndpoint) error {
+	defer c.invalidate(name, zone)
+	return c.NetworkEndpointGroupCloud.DetachNetworkEndpoints(name, zone, endpoints)
+}
+
+// invalidate removes the cached NEG after a write to it.
+func (c *cachingCloud) invalidate(name, zone string) {
+	c.negs.Delete(&cachedNEG{key: negCacheKey(name, zone)})
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncers
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+)
+
+// countingCloud counts the GetNetworkEndpointGroup calls.
+type countingCloud struct {
+	negtypes.NetworkEndpointGroupCloud
+	gets int
+}
+
+func (c *countingCloud) GetNetworkEndpointGroup(name string, zone string) (*compute.NetworkEndpointGroup, error) {
+	c.gets++
+	return c.NetworkEndpointGroupCloud.GetNetworkEndpointGroup(name, zone)
+}
+
+func TestCachingCloud(t *testing.T) {
+	counter := &countingCloud{NetworkEndpointGroupCloud: negtypes.NewFakeNetworkEndpointGroupCloud("test-subnetwork", "test-network")}
+	cloud := NewCachingCloud(counter, time.Hour)
+
+	if err := cloud.CreateNetworkEndpointGroup(&compute.NetworkEndpointGroup{Name: "neg", Description: "created"}, "zone1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		desc     string
+		write    func() error
+		wantGets int
+	}{
+		{desc: "first get", wantGets: 1},
+		{desc: "cached", wantGets: 1},
+		{desc: "invalidated by attach", write: func() error {
+			return cloud.AttachNetworkEndpoints("neg", "zone1", testEndpoints(0, 1))
+		}, wantGets: 2},
+		{desc: "cached after attach", wantGets: 2},
+		{desc: "other NEG", write: func() error {
+			return cloud.DetachNetworkEndpoints("other", "zone1", testEndpoints(0, 1))
+		}, wantGets: 2},
+	} {
+		if tc.write != nil {
+			tc.write()
+		}
+		if _, err := cloud.GetNetworkEndpointGroup("neg", "zone1"); err != nil {
+			t.Fatalf("%s: GetNetworkEndpointGroup() = %v", tc.desc, err)
+		}
+		if counter.gets != tc.wantGets {
+			t.Errorf("%s: got %d calls, want %d", tc.desc, counter.gets, tc.wantGets)
+		}
+	}
+	// The cached NEG is not changed by the callers.
+	neg, _ := cloud.GetNetworkEndpointGroup("neg", "zone1")
+	neg.Description = "changed"
+	if neg, _ := cloud.GetNetworkEndpointGroup("neg", "zone1"); neg.Description != "created" {
+		t.Errorf("Got cached NEG with description %q, want %q", neg.Description, "created")
+	}
+
+	if err := cloud.DeleteNetworkEndpointGroup("neg", "zone1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cloud.GetNetworkEndpointGroup("neg", "zone1"); err == nil {
+		t.Errorf("GetNetworkEndpointGroup() = nil after the NEG was deleted, want error")
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncers
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/klog"
+)
+
+// coalesceKey identifies the calls which can be coalesced: the attach or
+// detach calls of the same NEG in the same zone.
+type coalesceKey struct {
+	name   string
+	zone   string
+	detach bool
+}
+
+// coalescedCall is a call collecting the endpoints of the calls issued
+// during its window. All the callers get its error.
+type coalescedCall struct {
+	endpoints []*compute.NetworkEndpoint
+	seen      map[negtypes.NetworkEndpoint]bool
+	callers   int
+	done      chan struct{}
+	err       error
+}
+
+func (c *coalescedCall) add(endpoints []*compute.NetworkEndpoint) {
+	for _, ep := range endpoints {
+		key := negtypes.NetworkEndpoint{IP: ep.IpAddress, Node: ep.Instance, Port: strconv.FormatInt(ep.Port, 10)}
+		if c.seen[key] {
+			continue
+		}
+		c.seen[key] = true
+		c.endpoints = append(c.endpoints, ep)
+	}
+	c.callers++
+}
+
+// coalescingCloud is a NetworkEndpointGroupCloud coalescing the attach and
+// detach calls of all the syncers for the same NEG, zone and operation
+// issued within a window into a single call, up to the maximum number of
+// endpoints per call.
+type coalescingCloud struct {
+	negtypes.NetworkEndpointGroupCloud
+	window time.Duration
+
+	lock  sync.Mutex
+	calls map[coalesceKey]*coalescedCall
+}
+
+// NewCoalescingCloud returns a NetworkEndpointGroupCloud which delays the
+// attach and detach calls of cloud by window, to coalesce those for the same
+// NEG, zone and operation.
+func NewCoalescingCloud(cloud negtypes.NetworkEndpointGroupCloud, window time.Duration) negtypes.NetworkEndpointGroupCloud {
+	return &coalescingCloud{
+		NetworkEndpointGroupCloud: cloud,
+		window:                    window,
+		calls:                     map[coalesceKey]*coalescedCall{},
+	}
+}
+
+// AttachNetworkEndpoints implements NetworkEndpointGroupCloud.
+func (c *coalescingCloud) AttachNetworkEndpoints(name, zone string, endpoints []*compute.NetworkEndpoint) error {
+	return c.do(coalesceKey{name: name, zone: zone}, endpoints)
+}
+
+// DetachNetworkEndpoints implements NetworkEndpointGroupCloud.
+func (c *coalescingCloud) DetachNetworkEndpoints(name, zone string, endpoints []*compute.NetworkEndpoint) error {
+	return c.do(coalesceKey{name: name, zone: zone, detach: true}, endpoints)
+}
+
+// do adds the endpoints to the open call of key if they fit, or else opens
+// a new call, and returns the error of the call once it is issued.
+func (c *coalescingCloud) do(key coalesceKey, endpoints []*compute.NetworkEndpoint) error {
+	c.lock.Lock()
+	if call, ok := c.calls[key]; ok && len(call.endpoints)+len(endpoints) <= MAX_NETWORK_ENDPOINTS_PER_BATCH {
+		call.add(endpoints)
+		c.lock.Unlock()
+		<-call.done
+		return call.err
+	}
+	// A full call is issued at the end of its window by its own caller.
+	call := &coalescedCall{seen: map[negtypes.NetworkEndpoint]bool{}, done: make(chan struct{})}
+	call.add(endpoints)
+	c.calls[key] = call
+	c.lock.Unlock()
+
+	time.Sleep(c.window)
+
+	c.lock.Lock()
+	if c.calls[key] == call {
+		delete(c.calls, key)
+	}
+	c.lock.Unlock()
+	if call.callers > 1 {
+		klog.V(4).Infof("Coalesced %d calls with %d endpoint(s) for NEG %s in zone %s", call.callers, len(call.endpoints), key.name, key.zone)
+	}
+	if key.detach {
+		call.err = c.NetworkEndpointGroupCloud.DetachNetworkEndpoints(key.name, key.zone, call.endpoints)
+	} else {
+		call.err = c.NetworkEndpointGroupCloud.AttachNetworkEndpoints(key.name, key.zone, call.endpoints)
+	}
+	close(call.done)
+	return call.err
+}
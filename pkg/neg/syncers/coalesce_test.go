@@ -0,0 +1,99 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncers
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+)
+
+// recordingCloud records the number of endpoints of each attach and detach
+// call.
+type recordingCloud struct {
+	negtypes.NetworkEndpointGroupCloud
+
+	lock  sync.Mutex
+	calls []string
+}
+
+func (c *recordingCloud) record(op, name, zone string, endpoints []*compute.NetworkEndpoint) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.calls = append(c.calls, fmt.Sprintf("%s %s/%s %d", op, zone, name, len(endpoints)))
+	return nil
+}
+
+func (c *recordingCloud) AttachNetworkEndpoints(name, zone string, endpoints []*compute.NetworkEndpoint) error {
+	return c.record("attach", name, zone, endpoints)
+}
+
+func (c *recordingCloud) DetachNetworkEndpoints(name, zone string, endpoints []*compute.NetworkEndpoint) error {
+	return c.record("detach", name, zone, endpoints)
+}
+
+func testEndpoints(from, to int) []*compute.NetworkEndpoint {
+	var endpoints []*compute.NetworkEndpoint
+	for i := from; i < to; i++ {
+		endpoints = append(endpoints, &compute.NetworkEndpoint{IpAddress: fmt.Sprintf("10.0.%d.%d", i/256, i%256), Port: 80, Instance: "instance"})
+	}
+	return endpoints
+}
+
+func TestCoalescingCloud(t *testing.T) {
+	recorder := &recordingCloud{}
+	cloud := NewCoalescingCloud(recorder, 50*time.Millisecond)
+
+	var wg sync.WaitGroup
+	call := func(f func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := f(); err != nil {
+				t.Errorf("Got error %v, want nil", err)
+			}
+		}()
+	}
+	call(func() error { return cloud.AttachNetworkEndpoints("neg", "zone1", testEndpoints(0, 10)) })
+	call(func() error { return cloud.AttachNetworkEndpoints("neg", "zone1", testEndpoints(5, 20)) })
+	call(func() error { return cloud.AttachNetworkEndpoints("neg", "zone2", testEndpoints(0, 10)) })
+	call(func() error { return cloud.DetachNetworkEndpoints("neg", "zone1", testEndpoints(20, 30)) })
+	call(func() error { return cloud.AttachNetworkEndpoints("other", "zone1", testEndpoints(0, 10)) })
+	// Calls do not exceed the maximum number of endpoints.
+	call(func() error { return cloud.DetachNetworkEndpoints("big", "zone1", testEndpoints(0, 300)) })
+	call(func() error { return cloud.DetachNetworkEndpoints("big", "zone1", testEndpoints(300, 600)) })
+	wg.Wait()
+
+	sort.Strings(recorder.calls)
+	want := []string{
+		"attach zone1/neg 20",
+		"attach zone1/other 10",
+		"attach zone2/neg 10",
+		"detach zone1/big 300",
+		"detach zone1/big 300",
+		"detach zone1/neg 10",
+	}
+	if !reflect.DeepEqual(recorder.calls, want) {
+		t.Errorf("Got calls %v, want %v", recorder.calls, want)
+	}
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/klog"
+)
+
+// DefaultEndpointsCalculator is the name of the EndpointsCalculator which
+// computes the network endpoints from the Endpoints of the service.
+const DefaultEndpointsCalculator = "endpoints"
+
+// ServiceEntryEndpointsCalculator is the name of the EndpointsCalculator which
+// computes the network endpoints of an Istio:ServiceEntry from the pods
+// matching its workload selector.
+const ServiceEntryEndpointsCalculator = "serviceentry"
+
+// EndpointsCalculatorParams holds the syncer key and the listers available to
+// an EndpointsCalculator.
+type EndpointsCalculatorParams struct {
+	Key            negtypes.NegSyncerKey
+	ZoneGetter     negtypes.ZoneGetter
+	PodLister      cache.Indexer
+	ServiceLister  cache.Indexer
+	EndpointLister cache.Indexer
+}
+
+// EndpointsCalculatorFactory creates the EndpointsCalculator of a syncer.
+//
+// Custom endpoint sources are not watched by the NEG controller. They must
+// trigger syncs for the affected services through NegSyncerManager.Sync.
+type EndpointsCalculatorFactory func(params EndpointsCalculatorParams) (negtypes.EndpointsCalculator, error)
+
+var (
+	calculatorsLock sync.RWMutex
+	calculators     = map[string]EndpointsCalculatorFactory{
+		DefaultEndpointsCalculator:      newServiceEndpointsCalculator,
+		ServiceEntryEndpointsCalculator: newServiceEntryEndpointsCalculator,
+	}
+)
+
+// RegisterEndpointsCalculator registers an EndpointsCalculatorFactory under
+// the given name. It is meant to be called from init functions of packages
+// providing alternative endpoint sources.
+func RegisterEndpointsCalculator(name string, factory EndpointsCalculatorFactory) error {
+	if name == "" || factory == nil {
+		return fmt.Errorf("endpoints calculator name and factory must be set")
+	}
+	calculatorsLock.Lock()
+	defer calculatorsLock.Unlock()
+	if _, ok := calculators[name]; ok {
+		return fmt.Errorf("endpoints calculator %q is already registered", name)
+	}
+	calculators[name] = factory
+	klog.V(2).Infof("Registered endpoints calculator %q", name)
+	return nil
+}
+
+// RegisteredEndpointsCalculators returns the sorted names of all registered
+// EndpointsCalculators.
+func RegisteredEndpointsCalculators() []string {
+	calculatorsLock.RLock()
+	defer calculatorsLock.RUnlock()
+	var names []string
+	for name := range calculators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewEndpointsCalculator creates the EndpointsCalculator registered under
+// the given name. An empty name selects DefaultEndpointsCalculator.
+func NewEndpointsCalculator(name string, params EndpointsCalculatorParams) (negtypes.EndpointsCalculator, error) {
+	if name == "" {
+		name = DefaultEndpointsCalculator
+	}
+	calculatorsLock.RLock()
+	factory, ok := calculators[name]
+	calculatorsLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("endpoints calculator %q is not registered", name)
+	}
+	return factory(params)
+}
+
+// serviceEndpointsCalculator computes the network endpoints from the
+// Endpoints object of the service.
+type serviceEndpointsCalculator struct {
+	key            negtypes.NegSyncerKey
+	zoneGetter     negtypes.ZoneGetter
+	podLister      cache.Indexer
+	endpointLister cache.Indexer
+}
+
+func newServiceEndpointsCalculator(params EndpointsCalculatorParams) (negtypes.EndpointsCalculator, error) {
+	return &serviceEndpointsCalculator{
+		key:            params.Key,
+		zoneGetter:     params.ZoneGetter,
+		podLister:      params.PodLister,
+		endpointLister: params.EndpointLister,
+	}, nil
+}
+
+// CalculateEndpoints implements negtypes.EndpointsCalculator.
+func (c *serviceEndpointsCalculator) CalculateEndpoints() (map[string]negtypes.NetworkEndpointSet, negtypes.EndpointPodMap, bool, error) {
+	ep, exists, err := c.endpointLister.Get(
+		&apiv1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      c.key.Name,
+				Namespace: c.key.Namespace,
+			},
+		},
+	)
+	if err != nil || !exists {
+		return nil, nil, false, err
+	}
+	targetMap, endpointPodMap, err := toZoneNetworkEndpointMap(ep.(*apiv1.Endpoints), c.zoneGetter, c.key.TargetPort, c.podLister, c.key.SubsetLabels)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return targetMap, endpointPodMap, true, nil
+}
+
+// serviceEntryEndpointsCalculator computes the network endpoints from the
+// pods in the namespace of the Istio:ServiceEntry which match its workload
+// selector, stored in the SubsetLabels of the key.
+type serviceEntryEndpointsCalculator struct {
+	key        negtypes.NegSyncerKey
+	zoneGetter negtypes.ZoneGetter
+	podLister  cache.Indexer
+}
+
+func newServiceEntryEndpointsCalculator(params EndpointsCalculatorParams) (negtypes.EndpointsCalculator, error) {
+	return &serviceEntryEndpointsCalculator{
+		key:        params.Key,
+		zoneGetter: params.ZoneGetter,
+		podLister:  params.PodLister,
+	}, nil
+}
+
+// CalculateEndpoints implements negtypes.EndpointsCalculator.
+func (c *serviceEntryEndpointsCalculator) CalculateEndpoints() (map[string]negtypes.NetworkEndpointSet, negtypes.EndpointPodMap, bool, error) {
+	selector, err := labels.Parse(c.key.SubsetLabels)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to parse workload selector %q: %v", c.key.SubsetLabels, err)
+	}
+	var pods []*apiv1.Pod
+	if err := cache.ListAllByNamespace(c.podLister, c.key.Namespace, selector, func(obj interface{}) {
+		pods = append(pods, obj.(*apiv1.Pod))
+	}); err != nil {
+		return nil, nil, false, err
+	}
+
+	zoneNetworkEndpointMap := map[string]negtypes.NetworkEndpointSet{}
+	networkEndpointPodMap := negtypes.EndpointPodMap{}
+	for _, pod := range pods {
+		// Pods in graceful termination are detached, like the pods of
+		// services.
+		if pod.Status.PodIP == "" || pod.Spec.NodeName == "" || pod.DeletionTimestamp != nil {
+			continue
+		}
+		if pod.Status.Phase == apiv1.PodSucceeded || pod.Status.Phase == apiv1.PodFailed {
+			continue
+		}
+		port, ok := podTargetPort(pod, c.key.TargetPort)
+		if !ok {
+			klog.V(4).Infof("Pod %s/%s does not have target port %q of %s. Skipping", pod.Namespace, pod.Name, c.key.TargetPort, c.key.String())
+			continue
+		}
+		zone, err := c.zoneGetter.GetZoneForNode(pod.Spec.NodeName)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("failed to retrieve associated zone of node %q: %v", pod.Spec.NodeName, err)
+		}
+		if zoneNetworkEndpointMap[zone] == nil {
+			zoneNetworkEndpointMap[zone] = negtypes.NewNetworkEndpointSet()
+		}
+		networkEndpoint := negtypes.NetworkEndpoint{IP: pod.Status.PodIP, Port: port, Node: pod.Spec.NodeName}
+		zoneNetworkEndpointMap[zone].Insert(networkEndpoint)
+		networkEndpointPodMap[networkEndpoint] = types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}
+	}
+	return zoneNetworkEndpointMap, networkEndpointPodMap, true, nil
+}
+
+// podTargetPort returns the port number of the target port of the pod, which
+// is a port number or the name of a container port.
+func podTargetPort(pod *apiv1.Pod, targetPort string) (string, bool) {
+	if _, err := strconv.Atoi(targetPort); err == nil {
+		return targetPort, true
+	}
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.Name == targetPort {
+				return strconv.Itoa(int(port.ContainerPort)), true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncers
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+// staticEndpointsCalculator returns a fixed set of endpoints, standing in for
+// a custom endpoint source.
+type staticEndpointsCalculator struct {
+	key       negtypes.NegSyncerKey
+	endpoints map[string]negtypes.NetworkEndpointSet
+}
+
+func (c *staticEndpointsCalculator) CalculateEndpoints() (map[string]negtypes.NetworkEndpointSet, negtypes.EndpointPodMap, bool, error) {
+	return c.endpoints, negtypes.EndpointPodMap{}, true, nil
+}
+
+func TestEndpointsCalculatorRegistry(t *testing.T) {
+	const name = "test-static"
+	factory := func(params EndpointsCalculatorParams) (negtypes.EndpointsCalculator, error) {
+		return &staticEndpointsCalculator{key: params.Key}, nil
+	}
+	if err := RegisterEndpointsCalculator(name, factory); err != nil {
+		t.Fatalf("RegisterEndpointsCalculator(%q) = %v, want nil", name, err)
+	}
+
+	testCases := []struct {
+		desc    string
+		name    string
+		factory EndpointsCalculatorFactory
+	}{
+		{desc: "empty name", name: "", factory: factory},
+		{desc: "nil factory", name: "test-nil", factory: nil},
+		{desc: "duplicate default", name: DefaultEndpointsCalculator, factory: factory},
+		{desc: "duplicate custom", name: name, factory: factory},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if err := RegisterEndpointsCalculator(tc.name, tc.factory); err == nil {
+				t.Errorf("RegisterEndpointsCalculator(%q) = nil, want error", tc.name)
+			}
+		})
+	}
+
+	key := negtypes.NegSyncerKey{Namespace: testNamespace, Name: testService}
+	calculator, err := NewEndpointsCalculator(name, EndpointsCalculatorParams{Key: key})
+	if err != nil {
+		t.Fatalf("NewEndpointsCalculator(%q) = %v, want nil", name, err)
+	}
+	if got := calculator.(*staticEndpointsCalculator).key; got != key {
+		t.Errorf("Got calculator key %v, want %v", got, key)
+	}
+	calculator, err = NewEndpointsCalculator("", EndpointsCalculatorParams{Key: key})
+	if err != nil {
+		t.Fatalf("NewEndpointsCalculator(\"\") = %v, want nil", err)
+	}
+	if _, ok := calculator.(*serviceEndpointsCalculator); !ok {
+		t.Errorf("Got calculator %T, want *serviceEndpointsCalculator", calculator)
+	}
+	if _, err := NewEndpointsCalculator("unknown", EndpointsCalculatorParams{}); err == nil {
+		t.Errorf("NewEndpointsCalculator(%q) = nil, want error", "unknown")
+	}
+}
+
+func TestTransactionSyncerCustomEndpointsCalculator(t *testing.T) {
+	t.Parallel()
+
+	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	negtypes.MockNetworkEndpointAPIs(fakeGCE)
+	fakeCloud := negtypes.NewAdapter(fakeGCE)
+	negSyncer, transactionSyncer := newTestTransactionSyncer(fakeCloud)
+	negSyncer.(*syncer).stopped = false
+
+	target := generateEndpointSet(net.ParseIP("1.1.1.1"), 5, testInstance1, "8080")
+	transactionSyncer.endpointsCalculator = &staticEndpointsCalculator{
+		endpoints: map[string]negtypes.NetworkEndpointSet{testZone1: target},
+	}
+	if err := transactionSyncer.syncInternal(); err != nil {
+		t.Fatalf("syncInternal() = %v, want nil", err)
+	}
+	if err := waitForTransactions(transactionSyncer); err != nil {
+		t.Fatalf("Expect error == nil, but got %v", err)
+	}
+
+	got := negtypes.NewNetworkEndpointSet()
+	if err := retrieveExistingNetworkEndpoints(transactionSyncer.negName, testZone1, fakeCloud, got); err != nil {
+		t.Fatalf("retrieveExistingNetworkEndpoints(%q) = %v, want nil", testZone1, err)
+	}
+	if !got.Equal(target) {
+		t.Errorf("Got endpoints %v, want %v", got, target)
+	}
+}
+
+func TestServiceEntryEndpointsCalculator(t *testing.T) {
+	podLister := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	newPod := func(name, ip, node string, podLabels map[string]string) *apiv1.Pod {
+		return &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: name, Labels: podLabels},
+			Spec: apiv1.PodSpec{
+				NodeName: node,
+				Containers: []apiv1.Container{{
+					Ports: []apiv1.ContainerPort{{Name: "http", ContainerPort: 8080}},
+				}},
+			},
+			Status: apiv1.PodStatus{Phase: apiv1.PodRunning, PodIP: ip},
+		}
+	}
+	app := map[string]string{"app": "vm"}
+	terminating := newPod("terminating", "10.0.0.4", negtypes.TestInstance1, app)
+	terminating.DeletionTimestamp = &metav1.Time{}
+	otherNamespace := newPod("other-ns", "10.0.0.5", negtypes.TestInstance1, app)
+	otherNamespace.Namespace = "other"
+	for _, pod := range []*apiv1.Pod{
+		newPod("pod1", "10.0.0.1", negtypes.TestInstance1, app),
+		newPod("pod2", "10.0.0.2", negtypes.TestInstance3, map[string]string{"app": "vm", "version": "v1"}),
+		newPod("other-app", "10.0.0.3", negtypes.TestInstance1, map[string]string{"app": "other"}),
+		newPod("no-ip", "", negtypes.TestInstance1, app),
+		terminating,
+		otherNamespace,
+	} {
+		podLister.Add(pod)
+	}
+
+	for _, tc := range []struct {
+		desc       string
+		targetPort string
+		wantPort   string
+	}{
+		{desc: "port number", targetPort: "9090", wantPort: "9090"},
+		{desc: "named container port", targetPort: "http", wantPort: "8080"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			key := negtypes.NegSyncerKey{Namespace: testNamespace, Name: "se", Port: 80, TargetPort: tc.targetPort, SubsetLabels: "app=vm", ServiceEntry: true}
+			calculator, err := NewEndpointsCalculator(ServiceEntryEndpointsCalculator, EndpointsCalculatorParams{Key: key, ZoneGetter: negtypes.NewFakeZoneGetter(), PodLister: podLister})
+			if err != nil {
+				t.Fatalf("NewEndpointsCalculator(%q) = %v, want nil", ServiceEntryEndpointsCalculator, err)
+			}
+			endpoints, endpointPodMap, exists, err := calculator.CalculateEndpoints()
+			if err != nil || !exists {
+				t.Fatalf("CalculateEndpoints() = _, _, %t, %v, want true, nil", exists, err)
+			}
+			endpoint1 := negtypes.NetworkEndpoint{IP: "10.0.0.1", Port: tc.wantPort, Node: negtypes.TestInstance1}
+			endpoint2 := negtypes.NetworkEndpoint{IP: "10.0.0.2", Port: tc.wantPort, Node: negtypes.TestInstance3}
+			wantEndpoints := map[string]negtypes.NetworkEndpointSet{
+				negtypes.TestZone1: negtypes.NewNetworkEndpointSet(endpoint1),
+				negtypes.TestZone2: negtypes.NewNetworkEndpointSet(endpoint2),
+			}
+			if !reflect.DeepEqual(endpoints, wantEndpoints) {
+				t.Errorf("Got endpoints %v, want %v", endpoints, wantEndpoints)
+			}
+			wantEndpointPodMap := negtypes.EndpointPodMap{
+				endpoint1: types.NamespacedName{Namespace: testNamespace, Name: "pod1"},
+				endpoint2: types.NamespacedName{Namespace: testNamespace, Name: "pod2"},
+			}
+			if !reflect.DeepEqual(endpointPodMap, wantEndpointPodMap) {
+				t.Errorf("Got endpoint pods %v, want %v", endpointPodMap, wantEndpointPodMap)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncers
+
+// Limiter limits the number of goroutines doing some work at the same time.
+// A nil Limiter does not limit them.
+type Limiter chan struct{}
+
+// NewLimiter returns a Limiter letting n goroutines work at the same time,
+// nil if n is not positive.
+func NewLimiter(n int) Limiter {
+	if n <= 0 {
+		return nil
+	}
+	return make(Limiter, n)
+}
+
+// Acquire blocks until the goroutine can work.
+func (l Limiter) Acquire() {
+	if l != nil {
+		l <- struct{}{}
+	}
+}
+
+// Release lets another goroutine work.
+func (l Limiter) Release() {
+	if l != nil {
+		<-l
+	}
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncers
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	for _, tc := range []struct {
+		n    int
+		want int
+	}{
+		{n: 2, want: 2},
+		{n: 0, want: 5},
+	} {
+		limiter := NewLimiter(tc.n)
+		var lock sync.Mutex
+		running, max := 0, 0
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				limiter.Acquire()
+				defer limiter.Release()
+				lock.Lock()
+				running++
+				if running > max {
+					max = running
+				}
+				lock.Unlock()
+				time.Sleep(50 * time.Millisecond)
+				lock.Lock()
+				running--
+				lock.Unlock()
+			}()
+		}
+		wg.Wait()
+		if max != tc.want {
+			t.Errorf("NewLimiter(%d): got %d goroutines working at the same time, want %d", tc.n, max, tc.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncers
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"sync"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+)
+
+// snapshotKey is the ConfigMap data key holding the JSON encoded snapshot.
+const snapshotKey = "snapshot"
+
+// zoneSnapshot describes the endpoints of a NEG in a zone.
+type zoneSnapshot struct {
+	Hash  uint64 `json:"hash"`
+	Count int    `json:"count"`
+}
+
+// Snapshot records, for each NEG and zone, a hash of the endpoints the NEG is
+// known to contain, so that the first sync after a restart can skip listing
+// the endpoints of the NEGs which did not change. The endpoints themselves are
+// not recorded, as they would not fit in a ConfigMap for large clusters.
+// A nil Snapshot records nothing.
+type Snapshot struct {
+	lock sync.Mutex
+	// loaded is the snapshot saved by the previous run. Each entry is only
+	// used by the first sync of its NEG.
+	loaded map[string]zoneSnapshot
+	// current is the snapshot of this run.
+	current map[string]zoneSnapshot
+}
+
+// NewSnapshot returns an empty Snapshot.
+func NewSnapshot() *Snapshot {
+	return &Snapshot{
+		loaded:  map[string]zoneSnapshot{},
+		current: map[string]zoneSnapshot{},
+	}
+}
+
+// LoadSnapshot returns the snapshot saved in the given ConfigMap, an empty
+// one if the ConfigMap does not exist.
+func LoadSnapshot(kubeClient kubernetes.Interface, name types.NamespacedName) (*Snapshot, error) {
+	s := NewSnapshot()
+	cm, err := kubeClient.CoreV1().ConfigMaps(name.Namespace).Get(name.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if data, ok := cm.Data[snapshotKey]; ok {
+		if err := json.Unmarshal([]byte(data), &s.loaded); err != nil {
+			return NewSnapshot(), err
+		}
+	}
+	return s, nil
+}
+
+// Save stores the snapshot of this run in the given ConfigMap, creating it if
+// it does not exist.
+func (s *Snapshot) Save(kubeClient kubernetes.Interface, name types.NamespacedName) error {
+	s.lock.Lock()
+	data, err := json.Marshal(s.current)
+	s.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	cmData := map[string]string{snapshotKey: string(data)}
+
+	cmClient := kubeClient.CoreV1().ConfigMaps(name.Namespace)
+	cm, err := cmClient.Get(name.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		cm = &apiv1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name.Name, Namespace: name.Namespace},
+			Data:       cmData,
+		}
+		_, err = cmClient.Create(cm)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	cm.Data = cmData
+	_, err = cmClient.Update(cm)
+	return err
+}
+
+// record records that the NEG contains the given endpoints in the zone.
+func (s *Snapshot) record(negName, zone string, endpoints negtypes.NetworkEndpointSet) {
+	if s == nil {
+		return
+	}
+	snapshot := zoneSnapshot{Hash: endpointSetHash(endpoints), Count: endpoints.Len()}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.current[negCacheKey(negName, zone)] = snapshot
+}
+
+// forget removes the NEG in the zone from the snapshot, as its endpoints are
+// about to change.
+func (s *Snapshot) forget(negName, zone string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.current, negCacheKey(negName, zone))
+}
+
+// take returns and removes the entry of the NEG in the zone saved by the
+// previous run.
+func (s *Snapshot) take(negName, zone string) (zoneSnapshot, bool) {
+	if s == nil {
+		return zoneSnapshot{}, false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key := negCacheKey(negName, zone)
+	snapshot, ok := s.loaded[key]
+	delete(s.loaded, key)
+	return snapshot, ok
+}
+
+// endpointSetHash returns a hash of the endpoints which does not depend on
+// their order.
+func endpointSetHash(endpoints negtypes.NetworkEndpointSet) uint64 {
+	var sum uint64
+	for endpoint := range endpoints {
+		h := fnv.New64a()
+		h.Write([]byte(endpoint.IP + "/" + endpoint.Port + "/" + endpoint.Node))
+		sum += h.Sum64()
+	}
+	return sum
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncers
+
+import (
+	"net"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+)
+
+// listCountingCloud counts the ListNetworkEndpoints calls.
+type listCountingCloud struct {
+	negtypes.NetworkEndpointGroupCloud
+	lists int
+}
+
+func (c *listCountingCloud) ListNetworkEndpoints(name, zone string, showHealthStatus bool) ([]*compute.NetworkEndpointWithHealthStatus, error) {
+	c.lists++
+	return c.NetworkEndpointGroupCloud.ListNetworkEndpoints(name, zone, showHealthStatus)
+}
+
+func TestSnapshot(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	name := types.NamespacedName{Namespace: "kube-system", Name: "neg-snapshot"}
+	target, endpointPodMap := generateEndpointSetAndMap(net.ParseIP("1.1.1.1"), 10, testInstance1, "8080")
+	targetMap := map[string]negtypes.NetworkEndpointSet{testZone1: target}
+
+	// newCloud returns a cloud whose NEG contains the target endpoints.
+	newCloud := func() *listCountingCloud {
+		cloud := &listCountingCloud{NetworkEndpointGroupCloud: negtypes.NewFakeNetworkEndpointGroupCloud("test-subnetwork", "test-network")}
+		if err := cloud.CreateNetworkEndpointGroup(&compute.NetworkEndpointGroup{Name: testNegName}, testZone1); err != nil {
+			t.Fatal(err)
+		}
+		var endpoints []*compute.NetworkEndpoint
+		// makeEndpointBatch drains the given set.
+		for _, ne := range generateEndpointBatch(negtypes.NewNetworkEndpointSet(target.List()...)) {
+			endpoints = append(endpoints, ne)
+		}
+		if err := cloud.AttachNetworkEndpoints(testNegName, testZone1, endpoints); err != nil {
+			t.Fatal(err)
+		}
+		return cloud
+	}
+	// syncZone syncs the zone of the NEG with a new syncer using the snapshot
+	// saved in the ConfigMap, and returns the number of list calls.
+	syncZone := func(cloud *listCountingCloud, targetMap map[string]negtypes.NetworkEndpointSet, syncs int) int {
+		t.Helper()
+		snapshot, err := LoadSnapshot(kubeClient, name)
+		if err != nil {
+			t.Fatalf("LoadSnapshot() = %v", err)
+		}
+		_, transactionSyncer := newTestTransactionSyncer(cloud)
+		transactionSyncer.snapshot = snapshot
+		for i := 0; i < syncs; i++ {
+			if err := transactionSyncer.syncZone(testZone1, targetMap, true, endpointPodMap); err != nil {
+				t.Fatalf("syncZone() = %v", err)
+			}
+			if err := waitForTransactions(transactionSyncer); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := snapshot.Save(kubeClient, name); err != nil {
+			t.Fatalf("Save() = %v", err)
+		}
+		return cloud.lists
+	}
+
+	for _, tc := range []struct {
+		desc      string
+		mutate    func(cloud *listCountingCloud)
+		targetMap map[string]negtypes.NetworkEndpointSet
+		syncs     int
+		wantLists int
+	}{
+		{desc: "no snapshot", targetMap: targetMap, syncs: 1, wantLists: 1},
+		{desc: "unchanged NEG", targetMap: targetMap, syncs: 1, wantLists: 0},
+		{desc: "only the first sync uses the snapshot", targetMap: targetMap, syncs: 2, wantLists: 1},
+		{
+			desc: "NEG changed in the cloud",
+			mutate: func(cloud *listCountingCloud) {
+				endpoint := target.List()[0]
+				batch := generateEndpointBatch(negtypes.NewNetworkEndpointSet(endpoint))
+				cloud.DetachNetworkEndpoints(testNegName, testZone1, []*compute.NetworkEndpoint{batch[endpoint]})
+			},
+			targetMap: targetMap,
+			// The second sync records the repaired NEG.
+			syncs:     2,
+			wantLists: 2,
+		},
+		{desc: "snapshot saved after the NEG was repaired", targetMap: targetMap, syncs: 1, wantLists: 0},
+		{
+			desc:      "target changed",
+			targetMap: map[string]negtypes.NetworkEndpointSet{testZone1: generateEndpointSet(net.ParseIP("1.1.2.1"), 10, testInstance1, "8080")},
+			syncs:     1,
+			wantLists: 1,
+		},
+		{desc: "NEG changed during the previous run", targetMap: targetMap, syncs: 1, wantLists: 1},
+	} {
+		cloud := newCloud()
+		if tc.mutate != nil {
+			tc.mutate(cloud)
+		}
+		if got := syncZone(cloud, tc.targetMap, tc.syncs); got != tc.wantLists {
+			t.Errorf("%s: got %d list calls, want %d", tc.desc, got, tc.wantLists)
+		}
+	}
+}
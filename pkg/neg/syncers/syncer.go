@@ -56,9 +56,12 @@ type syncer struct {
 	syncCh  chan interface{}
 	clock   clock.Clock
 	backoff backoffHandler
+
+	// limiter limits the number of syncers syncing at the same time.
+	limiter Limiter
 }
 
-func newSyncer(negSyncerKey negtypes.NegSyncerKey, networkEndpointGroupName string, serviceLister cache.Indexer, recorder record.EventRecorder, core syncerCore) *syncer {
+func newSyncer(negSyncerKey negtypes.NegSyncerKey, networkEndpointGroupName string, serviceLister cache.Indexer, recorder record.EventRecorder, core syncerCore, limiter Limiter) *syncer {
 	return &syncer{
 		NegSyncerKey:  negSyncerKey,
 		negName:       networkEndpointGroupName,
@@ -69,6 +72,7 @@ func newSyncer(negSyncerKey negtypes.NegSyncerKey, networkEndpointGroupName stri
 		shuttingDown:  false,
 		clock:         clock.RealClock{},
 		backoff:       NewExponentialBackendOffHandler(maxRetries, minRetryDelay, maxRetryDelay),
+		limiter:       limiter,
 	}
 }
 
@@ -86,7 +90,9 @@ func (s *syncer) Start() error {
 		for {
 			// equivalent to never retry
 			retryCh := make(<-chan time.Time)
+			s.limiter.Acquire()
 			err := s.core.sync()
+			s.limiter.Release()
 			if err != nil {
 				delay, retryErr := s.backoff.NextRetryDelay()
 				retryMesg := ""
@@ -85,6 +85,7 @@ func newSyncerTester() *syncerTester {
 		context.ServiceInformer.GetIndexer(),
 		record.NewFakeRecorder(100),
 		st,
+		nil,
 	)
 	st.syncer = s
 	return st
@@ -23,10 +23,12 @@ import (
 
 	"google.golang.org/api/compute/v1"
 	apiv1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/ingress-gce/pkg/flags"
+	"k8s.io/ingress-gce/pkg/neg/metrics"
 	"k8s.io/ingress-gce/pkg/neg/readiness"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
 	"k8s.io/klog"
@@ -51,37 +53,65 @@ type transactionSyncer struct {
 	// transactions stores each transaction
 	transactions networkEndpointTransactionTable
 
-	podLister      cache.Indexer
-	serviceLister  cache.Indexer
-	endpointLister cache.Indexer
-	recorder       record.EventRecorder
-	cloud          negtypes.NetworkEndpointGroupCloud
-	zoneGetter     negtypes.ZoneGetter
+	serviceLister cache.Indexer
+	podLister     cache.Indexer
+	nodeLister    cache.Indexer
+	recorder      record.EventRecorder
+	cloud         negtypes.NetworkEndpointGroupCloud
+	zoneGetter    negtypes.ZoneGetter
+
+	// endpointsCalculator computes the target state of the NEG.
+	endpointsCalculator negtypes.EndpointsCalculator
 
 	// retry handles back off retry for NEG API operations
 	retry retryHandler
 
 	// reflector handles NEG readiness gate and conditions for pods in NEG.
 	reflector readiness.Reflector
+
+	// workers limits the number of operations of the syncer attaching or
+	// detaching endpoints at the same time.
+	workers Limiter
+
+	// snapshot records the endpoints of the NEGs for the next run, and lets
+	// the first sync skip listing the NEGs which did not change since the
+	// previous run. nil if disabled.
+	snapshot *Snapshot
+
+	// backendServices relinks the backend services using a NEG which must be
+	// recreated, nil if such NEGs are left as is. The backend services of the
+	// cluster are recognized by namer.
+	backendServices negtypes.BackendServiceCloud
+	namer           negtypes.NetworkEndpointGroupNamer
 }
 
-func NewTransactionSyncer(negSyncerKey negtypes.NegSyncerKey, networkEndpointGroupName string, recorder record.EventRecorder, cloud negtypes.NetworkEndpointGroupCloud, zoneGetter negtypes.ZoneGetter, podLister cache.Indexer, serviceLister cache.Indexer, endpointLister cache.Indexer, reflector readiness.Reflector) negtypes.NegSyncer {
+// NewTransactionSyncer returns a transaction syncer of the NEG. limiter
+// limits the number of syncers syncing at the same time, and is shared by
+// the syncers of a controller. snapshot, if not nil, is shared by the syncers
+// of a controller too. backendServices, if not nil, relinks the backend
+// services of the cluster when the NEG must be recreated.
+func NewTransactionSyncer(negSyncerKey negtypes.NegSyncerKey, networkEndpointGroupName string, recorder record.EventRecorder, cloud negtypes.NetworkEndpointGroupCloud, zoneGetter negtypes.ZoneGetter, serviceLister cache.Indexer, podLister cache.Indexer, nodeLister cache.Indexer, endpointsCalculator negtypes.EndpointsCalculator, reflector readiness.Reflector, limiter Limiter, snapshot *Snapshot, backendServices negtypes.BackendServiceCloud, namer negtypes.NetworkEndpointGroupNamer) negtypes.NegSyncer {
 	// TransactionSyncer implements the syncer core
 	ts := &transactionSyncer{
-		NegSyncerKey:   negSyncerKey,
-		negName:        networkEndpointGroupName,
-		needInit:       true,
-		transactions:   NewTransactionTable(),
-		podLister:      podLister,
-		serviceLister:  serviceLister,
-		endpointLister: endpointLister,
-		recorder:       recorder,
-		cloud:          cloud,
-		zoneGetter:     zoneGetter,
-		reflector:      reflector,
+		NegSyncerKey:        negSyncerKey,
+		negName:             networkEndpointGroupName,
+		needInit:            true,
+		transactions:        NewTransactionTable(),
+		serviceLister:       serviceLister,
+		podLister:           podLister,
+		nodeLister:          nodeLister,
+		recorder:            recorder,
+		cloud:               cloud,
+		zoneGetter:          zoneGetter,
+		endpointsCalculator: endpointsCalculator,
+		reflector:           reflector,
+		workers:             NewLimiter(flags.F.NegSyncerWorkers),
+		snapshot:            snapshot,
+		backendServices:     backendServices,
+		namer:               namer,
 	}
 	// Syncer implements life cycle logic
-	syncer := newSyncer(negSyncerKey, networkEndpointGroupName, serviceLister, recorder, ts)
+	syncer := newSyncer(negSyncerKey, networkEndpointGroupName, serviceLister, recorder, ts, limiter)
 	// transactionSyncer needs syncer interface for internals
 	ts.syncer = syncer
 	ts.retry = NewDelayRetryHandler(func() { syncer.Sync() }, NewExponentialBackendOffHandler(maxRetries, minRetryDelay, maxRetryDelay))
@@ -113,14 +143,7 @@ func (s *transactionSyncer) syncInternal() error {
 	}
 	klog.V(2).Infof("Sync NEG %q for %s.", s.negName, s.NegSyncerKey.String())
 
-	ep, exists, err := s.endpointLister.Get(
-		&apiv1.Endpoints{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      s.Name,
-				Namespace: s.Namespace,
-			},
-		},
-	)
+	targetMap, endpointPodMap, exists, err := s.endpointsCalculator.CalculateEndpoints()
 	if err != nil {
 		return err
 	}
@@ -130,25 +153,76 @@ func (s *transactionSyncer) syncInternal() error {
 		return nil
 	}
 
-	targetMap, endpointPodMap, err := toZoneNetworkEndpointMap(ep.(*apiv1.Endpoints), s.zoneGetter, s.TargetPort, s.podLister, s.NegSyncerKey.SubsetLabels)
-	if err != nil {
-		return err
+	truncated := truncateEndpoints(targetMap, flags.F.NegMaxEndpoints)
+	for zone, count := range truncated {
+		s.recordEvent(apiv1.EventTypeWarning, "NEGEndpointsTruncated", fmt.Sprintf("Left %d endpoint(s) out of NEG %q in zone %q, which can have at most %d endpoints", count, s.negName, zone, flags.F.NegMaxEndpoints))
 	}
 
-	currentMap, err := retrieveExistingZoneNetworkEndpointMap(s.negName, s.zoneGetter, s.cloud)
+	// Find transaction entries that needs to be reconciled
+	reconcileTransactions(targetMap, s.transactions)
+
+	// The current state and the differences are computed one zone at a time so
+	// that the NEG endpoints listed from GCE are only held for a single zone.
+	// The target state of all the zones is still held for the whole sync.
+	zones, pinned, err := negZones(s.NegSyncerKey, s.zoneGetter, s.serviceLister)
 	if err != nil {
 		return err
 	}
+	for _, zone := range zones {
+		metrics.ObserveTruncatedEndpoints(s.negName, zone, truncated[zone])
+	}
+	negZones := sets.NewString(zones...)
+	allZones := sets.NewString(zones...)
+	for zone := range targetMap {
+		// The endpoints in the zones the NEGs are not pinned to are left out.
+		if !pinned {
+			allZones.Insert(zone)
+		}
+	}
+	for _, zone := range allZones.List() {
+		if err := s.syncZone(zone, targetMap, negZones.Has(zone), endpointPodMap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncZone transforms the endpoints of the NEG in the given zone into the
+// target state. The NEG is only listed if listNEG is true, otherwise the
+// current state only consists of the ongoing transactions.
+func (s *transactionSyncer) syncZone(zone string, targetMap map[string]negtypes.NetworkEndpointSet, listNEG bool, endpointPodMap negtypes.EndpointPodMap) error {
+	currentSet := endpointSetPool.Get().(negtypes.NetworkEndpointSet)
+	currentMap := map[string]negtypes.NetworkEndpointSet{zone: currentSet}
+	defer releaseNetworkEndpointSets(currentMap)
+	if listNEG && !s.restoreZone(zone, targetMap[zone], currentSet) {
+		if err := retrieveExistingNetworkEndpoints(s.negName, zone, s.cloud, currentSet); err != nil {
+			return err
+		}
+	}
 
 	// Merge the current state from cloud with the transaction table together
 	// The combined state represents the eventual result when all transactions completed
 	mergeTransactionIntoZoneEndpointMap(currentMap, s.transactions)
-	// Find transaction entries that needs to be reconciled
-	reconcileTransactions(targetMap, s.transactions)
+	zoneTargetMap := map[string]negtypes.NetworkEndpointSet{zone: targetMap[zone]}
+	zoneCurrentMap := map[string]negtypes.NetworkEndpointSet{zone: currentSet}
 	// Calculate the endpoints to add and delete to transform the current state to desire state
-	addEndpoints, removeEndpoints := calculateNetworkEndpointDifference(targetMap, currentMap)
+	addEndpoints, removeEndpoints := calculateNetworkEndpointDifference(zoneTargetMap, zoneCurrentMap)
+	if s.snapshot != nil {
+		if listNEG && addEndpoints[zone].Len() == 0 && removeEndpoints[zone].Len() == 0 && len(s.transactions.Keys()) == 0 {
+			s.snapshot.record(s.negName, zone, targetMap[zone])
+		} else {
+			s.snapshot.forget(s.negName, zone)
+		}
+	}
 	// Calculate Pods that are already in the NEG
-	_, committedEndpoints := calculateNetworkEndpointDifference(addEndpoints, targetMap)
+	notCommittedEndpoints, committedEndpoints := calculateNetworkEndpointDifference(addEndpoints, zoneTargetMap)
+	// The endpoint sets are only used during this sync, endpoint batches passed
+	// to the NEG operations are copied out of them.
+	defer func() {
+		for _, endpointMap := range []map[string]negtypes.NetworkEndpointSet{addEndpoints, removeEndpoints, notCommittedEndpoints, committedEndpoints} {
+			releaseNetworkEndpointSets(endpointMap)
+		}
+	}()
 	// Filter out the endpoints with existing transaction
 	// This mostly happens when transaction entry require reconciliation but the transaction is still progress
 	// e.g. endpoint A is in the process of adding to NEG N, and the new desire state is not to have A in N.
@@ -161,32 +235,71 @@ func (s *transactionSyncer) syncInternal() error {
 	s.commitPods(committedEndpoints, endpointPodMap)
 
 	if len(addEndpoints) == 0 && len(removeEndpoints) == 0 {
-		klog.V(4).Infof("No endpoint change for %s/%s, skip syncing NEG. ", s.Namespace, s.Name)
+		klog.V(4).Infof("No endpoint change for %s/%s in zone %s, skip syncing NEG. ", s.Namespace, s.Name, zone)
 		return nil
 	}
 
-	return s.syncNetworkEndpoints(addEndpoints, removeEndpoints)
+	return s.syncNetworkEndpoints(addEndpoints, removeEndpoints, endpointPodMap)
+}
+
+// restoreZone fills currentSet with the target endpoints of the zone if the
+// snapshot saved by the previous run shows that the NEG already contains them,
+// and returns false if the NEG must be listed instead. The snapshot is trusted
+// if its hash matches the target endpoints and its size matches the NEG.
+func (s *transactionSyncer) restoreZone(zone string, target, currentSet negtypes.NetworkEndpointSet) bool {
+	snapshot, ok := s.snapshot.take(s.negName, zone)
+	if !ok || snapshot.Count != target.Len() || snapshot.Hash != endpointSetHash(target) {
+		return false
+	}
+	neg, err := s.cloud.GetNetworkEndpointGroup(s.negName, zone)
+	if err != nil || neg.Size != int64(snapshot.Count) {
+		return false
+	}
+	klog.V(2).Infof("NEG %q in zone %s did not change since the previous run, skip listing its endpoints", s.negName, zone)
+	for endpoint := range target {
+		currentSet.Insert(endpoint)
+	}
+	return true
 }
 
 // ensureNetworkEndpointGroups ensures NEGs are created and configured correctly in the corresponding zones.
 func (s *transactionSyncer) ensureNetworkEndpointGroups() error {
-	var err error
-	zones, err := s.zoneGetter.ListZones()
+	zones, _, err := negZones(s.NegSyncerKey, s.zoneGetter, s.serviceLister)
 	if err != nil {
 		return err
 	}
 
+	var replacer *negReplacer
+	if s.backendServices != nil && flags.F.EnableNEGReplacement {
+		replacer = &negReplacer{backendServices: s.backendServices, isManaged: s.namer.IsNEG, endpoints: s.zoneEndpoints}
+	}
 	var errList []error
 	for _, zone := range zones {
-		if err := ensureNetworkEndpointGroup(s.Namespace, s.Name, s.negName, zone, s.NegSyncerKey.String(), s.cloud, s.serviceLister, s.recorder); err != nil {
+		if err := ensureNetworkEndpointGroup(s.Namespace, s.Name, s.negName, zone, s.NegSyncerKey.String(), s.cloud, replacer, s.serviceLister, s.recorder); err != nil {
 			errList = append(errList, err)
 		}
 	}
 	return utilerrors.NewAggregate(errList)
 }
 
+// zoneEndpoints returns the target endpoints of the NEG in the zone.
+func (s *transactionSyncer) zoneEndpoints(zone string) (negtypes.NetworkEndpointSet, error) {
+	targetMap, _, exists, err := s.endpointsCalculator.CalculateEndpoints()
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("endpoints of %s/%s do not exist", s.Namespace, s.Name)
+	}
+	truncateEndpoints(targetMap, flags.F.NegMaxEndpoints)
+	if targetMap[zone] == nil {
+		return negtypes.NewNetworkEndpointSet(), nil
+	}
+	return targetMap[zone], nil
+}
+
 // syncNetworkEndpoints spins off go routines to execute NEG operations
-func (s *transactionSyncer) syncNetworkEndpoints(addEndpoints, removeEndpoints map[string]negtypes.NetworkEndpointSet) error {
+func (s *transactionSyncer) syncNetworkEndpoints(addEndpoints, removeEndpoints map[string]negtypes.NetworkEndpointSet, endpointPodMap negtypes.EndpointPodMap) error {
 	syncFunc := func(endpointMap map[string]negtypes.NetworkEndpointSet, operation transactionOp) error {
 		for zone, endpointSet := range endpointMap {
 			if endpointSet.Len() == 0 {
@@ -194,6 +307,18 @@ func (s *transactionSyncer) syncNetworkEndpoints(addEndpoints, removeEndpoints m
 				continue
 			}
 
+			// Only a single batch is attached per sync. Attach the warmed-up pods
+			// first so that traffic is restored to them before the rest.
+			if operation == attachOp && flags.Reloadable().NegAttachWarmPodsFirst && endpointSet.Len() > MAX_NETWORK_ENDPOINTS_PER_BATCH {
+				endpointSet = warmEndpoints(endpointSet, endpointPodMap, s.podLister)
+			}
+			if operation == detachOp {
+				endpointSet = detachEndpoints(endpointSet, s.Namespace, s.detachesInProgress(zone), flags.F.NegMaxUnavailableEndpoints, s.podLister, s.nodeLister)
+				if endpointSet.Len() == 0 {
+					continue
+				}
+			}
+
 			batch, err := makeEndpointBatch(endpointSet)
 			if err != nil {
 				return err
@@ -230,6 +355,18 @@ func (s *transactionSyncer) syncNetworkEndpoints(addEndpoints, removeEndpoints m
 	return nil
 }
 
+// detachesInProgress returns the number of endpoints being detached from the
+// NEG in the zone.
+func (s *transactionSyncer) detachesInProgress(zone string) int {
+	count := 0
+	for _, endpoint := range s.transactions.Keys() {
+		if entry, ok := s.transactions.Get(endpoint); ok && entry.Operation == detachOp && entry.Zone == zone {
+			count++
+		}
+	}
+	return count
+}
+
 // attachNetworkEndpoints creates go routine to run operations for attaching network endpoints
 func (s *transactionSyncer) attachNetworkEndpoints(zone string, networkEndpointMap map[negtypes.NetworkEndpoint]*compute.NetworkEndpoint) {
 	klog.V(2).Infof("Attaching %d endpoint(s) for %s in NEG %s at %s.", len(networkEndpointMap), s.NegSyncerKey.String(), s.negName, zone)
@@ -246,6 +383,8 @@ func (s *transactionSyncer) detachNetworkEndpoints(zone string, networkEndpointM
 // It will record events when operations are completed
 // If error occurs or any transaction entry requires reconciliation, it will trigger resync
 func (s *transactionSyncer) operationInternal(operation transactionOp, zone string, networkEndpointMap map[negtypes.NetworkEndpoint]*compute.NetworkEndpoint) {
+	s.workers.Acquire()
+	defer s.workers.Release()
 	var err error
 	networkEndpoints := []*compute.NetworkEndpoint{}
 	for _, ne := range networkEndpointMap {
@@ -262,7 +401,8 @@ func (s *transactionSyncer) operationInternal(operation transactionOp, zone stri
 	if err == nil {
 		s.recordEvent(apiv1.EventTypeNormal, operation.String(), fmt.Sprintf("%s %d network endpoint(s) (NEG %q in zone %q)", operation.String(), len(networkEndpointMap), s.negName, zone))
 	} else {
-		s.recordEvent(apiv1.EventTypeWarning, operation.String()+"Failed", fmt.Sprintf("Failed to %s %d network endpoint(s) (NEG %q in zone %q): %v", operation.String(), len(networkEndpointMap), s.negName, zone, err))
+		reason, msg := operationFailedEvent(operation.String(), len(networkEndpointMap), s.negName, zone, err)
+		s.recordEvent(apiv1.EventTypeWarning, reason, msg)
 	}
 
 	// WARNING: commitTransaction must be called at last for analyzing the operation result
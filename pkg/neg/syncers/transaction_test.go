@@ -26,12 +26,15 @@ import (
 
 	"google.golang.org/api/compute/v1"
 	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/ingress-gce/pkg/annotations"
 	backendconfigclient "k8s.io/ingress-gce/pkg/backendconfig/client/clientset/versioned/fake"
+	"k8s.io/ingress-gce/pkg/chaos"
 	"k8s.io/ingress-gce/pkg/context"
 	"k8s.io/ingress-gce/pkg/neg/readiness"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
@@ -148,7 +151,7 @@ func TestTransactionSyncNetworkEndpoints(t *testing.T) {
 	}
 
 	for _, tc := range testCases {
-		err := transactionSyncer.syncNetworkEndpoints(tc.addEndpoints, tc.removeEndpoints)
+		err := transactionSyncer.syncNetworkEndpoints(tc.addEndpoints, tc.removeEndpoints, negtypes.EndpointPodMap{})
 		if err != nil {
 			t.Errorf("For case %q, endpointSets error == nil, but got %v", tc.desc, err)
 		}
@@ -175,6 +178,172 @@ func TestTransactionSyncNetworkEndpoints(t *testing.T) {
 	}
 }
 
+func TestTransactionSyncZone(t *testing.T) {
+	t.Parallel()
+
+	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	negtypes.MockNetworkEndpointAPIs(fakeGCE)
+	fakeCloud := negtypes.NewAdapter(fakeGCE)
+	_, transactionSyncer := newTestTransactionSyncer(fakeCloud)
+	if err := transactionSyncer.ensureNetworkEndpointGroups(); err != nil {
+		t.Fatalf("Expect error == nil, but got %v", err)
+	}
+
+	// Zone 1 starts with endpoints on instance 1, zone 2 is empty.
+	existing := generateEndpointSet(net.ParseIP("1.1.1.1"), 10, testInstance1, "8080")
+	// syncNetworkEndpoints drains the given sets.
+	addEndpoints := map[string]negtypes.NetworkEndpointSet{testZone1: generateEndpointSet(net.ParseIP("1.1.1.1"), 10, testInstance1, "8080")}
+	if err := transactionSyncer.syncNetworkEndpoints(addEndpoints, nil, negtypes.EndpointPodMap{}); err != nil {
+		t.Fatalf("Expect error == nil, but got %v", err)
+	}
+	if err := waitForTransactions(transactionSyncer); err != nil {
+		t.Fatalf("Expect error == nil, but got %v", err)
+	}
+
+	zone1Target, zone1Pods := generateEndpointSetAndMap(net.ParseIP("1.1.2.1"), 10, testInstance2, "8080")
+	zone2Target, zone2Pods := generateEndpointSetAndMap(net.ParseIP("1.1.3.1"), 10, testInstance3, "8080")
+	targetMap := map[string]negtypes.NetworkEndpointSet{testZone1: zone1Target, testZone2: zone2Target}
+	endpointPodMap := unionEndpointMap(zone1Pods, zone2Pods)
+
+	// Syncing one zone must not touch the other.
+	if err := transactionSyncer.syncZone(testZone2, targetMap, true, endpointPodMap); err != nil {
+		t.Fatalf("syncZone(%q) = %v, want nil", testZone2, err)
+	}
+	if err := waitForTransactions(transactionSyncer); err != nil {
+		t.Fatalf("Expect error == nil, but got %v", err)
+	}
+	for zone, want := range map[string]negtypes.NetworkEndpointSet{testZone1: existing, testZone2: zone2Target} {
+		got := negtypes.NewNetworkEndpointSet()
+		if err := retrieveExistingNetworkEndpoints(transactionSyncer.negName, zone, fakeCloud, got); err != nil {
+			t.Fatalf("retrieveExistingNetworkEndpoints(%q) = %v, want nil", zone, err)
+		}
+		if !got.Equal(want) {
+			t.Errorf("In zone %q, got endpoints %v, want %v", zone, got, want)
+		}
+	}
+
+	if err := transactionSyncer.syncZone(testZone1, targetMap, true, endpointPodMap); err != nil {
+		t.Fatalf("syncZone(%q) = %v, want nil", testZone1, err)
+	}
+	if err := waitForTransactions(transactionSyncer); err != nil {
+		t.Fatalf("Expect error == nil, but got %v", err)
+	}
+	got := negtypes.NewNetworkEndpointSet()
+	if err := retrieveExistingNetworkEndpoints(transactionSyncer.negName, testZone1, fakeCloud, got); err != nil {
+		t.Fatalf("retrieveExistingNetworkEndpoints(%q) = %v, want nil", testZone1, err)
+	}
+	if !got.Equal(zone1Target) {
+		t.Errorf("In zone %q, got endpoints %v, want %v", testZone1, got, zone1Target)
+	}
+}
+
+func TestTransactionSyncZoneFaults(t *testing.T) {
+	t.Parallel()
+
+	injector := chaos.NewInjector(chaos.Config{QuotaErrorRate: 1, Seed: 1})
+	fakeCloud := injector.NetworkEndpointGroupCloud(negtypes.NewFakeNetworkEndpointGroupCloud("test-subnetwork", "test-network"))
+	_, transactionSyncer := newTestTransactionSyncer(fakeCloud)
+	if err := fakeCloud.CreateNetworkEndpointGroup(&compute.NetworkEndpointGroup{Name: testNegName}, testZone1); err != nil {
+		t.Fatalf("Failed to create NEG: %v", err)
+	}
+	target, endpointPodMap := generateEndpointSetAndMap(net.ParseIP("1.1.1.1"), 10, testInstance1, "8080")
+	targetMap := map[string]negtypes.NetworkEndpointSet{testZone1: target}
+
+	for _, tc := range []struct {
+		desc         string
+		errorRate    float64
+		wantNeedInit bool
+		want         negtypes.NetworkEndpointSet
+	}{
+		{
+			desc:         "attach fails",
+			errorRate:    1,
+			wantNeedInit: true,
+			want:         negtypes.NewNetworkEndpointSet(),
+		},
+		{
+			desc: "attach succeeds after the failure",
+			want: target,
+		},
+	} {
+		injector.SetErrorRate("NetworkEndpointGroups.AttachNetworkEndpoints", tc.errorRate)
+		transactionSyncer.needInit = false
+		if err := transactionSyncer.syncZone(testZone1, targetMap, true, endpointPodMap); err != nil {
+			t.Fatalf("%s: syncZone() = %v, want nil", tc.desc, err)
+		}
+		if err := waitForTransactions(transactionSyncer); err != nil {
+			t.Fatalf("%s: %v", tc.desc, err)
+		}
+		transactionSyncer.syncLock.Lock()
+		needInit := transactionSyncer.needInit
+		transactionSyncer.syncLock.Unlock()
+		if needInit != tc.wantNeedInit {
+			t.Errorf("%s: got needInit %v, want %v", tc.desc, needInit, tc.wantNeedInit)
+		}
+		got := negtypes.NewNetworkEndpointSet()
+		if err := retrieveExistingNetworkEndpoints(testNegName, testZone1, fakeCloud, got); err != nil {
+			t.Fatalf("%s: retrieveExistingNetworkEndpoints() = %v", tc.desc, err)
+		}
+		if !got.Equal(tc.want) {
+			t.Errorf("%s: got endpoints %v, want %v", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestTransactionEnsurePinnedNetworkEndpointGroups(t *testing.T) {
+	t.Parallel()
+
+	fakeCloud := negtypes.NewFakeNetworkEndpointGroupCloud("test-subnetwork", "test-network")
+	_, transactionSyncer := newTestTransactionSyncer(fakeCloud)
+	transactionSyncer.serviceLister.Add(&apiv1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   testNamespace,
+			Name:        testService,
+			Annotations: map[string]string{annotations.NEGZonesKey: testZone1 + ",unknown-zone"},
+		},
+	})
+	if err := transactionSyncer.ensureNetworkEndpointGroups(); err != nil {
+		t.Fatalf("ensureNetworkEndpointGroups() = %v", err)
+	}
+	for zone, want := range map[string]bool{testZone1: true, testZone2: false} {
+		_, err := fakeCloud.GetNetworkEndpointGroup(testNegName, zone)
+		if got := err == nil; got != want {
+			t.Errorf("Got NEG in zone %q: %v, want %v", zone, got, want)
+		}
+	}
+}
+
+// BenchmarkTransactionSyncZone measures the memory used to sync a zone whose
+// NEG is already in the target state, for increasing numbers of endpoints.
+func BenchmarkTransactionSyncZone(b *testing.B) {
+	for _, numEndpoints := range []int{1000, 10000, 50000} {
+		b.Run(fmt.Sprintf("endpoints-%d", numEndpoints), func(b *testing.B) {
+			fakeCloud := negtypes.NewFakeNetworkEndpointGroupCloud("test-subnetwork", "test-network")
+			_, transactionSyncer := newTestTransactionSyncer(fakeCloud)
+			if err := fakeCloud.CreateNetworkEndpointGroup(&compute.NetworkEndpointGroup{Name: testNegName}, testZone1); err != nil {
+				b.Fatalf("Failed to create NEG: %v", err)
+			}
+			targetSet, endpointPodMap := generateEndpointSetAndMap(net.ParseIP("10.0.0.0"), numEndpoints, testInstance1, "8080")
+			var networkEndpoints []*compute.NetworkEndpoint
+			for _, ne := range generateEndpointBatch(targetSet) {
+				networkEndpoints = append(networkEndpoints, ne)
+			}
+			if err := fakeCloud.AttachNetworkEndpoints(testNegName, testZone1, networkEndpoints); err != nil {
+				b.Fatalf("Failed to attach endpoints: %v", err)
+			}
+			targetMap := map[string]negtypes.NetworkEndpointSet{testZone1: targetSet}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := transactionSyncer.syncZone(testZone1, targetMap, true, endpointPodMap); err != nil {
+					b.Fatalf("syncZone() = %v, want nil", err)
+				}
+			}
+		})
+	}
+}
+
 func TestCommitTransaction(t *testing.T) {
 	t.Parallel()
 	s, transactionSyncer := newTestTransactionSyncer(negtypes.NewAdapter(gce.NewFakeGCECloud(gce.DefaultTestClusterValues())))
@@ -1070,15 +1239,28 @@ func newTestTransactionSyncer(fakeGCE negtypes.NetworkEndpointGroupCloud) (negty
 	// TODO(freehan): use real readiness reflector
 	reflector := &readiness.NoopReflector{}
 
+	calculator, _ := newServiceEndpointsCalculator(EndpointsCalculatorParams{
+		Key:            svcPort,
+		ZoneGetter:     negtypes.NewFakeZoneGetter(),
+		PodLister:      context.PodInformer.GetIndexer(),
+		ServiceLister:  context.ServiceInformer.GetIndexer(),
+		EndpointLister: context.EndpointInformer.GetIndexer(),
+	})
+
 	negsyncer := NewTransactionSyncer(svcPort,
 		testNegName,
 		record.NewFakeRecorder(100),
 		fakeGCE,
 		negtypes.NewFakeZoneGetter(),
-		context.PodInformer.GetIndexer(),
 		context.ServiceInformer.GetIndexer(),
-		context.EndpointInformer.GetIndexer(),
-		reflector)
+		context.PodInformer.GetIndexer(),
+		context.NodeInformer.GetIndexer(),
+		calculator,
+		reflector,
+		nil,
+		nil,
+		nil,
+		nil)
 	transactionSyncer := negsyncer.(*syncer).core.(*transactionSyncer)
 	return negsyncer, transactionSyncer
 }
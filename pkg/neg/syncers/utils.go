@@ -17,9 +17,13 @@ limitations under the License.
 package syncers
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"google.golang.org/api/compute/v1"
@@ -30,6 +34,10 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/ingress-gce/pkg/annotations"
+	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/flags"
+	"k8s.io/ingress-gce/pkg/neg/metrics"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/klog"
@@ -39,11 +47,10 @@ const (
 	MAX_NETWORK_ENDPOINTS_PER_BATCH = 500
 	// For each NEG, only retries 15 times to process it.
 	// This is a convention in kube-controller-manager.
-	maxRetries                   = 15
-	minRetryDelay                = 5 * time.Second
-	maxRetryDelay                = 600 * time.Second
-	separator                    = "||"
-	negIPPortNetworkEndpointType = "GCE_VM_IP_PORT"
+	maxRetries    = 15
+	minRetryDelay = 5 * time.Second
+	maxRetryDelay = 600 * time.Second
+	separator     = "||"
 )
 
 // encodeEndpoint encodes ip and instance into a single string
@@ -77,26 +84,66 @@ func calculateDifference(targetMap, currentMap map[string]sets.String) (map[stri
 	return addSet, removeSet
 }
 
+// endpointSetPool holds the NetworkEndpointSets returned by
+// calculateNetworkEndpointDifference for reuse by later syncs.
+var endpointSetPool = sync.Pool{
+	New: func() interface{} { return negtypes.NewNetworkEndpointSet() },
+}
+
 // calculateNetworkEndpointDifference determines what endpoints needs to be added and removed in order to move current state to target state.
+// The returned sets are taken from endpointSetPool and can be returned with releaseNetworkEndpointSets.
 func calculateNetworkEndpointDifference(targetMap, currentMap map[string]negtypes.NetworkEndpointSet) (map[string]negtypes.NetworkEndpointSet, map[string]negtypes.NetworkEndpointSet) {
 	addSet := map[string]negtypes.NetworkEndpointSet{}
 	removeSet := map[string]negtypes.NetworkEndpointSet{}
 	for zone, endpointSet := range targetMap {
-		diff := endpointSet.Difference(currentMap[zone])
-		if len(diff) > 0 {
+		// Fast path for the common case where nothing changed in the zone.
+		if endpointSet.Equal(currentMap[zone]) {
+			continue
+		}
+		if diff := pooledDifference(endpointSet, currentMap[zone]); diff != nil {
 			addSet[zone] = diff
 		}
 	}
 
 	for zone, endpointSet := range currentMap {
-		diff := endpointSet.Difference(targetMap[zone])
-		if len(diff) > 0 {
+		if endpointSet.Equal(targetMap[zone]) {
+			continue
+		}
+		if diff := pooledDifference(endpointSet, targetMap[zone]); diff != nil {
 			removeSet[zone] = diff
 		}
 	}
 	return addSet, removeSet
 }
 
+// pooledDifference returns the endpoints in s1 which are not in s2, or nil if
+// there is none. The returned set is taken from endpointSetPool.
+func pooledDifference(s1, s2 negtypes.NetworkEndpointSet) negtypes.NetworkEndpointSet {
+	var result negtypes.NetworkEndpointSet
+	for endpoint := range s1 {
+		if s2.Has(endpoint) {
+			continue
+		}
+		if result == nil {
+			result = endpointSetPool.Get().(negtypes.NetworkEndpointSet)
+		}
+		result.Insert(endpoint)
+	}
+	return result
+}
+
+// releaseNetworkEndpointSets clears the sets in the map and returns them to
+// endpointSetPool. The sets must not be used afterwards.
+func releaseNetworkEndpointSets(endpointMap map[string]negtypes.NetworkEndpointSet) {
+	for zone, endpointSet := range endpointMap {
+		for endpoint := range endpointSet {
+			delete(endpointSet, endpoint)
+		}
+		endpointSetPool.Put(endpointSet)
+		delete(endpointMap, zone)
+	}
+}
+
 // getService retrieves service object from serviceLister based on the input Namespace and Name
 func getService(serviceLister cache.Indexer, namespace, name string) *apiv1.Service {
 	if serviceLister == nil {
@@ -112,8 +159,85 @@ func getService(serviceLister cache.Indexer, namespace, name string) *apiv1.Serv
 	return nil
 }
 
+// negLocks serializes ensureNetworkEndpointGroup for each zonal NEG, since
+// the syncers of different ports of a service may ensure the same NEG.
+var negLocks = newKeyedMutex()
+
+// keyedMutex is a set of mutexes, one per key. The mutex of a key is only
+// kept while it is held or waited for.
+type keyedMutex struct {
+	lock  sync.Mutex
+	locks map[string]*refCountedMutex
+}
+
+type refCountedMutex struct {
+	sync.Mutex
+	refs int
+}
+
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{locks: map[string]*refCountedMutex{}}
+}
+
+// Lock locks the mutex of the key.
+func (m *keyedMutex) Lock(key string) {
+	m.lock.Lock()
+	l, ok := m.locks[key]
+	if !ok {
+		l = &refCountedMutex{}
+		m.locks[key] = l
+	}
+	l.refs++
+	m.lock.Unlock()
+	l.Lock()
+}
+
+// Unlock unlocks the mutex of the key.
+func (m *keyedMutex) Unlock(key string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	l := m.locks[key]
+	l.Unlock()
+	l.refs--
+	if l.refs == 0 {
+		delete(m.locks, key)
+	}
+}
+
 // ensureNetworkEndpointGroup ensures corresponding NEG is configured correctly in the specified zone.
-func ensureNetworkEndpointGroup(svcNamespace, svcName, negName, zone, negServicePortName string, cloud negtypes.NetworkEndpointGroupCloud, serviceLister cache.Indexer, recorder record.EventRecorder) error {
+// A NEG which does not match the NEG to create is recreated. If backend
+// services use it, it is replaced without dropping their traffic by replacer,
+// and left as is if replacer is nil. A replacement interrupted by an earlier
+// sync is finished first.
+func ensureNetworkEndpointGroup(svcNamespace, svcName, negName, zone, negServicePortName string, cloud negtypes.NetworkEndpointGroupCloud, replacer *negReplacer, serviceLister cache.Indexer, recorder record.EventRecorder) error {
+	negKey := zone + "/" + negName
+	negLocks.Lock(negKey)
+	defer negLocks.Unlock(negKey)
+
+	subnetworkURL := zoneSubnetworkURL(cloud, zone)
+	wantNEG := func(name string) *compute.NetworkEndpointGroup {
+		return &compute.NetworkEndpointGroup{
+			Name:                name,
+			NetworkEndpointType: string(negtypes.VmIpPortEndpointType),
+			Network:             cloud.NetworkURL(),
+			Subnetwork:          subnetworkURL,
+		}
+	}
+	if replacer != nil {
+		resumed, err := replacer.resume(negName, zone, wantNEG, cloud)
+		if err != nil {
+			return err
+		}
+		if resumed {
+			if recorder != nil && serviceLister != nil {
+				if svc := getService(serviceLister, svcNamespace, svcName); svc != nil {
+					recorder.Eventf(svc, apiv1.EventTypeNormal, "Recreate", "Finished recreating NEG %q for %s in %q.", negName, negServicePortName, zone)
+				}
+			}
+			return nil
+		}
+	}
+
 	neg, err := cloud.GetNetworkEndpointGroup(negName, zone)
 	if err != nil {
 		// Most likely to be caused by non-existed NEG
@@ -123,11 +247,32 @@ func ensureNetworkEndpointGroup(svcNamespace, svcName, negName, zone, negService
 	needToCreate := false
 	if neg == nil {
 		needToCreate = true
-	} else if !utils.EqualResourceIDs(neg.Network, cloud.NetworkURL()) ||
-		!utils.EqualResourceIDs(neg.Subnetwork, cloud.SubnetworkURL()) {
+	} else if mismatch := negMismatch(neg, cloud.NetworkURL(), subnetworkURL); mismatch != "" {
 		needToCreate = true
-		klog.V(2).Infof("NEG %q in %q does not match network and subnetwork of the cluster. Deleting NEG.", negName, zone)
+		klog.V(2).Infof("NEG %q in %q has %s. Deleting NEG.", negName, zone, mismatch)
 		err = cloud.DeleteNetworkEndpointGroup(negName, zone)
+		if utils.IsInUsedByError(err) {
+			// GCE refuses to delete a NEG linked to a backend service, so
+			// the NEG keeps serving until it is replaced or unlinked.
+			if replacer != nil {
+				klog.V(2).Infof("NEG %q in %q is in use, replacing it: %v", negName, zone, err)
+				err = replacer.replace(negName, zone, wantNEG, cloud)
+				if err == nil {
+					if recorder != nil && serviceLister != nil {
+						if svc := getService(serviceLister, svcNamespace, svcName); svc != nil {
+							recorder.Eventf(svc, apiv1.EventTypeNormal, "Recreate", "Recreated NEG %q for %s in %q, which had %s.", negName, negServicePortName, zone, mismatch)
+						}
+					}
+					return nil
+				}
+			}
+			if recorder != nil && serviceLister != nil {
+				if svc := getService(serviceLister, svcNamespace, svcName); svc != nil {
+					recorder.Eventf(svc, apiv1.EventTypeWarning, "NEGRecreationBlocked", "NEG %q for %s in %q has %s and cannot be recreated while it is used by a backend service: %v", negName, negServicePortName, zone, mismatch, err)
+				}
+			}
+			return err
+		}
 		if err != nil {
 			return err
 		} else {
@@ -141,12 +286,17 @@ func ensureNetworkEndpointGroup(svcNamespace, svcName, negName, zone, negService
 
 	if needToCreate {
 		klog.V(2).Infof("Creating NEG %q for %s in %q.", negName, negServicePortName, zone)
-		err = cloud.CreateNetworkEndpointGroup(&compute.NetworkEndpointGroup{
-			Name:                negName,
-			NetworkEndpointType: negIPPortNetworkEndpointType,
-			Network:             cloud.NetworkURL(),
-			Subnetwork:          cloud.SubnetworkURL(),
-		}, zone)
+		err = cloud.CreateNetworkEndpointGroup(wantNEG(negName), zone)
+		if utils.IsHTTPErrorCode(err, http.StatusConflict) {
+			// The NEG was created since it was retrieved, e.g. by a
+			// previous leader of the controller. It is fine as long as
+			// it matches the NEG to create.
+			if neg, getErr := cloud.GetNetworkEndpointGroup(negName, zone); getErr == nil &&
+				negMismatch(neg, cloud.NetworkURL(), subnetworkURL) == "" {
+				klog.V(2).Infof("NEG %q for %s in %q already exists: %v", negName, negServicePortName, zone, err)
+				return nil
+			}
+		}
 		if err != nil {
 			return err
 		} else {
@@ -160,6 +310,197 @@ func ensureNetworkEndpointGroup(svcNamespace, svcName, negName, zone, negService
 	return nil
 }
 
+// negReplacer replaces the NEGs used by backend services without dropping
+// their traffic.
+type negReplacer struct {
+	backendServices negtypes.BackendServiceCloud
+	// isManaged returns true for the backend services of the cluster, which
+	// are relinked. The NEGs used by other backend services are not replaced.
+	isManaged func(backendService string) bool
+	// endpoints returns the target endpoints of the NEG in the zone.
+	endpoints func(zone string) (negtypes.NetworkEndpointSet, error)
+}
+
+// replace recreates the NEG with the given name in the zone as wantNEG
+// returns it. GCE refuses to delete a NEG used by a backend service, and the
+// name of the NEG of a service port is fixed, so the traffic is moved to a
+// replacement NEG while the NEG is recreated:
+//  1. the replacement NEG is created with the target endpoints,
+//  2. the backend services are relinked from the NEG to the replacement,
+//  3. the NEG is deleted and recreated with the target endpoints,
+//  4. the backend services are relinked back to the NEG, and the replacement
+//     is deleted.
+//
+// Each step is idempotent, so that a replacement interrupted by an error can
+// be finished by calling replace again, see resume.
+func (r *negReplacer) replace(negName, zone string, wantNEG func(name string) *compute.NetworkEndpointGroup, cloud negtypes.NetworkEndpointGroupCloud) error {
+	backendServices, err := r.backendServices.ListBackendServices()
+	if err != nil {
+		return err
+	}
+	var external []string
+	for _, bs := range backendServices {
+		for _, backend := range bs.Backends {
+			if negtypes.IsNEGBackend(backend, negName, zone) && !r.isManaged(bs.Name) {
+				external = append(external, bs.Name)
+				break
+			}
+		}
+	}
+	if len(external) > 0 {
+		return fmt.Errorf("NEG %q in %q is referenced by backend services not managed by this cluster: %s", negName, zone, strings.Join(external, ", "))
+	}
+	endpoints, err := r.endpoints(zone)
+	if err != nil {
+		return err
+	}
+
+	replacementName := ReplacementNEGName(negName)
+	replacement, err := ensureNEGWithEndpoints(cloud, wantNEG(replacementName), zone, endpoints)
+	if err != nil {
+		return err
+	}
+	// The NEG was already recreated if an earlier replacement was
+	// interrupted after it, and only needs to be relinked back.
+	want := wantNEG(negName)
+	if neg, err := cloud.GetNetworkEndpointGroup(negName, zone); err != nil || negMismatch(neg, want.Network, want.Subnetwork) != "" {
+		if err := r.relink(backendServices, negName, zone, replacement.SelfLink); err != nil {
+			return err
+		}
+		klog.V(2).Infof("Deleting NEG %q in %q, replaced by NEG %q.", negName, zone, replacementName)
+		if err := cloud.DeleteNetworkEndpointGroup(negName, zone); err != nil && !utils.IsNotFoundError(err) {
+			return err
+		}
+	}
+	recreated, err := ensureNEGWithEndpoints(cloud, want, zone, endpoints)
+	if err != nil {
+		return err
+	}
+	if err := r.relink(backendServices, replacementName, zone, recreated.SelfLink); err != nil {
+		return err
+	}
+	klog.V(2).Infof("Deleting replacement NEG %q in %q.", replacementName, zone)
+	return cloud.DeleteNetworkEndpointGroup(replacementName, zone)
+}
+
+// resume finishes the replacement of the NEG with the given name in the zone
+// if an earlier one was interrupted, e.g. by an error or a restart of the
+// controller, which left the replacement NEG behind. The backend services may
+// still use the replacement, so it is only deleted once they are relinked back
+// to the recreated NEG. Returns true if a replacement was finished.
+func (r *negReplacer) resume(negName, zone string, wantNEG func(name string) *compute.NetworkEndpointGroup, cloud negtypes.NetworkEndpointGroupCloud) (bool, error) {
+	replacementName := ReplacementNEGName(negName)
+	if _, err := cloud.GetNetworkEndpointGroup(replacementName, zone); err != nil {
+		if utils.IsNotFoundError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	klog.V(2).Infof("Resuming the replacement of NEG %q in %q by NEG %q.", negName, zone, replacementName)
+	if err := r.replace(negName, zone, wantNEG, cloud); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// relink replaces the NEG with the given name in the zone by the NEG with the
+// given self link in the backends of the backend services, and updates them.
+func (r *negReplacer) relink(backendServices []*composite.BackendService, negName, zone, selfLink string) error {
+	for _, bs := range backendServices {
+		var backends []*composite.Backend
+		linked := false
+		for _, backend := range bs.Backends {
+			if utils.EqualResourceIDs(backend.Group, selfLink) {
+				linked = true
+			}
+		}
+		changed := false
+		for _, backend := range bs.Backends {
+			if !negtypes.IsNEGBackend(backend, negName, zone) {
+				backends = append(backends, backend)
+				continue
+			}
+			changed = true
+			if !linked {
+				relinked := *backend
+				relinked.Group = selfLink
+				backends = append(backends, &relinked)
+				linked = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		klog.V(2).Infof("Relinking backend service %q from NEG %q in %q to %q.", bs.Name, negName, zone, selfLink)
+		bs.Backends = backends
+		if err := r.backendServices.UpdateBackendService(bs); err != nil {
+			return fmt.Errorf("failed to relink backend service %q: %v", bs.Name, err)
+		}
+	}
+	return nil
+}
+
+// ensureNEGWithEndpoints creates the NEG in the zone unless it exists, and
+// attaches the endpoints it misses. Returns the NEG.
+func ensureNEGWithEndpoints(cloud negtypes.NetworkEndpointGroupCloud, neg *compute.NetworkEndpointGroup, zone string, endpoints negtypes.NetworkEndpointSet) (*compute.NetworkEndpointGroup, error) {
+	klog.V(2).Infof("Creating NEG %q in %q.", neg.Name, zone)
+	if err := cloud.CreateNetworkEndpointGroup(neg, zone); err != nil && !utils.IsHTTPErrorCode(err, http.StatusConflict) {
+		return nil, err
+	}
+	existing := negtypes.NewNetworkEndpointSet()
+	if err := retrieveExistingNetworkEndpoints(neg.Name, zone, cloud, existing); err != nil {
+		return nil, err
+	}
+	missing := endpoints.Difference(existing)
+	for missing.Len() > 0 {
+		batch, err := makeEndpointBatch(missing)
+		if err != nil {
+			return nil, err
+		}
+		var networkEndpoints []*compute.NetworkEndpoint
+		for _, ne := range batch {
+			networkEndpoints = append(networkEndpoints, ne)
+		}
+		if err := cloud.AttachNetworkEndpoints(neg.Name, zone, networkEndpoints); err != nil {
+			return nil, err
+		}
+	}
+	return cloud.GetNetworkEndpointGroup(neg.Name, zone)
+}
+
+// ReplacementNEGName returns the name of the NEG replacing the NEG with the
+// given name while it is recreated. It has the prefix of the NEG.
+func ReplacementNEGName(negName string) string {
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(negName)))[:8]
+	if maxLen := 63 - len(hash) - 1; len(negName) > maxLen {
+		negName = strings.TrimRight(negName[:maxLen], "-")
+	}
+	return negName + "-" + hash
+}
+
+// negMismatch describes how the NEG differs from the NEGs of the syncers, in
+// the given network and subnetwork, or returns an empty string if it does not.
+func negMismatch(neg *compute.NetworkEndpointGroup, networkURL, subnetworkURL string) string {
+	switch {
+	case neg.NetworkEndpointType != string(negtypes.VmIpPortEndpointType):
+		return fmt.Sprintf("network endpoint type %q instead of %q", neg.NetworkEndpointType, negtypes.VmIpPortEndpointType)
+	case !utils.EqualResourceIDs(neg.Network, networkURL):
+		return fmt.Sprintf("network %q instead of %q", neg.Network, networkURL)
+	case !utils.EqualResourceIDs(neg.Subnetwork, subnetworkURL):
+		return fmt.Sprintf("subnetwork %q instead of %q", neg.Subnetwork, subnetworkURL)
+	}
+	return ""
+}
+
+// zoneSubnetworkURL returns the subnetwork of the NEGs in the zone, the one
+// configured for the zone if any, otherwise the subnetwork of the cluster.
+func zoneSubnetworkURL(cloud negtypes.NetworkEndpointGroupCloud, zone string) string {
+	if subnetwork, ok := flags.F.NegZoneSubnetworks.Subnetwork(zone); ok {
+		return subnetwork
+	}
+	return cloud.SubnetworkURL()
+}
+
 // toZoneNetworkEndpointMap translates addresses in endpoints object and Istio:DestinationRule subset into zone and endpoints map
 func toZoneNetworkEndpointMap(endpoints *apiv1.Endpoints, zoneGetter negtypes.ZoneGetter, targetPort string, podLister cache.Indexer, subsetLables string) (map[string]negtypes.NetworkEndpointSet, negtypes.EndpointPodMap, error) {
 	zoneNetworkEndpointMap := map[string]negtypes.NetworkEndpointSet{}
@@ -244,6 +585,26 @@ func toZoneNetworkEndpointMap(endpoints *apiv1.Endpoints, zoneGetter negtypes.Zo
 	return zoneNetworkEndpointMap, networkEndpointPodMap, nil
 }
 
+// negZones returns the zones of the NEG of the syncer key among the zones of
+// the cluster, and whether its Service pins them to a subset of the zones of
+// the cluster with the cloud.google.com/neg-zones annotation.
+func negZones(key negtypes.NegSyncerKey, zoneGetter negtypes.ZoneGetter, serviceLister cache.Indexer) ([]string, bool, error) {
+	zones, err := zoneGetter.ListZones()
+	if err != nil || key.ServiceEntry {
+		return zones, false, err
+	}
+	obj, exists, err := serviceLister.GetByKey(key.Namespace + "/" + key.Name)
+	if err != nil || !exists {
+		return zones, false, err
+	}
+	pinned, ok := annotations.FromService(obj.(*v1.Service)).NEGZones()
+	if !ok {
+		return zones, false, nil
+	}
+	zones, _ = negtypes.PinnedZones(zones, pinned)
+	return zones, true, nil
+}
+
 // retrieveExistingZoneNetworkEndpointMap lists existing network endpoints in the neg and return the zone and endpoints map
 func retrieveExistingZoneNetworkEndpointMap(negName string, zoneGetter negtypes.ZoneGetter, cloud negtypes.NetworkEndpointGroupCloud) (map[string]negtypes.NetworkEndpointSet, error) {
 	zones, err := zoneGetter.ListZones()
@@ -254,17 +615,25 @@ func retrieveExistingZoneNetworkEndpointMap(negName string, zoneGetter negtypes.
 	zoneNetworkEndpointMap := map[string]negtypes.NetworkEndpointSet{}
 	for _, zone := range zones {
 		zoneNetworkEndpointMap[zone] = negtypes.NewNetworkEndpointSet()
-		networkEndpointsWithHealthStatus, err := cloud.ListNetworkEndpoints(negName, zone, false)
-		if err != nil {
+		if err := retrieveExistingNetworkEndpoints(negName, zone, cloud, zoneNetworkEndpointMap[zone]); err != nil {
 			return nil, err
 		}
-		for _, ne := range networkEndpointsWithHealthStatus {
-			zoneNetworkEndpointMap[zone].Insert(negtypes.NetworkEndpoint{IP: ne.NetworkEndpoint.IpAddress, Node: ne.NetworkEndpoint.Instance, Port: strconv.FormatInt(ne.NetworkEndpoint.Port, 10)})
-		}
 	}
 	return zoneNetworkEndpointMap, nil
 }
 
+// retrieveExistingNetworkEndpoints lists the existing network endpoints of the neg in a zone and inserts them into endpointSet.
+func retrieveExistingNetworkEndpoints(negName, zone string, cloud negtypes.NetworkEndpointGroupCloud, endpointSet negtypes.NetworkEndpointSet) error {
+	networkEndpointsWithHealthStatus, err := cloud.ListNetworkEndpoints(negName, zone, false)
+	if err != nil {
+		return err
+	}
+	for _, ne := range networkEndpointsWithHealthStatus {
+		endpointSet.Insert(negtypes.NetworkEndpoint{IP: ne.NetworkEndpoint.IpAddress, Node: ne.NetworkEndpoint.Instance, Port: strconv.FormatInt(ne.NetworkEndpoint.Port, 10)})
+	}
+	return nil
+}
+
 // makeEndpointBatch return a batch of endpoint from the input and remove the endpoints from input set
 // The return map has the encoded endpoint as key and GCE network endpoint object as value
 func makeEndpointBatch(endpoints negtypes.NetworkEndpointSet) (map[negtypes.NetworkEndpoint]*compute.NetworkEndpoint, error) {
@@ -290,6 +659,221 @@ func makeEndpointBatch(endpoints negtypes.NetworkEndpointSet) (map[negtypes.Netw
 	return endpointBatch, nil
 }
 
+// warmEndpoints returns a new set with at most MAX_NETWORK_ENDPOINTS_PER_BATCH endpoints
+// from the input, preferring the endpoints whose pods have been Ready the longest.
+// Endpoints whose pods cannot be found or are not Ready are picked last.
+func warmEndpoints(endpoints negtypes.NetworkEndpointSet, endpointPodMap negtypes.EndpointPodMap, podLister cache.Indexer) negtypes.NetworkEndpointSet {
+	candidates := endpoints.List()
+	readyTimes := map[negtypes.NetworkEndpoint]time.Time{}
+	for _, endpoint := range candidates {
+		if podName, ok := endpointPodMap[endpoint]; ok {
+			if readyTime, ok := podReadyTime(podLister, podName.Namespace, podName.Name); ok {
+				readyTimes[endpoint] = readyTime
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		ti, iReady := readyTimes[candidates[i]]
+		tj, jReady := readyTimes[candidates[j]]
+		if iReady != jReady {
+			return iReady
+		}
+		return ti.Before(tj)
+	})
+
+	if len(candidates) > MAX_NETWORK_ENDPOINTS_PER_BATCH {
+		candidates = candidates[:MAX_NETWORK_ENDPOINTS_PER_BATCH]
+	}
+	return negtypes.NewNetworkEndpointSet(candidates...)
+}
+
+// operationMethods are the GCE methods of the operations attaching and
+// detaching endpoints.
+var operationMethods = map[string]string{
+	"Attach": "compute.networkEndpointGroups.attachNetworkEndpoints",
+	"Detach": "compute.networkEndpointGroups.detachNetworkEndpoints",
+}
+
+// operationFailedEvent returns the reason and the message of the event of
+// the failure of the operation, "Attach" or "Detach", of count endpoints of
+// the NEG in the zone. The reason is typed after the GCE error, e.g.
+// AttachPermissionDenied, and the operation is counted by the OperationErrors
+// metric.
+func operationFailedEvent(operation string, count int, negName, zone string, err error) (string, string) {
+	reason, msg := negtypes.ParseOperationError(err, operationMethods[operation])
+	metrics.OperationErrors.WithLabelValues(operation, string(reason)).Inc()
+	eventReason := operation + string(reason)
+	if reason == negtypes.ReasonUnknown {
+		eventReason = operation + "Failed"
+	}
+	return eventReason, fmt.Sprintf("Failed to %s %d network endpoint(s) (NEG %q in zone %q): %s", operation, count, negName, zone, msg)
+}
+
+// truncateEndpoints removes the endpoints beyond maxEndpoints from each zone
+// of the target map, keeping the lowest ones by IP and port so that the same
+// endpoints are kept from one sync to the next. It returns the number of
+// endpoints removed from each truncated zone of the target map.
+func truncateEndpoints(targetMap map[string]negtypes.NetworkEndpointSet, maxEndpoints int) map[string]int {
+	truncated := map[string]int{}
+	for zone, endpoints := range targetMap {
+		if maxEndpoints <= 0 || endpoints.Len() <= maxEndpoints {
+			continue
+		}
+		list := endpoints.List()
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].IP != list[j].IP {
+				return list[i].IP < list[j].IP
+			}
+			return list[i].Port < list[j].Port
+		})
+		for _, endpoint := range list[maxEndpoints:] {
+			endpoints.Delete(endpoint)
+		}
+		truncated[zone] = len(list) - maxEndpoints
+	}
+	return truncated
+}
+
+// podDeletionCostAnnotation is the annotation of the cost of deleting a pod
+// compared to the other pods of its ReplicaSet, lower costs first.
+const podDeletionCostAnnotation = "controller.kubernetes.io/pod-deletion-cost"
+
+// detachCandidate is an endpoint to detach from a NEG.
+type detachCandidate struct {
+	endpoint negtypes.NetworkEndpoint
+	// serving is true if the pod of the endpoint exists, is Ready and is not
+	// being deleted, so that detaching the endpoint makes it unavailable.
+	serving bool
+	// unschedulable is true if the node of the endpoint is cordoned or
+	// drained.
+	unschedulable bool
+	deletionCost  int64
+}
+
+// detachEndpoints returns the endpoints to detach from a NEG in a zone in a
+// sync, at most a batch. The endpoints of the pods which are not serving are
+// detached first, then those on unschedulable nodes, then those of the pods
+// with the lowest deletion cost. If maxUnavailable is positive, at most
+// maxUnavailable endpoints of serving pods are detached at a time, counting
+// the detachments in progress, and the others are left for the next syncs.
+func detachEndpoints(endpoints negtypes.NetworkEndpointSet, namespace string, inProgress, maxUnavailable int, podLister, nodeLister cache.Indexer) negtypes.NetworkEndpointSet {
+	if maxUnavailable <= 0 && endpoints.Len() <= MAX_NETWORK_ENDPOINTS_PER_BATCH {
+		return endpoints
+	}
+
+	pods := podsByIP(podLister, namespace)
+	candidates := make([]detachCandidate, 0, endpoints.Len())
+	for endpoint := range endpoints {
+		c := detachCandidate{endpoint: endpoint, unschedulable: nodeUnschedulable(nodeLister, endpoint.Node)}
+		if pod, ok := pods[endpoint.IP]; ok {
+			c.serving = pod.DeletionTimestamp == nil && podReady(pod)
+			c.deletionCost, _ = strconv.ParseInt(pod.Annotations[podDeletionCostAnnotation], 10, 32)
+		}
+		candidates = append(candidates, c)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		ci, cj := candidates[i], candidates[j]
+		if ci.serving != cj.serving {
+			return !ci.serving
+		}
+		if ci.unschedulable != cj.unschedulable {
+			return ci.unschedulable
+		}
+		if ci.deletionCost != cj.deletionCost {
+			return ci.deletionCost < cj.deletionCost
+		}
+		return ci.endpoint.IP < cj.endpoint.IP
+	})
+
+	ret := negtypes.NewNetworkEndpointSet()
+	unavailable := inProgress
+	for _, c := range candidates {
+		if ret.Len() == MAX_NETWORK_ENDPOINTS_PER_BATCH {
+			break
+		}
+		if c.serving {
+			if maxUnavailable > 0 && unavailable >= maxUnavailable {
+				klog.V(2).Infof("Holding back the detachment of %d endpoint(s) of serving pods to keep at most %d unavailable", endpoints.Len()-ret.Len(), maxUnavailable)
+				break
+			}
+			unavailable++
+		}
+		ret.Insert(c.endpoint)
+	}
+	return ret
+}
+
+// podsByIP returns the pods of the namespace by IP.
+func podsByIP(podLister cache.Indexer, namespace string) map[string]*v1.Pod {
+	ret := map[string]*v1.Pod{}
+	if podLister == nil {
+		return ret
+	}
+	objs, err := podLister.ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil {
+		klog.Errorf("Failed to list pods in namespace %q: %v", namespace, err)
+		return ret
+	}
+	for _, obj := range objs {
+		if pod, ok := obj.(*v1.Pod); ok && pod.Status.PodIP != "" {
+			ret[pod.Status.PodIP] = pod
+		}
+	}
+	return ret
+}
+
+// nodeUnschedulable returns true if the node exists and is unschedulable.
+func nodeUnschedulable(nodeLister cache.Indexer, name string) bool {
+	if nodeLister == nil {
+		return false
+	}
+	obj, exists, err := nodeLister.GetByKey(name)
+	if err != nil || !exists {
+		return false
+	}
+	node, ok := obj.(*v1.Node)
+	return ok && node.Spec.Unschedulable
+}
+
+// podReady returns true if the pod is Ready.
+func podReady(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// podReadyTime returns the time the pod last became Ready.
+// It returns false if the pod does not exist or is not Ready.
+func podReadyTime(podLister cache.Indexer, namespace, name string) (time.Time, bool) {
+	if podLister == nil {
+		return time.Time{}, false
+	}
+	key := keyFunc(namespace, name)
+	obj, exists, err := podLister.GetByKey(key)
+	if err != nil {
+		klog.Errorf("Failed to retrieve pod %s from pod lister: %v", key, err)
+		return time.Time{}, false
+	}
+	if !exists {
+		return time.Time{}, false
+	}
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		klog.Errorf("Failed to convert obj %s to v1.Pod. The object type is %T", key, obj)
+		return time.Time{}, false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady && condition.Status == v1.ConditionTrue {
+			return condition.LastTransitionTime.Time, true
+		}
+	}
+	return time.Time{}, false
+}
+
 func keyFunc(namespace, name string) string {
 	return fmt.Sprintf("%s/%s", namespace, name)
 }
@@ -17,17 +17,27 @@ limitations under the License.
 package syncers
 
 import (
+	"net/http"
 	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"fmt"
 
+	"github.com/google/go-cmp/cmp"
 	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/flags"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
 	"k8s.io/legacy-cloud-providers/gce"
 )
@@ -292,10 +302,118 @@ func TestNetworkEndpointCalculateDifference(t *testing.T) {
 	}
 }
 
+func TestReleaseNetworkEndpointSets(t *testing.T) {
+	t.Parallel()
+
+	targetMap := map[string]negtypes.NetworkEndpointSet{
+		negtypes.TestZone1: negtypes.NewNetworkEndpointSet(genNetworkEndpoint("a"), genNetworkEndpoint("b")),
+	}
+	currentMap := map[string]negtypes.NetworkEndpointSet{
+		negtypes.TestZone1: negtypes.NewNetworkEndpointSet(genNetworkEndpoint("b"), genNetworkEndpoint("c")),
+	}
+	addSet, removeSet := calculateNetworkEndpointDifference(targetMap, currentMap)
+	releaseNetworkEndpointSets(addSet)
+	releaseNetworkEndpointSets(removeSet)
+	if len(addSet) != 0 || len(removeSet) != 0 {
+		t.Errorf("Got add set %v and remove set %v after release, want empty maps", addSet, removeSet)
+	}
+
+	// Released sets must not leak endpoints into later calculations.
+	addSet, removeSet = calculateNetworkEndpointDifference(targetMap, currentMap)
+	wantAdd := map[string]negtypes.NetworkEndpointSet{negtypes.TestZone1: negtypes.NewNetworkEndpointSet(genNetworkEndpoint("a"))}
+	wantRemove := map[string]negtypes.NetworkEndpointSet{negtypes.TestZone1: negtypes.NewNetworkEndpointSet(genNetworkEndpoint("c"))}
+	if !reflect.DeepEqual(addSet, wantAdd) || !reflect.DeepEqual(removeSet, wantRemove) {
+		t.Errorf("calculateNetworkEndpointDifference() = %v, %v, want %v, %v", addSet, removeSet, wantAdd, wantRemove)
+	}
+}
+
+func genZoneNetworkEndpointMap(zones, endpointsPerZone int) map[string]negtypes.NetworkEndpointSet {
+	ret := map[string]negtypes.NetworkEndpointSet{}
+	for z := 0; z < zones; z++ {
+		endpointSet := negtypes.NewNetworkEndpointSet()
+		for i := 0; i < endpointsPerZone; i++ {
+			endpointSet.Insert(genNetworkEndpoint(fmt.Sprintf("%d-%d", z, i)))
+		}
+		ret[fmt.Sprintf("zone%d", z)] = endpointSet
+	}
+	return ret
+}
+
+func BenchmarkCalculateNetworkEndpointDifference(b *testing.B) {
+	for _, bc := range []struct {
+		desc             string
+		zones            int
+		endpointsPerZone int
+		changed          int
+	}{
+		{desc: "unchanged", zones: 3, endpointsPerZone: 1000, changed: 0},
+		{desc: "changed", zones: 3, endpointsPerZone: 1000, changed: 50},
+		{desc: "unchanged-50k", zones: 5, endpointsPerZone: 10000, changed: 0},
+		{desc: "changed-50k", zones: 5, endpointsPerZone: 10000, changed: 500},
+	} {
+		b.Run(bc.desc, func(b *testing.B) {
+			targetMap := genZoneNetworkEndpointMap(bc.zones, bc.endpointsPerZone)
+			currentMap := genZoneNetworkEndpointMap(bc.zones, bc.endpointsPerZone)
+			for i := 0; i < bc.changed; i++ {
+				currentMap["zone0"].Delete(genNetworkEndpoint(fmt.Sprintf("0-%d", i)))
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				addSet, removeSet := calculateNetworkEndpointDifference(targetMap, currentMap)
+				releaseNetworkEndpointSets(addSet)
+				releaseNetworkEndpointSets(removeSet)
+			}
+		})
+	}
+}
+
+// genEndpoints returns an Endpoints object with numEndpoints addresses of
+// pods spread over the nodes of the fake zone getter, a tenth of them not
+// ready.
+func genEndpoints(numEndpoints int) *v1.Endpoints {
+	nodes := []string{negtypes.TestInstance1, negtypes.TestInstance2, negtypes.TestInstance3, negtypes.TestInstance4}
+	subset := v1.EndpointSubset{Ports: []v1.EndpointPort{{Name: "http", Port: 8080, Protocol: v1.ProtocolTCP}}}
+	for i := 0; i < numEndpoints; i++ {
+		node := nodes[i%len(nodes)]
+		address := v1.EndpointAddress{
+			IP:        fmt.Sprintf("10.%d.%d.%d", i/65536, i/256%256, i%256),
+			NodeName:  &node,
+			TargetRef: &v1.ObjectReference{Kind: "Pod", Namespace: testServiceNamespace, Name: fmt.Sprintf("pod%d", i)},
+		}
+		if i%10 == 0 {
+			subset.NotReadyAddresses = append(subset.NotReadyAddresses, address)
+		} else {
+			subset.Addresses = append(subset.Addresses, address)
+		}
+	}
+	return &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testServiceNamespace, Name: testServiceName},
+		Subsets:    []v1.EndpointSubset{subset},
+	}
+}
+
+func BenchmarkToZoneNetworkEndpointMap(b *testing.B) {
+	for _, numEndpoints := range []int{1000, 50000} {
+		b.Run(fmt.Sprintf("endpoints-%d", numEndpoints), func(b *testing.B) {
+			endpoints := genEndpoints(numEndpoints)
+			zoneGetter := negtypes.NewFakeZoneGetter()
+			podLister := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := toZoneNetworkEndpointMap(endpoints, zoneGetter, "8080", podLister, ""); err != nil {
+					b.Fatalf("toZoneNetworkEndpointMap() = %v, want nil", err)
+				}
+			}
+		})
+	}
+}
+
 func TestToZoneNetworkEndpointMapUtil(t *testing.T) {
 	t.Parallel()
 	_, transactionSyncer := newTestTransactionSyncer(negtypes.NewAdapter(gce.NewFakeGCECloud(gce.DefaultTestClusterValues())))
-	podLister := transactionSyncer.podLister
+	podLister := transactionSyncer.endpointsCalculator.(*serviceEndpointsCalculator).podLister
 
 	// add all pods in default endpoint into podLister
 	for i := 1; i <= 12; i++ {
@@ -623,12 +741,174 @@ func TestMakeEndpointBatch(t *testing.T) {
 	}
 }
 
+func TestWarmEndpoints(t *testing.T) {
+	t.Parallel()
+
+	_, transactionSyncer := newTestTransactionSyncer(negtypes.NewAdapter(gce.NewFakeGCECloud(gce.DefaultTestClusterValues())))
+	podLister := transactionSyncer.podLister
+
+	now := time.Now()
+	testCases := []struct {
+		desc        string
+		endpointNum int
+		// readyAge returns how long the pod of the i-th endpoint has been Ready.
+		// A negative value means the pod is not Ready.
+		readyAge    func(i int) time.Duration
+		expectBatch func(i int) bool
+	}{
+		{
+			desc:        "fewer endpoints than a batch",
+			endpointNum: 10,
+			readyAge:    func(i int) time.Duration { return time.Duration(i) * time.Second },
+			expectBatch: func(i int) bool { return true },
+		},
+		{
+			desc:        "longest ready pods first",
+			endpointNum: 600,
+			readyAge:    func(i int) time.Duration { return time.Duration(i) * time.Second },
+			expectBatch: func(i int) bool { return i >= 100 },
+		},
+		{
+			desc:        "pods that are not ready last",
+			endpointNum: 600,
+			readyAge: func(i int) time.Duration {
+				if i%6 == 0 {
+					return -1
+				}
+				return time.Minute
+			},
+			expectBatch: func(i int) bool { return i%6 != 0 },
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			namespace := fmt.Sprintf("ns%d", i)
+			endpointSet, _ := genTestEndpoints(tc.endpointNum)
+			endpointPodMap := negtypes.EndpointPodMap{}
+			for j := 0; j < tc.endpointNum; j++ {
+				endpoint := negtypes.NetworkEndpoint{IP: "1.2.3.4", Node: "instance", Port: strconv.Itoa(j)}
+				pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: fmt.Sprintf("pod%d", j)}}
+				if age := tc.readyAge(j); age >= 0 {
+					pod.Status.Conditions = []v1.PodCondition{{
+						Type:               v1.PodReady,
+						Status:             v1.ConditionTrue,
+						LastTransitionTime: metav1.NewTime(now.Add(-age)),
+					}}
+				}
+				podLister.Add(pod)
+				endpointPodMap[endpoint] = types.NamespacedName{Namespace: namespace, Name: pod.Name}
+			}
+
+			out := warmEndpoints(endpointSet, endpointPodMap, podLister)
+			for j := 0; j < tc.endpointNum; j++ {
+				endpoint := negtypes.NetworkEndpoint{IP: "1.2.3.4", Node: "instance", Port: strconv.Itoa(j)}
+				if out.Has(endpoint) != tc.expectBatch(j) {
+					t.Errorf("Expect endpoint %v in batch = %v, but got %v", endpoint, tc.expectBatch(j), out.Has(endpoint))
+				}
+			}
+		})
+	}
+}
+
+func TestTruncateEndpoints(t *testing.T) {
+	t.Parallel()
+
+	endpoint := func(ip, port string) negtypes.NetworkEndpoint {
+		return negtypes.NetworkEndpoint{IP: ip, Node: "instance", Port: port}
+	}
+	targetMap := map[string]negtypes.NetworkEndpointSet{
+		negtypes.TestZone1: negtypes.NewNetworkEndpointSet(endpoint("10.0.0.3", "80"), endpoint("10.0.0.1", "81"), endpoint("10.0.0.1", "80"), endpoint("10.0.0.2", "80")),
+		negtypes.TestZone2: negtypes.NewNetworkEndpointSet(endpoint("10.0.1.1", "80")),
+	}
+
+	truncated := truncateEndpoints(targetMap, 2)
+	if want := map[string]int{negtypes.TestZone1: 2}; !reflect.DeepEqual(truncated, want) {
+		t.Errorf("truncateEndpoints() = %v, want %v", truncated, want)
+	}
+	want := map[string]negtypes.NetworkEndpointSet{
+		negtypes.TestZone1: negtypes.NewNetworkEndpointSet(endpoint("10.0.0.1", "80"), endpoint("10.0.0.1", "81")),
+		negtypes.TestZone2: negtypes.NewNetworkEndpointSet(endpoint("10.0.1.1", "80")),
+	}
+	if !reflect.DeepEqual(targetMap, want) {
+		t.Errorf("Got target map %v, want %v", targetMap, want)
+	}
+
+	if truncated := truncateEndpoints(targetMap, 0); len(truncated) != 0 || targetMap[negtypes.TestZone1].Len() != 2 {
+		t.Errorf("truncateEndpoints() with no maximum = %v, left %d endpoints, want no truncation", truncated, targetMap[negtypes.TestZone1].Len())
+	}
+}
+
+func TestDetachEndpoints(t *testing.T) {
+	t.Parallel()
+
+	podLister := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	nodeLister := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	nodeLister.Add(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	nodeLister.Add(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}, Spec: v1.NodeSpec{Unschedulable: true}})
+
+	ready := []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+	now := metav1.Now()
+	for _, pod := range []*v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "serving"}, Status: v1.PodStatus{PodIP: "10.0.0.1", Conditions: ready}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "cordoned"}, Status: v1.PodStatus{PodIP: "10.0.0.2", Conditions: ready}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "cheap", Annotations: map[string]string{podDeletionCostAnnotation: "-10"}}, Status: v1.PodStatus{PodIP: "10.0.0.3", Conditions: ready}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "deleted", DeletionTimestamp: &now}, Status: v1.PodStatus{PodIP: "10.0.0.5", Conditions: ready}},
+	} {
+		pod.Namespace = testNamespace
+		podLister.Add(pod)
+	}
+	endpoint := func(ip, node string) negtypes.NetworkEndpoint {
+		return negtypes.NetworkEndpoint{IP: ip, Node: node, Port: "80"}
+	}
+	serving := endpoint("10.0.0.1", "node1")
+	cordoned := endpoint("10.0.0.2", "node2")
+	cheap := endpoint("10.0.0.3", "node1")
+	gone := endpoint("10.0.0.4", "node1")
+	deleted := endpoint("10.0.0.5", "node1")
+	endpoints := negtypes.NewNetworkEndpointSet(serving, cordoned, cheap, gone, deleted)
+
+	for _, tc := range []struct {
+		desc           string
+		inProgress     int
+		maxUnavailable int
+		want           negtypes.NetworkEndpointSet
+	}{
+		{
+			desc: "unlimited",
+			want: endpoints,
+		},
+		{
+			desc:           "cordoned nodes and low deletion costs first",
+			maxUnavailable: 2,
+			want:           negtypes.NewNetworkEndpointSet(cordoned, cheap, gone, deleted),
+		},
+		{
+			desc:           "detachments in progress count",
+			inProgress:     1,
+			maxUnavailable: 2,
+			want:           negtypes.NewNetworkEndpointSet(cordoned, gone, deleted),
+		},
+		{
+			desc:           "endpoints of pods which are not serving are always detached",
+			inProgress:     1,
+			maxUnavailable: 1,
+			want:           negtypes.NewNetworkEndpointSet(gone, deleted),
+		},
+	} {
+		got := detachEndpoints(negtypes.NewNetworkEndpointSet(endpoints.List()...), testNamespace, tc.inProgress, tc.maxUnavailable, podLister, nodeLister)
+		if !got.Equal(tc.want) {
+			t.Errorf("%s: detachEndpoints() = %v, want %v", tc.desc, got.List(), tc.want.List())
+		}
+	}
+}
+
 func TestShouldPodBeInNeg(t *testing.T) {
 	t.Parallel()
 
 	_, transactionSyncer := newTestTransactionSyncer(negtypes.NewAdapter(gce.NewFakeGCECloud(gce.DefaultTestClusterValues())))
 
-	podLister := transactionSyncer.podLister
+	podLister := transactionSyncer.endpointsCalculator.(*serviceEndpointsCalculator).podLister
 
 	namespace1 := "ns1"
 	namespace2 := "ns2"
@@ -721,3 +1001,358 @@ func networkEndpointFromEncodedEndpoint(encodedEndpoint string) negtypes.Network
 	ip, node, port := decodeEndpoint(encodedEndpoint)
 	return negtypes.NetworkEndpoint{IP: ip, Node: node, Port: port}
 }
+
+// conflictingNEGCloud creates a NEG like a concurrent creator would, and then
+// fails with alreadyExists.
+type conflictingNEGCloud struct {
+	negtypes.NetworkEndpointGroupCloud
+	network string
+}
+
+func (c *conflictingNEGCloud) CreateNetworkEndpointGroup(neg *compute.NetworkEndpointGroup, zone string) error {
+	neg.Network = c.network
+	if err := c.NetworkEndpointGroupCloud.CreateNetworkEndpointGroup(neg, zone); err != nil {
+		return err
+	}
+	return &googleapi.Error{Code: http.StatusConflict, Message: "alreadyExists"}
+}
+
+// inUseNEGCloud fails to delete NEGs as if they were used by a backend
+// service, either always if backendServices is nil, or if one of the backend
+// services of backendServices uses them.
+type inUseNEGCloud struct {
+	negtypes.NetworkEndpointGroupCloud
+	backendServices *fakeBackendServiceCloud
+}
+
+func (c *inUseNEGCloud) DeleteNetworkEndpointGroup(name, zone string) error {
+	inUse := c.backendServices == nil
+	if c.backendServices != nil {
+		for _, bs := range c.backendServices.backendServices {
+			for _, backend := range bs.Backends {
+				inUse = inUse || negtypes.IsNEGBackend(backend, name, zone)
+			}
+		}
+	}
+	if inUse {
+		return &googleapi.Error{Code: http.StatusBadRequest, Message: fmt.Sprintf("The network_endpoint_group resource %q is already being used by a backend service", name)}
+	}
+	return c.NetworkEndpointGroupCloud.DeleteNetworkEndpointGroup(name, zone)
+}
+
+// failingNEGCloud fails the first call of an operation, "create" or "delete",
+// on the NEG with the given name.
+type failingNEGCloud struct {
+	negtypes.NetworkEndpointGroupCloud
+	op, name string
+}
+
+func (c *failingNEGCloud) fail(op, name string) error {
+	if c.op != op || c.name != name {
+		return nil
+	}
+	c.op = ""
+	return fmt.Errorf("injected error for the %s of NEG %q", op, name)
+}
+
+func (c *failingNEGCloud) CreateNetworkEndpointGroup(neg *compute.NetworkEndpointGroup, zone string) error {
+	if err := c.fail("create", neg.Name); err != nil {
+		return err
+	}
+	return c.NetworkEndpointGroupCloud.CreateNetworkEndpointGroup(neg, zone)
+}
+
+func (c *failingNEGCloud) DeleteNetworkEndpointGroup(name, zone string) error {
+	if err := c.fail("delete", name); err != nil {
+		return err
+	}
+	return c.NetworkEndpointGroupCloud.DeleteNetworkEndpointGroup(name, zone)
+}
+
+type fakeBackendServiceCloud struct {
+	backendServices []*composite.BackendService
+	// updateErrs are returned by the next updates of the backend services.
+	updateErrs []error
+}
+
+func (f *fakeBackendServiceCloud) ListBackendServices() ([]*composite.BackendService, error) {
+	var ret []*composite.BackendService
+	for _, bs := range f.backendServices {
+		copy := *bs
+		copy.Backends = append([]*composite.Backend{}, bs.Backends...)
+		ret = append(ret, &copy)
+	}
+	return ret, nil
+}
+
+func (f *fakeBackendServiceCloud) UpdateBackendService(bs *composite.BackendService) error {
+	if len(f.updateErrs) > 0 {
+		err := f.updateErrs[0]
+		f.updateErrs = f.updateErrs[1:]
+		if err != nil {
+			return err
+		}
+	}
+	for i := range f.backendServices {
+		if f.backendServices[i].Name == bs.Name {
+			// Later changes of bs by the caller are not saved.
+			copy := *bs
+			f.backendServices[i] = &copy
+		}
+	}
+	return nil
+}
+
+func TestEnsureNetworkEndpointGroup(t *testing.T) {
+	const (
+		negName      = "neg"
+		zone         = "zone1"
+		networkURL   = "https://www.googleapis.com/compute/v1/projects/mock-project/global/networks/test-network"
+		subnetURL    = "https://www.googleapis.com/compute/v1/projects/mock-project/regions/test-region/subnetworks/test-subnetwork"
+		otherNetwork = "https://www.googleapis.com/compute/v1/projects/mock-project/global/networks/other-network"
+	)
+
+	t.Run("concurrent syncers", func(t *testing.T) {
+		fakeCloud := negtypes.NewFakeNetworkEndpointGroupCloud(subnetURL, networkURL)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(port int) {
+				defer wg.Done()
+				if err := ensureNetworkEndpointGroup(testServiceNamespace, testServiceName, negName, zone, strconv.Itoa(port), fakeCloud, nil, nil, nil); err != nil {
+					t.Errorf("ensureNetworkEndpointGroup() = %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		negs, err := fakeCloud.ListNetworkEndpointGroup(zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(negs) != 1 {
+			t.Errorf("got %d NEGs, want 1", len(negs))
+		}
+	})
+
+	for _, tc := range []struct {
+		desc    string
+		network string
+		wantErr bool
+	}{
+		{desc: "already exists in the cluster network", network: networkURL},
+		{desc: "already exists in another network", network: otherNetwork, wantErr: true},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeCloud := &conflictingNEGCloud{negtypes.NewFakeNetworkEndpointGroupCloud(subnetURL, networkURL), tc.network}
+			err := ensureNetworkEndpointGroup(testServiceNamespace, testServiceName, negName, zone, "80", fakeCloud, nil, nil, nil)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("ensureNetworkEndpointGroup() = %v, want err %v", err, tc.wantErr)
+			}
+		})
+	}
+
+	t.Run("subnetwork of the zone", func(t *testing.T) {
+		const zoneSubnetURL = "https://www.googleapis.com/compute/v1/projects/mock-project/regions/test-region/subnetworks/zone-subnetwork"
+		if err := flags.F.NegZoneSubnetworks.Set(zone + "=" + zoneSubnetURL); err != nil {
+			t.Fatal(err)
+		}
+		defer func() { flags.F.NegZoneSubnetworks = flags.ZoneSubnetworks{} }()
+
+		fakeCloud := negtypes.NewFakeNetworkEndpointGroupCloud(subnetURL, networkURL)
+		// The NEGs in the subnetwork of the cluster are recreated in the
+		// subnetwork of their zone.
+		for _, z := range []string{zone, "zone2"} {
+			fakeCloud.CreateNetworkEndpointGroup(&compute.NetworkEndpointGroup{Name: negName, NetworkEndpointType: string(negtypes.VmIpPortEndpointType), Network: networkURL, Subnetwork: subnetURL}, z)
+		}
+		for z, want := range map[string]string{zone: zoneSubnetURL, "zone2": subnetURL} {
+			if err := ensureNetworkEndpointGroup(testServiceNamespace, testServiceName, negName, z, "80", fakeCloud, nil, nil, nil); err != nil {
+				t.Fatalf("ensureNetworkEndpointGroup() = %v", err)
+			}
+			neg, err := fakeCloud.GetNetworkEndpointGroup(negName, z)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if neg.Subnetwork != want {
+				t.Errorf("Got NEG in %q in subnetwork %q, want %q", z, neg.Subnetwork, want)
+			}
+		}
+	})
+
+	t.Run("network endpoint type changed", func(t *testing.T) {
+		endpoint := negtypes.NetworkEndpoint{IP: "10.100.1.1", Node: "instance1", Port: "8080"}
+		for _, tc := range []struct {
+			desc       string
+			inUse      bool
+			replace    bool
+			wantType   negtypes.NetworkEndpointType
+			wantErr    bool
+			wantReason string
+		}{
+			{desc: "NEG not in use", wantType: negtypes.VmIpPortEndpointType, wantReason: "Create"},
+			{desc: "NEG in use", inUse: true, wantType: negtypes.NonGCPPrivateEndpointType, wantErr: true, wantReason: "NEGRecreationBlocked"},
+			{desc: "NEG in use replaced", inUse: true, replace: true, wantType: negtypes.VmIpPortEndpointType, wantReason: "Recreate"},
+		} {
+			t.Run(tc.desc, func(t *testing.T) {
+				var fakeCloud negtypes.NetworkEndpointGroupCloud = negtypes.NewFakeNetworkEndpointGroupCloud(subnetURL, networkURL)
+				fakeCloud.CreateNetworkEndpointGroup(&compute.NetworkEndpointGroup{Name: negName, NetworkEndpointType: string(negtypes.NonGCPPrivateEndpointType), Network: networkURL}, zone)
+				old, err := fakeCloud.GetNetworkEndpointGroup(negName, zone)
+				if err != nil {
+					t.Fatal(err)
+				}
+				backendServices := &fakeBackendServiceCloud{
+					backendServices: []*composite.BackendService{{Name: "k8s1-bs", Backends: []*composite.Backend{{Group: old.SelfLink, BalancingMode: "RATE", MaxRatePerEndpoint: 10}}}},
+				}
+				var replacer *negReplacer
+				if tc.inUse {
+					inUseCloud := &inUseNEGCloud{NetworkEndpointGroupCloud: fakeCloud}
+					if tc.replace {
+						inUseCloud.backendServices = backendServices
+						replacer = &negReplacer{
+							backendServices: backendServices,
+							isManaged:       func(name string) bool { return strings.HasPrefix(name, "k8s1-") },
+							endpoints: func(string) (negtypes.NetworkEndpointSet, error) {
+								return negtypes.NewNetworkEndpointSet(endpoint), nil
+							},
+						}
+					}
+					fakeCloud = inUseCloud
+				}
+				serviceLister := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+				serviceLister.Add(&v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: testServiceNamespace, Name: testServiceName}})
+				recorder := record.NewFakeRecorder(10)
+
+				err = ensureNetworkEndpointGroup(testServiceNamespace, testServiceName, negName, zone, "80", fakeCloud, replacer, serviceLister, recorder)
+				if gotErr := err != nil; gotErr != tc.wantErr {
+					t.Errorf("ensureNetworkEndpointGroup() = %v, want err %v", err, tc.wantErr)
+				}
+				neg, err := fakeCloud.GetNetworkEndpointGroup(negName, zone)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if neg.NetworkEndpointType != string(tc.wantType) {
+					t.Errorf("Got NEG of type %q, want %q", neg.NetworkEndpointType, tc.wantType)
+				}
+				if tc.replace {
+					// The backend service is relinked to the recreated NEG,
+					// which has the endpoints, and the replacement is deleted.
+					wantBackends := []*composite.Backend{{Group: neg.SelfLink, BalancingMode: "RATE", MaxRatePerEndpoint: 10}}
+					if diff := cmp.Diff(wantBackends, backendServices.backendServices[0].Backends); diff != "" {
+						t.Errorf("Got unexpected backends (-want +got):\n%s", diff)
+					}
+					endpoints := negtypes.NewNetworkEndpointSet()
+					if err := retrieveExistingNetworkEndpoints(negName, zone, fakeCloud, endpoints); err != nil {
+						t.Fatal(err)
+					}
+					if !endpoints.Equal(negtypes.NewNetworkEndpointSet(endpoint)) {
+						t.Errorf("Got endpoints %v, want %v", endpoints.List(), endpoint)
+					}
+					if _, err := fakeCloud.GetNetworkEndpointGroup(ReplacementNEGName(negName), zone); err == nil {
+						t.Errorf("Replacement NEG %q was not deleted", ReplacementNEGName(negName))
+					}
+				}
+				var reasons []string
+				for len(recorder.Events) > 0 {
+					reasons = append(reasons, strings.Fields(<-recorder.Events)[1])
+				}
+				if len(reasons) == 0 || reasons[len(reasons)-1] != tc.wantReason {
+					t.Errorf("Got events with reasons %v, want last reason %q", reasons, tc.wantReason)
+				}
+			})
+		}
+	})
+}
+
+// TestEnsureNetworkEndpointGroupInterruptedReplacement asserts that a
+// replacement of a NEG in use interrupted by an error keeps the traffic on the
+// replacement NEG, and is finished by the next sync.
+func TestEnsureNetworkEndpointGroupInterruptedReplacement(t *testing.T) {
+	const (
+		negName    = "neg"
+		zone       = "zone1"
+		networkURL = "https://www.googleapis.com/compute/v1/projects/mock-project/global/networks/test-network"
+		subnetURL  = "https://www.googleapis.com/compute/v1/projects/mock-project/regions/test-region/subnetworks/test-subnetwork"
+	)
+	endpoint := negtypes.NetworkEndpoint{IP: "10.100.1.1", Node: "instance1", Port: "8080"}
+	replacementName := ReplacementNEGName(negName)
+
+	for _, tc := range []struct {
+		desc       string
+		failOp     string
+		updateErrs []error
+	}{
+		{desc: "deleting the NEG fails", failOp: "delete"},
+		{desc: "recreating the NEG fails", failOp: "create"},
+		{desc: "relinking back to the NEG fails", updateErrs: []error{nil, fmt.Errorf("injected update error")}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			fakeCloud := negtypes.NewFakeNetworkEndpointGroupCloud(subnetURL, networkURL)
+			fakeCloud.CreateNetworkEndpointGroup(&compute.NetworkEndpointGroup{Name: negName, NetworkEndpointType: string(negtypes.NonGCPPrivateEndpointType), Network: networkURL}, zone)
+			old, err := fakeCloud.GetNetworkEndpointGroup(negName, zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			backendServices := &fakeBackendServiceCloud{
+				backendServices: []*composite.BackendService{{Name: "k8s1-bs", Backends: []*composite.Backend{{Group: old.SelfLink, BalancingMode: "RATE", MaxRatePerEndpoint: 10}}}},
+				updateErrs:      tc.updateErrs,
+			}
+			cloud := &inUseNEGCloud{
+				NetworkEndpointGroupCloud: &failingNEGCloud{NetworkEndpointGroupCloud: fakeCloud, op: tc.failOp, name: negName},
+				backendServices:           backendServices,
+			}
+			replacer := &negReplacer{
+				backendServices: backendServices,
+				isManaged:       func(name string) bool { return strings.HasPrefix(name, "k8s1-") },
+				endpoints: func(string) (negtypes.NetworkEndpointSet, error) {
+					return negtypes.NewNetworkEndpointSet(endpoint), nil
+				},
+			}
+
+			if err := ensureNetworkEndpointGroup(testServiceNamespace, testServiceName, negName, zone, "80", cloud, replacer, nil, nil); err == nil {
+				t.Fatalf("ensureNetworkEndpointGroup() = nil, want the injected error")
+			}
+			// The traffic stays on the replacement NEG.
+			replacement, err := cloud.GetNetworkEndpointGroup(replacementName, zone)
+			if err != nil {
+				t.Fatalf("Replacement NEG %q was deleted: %v", replacementName, err)
+			}
+			wantBackends := []*composite.Backend{{Group: replacement.SelfLink, BalancingMode: "RATE", MaxRatePerEndpoint: 10}}
+			if diff := cmp.Diff(wantBackends, backendServices.backendServices[0].Backends); diff != "" {
+				t.Errorf("Got unexpected backends after the interrupted replacement (-want +got):\n%s", diff)
+			}
+
+			if err := ensureNetworkEndpointGroup(testServiceNamespace, testServiceName, negName, zone, "80", cloud, replacer, nil, nil); err != nil {
+				t.Fatalf("ensureNetworkEndpointGroup() = %v", err)
+			}
+			neg, err := cloud.GetNetworkEndpointGroup(negName, zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if neg.NetworkEndpointType != string(negtypes.VmIpPortEndpointType) {
+				t.Errorf("Got NEG of type %q, want %q", neg.NetworkEndpointType, negtypes.VmIpPortEndpointType)
+			}
+			wantBackends = []*composite.Backend{{Group: neg.SelfLink, BalancingMode: "RATE", MaxRatePerEndpoint: 10}}
+			if diff := cmp.Diff(wantBackends, backendServices.backendServices[0].Backends); diff != "" {
+				t.Errorf("Got unexpected backends after the next sync (-want +got):\n%s", diff)
+			}
+			endpoints := negtypes.NewNetworkEndpointSet()
+			if err := retrieveExistingNetworkEndpoints(negName, zone, cloud, endpoints); err != nil {
+				t.Fatal(err)
+			}
+			if !endpoints.Equal(negtypes.NewNetworkEndpointSet(endpoint)) {
+				t.Errorf("Got endpoints %v, want %v", endpoints.List(), endpoint)
+			}
+			if _, err := cloud.GetNetworkEndpointGroup(replacementName, zone); err == nil {
+				t.Errorf("Replacement NEG %q was not deleted", replacementName)
+			}
+		})
+	}
+}
+
+func TestReplacementNEGName(t *testing.T) {
+	for _, negName := range []string{"k8s1-uid-ns-svc-80-12345678", "k8s1-" + strings.Repeat("a", 58)} {
+		name := ReplacementNEGName(negName)
+		if len(name) > 63 || name == negName || !strings.HasPrefix(name, "k8s1-") {
+			t.Errorf("ReplacementNEGName(%q) = %q, want a different name of at most 63 characters with the same prefix", negName, name)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+// BackendServiceCloud is an interface for managing the gce backend services
+// referencing network endpoint groups.
+type BackendServiceCloud interface {
+	// ListBackendServices returns the global backend services and the
+	// regional backend services of the region of the cluster.
+	ListBackendServices() ([]*composite.BackendService, error)
+	// UpdateBackendService updates the backend service in its scope.
+	UpdateBackendService(bs *composite.BackendService) error
+}
+
+// NewBackendServiceAdapter takes a Cloud and returns a BackendServiceCloud.
+// The beta API is used so that updating the backends of a backend service
+// does not clear the fields it has beyond the GA API.
+func NewBackendServiceAdapter(g *gce.Cloud) BackendServiceCloud {
+	return &backendServiceAdapter{cloud: g}
+}
+
+type backendServiceAdapter struct {
+	cloud *gce.Cloud
+}
+
+// ListBackendServices implements BackendServiceCloud.
+func (a *backendServiceAdapter) ListBackendServices() ([]*composite.BackendService, error) {
+	var ret []*composite.BackendService
+	for _, scope := range []meta.KeyType{meta.Global, meta.Regional} {
+		key, err := composite.CreateKey(a.cloud, "", scope)
+		if err != nil {
+			return nil, err
+		}
+		list, err := composite.ListBackendServices(a.cloud, key, meta.VersionBeta)
+		if err != nil {
+			return nil, err
+		}
+		for _, bs := range list {
+			bs.Scope = scope
+		}
+		ret = append(ret, list...)
+	}
+	return ret, nil
+}
+
+// UpdateBackendService implements BackendServiceCloud.
+func (a *backendServiceAdapter) UpdateBackendService(bs *composite.BackendService) error {
+	key, err := composite.CreateKey(a.cloud, bs.Name, bs.Scope)
+	if err != nil {
+		return err
+	}
+	return composite.UpdateBackendService(a.cloud, key, bs)
+}
+
+// IsNEGBackend returns true if the group of the backend is the NEG with the
+// given name in the zone.
+func IsNEGBackend(backend *composite.Backend, name, zone string) bool {
+	return strings.HasSuffix(backend.Group, fmt.Sprintf("/zones/%s/networkEndpointGroups/%s", zone, name))
+}
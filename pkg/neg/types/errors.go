@@ -0,0 +1,107 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+)
+
+// OperationErrorReason is the type of the error of a call to the GCE API
+// managing NEGs.
+type OperationErrorReason string
+
+const (
+	ReasonQuotaExceeded    = OperationErrorReason("QuotaExceeded")
+	ReasonPermissionDenied = OperationErrorReason("PermissionDenied")
+	ReasonResourceInUse    = OperationErrorReason("ResourceInUse")
+	ReasonInvalidRequest   = OperationErrorReason("InvalidRequest")
+	ReasonNotFound         = OperationErrorReason("NotFound")
+	// ReasonUnknown is the reason of the errors which are not GCE API errors
+	// or not of the other types, e.g. server errors.
+	ReasonUnknown = OperationErrorReason("Unknown")
+)
+
+// reasonStatuses are the canonical statuses of the reasons, as shown by the
+// GCE API.
+var reasonStatuses = map[OperationErrorReason]string{
+	ReasonQuotaExceeded:    "QUOTA_EXCEEDED",
+	ReasonPermissionDenied: "PERMISSION_DENIED",
+	ReasonResourceInUse:    "RESOURCE_IN_USE",
+	ReasonInvalidRequest:   "INVALID_ARGUMENT",
+	ReasonNotFound:         "NOT_FOUND",
+}
+
+// quotaReasons are the reasons of the GCE API errors of calls exceeding
+// quotas or rate limits.
+var quotaReasons = map[string]bool{
+	"quotaExceeded":         true,
+	"rateLimitExceeded":     true,
+	"userRateLimitExceeded": true,
+}
+
+// ParseOperationError returns the reason of the error of a call to the GCE
+// method, e.g. compute.networkEndpointGroups.attachNetworkEndpoints, and a
+// message naming the method, e.g. "PERMISSION_DENIED on
+// compute.networkEndpointGroups.attachNetworkEndpoints: Required permission".
+func ParseOperationError(err error, method string) (OperationErrorReason, string) {
+	reason := operationErrorReason(err)
+	status, ok := reasonStatuses[reason]
+	if !ok {
+		return reason, err.Error()
+	}
+	msg := err.Error()
+	if apiErr, ok := err.(*googleapi.Error); ok && apiErr.Message != "" {
+		msg = apiErr.Message
+	}
+	return reason, fmt.Sprintf("%s on %s: %s", status, method, msg)
+}
+
+func operationErrorReason(err error) OperationErrorReason {
+	apiErr, ok := err.(*googleapi.Error)
+	if !ok {
+		return ReasonUnknown
+	}
+	for _, item := range apiErr.Errors {
+		switch {
+		case quotaReasons[item.Reason]:
+			return ReasonQuotaExceeded
+		case item.Reason == "resourceInUseByAnotherResource":
+			return ReasonResourceInUse
+		}
+	}
+	switch apiErr.Code {
+	case http.StatusForbidden:
+		if strings.Contains(apiErr.Message, "Quota exceeded") {
+			return ReasonQuotaExceeded
+		}
+		return ReasonPermissionDenied
+	case http.StatusTooManyRequests:
+		return ReasonQuotaExceeded
+	case http.StatusBadRequest:
+		if strings.Contains(apiErr.Message, "being used by") {
+			return ReasonResourceInUse
+		}
+		return ReasonInvalidRequest
+	case http.StatusNotFound:
+		return ReasonNotFound
+	}
+	return ReasonUnknown
+}
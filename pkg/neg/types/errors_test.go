@@ -0,0 +1,90 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestParseOperationError(t *testing.T) {
+	const method = "compute.networkEndpointGroups.attachNetworkEndpoints"
+	serverError := &googleapi.Error{Code: http.StatusInternalServerError, Message: "internal error"}
+	for _, tc := range []struct {
+		desc       string
+		err        error
+		wantReason OperationErrorReason
+		wantMsg    string
+	}{
+		{
+			desc:       "quota",
+			err:        &googleapi.Error{Code: http.StatusForbidden, Message: "Quota exceeded", Errors: []googleapi.ErrorItem{{Reason: "quotaExceeded"}}},
+			wantReason: ReasonQuotaExceeded,
+			wantMsg:    "QUOTA_EXCEEDED on " + method + ": Quota exceeded",
+		},
+		{
+			desc:       "rate limit",
+			err:        &googleapi.Error{Code: http.StatusForbidden, Message: "Rate Limit Exceeded", Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}},
+			wantReason: ReasonQuotaExceeded,
+			wantMsg:    "QUOTA_EXCEEDED on " + method + ": Rate Limit Exceeded",
+		},
+		{
+			desc:       "permission",
+			err:        &googleapi.Error{Code: http.StatusForbidden, Message: "Required 'compute.networkEndpointGroups.attachNetworkEndpoints' permission"},
+			wantReason: ReasonPermissionDenied,
+			wantMsg:    "PERMISSION_DENIED on " + method + ": Required 'compute.networkEndpointGroups.attachNetworkEndpoints' permission",
+		},
+		{
+			desc:       "resource in use",
+			err:        &googleapi.Error{Code: http.StatusBadRequest, Message: "The network_endpoint_group resource 'neg' is already being used by 'backend'"},
+			wantReason: ReasonResourceInUse,
+			wantMsg:    "RESOURCE_IN_USE on " + method + ": The network_endpoint_group resource 'neg' is already being used by 'backend'",
+		},
+		{
+			desc:       "invalid",
+			err:        &googleapi.Error{Code: http.StatusBadRequest, Message: "Invalid value for field 'port'"},
+			wantReason: ReasonInvalidRequest,
+			wantMsg:    "INVALID_ARGUMENT on " + method + ": Invalid value for field 'port'",
+		},
+		{
+			desc:       "not found",
+			err:        NotFoundError,
+			wantReason: ReasonNotFound,
+			wantMsg:    "NOT_FOUND on " + method + ": not Found",
+		},
+		{
+			desc:       "server error",
+			err:        serverError,
+			wantReason: ReasonUnknown,
+			wantMsg:    serverError.Error(),
+		},
+		{
+			desc:       "not an API error",
+			err:        fmt.Errorf("connection refused"),
+			wantReason: ReasonUnknown,
+			wantMsg:    "connection refused",
+		},
+	} {
+		reason, msg := ParseOperationError(tc.err, method)
+		if reason != tc.wantReason || msg != tc.wantMsg {
+			t.Errorf("%s: ParseOperationError() = %q, %q; want %q, %q", tc.desc, reason, msg, tc.wantReason, tc.wantMsg)
+		}
+	}
+}
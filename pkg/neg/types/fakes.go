@@ -18,12 +18,14 @@ package types
 
 import (
 	"fmt"
+	"net/http"
 	"reflect"
 	"sync"
 
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
 	"k8s.io/apimachinery/pkg/util/sets"
 )
 
@@ -82,7 +84,23 @@ func NewFakeNetworkEndpointGroupCloud(subnetwork, network string) NetworkEndpoin
 	}
 }
 
-var NotFoundError = fmt.Errorf("not Found")
+var NotFoundError = &googleapi.Error{Code: http.StatusNotFound, Message: "not Found"}
+
+// badRequestError returns the error of the cloud rejecting an invalid request.
+func badRequestError(format string, args ...interface{}) error {
+	return &googleapi.Error{Code: http.StatusBadRequest, Message: fmt.Sprintf(format, args...)}
+}
+
+// getNEG returns the NEG in the zone, nil if it does not exist. f.mu must be
+// held.
+func (f *FakeNetworkEndpointGroupCloud) getNEG(name, zone string) *compute.NetworkEndpointGroup {
+	for _, neg := range f.NetworkEndpointGroups[zone] {
+		if neg.Name == name {
+			return neg
+		}
+	}
+	return nil
+}
 
 func (f *FakeNetworkEndpointGroupCloud) GetNetworkEndpointGroup(name string, zone string) (*compute.NetworkEndpointGroup, error) {
 	f.mu.Lock()
@@ -91,6 +109,7 @@ func (f *FakeNetworkEndpointGroupCloud) GetNetworkEndpointGroup(name string, zon
 	if ok {
 		for _, neg := range negs {
 			if neg.Name == name {
+				neg.Size = int64(len(f.NetworkEndpoints[networkEndpointKey(name, zone)]))
 				return neg, nil
 			}
 		}
@@ -117,6 +136,10 @@ func (f *FakeNetworkEndpointGroupCloud) AggregatedListNetworkEndpointGroup() (ma
 func (f *FakeNetworkEndpointGroupCloud) CreateNetworkEndpointGroup(neg *compute.NetworkEndpointGroup, zone string) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
+	// Hybrid NEGs are attached to a network only.
+	if neg.NetworkEndpointType == string(NonGCPPrivateEndpointType) && neg.Subnetwork != "" {
+		return badRequestError("subnetwork %q must not be set for %s NEG %q", neg.Subnetwork, NonGCPPrivateEndpointType, neg.Name)
+	}
 	neg.SelfLink = cloud.NewNetworkEndpointGroupsResourceID("mock-project", zone, neg.Name).SelfLink(meta.VersionAlpha)
 	if _, ok := f.NetworkEndpointGroups[zone]; !ok {
 		f.NetworkEndpointGroups[zone] = []*compute.NetworkEndpointGroup{}
@@ -150,6 +173,14 @@ func (f *FakeNetworkEndpointGroupCloud) DeleteNetworkEndpointGroup(name string,
 func (f *FakeNetworkEndpointGroupCloud) AttachNetworkEndpoints(name, zone string, endpoints []*compute.NetworkEndpoint) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
+	// The endpoints of hybrid NEGs are not GCE VMs.
+	if neg := f.getNEG(name, zone); neg != nil && neg.NetworkEndpointType == string(NonGCPPrivateEndpointType) {
+		for _, ne := range endpoints {
+			if ne.Instance != "" {
+				return badRequestError("instance %q must not be set for endpoint %s:%d of %s NEG %q", ne.Instance, ne.IpAddress, ne.Port, NonGCPPrivateEndpointType, name)
+			}
+		}
+	}
 	f.NetworkEndpoints[networkEndpointKey(name, zone)] = append(f.NetworkEndpoints[networkEndpointKey(name, zone)], endpoints...)
 	return nil
 }
@@ -0,0 +1,67 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestFakeHybridNetworkEndpointGroup(t *testing.T) {
+	for _, tc := range []struct {
+		desc       string
+		subnetwork string
+		instance   string
+		wantCreate bool
+		wantAttach bool
+	}{
+		{desc: "valid hybrid NEG", wantCreate: true, wantAttach: true},
+		{desc: "subnetwork set", subnetwork: "test-subnetwork"},
+		{desc: "instance set", instance: TestInstance1, wantCreate: true},
+	} {
+		cloud := NewFakeNetworkEndpointGroupCloud("test-subnetwork", "test-network")
+		neg := &compute.NetworkEndpointGroup{
+			Name:                "neg",
+			NetworkEndpointType: string(NonGCPPrivateEndpointType),
+			Network:             "test-network",
+			Subnetwork:          tc.subnetwork,
+		}
+		err := cloud.CreateNetworkEndpointGroup(neg, TestZone1)
+		if gotCreate := err == nil; gotCreate != tc.wantCreate {
+			t.Errorf("%s: CreateNetworkEndpointGroup() = %v, want success %v", tc.desc, err, tc.wantCreate)
+		}
+		if err != nil {
+			continue
+		}
+		endpoints := []*compute.NetworkEndpoint{{IpAddress: "192.168.0.1", Port: 80, Instance: tc.instance}}
+		err = cloud.AttachNetworkEndpoints("neg", TestZone1, endpoints)
+		if gotAttach := err == nil; gotAttach != tc.wantAttach {
+			t.Errorf("%s: AttachNetworkEndpoints() = %v, want success %v", tc.desc, err, tc.wantAttach)
+		}
+	}
+
+	// The endpoints of GCE_VM_IP_PORT NEGs keep their instance.
+	cloud := NewFakeNetworkEndpointGroupCloud("test-subnetwork", "test-network")
+	neg := &compute.NetworkEndpointGroup{Name: "neg", NetworkEndpointType: string(VmIpPortEndpointType), Subnetwork: "test-subnetwork"}
+	if err := cloud.CreateNetworkEndpointGroup(neg, TestZone1); err != nil {
+		t.Fatal(err)
+	}
+	if err := cloud.AttachNetworkEndpoints("neg", TestZone1, []*compute.NetworkEndpoint{{IpAddress: "10.0.0.1", Port: 80, Instance: TestInstance1}}); err != nil {
+		t.Errorf("AttachNetworkEndpoints() = %v, want nil", err)
+	}
+}
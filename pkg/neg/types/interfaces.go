@@ -40,6 +40,15 @@ type NetworkEndpointGroupCloud interface {
 	SubnetworkURL() string
 }
 
+// EndpointsCalculator computes the target network endpoints of a NEG syncer
+// from an endpoint source, such as the Endpoints of the service.
+type EndpointsCalculator interface {
+	// CalculateEndpoints returns the target network endpoints grouped by zone
+	// and the pods backing them, if any. exists is false if the source has no
+	// endpoints for the syncer, in which case the sync is skipped.
+	CalculateEndpoints() (endpoints map[string]NetworkEndpointSet, endpointPodMap EndpointPodMap, exists bool, err error)
+}
+
 // NetworkEndpointGroupNamer is an interface for generating network endpoint group name.
 type NetworkEndpointGroupNamer interface {
 	NEG(namespace, name string, port int32) string
@@ -70,8 +79,17 @@ type NegSyncerManager interface {
 	StopSyncer(namespace, name string)
 	// Sync signals all syncers related to the service to sync. This call is asynchronous.
 	Sync(namespace, name string)
+	// EnsureServiceEntrySyncers is EnsureSyncers for the ports of an Istio:ServiceEntry.
+	EnsureServiceEntrySyncers(namespace, name string, portMap PortInfoMap) error
+	// StopServiceEntrySyncer is StopSyncer for an Istio:ServiceEntry.
+	StopServiceEntrySyncer(namespace, name string)
+	// SyncServiceEntry is Sync for an Istio:ServiceEntry.
+	SyncServiceEntry(namespace, name string)
 	// GC garbage collects network endpoint group and syncers
 	GC() error
+	// DeleteNEGs deletes the NEGs with the given names in the given zones.
+	// NEGs which do not exist are ignored.
+	DeleteNEGs(negNames, zones []string) error
 	// ShutDown shuts down the manager
 	ShutDown()
 }
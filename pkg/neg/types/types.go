@@ -29,6 +29,23 @@ import (
 	"k8s.io/ingress-gce/pkg/annotations"
 )
 
+// NetworkEndpointType is the type of the network endpoints of a NEG.
+type NetworkEndpointType string
+
+const (
+	// VmIpPortEndpointType is the type of NEGs whose endpoints are the IP and
+	// port of pods running on GCE VMs. This is the only type managed by the
+	// NEG controller.
+	VmIpPortEndpointType = NetworkEndpointType("GCE_VM_IP_PORT")
+	// NonGCPPrivateEndpointType is the type of hybrid NEGs whose endpoints are
+	// IP and port pairs outside of GCP, e.g. on-premises. Not supported yet.
+	NonGCPPrivateEndpointType = NetworkEndpointType("NON_GCP_PRIVATE_IP_PORT")
+	// VmIpEndpointType is the type of NEGs whose endpoints are the primary IP
+	// of GCE VMs. They back L4 load balancers and are managed by the L4
+	// controller rather than the NEG controller.
+	VmIpEndpointType = NetworkEndpointType("GCE_VM_IP")
+)
+
 // SvcPortMap is a map of ServicePort:TargetPort
 type SvcPortMap map[int32]string
 
@@ -103,6 +120,24 @@ func NewPortInfoMapWithDestinationRule(namespace, name string, svcPortMap SvcPor
 	return ret, nil
 }
 
+// ServiceEntrySubset is the subset in the name of the NEGs of Istio:ServiceEntry
+// ports, which tells them apart from the NEGs of the Service with the same name.
+const ServiceEntrySubset = "serviceentry"
+
+// NewPortInfoMapWithServiceEntry creates the PortInfoMap of the ports of an
+// Istio:ServiceEntry, whose endpoints are the pods matching its workload selector.
+func NewPortInfoMapWithServiceEntry(namespace, name string, svcPortMap SvcPortMap, namer NetworkEndpointGroupNamer, workloadLabels map[string]string) PortInfoMap {
+	ret := PortInfoMap{}
+	for svcPort, targetPort := range svcPortMap {
+		ret[PortInfoMapKey{svcPort, ""}] = PortInfo{
+			TargetPort:   targetPort,
+			NegName:      namer.NEGWithSubset(namespace, name, ServiceEntrySubset, svcPort),
+			SubsetLabels: labels.Set(workloadLabels).String(),
+		}
+	}
+	return ret
+}
+
 // Merge merges p2 into p1 PortInfoMap
 // It assumes the same key (service port) will have the same target port and negName
 // If not, it will throw error
@@ -157,6 +192,16 @@ func (p1 PortInfoMap) ToPortNegMap() annotations.PortNegMap {
 	return ret
 }
 
+// ToPortTargetPortMap returns the mapping between service port and target
+// port of the ports.
+func (p1 PortInfoMap) ToPortTargetPortMap() annotations.PortTargetPortMap {
+	ret := annotations.PortTargetPortMap{}
+	for mapKey, portInfo := range p1 {
+		ret[strconv.Itoa(int(mapKey.ServicePort))] = portInfo.TargetPort
+	}
+	return ret
+}
+
 func (p1 PortInfoMap) ToPortSubsetNegMap() annotations.PortSubsetNegMap {
 	ret := annotations.PortSubsetNegMap{}
 	for mapKey, portInfo := range p1 {
@@ -195,13 +240,30 @@ type NegSyncerKey struct {
 	// when --enable-csm=true.
 	Subset string
 
-	// Subset label, should set together with Subset.
+	// Subset label, should set together with Subset. For an Istio:ServiceEntry,
+	// it is the workload selector.
 	SubsetLabels string
+
+	// ServiceEntry is true if Namespace and Name are those of an
+	// Istio:ServiceEntry rather than a Service.
+	ServiceEntry bool
 }
 
 func (key NegSyncerKey) String() string {
+	if key.ServiceEntry {
+		return fmt.Sprintf("serviceentry:%s/%s-%v/%s", key.Namespace, key.Name, key.Port, key.TargetPort)
+	}
 	return fmt.Sprintf("%s/%s-%s-%v/%s", key.Namespace, key.Name, key.Subset, key.Port, key.TargetPort)
 }
 
 // EndpointPodMap is a map from network endpoint to a namespaced name of a pod
 type EndpointPodMap map[NetworkEndpoint]types.NamespacedName
+
+// PinnedZones returns the zones of the cluster the NEGs of a Service are
+// pinned to by its cloud.google.com/neg-zones annotation, and the pinned zones
+// which are not zones of the cluster.
+func PinnedZones(clusterZones, pinned []string) ([]string, []string) {
+	known := sets.NewString(clusterZones...)
+	pinnedSet := sets.NewString(pinned...)
+	return known.Intersection(pinnedSet).List(), pinnedSet.Difference(known).List()
+}
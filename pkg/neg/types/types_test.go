@@ -365,3 +365,13 @@ func TestNegsWithReadinessGate(t *testing.T) {
 		}
 	}
 }
+
+func TestPinnedZones(t *testing.T) {
+	zones, unknown := PinnedZones([]string{"zone-a", "zone-b", "zone-c"}, []string{"zone-c", "zone-a", "zone-d"})
+	if want := []string{"zone-a", "zone-c"}; !reflect.DeepEqual(zones, want) {
+		t.Errorf("PinnedZones() returned zones %v, want %v", zones, want)
+	}
+	if want := []string{"zone-d"}; !reflect.DeepEqual(unknown, want) {
+		t.Errorf("PinnedZones() returned unknown zones %v, want %v", unknown, want)
+	}
+}
@@ -19,11 +19,16 @@ package neg
 import (
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"reflect"
+	"strconv"
 	"strings"
 
 	istioV1alpha3 "istio.io/api/networking/v1alpha3"
+	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/ingress-gce/pkg/annotations"
 	"k8s.io/ingress-gce/pkg/neg/types"
 )
@@ -40,16 +45,22 @@ type NegSyncerType string
 // knownPorts represents the known Port:TargetPort attributes of servicePorts
 // that already exist on the service. This function returns an error if
 // any of the parsed ServicePorts from the annotation is not in knownPorts.
+// The ranges of ports of the annotation expose the knownPorts they contain,
+// if any.
 func negServicePorts(ann *annotations.NegAnnotation, knownPorts types.SvcPortMap) (types.SvcPortMap, error) {
 	portSet := make(types.SvcPortMap)
 	var errList []error
 	for port := range ann.ExposedPorts {
-		// TODO: also validate ServicePorts in the exposed NEG annotation via webhook
 		if _, ok := knownPorts[port]; !ok {
 			errList = append(errList, fmt.Errorf("port %v specified in %q doesn't exist in the service", port, annotations.NEGAnnotationKey))
 		}
 		portSet[port] = knownPorts[port]
 	}
+	for port, targetPort := range knownPorts {
+		if ann.Exposes(port) {
+			portSet[port] = targetPort
+		}
+	}
 
 	return portSet, utilerrors.NewAggregate(errList)
 }
@@ -82,6 +93,98 @@ func castToDestinationRule(drus *unstructured.Unstructured) (string, string, *is
 	return targetServiceNamespace, drHost, dr, nil
 }
 
+// serviceEntrySpec holds the fields of the spec of an Istio:ServiceEntry used
+// by the NEG controller. The vendored istio API predates workload selectors
+// and port target ports.
+type serviceEntrySpec struct {
+	Ports []struct {
+		Number     int32  `json:"number"`
+		Name       string `json:"name"`
+		TargetPort int32  `json:"targetPort"`
+	} `json:"ports"`
+	WorkloadSelector *struct {
+		Labels map[string]string `json:"labels"`
+	} `json:"workloadSelector"`
+}
+
+// castToServiceEntry casts Unstructured obj to serviceEntrySpec.
+func castToServiceEntry(seus *unstructured.Unstructured) (*serviceEntrySpec, error) {
+	seJSON, err := json.Marshal(seus.Object["spec"])
+	if err != nil {
+		return nil, err
+	}
+	se := &serviceEntrySpec{}
+	if err := json.Unmarshal(seJSON, se); err != nil {
+		return nil, err
+	}
+	return se, nil
+}
+
+// workloadLabels returns the labels of the workload selector of the
+// ServiceEntry, nil if it does not select pods.
+func (se *serviceEntrySpec) workloadLabels() map[string]string {
+	if se.WorkloadSelector == nil || len(se.WorkloadSelector.Labels) == 0 {
+		return nil
+	}
+	return se.WorkloadSelector.Labels
+}
+
+// svcPortMap returns the port:targetport map of the ServiceEntry ports. The
+// target port defaults to the port number.
+func (se *serviceEntrySpec) svcPortMap() types.SvcPortMap {
+	ret := types.SvcPortMap{}
+	for _, port := range se.Ports {
+		targetPort := port.TargetPort
+		if targetPort == 0 {
+			targetPort = port.Number
+		}
+		ret[port.Number] = strconv.Itoa(int(targetPort))
+	}
+	return ret
+}
+
+// endpointsHash returns a hash of the addresses and ports of the Endpoints,
+// the only content of the Endpoints the NEG syncers depend on.
+func endpointsHash(endpoints *apiv1.Endpoints) (string, error) {
+	data, err := json.Marshal(endpoints.Subsets)
+	if err != nil {
+		return "", err
+	}
+	h := fnv.New64a()
+	h.Write(data)
+	return strconv.FormatUint(h.Sum64(), 16), nil
+}
+
+// podReadinessChanged returns true if the update of the pod can change its NEG
+// readiness gate. Resyncs are kept as they time out the unready pods.
+func podReadinessChanged(old, cur *apiv1.Pod) bool {
+	if old.ResourceVersion == cur.ResourceVersion {
+		return true
+	}
+	return !reflect.DeepEqual(old.Spec.ReadinessGates, cur.Spec.ReadinessGates) ||
+		!reflect.DeepEqual(old.Status.Conditions, cur.Status.Conditions) ||
+		!reflect.DeepEqual(old.DeletionTimestamp, cur.DeletionTimestamp)
+}
+
+// podEndpointChanged returns true if the update of the pod can change the
+// network endpoints selected by a ServiceEntry.
+func podEndpointChanged(old, cur *apiv1.Pod) bool {
+	if old.ResourceVersion == cur.ResourceVersion {
+		return false
+	}
+	return !reflect.DeepEqual(old.Labels, cur.Labels) ||
+		old.Status.PodIP != cur.Status.PodIP ||
+		old.Status.Phase != cur.Status.Phase ||
+		old.Spec.NodeName != cur.Spec.NodeName ||
+		!reflect.DeepEqual(old.DeletionTimestamp, cur.DeletionTimestamp)
+}
+
+// nodeZonesChanged returns true if the update of the node can change the
+// zones of the cluster, i.e. its zone or its readiness.
+func nodeZonesChanged(nodeReady listers.NodeConditionPredicate, old, cur *apiv1.Node) bool {
+	return old.Labels[annotations.ZoneKey] != cur.Labels[annotations.ZoneKey] || nodeReady(old) != nodeReady(cur)
+}
+
 func contains(ss []string, target string) bool {
 	for _, s := range ss {
 		if s == target {
@@ -58,6 +58,24 @@ func TestNEGServicePorts(t *testing.T) {
 			knownPortMap:    types.SvcPortMap{80: "8080", 3000: "3030", 4000: "4040"},
 			expectedPortMap: types.SvcPortMap{80: "8080"},
 		},
+		{
+			desc:            "NEG annotation exposes the service ports in a range",
+			annotation:      `{"exposed_ports":{"80":{},"3000-3999":{}}}`,
+			knownPortMap:    types.SvcPortMap{80: "8080", 3000: "3030", 3500: "3535", 4000: "4040"},
+			expectedPortMap: types.SvcPortMap{80: "8080", 3000: "3030", 3500: "3535"},
+		},
+		{
+			desc:            "NEG annotation exposes all the service ports",
+			annotation:      `{"exposed_ports":{"all":{}}}`,
+			knownPortMap:    types.SvcPortMap{80: "8080", 3000: "3030"},
+			expectedPortMap: types.SvcPortMap{80: "8080", 3000: "3030"},
+		},
+		{
+			desc:            "NEG annotation range without service ports",
+			annotation:      `{"exposed_ports":{"5000-6000":{}}}`,
+			knownPortMap:    types.SvcPortMap{80: "8080"},
+			expectedPortMap: types.SvcPortMap{},
+		},
 	}
 
 	for _, tc := range testcases {
@@ -92,3 +110,84 @@ func TestNEGServicePorts(t *testing.T) {
 		})
 	}
 }
+
+func TestPodUpdateFilters(t *testing.T) {
+	now := metav1.Now()
+	for _, tc := range []struct {
+		desc                string
+		mutate              func(pod *v1.Pod)
+		wantReadinessChange bool
+		wantEndpointChange  bool
+	}{
+		{
+			desc:                "resync",
+			mutate:              func(pod *v1.Pod) {},
+			wantReadinessChange: true,
+		},
+		{
+			desc: "annotation changed",
+			mutate: func(pod *v1.Pod) {
+				pod.ResourceVersion = "2"
+				pod.Annotations = map[string]string{"foo": "bar"}
+			},
+		},
+		{
+			desc: "container restarted",
+			mutate: func(pod *v1.Pod) {
+				pod.ResourceVersion = "2"
+				pod.Status.ContainerStatuses = []v1.ContainerStatus{{Name: "c", RestartCount: 1}}
+			},
+		},
+		{
+			desc: "label changed",
+			mutate: func(pod *v1.Pod) {
+				pod.ResourceVersion = "2"
+				pod.Labels["app"] = "other"
+			},
+			wantEndpointChange: true,
+		},
+		{
+			desc: "condition changed",
+			mutate: func(pod *v1.Pod) {
+				pod.ResourceVersion = "2"
+				pod.Status.Conditions[0].Status = v1.ConditionFalse
+			},
+			wantReadinessChange: true,
+		},
+		{
+			desc: "pod IP changed",
+			mutate: func(pod *v1.Pod) {
+				pod.ResourceVersion = "2"
+				pod.Status.PodIP = "10.0.0.2"
+			},
+			wantEndpointChange: true,
+		},
+		{
+			desc: "pod deleted",
+			mutate: func(pod *v1.Pod) {
+				pod.ResourceVersion = "2"
+				pod.DeletionTimestamp = &now
+			},
+			wantReadinessChange: true,
+			wantEndpointChange:  true,
+		},
+	} {
+		old := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", ResourceVersion: "1", Labels: map[string]string{"app": "foo"}},
+			Spec:       v1.PodSpec{NodeName: "node"},
+			Status: v1.PodStatus{
+				PodIP:      "10.0.0.1",
+				Phase:      v1.PodRunning,
+				Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}},
+			},
+		}
+		cur := old.DeepCopy()
+		tc.mutate(cur)
+		if got := podReadinessChanged(old, cur); got != tc.wantReadinessChange {
+			t.Errorf("%s: podReadinessChanged() = %v, want %v", tc.desc, got, tc.wantReadinessChange)
+		}
+		if got := podEndpointChanged(old, cur); got != tc.wantEndpointChange {
+			t.Errorf("%s: podEndpointChanged() = %v, want %v", tc.desc, got, tc.wantEndpointChange)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package operations tracks the GCE operations started by the controller
+// without waiting for them. Instead of blocking a sync worker for each
+// operation, the operations are polled in a shared loop and the key owning
+// them is enqueued again once they complete.
+package operations
+
+import (
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	compute "google.golang.org/api/compute/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/klog"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+const statusDone = "DONE"
+
+// Getter returns the current state of an operation.
+type Getter func(op *compute.Operation) (*compute.Operation, error)
+
+// NewCloudGetter returns a Getter of the zonal, regional and global
+// operations of the project of cloud.
+func NewCloudGetter(gceCloud *gce.Cloud) Getter {
+	return func(op *compute.Operation) (*compute.Operation, error) {
+		ctx, cancel := cloud.ContextWithCallTimeout()
+		defer cancel()
+		services := gceCloud.ComputeServices().GA
+		switch {
+		case op.Zone != "":
+			return services.ZoneOperations.Get(gceCloud.ProjectID(), path.Base(op.Zone), op.Name).Context(ctx).Do()
+		case op.Region != "":
+			return services.RegionOperations.Get(gceCloud.ProjectID(), path.Base(op.Region), op.Name).Context(ctx).Do()
+		default:
+			return services.GlobalOperations.Get(gceCloud.ProjectID(), op.Name).Context(ctx).Do()
+		}
+	}
+}
+
+// Tracker polls the operations of the keys which started them, and enqueues
+// a key once all its operations are done.
+type Tracker struct {
+	get      Getter
+	interval time.Duration
+
+	lock sync.Mutex
+	// pending are the operations which are not done, by key.
+	pending map[string]*owner
+	// errs are the errors of the failed operations of each key, until
+	// they are returned by Result.
+	errs map[string][]error
+}
+
+type owner struct {
+	ops     []*compute.Operation
+	enqueue func(key string)
+}
+
+// NewTracker returns a Tracker polling the operations with get every
+// interval.
+func NewTracker(get Getter, interval time.Duration) *Tracker {
+	return &Tracker{
+		get:      get,
+		interval: interval,
+		pending:  map[string]*owner{},
+		errs:     map[string][]error{},
+	}
+}
+
+// Track adds an operation started by the sync of key. enqueue is called with
+// key once all the operations of key are done.
+func (t *Tracker) Track(key string, op *compute.Operation, enqueue func(key string)) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if op.Status == statusDone {
+		t.recordDone(key, op)
+		return
+	}
+	o, ok := t.pending[key]
+	if !ok {
+		o = &owner{}
+		t.pending[key] = o
+	}
+	o.ops = append(o.ops, op)
+	o.enqueue = enqueue
+}
+
+// Pending returns true if some operations of key are not done.
+func (t *Tracker) Pending(key string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	_, ok := t.pending[key]
+	return ok
+}
+
+// Result returns the errors of the operations of key which failed since the
+// last call, nil if none did.
+func (t *Tracker) Result(key string) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	errs := t.errs[key]
+	delete(t.errs, key)
+	if len(errs) == 0 {
+		return nil
+	}
+	return utils.JoinErrs(errs)
+}
+
+// Run polls the pending operations until stopCh is closed.
+func (t *Tracker) Run(stopCh <-chan struct{}) {
+	wait.Until(t.poll, t.interval, stopCh)
+}
+
+// poll gets the state of all the pending operations, and enqueues the keys
+// whose operations are all done.
+func (t *Tracker) poll() {
+	t.lock.Lock()
+	var ops []*compute.Operation
+	for _, o := range t.pending {
+		ops = append(ops, o.ops...)
+	}
+	t.lock.Unlock()
+
+	updated := map[*compute.Operation]*compute.Operation{}
+	for _, op := range ops {
+		current, err := t.get(op)
+		if err != nil {
+			klog.Warningf("Failed to get operation %s, retrying: %v", op.Name, err)
+			continue
+		}
+		if current.Status == statusDone {
+			updated[op] = current
+		}
+	}
+	if len(updated) == 0 {
+		return
+	}
+
+	t.lock.Lock()
+	done := map[string]func(string){}
+	for key, o := range t.pending {
+		var remaining []*compute.Operation
+		for _, op := range o.ops {
+			if current, ok := updated[op]; ok {
+				t.recordDone(key, current)
+			} else {
+				remaining = append(remaining, op)
+			}
+		}
+		o.ops = remaining
+		if len(remaining) == 0 {
+			delete(t.pending, key)
+			done[key] = o.enqueue
+		}
+	}
+	t.lock.Unlock()
+
+	for key, enqueue := range done {
+		klog.V(3).Infof("Operations of %q are done", key)
+		if enqueue != nil {
+			enqueue(key)
+		}
+	}
+}
+
+// recordDone records the error of the done operation of key, if any. It must
+// be called with the lock held.
+func (t *Tracker) recordDone(key string, op *compute.Operation) {
+	if op.Error != nil && len(op.Error.Errors) > 0 {
+		t.errs[key] = append(t.errs[key], fmt.Errorf("operation %s failed: %s", op.Name, op.Error.Errors[0].Message))
+	}
+}
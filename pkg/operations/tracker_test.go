@@ -0,0 +1,82 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operations
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+func failed(name string) *compute.Operation {
+	return &compute.Operation{Name: name, Status: statusDone, Error: &compute.OperationError{
+		Errors: []*compute.OperationErrorErrors{{Message: "failed"}},
+	}}
+}
+
+func TestTracker(t *testing.T) {
+	// Operations are done once they are in done, and fail to be polled
+	// if their name is "unavailable".
+	done := map[string]*compute.Operation{}
+	tracker := NewTracker(func(op *compute.Operation) (*compute.Operation, error) {
+		if op.Name == "unavailable" {
+			return nil, fmt.Errorf("unavailable")
+		}
+		if current, ok := done[op.Name]; ok {
+			return current, nil
+		}
+		return op, nil
+	}, time.Second)
+	var enqueued []string
+	enqueue := func(key string) { enqueued = append(enqueued, key) }
+
+	tracker.Track("a", &compute.Operation{Name: "a1", Status: "RUNNING"}, enqueue)
+	tracker.Track("a", &compute.Operation{Name: "a2", Status: "PENDING"}, enqueue)
+	tracker.Track("b", &compute.Operation{Name: "unavailable", Status: "RUNNING"}, enqueue)
+	// Operations which are already done are not tracked.
+	tracker.Track("c", failed("c1"), enqueue)
+	if tracker.Pending("c") {
+		t.Errorf("Pending(c) = true for a done operation, want false")
+	}
+	if err := tracker.Result("c"); err == nil {
+		t.Errorf("Result(c) = nil for a failed operation, want error")
+	}
+
+	done["a1"] = &compute.Operation{Name: "a1", Status: statusDone}
+	tracker.poll()
+	if !tracker.Pending("a") || len(enqueued) != 0 {
+		t.Errorf("Got a pending %t and enqueued %v with an operation of a running, want pending and none enqueued", tracker.Pending("a"), enqueued)
+	}
+
+	done["a2"] = failed("a2")
+	tracker.poll()
+	if tracker.Pending("a") || !reflect.DeepEqual(enqueued, []string{"a"}) {
+		t.Errorf("Got a pending %t and enqueued %v once its operations are done, want not pending and a enqueued", tracker.Pending("a"), enqueued)
+	}
+	if err := tracker.Result("a"); err == nil || err.Error() != "operation a2 failed: failed" {
+		t.Errorf("Result(a) = %v, want the error of a2", err)
+	}
+	if err := tracker.Result("a"); err != nil {
+		t.Errorf("Result(a) = %v after the error was returned, want nil", err)
+	}
+	if !tracker.Pending("b") {
+		t.Errorf("Pending(b) = false for an operation which failed to be polled, want true")
+	}
+}
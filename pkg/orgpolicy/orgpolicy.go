@@ -0,0 +1,169 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package orgpolicy checks the resources of an Ingress against the
+// organization policy constraints of the project, so that inevitable failures
+// are reported up front instead of being retried against the GCE API.
+package orgpolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"k8s.io/ingress-gce/pkg/controller/errors"
+)
+
+const (
+	// RestrictLoadBalancerTypesConstraint restricts the types of load
+	// balancers which can be created in the project.
+	RestrictLoadBalancerTypesConstraint = "constraints/compute.restrictLoadBalancerCreationForTypes"
+	// RestrictTLSVersionConstraint restricts the TLS versions load balancers
+	// can negotiate.
+	RestrictTLSVersionConstraint = "constraints/gcp.restrictTLSVersion"
+
+	// ExternalHTTPSLoadBalancer is the load balancer type of an Ingress.
+	ExternalHTTPSLoadBalancer = "EXTERNAL_HTTP_HTTPS"
+	// InternalHTTPSLoadBalancer is the load balancer type of an L7-ILB Ingress.
+	InternalHTTPSLoadBalancer = "INTERNAL_HTTP_HTTPS"
+
+	// TLSVersion1 is the minimum TLS version of the default SSL policy, which
+	// is used by all target HTTPS proxies of the controller.
+	TLSVersion1 = "TLS_VERSION_1"
+
+	allowAll = "ALLOW"
+	denyAll  = "DENY"
+)
+
+// violationRegexp matches the constraint in the error returned by the GCE API
+// when a request violates an organization policy.
+var violationRegexp = regexp.MustCompile(`Constraint (constraints/[\w.]+) violated`)
+
+// Policy is an effective organization policy of the project, in the format
+// of the Resource Manager API.
+type Policy struct {
+	Constraint string      `json:"constraint"`
+	ListPolicy *ListPolicy `json:"listPolicy,omitempty"`
+}
+
+// ListPolicy is the list of values allowed or denied by a list constraint.
+type ListPolicy struct {
+	AllowedValues []string `json:"allowedValues,omitempty"`
+	DeniedValues  []string `json:"deniedValues,omitempty"`
+	// AllValues is either ALLOW or DENY, and takes precedence over the lists.
+	AllValues string `json:"allValues,omitempty"`
+}
+
+// Allows returns true if the policy allows the value.
+func (p *ListPolicy) Allows(value string) bool {
+	if p == nil {
+		return true
+	}
+	switch p.AllValues {
+	case allowAll:
+		return true
+	case denyAll:
+		return false
+	}
+	if matchesAny(p.DeniedValues, value) {
+		return false
+	}
+	if len(p.AllowedValues) > 0 {
+		return matchesAny(p.AllowedValues, value)
+	}
+	return true
+}
+
+// matchesAny returns true if the value is in values. Values may be prefixed
+// with "is:", or be a value group of the form "in:<prefix>", e.g. "in:EXTERNAL".
+func matchesAny(values []string, value string) bool {
+	for _, v := range values {
+		if strings.TrimPrefix(v, "is:") == value {
+			return true
+		}
+		if group := strings.TrimPrefix(v, "in:"); group != v && strings.HasPrefix(value, group+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// Source returns the effective organization policies of the project.
+type Source interface {
+	Policies() ([]Policy, error)
+}
+
+// NewFileSource returns a Source reading the policies from a JSON file.
+func NewFileSource(path string) Source {
+	return &fileSource{path: path}
+}
+
+type fileSource struct {
+	path string
+}
+
+// Policies implements Source. The file is read on every call, so that policy
+// changes are picked up without restarting the controller.
+func (s *fileSource) Policies() ([]Policy, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var policies []Policy
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("error parsing organization policies in %s: %v", s.path, err)
+	}
+	return policies, nil
+}
+
+// Check returns an ErrOrgPolicyViolation if a load balancer of type lbType,
+// terminating TLS if tls is set, violates one of the policies.
+func Check(policies []Policy, lbType string, tls bool) error {
+	for _, p := range policies {
+		switch p.Constraint {
+		case RestrictLoadBalancerTypesConstraint:
+			if !p.ListPolicy.Allows(lbType) {
+				return errors.ErrOrgPolicyViolation{
+					Constraint: p.Constraint,
+					Reason:     fmt.Sprintf("load balancers of type %s are not allowed in the project", lbType),
+				}
+			}
+		case RestrictTLSVersionConstraint:
+			if tls && !p.ListPolicy.Allows(TLSVersion1) {
+				return errors.ErrOrgPolicyViolation{
+					Constraint: p.Constraint,
+					Reason:     fmt.Sprintf("target HTTPS proxies use the default SSL policy, which allows %s", TLSVersion1),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ViolatedConstraint returns the constraint violated by a request if err is
+// an organization policy denial of the GCE API.
+func ViolatedConstraint(err error) (string, bool) {
+	if err == nil {
+		return "", false
+	}
+	m := violationRegexp.FindStringSubmatch(err.Error())
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
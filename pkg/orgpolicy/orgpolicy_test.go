@@ -0,0 +1,162 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orgpolicy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/ingress-gce/pkg/controller/errors"
+)
+
+func TestCheck(t *testing.T) {
+	lbPolicy := func(lp *ListPolicy) Policy {
+		return Policy{Constraint: RestrictLoadBalancerTypesConstraint, ListPolicy: lp}
+	}
+	tlsPolicy := Policy{Constraint: RestrictTLSVersionConstraint, ListPolicy: &ListPolicy{DeniedValues: []string{TLSVersion1}}}
+
+	testCases := []struct {
+		desc           string
+		policies       []Policy
+		lbType         string
+		tls            bool
+		wantConstraint string
+	}{
+		{
+			desc:   "no policies",
+			lbType: ExternalHTTPSLoadBalancer,
+		},
+		{
+			desc:           "denied load balancer type",
+			policies:       []Policy{lbPolicy(&ListPolicy{DeniedValues: []string{ExternalHTTPSLoadBalancer}})},
+			lbType:         ExternalHTTPSLoadBalancer,
+			wantConstraint: RestrictLoadBalancerTypesConstraint,
+		},
+		{
+			desc:           "denied load balancer group",
+			policies:       []Policy{lbPolicy(&ListPolicy{DeniedValues: []string{"in:EXTERNAL"}})},
+			lbType:         ExternalHTTPSLoadBalancer,
+			wantConstraint: RestrictLoadBalancerTypesConstraint,
+		},
+		{
+			desc:     "other load balancer group denied",
+			policies: []Policy{lbPolicy(&ListPolicy{DeniedValues: []string{"in:EXTERNAL"}})},
+			lbType:   InternalHTTPSLoadBalancer,
+		},
+		{
+			desc:     "allowed load balancer type",
+			policies: []Policy{lbPolicy(&ListPolicy{AllowedValues: []string{"is:" + InternalHTTPSLoadBalancer}})},
+			lbType:   InternalHTTPSLoadBalancer,
+		},
+		{
+			desc:           "load balancer type not in allowed values",
+			policies:       []Policy{lbPolicy(&ListPolicy{AllowedValues: []string{InternalHTTPSLoadBalancer}})},
+			lbType:         ExternalHTTPSLoadBalancer,
+			wantConstraint: RestrictLoadBalancerTypesConstraint,
+		},
+		{
+			desc:           "all load balancer types denied",
+			policies:       []Policy{lbPolicy(&ListPolicy{AllValues: "DENY"})},
+			lbType:         InternalHTTPSLoadBalancer,
+			wantConstraint: RestrictLoadBalancerTypesConstraint,
+		},
+		{
+			desc:     "TLS version restricted without TLS",
+			policies: []Policy{tlsPolicy},
+			lbType:   ExternalHTTPSLoadBalancer,
+		},
+		{
+			desc:           "TLS version restricted with TLS",
+			policies:       []Policy{tlsPolicy},
+			lbType:         ExternalHTTPSLoadBalancer,
+			tls:            true,
+			wantConstraint: RestrictTLSVersionConstraint,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := Check(tc.policies, tc.lbType, tc.tls)
+			if tc.wantConstraint == "" {
+				if err != nil {
+					t.Errorf("Check() = %v, want nil", err)
+				}
+				return
+			}
+			violation, ok := err.(errors.ErrOrgPolicyViolation)
+			if !ok || violation.Constraint != tc.wantConstraint {
+				t.Errorf("Check() = %v, want violation of %s", err, tc.wantConstraint)
+			}
+		})
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "orgpolicy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "policies.json")
+	data := `[{"constraint": "constraints/compute.restrictLoadBalancerCreationForTypes", "listPolicy": {"deniedValues": ["in:EXTERNAL"]}}]`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	policies, err := NewFileSource(path).Policies()
+	if err != nil {
+		t.Fatalf("Policies() = _, %v, want nil", err)
+	}
+	if len(policies) != 1 || policies[0].Constraint != RestrictLoadBalancerTypesConstraint || policies[0].ListPolicy.Allows(ExternalHTTPSLoadBalancer) {
+		t.Errorf("Policies() = %+v, want the external load balancer denial", policies)
+	}
+}
+
+func TestViolatedConstraint(t *testing.T) {
+	testCases := []struct {
+		desc string
+		err  error
+		want string
+	}{
+		{
+			desc: "nil error",
+		},
+		{
+			desc: "other error",
+			err:  fmt.Errorf("quota exceeded"),
+		},
+		{
+			desc: "wrapped denial",
+			err: fmt.Errorf("error creating forwarding rule: %v",
+				fmt.Errorf("googleapi: Error 412: Constraint constraints/compute.restrictLoadBalancerCreationForTypes violated for projects/p, conditionNotMet")),
+			want: RestrictLoadBalancerTypesConstraint,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, ok := ViolatedConstraint(tc.err)
+			if got != tc.want || ok != (tc.want != "") {
+				t.Errorf("ViolatedConstraint(%v) = %q, %v, want %q", tc.err, got, ok, tc.want)
+			}
+		})
+	}
+}
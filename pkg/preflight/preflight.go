@@ -0,0 +1,407 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package preflight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"google.golang.org/api/googleapi"
+	api_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/ingress-gce/pkg/identity"
+	"k8s.io/klog"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+const (
+	// CategoryAPI is the category of checks verifying that a GCP API is enabled.
+	CategoryAPI = "api"
+	// CategoryIAM is the category of checks verifying IAM permissions.
+	CategoryIAM = "iam"
+	// CategoryNetwork is the category of checks verifying cluster networking.
+	CategoryNetwork = "network"
+
+	// reportKey is the ConfigMap data key holding the JSON encoded report.
+	reportKey = "report"
+	// statusKey is the ConfigMap data key holding the summarized status.
+	statusKey = "status"
+
+	statusOK     = "OK"
+	statusFailed = "Failed"
+
+	// accessNotConfiguredReason is the googleapi error reason returned when
+	// an API has not been enabled for the project.
+	accessNotConfiguredReason = "accessNotConfigured"
+
+	certificateManagerURL = "https://certificatemanager.googleapis.com/v1/projects/%s/locations/global/certificates?pageSize=1"
+
+	cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+// Result is the outcome of a single startup check.
+type Result struct {
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	OK       bool   `json:"ok"`
+	Message  string `json:"message,omitempty"`
+	// Missing are the IAM permissions missing on the project, for the
+	// permissions check.
+	Missing []string `json:"missing,omitempty"`
+}
+
+// Report is the set of results produced by a Checker.
+type Report struct {
+	Timestamp meta_v1.Time `json:"timestamp"`
+	Results   []Result     `json:"results"`
+}
+
+// OK returns true if every check in the report passed.
+func (r *Report) OK() bool {
+	for _, res := range r.Results {
+		if !res.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// Failures returns the results of the checks which did not pass.
+func (r *Report) Failures() []Result {
+	var failed []Result
+	for _, res := range r.Results {
+		if !res.OK {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+// probe is a read-only GCE call representative of an operation class.
+type probe func(ctx context.Context) error
+
+// Checker verifies the project and cluster configuration required by the
+// controller before any user visible sync happens.
+type Checker struct {
+	cloud       *gce.Cloud
+	kubeClient  kubernetes.Interface
+	credentials *identity.Credentials
+	// certManagerProbe checks the Certificate Manager API, and
+	// permissionsProbe the minimum IAM permissions. They are fields so that
+	// they can be replaced in tests.
+	certManagerProbe probe
+	permissionsProbe probe
+}
+
+// NewChecker returns a new Checker of the controller using the given
+// credentials.
+func NewChecker(cloud *gce.Cloud, kubeClient kubernetes.Interface, credentials *identity.Credentials) *Checker {
+	c := &Checker{
+		cloud:       cloud,
+		kubeClient:  kubeClient,
+		credentials: credentials,
+	}
+	c.certManagerProbe = c.probeCertificateManager
+	c.permissionsProbe = c.probePermissions
+	return c
+}
+
+// Run executes all checks and returns the resulting report.
+func (c *Checker) Run() *Report {
+	ctx := context.Background()
+	report := &Report{Timestamp: meta_v1.Now()}
+
+	// The compute API is checked via the operation class probes: an API which
+	// is not enabled will fail all of them with the same reason.
+	computeEnabled := true
+	classes := c.operationClasses()
+	for _, name := range sortedNames(classes) {
+		err := classes[name](ctx)
+		res := Result{Name: name, Category: CategoryIAM, OK: err == nil}
+		if err != nil {
+			if isAPINotEnabled(err) {
+				computeEnabled = false
+			}
+			res.Message = describeError(err)
+		}
+		report.Results = append(report.Results, res)
+	}
+	computeRes := Result{Name: "compute.googleapis.com", Category: CategoryAPI, OK: computeEnabled}
+	if !computeEnabled {
+		computeRes.Message = "Compute Engine API is not enabled for the project"
+	}
+	report.Results = append([]Result{computeRes}, report.Results...)
+
+	certRes := Result{Name: "certificatemanager.googleapis.com", Category: CategoryAPI, OK: true}
+	if err := c.certManagerProbe(ctx); err != nil {
+		certRes.OK = false
+		certRes.Message = describeError(err)
+	}
+	report.Results = append(report.Results, certRes)
+
+	report.Results = append(report.Results, c.checkPermissions(ctx))
+
+	report.Results = append(report.Results, c.checkVPCNative(ctx))
+	return report
+}
+
+// operationClasses returns one read-only probe per class of GCE resources
+// managed by the controller. A permission failure on the probe is a strong
+// signal that mutating calls on the same resource will fail as well.
+func (c *Checker) operationClasses() map[string]probe {
+	compute := c.cloud.Compute()
+	return map[string]probe{
+		"backendServices": func(ctx context.Context) error {
+			_, err := compute.BackendServices().List(ctx, filter.None)
+			return err
+		},
+		"healthChecks": func(ctx context.Context) error {
+			_, err := compute.HealthChecks().List(ctx, filter.None)
+			return err
+		},
+		"urlMaps": func(ctx context.Context) error {
+			_, err := compute.UrlMaps().List(ctx, filter.None)
+			return err
+		},
+		"targetHttpProxies": func(ctx context.Context) error {
+			_, err := compute.TargetHttpProxies().List(ctx, filter.None)
+			return err
+		},
+		"targetHttpsProxies": func(ctx context.Context) error {
+			_, err := compute.TargetHttpsProxies().List(ctx, filter.None)
+			return err
+		},
+		"sslCertificates": func(ctx context.Context) error {
+			_, err := compute.SslCertificates().List(ctx, filter.None)
+			return err
+		},
+		"globalForwardingRules": func(ctx context.Context) error {
+			_, err := compute.GlobalForwardingRules().List(ctx, filter.None)
+			return err
+		},
+		"globalAddresses": func(ctx context.Context) error {
+			_, err := compute.GlobalAddresses().List(ctx, filter.None)
+			return err
+		},
+		"firewalls": func(ctx context.Context) error {
+			_, err := compute.Firewalls().List(ctx, filter.None)
+			return err
+		},
+		"networkEndpointGroups": func(ctx context.Context) error {
+			_, err := compute.NetworkEndpointGroups().AggregatedList(ctx, filter.None)
+			return err
+		},
+	}
+}
+
+func sortedNames(classes map[string]probe) []string {
+	var names []string
+	for name := range classes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkPermissions verifies that the credentials of the controller have the
+// minimum IAM permissions on the project. Unlike the operation class probes,
+// it covers the mutations.
+func (c *Checker) checkPermissions(ctx context.Context) Result {
+	res := Result{Name: "permissions", Category: CategoryIAM, OK: true}
+	err := c.permissionsProbe(ctx)
+	if err == nil {
+		return res
+	}
+	res.OK = false
+	res.Message = describeError(err)
+	if missing, ok := err.(*identity.MissingPermissionsError); ok {
+		res.Missing = missing.Missing
+	}
+	return res
+}
+
+// probePermissions tests the minimum IAM permissions of the credentials of
+// the controller with the Resource Manager API.
+func (c *Checker) probePermissions(ctx context.Context) error {
+	client, err := c.credentials.Client(cloudPlatformScope)
+	if err != nil {
+		return err
+	}
+	return identity.CheckPermissions(client, c.credentials, c.cloud.ProjectID(), identity.MinimumPermissions)
+}
+
+// probeCertificateManager lists at most one certificate from the Certificate
+// Manager API using the credentials of the controller.
+func (c *Checker) probeCertificateManager(ctx context.Context) error {
+	client, err := c.credentials.Client(cloudPlatformScope)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Get(fmt.Sprintf(certificateManagerURL, c.cloud.ProjectID()))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return googleapi.CheckResponse(resp)
+}
+
+// checkVPCNative verifies that the nodes of the cluster use alias IP ranges,
+// which is required for container native load balancing.
+func (c *Checker) checkVPCNative(ctx context.Context) Result {
+	res := Result{Name: "vpcNative", Category: CategoryNetwork}
+	nodes, err := c.kubeClient.CoreV1().Nodes().List(meta_v1.ListOptions{})
+	if err != nil {
+		res.Message = fmt.Sprintf("failed to list nodes: %v", err)
+		return res
+	}
+	for _, node := range nodes.Items {
+		zone, name, err := splitProviderID(node.Spec.ProviderID)
+		if err != nil {
+			klog.V(4).Infof("Skipping node %q for VPC-native check: %v", node.Name, err)
+			continue
+		}
+		instance, err := c.cloud.Compute().Instances().Get(ctx, meta.ZonalKey(name, zone))
+		if err != nil {
+			res.Message = fmt.Sprintf("failed to get instance %s/%s: %s", zone, name, describeError(err))
+			return res
+		}
+		for _, nic := range instance.NetworkInterfaces {
+			if len(nic.AliasIpRanges) > 0 {
+				res.OK = true
+				return res
+			}
+		}
+		res.Message = fmt.Sprintf("node %q has no alias IP ranges, the cluster is not VPC-native and NEGs will not work", node.Name)
+		return res
+	}
+	res.Message = "no GCE node found to determine VPC-native status"
+	return res
+}
+
+// splitProviderID returns the zone and instance name of a GCE provider ID of
+// the form gce://<project>/<zone>/<instance>.
+func splitProviderID(providerID string) (string, string, error) {
+	const prefix = "gce://"
+	if !strings.HasPrefix(providerID, prefix) {
+		return "", "", fmt.Errorf("unexpected provider ID %q", providerID)
+	}
+	parts := strings.Split(strings.TrimPrefix(providerID, prefix), "/")
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return "", "", fmt.Errorf("unexpected provider ID %q", providerID)
+	}
+	return parts[1], parts[2], nil
+}
+
+func isAPINotEnabled(err error) bool {
+	apiErr, ok := err.(*googleapi.Error)
+	if !ok {
+		return false
+	}
+	for _, e := range apiErr.Errors {
+		if e.Reason == accessNotConfiguredReason {
+			return true
+		}
+	}
+	return false
+}
+
+func describeError(err error) string {
+	apiErr, ok := err.(*googleapi.Error)
+	if !ok {
+		return err.Error()
+	}
+	switch {
+	case isAPINotEnabled(err):
+		return fmt.Sprintf("API not enabled: %v", err)
+	case apiErr.Code == http.StatusForbidden:
+		return fmt.Sprintf("permission denied: %v", err)
+	}
+	return err.Error()
+}
+
+// LogReport writes the report to the controller logs.
+func LogReport(report *Report) {
+	for _, res := range report.Results {
+		if res.OK {
+			klog.V(2).Infof("Startup check %s/%s passed", res.Category, res.Name)
+			continue
+		}
+		klog.Warningf("Startup check %s/%s failed: %s", res.Category, res.Name, res.Message)
+	}
+	if report.OK() {
+		klog.V(0).Infof("All %d startup checks passed", len(report.Results))
+	} else {
+		klog.Warningf("%d of %d startup checks failed", len(report.Failures()), len(report.Results))
+	}
+}
+
+// WriteReport stores the report in the given ConfigMap, creating it if it
+// does not exist.
+func WriteReport(kubeClient kubernetes.Interface, name types.NamespacedName, report *Report) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	status := statusOK
+	if !report.OK() {
+		status = statusFailed
+	}
+	cmData := map[string]string{
+		reportKey: string(data),
+		statusKey: status,
+	}
+
+	cmClient := kubeClient.CoreV1().ConfigMaps(name.Namespace)
+	cm, err := cmClient.Get(name.Name, meta_v1.GetOptions{})
+	if errors.IsNotFound(err) {
+		cm = &api_v1.ConfigMap{
+			ObjectMeta: meta_v1.ObjectMeta{Name: name.Name, Namespace: name.Namespace},
+			Data:       cmData,
+		}
+		_, err = cmClient.Create(cm)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	cm.Data = cmData
+	_, err = cmClient.Update(cm)
+	return err
+}
+
+// RunAndReport runs all the startup checks, logs the result and records it
+// in the given ConfigMap. Failures to write the ConfigMap are only logged.
+func RunAndReport(cloud *gce.Cloud, kubeClient kubernetes.Interface, credentials *identity.Credentials, name types.NamespacedName) *Report {
+	start := time.Now()
+	report := NewChecker(cloud, kubeClient, credentials).Run()
+	klog.V(2).Infof("Startup checks completed in %v", time.Since(start))
+	LogReport(report)
+	if err := WriteReport(kubeClient, name, report); err != nil {
+		klog.Warningf("Failed to write startup check report to ConfigMap %s: %v", name, err)
+	}
+	return report
+}
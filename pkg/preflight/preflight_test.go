@@ -0,0 +1,233 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package preflight
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	api_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/ingress-gce/pkg/identity"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+const (
+	testZone     = "us-central1-b"
+	testInstance = "node-1"
+)
+
+func newTestChecker(t *testing.T, aliasIPs bool) (*Checker, *cloud.MockGCE) {
+	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	nic := &compute.NetworkInterface{}
+	if aliasIPs {
+		nic.AliasIpRanges = []*compute.AliasIpRange{{IpCidrRange: "10.4.0.0/24"}}
+	}
+	if err := fakeGCE.Compute().Instances().Insert(context.Background(), meta.ZonalKey(testInstance, testZone), &compute.Instance{
+		Name:              testInstance,
+		NetworkInterfaces: []*compute.NetworkInterface{nic},
+	}); err != nil {
+		t.Fatalf("Failed to insert instance: %v", err)
+	}
+
+	kubeClient := fake.NewSimpleClientset(&api_v1.Node{
+		ObjectMeta: meta_v1.ObjectMeta{Name: testInstance},
+		Spec:       api_v1.NodeSpec{ProviderID: "gce://test-project/" + testZone + "/" + testInstance},
+	})
+	c := NewChecker(fakeGCE, kubeClient, &identity.Credentials{Source: identity.MetadataSource})
+	c.certManagerProbe = func(context.Context) error { return nil }
+	c.permissionsProbe = func(context.Context) error { return nil }
+	return c, fakeGCE.Compute().(*cloud.MockGCE)
+}
+
+func failedChecks(report *Report) map[string]bool {
+	failed := map[string]bool{}
+	for _, res := range report.Failures() {
+		failed[res.Name] = true
+	}
+	return failed
+}
+
+func TestRun(t *testing.T) {
+	forbidden := &googleapi.Error{Code: http.StatusForbidden}
+	notEnabled := &googleapi.Error{
+		Code:   http.StatusForbidden,
+		Errors: []googleapi.ErrorItem{{Reason: accessNotConfiguredReason}},
+	}
+
+	testCases := []struct {
+		desc       string
+		aliasIPs   bool
+		setup      func(c *Checker, mockGCE *cloud.MockGCE)
+		wantFailed []string
+	}{
+		{
+			desc:     "all checks pass",
+			aliasIPs: true,
+		},
+		{
+			desc:     "missing permission on backend services",
+			aliasIPs: true,
+			setup: func(c *Checker, mockGCE *cloud.MockGCE) {
+				mockGCE.MockBackendServices.ListHook = func(ctx context.Context, fl *filter.F, m *cloud.MockBackendServices) (bool, []*compute.BackendService, error) {
+					return true, nil, forbidden
+				}
+			},
+			wantFailed: []string{"backendServices"},
+		},
+		{
+			desc:     "compute API not enabled",
+			aliasIPs: true,
+			setup: func(c *Checker, mockGCE *cloud.MockGCE) {
+				mockGCE.MockFirewalls.ListHook = func(ctx context.Context, fl *filter.F, m *cloud.MockFirewalls) (bool, []*compute.Firewall, error) {
+					return true, nil, notEnabled
+				}
+			},
+			wantFailed: []string{"compute.googleapis.com", "firewalls"},
+		},
+		{
+			desc:     "certificate manager API not enabled",
+			aliasIPs: true,
+			setup: func(c *Checker, mockGCE *cloud.MockGCE) {
+				c.certManagerProbe = func(context.Context) error { return notEnabled }
+			},
+			wantFailed: []string{"certificatemanager.googleapis.com"},
+		},
+		{
+			desc:     "missing IAM permissions",
+			aliasIPs: true,
+			setup: func(c *Checker, mockGCE *cloud.MockGCE) {
+				c.permissionsProbe = func(context.Context) error {
+					return &identity.MissingPermissionsError{Project: "test-project", Missing: []string{"compute.urlMaps.create"}}
+				}
+			},
+			wantFailed: []string{"permissions"},
+		},
+		{
+			desc:       "cluster is not VPC-native",
+			aliasIPs:   false,
+			wantFailed: []string{"vpcNative"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			c, mockGCE := newTestChecker(t, tc.aliasIPs)
+			if tc.setup != nil {
+				tc.setup(c, mockGCE)
+			}
+			report := c.Run()
+			failed := failedChecks(report)
+			if len(failed) != len(tc.wantFailed) {
+				t.Errorf("Got failed checks %v, want %v", failed, tc.wantFailed)
+			}
+			for _, name := range tc.wantFailed {
+				if !failed[name] {
+					t.Errorf("Expected check %q to fail, got failed checks %v", name, failed)
+				}
+			}
+			if report.OK() != (len(tc.wantFailed) == 0) {
+				t.Errorf("report.OK() = %v, want %v", report.OK(), len(tc.wantFailed) == 0)
+			}
+			for _, res := range report.Failures() {
+				if res.Name == "permissions" && len(res.Missing) == 0 {
+					t.Errorf("Got no missing permissions in failed check %+v", res)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	name := types.NamespacedName{Namespace: "kube-system", Name: "ingress-gce-startup-checks"}
+
+	reports := []*Report{
+		{Results: []Result{{Name: "firewalls", Category: CategoryIAM, OK: true}}},
+		{Results: []Result{{Name: "firewalls", Category: CategoryIAM, OK: false, Message: "permission denied"}}},
+	}
+	wantStatus := []string{statusOK, statusFailed}
+
+	// The first write creates the ConfigMap, the second updates it.
+	for i, report := range reports {
+		if err := WriteReport(kubeClient, name, report); err != nil {
+			t.Fatalf("WriteReport() = %v, want nil", err)
+		}
+		cm, err := kubeClient.CoreV1().ConfigMaps(name.Namespace).Get(name.Name, meta_v1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Failed to get ConfigMap: %v", err)
+		}
+		if cm.Data[statusKey] != wantStatus[i] {
+			t.Errorf("Got status %q, want %q", cm.Data[statusKey], wantStatus[i])
+		}
+		var got Report
+		if err := json.Unmarshal([]byte(cm.Data[reportKey]), &got); err != nil {
+			t.Fatalf("Failed to unmarshal report: %v", err)
+		}
+		if len(got.Results) != 1 || got.Results[0].OK != report.Results[0].OK {
+			t.Errorf("Got report %+v, want %+v", got, report)
+		}
+	}
+}
+
+func TestSplitProviderID(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		providerID string
+		wantZone   string
+		wantName   string
+		wantErr    bool
+	}{
+		{
+			desc:       "valid provider ID",
+			providerID: "gce://project/us-central1-b/node-1",
+			wantZone:   "us-central1-b",
+			wantName:   "node-1",
+		},
+		{
+			desc:       "other provider",
+			providerID: "aws:///us-east-1a/i-123",
+			wantErr:    true,
+		},
+		{
+			desc:       "missing instance",
+			providerID: "gce://project/us-central1-b/",
+			wantErr:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			zone, name, err := splitProviderID(tc.providerID)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("splitProviderID(%q) = %v, want error %v", tc.providerID, err, tc.wantErr)
+			}
+			if zone != tc.wantZone || name != tc.wantName {
+				t.Errorf("splitProviderID(%q) = %q, %q, want %q, %q", tc.providerID, zone, name, tc.wantZone, tc.wantName)
+			}
+		})
+	}
+}
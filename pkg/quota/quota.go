@@ -0,0 +1,127 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package quota checks the quotas of the project before creating the
+// resources of an Ingress or Service, so that exceeding one is reported up
+// front instead of failing midway through the creation.
+package quota
+
+import (
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	compute "google.golang.org/api/compute/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/ingress-gce/pkg/controller/errors"
+	"k8s.io/klog"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+const (
+	// NetworkEndpointGroups is the quota metric of the zonal NEGs.
+	NetworkEndpointGroups = "NETWORK_ENDPOINT_GROUPS"
+	// BackendServices is the quota metric of the global backend services.
+	BackendServices = "BACKEND_SERVICES"
+	// HealthChecks is the quota metric of the global health checks.
+	HealthChecks = "HEALTH_CHECKS"
+
+	// quotasTTL is how long the quotas of the project are cached.
+	quotasTTL = time.Minute
+)
+
+// Checker checks the resources to create against the quotas of the project.
+type Checker struct {
+	// getQuotas returns the quotas of the project.
+	getQuotas func() ([]*compute.Quota, error)
+
+	lock    sync.Mutex
+	quotas  map[string]*compute.Quota
+	fetched time.Time
+}
+
+// NewChecker returns a Checker of the quotas of the project of cloud.
+func NewChecker(gceCloud *gce.Cloud) *Checker {
+	return &Checker{
+		getQuotas: func() ([]*compute.Quota, error) {
+			ctx, cancel := cloud.ContextWithCallTimeout()
+			defer cancel()
+			project, err := gceCloud.Compute().Projects().Get(ctx, gceCloud.ProjectID())
+			if err != nil {
+				return nil, err
+			}
+			return project.Quotas, nil
+		},
+	}
+}
+
+// Quotas returns the quotas of the project by metric.
+func (c *Checker) Quotas() (map[string]*compute.Quota, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.fetched.IsZero() && time.Since(c.fetched) < quotasTTL {
+		return c.quotas, nil
+	}
+	quotas, err := c.getQuotas()
+	if err != nil {
+		return nil, err
+	}
+	c.quotas = map[string]*compute.Quota{}
+	for _, q := range quotas {
+		c.quotas[q.Metric] = q
+	}
+	c.fetched = time.Now()
+	return c.quotas, nil
+}
+
+// Check returns an ErrQuotaExceeded if creating the resources with the given
+// names which do not exist yet would exceed the quota of one of the metrics.
+// As most of the resources of a sync usually exist, existing is only called
+// to return the names of those which exist when creating all of them would
+// exceed a quota. Failing to get the quotas or the existing resources is not
+// fatal, the GCE API enforces the quotas regardless.
+func (c *Checker) Check(names []string, existing func() (sets.String, error), metrics ...string) error {
+	quotas, err := c.Quotas()
+	if err != nil {
+		klog.Warningf("Failed to get the quotas of the project, not checking %v: %v", metrics, err)
+		return nil
+	}
+	if err := check(quotas, len(names), metrics); err == nil {
+		return nil
+	}
+	have, err := existing()
+	if err != nil {
+		klog.Warningf("Failed to get existing resources, not checking quotas %v: %v", metrics, err)
+		return nil
+	}
+	return check(quotas, sets.NewString(names...).Difference(have).Len(), metrics)
+}
+
+func check(quotas map[string]*compute.Quota, required int, metrics []string) error {
+	if required == 0 {
+		return nil
+	}
+	for _, metric := range metrics {
+		q, ok := quotas[metric]
+		if !ok {
+			continue
+		}
+		if q.Usage+float64(required) > q.Limit {
+			return errors.ErrQuotaExceeded{Metric: metric, Limit: q.Limit, Usage: q.Usage, Required: required}
+		}
+	}
+	return nil
+}
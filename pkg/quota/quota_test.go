@@ -0,0 +1,109 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package quota
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	compute "google.golang.org/api/compute/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/ingress-gce/pkg/controller/errors"
+)
+
+func TestCheck(t *testing.T) {
+	quotas := []*compute.Quota{
+		{Metric: BackendServices, Limit: 10, Usage: 7},
+		{Metric: HealthChecks, Limit: 100, Usage: 7},
+	}
+	names := []string{"a", "b", "c", "d"}
+	for _, tc := range []struct {
+		desc         string
+		names        []string
+		existing     []string
+		existingErr  error
+		quotasErr    error
+		wantExisting bool
+		want         error
+	}{
+		{
+			desc:  "within quota",
+			names: names[:3],
+		},
+		{
+			desc:         "within quota once existing resources are excluded",
+			names:        names,
+			existing:     []string{"a", "other"},
+			wantExisting: true,
+		},
+		{
+			desc:         "quota exceeded",
+			names:        names,
+			existing:     []string{"other"},
+			wantExisting: true,
+			want:         errors.ErrQuotaExceeded{Metric: BackendServices, Limit: 10, Usage: 7, Required: 4},
+		},
+		{
+			desc:         "failed to list existing resources",
+			names:        names,
+			existingErr:  fmt.Errorf("error"),
+			wantExisting: true,
+		},
+		{
+			desc:      "failed to get quotas",
+			names:     names,
+			quotasErr: fmt.Errorf("error"),
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			c := &Checker{getQuotas: func() ([]*compute.Quota, error) { return quotas, tc.quotasErr }}
+			calledExisting := false
+			existing := func() (sets.String, error) {
+				calledExisting = true
+				return sets.NewString(tc.existing...), tc.existingErr
+			}
+			err := c.Check(tc.names, existing, BackendServices, HealthChecks)
+			if !reflect.DeepEqual(err, tc.want) {
+				t.Errorf("Check() = %v, want %v", err, tc.want)
+			}
+			if calledExisting != tc.wantExisting {
+				t.Errorf("Got existing called %t, want %t", calledExisting, tc.wantExisting)
+			}
+		})
+	}
+}
+
+func TestQuotasCached(t *testing.T) {
+	calls := 0
+	c := &Checker{getQuotas: func() ([]*compute.Quota, error) {
+		calls++
+		return []*compute.Quota{{Metric: NetworkEndpointGroups, Limit: 100}}, nil
+	}}
+	for i := 0; i < 2; i++ {
+		quotas, err := c.Quotas()
+		if err != nil {
+			t.Fatalf("Quotas() = %v, want nil", err)
+		}
+		if q := quotas[NetworkEndpointGroups]; q == nil || q.Limit != 100 {
+			t.Errorf("Quotas() = %v, want the NETWORK_ENDPOINT_GROUPS quota", quotas)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Got quotas fetched %d times, want 1", calls)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
@@ -31,6 +32,8 @@ import (
 
 // GCERateLimiter implements cloud.RateLimiter
 type GCERateLimiter struct {
+	// lock guards rateLimitImpls, which Update replaces.
+	lock sync.RWMutex
 	// Map a RateLimitKey to its rate limiter implementation.
 	rateLimitImpls map[cloud.RateLimitKey]flowcontrol.RateLimiter
 	// Minimum polling interval for getting operations. Underlying operations rate limiter
@@ -38,10 +41,77 @@ type GCERateLimiter struct {
 	operationPollInterval time.Duration
 }
 
+var (
+	// limitersLock guards limiters.
+	limitersLock sync.Mutex
+	// limiters are the rate limiters created by NewGCERateLimiter, which
+	// UpdateAll reconfigures.
+	limiters []*GCERateLimiter
+	// updatedSpecs are the specs of the last UpdateAll, which replace those
+	// of the rate limiters created afterwards.
+	updatedSpecs []string
+)
+
 // NewGCERateLimiter parses the list of rate limiting specs passed in and
 // returns a properly configured cloud.RateLimiter implementation.
 // Expected format of specs: {"[version].[service].[operation],[type],[param1],[param2],..", "..."}
 func NewGCERateLimiter(specs []string, operationPollInterval time.Duration) (*GCERateLimiter, error) {
+	rateLimitImpls, err := parseSpecs(specs)
+	if err != nil {
+		return nil, err
+	}
+	if len(rateLimitImpls) == 0 {
+		return nil, nil
+	}
+	l := &GCERateLimiter{
+		rateLimitImpls:        rateLimitImpls,
+		operationPollInterval: operationPollInterval,
+	}
+	limitersLock.Lock()
+	defer limitersLock.Unlock()
+	if updatedSpecs != nil {
+		if err := l.Update(updatedSpecs); err != nil {
+			return nil, err
+		}
+	}
+	limiters = append(limiters, l)
+	return l, nil
+}
+
+// Update replaces the rate limiting specs of the rate limiter. The calls
+// waiting on the previous rate limiters are not affected.
+func (l *GCERateLimiter) Update(specs []string) error {
+	rateLimitImpls, err := parseSpecs(specs)
+	if err != nil {
+		return err
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.rateLimitImpls = rateLimitImpls
+	return nil
+}
+
+// UpdateAll replaces the rate limiting specs of all the rate limiters created
+// by NewGCERateLimiter, including those created afterwards. The GCE clients
+// created without rate limits, as the specs were empty, remain without.
+func UpdateAll(specs []string) error {
+	if _, err := parseSpecs(specs); err != nil {
+		return err
+	}
+	limitersLock.Lock()
+	defer limitersLock.Unlock()
+	updatedSpecs = append([]string{}, specs...)
+	for _, l := range limiters {
+		if err := l.Update(specs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseSpecs returns the rate limiter implementations of the rate limiting
+// specs, by RateLimitKey.
+func parseSpecs(specs []string) (map[cloud.RateLimitKey]flowcontrol.RateLimiter, error) {
 	rateLimitImpls := make(map[cloud.RateLimitKey]flowcontrol.RateLimiter)
 	// Within each specification, split on comma to get the operation,
 	// rate limiter type, and extra parameters.
@@ -63,13 +133,7 @@ func NewGCERateLimiter(specs []string, operationPollInterval time.Duration) (*GC
 		rateLimitImpls[key] = impl
 		klog.Infof("Configured rate limiting for: %v", key)
 	}
-	if len(rateLimitImpls) == 0 {
-		return nil, nil
-	}
-	return &GCERateLimiter{
-		rateLimitImpls:        rateLimitImpls,
-		operationPollInterval: operationPollInterval,
-	}, nil
+	return rateLimitImpls, nil
 }
 
 // Accept looks up the associated flowcontrol.RateLimiter (if exists) and waits on it.
@@ -113,6 +177,8 @@ func (l *GCERateLimiter) rateLimitImpl(key *cloud.RateLimitKey) flowcontrol.Rate
 		Version:   key.Version,
 		Service:   key.Service,
 	}
+	l.lock.RLock()
+	defer l.lock.RUnlock()
 	return l.rateLimitImpls[keyCopy]
 }
 
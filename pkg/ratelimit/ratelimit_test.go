@@ -19,6 +19,9 @@ package ratelimit
 import (
 	"testing"
 	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 )
 
 func TestGCERateLimiter(t *testing.T) {
@@ -55,3 +58,25 @@ func TestGCERateLimiter(t *testing.T) {
 		}
 	}
 }
+
+func TestGCERateLimiterUpdate(t *testing.T) {
+	l, err := NewGCERateLimiter([]string{"ga.Addresses.Get,qps,1.5,5"}, time.Second)
+	if err != nil {
+		t.Fatalf("NewGCERateLimiter() = %v, want nil", err)
+	}
+	getKey := &cloud.RateLimitKey{ProjectID: "project", Operation: "Get", Version: meta.VersionGA, Service: "Addresses"}
+	listKey := &cloud.RateLimitKey{ProjectID: "project", Operation: "List", Version: meta.VersionGA, Service: "Addresses"}
+	if l.rateLimitImpl(getKey) == nil || l.rateLimitImpl(listKey) != nil {
+		t.Fatalf("Rate limiter does not limit exactly ga.Addresses.Get")
+	}
+
+	if err := UpdateAll([]string{"gaAddresses.List,qps,2,10"}); err == nil {
+		t.Errorf("UpdateAll() = nil, want an error for an invalid spec")
+	}
+	if err := UpdateAll([]string{"ga.Addresses.List,qps,2,10"}); err != nil {
+		t.Fatalf("UpdateAll() = %v, want nil", err)
+	}
+	if l.rateLimitImpl(getKey) != nil || l.rateLimitImpl(listKey) == nil {
+		t.Errorf("Updated rate limiter does not limit exactly ga.Addresses.List")
+	}
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package reload applies the flags set in a ConfigMap to the running
+// controller, so that tuning knobs can be changed without a restart.
+package reload
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	api_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/flags"
+	"k8s.io/ingress-gce/pkg/ratelimit"
+	"k8s.io/klog"
+)
+
+// RateLimitFlag is the flag of the GCE rate limits. Its ConfigMap value is
+// the list of rate limiting specs separated by ';'.
+const RateLimitFlag = "gce-ratelimit"
+
+// resyncPeriod is the period at which the ConfigMap is applied again, which
+// retries the values which failed to apply.
+const resyncPeriod = 10 * time.Minute
+
+// Reloadable are the flags which can be set in the ConfigMap. They are read
+// on each use rather than at startup, through flags.Reloadable, which
+// excludes their updates. The GCE rate limits are updated by the rate
+// limiters.
+var Reloadable = map[string]bool{
+	"preserve-managed-static-ips":       true,
+	"sync-stuck-threshold":              true,
+	"ssl-cert-expiry-warning-period":    true,
+	"node-filter-include-unschedulable": true,
+	"node-filter-include-not-ready":     true,
+	"neg-attach-warm-pods-first":        true,
+	"enable-shared-health-checks":       true,
+	"max-ig-size":                       true,
+	RateLimitFlag:                       true,
+}
+
+// Reloader sets the Reloadable flags to the values of a ConfigMap, keyed by
+// flag name. The flags which are not in the ConfigMap, or which are removed
+// from it, keep or get back their value from the command line.
+type Reloader struct {
+	client  kubernetes.Interface
+	name    types.NamespacedName
+	flagSet *flag.FlagSet
+	// setRateLimits replaces the rate limits of the GCE clients.
+	setRateLimits func(specs []string) error
+
+	lock sync.Mutex
+	// initial are the values of the Reloadable flags from the command line.
+	initial map[string]string
+	// current are the values last applied to the Reloadable flags.
+	current map[string]string
+}
+
+// NewReloader returns a Reloader of the flags of flagSet from the ConfigMap
+// with the given name.
+func NewReloader(client kubernetes.Interface, name types.NamespacedName, flagSet *flag.FlagSet) *Reloader {
+	r := &Reloader{
+		client:        client,
+		name:          name,
+		flagSet:       flagSet,
+		setRateLimits: ratelimit.UpdateAll,
+		initial:       map[string]string{},
+		current:       map[string]string{},
+	}
+	for name := range Reloadable {
+		if f := flagSet.Lookup(name); f != nil {
+			r.initial[name] = f.Value.String()
+			r.current[name] = r.initial[name]
+		}
+	}
+	return r
+}
+
+// Run applies the ConfigMap whenever it changes, until stopCh is closed.
+func (r *Reloader) Run(stopCh <-chan struct{}) {
+	lw := cache.NewListWatchFromClient(r.client.CoreV1().RESTClient(), "configmaps", r.name.Namespace, fields.OneTermEqualSelector("metadata.name", r.name.Name))
+	_, informer := cache.NewInformer(lw, &api_v1.ConfigMap{}, resyncPeriod, cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			r.Apply(obj.(*api_v1.ConfigMap).Data)
+		},
+		UpdateFunc: func(_, cur interface{}) {
+			r.Apply(cur.(*api_v1.ConfigMap).Data)
+		},
+		DeleteFunc: func(interface{}) {
+			r.Apply(nil)
+		},
+	})
+	klog.Infof("Reloading flags from ConfigMap %v", r.name)
+	informer.Run(stopCh)
+}
+
+// Apply sets the Reloadable flags to the given values, and the others back to
+// their initial value. Invalid values and other flags are logged and ignored.
+func (r *Reloader) Apply(data map[string]string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var ignored []string
+	for name := range data {
+		if _, ok := r.initial[name]; !ok {
+			ignored = append(ignored, name)
+		}
+	}
+	if len(ignored) > 0 {
+		sort.Strings(ignored)
+		klog.Warningf("Ignoring flags %v of ConfigMap %v, which cannot be reloaded", ignored, r.name)
+	}
+
+	for name, initial := range r.initial {
+		value, ok := data[name]
+		if !ok {
+			value = initial
+		}
+		if value == r.current[name] {
+			continue
+		}
+		if err := r.set(name, value); err != nil {
+			klog.Errorf("Failed to set flag %s to %q from ConfigMap %v: %v", name, value, r.name, err)
+			continue
+		}
+		klog.Infof("Set flag %s to %q, was %q", name, value, r.current[name])
+		r.current[name] = value
+	}
+}
+
+func (r *Reloader) set(name, value string) error {
+	if name != RateLimitFlag {
+		return flags.UpdateReloadable(func() error {
+			return r.flagSet.Set(name, value)
+		})
+	}
+	var specs []string
+	if value != "" {
+		specs = strings.Split(value, ";")
+	}
+	return r.setRateLimits(specs)
+}
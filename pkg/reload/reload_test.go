@@ -0,0 +1,109 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reload
+
+import (
+	"reflect"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/ingress-gce/pkg/flags"
+)
+
+func TestApply(t *testing.T) {
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	maxIGSize := flagSet.Int("max-ig-size", 1000, "")
+	preserve := flagSet.Bool("preserve-managed-static-ips", false, "")
+	flagSet.String(RateLimitFlag, "ga.Operations.Get,qps,10,10", "")
+	port := flagSet.Int("healthz-port", 8081, "")
+
+	r := NewReloader(fake.NewSimpleClientset(), types.NamespacedName{Namespace: "kube-system", Name: "config"}, flagSet)
+	var rateLimits [][]string
+	r.setRateLimits = func(specs []string) error {
+		rateLimits = append(rateLimits, specs)
+		return nil
+	}
+
+	r.Apply(map[string]string{
+		"max-ig-size":                 "500",
+		"preserve-managed-static-ips": "yes",
+		RateLimitFlag:                 "ga.Addresses.Get,qps,1,5;ga.Addresses.List,qps,1,5",
+		"healthz-port":                "9090",
+	})
+	if *maxIGSize != 500 {
+		t.Errorf("Got max-ig-size %d, want 500", *maxIGSize)
+	}
+	// Invalid values and flags which cannot be reloaded are ignored.
+	if *preserve {
+		t.Errorf("Got preserve-managed-static-ips true for an invalid value, want false")
+	}
+	if *port != 8081 {
+		t.Errorf("Got healthz-port %d, want 8081 as it cannot be reloaded", *port)
+	}
+	wantRateLimits := [][]string{{"ga.Addresses.Get,qps,1,5", "ga.Addresses.List,qps,1,5"}}
+	if !reflect.DeepEqual(rateLimits, wantRateLimits) {
+		t.Errorf("Got rate limits %v, want %v", rateLimits, wantRateLimits)
+	}
+
+	// Applying the same values again changes nothing, and the flags
+	// removed from the ConfigMap get back their initial value.
+	r.Apply(map[string]string{"max-ig-size": "500", "preserve-managed-static-ips": "true"})
+	if *maxIGSize != 500 || !*preserve {
+		t.Errorf("Got max-ig-size %d and preserve-managed-static-ips %t, want 500 and true", *maxIGSize, *preserve)
+	}
+	wantRateLimits = append(wantRateLimits, []string{"ga.Operations.Get,qps,10,10"})
+	if !reflect.DeepEqual(rateLimits, wantRateLimits) {
+		t.Errorf("Got rate limits %v, want %v", rateLimits, wantRateLimits)
+	}
+
+	r.Apply(nil)
+	if *maxIGSize != 1000 || *preserve {
+		t.Errorf("Got max-ig-size %d and preserve-managed-static-ips %t after the ConfigMap was deleted, want 1000 and false", *maxIGSize, *preserve)
+	}
+}
+
+// TestReloadableFlags checks that the flags which can be set in the ConfigMap
+// are read through flags.Reloadable, which excludes their updates.
+func TestReloadableFlags(t *testing.T) {
+	flags.Register()
+	for name := range Reloadable {
+		if name == RateLimitFlag {
+			continue
+		}
+		f := flag.CommandLine.Lookup(name)
+		if f == nil {
+			t.Errorf("Flag %s does not exist", name)
+			continue
+		}
+		initial := f.Value.String()
+		value := map[string]string{"bool": "true", "duration": "1h23m0s", "int": "1234"}[f.Value.Type()]
+		if initial == "true" {
+			value = "false"
+		}
+		before := flags.Reloadable()
+		if err := f.Value.Set(value); err != nil {
+			t.Errorf("Set(%s, %q) = %v", name, value, err)
+			continue
+		}
+		if reflect.DeepEqual(flags.Reloadable(), before) {
+			t.Errorf("Setting flag %s did not change flags.Reloadable()", name)
+		}
+		f.Value.Set(initial)
+	}
+}
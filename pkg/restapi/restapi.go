@@ -0,0 +1,159 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package restapi calls the Google Cloud REST APIs which the vendored client
+// libraries do not expose, and waits for the operations they start.
+package restapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const statusDone = "DONE"
+
+var (
+	// OperationPollInterval is the interval between the polls of an
+	// operation.
+	OperationPollInterval = 2 * time.Second
+	// OperationTimeout is how long an operation is waited for before
+	// giving up.
+	OperationTimeout = 5 * time.Minute
+)
+
+// WaitForOperation calls done every OperationPollInterval until it returns
+// true or an error, for at most OperationTimeout. name identifies the
+// operation in the timeout error.
+func WaitForOperation(name string, done func() (bool, error)) error {
+	err := wait.PollImmediate(OperationPollInterval, OperationTimeout, done)
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("timed out after %v waiting for operation %s", OperationTimeout, name)
+	}
+	return err
+}
+
+// Client sends JSON requests to the REST APIs.
+type Client struct {
+	client *http.Client
+}
+
+// NewClient returns a Client using the given authenticated HTTP client.
+func NewClient(client *http.Client) *Client {
+	return &Client{client: client}
+}
+
+// computeOperation is an operation of the compute API.
+type computeOperation struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	SelfLink string `json:"selfLink"`
+	Error    *struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	} `json:"error"`
+}
+
+// longRunningOperation is an operation of the APIs using the long running
+// operations of google.longrunning, such as the network security API.
+type longRunningOperation struct {
+	Name  string `json:"name"`
+	Done  bool   `json:"done"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// DoComputeOperation sends a request with the JSON encoded body to the URL of
+// the compute API, and waits for the operation it starts to complete.
+func (c *Client) DoComputeOperation(method, url string, body interface{}) error {
+	op := &computeOperation{}
+	if err := c.Do(method, url, body, op); err != nil {
+		return err
+	}
+	err := WaitForOperation(op.SelfLink, func() (bool, error) {
+		if op.Status == statusDone {
+			return true, nil
+		}
+		return false, c.Do(http.MethodGet, op.SelfLink, nil, op)
+	})
+	if err != nil {
+		return err
+	}
+	if op.Error != nil && len(op.Error.Errors) > 0 {
+		return fmt.Errorf("operation %s failed: %s: %s", op.SelfLink, op.Error.Errors[0].Code, op.Error.Errors[0].Message)
+	}
+	return nil
+}
+
+// DoLongRunningOperation sends a request with the JSON encoded body to the
+// URL, and waits for the long running operation it starts to complete. The
+// operation is polled relative to basePath, the base path of its API.
+func (c *Client) DoLongRunningOperation(method, url, basePath string, body interface{}) error {
+	op := &longRunningOperation{}
+	if err := c.Do(method, url, body, op); err != nil {
+		return err
+	}
+	err := WaitForOperation(op.Name, func() (bool, error) {
+		if op.Done {
+			return true, nil
+		}
+		return false, c.Do(http.MethodGet, basePath+op.Name, nil, op)
+	})
+	if err != nil {
+		return err
+	}
+	if op.Error != nil {
+		return fmt.Errorf("operation %s failed: %d: %s", op.Name, op.Error.Code, op.Error.Message)
+	}
+	return nil
+}
+
+// Do sends a request with the JSON encoded body to the URL, and decodes the
+// response into out if it is not nil.
+func (c *Client) Do(method, url string, body, out interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, url, &reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer googleapi.CloseBody(resp)
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package restapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDoComputeOperation(t *testing.T) {
+	defer func(interval, timeout time.Duration) {
+		OperationPollInterval, OperationTimeout = interval, timeout
+	}(OperationPollInterval, OperationTimeout)
+	OperationPollInterval, OperationTimeout = time.Millisecond, 100*time.Millisecond
+
+	for _, tc := range []struct {
+		desc string
+		// polls is the number of polls after which the operation is
+		// done, or -1 if it never is.
+		polls   int
+		failed  bool
+		wantErr string
+	}{
+		{desc: "done immediately", polls: 0},
+		{desc: "done after polls", polls: 3},
+		{desc: "failed operation", polls: 1, failed: true, wantErr: "QUOTA_EXCEEDED"},
+		{desc: "operation never done", polls: -1, wantErr: "timed out"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var server *httptest.Server
+			polled := 0
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					polled++
+				}
+				status := "RUNNING"
+				if tc.polls >= 0 && polled >= tc.polls {
+					status = "DONE"
+				}
+				opErr := ""
+				if tc.failed && status == "DONE" {
+					opErr = `, "error": {"errors": [{"code": "QUOTA_EXCEEDED", "message": "quota"}]}`
+				}
+				fmt.Fprintf(w, `{"name": "op", "status": %q, "selfLink": "%s/op"%s}`, status, server.URL, opErr)
+			}))
+			defer server.Close()
+
+			err := NewClient(server.Client()).DoComputeOperation(http.MethodPatch, server.URL+"/resource", nil)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("DoComputeOperation() = %v, want nil", err)
+				}
+				if polled != tc.polls {
+					t.Errorf("polled the operation %d times, want %d", polled, tc.polls)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("DoComputeOperation() = %v, want an error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestDoLongRunningOperation(t *testing.T) {
+	defer func(interval, timeout time.Duration) {
+		OperationPollInterval, OperationTimeout = interval, timeout
+	}(OperationPollInterval, OperationTimeout)
+	OperationPollInterval, OperationTimeout = time.Millisecond, 100*time.Millisecond
+
+	for _, tc := range []struct {
+		desc string
+		// polls is the number of polls after which the operation is
+		// done, or -1 if it never is.
+		polls   int
+		failed  bool
+		wantErr string
+	}{
+		{desc: "done after polls", polls: 2},
+		{desc: "failed operation", polls: 1, failed: true, wantErr: "permission denied"},
+		{desc: "operation never done", polls: -1, wantErr: "timed out"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			polled := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					if r.URL.Path != "/v1/operations/op" {
+						t.Errorf("polled %q, want /v1/operations/op", r.URL.Path)
+					}
+					polled++
+				}
+				done := tc.polls >= 0 && polled >= tc.polls
+				opErr := ""
+				if tc.failed && done {
+					opErr = `, "error": {"code": 7, "message": "permission denied"}`
+				}
+				fmt.Fprintf(w, `{"name": "operations/op", "done": %t%s}`, done, opErr)
+			}))
+			defer server.Close()
+
+			err := NewClient(server.Client()).DoLongRunningOperation(http.MethodPost, server.URL+"/v1/policies", server.URL+"/v1/", nil)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("DoLongRunningOperation() = %v, want nil", err)
+				}
+				if polled != tc.polls {
+					t.Errorf("polled the operation %d times, want %d", polled, tc.polls)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("DoLongRunningOperation() = %v, want an error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
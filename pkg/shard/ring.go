@@ -0,0 +1,195 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package shard spreads the namespaces of the cluster over the replicas of
+// the controller.
+package shard
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coordinationclient "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	"k8s.io/klog"
+)
+
+// ringLabel is the label of the Leases of the members of a ring, set to the
+// name of the ring.
+const ringLabel = "networking.gke.io/ingress-gce-shard"
+
+// Ring assigns each namespace to one of the replicas of the controller. Each
+// replica publishes its membership with a Lease which it renews, and the
+// members are the replicas whose Lease did not expire. Namespaces are
+// assigned with rendezvous hashing, so that only the namespaces of a joining
+// or leaving member change owner.
+type Ring struct {
+	client        coordinationclient.LeasesGetter
+	namespace     string
+	name          string
+	identity      string
+	leaseDuration time.Duration
+	// now returns the current time, overridden in tests.
+	now func() time.Time
+
+	lock     sync.Mutex
+	members  []string
+	handlers []func()
+}
+
+// NewRing returns the ring with the given name of the replica with the given
+// identity. Leases are created in namespace and expire after leaseDuration.
+func NewRing(client coordinationclient.LeasesGetter, namespace, name, identity string, leaseDuration time.Duration) *Ring {
+	return &Ring{
+		client:        client,
+		namespace:     namespace,
+		name:          name,
+		identity:      identity,
+		leaseDuration: leaseDuration,
+		now:           time.Now,
+	}
+}
+
+// Owns returns true if the namespace is assigned to this replica. No
+// namespace is owned until the replica joined the ring.
+func (r *Ring) Owns(namespace string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return owner(r.members, namespace) == r.identity
+}
+
+// AddChangeHandler registers a function called when the members of the ring
+// change, i.e. when namespaces may have changed owner.
+func (r *Ring) AddChangeHandler(handler func()) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.handlers = append(r.handlers, handler)
+}
+
+// Run renews the Lease of the replica and refreshes the members of the ring
+// until stopCh is closed, then deletes the Lease so that the other members
+// take over its namespaces.
+func (r *Ring) Run(stopCh <-chan struct{}) {
+	klog.V(0).Infof("Joining shard ring %s/%s as %q", r.namespace, r.name, r.identity)
+	wait.Until(func() {
+		if err := r.sync(); err != nil {
+			klog.Errorf("Failed to sync shard ring %s/%s: %v", r.namespace, r.name, err)
+		}
+	}, r.leaseDuration/3, stopCh)
+
+	if err := r.client.Leases(r.namespace).Delete(r.leaseName(), &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		klog.Errorf("Failed to delete Lease %s/%s: %v", r.namespace, r.leaseName(), err)
+	}
+}
+
+// sync renews the Lease of the replica and refreshes the members of the ring.
+func (r *Ring) sync() error {
+	if err := r.renew(); err != nil {
+		return err
+	}
+	leases, err := r.client.Leases(r.namespace).List(metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", ringLabel, r.name)})
+	if err != nil {
+		return fmt.Errorf("failed to list Leases: %v", err)
+	}
+	var members []string
+	for _, lease := range leases.Items {
+		if lease.Spec.HolderIdentity == nil || lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+		if r.now().Before(expiry) {
+			members = append(members, *lease.Spec.HolderIdentity)
+		}
+	}
+	sort.Strings(members)
+
+	r.lock.Lock()
+	changed := !reflect.DeepEqual(members, r.members)
+	r.members = members
+	handlers := r.handlers
+	r.lock.Unlock()
+
+	if changed {
+		klog.V(0).Infof("Members of shard ring %s/%s changed to %v", r.namespace, r.name, members)
+		for _, handler := range handlers {
+			handler()
+		}
+	}
+	return nil
+}
+
+// renew creates or renews the Lease of the replica.
+func (r *Ring) renew() error {
+	leases := r.client.Leases(r.namespace)
+	now := metav1.NewMicroTime(r.now())
+	duration := int32(r.leaseDuration.Seconds())
+	lease, err := leases.Get(r.leaseName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      r.leaseName(),
+				Namespace: r.namespace,
+				Labels:    map[string]string{ringLabel: r.name},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &r.identity,
+				LeaseDurationSeconds: &duration,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		if _, err := leases.Create(lease); err != nil {
+			return fmt.Errorf("failed to create Lease %s/%s: %v", r.namespace, r.leaseName(), err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get Lease %s/%s: %v", r.namespace, r.leaseName(), err)
+	}
+	lease.Spec.HolderIdentity = &r.identity
+	lease.Spec.LeaseDurationSeconds = &duration
+	lease.Spec.RenewTime = &now
+	if _, err := leases.Update(lease); err != nil {
+		return fmt.Errorf("failed to renew Lease %s/%s: %v", r.namespace, r.leaseName(), err)
+	}
+	return nil
+}
+
+func (r *Ring) leaseName() string {
+	return fmt.Sprintf("%s-%s", r.name, r.identity)
+}
+
+// owner returns the member with the highest hash of the member and the
+// namespace, empty if there are no members.
+func owner(members []string, namespace string) string {
+	var owner string
+	var max uint64
+	for _, member := range members {
+		hash := sha256.Sum256([]byte(member + "/" + namespace))
+		if sum := binary.BigEndian.Uint64(hash[:8]); owner == "" || sum > max {
+			owner, max = member, sum
+		}
+	}
+	return owner
+}
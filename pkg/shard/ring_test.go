@@ -0,0 +1,97 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shard
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRing(t *testing.T) {
+	client := fake.NewSimpleClientset().CoordinationV1()
+	now := time.Now()
+	var rings []*Ring
+	for _, id := range []string{"a", "b", "c"} {
+		r := NewRing(client, "kube-system", "ingress-gce", id, 15*time.Second)
+		r.now = func() time.Time { return now }
+		rings = append(rings, r)
+	}
+
+	if rings[0].Owns("default") {
+		t.Errorf("Owns(%q) = true before joining the ring, want false", "default")
+	}
+	changes := 0
+	rings[0].AddChangeHandler(func() { changes++ })
+	// Members only see the members which joined after them on their next
+	// sync.
+	for _, r := range append(rings, rings...) {
+		if err := r.sync(); err != nil {
+			t.Fatalf("sync() = %v, want nil", err)
+		}
+	}
+	if changes != 2 {
+		t.Errorf("got %d changes, want 2", changes)
+	}
+
+	owned := map[string]int{}
+	for i := 0; i < 100; i++ {
+		ns := fmt.Sprintf("ns-%d", i)
+		var owners []string
+		for _, r := range rings {
+			if r.Owns(ns) {
+				owners = append(owners, r.identity)
+				owned[r.identity]++
+			}
+		}
+		if len(owners) != 1 {
+			t.Errorf("namespace %q is owned by %v, want exactly one member", ns, owners)
+		}
+	}
+	for _, r := range rings {
+		if owned[r.identity] == 0 {
+			t.Errorf("member %q owns no namespace", r.identity)
+		}
+	}
+
+	// Member c stops renewing its Lease, its namespaces move to a and b
+	// once the Lease expired, the other namespaces keep their owner.
+	now = now.Add(20 * time.Second)
+	for _, r := range []*Ring{rings[0], rings[1], rings[0]} {
+		if err := r.sync(); err != nil {
+			t.Fatalf("sync() = %v, want nil", err)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		ns := fmt.Sprintf("ns-%d", i)
+		switch owner([]string{"a", "b", "c"}, ns) {
+		case "a":
+			if !rings[0].Owns(ns) {
+				t.Errorf("namespace %q moved from a after member c left", ns)
+			}
+		case "b":
+			if !rings[1].Owns(ns) {
+				t.Errorf("namespace %q moved from b after member c left", ns)
+			}
+		}
+		if rings[0].Owns(ns) == rings[1].Owns(ns) {
+			t.Errorf("namespace %q is not owned by exactly one of a and b", ns)
+		}
+	}
+}
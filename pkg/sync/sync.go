@@ -34,10 +34,12 @@ var ErrSkipBackendsSync = errors.New("ingress skip backends sync and beyond")
 // an implementation of Controller.
 type IngressSyncer struct {
 	controller Controller
+	// classes resolves the IngressClasses of Ingresses, nil if disabled.
+	classes utils.IngressClassLookup
 }
 
-func NewIngressSyncer(controller Controller) Syncer {
-	return &IngressSyncer{controller}
+func NewIngressSyncer(controller Controller, classes utils.IngressClassLookup) Syncer {
+	return &IngressSyncer{controller: controller, classes: classes}
 }
 
 // Sync implements Syncer.
@@ -66,7 +68,9 @@ func (s *IngressSyncer) GC(ings []*v1beta1.Ingress) error {
 	// An Ingress is considered to exist and not considered for cleanup, if:
 	// 1) It is a GCLB Ingress.
 	// 2) It is not a candidate for deletion.
-	toCleanup, toKeep := operator.Ingresses(ings).Partition(utils.NeedsCleanup)
+	toCleanup, toKeep := operator.Ingresses(ings).Partition(func(ing *v1beta1.Ingress) bool {
+		return utils.NeedsCleanup(ing, s.classes)
+	})
 	toKeepIngresses := toKeep.AsList()
 	lbErr := s.controller.GCLoadBalancers(toKeepIngresses)
 	beErr := s.controller.GCBackends(toKeepIngresses)
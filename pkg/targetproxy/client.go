@@ -0,0 +1,124 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package targetproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"k8s.io/ingress-gce/pkg/restapi"
+)
+
+const computeBasePath = "https://compute.googleapis.com/compute/v1/"
+
+const (
+	// HTTP is the collection of global target HTTP proxies.
+	HTTP = "targetHttpProxies"
+	// HTTPS is the collection of global target HTTPS proxies.
+	HTTPS = "targetHttpsProxies"
+)
+
+// Proxy holds the settings of a global target HTTP or HTTPS proxy which the
+// compute API version vendored by the controller does not expose. See
+// https://cloud.google.com/compute/docs/reference/rest/v1/targetHttpProxies.
+type Proxy struct {
+	Name string `json:"name"`
+	// HttpKeepAliveTimeoutSec is the client HTTP keepalive timeout. Zero
+	// means the load balancer default.
+	HttpKeepAliveTimeoutSec int64 `json:"httpKeepAliveTimeoutSec,omitempty"`
+	// ServerTlsPolicy is the URL of the ServerTlsPolicy of an HTTPS proxy,
+	// which validates the client certificates.
+	ServerTlsPolicy string `json:"serverTlsPolicy,omitempty"`
+	// Fingerprint must be sent back when patching the proxy.
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// NullFields are the JSON names of the fields sent as null, which
+	// patching clears.
+	NullFields []string `json:"-"`
+}
+
+// MarshalJSON encodes the proxy with its NullFields set to null.
+func (p Proxy) MarshalJSON() ([]byte, error) {
+	type noMethod Proxy
+	raw, err := json.Marshal(noMethod(p))
+	if err != nil || len(p.NullFields) == 0 {
+		return raw, err
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	for _, f := range p.NullFields {
+		fields[f] = nil
+	}
+	return json.Marshal(fields)
+}
+
+// Client gets and patches the global target proxies of a project.
+type Client interface {
+	// Get returns the proxy with the given name in the collection, HTTP or
+	// HTTPS.
+	Get(collection, name string) (*Proxy, error)
+	// Patch updates the proxy with the name of proxy in the collection.
+	Patch(collection string, proxy *Proxy) error
+
+	// GetServerTlsPolicy returns the global ServerTlsPolicy with the given
+	// name.
+	GetServerTlsPolicy(name string) (*ServerTlsPolicy, error)
+	// CreateServerTlsPolicy creates the global ServerTlsPolicy with the
+	// given name.
+	CreateServerTlsPolicy(name string, policy *ServerTlsPolicy) error
+	// PatchServerTlsPolicy updates the mTLS policy of the global
+	// ServerTlsPolicy with the given name.
+	PatchServerTlsPolicy(name string, policy *ServerTlsPolicy) error
+	// DeleteServerTlsPolicy deletes the global ServerTlsPolicy with the
+	// given name.
+	DeleteServerTlsPolicy(name string) error
+	// ServerTlsPolicyURL returns the URL of the global ServerTlsPolicy with
+	// the given name, as referenced by the proxies.
+	ServerTlsPolicyURL(name string) string
+}
+
+// restClient is a Client using the Compute Engine REST API.
+type restClient struct {
+	api     *restapi.Client
+	project string
+}
+
+// NewClient returns a Client of the proxies in the given project using the
+// given authenticated HTTP client.
+func NewClient(client *http.Client, project string) Client {
+	return &restClient{api: restapi.NewClient(client), project: project}
+}
+
+// Get implements Client.
+func (c *restClient) Get(collection, name string) (*Proxy, error) {
+	proxy := &Proxy{}
+	if err := c.api.Do(http.MethodGet, c.proxyURL(collection, name), nil, proxy); err != nil {
+		return nil, err
+	}
+	return proxy, nil
+}
+
+// Patch implements Client.
+func (c *restClient) Patch(collection string, proxy *Proxy) error {
+	return c.api.DoComputeOperation(http.MethodPatch, c.proxyURL(collection, proxy.Name), proxy)
+}
+
+func (c *restClient) proxyURL(collection, name string) string {
+	return fmt.Sprintf("%sprojects/%s/global/%s/%s", computeBasePath, c.project, collection, name)
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package targetproxy
+
+import (
+	"net/http"
+
+	"google.golang.org/api/googleapi"
+)
+
+// FakeProject is the project of the ServerTlsPolicies of a FakeClient.
+const FakeProject = "fake-project"
+
+// FakeClient is a Client storing proxies in memory, by collection and name,
+// and ServerTlsPolicies by name.
+type FakeClient struct {
+	Proxies  map[string]map[string]*Proxy
+	Policies map[string]*ServerTlsPolicy
+}
+
+// NewFakeClient returns a new FakeClient.
+func NewFakeClient() *FakeClient {
+	return &FakeClient{
+		Proxies:  map[string]map[string]*Proxy{HTTP: {}, HTTPS: {}},
+		Policies: map[string]*ServerTlsPolicy{},
+	}
+}
+
+// Get implements Client.
+func (f *FakeClient) Get(collection, name string) (*Proxy, error) {
+	proxy, ok := f.Proxies[collection][name]
+	if !ok {
+		return nil, &googleapi.Error{Code: http.StatusNotFound}
+	}
+	copied := *proxy
+	return &copied, nil
+}
+
+// Patch implements Client.
+func (f *FakeClient) Patch(collection string, proxy *Proxy) error {
+	if _, ok := f.Proxies[collection][proxy.Name]; !ok {
+		return &googleapi.Error{Code: http.StatusNotFound}
+	}
+	patched := *proxy
+	f.Proxies[collection][proxy.Name] = &patched
+	return nil
+}
+
+// GetServerTlsPolicy implements Client.
+func (f *FakeClient) GetServerTlsPolicy(name string) (*ServerTlsPolicy, error) {
+	policy, ok := f.Policies[name]
+	if !ok {
+		return nil, &googleapi.Error{Code: http.StatusNotFound}
+	}
+	copied := *policy
+	return &copied, nil
+}
+
+// CreateServerTlsPolicy implements Client.
+func (f *FakeClient) CreateServerTlsPolicy(name string, policy *ServerTlsPolicy) error {
+	if _, ok := f.Policies[name]; ok {
+		return &googleapi.Error{Code: http.StatusConflict}
+	}
+	created := *policy
+	f.Policies[name] = &created
+	return nil
+}
+
+// PatchServerTlsPolicy implements Client.
+func (f *FakeClient) PatchServerTlsPolicy(name string, policy *ServerTlsPolicy) error {
+	existing, ok := f.Policies[name]
+	if !ok {
+		return &googleapi.Error{Code: http.StatusNotFound}
+	}
+	existing.MtlsPolicy = policy.MtlsPolicy
+	return nil
+}
+
+// DeleteServerTlsPolicy implements Client.
+func (f *FakeClient) DeleteServerTlsPolicy(name string) error {
+	if _, ok := f.Policies[name]; !ok {
+		return &googleapi.Error{Code: http.StatusNotFound}
+	}
+	delete(f.Policies, name)
+	return nil
+}
+
+// ServerTlsPolicyURL implements Client.
+func (f *FakeClient) ServerTlsPolicyURL(name string) string {
+	return ServerTlsPolicyURL(FakeProject, name)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package targetproxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const networkSecurityBasePath = "https://networksecurity.googleapis.com/v1/"
+
+// ServerTlsPolicy is a ServerTlsPolicy of the network security API. See
+// https://cloud.google.com/traffic-director/docs/reference/network-security/rest/v1/projects.locations.serverTlsPolicies.
+type ServerTlsPolicy struct {
+	Description string      `json:"description,omitempty"`
+	MtlsPolicy  *MtlsPolicy `json:"mtlsPolicy,omitempty"`
+}
+
+// MtlsPolicy is the validation of the client certificates of a
+// ServerTlsPolicy.
+type MtlsPolicy struct {
+	// ClientValidationMode is REJECT_INVALID or
+	// ALLOW_INVALID_OR_MISSING_CLIENT_CERT.
+	ClientValidationMode string `json:"clientValidationMode,omitempty"`
+	// ClientValidationTrustConfig is the resource name of the Certificate
+	// Manager TrustConfig which validates the client certificates.
+	ClientValidationTrustConfig string `json:"clientValidationTrustConfig,omitempty"`
+}
+
+// GetServerTlsPolicy implements Client.
+func (c *restClient) GetServerTlsPolicy(name string) (*ServerTlsPolicy, error) {
+	policy := &ServerTlsPolicy{}
+	if err := c.api.Do(http.MethodGet, c.policyURL(name), nil, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// CreateServerTlsPolicy implements Client.
+func (c *restClient) CreateServerTlsPolicy(name string, policy *ServerTlsPolicy) error {
+	u := fmt.Sprintf("%sprojects/%s/locations/global/serverTlsPolicies?serverTlsPolicyId=%s", networkSecurityBasePath, c.project, url.QueryEscape(name))
+	return c.api.DoLongRunningOperation(http.MethodPost, u, networkSecurityBasePath, policy)
+}
+
+// PatchServerTlsPolicy implements Client.
+func (c *restClient) PatchServerTlsPolicy(name string, policy *ServerTlsPolicy) error {
+	return c.api.DoLongRunningOperation(http.MethodPatch, c.policyURL(name)+"?updateMask=mtlsPolicy", networkSecurityBasePath, policy)
+}
+
+// DeleteServerTlsPolicy implements Client.
+func (c *restClient) DeleteServerTlsPolicy(name string) error {
+	return c.api.DoLongRunningOperation(http.MethodDelete, c.policyURL(name), networkSecurityBasePath, nil)
+}
+
+// ServerTlsPolicyURL implements Client.
+func (c *restClient) ServerTlsPolicyURL(name string) string {
+	return ServerTlsPolicyURL(c.project, name)
+}
+
+// ServerTlsPolicyURL returns the URL of the global ServerTlsPolicy with the
+// given name in the project, as referenced by the proxies.
+func ServerTlsPolicyURL(project, name string) string {
+	return fmt.Sprintf("//networksecurity.googleapis.com/projects/%s/locations/global/serverTlsPolicies/%s", project, name)
+}
+
+func (c *restClient) policyURL(name string) string {
+	return fmt.Sprintf("%sprojects/%s/locations/global/serverTlsPolicies/%s", networkSecurityBasePath, c.project, name)
+}
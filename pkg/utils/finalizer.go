@@ -16,8 +16,10 @@ package utils
 import (
 	"fmt"
 
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/api/networking/v1beta1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	client "k8s.io/client-go/kubernetes/typed/networking/v1beta1"
 	"k8s.io/klog"
 	"k8s.io/kubernetes/pkg/util/slice"
@@ -26,6 +28,19 @@ import (
 // FinalizerKey is the string representing the Ingress finalizer.
 const FinalizerKey = "networking.gke.io/ingress-finalizer"
 
+// ILBFinalizerV2 is the string representing the finalizer of the internal
+// LoadBalancer Services managed by the L4 controller.
+const ILBFinalizerV2 = "gke.networking.io/l4-ilb-v2"
+
+// NetLBFinalizerV2 is the string representing the finalizer of the external
+// LoadBalancer Services with regional backend services managed by the L4
+// controller.
+const NetLBFinalizerV2 = "gke.networking.io/l4-netlb-v2"
+
+// NegFinalizerKey is the string representing the finalizer of the Services
+// with NEGs, which is removed once their NEGs are deleted.
+const NegFinalizerKey = "networking.gke.io/neg-finalizer"
+
 // IsDeletionCandidate is true if the passed in meta contains the specified finalizer.
 func IsDeletionCandidate(m meta_v1.ObjectMeta, key string) bool {
 	return m.DeletionTimestamp != nil && HasFinalizer(m, key)
@@ -72,3 +87,33 @@ func RemoveFinalizer(ing *v1beta1.Ingress, ingClient client.IngressInterface) er
 
 	return nil
 }
+
+// AddServiceFinalizer tries to add the finalizer to a Service. If the
+// finalizer already exists, it does nothing.
+func AddServiceFinalizer(svc *v1.Service, key string, svcClient corev1.ServiceInterface) error {
+	if NeedToAddFinalizer(svc.ObjectMeta, key) {
+		updated := svc.DeepCopy()
+		updated.ObjectMeta.Finalizers = append(updated.ObjectMeta.Finalizers, key)
+		if _, err := svcClient.Update(updated); err != nil {
+			return fmt.Errorf("error updating Service %s/%s: %v", svc.Namespace, svc.Name, err)
+		}
+		klog.V(3).Infof("Added finalizer %q for Service %s/%s", key, svc.Namespace, svc.Name)
+	}
+
+	return nil
+}
+
+// RemoveServiceFinalizer tries to remove the finalizer from a Service. If the
+// finalizer is not on the Service, it does nothing.
+func RemoveServiceFinalizer(svc *v1.Service, key string, svcClient corev1.ServiceInterface) error {
+	if HasFinalizer(svc.ObjectMeta, key) {
+		updated := svc.DeepCopy()
+		updated.ObjectMeta.Finalizers = slice.RemoveString(updated.ObjectMeta.Finalizers, key, nil)
+		if _, err := svcClient.Update(updated); err != nil {
+			return fmt.Errorf("error updating Service %s/%s: %v", svc.Namespace, svc.Name, err)
+		}
+		klog.V(3).Infof("Removed finalizer %q for Service %s/%s", key, svc.Namespace, svc.Name)
+	}
+
+	return nil
+}
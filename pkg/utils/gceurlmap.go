@@ -15,8 +15,10 @@ package utils
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 
+	"k8s.io/ingress-gce/pkg/annotations"
 	"k8s.io/klog"
 )
 
@@ -44,6 +46,29 @@ type HostRule struct {
 type PathRule struct {
 	Path    string
 	Backend ServicePort
+	// Rewrite is applied to requests before they are forwarded to Backend.
+	Rewrite *annotations.URLRewrite
+	// Redirect, if set, redirects requests instead of forwarding them to Backend.
+	Redirect *annotations.URLRedirect
+	// WeightedBackends, if set, splits the traffic of the path between the
+	// given backends instead of forwarding it to Backend.
+	WeightedBackends []WeightedServicePort
+	// ConditionalRoutes are evaluated in order before the path rule itself.
+	ConditionalRoutes []ConditionalRoute
+}
+
+// ConditionalRoute sends the requests of a path matching all of the header
+// and query parameter conditions to Backend.
+type ConditionalRoute struct {
+	Headers     []annotations.HeaderMatch
+	QueryParams []annotations.QueryParamMatch
+	Backend     ServicePort
+}
+
+// WeightedServicePort is a backend receiving a share of the traffic of a path.
+type WeightedServicePort struct {
+	Backend ServicePort
+	Weight  int64
 }
 
 // NewGCEURLMap returns an empty GCEURLMap
@@ -83,6 +108,27 @@ func EqualMapping(a, b *GCEURLMap) bool {
 			if aPath.Backend.ID != bPath.Backend.ID {
 				return false
 			}
+			if !reflect.DeepEqual(aPath.Rewrite, bPath.Rewrite) || !reflect.DeepEqual(aPath.Redirect, bPath.Redirect) {
+				return false
+			}
+			if len(aPath.WeightedBackends) != len(bPath.WeightedBackends) {
+				return false
+			}
+			for i, aBackend := range aPath.WeightedBackends {
+				bBackend := bPath.WeightedBackends[i]
+				if aBackend.Backend.ID != bBackend.Backend.ID || aBackend.Weight != bBackend.Weight {
+					return false
+				}
+			}
+			if len(aPath.ConditionalRoutes) != len(bPath.ConditionalRoutes) {
+				return false
+			}
+			for i, aRoute := range aPath.ConditionalRoutes {
+				bRoute := bPath.ConditionalRoutes[i]
+				if aRoute.Backend.ID != bRoute.Backend.ID || !reflect.DeepEqual(aRoute.Headers, bRoute.Headers) || !reflect.DeepEqual(aRoute.QueryParams, bRoute.QueryParams) {
+					return false
+				}
+			}
 		}
 	}
 	return true
@@ -126,20 +172,54 @@ func (g *GCEURLMap) PutPathRulesForHost(hostname string, pathRules []PathRule) {
 }
 
 // AllServicePorts return a list of all ServicePorts contained in the GCEURLMap.
+// External backend services, which the controller does not manage, are
+// omitted.
 func (g *GCEURLMap) AllServicePorts() (svcPorts []ServicePort) {
+	add := func(sp ServicePort) {
+		if sp.ExternalBackendService == "" {
+			svcPorts = append(svcPorts, sp)
+		}
+	}
 	if g.DefaultBackend != nil {
-		svcPorts = append(svcPorts, *g.DefaultBackend)
+		add(*g.DefaultBackend)
 	}
 
 	for _, rules := range g.HostRules {
 		for _, rule := range rules.Paths {
-			svcPorts = append(svcPorts, rule.Backend)
+			add(rule.Backend)
+			for _, wb := range rule.WeightedBackends {
+				add(wb.Backend)
+			}
+			for _, route := range rule.ConditionalRoutes {
+				add(route.Backend)
+			}
 		}
 	}
 
 	return
 }
 
+// UpdateServicePorts calls update on all ServicePorts contained in the
+// GCEURLMap.
+func (g *GCEURLMap) UpdateServicePorts(update func(sp *ServicePort)) {
+	if g.DefaultBackend != nil {
+		update(g.DefaultBackend)
+	}
+
+	for i := range g.HostRules {
+		for j := range g.HostRules[i].Paths {
+			rule := &g.HostRules[i].Paths[j]
+			update(&rule.Backend)
+			for k := range rule.WeightedBackends {
+				update(&rule.WeightedBackends[k].Backend)
+			}
+			for k := range rule.ConditionalRoutes {
+				update(&rule.ConditionalRoutes[k].Backend)
+			}
+		}
+	}
+}
+
 func (g *GCEURLMap) deleteHost(hostname string) {
 	// Iterate HostRules and remove any (should only be zero or one) with the provided hostname.
 	for i := len(g.HostRules) - 1; i >= 0; i-- {
@@ -150,6 +230,23 @@ func (g *GCEURLMap) deleteHost(hostname string) {
 	delete(g.hosts, hostname)
 }
 
+// UpdatePathRule calls update on the path rule of the given path of a
+// hostname. Returns false if the path does not exist for the hostname.
+func (g *GCEURLMap) UpdatePathRule(hostname, path string, update func(rule *PathRule)) bool {
+	for i := range g.HostRules {
+		if g.HostRules[i].Hostname != hostname {
+			continue
+		}
+		for j := range g.HostRules[i].Paths {
+			if g.HostRules[i].Paths[j].Path == path {
+				update(&g.HostRules[i].Paths[j])
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // HostExists returns true if the given hostname is specified in the GCEURLMap.
 func (g *GCEURLMap) HostExists(hostname string) bool {
 	return g.hosts[hostname]
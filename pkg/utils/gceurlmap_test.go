@@ -176,6 +176,24 @@ func TestAllServicePorts(t *testing.T) {
 		t.Errorf("AllServicePorts(%+v) = \n%+v\nwant\n%+v", m, gotPorts, wantPorts)
 	}
 
+	// External backend services are not managed by the controller.
+	m.DefaultBackend.ExternalBackendService = "external-backend"
+	if gotPorts := m.AllServicePorts(); !reflect.DeepEqual(gotPorts, wantPorts[1:]) {
+		t.Errorf("AllServicePorts(%+v) = \n%+v\nwant\n%+v", m, gotPorts, wantPorts[1:])
+	}
+}
+
+func TestUpdateServicePorts(t *testing.T) {
+	t.Parallel()
+	m := newTestMap()
+	m.UpdateServicePorts(func(sp *ServicePort) {
+		sp.NEGEnabled = sp.ID.Service.Name != "svc-B"
+	})
+	for _, sp := range m.AllServicePorts() {
+		if want := sp.ID.Service.Name != "svc-B"; sp.NEGEnabled != want {
+			t.Errorf("NEGEnabled of %v = %t, want %t", sp.ID, sp.NEGEnabled, want)
+		}
+	}
 }
 
 func newTestMap() *GCEURLMap {
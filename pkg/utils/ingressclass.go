@@ -0,0 +1,82 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"k8s.io/api/networking/v1beta1"
+	"k8s.io/ingress-gce/pkg/annotations"
+)
+
+// IngressClassParams are the settings of the Ingresses of an IngressClass of
+// the controller.
+type IngressClassParams struct {
+	// Scope is the backend service scope of the Ingresses, flags.ScopeGlobal
+	// or flags.ScopeRegional.
+	Scope string
+	// NetworkTier is the network tier of external load balancers, empty for
+	// the default tier.
+	NetworkTier string
+	// DefaultBackend is the backend of the Ingresses without a default
+	// backend, nil for the default backend of the cluster.
+	DefaultBackend *ServicePortID
+	// Err is set if the parameters of the IngressClass are invalid, in which
+	// case the Ingresses of the class are not synced.
+	Err error
+}
+
+// IngressClassLookup looks up the IngressClasses of the cluster.
+type IngressClassLookup interface {
+	// Params returns the settings of the IngressClass with the given name,
+	// and false if it is not an IngressClass of the controller.
+	Params(class string) (*IngressClassParams, bool)
+	// DefaultClass returns the name of the default IngressClass of the
+	// cluster, if any.
+	DefaultClass() string
+}
+
+// IngressClassParamsFor returns the settings of the IngressClass of the
+// Ingress, and false if the Ingress does not belong to an IngressClass of the
+// controller or classes is nil, i.e. IngressClasses are not enabled.
+// Ingresses without ingress class annotation belong to the default
+// IngressClass of the cluster, if any.
+func IngressClassParamsFor(ing *v1beta1.Ingress, classes IngressClassLookup) (*IngressClassParams, bool) {
+	if classes == nil {
+		return nil, false
+	}
+	class := annotations.FromIngress(ing).IngressClass()
+	if class == "" {
+		if class = classes.DefaultClass(); class == "" {
+			return nil, false
+		}
+	}
+	return classes.Params(class)
+}
+
+// defaultClassOfOtherController returns true if the Ingress has no ingress
+// class annotation and the default IngressClass of the cluster belongs to
+// another controller.
+func defaultClassOfOtherController(ing *v1beta1.Ingress, classes IngressClassLookup) bool {
+	if classes == nil || annotations.FromIngress(ing).IngressClass() != "" {
+		return false
+	}
+	class := classes.DefaultClass()
+	if class == "" {
+		return false
+	}
+	_, ok := classes.Params(class)
+	return !ok
+}
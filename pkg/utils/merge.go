@@ -0,0 +1,45 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// MergeUnsetFields sets the fields of the struct pointed to by dst which
+// have their zero value to the value of the same field in the struct pointed
+// to by src. Only top-level fields are merged: a field set in dst is kept as
+// a whole, even if some of its nested fields are unset. Pointer fields of src
+// are shared with dst, callers should pass a copy if src must not be aliased.
+func MergeUnsetFields(dst, src interface{}) error {
+	dstVal, srcVal := reflect.ValueOf(dst), reflect.ValueOf(src)
+	if dstVal.Kind() != reflect.Ptr || srcVal.Kind() != reflect.Ptr || dstVal.Type() != srcVal.Type() || dstVal.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot merge %T into %T, want pointers to the same struct type", src, dst)
+	}
+	dstVal, srcVal = dstVal.Elem(), srcVal.Elem()
+	for i := 0; i < dstVal.NumField(); i++ {
+		field := dstVal.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+		if reflect.DeepEqual(field.Interface(), reflect.Zero(field.Type()).Interface()) {
+			field.Set(srcVal.Field(i))
+		}
+	}
+	return nil
+}
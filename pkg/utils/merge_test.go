@@ -0,0 +1,71 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+type mergeTestStruct struct {
+	Name    string
+	Timeout *int64
+	Labels  map[string]string
+	Nested  *mergeTestStruct
+}
+
+func TestMergeUnsetFields(t *testing.T) {
+	one, two := int64(1), int64(2)
+	testCases := []struct {
+		desc string
+		dst  mergeTestStruct
+		src  mergeTestStruct
+		want mergeTestStruct
+	}{
+		{
+			desc: "empty dst",
+			src:  mergeTestStruct{Name: "src", Timeout: &one, Labels: map[string]string{"a": "b"}},
+			want: mergeTestStruct{Name: "src", Timeout: &one, Labels: map[string]string{"a": "b"}},
+		},
+		{
+			desc: "dst fields take precedence",
+			dst:  mergeTestStruct{Name: "dst", Timeout: &two},
+			src:  mergeTestStruct{Name: "src", Timeout: &one, Labels: map[string]string{"a": "b"}},
+			want: mergeTestStruct{Name: "dst", Timeout: &two, Labels: map[string]string{"a": "b"}},
+		},
+		{
+			desc: "nested fields are not merged",
+			dst:  mergeTestStruct{Nested: &mergeTestStruct{Name: "dst"}},
+			src:  mergeTestStruct{Nested: &mergeTestStruct{Name: "src", Timeout: &one}},
+			want: mergeTestStruct{Nested: &mergeTestStruct{Name: "dst"}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if err := MergeUnsetFields(&tc.dst, &tc.src); err != nil {
+				t.Fatalf("MergeUnsetFields() = %v, want nil", err)
+			}
+			if !reflect.DeepEqual(tc.dst, tc.want) {
+				t.Errorf("MergeUnsetFields() = %+v, want %+v", tc.dst, tc.want)
+			}
+		})
+	}
+
+	if err := MergeUnsetFields(&mergeTestStruct{}, &struct{}{}); err == nil {
+		t.Errorf("MergeUnsetFields() with different types = nil, want error")
+	}
+}
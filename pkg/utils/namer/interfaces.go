@@ -0,0 +1,115 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namer
+
+// IngressNamer is the naming policy for the GCE resources of Ingresses. It is
+// implemented by Namer. Forks can customize the names, e.g. their prefixes,
+// hashes or length budgets, by registering another implementation with
+// RegisterNamer, typically one embedding a *Namer. Note that the methods of
+// an embedded *Namer keep calling the other methods of the *Namer.
+type IngressNamer interface {
+	// SetUID sets the UID/name of this cluster.
+	SetUID(name string)
+	// SetFirewall sets the firewall name of this cluster.
+	SetFirewall(name string)
+	// UID returns the UID/name of this cluster.
+	UID() string
+	// Firewall returns the firewall name of this cluster.
+	Firewall() string
+
+	// ParseName parses the name of a resource generated by the namer.
+	ParseName(name string) *NameComponents
+	// NameBelongsToCluster checks if a given name is tagged with this
+	// cluster's UID.
+	NameBelongsToCluster(name string) bool
+
+	// IGBackend constructs the name for a backend service targeting
+	// instance groups.
+	IGBackend(port int64) string
+	// IGBackendPort retrieves the port from the given backend name.
+	IGBackendPort(beName string) (string, error)
+	// PolicyBackend constructs the name of the backend service with the
+	// given security policy of the backends of the backend service beName.
+	PolicyBackend(beName, securityPolicy string) string
+	// SharedHealthCheck constructs the name of the health check shared by
+	// the backend services whose health check settings have the given hash.
+	SharedHealthCheck(settingsHash string) string
+	// IsSharedHealthCheck returns true if the given name is the name of a
+	// shared health check of this cluster.
+	IsSharedHealthCheck(name string) bool
+	// InstanceGroup constructs the name for an Instance Group.
+	InstanceGroup() string
+	// InstanceGroupShard constructs the name of an Instance Group shard.
+	InstanceGroupShard(shard int) string
+	// InstanceGroupShardIndex returns the shard of an Instance Group name.
+	InstanceGroupShardIndex(name string) (int, bool)
+	// NamedPort returns the name for a named port.
+	NamedPort(port int64) string
+	// ProxyOnlySubnet constructs the name of the proxy-only subnet.
+	ProxyOnlySubnet() string
+	// FirewallRule constructs the full firewall rule name.
+	FirewallRule() string
+
+	// LoadBalancer constructs a loadbalancer name from the given Ingress key.
+	LoadBalancer(key string) string
+	// LoadBalancerV2 constructs the v2 loadbalancer name from the given
+	// Ingress key. The other frontend methods name the resources of v2
+	// loadbalancers with the v2 naming scheme.
+	LoadBalancerV2(key string) string
+	// LoadBalancerFromLbName reconstructs a full loadbalancer name from a
+	// given lbName.
+	LoadBalancerFromLbName(lbName string) string
+	// TargetProxy returns the name for target proxy given the load balancer
+	// name and protocol.
+	TargetProxy(lbName string, protocol NamerProtocol) string
+	// IsCertUsedForLB returns true if the resourceName belongs to this
+	// cluster's ingress.
+	IsCertUsedForLB(lbName, resourceName string) bool
+	// IsLegacySSLCert returns true if certName is an Ingress managed name
+	// following the older naming convention.
+	IsLegacySSLCert(lbName string, resourceName string) bool
+	// SSLCertName returns the name of the certificate.
+	SSLCertName(lbName string, secretHash string) string
+	// ForwardingRule returns the name of the forwarding rule prefix.
+	ForwardingRule(lbName string, protocol NamerProtocol) string
+	// HTTPSForwardingRuleForPort returns the name of the additional https
+	// forwarding rule of the load balancer serving the given port.
+	HTTPSForwardingRuleForPort(lbName string, port int64) string
+	// HTTPSForwardingRuleForPortPrefix returns the prefix of the names of
+	// the additional https forwarding rules of the load balancer.
+	HTTPSForwardingRuleForPortPrefix(lbName string) string
+	// IsHTTPSForwardingRuleForPort returns true if resourceName is the name
+	// of an additional https forwarding rule of the load balancer.
+	IsHTTPSForwardingRuleForPort(lbName, resourceName string) bool
+	// UrlMap returns the name for the UrlMap for a given load balancer.
+	UrlMap(lbName string) string
+
+	// NEG returns the gce neg name based on the service namespace, name
+	// and target port.
+	NEG(namespace, name string, port int32) string
+	// NEGWithSubset returns the gce neg name based on the service
+	// namespace, name, target port and Istio:DestinationRule subset.
+	NEGWithSubset(namespace, name, subset string, port int32) string
+	// IsNEG returns true if the name is a NEG owned by this cluster.
+	IsNEG(name string) bool
+	// L4Backend returns the name of the GCE resources of the L4 load
+	// balancer of a service.
+	L4Backend(namespace, name string) string
+}
+
+// Namer is an IngressNamer.
+var _ IngressNamer = (*Namer)(nil)
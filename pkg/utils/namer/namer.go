@@ -46,9 +46,17 @@ const (
 	backendPrefix = "be"
 	backendRegex  = "be-([0-9]+).*"
 
+	// Prefix used for the backend services of the paths with a security
+	// policy of their own.
+	policyBackendPrefix = "bp"
+
 	// Prefix used for instance groups involved in L7 balancing.
 	igPrefix = "ig"
 
+	// Prefix used for health checks shared by the backend services with the
+	// same health check settings.
+	sharedHealthCheckPrefix = "hc"
+
 	// Suffix used in the l7 firewall rule. There is currently only one.
 	// Note that this name is used by the cloudprovider lib that inserts
 	// its own k8s-fw prefix.
@@ -81,6 +89,24 @@ const (
 
 	// schemaVersionV1 is the version 1 naming scheme for NEG
 	schemaVersionV1 = "1"
+	// schemaVersionV2 is the version 2 naming scheme for the frontend
+	// resources of Ingresses.
+	schemaVersionV2 = "2"
+
+	// Resource codes of the frontend resources in the v2 naming scheme.
+	forwardingRuleV2Code      = "fr"
+	httpsForwardingRuleV2Code = "fs"
+	httpsPortRuleV2Code       = "fp"
+	targetHTTPProxyV2Code     = "tp"
+	targetHTTPSProxyV2Code    = "ts"
+	urlMapV2Code              = "um"
+	sslCertV2Code             = "cr"
+
+	// maxFrontendDescriptiveLabel is the max length for namespace and name
+	// of the Ingress in v2 frontend names. 63 - 5 (k8s and naming schema
+	// version prefix) - 2 (resource code) - 8 (truncated cluster id) - 8
+	// (suffix hash) - 4 (hyphen connector) = 36
+	maxFrontendDescriptiveLabel = 36
 )
 
 // NamerProtocol is an enum for the different protocols given as
@@ -210,6 +236,19 @@ func (n *Namer) decorateName(name string) string {
 //
 // Backend, InstanceGroup, UrlMap.
 func (n *Namer) ParseName(name string) *NameComponents {
+	// v2 names are {prefix}2-{resource}-{lbName without {prefix}2-}.
+	if strings.HasPrefix(name, n.v2Prefix()+"-") {
+		parts := strings.SplitN(name, "-", 3)
+		if len(parts) != 3 {
+			return &NameComponents{}
+		}
+		return &NameComponents{
+			ClusterName: strings.Split(parts[2], "-")[0],
+			Resource:    parts[1],
+			LbName:      n.v2Prefix() + "-" + parts[2],
+		}
+	}
+
 	l := strings.Split(name, clusterNameDelimiter)
 	var uid, resource, lbName string
 	if len(l) >= 2 {
@@ -249,6 +288,12 @@ func (n *Namer) NameBelongsToCluster(name string) bool {
 		return true
 	}
 
+	// Name follows the v2 frontend naming scheme
+	if strings.HasPrefix(name, n.v2Prefix()+"-") {
+		parts := strings.SplitN(name, "-", 4)
+		return len(parts) == 4 && parts[2] == n.shortUID()
+	}
+
 	// Name follows the naming scheme where clusterid is the suffix.
 	if !strings.HasPrefix(name, n.prefix+"-") {
 		return false
@@ -302,11 +347,63 @@ func (n *Namer) IGBackendPort(beName string) (string, error) {
 	return match[1], nil
 }
 
+// PolicyBackend constructs the name of the backend service with the given
+// security policy of the backends of the backend service beName. It is
+// shared by the paths of all the Ingresses with that policy and backends.
+func (n *Namer) PolicyBackend(beName, securityPolicy string) string {
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(beName+"/"+securityPolicy)))
+	return n.decorateName(fmt.Sprintf("%v-%v-%v", n.prefix, policyBackendPrefix, hash[:16]))
+}
+
+// SharedHealthCheck constructs the name for the health check shared by the
+// backend services whose health check settings have the given hash.
+func (n *Namer) SharedHealthCheck(settingsHash string) string {
+	return n.decorateName(fmt.Sprintf("%v-%v-%v", n.prefix, sharedHealthCheckPrefix, settingsHash))
+}
+
+// IsSharedHealthCheck returns true if the given name is the name of a shared
+// health check of this cluster.
+func (n *Namer) IsSharedHealthCheck(name string) bool {
+	return strings.HasPrefix(name, fmt.Sprintf("%v-%v-", n.prefix, sharedHealthCheckPrefix)) && n.NameBelongsToCluster(name)
+}
+
 // InstanceGroup constructs the name for an Instance Group.
 func (n *Namer) InstanceGroup() string {
 	return n.decorateName(n.prefix + "-" + igPrefix)
 }
 
+// InstanceGroupShard constructs the name of an Instance Group of a zone with
+// more nodes than an Instance Group can hold. Shard 0 is InstanceGroup().
+func (n *Namer) InstanceGroupShard(shard int) string {
+	if shard == 0 {
+		return n.InstanceGroup()
+	}
+	return n.decorateName(fmt.Sprintf("%v-%v-%d", n.prefix, igPrefix, shard))
+}
+
+// InstanceGroupShardIndex returns the shard of the given Instance Group name,
+// or false if it is not the name of an Instance Group shard of this cluster.
+func (n *Namer) InstanceGroupShardIndex(name string) (int, bool) {
+	if name == n.InstanceGroup() {
+		return 0, true
+	}
+	shardPrefix := fmt.Sprintf("%v-%v-", n.prefix, igPrefix)
+	if !strings.HasPrefix(name, shardPrefix) {
+		return 0, false
+	}
+	shard, err := strconv.Atoi(strings.Split(strings.TrimPrefix(name, shardPrefix), clusterNameDelimiter)[0])
+	if err != nil || shard <= 0 || n.InstanceGroupShard(shard) != name {
+		return 0, false
+	}
+	return shard, true
+}
+
+// ProxyOnlySubnet constructs the name of the proxy-only subnet created for
+// L7-ILB when none exists in the region of the cluster.
+func (n *Namer) ProxyOnlySubnet() string {
+	return n.decorateName(n.prefix + "-proxy-only")
+}
+
 // firewallRuleSuffix constructs the glbc specific suffix for the FirewallRule.
 func (n *Namer) firewallRuleSuffix() string {
 	firewallName := n.Firewall()
@@ -325,8 +422,12 @@ func (n *Namer) FirewallRule() string {
 }
 
 // LoadBalancer constructs a loadbalancer name from the given key. The key
-// is usually the namespace/name of a Kubernetes Ingress.
+// is usually the namespace/name of a Kubernetes Ingress. v2 loadbalancer
+// names are returned as is.
 func (n *Namer) LoadBalancer(key string) string {
+	if n.isV2LoadBalancer(key) {
+		return key
+	}
 	// TODO: Pipe the clusterName through, for now it saves code churn
 	// to just grab it globally, especially since we haven't decided how
 	// to handle namespace conflicts in the Ubernetes context.
@@ -339,15 +440,62 @@ func (n *Namer) LoadBalancer(key string) string {
 	return truncate(fmt.Sprintf("%v%v%v", scrubbedName, clusterNameDelimiter, clusterName))
 }
 
+// LoadBalancerV2 constructs the v2 loadbalancer name from the given key, the
+// namespace/name of a Kubernetes Ingress. Unlike LoadBalancer, it embeds a
+// hash of the cluster UID and of the key, so that truncated names do not
+// collide. Naming convention:
+//
+//   {prefix}2-{clusterid}-{namespace}-{name}-{hash}
+//
+// The names of the frontend resources insert their resource code after the
+// prefix, and are at most 63 characters.
+func (n *Namer) LoadBalancerV2(key string) string {
+	var namespace, name string
+	if parts := strings.SplitN(key, "/", 2); len(parts) == 2 {
+		namespace, name = parts[0], parts[1]
+	} else {
+		name = key
+	}
+	truncFields := TrimFieldsEvenly(maxFrontendDescriptiveLabel, namespace, name)
+	return fmt.Sprintf("%s-%s-%s-%s-%s", n.v2Prefix(), n.shortUID(), truncFields[0], truncFields[1], negSuffix(n.shortUID(), namespace, name, "", ""))
+}
+
+// isV2LoadBalancer returns true if lbName is a v2 loadbalancer name of this
+// cluster.
+func (n *Namer) isV2LoadBalancer(lbName string) bool {
+	return strings.HasPrefix(lbName, fmt.Sprintf("%s-%s-", n.v2Prefix(), n.shortUID()))
+}
+
+// v2Frontend returns the name of the frontend resource with the given code
+// of a v2 loadbalancer.
+func (n *Namer) v2Frontend(code, lbName string) string {
+	return fmt.Sprintf("%s-%s-%s", n.v2Prefix(), code, strings.TrimPrefix(lbName, n.v2Prefix()+"-"))
+}
+
+func (n *Namer) v2Prefix() string {
+	return n.prefix + schemaVersionV2
+}
+
 // LoadBalancerFromLbName reconstructs the full loadbalancer name, given the
 // lbName portion from NameComponents
 func (n *Namer) LoadBalancerFromLbName(lbName string) string {
+	if n.isV2LoadBalancer(lbName) {
+		return lbName
+	}
 	return truncate(fmt.Sprintf("%v%v%v", lbName, clusterNameDelimiter, n.UID()))
 }
 
 // TargetProxy returns the name for target proxy given the load
 // balancer name and the protocol.
 func (n *Namer) TargetProxy(lbName string, protocol NamerProtocol) string {
+	if n.isV2LoadBalancer(lbName) {
+		switch protocol {
+		case HTTPProtocol:
+			return n.v2Frontend(targetHTTPProxyV2Code, lbName)
+		case HTTPSProtocol:
+			return n.v2Frontend(targetHTTPSProxyV2Code, lbName)
+		}
+	}
 	switch protocol {
 	case HTTPProtocol:
 		return truncate(fmt.Sprintf("%v-%v-%v", n.prefix, targetHTTPProxyPrefix, lbName))
@@ -362,6 +510,9 @@ func (n *Namer) TargetProxy(lbName string, protocol NamerProtocol) string {
 // It checks that the hashed lbName exists and
 func (n *Namer) IsCertUsedForLB(lbName, resourceName string) bool {
 	lbNameHash := n.lbNameToHash(lbName)
+	if n.isV2LoadBalancer(lbName) {
+		return strings.HasPrefix(resourceName, fmt.Sprintf("%s-%s-%s-%s-", n.v2Prefix(), sslCertV2Code, n.shortUID(), lbNameHash))
+	}
 	prefix := fmt.Sprintf("%s-%s-%s", n.prefix, sslCertPrefix, lbNameHash)
 	return strings.HasPrefix(resourceName, prefix) && strings.HasSuffix(resourceName, n.UID())
 }
@@ -374,6 +525,9 @@ func (n *Namer) lbNameToHash(lbName string) string {
 // IsLegacySSLCert returns true if certName is an Ingress managed name following the older naming convention. The check
 // also ensures that the cert is managed by the specific ingress instance - lbName
 func (n *Namer) IsLegacySSLCert(lbName string, resourceName string) bool {
+	if n.isV2LoadBalancer(lbName) {
+		return false
+	}
 	// old style name is of the form k8s-ssl-<lbname> or k8s-ssl-1-<lbName>.
 	legacyPrefixPrimary := truncate(fmt.Sprintf("%s-%s-%s", n.prefix, sslCertPrefix, lbName))
 	legacyPrefixSec := truncate(fmt.Sprintf("%s-%s-1-%s", n.prefix, sslCertPrefix, lbName))
@@ -383,12 +537,24 @@ func (n *Namer) IsLegacySSLCert(lbName string, resourceName string) bool {
 // SSLCertName returns the name of the certificate.
 func (n *Namer) SSLCertName(lbName string, secretHash string) string {
 	lbNameHash := n.lbNameToHash(lbName)
+	if n.isV2LoadBalancer(lbName) {
+		// k8s2-cr-[clusterUID]-[lbNameHash]-[certhash]
+		return fmt.Sprintf("%s-%s-%s-%s-%s", n.v2Prefix(), sslCertV2Code, n.shortUID(), lbNameHash, secretHash)
+	}
 	// k8s-ssl-[lbNameHash]-[certhash]--[clusterUID]
 	return n.decorateName(fmt.Sprintf("%s-%s-%s-%s", n.prefix, sslCertPrefix, lbNameHash, secretHash))
 }
 
 // ForwardingRule returns the name of the forwarding rule prefix.
 func (n *Namer) ForwardingRule(lbName string, protocol NamerProtocol) string {
+	if n.isV2LoadBalancer(lbName) {
+		switch protocol {
+		case HTTPProtocol:
+			return n.v2Frontend(forwardingRuleV2Code, lbName)
+		case HTTPSProtocol:
+			return n.v2Frontend(httpsForwardingRuleV2Code, lbName)
+		}
+	}
 	switch protocol {
 	case HTTPProtocol:
 		return truncate(fmt.Sprintf("%v-%v-%v", n.prefix, forwardingRulePrefix, lbName))
@@ -399,8 +565,42 @@ func (n *Namer) ForwardingRule(lbName string, protocol NamerProtocol) string {
 	return "invalid"
 }
 
+// HTTPSForwardingRuleForPort returns the name of the additional https
+// forwarding rule of the load balancer serving the given port.
+func (n *Namer) HTTPSForwardingRuleForPort(lbName string, port int64) string {
+	lbNameHash := n.lbNameToHash(lbName)
+	if n.isV2LoadBalancer(lbName) {
+		// k8s2-fp-[clusterUID]-[lbNameHash]-[port]
+		return fmt.Sprintf("%s-%s-%s-%s-%d", n.v2Prefix(), httpsPortRuleV2Code, n.shortUID(), lbNameHash, port)
+	}
+	// k8s-fws-[lbNameHash]-[port]--[clusterUID]
+	return n.decorateName(fmt.Sprintf("%s-%s-%s-%d", n.prefix, httpsForwardingRulePrefix, lbNameHash, port))
+}
+
+// HTTPSForwardingRuleForPortPrefix returns the prefix of the names of the
+// additional https forwarding rules of the load balancer.
+func (n *Namer) HTTPSForwardingRuleForPortPrefix(lbName string) string {
+	lbNameHash := n.lbNameToHash(lbName)
+	if n.isV2LoadBalancer(lbName) {
+		return fmt.Sprintf("%s-%s-%s-%s-", n.v2Prefix(), httpsPortRuleV2Code, n.shortUID(), lbNameHash)
+	}
+	return fmt.Sprintf("%s-%s-%s-", n.prefix, httpsForwardingRulePrefix, lbNameHash)
+}
+
+// IsHTTPSForwardingRuleForPort returns true if resourceName is the name of
+// an additional https forwarding rule of the load balancer.
+func (n *Namer) IsHTTPSForwardingRuleForPort(lbName, resourceName string) bool {
+	if !strings.HasPrefix(resourceName, n.HTTPSForwardingRuleForPortPrefix(lbName)) {
+		return false
+	}
+	return n.isV2LoadBalancer(lbName) || strings.HasSuffix(resourceName, n.UID())
+}
+
 // UrlMap returns the name for the UrlMap for a given load balancer.
 func (n *Namer) UrlMap(lbName string) string {
+	if n.isV2LoadBalancer(lbName) {
+		return n.v2Frontend(urlMapV2Code, lbName)
+	}
 	return truncate(fmt.Sprintf("%v-%v-%v", n.prefix, urlMapPrefix, lbName))
 }
 
@@ -459,6 +659,22 @@ func (n *Namer) IsNEG(name string) bool {
 	return strings.HasPrefix(name, n.negPrefix())
 }
 
+// L4Backend returns the name of the NEGs, backend service, health check,
+// firewall rule and forwarding rule of the L4 load balancer of a service.
+// Naming convention:
+//
+//   {prefix}l4-{clusterid}-{namespace}-{name}-{hash}
+//
+// Output name is at most 63 characters.
+func (n *Namer) L4Backend(namespace, name string) string {
+	truncFields := TrimFieldsEvenly(maxNEGDescriptiveLabel, namespace, name)
+	return fmt.Sprintf("%s-%s-%s-%s", n.l4Prefix(), truncFields[0], truncFields[1], negSuffix(n.shortUID(), namespace, name, "", ""))
+}
+
+func (n *Namer) l4Prefix() string {
+	return fmt.Sprintf("%sl4-%s", n.prefix, n.shortUID())
+}
+
 func (n *Namer) negPrefix() string {
 	return fmt.Sprintf("%s%s-%s", n.prefix, schemaVersionV1, n.shortUID())
 }
@@ -19,6 +19,7 @@ package namer
 import (
 	"crypto/sha256"
 	"fmt"
+	"regexp"
 	"strings"
 	"testing"
 )
@@ -267,6 +268,41 @@ func TestNamedPort(t *testing.T) {
 	}
 }
 
+func TestNamerSharedHealthCheck(t *testing.T) {
+	namer := NewNamer("uid1", "fw1")
+	name := namer.SharedHealthCheck("0123456789abcdef")
+	if want := "k8s-hc-0123456789abcdef--uid1"; name != want {
+		t.Errorf("namer.SharedHealthCheck() = %q, want %q", name, want)
+	}
+	if !namer.IsSharedHealthCheck(name) {
+		t.Errorf("namer.IsSharedHealthCheck(%q) = false, want true", name)
+	}
+	for _, name := range []string{namer.IGBackend(80), NewNamer("uid2", "fw1").SharedHealthCheck("0123456789abcdef")} {
+		if namer.IsSharedHealthCheck(name) {
+			t.Errorf("namer.IsSharedHealthCheck(%q) = true, want false", name)
+		}
+	}
+}
+
+func TestNamerPolicyBackend(t *testing.T) {
+	namer := NewNamer("uid1", "fw1")
+	name := namer.PolicyBackend(namer.IGBackend(80), "policy-1")
+	if !strings.HasPrefix(name, "k8s-bp-") || !strings.HasSuffix(name, "--uid1") || len(name) > 63 {
+		t.Errorf("namer.PolicyBackend() = %q, want k8s-bp-[hash]--uid1", name)
+	}
+	if !namer.NameBelongsToCluster(name) {
+		t.Errorf("namer.NameBelongsToCluster(%q) = false, want true", name)
+	}
+	for _, other := range []string{
+		namer.PolicyBackend(namer.IGBackend(81), "policy-1"),
+		namer.PolicyBackend(namer.IGBackend(80), "policy-2"),
+	} {
+		if other == name {
+			t.Errorf("namer.PolicyBackend() = %q for different backends or policies", name)
+		}
+	}
+}
+
 func TestNamerInstanceGroup(t *testing.T) {
 	newNamer := NewNamer("uid1", "fw1")
 	name := newNamer.InstanceGroup()
@@ -281,6 +317,34 @@ func TestNamerInstanceGroup(t *testing.T) {
 	}
 }
 
+func TestNamerInstanceGroupShard(t *testing.T) {
+	namer := NewNamer("uid1", "fw1")
+	for _, tc := range []struct {
+		shard int
+		want  string
+	}{
+		{0, "k8s-ig--uid1"},
+		{1, "k8s-ig-1--uid1"},
+		{12, "k8s-ig-12--uid1"},
+	} {
+		name := namer.InstanceGroupShard(tc.shard)
+		if name != tc.want {
+			t.Errorf("namer.InstanceGroupShard(%d) = %q, want %q", tc.shard, name, tc.want)
+		}
+		if !namer.NameBelongsToCluster(name) {
+			t.Errorf("namer.NameBelongsToCluster(%q) = false, want true", name)
+		}
+		if shard, ok := namer.InstanceGroupShardIndex(name); !ok || shard != tc.shard {
+			t.Errorf("namer.InstanceGroupShardIndex(%q) = %d, %t, want %d, true", name, shard, ok, tc.shard)
+		}
+	}
+	for _, name := range []string{"k8s-ig-0--uid1", "k8s-ig-1--uid2", "k8s-ig-a--uid1", "k8s-be-1--uid1"} {
+		if shard, ok := namer.InstanceGroupShardIndex(name); ok {
+			t.Errorf("namer.InstanceGroupShardIndex(%q) = %d, true, want false", name, shard)
+		}
+	}
+}
+
 func TestNamerFirewallRule(t *testing.T) {
 	newNamer := NewNamer("uid1", "fw1")
 	name := newNamer.FirewallRule()
@@ -360,6 +424,55 @@ func TestNamerLoadBalancer(t *testing.T) {
 	}
 }
 
+func TestNamerLoadBalancerV2(t *testing.T) {
+	newNamer := NewNamer("uid1", "fw1")
+	lbName := newNamer.LoadBalancerV2("namespace/name")
+	hash := negSuffix("uid1", "namespace", "name", "", "")
+	if want := "k8s2-uid1-namespace-name-" + hash; lbName != want {
+		t.Fatalf("newNamer.LoadBalancerV2(%q) = %q, want %q", "namespace/name", lbName, want)
+	}
+	if got := newNamer.LoadBalancer(lbName); got != lbName {
+		t.Errorf("newNamer.LoadBalancer(%q) = %q, want %q", lbName, got, lbName)
+	}
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{newNamer.TargetProxy(lbName, HTTPProtocol), "k8s2-tp-uid1-namespace-name-" + hash},
+		{newNamer.TargetProxy(lbName, HTTPSProtocol), "k8s2-ts-uid1-namespace-name-" + hash},
+		{newNamer.ForwardingRule(lbName, HTTPProtocol), "k8s2-fr-uid1-namespace-name-" + hash},
+		{newNamer.ForwardingRule(lbName, HTTPSProtocol), "k8s2-fs-uid1-namespace-name-" + hash},
+		{newNamer.UrlMap(lbName), "k8s2-um-uid1-namespace-name-" + hash},
+	} {
+		if tc.name != tc.want {
+			t.Errorf("name = %q, want %q", tc.name, tc.want)
+		}
+		if !newNamer.NameBelongsToCluster(tc.name) {
+			t.Errorf("newNamer.NameBelongsToCluster(%q) = false, want true", tc.name)
+		}
+	}
+	nc := newNamer.ParseName(newNamer.UrlMap(lbName))
+	if got := newNamer.LoadBalancerFromLbName(nc.LbName); got != lbName {
+		t.Errorf("newNamer.LoadBalancerFromLbName(%q) = %q, want %q", nc.LbName, got, lbName)
+	}
+	if NewNamer("uid2", "fw1").NameBelongsToCluster(newNamer.UrlMap(lbName)) {
+		t.Errorf("NameBelongsToCluster(%q) = true for another cluster, want false", newNamer.UrlMap(lbName))
+	}
+
+	// Long keys which only differ past the truncated length must not collide.
+	long := strings.Repeat("a", 60)
+	lb1 := newNamer.LoadBalancerV2(long + "/" + long + "1")
+	lb2 := newNamer.LoadBalancerV2(long + "/" + long + "2")
+	if lb1 == lb2 {
+		t.Errorf("LoadBalancerV2() = %q for different keys, want different names", lb1)
+	}
+	for _, name := range []string{newNamer.TargetProxy(lb1, HTTPSProtocol), newNamer.UrlMap(lb1)} {
+		if len(name) > 63 {
+			t.Errorf("len(%q) = %d, want <= 63", name, len(name))
+		}
+	}
+}
+
 // Ensure that a valid cert name is created if clusterName is empty.
 func TestNamerSSLCertName(t *testing.T) {
 	secretHash := fmt.Sprintf("%x", sha256.Sum256([]byte("test123")))[:16]
@@ -407,6 +520,38 @@ func TestNamerIsCertUsedForLB(t *testing.T) {
 	}
 }
 
+func TestNamerHTTPSForwardingRuleForPort(t *testing.T) {
+	for _, tc := range []struct {
+		desc   string
+		lbName func(n *Namer) string
+		want   string
+	}{
+		{desc: "v1", lbName: func(n *Namer) string { return n.LoadBalancer("namespace/name") }, want: "k8s-fws-[a-f0-9]{16}-8443--uid1"},
+		{desc: "v2", lbName: func(n *Namer) string { return n.LoadBalancerV2("namespace/name") }, want: "k8s2-fp-uid1-[a-f0-9]{16}-8443"},
+	} {
+		newNamer := NewNamer("uid1", "fw1")
+		lbName := tc.lbName(newNamer)
+		name := newNamer.HTTPSForwardingRuleForPort(lbName, 8443)
+		if !regexp.MustCompile("^" + tc.want + "$").MatchString(name) {
+			t.Errorf("%s: HTTPSForwardingRuleForPort(%q, 8443) = %q, want %q", tc.desc, lbName, name, tc.want)
+		}
+		if !newNamer.IsHTTPSForwardingRuleForPort(lbName, name) {
+			t.Errorf("%s: IsHTTPSForwardingRuleForPort(%q, %q) = false, want true", tc.desc, lbName, name)
+		}
+		if prefix := newNamer.HTTPSForwardingRuleForPortPrefix(lbName); !strings.HasPrefix(name, prefix) {
+			t.Errorf("%s: HTTPSForwardingRuleForPortPrefix(%q) = %q, want a prefix of %q", tc.desc, lbName, prefix, name)
+		}
+		if !newNamer.NameBelongsToCluster(name) {
+			t.Errorf("%s: NameBelongsToCluster(%q) = false, want true", tc.desc, name)
+		}
+		for _, other := range []string{newNamer.ForwardingRule(lbName, HTTPSProtocol), newNamer.HTTPSForwardingRuleForPort(tc.lbName(NewNamer("uid1", "fw1"))+"x", 8443)} {
+			if newNamer.IsHTTPSForwardingRuleForPort(lbName, other) {
+				t.Errorf("%s: IsHTTPSForwardingRuleForPort(%q, %q) = true, want false", tc.desc, lbName, other)
+			}
+		}
+	}
+}
+
 func TestNamerNEG(t *testing.T) {
 	longstring := "01234567890123456789012345678901234567890123456789"
 	testCases := []struct {
@@ -474,6 +619,45 @@ func TestNamerNEG(t *testing.T) {
 	}
 }
 
+func TestNamerL4Backend(t *testing.T) {
+	longstring := "01234567890123456789012345678901234567890123456789"
+	testCases := []struct {
+		desc      string
+		namespace string
+		name      string
+		expect    string
+	}{
+		{
+			desc:      "simple case",
+			namespace: "namespace",
+			name:      "name",
+			expect:    "k8sl4-01234567-namespace-name-51aaa9b0",
+		},
+		{
+			desc:      "long name and namespace",
+			namespace: longstring,
+			name:      longstring,
+			expect:    "k8sl4-01234567-0123456789012345678-0123456789012345678-68893c91",
+		},
+	}
+
+	newNamer := NewNamer(clusterId, "")
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			res := newNamer.L4Backend(tc.namespace, tc.name)
+			if len(res) > 63 {
+				t.Errorf("got len(res) == %v, want <= 63", len(res))
+			}
+			if res != tc.expect {
+				t.Errorf("got %q, want %q", res, tc.expect)
+			}
+			if newNamer.IsNEG(res) {
+				t.Errorf("IsNEG(%q) = true, want false", res)
+			}
+		})
+	}
+}
+
 func TestIsNEG(t *testing.T) {
 	for _, tc := range []struct {
 		prefix string
@@ -499,3 +683,53 @@ func TestIsNEG(t *testing.T) {
 		}
 	}
 }
+
+// customNamer is an IngressNamer which names instance groups differently.
+type customNamer struct {
+	*Namer
+}
+
+func (n *customNamer) InstanceGroup() string {
+	return "custom-ig--" + n.UID()
+}
+
+func TestRegisterNamer(t *testing.T) {
+	factory := func(clusterName, firewallName string) (IngressNamer, error) {
+		return &customNamer{NewNamer(clusterName, firewallName)}, nil
+	}
+	if err := RegisterNamer("custom", factory); err != nil {
+		t.Fatalf("RegisterNamer(%q) = %v", "custom", err)
+	}
+	if err := RegisterNamer("custom", factory); err == nil {
+		t.Errorf("RegisterNamer(%q) = nil, want error for a duplicate name", "custom")
+	}
+	if err := RegisterNamer("", factory); err == nil {
+		t.Errorf("RegisterNamer(%q) = nil, want error for an empty name", "")
+	}
+
+	for _, tc := range []struct {
+		name    string
+		wantIG  string
+		wantErr bool
+	}{
+		{name: "", wantIG: "k8s-ig--uid1"},
+		{name: DefaultNamer, wantIG: "k8s-ig--uid1"},
+		{name: "custom", wantIG: "custom-ig--uid1"},
+		{name: "unknown", wantErr: true},
+	} {
+		namer, err := NewRegisteredNamer(tc.name, "uid1", "fw1")
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			t.Errorf("NewRegisteredNamer(%q) = %v, want err %v", tc.name, err, tc.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := namer.InstanceGroup(); got != tc.wantIG {
+			t.Errorf("NewRegisteredNamer(%q).InstanceGroup() = %q, want %q", tc.name, got, tc.wantIG)
+		}
+		if got, want := namer.UrlMap("lb"), NewNamer("uid1", "fw1").UrlMap("lb"); got != want {
+			t.Errorf("NewRegisteredNamer(%q).UrlMap(%q) = %q, want %q", tc.name, "lb", got, want)
+		}
+	}
+}
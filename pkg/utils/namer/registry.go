@@ -0,0 +1,85 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namer
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"k8s.io/klog"
+)
+
+// DefaultNamer is the name of the IngressNamer implemented by Namer.
+const DefaultNamer = "default"
+
+// NamerFactory creates the IngressNamer of a cluster with the given UID and
+// firewall name.
+type NamerFactory func(clusterName, firewallName string) (IngressNamer, error)
+
+var (
+	namersLock sync.RWMutex
+	namers     = map[string]NamerFactory{
+		DefaultNamer: func(clusterName, firewallName string) (IngressNamer, error) {
+			return NewNamer(clusterName, firewallName), nil
+		},
+	}
+)
+
+// RegisterNamer registers a NamerFactory under the given name. It is meant to
+// be called from init functions of packages providing alternative naming
+// policies.
+func RegisterNamer(name string, factory NamerFactory) error {
+	if name == "" || factory == nil {
+		return fmt.Errorf("namer name and factory must be set")
+	}
+	namersLock.Lock()
+	defer namersLock.Unlock()
+	if _, ok := namers[name]; ok {
+		return fmt.Errorf("namer %q is already registered", name)
+	}
+	namers[name] = factory
+	klog.V(2).Infof("Registered namer %q", name)
+	return nil
+}
+
+// RegisteredNamers returns the sorted names of all registered IngressNamers.
+func RegisteredNamers() []string {
+	namersLock.RLock()
+	defer namersLock.RUnlock()
+	var names []string
+	for name := range namers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewRegisteredNamer creates the IngressNamer registered under the given
+// name. An empty name selects DefaultNamer.
+func NewRegisteredNamer(name, clusterName, firewallName string) (IngressNamer, error) {
+	if name == "" {
+		name = DefaultNamer
+	}
+	namersLock.RLock()
+	factory, ok := namers[name]
+	namersLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("namer %q is not registered", name)
+	}
+	return factory(clusterName, firewallName)
+}
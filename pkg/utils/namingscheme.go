@@ -0,0 +1,67 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+
+	"k8s.io/api/networking/v1beta1"
+	client "k8s.io/client-go/kubernetes/typed/networking/v1beta1"
+	"k8s.io/ingress-gce/pkg/annotations"
+	"k8s.io/ingress-gce/pkg/flags"
+	"k8s.io/klog"
+)
+
+// NamingScheme returns the naming scheme of the frontend resources of the
+// Ingress. Ingresses keep the scheme recorded on them, except v1 Ingresses
+// without IP which are migrated to v2 if --enable-v2-frontend-namer is set:
+// they do not serve traffic, so renaming their resources is not disruptive.
+// Ingresses without recorded scheme and with an IP predate the v2 scheme.
+func NamingScheme(ing *v1beta1.Ingress) string {
+	if annotations.FromIngress(ing).NamingScheme() == annotations.NamingSchemeV2 {
+		return annotations.NamingSchemeV2
+	}
+	if flags.F.EnableV2FrontendNamer && len(ing.Status.LoadBalancer.Ingress) == 0 {
+		return annotations.NamingSchemeV2
+	}
+	return annotations.NamingSchemeV1
+}
+
+// EnsureNamingScheme records the v2 naming scheme on the Ingresses using it,
+// so that it is kept once the Ingress has an IP, and refreshes ing with the
+// updated Ingress. The v1 scheme is not recorded, as it is the scheme of the
+// Ingresses without annotation once they have an IP, so that existing
+// Ingresses are not updated. If the scheme is already recorded, it does
+// nothing.
+func EnsureNamingScheme(ing *v1beta1.Ingress, ingClient client.IngressInterface) error {
+	scheme := NamingScheme(ing)
+	if scheme != annotations.NamingSchemeV2 || annotations.FromIngress(ing).NamingScheme() == scheme {
+		return nil
+	}
+	updated := ing.DeepCopy()
+	if updated.Annotations == nil {
+		updated.Annotations = map[string]string{}
+	}
+	updated.Annotations[annotations.NamingSchemeKey] = scheme
+	res, err := ingClient.Update(updated)
+	if err != nil {
+		return fmt.Errorf("error updating Ingress %s/%s: %v", ing.Namespace, ing.Name, err)
+	}
+	res.DeepCopyInto(ing)
+	klog.V(3).Infof("Recorded naming scheme %q for Ingress %s/%s", scheme, ing.Namespace, ing.Name)
+	return nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	api_v1 "k8s.io/api/core/v1"
+	"k8s.io/api/networking/v1beta1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/ingress-gce/pkg/annotations"
+	"k8s.io/ingress-gce/pkg/flags"
+)
+
+func TestNamingScheme(t *testing.T) {
+	defer func(enabled bool) { flags.F.EnableV2FrontendNamer = enabled }(flags.F.EnableV2FrontendNamer)
+
+	for _, tc := range []struct {
+		desc    string
+		enabled bool
+		scheme  string
+		hasIP   bool
+		want    string
+	}{
+		{desc: "disabled, new Ingress", want: annotations.NamingSchemeV1},
+		{desc: "disabled, v2 Ingress", scheme: annotations.NamingSchemeV2, hasIP: true, want: annotations.NamingSchemeV2},
+		{desc: "enabled, new Ingress", enabled: true, want: annotations.NamingSchemeV2},
+		{desc: "enabled, Ingress predating the scheme", enabled: true, hasIP: true, want: annotations.NamingSchemeV1},
+		{desc: "enabled, v1 Ingress with IP", enabled: true, scheme: annotations.NamingSchemeV1, hasIP: true, want: annotations.NamingSchemeV1},
+		{desc: "enabled, v1 Ingress without IP is migrated", enabled: true, scheme: annotations.NamingSchemeV1, want: annotations.NamingSchemeV2},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			flags.F.EnableV2FrontendNamer = tc.enabled
+			ing := &v1beta1.Ingress{ObjectMeta: v1.ObjectMeta{Name: "ing", Namespace: "default"}}
+			if tc.scheme != "" {
+				ing.Annotations = map[string]string{annotations.NamingSchemeKey: tc.scheme}
+			}
+			if tc.hasIP {
+				ing.Status.LoadBalancer.Ingress = []api_v1.LoadBalancerIngress{{IP: "1.2.3.4"}}
+			}
+			if got := NamingScheme(ing); got != tc.want {
+				t.Errorf("NamingScheme() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEnsureNamingScheme(t *testing.T) {
+	defer func(enabled bool) { flags.F.EnableV2FrontendNamer = enabled }(flags.F.EnableV2FrontendNamer)
+
+	// The v1 scheme is not recorded, the Ingress is not updated.
+	flags.F.EnableV2FrontendNamer = false
+	ing := &v1beta1.Ingress{ObjectMeta: v1.ObjectMeta{Name: "ing", Namespace: "default"}}
+	kubeClient := fake.NewSimpleClientset(ing)
+	ingClient := kubeClient.NetworkingV1beta1().Ingresses(ing.Namespace)
+	if err := EnsureNamingScheme(ing, ingClient); err != nil {
+		t.Fatalf("EnsureNamingScheme() = %v, want nil", err)
+	}
+	if actions := kubeClient.Actions(); len(actions) != 0 {
+		t.Errorf("EnsureNamingScheme() made requests %v, want none for a v1 Ingress", actions)
+	}
+
+	flags.F.EnableV2FrontendNamer = true
+	if err := EnsureNamingScheme(ing, ingClient); err != nil {
+		t.Fatalf("EnsureNamingScheme() = %v, want nil", err)
+	}
+	updated, err := ingClient.Get(ing.Name, v1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Get() = %v, want nil", err)
+	}
+	if got := updated.Annotations[annotations.NamingSchemeKey]; got != annotations.NamingSchemeV2 {
+		t.Errorf("naming scheme = %q, want %q", got, annotations.NamingSchemeV2)
+	}
+
+	// The scheme is kept once the Ingress has an IP, even if the flag is
+	// disabled.
+	flags.F.EnableV2FrontendNamer = false
+	ing.Status.LoadBalancer.Ingress = []api_v1.LoadBalancerIngress{{IP: "1.2.3.4"}}
+	if got := NamingScheme(ing); got != annotations.NamingSchemeV2 {
+		t.Errorf("NamingScheme() = %q, want %q", got, annotations.NamingSchemeV2)
+	}
+}
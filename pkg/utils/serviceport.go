@@ -50,6 +50,17 @@ type ServicePort struct {
 	NEGEnabled    bool
 	L7ILBEnabled  bool
 	BackendConfig *backendconfigv1beta1.BackendConfig
+	// SecurityPolicy is the security policy set for the paths of an Ingress
+	// using this ServicePort, which overrides the one of the BackendConfig.
+	// It gives the ServicePort a backend service of its own.
+	SecurityPolicy string
+	// ExternalBackendService is the name of an existing backend service,
+	// not managed by the controller, which serves this ServicePort instead
+	// of the Service of its ID.
+	ExternalBackendService string
+	// HealthCheckPort is the port health checked on the endpoints of a NEG
+	// backend instead of their serving port, 0 if not overridden.
+	HealthCheckPort int64
 }
 
 // GetDescription returns a Description for this ServicePort.
@@ -60,13 +71,32 @@ func (sp ServicePort) GetDescription() Description {
 	}
 }
 
+// BackendProtocol returns the protocol of the backend service and health
+// check for this ServicePort. gRPC is carried over HTTP/2.
+// TODO: use GRPC health checks for gRPC backends once the vendored compute API
+// has the GRPCHealthCheck type.
+func (sp ServicePort) BackendProtocol() annotations.AppProtocol {
+	if sp.Protocol == annotations.ProtocolGRPC {
+		return annotations.ProtocolHTTP2
+	}
+	return sp.Protocol
+}
+
 // BackendName returns the name of the backend which would be used for this ServicePort.
-func (sp ServicePort) BackendName(namer *namer.Namer) string {
+func (sp ServicePort) BackendName(namer namer.IngressNamer) string {
+	if sp.ExternalBackendService != "" {
+		return sp.ExternalBackendService
+	}
+	var name string
 	if !sp.NEGEnabled {
-		return namer.IGBackend(sp.NodePort)
+		name = namer.IGBackend(sp.NodePort)
+	} else {
+		name = namer.NEG(sp.ID.Service.Namespace, sp.ID.Service.Name, sp.Port)
 	}
-
-	return namer.NEG(sp.ID.Service.Namespace, sp.ID.Service.Name, sp.Port)
+	if sp.SecurityPolicy != "" {
+		return namer.PolicyBackend(name, sp.SecurityPolicy)
+	}
+	return name
 }
 
 // BackendToServicePortID creates a ServicePortID from a given IngressBackend and namespace.
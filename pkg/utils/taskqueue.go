@@ -17,6 +17,10 @@ limitations under the License.
 package utils
 
 import (
+	"hash/fnv"
+	"sync"
+	"time"
+
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog"
@@ -30,7 +34,11 @@ var (
 type TaskQueue interface {
 	Run()
 	Enqueue(objs ...interface{})
+	EnqueueSpread(period time.Duration, objs ...interface{})
 	Shutdown()
+	// Syncing returns the key being synced and the start time of its sync,
+	// or an empty key if no key is being synced.
+	Syncing() (string, time.Time)
 }
 
 // PeriodicTaskQueue invokes the given sync function for every work item
@@ -47,6 +55,11 @@ type PeriodicTaskQueue struct {
 	sync func(string) error
 	// workerDone is closed when the worker exits.
 	workerDone chan struct{}
+
+	lock sync.Mutex
+	// syncingKey is the key being synced since syncStart.
+	syncingKey string
+	syncStart  time.Time
 }
 
 // Run the task queue. This will block until the Shutdown() has been called.
@@ -58,7 +71,10 @@ func (t *PeriodicTaskQueue) Run() {
 			return
 		}
 		klog.V(4).Infof("Syncing %v (%v)", key, t.resource)
-		if err := t.sync(key.(string)); err != nil {
+		t.setSyncing(key.(string))
+		err := t.sync(key.(string))
+		t.setSyncing("")
+		if err != nil {
 			klog.Errorf("Requeuing %q due to error: %v (%v)", key, err, t.resource)
 			t.queue.AddRateLimited(key)
 		} else {
@@ -69,6 +85,20 @@ func (t *PeriodicTaskQueue) Run() {
 	}
 }
 
+func (t *PeriodicTaskQueue) setSyncing(key string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.syncingKey = key
+	t.syncStart = time.Now()
+}
+
+// Syncing implements TaskQueue.
+func (t *PeriodicTaskQueue) Syncing() (string, time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.syncingKey, t.syncStart
+}
+
 // Enqueue one or more keys to the work queue.
 func (t *PeriodicTaskQueue) Enqueue(objs ...interface{}) {
 	for _, obj := range objs {
@@ -82,6 +112,34 @@ func (t *PeriodicTaskQueue) Enqueue(objs ...interface{}) {
 	}
 }
 
+// EnqueueSpread enqueues one or more keys to the work queue, each after a
+// delay within period derived from a hash of the key. This spreads the
+// periodic resync of all objects evenly across the resync period, instead of
+// syncing them all at once, while each object keeps a stable offset.
+func (t *PeriodicTaskQueue) EnqueueSpread(period time.Duration, objs ...interface{}) {
+	if period <= 0 {
+		t.Enqueue(objs...)
+		return
+	}
+	for _, obj := range objs {
+		key, err := t.keyFunc(obj)
+		if err != nil {
+			klog.Errorf("Couldn't get key for object %+v (type %T): %v", obj, obj, err)
+			return
+		}
+		delay := spreadOffset(key, period)
+		klog.V(4).Infof("Enqueue key=%q after %v (%v)", key, delay, t.resource)
+		t.queue.AddAfter(key, delay)
+	}
+}
+
+// spreadOffset returns the offset of key within period.
+func spreadOffset(key string, period time.Duration) time.Duration {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return time.Duration(h.Sum64() % uint64(period))
+}
+
 // Shutdown shuts down the work queue and waits for the worker to ACK
 func (t *PeriodicTaskQueue) Shutdown() {
 	klog.V(2).Infof("Shutdown")
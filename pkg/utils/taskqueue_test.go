@@ -18,8 +18,10 @@ package utils
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"k8s.io/client-go/tools/cache"
 )
@@ -67,3 +69,71 @@ func TestPeriodicTaskQueue(t *testing.T) {
 		t.Errorf("task queue synced %+v, want %+v", synced, expected)
 	}
 }
+
+func TestSyncing(t *testing.T) {
+	t.Parallel()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	tq := NewPeriodicTaskQueue("", "test", func(key string) error {
+		close(started)
+		<-release
+		return nil
+	})
+	if key, _ := tq.Syncing(); key != "" {
+		t.Errorf("Syncing() = %q before the sync, want empty", key)
+	}
+	go tq.Run()
+	before := time.Now()
+	tq.Enqueue(cache.ExplicitKey("a"))
+	<-started
+	if key, start := tq.Syncing(); key != "a" || start.Before(before) {
+		t.Errorf("Syncing() = %q, %v during the sync, want %q, after %v", key, start, "a", before)
+	}
+	close(release)
+	tq.Shutdown()
+	if key, _ := tq.Syncing(); key != "" {
+		t.Errorf("Syncing() = %q after the sync, want empty", key)
+	}
+}
+
+func TestEnqueueSpread(t *testing.T) {
+	t.Parallel()
+	synced := make(chan string, 1)
+	tq := NewPeriodicTaskQueue("", "test", func(key string) error {
+		synced <- key
+		return nil
+	})
+	go tq.Run()
+	defer tq.Shutdown()
+
+	tq.EnqueueSpread(100*time.Millisecond, cache.ExplicitKey("a"))
+	select {
+	case key := <-synced:
+		if key != "a" {
+			t.Errorf("synced %q, want %q", key, "a")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("key was not synced")
+	}
+}
+
+func TestSpreadOffset(t *testing.T) {
+	t.Parallel()
+	period := 30 * time.Second
+	buckets := map[time.Duration]bool{}
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("ns/ing-%d", i)
+		offset := spreadOffset(key, period)
+		if offset < 0 || offset >= period {
+			t.Fatalf("spreadOffset(%q, %v) = %v, want within the period", key, period, offset)
+		}
+		if again := spreadOffset(key, period); again != offset {
+			t.Errorf("spreadOffset(%q, %v) = %v, then %v, want a stable offset", key, period, offset, again)
+		}
+		buckets[offset/time.Second] = true
+	}
+	// 1000 keys should fall into each of the 30 one second buckets.
+	if len(buckets) != 30 {
+		t.Errorf("offsets fall into %d of 30 buckets, want an even spread", len(buckets))
+	}
+}
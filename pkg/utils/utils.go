@@ -30,6 +30,7 @@ import (
 	api_v1 "k8s.io/api/core/v1"
 	"k8s.io/api/networking/v1beta1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/ingress-gce/pkg/annotations"
@@ -66,6 +67,10 @@ const (
 	// This label is feature-gated in kubernetes/kubernetes but we do not have feature gates
 	// This will need to be updated after the end of the alpha
 	LabelNodeRoleExcludeBalancer = "alpha.service-controller.kubernetes.io/exclude-balancer"
+	// LabelNodeExcludeFromExternalLoadBalancers specifies that a node should be
+	// excluded from external load balancers. It is the GA successor of
+	// LabelNodeRoleExcludeBalancer.
+	LabelNodeExcludeFromExternalLoadBalancers = "node.kubernetes.io/exclude-from-external-load-balancers"
 	// ToBeDeletedTaint is the taint that the autoscaler adds when a node is scheduled to be deleted
 	// https://github.com/kubernetes/autoscaler/blob/cluster-autoscaler-0.5.2/cluster-autoscaler/utils/deletetaint/delete.go#L33
 	ToBeDeletedTaint = "ToBeDeletedByClusterAutoscaler"
@@ -227,16 +232,26 @@ func IGLinks(igs []*compute.InstanceGroup) (igLinks []string) {
 }
 
 // IsGCEIngress returns true if the Ingress matches the class managed by this
-// controller.
-func IsGCEIngress(ing *v1beta1.Ingress) bool {
+// controller. classes resolves the IngressClasses, nil if they are not
+// enabled. Ingresses without class belong to the controller, unless the
+// default IngressClass of the cluster belongs to another controller.
+func IsGCEIngress(ing *v1beta1.Ingress, classes IngressClassLookup) bool {
 	class := annotations.FromIngress(ing).IngressClass()
 	if flags.F.IngressClass != "" && class == flags.F.IngressClass {
 		return true
 	}
 
+	if scope, ok := flags.F.IngressClassScopes.Scope(class); ok {
+		return scope == flags.ScopeGlobal || flags.F.EnableL7Ilb
+	}
+
+	if params, ok := IngressClassParamsFor(ing, classes); ok {
+		return params.Scope != flags.ScopeRegional || flags.F.EnableL7Ilb
+	}
+
 	switch class {
 	case "":
-		return true
+		return !defaultClassOfOtherController(ing, classes)
 	case annotations.GceIngressClass:
 		return true
 	case annotations.GceL7ILBIngressClass:
@@ -255,23 +270,41 @@ func IsGCEMultiClusterIngress(ing *v1beta1.Ingress) bool {
 }
 
 // IsGCEL7ILBIngress returns true if the given Ingress has
-// ingress.class annotation set to "gce-l7-ilb"
-func IsGCEL7ILBIngress(ing *v1beta1.Ingress) bool {
+// ingress.class annotation set to "gce-l7-ilb", or to a class
+// configured with regional scope.
+func IsGCEL7ILBIngress(ing *v1beta1.Ingress, classes IngressClassLookup) bool {
 	class := annotations.FromIngress(ing).IngressClass()
+	if scope, ok := flags.F.IngressClassScopes.Scope(class); ok {
+		return scope == flags.ScopeRegional
+	}
+	if params, ok := IngressClassParamsFor(ing, classes); ok {
+		return params.Scope == flags.ScopeRegional
+	}
 	return class == annotations.GceL7ILBIngressClass
 }
 
 // IsGLBCIngress returns true if the given Ingress should be processed by GLBC
-func IsGLBCIngress(ing *v1beta1.Ingress) bool {
-	return IsGCEIngress(ing) || IsGCEMultiClusterIngress(ing)
+func IsGLBCIngress(ing *v1beta1.Ingress, classes IngressClassLookup) bool {
+	return IsGCEIngress(ing, classes) || IsGCEMultiClusterIngress(ing)
 }
 
 // GetReadyNodeNames returns names of schedulable, ready nodes from the node lister
 // It also filters out masters and nodes excluded from load-balancing
 // TODO(rramkumar): Add a test for this.
 func GetReadyNodeNames(lister listers.NodeLister) ([]string, error) {
+	return listNodeNames(lister, GetNodeConditionPredicate())
+}
+
+// GetInstanceGroupNodeNames returns the names of the nodes to add to the
+// instance groups, i.e. the nodes of GetReadyNodeNames as configured by the
+// node filter flags.
+func GetInstanceGroupNodeNames(lister listers.NodeLister) ([]string, error) {
+	return listNodeNames(lister, GetNodeConditionPredicateWithOptions(InstanceGroupNodeFilterOptions()))
+}
+
+func listNodeNames(lister listers.NodeLister, predicate listers.NodeConditionPredicate) ([]string, error) {
 	var nodeNames []string
-	nodes, err := lister.ListWithPredicate(GetNodeConditionPredicate())
+	nodes, err := lister.ListWithPredicate(predicate)
 	if err != nil {
 		return nodeNames, err
 	}
@@ -292,19 +325,55 @@ func NodeIsReady(node *api_v1.Node) bool {
 	return false
 }
 
+// NodeFilterOptions adjust the nodes accepted by
+// GetNodeConditionPredicateWithOptions.
+type NodeFilterOptions struct {
+	// IncludeUnschedulable accepts cordoned nodes.
+	IncludeUnschedulable bool
+	// IncludeNotReady accepts the nodes whose Ready condition is not true.
+	IncludeNotReady bool
+	// ExcludeTaints are the keys of the taints rejecting nodes, in addition
+	// to ToBeDeletedTaint.
+	ExcludeTaints []string
+	// ExcludeExternalLoadBalancers rejects the nodes labeled with
+	// LabelNodeExcludeFromExternalLoadBalancers.
+	ExcludeExternalLoadBalancers bool
+}
+
+// InstanceGroupNodeFilterOptions returns the NodeFilterOptions of the nodes
+// added to instance groups, set by the --node-filter flags.
+func InstanceGroupNodeFilterOptions() NodeFilterOptions {
+	reloadable := flags.Reloadable()
+	return NodeFilterOptions{
+		IncludeUnschedulable:         reloadable.NodeIncludeUnschedulable,
+		IncludeNotReady:              reloadable.NodeIncludeNotReady,
+		ExcludeTaints:                flags.F.NodeExcludeTaints,
+		ExcludeExternalLoadBalancers: true,
+	}
+}
+
 // This is a duplicate definition of the function in:
 // kubernetes/kubernetes/pkg/controller/service/service_controller.go
 func GetNodeConditionPredicate() listers.NodeConditionPredicate {
+	return GetNodeConditionPredicateWithOptions(NodeFilterOptions{})
+}
+
+// GetNodeConditionPredicateWithOptions returns the predicate of
+// GetNodeConditionPredicate adjusted by opts.
+func GetNodeConditionPredicateWithOptions(opts NodeFilterOptions) listers.NodeConditionPredicate {
+	excludeTaints := sets.NewString(opts.ExcludeTaints...)
+	excludeTaints.Insert(ToBeDeletedTaint)
 	return func(node *api_v1.Node) bool {
 		// We add the master to the node list, but its unschedulable.  So we use this to filter
 		// the master.
-		if node.Spec.Unschedulable {
+		if node.Spec.Unschedulable && !opts.IncludeUnschedulable {
 			return false
 		}
 
 		// Get all nodes that have a taint with NoSchedule effect
 		for _, taint := range node.Spec.Taints {
-			if taint.Key == ToBeDeletedTaint {
+			if excludeTaints.Has(taint.Key) {
+				klog.V(4).Infof("Ignoring node %v with taint %v", node.Name, taint.Key)
 				return false
 			}
 		}
@@ -319,6 +388,10 @@ func GetNodeConditionPredicate() listers.NodeConditionPredicate {
 			return false
 		}
 
+		if _, hasExcludeLabel := node.Labels[LabelNodeExcludeFromExternalLoadBalancers]; hasExcludeLabel && opts.ExcludeExternalLoadBalancers {
+			return false
+		}
+
 		// If we have no info, don't accept
 		if len(node.Status.Conditions) == 0 {
 			return false
@@ -326,7 +399,7 @@ func GetNodeConditionPredicate() listers.NodeConditionPredicate {
 		for _, cond := range node.Status.Conditions {
 			// We consider the node for load balancing only when its NodeReady condition status
 			// is ConditionTrue
-			if cond.Type == api_v1.NodeReady && cond.Status != api_v1.ConditionTrue {
+			if cond.Type == api_v1.NodeReady && cond.Status != api_v1.ConditionTrue && !opts.IncludeNotReady {
 				klog.V(4).Infof("Ignoring node %v with %v condition status %v", node.Name, cond.Type, cond.Status)
 				return false
 			}
@@ -373,6 +446,22 @@ func TraverseIngressBackends(ing *v1beta1.Ingress, process func(id ServicePortID
 			}
 		}
 	}
+
+	// Check the weighted backends and routes of the route actions. A
+	// malformed annotation is surfaced when the Ingress is translated.
+	actions, _ := annotations.FromIngress(ing).RouteActions()
+	for _, action := range actions {
+		for _, b := range action.WeightedBackends {
+			if process(ServicePortID{Service: types.NamespacedName{Namespace: ing.Namespace, Name: b.ServiceName}, Port: b.ServicePort}) {
+				return
+			}
+		}
+		for _, r := range action.Routes {
+			if process(ServicePortID{Service: types.NamespacedName{Namespace: ing.Namespace, Name: r.ServiceName}, Port: r.ServicePort}) {
+				return
+			}
+		}
+	}
 	return
 }
 
@@ -381,6 +470,6 @@ func ServiceKeyFunc(namespace, name string) string {
 }
 
 // NeedsCleanup returns true if the ingress needs to have its associated resources deleted.
-func NeedsCleanup(ing *v1beta1.Ingress) bool {
-	return IsDeletionCandidate(ing.ObjectMeta, FinalizerKey) || !IsGLBCIngress(ing)
+func NeedsCleanup(ing *v1beta1.Ingress, classes IngressClassLookup) bool {
+	return IsDeletionCandidate(ing.ObjectMeta, FinalizerKey) || !IsGLBCIngress(ing, classes)
 }
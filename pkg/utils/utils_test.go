@@ -372,6 +372,36 @@ func TestTraverseIngressBackends(t *testing.T) {
 				},
 			},
 		},
+		{
+			"weighted backends in route actions",
+			&v1beta1.Ingress{
+				ObjectMeta: v1.ObjectMeta{
+					Annotations: map[string]string{
+						annotations.RouteActionsKey: `[{"path":"/*","weightedBackends":[{"serviceName":"stable-service","servicePort":80,"weight":90},{"serviceName":"canary-service","servicePort":"http","weight":10}]}]`,
+					},
+				},
+				Spec: v1beta1.IngressSpec{
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "stable-service",
+						ServicePort: intstr.FromInt(80),
+					},
+				},
+			},
+			[]v1beta1.IngressBackend{
+				{
+					ServiceName: "stable-service",
+					ServicePort: intstr.FromInt(80),
+				},
+				{
+					ServiceName: "stable-service",
+					ServicePort: intstr.FromInt(80),
+				},
+				{
+					ServiceName: "canary-service",
+					ServicePort: intstr.FromString("http"),
+				},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -449,6 +479,60 @@ func TestGetNodeConditionPredicate(t *testing.T) {
 	}
 }
 
+func TestInstanceGroupNodeFilter(t *testing.T) {
+	defer func(unschedulable, notReady bool, taints []string) {
+		flags.F.NodeIncludeUnschedulable = unschedulable
+		flags.F.NodeIncludeNotReady = notReady
+		flags.F.NodeExcludeTaints = taints
+	}(flags.F.NodeIncludeUnschedulable, flags.F.NodeIncludeNotReady, flags.F.NodeExcludeTaints)
+
+	readyCondition := []api_v1.NodeCondition{{Type: api_v1.NodeReady, Status: api_v1.ConditionTrue}}
+	cordoned := api_v1.Node{Spec: api_v1.NodeSpec{Unschedulable: true}, Status: api_v1.NodeStatus{Conditions: readyCondition}}
+	notReady := api_v1.Node{Status: api_v1.NodeStatus{Conditions: []api_v1.NodeCondition{{Type: api_v1.NodeReady, Status: api_v1.ConditionFalse}}}}
+	tainted := api_v1.Node{
+		Spec:   api_v1.NodeSpec{Taints: []api_v1.Taint{{Key: "dedicated", Effect: api_v1.TaintEffectNoSchedule}}},
+		Status: api_v1.NodeStatus{Conditions: readyCondition},
+	}
+	labeled := api_v1.Node{
+		ObjectMeta: v1.ObjectMeta{Labels: map[string]string{LabelNodeExcludeFromExternalLoadBalancers: ""}},
+		Status:     api_v1.NodeStatus{Conditions: readyCondition},
+	}
+
+	testCases := []struct {
+		desc                 string
+		includeUnschedulable bool
+		includeNotReady      bool
+		excludeTaints        []string
+		node                 api_v1.Node
+		expectAccept         bool
+		// expectDefaultAccept is the result of GetNodeConditionPredicate,
+		// which the flags do not change.
+		expectDefaultAccept bool
+	}{
+		{desc: "cordoned node excluded", node: cordoned},
+		{desc: "cordoned node included", includeUnschedulable: true, node: cordoned, expectAccept: true},
+		{desc: "not ready node excluded", node: notReady},
+		{desc: "not ready node included", includeNotReady: true, node: notReady, expectAccept: true},
+		{desc: "tainted node included", node: tainted, expectAccept: true, expectDefaultAccept: true},
+		{desc: "tainted node excluded", excludeTaints: []string{"other", "dedicated"}, node: tainted, expectDefaultAccept: true},
+		{desc: "node excluded from external load balancers", node: labeled, expectDefaultAccept: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			flags.F.NodeIncludeUnschedulable = tc.includeUnschedulable
+			flags.F.NodeIncludeNotReady = tc.includeNotReady
+			flags.F.NodeExcludeTaints = tc.excludeTaints
+			if accept := GetNodeConditionPredicateWithOptions(InstanceGroupNodeFilterOptions())(&tc.node); accept != tc.expectAccept {
+				t.Errorf("instance group node predicate(%+v) = %v, want %v", tc.node, accept, tc.expectAccept)
+			}
+			if accept := GetNodeConditionPredicate()(&tc.node); accept != tc.expectDefaultAccept {
+				t.Errorf("GetNodeConditionPredicate()(%+v) = %v, want %v", tc.node, accept, tc.expectDefaultAccept)
+			}
+		})
+	}
+}
+
 // Do not run in parallel since modifies global flags
 // TODO(shance): remove l7-ilb flag tests once flag is removed
 func TestIsGCEIngress(t *testing.T) {
@@ -533,7 +617,7 @@ func TestIsGCEIngress(t *testing.T) {
 				flags.F.EnableL7Ilb = true
 			}
 
-			result := IsGCEIngress(tc.ingress)
+			result := IsGCEIngress(tc.ingress, nil)
 			if result != tc.expected {
 				t.Fatalf("want %v, got %v", tc.expected, result)
 			}
@@ -585,7 +669,7 @@ func TestIsGCEL7ILBIngress(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.desc, func(t *testing.T) {
-			result := IsGCEL7ILBIngress(tc.ingress)
+			result := IsGCEL7ILBIngress(tc.ingress, nil)
 			if result != tc.expected {
 				t.Fatalf("want %v, got %v", tc.expected, result)
 			}
@@ -593,6 +677,131 @@ func TestIsGCEL7ILBIngress(t *testing.T) {
 	}
 }
 
+func TestIngressClassScopes(t *testing.T) {
+	defer func() {
+		flags.F.IngressClassScopes = flags.IngressClassScopes{}
+		flags.F.EnableL7Ilb = false
+	}()
+	if err := flags.F.IngressClassScopes.Set("internal-apps=regional,external-apps=global"); err != nil {
+		t.Fatalf("IngressClassScopes.Set() = %v", err)
+	}
+	if err := flags.F.IngressClassScopes.Set("bad-apps=zonal"); err == nil {
+		t.Errorf("IngressClassScopes.Set() = nil, want error for invalid scope")
+	}
+
+	testCases := []struct {
+		desc            string
+		class           string
+		enableL7IlbFlag bool
+		wantGCE         bool
+		wantL7ILB       bool
+	}{
+		{
+			desc:    "global class",
+			class:   "external-apps",
+			wantGCE: true,
+		},
+		{
+			desc:    "regional class with L7-ILB disabled",
+			class:   "internal-apps",
+			wantGCE: false,
+			// The class is still regional, it is just not processed.
+			wantL7ILB: true,
+		},
+		{
+			desc:            "regional class with L7-ILB enabled",
+			class:           "internal-apps",
+			enableL7IlbFlag: true,
+			wantGCE:         true,
+			wantL7ILB:       true,
+		},
+		{
+			desc:    "class without scope",
+			class:   "other-apps",
+			wantGCE: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			flags.F.EnableL7Ilb = tc.enableL7IlbFlag
+			ing := &v1beta1.Ingress{
+				ObjectMeta: v1.ObjectMeta{
+					Annotations: map[string]string{annotations.IngressClassKey: tc.class},
+				},
+			}
+			if got := IsGCEIngress(ing, nil); got != tc.wantGCE {
+				t.Errorf("IsGCEIngress() = %v, want %v", got, tc.wantGCE)
+			}
+			if got := IsGCEL7ILBIngress(ing, nil); got != tc.wantL7ILB {
+				t.Errorf("IsGCEL7ILBIngress() = %v, want %v", got, tc.wantL7ILB)
+			}
+		})
+	}
+}
+
+// fakeIngressClasses is an IngressClassLookup with the given classes of the
+// controller and default class.
+type fakeIngressClasses struct {
+	classes      map[string]*IngressClassParams
+	defaultClass string
+}
+
+func (f *fakeIngressClasses) Params(class string) (*IngressClassParams, bool) {
+	params, ok := f.classes[class]
+	return params, ok
+}
+
+func (f *fakeIngressClasses) DefaultClass() string {
+	return f.defaultClass
+}
+
+func TestIsGCEIngressDefaultClass(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		class        string
+		defaultClass string
+		want         bool
+	}{
+		{
+			desc: "no default class",
+			want: true,
+		},
+		{
+			desc:         "default class of the controller",
+			defaultClass: "gce-apps",
+			want:         true,
+		},
+		{
+			desc:         "default class of another controller",
+			defaultClass: "nginx",
+			want:         false,
+		},
+		{
+			desc:         "gce annotation with default class of another controller",
+			class:        annotations.GceIngressClass,
+			defaultClass: "nginx",
+			want:         true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			classes := &fakeIngressClasses{
+				classes:      map[string]*IngressClassParams{"gce-apps": {Scope: flags.ScopeGlobal}},
+				defaultClass: tc.defaultClass,
+			}
+			ing := &v1beta1.Ingress{ObjectMeta: v1.ObjectMeta{Annotations: map[string]string{}}}
+			if tc.class != "" {
+				ing.Annotations[annotations.IngressClassKey] = tc.class
+			}
+			if got := IsGCEIngress(ing, classes); got != tc.want {
+				t.Errorf("IsGCEIngress() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
 func TestNeedsCleanup(t *testing.T) {
 	testCases := []struct {
 		isGLBCIngress       bool
@@ -642,7 +851,7 @@ func TestNeedsCleanup(t *testing.T) {
 				ingress.SetDeletionTimestamp(&ts)
 			}
 
-			if gotNeedsCleanup := NeedsCleanup(ingress); gotNeedsCleanup != tc.expectNeedsCleanup {
+			if gotNeedsCleanup := NeedsCleanup(ingress, nil); gotNeedsCleanup != tc.expectNeedsCleanup {
 				t.Errorf("NeedsCleanup() = %t, want %t (tc = %+v)", gotNeedsCleanup, tc.expectNeedsCleanup, tc)
 			}
 		})
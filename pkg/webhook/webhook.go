@@ -0,0 +1,198 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webhook rejects, at admission, the invalid configurations which the
+// controller otherwise only reports when it syncs them.
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/api/networking/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/ingress-gce/pkg/annotations"
+	backendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/backendconfig/v1beta1"
+	frontendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1"
+	"k8s.io/ingress-gce/pkg/backendconfig"
+	backendconfigclient "k8s.io/ingress-gce/pkg/backendconfig/client/clientset/versioned"
+	"k8s.io/ingress-gce/pkg/frontendconfig"
+	frontendconfigclient "k8s.io/ingress-gce/pkg/frontendconfig/client/clientset/versioned"
+	"k8s.io/klog"
+)
+
+// Validator is a validating admission webhook for the Services, Ingresses,
+// BackendConfigs and FrontendConfigs.
+type Validator struct {
+	kubeClient          kubernetes.Interface
+	backendConfigClient backendconfigclient.Interface
+	// frontendConfigClient is nil if FrontendConfigs are disabled.
+	frontendConfigClient frontendconfigclient.Interface
+}
+
+// NewValidator returns a Validator looking up the configs referenced by the
+// validated objects with the given clients.
+func NewValidator(kubeClient kubernetes.Interface, backendConfigClient backendconfigclient.Interface, frontendConfigClient frontendconfigclient.Interface) *Validator {
+	return &Validator{
+		kubeClient:           kubeClient,
+		backendConfigClient:  backendConfigClient,
+		frontendConfigClient: frontendConfigClient,
+	}
+}
+
+// ServeHTTP handles an AdmissionReview.
+func (v *Validator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	review := &admissionv1beta1.AdmissionReview{}
+	if err := json.Unmarshal(body, review); err != nil || review.Request == nil {
+		http.Error(w, fmt.Sprintf("invalid AdmissionReview: %v", err), http.StatusBadRequest)
+		return
+	}
+	response := &admissionv1beta1.AdmissionResponse{UID: review.Request.UID, Allowed: true}
+	if err := v.Validate(review.Request); err != nil {
+		klog.V(2).Infof("Rejecting %s %s/%s: %v", review.Request.Kind.Kind, review.Request.Namespace, review.Request.Name, err)
+		response.Allowed = false
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Reason:  metav1.StatusReasonInvalid,
+			Message: err.Error(),
+			Code:    http.StatusUnprocessableEntity,
+		}
+	}
+	review.Response = response
+	review.Request = nil
+	out, err := json.Marshal(review)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// Validate returns an error if the object of the admission request is
+// invalid. Deletions and other kinds of objects are always allowed.
+func (v *Validator) Validate(req *admissionv1beta1.AdmissionRequest) error {
+	if req.Operation == admissionv1beta1.Delete {
+		return nil
+	}
+	switch req.Kind.Kind {
+	case "Service":
+		svc := &apiv1.Service{}
+		if err := json.Unmarshal(req.Object.Raw, svc); err != nil {
+			return err
+		}
+		return v.validateService(svc, req.Namespace)
+	case "Ingress":
+		ing := &v1beta1.Ingress{}
+		if err := json.Unmarshal(req.Object.Raw, ing); err != nil {
+			return err
+		}
+		return v.validateIngress(ing, req.Namespace)
+	case "BackendConfig":
+		beConfig := &backendconfigv1beta1.BackendConfig{}
+		if err := json.Unmarshal(req.Object.Raw, beConfig); err != nil {
+			return err
+		}
+		beConfig.Namespace = req.Namespace
+		return backendconfig.Validate(v.kubeClient, beConfig)
+	case "FrontendConfig":
+		feConfig := &frontendconfigv1beta1.FrontendConfig{}
+		if err := json.Unmarshal(req.Object.Raw, feConfig); err != nil {
+			return err
+		}
+		return frontendconfig.Validate(feConfig)
+	}
+	return nil
+}
+
+// validateService validates the NEG and BackendConfig annotations of the
+// Service. Only a missing BackendConfig or an invalid annotation rejects the
+// Service, the BackendConfigs which cannot be looked up are not checked.
+func (v *Validator) validateService(svc *apiv1.Service, namespace string) error {
+	svcAnnotations := annotations.FromService(svc)
+	var errs []error
+	negAnnotation, found, err := svcAnnotations.NEGAnnotation()
+	if err != nil {
+		errs = append(errs, err)
+	} else if found {
+		ports := map[int32]bool{}
+		for _, port := range svc.Spec.Ports {
+			ports[port.Port] = true
+		}
+		for port := range negAnnotation.ExposedPorts {
+			if !ports[port] {
+				errs = append(errs, fmt.Errorf("port %v specified in %q doesn't exist in the service", port, annotations.NEGAnnotationKey))
+			}
+		}
+	}
+
+	if _, _, err := svcAnnotations.NEGHealthCheckPort(); err != nil {
+		errs = append(errs, err)
+	}
+
+	beConfigs, err := svcAnnotations.GetBackendConfigs()
+	switch {
+	case err == annotations.ErrBackendConfigAnnotationMissing:
+	case err != nil:
+		errs = append(errs, err)
+	default:
+		names := map[string]bool{}
+		if beConfigs.Default != "" {
+			names[beConfigs.Default] = true
+		}
+		for _, name := range beConfigs.Ports {
+			names[name] = true
+		}
+		for name := range names {
+			_, err := v.backendConfigClient.CloudV1beta1().BackendConfigs(namespace).Get(name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				errs = append(errs, fmt.Errorf("BackendConfig %s/%s referenced in %q does not exist", namespace, name, annotations.BackendConfigKey))
+			} else if err != nil {
+				klog.Warningf("Not checking BackendConfig %s/%s of Service %s/%s, failed to get it: %v", namespace, name, namespace, svc.Name, err)
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// validateIngress validates the FrontendConfig annotation of the Ingress.
+// Only a missing FrontendConfig rejects the Ingress.
+func (v *Validator) validateIngress(ing *v1beta1.Ingress, namespace string) error {
+	name := annotations.FromIngress(ing).FrontendConfig()
+	if name == "" || v.frontendConfigClient == nil {
+		return nil
+	}
+	_, err := v.frontendConfigClient.NetworkingV1beta1().FrontendConfigs(namespace).Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("FrontendConfig %s/%s referenced in %q does not exist", namespace, name, annotations.FrontendConfigKey)
+	}
+	if err != nil {
+		klog.Warningf("Not checking FrontendConfig %s/%s of Ingress %s/%s, failed to get it: %v", namespace, name, namespace, ing.Name, err)
+	}
+	return nil
+}
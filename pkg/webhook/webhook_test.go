@@ -0,0 +1,145 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/api/networking/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/ingress-gce/pkg/annotations"
+	backendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/backendconfig/v1beta1"
+	frontendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1"
+	backendconfigfake "k8s.io/ingress-gce/pkg/backendconfig/client/clientset/versioned/fake"
+	frontendconfigfake "k8s.io/ingress-gce/pkg/frontendconfig/client/clientset/versioned/fake"
+)
+
+func request(t *testing.T, kind string, obj interface{}) *admissionv1beta1.AdmissionRequest {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatalf("json.Marshal() = %v", err)
+	}
+	return &admissionv1beta1.AdmissionRequest{
+		UID:       "uid",
+		Kind:      metav1.GroupVersionKind{Kind: kind},
+		Namespace: "default",
+		Operation: admissionv1beta1.Create,
+		Object:    runtime.RawExtension{Raw: raw},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	existing := &backendconfigv1beta1.BackendConfig{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"}}
+	existingFE := &frontendconfigv1beta1.FrontendConfig{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"}}
+	v := NewValidator(fake.NewSimpleClientset(), backendconfigfake.NewSimpleClientset(existing), frontendconfigfake.NewSimpleClientset(existingFE))
+
+	service := func(svcAnnotations map[string]string) *apiv1.Service {
+		return &apiv1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "svc", Annotations: svcAnnotations},
+			Spec:       apiv1.ServiceSpec{Ports: []apiv1.ServicePort{{Port: 80}}},
+		}
+	}
+	ingress := func(feConfig string) *v1beta1.Ingress {
+		return &v1beta1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "ing", Annotations: map[string]string{annotations.FrontendConfigKey: feConfig}}}
+	}
+
+	for _, tc := range []struct {
+		desc    string
+		req     *admissionv1beta1.AdmissionRequest
+		wantErr bool
+	}{
+		{"plain Service", request(t, "Service", service(nil)), false},
+		{"valid NEG annotation", request(t, "Service", service(map[string]string{annotations.NEGAnnotationKey: `{"exposed_ports":{"80":{}}}`})), false},
+		{"malformed NEG annotation", request(t, "Service", service(map[string]string{annotations.NEGAnnotationKey: `{"ingress":tru}`})), true},
+		{"NEG for unknown port", request(t, "Service", service(map[string]string{annotations.NEGAnnotationKey: `{"exposed_ports":{"443":{}}}`})), true},
+		{"invalid NEG health check port", request(t, "Service", service(map[string]string{annotations.NEGHealthCheckPortKey: "0"})), true},
+		{"existing BackendConfig", request(t, "Service", service(map[string]string{annotations.BackendConfigKey: `{"default":"config"}`})), false},
+		{"missing BackendConfig", request(t, "Service", service(map[string]string{annotations.BackendConfigKey: `{"ports":{"80":"other"}}`})), true},
+		{"existing FrontendConfig", request(t, "Ingress", ingress("config")), false},
+		{"missing FrontendConfig", request(t, "Ingress", ingress("other")), true},
+		{"IAP and CDN", request(t, "BackendConfig", &backendconfigv1beta1.BackendConfig{
+			Spec: backendconfigv1beta1.BackendConfigSpec{
+				Iap: &backendconfigv1beta1.IAPConfig{Enabled: true},
+				Cdn: &backendconfigv1beta1.CDNConfig{Enabled: true},
+			},
+		}), true},
+		{"invalid FrontendConfig", request(t, "FrontendConfig", &frontendconfigv1beta1.FrontendConfig{
+			Spec: frontendconfigv1beta1.FrontendConfigSpec{QuicOverride: "SOMETIMES"},
+		}), true},
+	} {
+		if err := v.Validate(tc.req); (err != nil) != tc.wantErr {
+			t.Errorf("%s: Validate() = %v, want error: %t", tc.desc, err, tc.wantErr)
+		}
+	}
+}
+
+func TestValidateLookupErrors(t *testing.T) {
+	beClient := backendconfigfake.NewSimpleClientset()
+	beClient.PrependReactor("get", "backendconfigs", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewServiceUnavailable("apiserver unavailable")
+	})
+	feClient := frontendconfigfake.NewSimpleClientset()
+	feClient.PrependReactor("get", "frontendconfigs", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "frontendconfigs"}, "config", nil)
+	})
+	v := NewValidator(fake.NewSimpleClientset(), beClient, feClient)
+
+	svc := &apiv1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "svc", Annotations: map[string]string{annotations.BackendConfigKey: `{"default":"config"}`}},
+		Spec:       apiv1.ServiceSpec{Ports: []apiv1.ServicePort{{Port: 80}}},
+	}
+	if err := v.Validate(request(t, "Service", svc)); err != nil {
+		t.Errorf("Validate(Service) = %v, want nil as the BackendConfig could not be looked up", err)
+	}
+	ing := &v1beta1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "ing", Annotations: map[string]string{annotations.FrontendConfigKey: "config"}}}
+	if err := v.Validate(request(t, "Ingress", ing)); err != nil {
+		t.Errorf("Validate(Ingress) = %v, want nil as the FrontendConfig could not be looked up", err)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	v := NewValidator(fake.NewSimpleClientset(), backendconfigfake.NewSimpleClientset(), nil)
+	svc := &apiv1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Annotations: map[string]string{annotations.NEGAnnotationKey: "{"}}}
+	body, err := json.Marshal(&admissionv1beta1.AdmissionReview{Request: request(t, "Service", svc)})
+	if err != nil {
+		t.Fatalf("json.Marshal() = %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	v.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP() returned %d, want %d", w.Code, http.StatusOK)
+	}
+	review := &admissionv1beta1.AdmissionReview{}
+	if err := json.Unmarshal(w.Body.Bytes(), review); err != nil {
+		t.Fatalf("json.Unmarshal(%q) = %v", w.Body.String(), err)
+	}
+	if review.Response == nil || review.Response.UID != "uid" || review.Response.Allowed || review.Response.Result == nil {
+		t.Errorf("response = %+v, want a rejection of request uid", review.Response)
+	}
+}